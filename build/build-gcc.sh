@@ -1,2 +1,2 @@
 #!/bin/bash
-go build -o dist/PiwigoDirectoryUploader cmd/PiwigoDirectoryUploader/PiwigoDirectoryUploader.go
\ No newline at end of file
+go build -o dist/PiwigoDirectoryUploader --ldflags "-X git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/app.version=$(git describe --tags --always)" cmd/PiwigoDirectoryUploader/PiwigoDirectoryUploader.go
\ No newline at end of file
@@ -1,2 +1,2 @@
 #!/bin/bash
-CC=musl-gcc go build -o dist/PiwigoDirectoryUploaderMusl --ldflags '-linkmode external -extldflags "-static"' ./cmd/PiwigoDirectoryUploader/PiwigoDirectoryUploader.go
\ No newline at end of file
+CC=musl-gcc go build -o dist/PiwigoDirectoryUploaderMusl --ldflags "-linkmode external -extldflags \"-static\" -X git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/app.version=$(git describe --tags --always)" ./cmd/PiwigoDirectoryUploader/PiwigoDirectoryUploader.go
\ No newline at end of file
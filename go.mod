@@ -10,4 +10,5 @@ require (
 	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/vharitonsky/iniflags v0.0.0-20180513140207-a33cd0b5f3de
 	golang.org/x/sys v0.0.0-20200406155108-e3b113bbe6a4 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
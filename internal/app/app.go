@@ -6,66 +6,745 @@
 package app
 
 import (
+	gocontext "context"
+	"errors"
+	"flag"
+	"fmt"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/category"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/hooks"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/images"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/manifest"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/selftest"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+var logWriter io.WriteCloser
+
+// functions that have to run on every exit of the application, even on errors and signals
+var cleanupFunctions []func()
+
+var runExitCode int
+
+// guards the cleanup functions and the exit code, as a signal terminates the application while the run goes on
+var cleanupMutex sync.Mutex
+
+// cancelled on termination to abort the requests to the server that are still in flight
+var runContext, cancelRunContext = gocontext.WithCancel(gocontext.Background())
+
 func Run() {
+	startTime := time.Now()
 	initializeFlags()
 	initializeLog()
+	defer runCleanup()
+	handleSignals()
+
+	stopProfiles, err := startProfiles(*cpuProfile, *memProfile)
+	if err != nil {
+		logErrorAndExit(err, 1)
+	}
+	registerCleanup(stopProfiles)
+
+	config := effectiveConfig(flag.CommandLine)
+	logrus.Infof("Effective configuration: %s", effectiveConfigSummary(config))
+	if *printConfig {
+		err := writeEffectiveConfig(os.Stdout, config)
+		if err != nil {
+			logErrorAndExit(err, 1)
+		}
+		return
+	}
+
+	if *exportTree != "" {
+		runTreeExport()
+		return
+	}
 
 	context, err := newAppContext()
 	if err != nil {
 		logErrorAndExit(err, 1)
 	}
 
-	err = context.piwigo.Login()
+	if *pushGatewayUrl != "" {
+		registerCleanup(func() {
+			pushRunMetrics(context, startTime)
+		})
+	}
+
+	if *noLogin {
+		err = context.piwigo.VerifySession()
+		if err != nil {
+			logErrorAndExit(err, 2)
+		}
+	}
+
+	if *selfTest {
+		runSelfTest(context)
+		return
+	}
+
+	if *manifestFile != "" {
+		runManifest(context)
+		return
+	}
+
+	if *diffServer != "" {
+		runDiffServer(context)
+		return
+	}
+
+	if *planFile != "" {
+		runPlan(context)
+		return
+	}
+
+	if *applyPlan != "" {
+		runApplyPlan(context)
+		return
+	}
+
+	if *listCategories {
+		err = loginWithRetries(context)
+		if err != nil {
+			logErrorAndExit(err, 2)
+		}
+		err = category.PrintCategoryTree(context.piwigo, os.Stdout, *jsonOutput)
+		logout(context)
+		if err != nil {
+			logErrorAndExit(err, 9)
+		}
+		return
+	}
+
+	if *dedupeCategories {
+		err = printDuplicates(context)
+		if err != nil {
+			logErrorAndExit(err, 12)
+		}
+		return
+	}
+
+	formatter, err := newReportFormatter()
+	if err != nil {
+		logErrorAndExit(err, 1)
+	}
+
+	if *interval > 0 {
+		runDaemon(context, formatter)
+		return
+	}
+
+	targets, exitCode, err := loginTargets(context)
 	if err != nil {
 		logErrorAndExit(err, 2)
 	}
 
-	filesystemNodes, err := localFileStructure.ScanLocalFileStructure(context.localRootPath, extensions, ignoreDirs, *dirSuffixToSkip)
+	filesystemNodes, err := scanLocalFiles(context)
 	if err != nil {
 		logErrorAndExit(err, 3)
 	}
 
-	err = category.SynchronizeCategories(filesystemNodes, context.piwigo, context.dataStore)
+	applyCategoryKeys(filesystemNodes)
+
+	if *statsOnly {
+		for _, target := range targets {
+			err = printReconciliation(target, filesystemNodes, len(targets) > 1)
+			logout(target)
+			if err != nil {
+				logErrorAndExit(err, 10)
+			}
+		}
+		return
+	}
+
+	syncExitCode := synchronizeTargets(context, targets, filesystemNodes, formatter)
+	for _, target := range targets {
+		_ = target.piwigo.Logout()
+	}
+	if exitCode == 0 {
+		exitCode = syncExitCode
+	}
+
+	if exitCode != 0 {
+		exit(exitCode)
+	}
+}
+
+// Synchronizes the local files to all installations, logs their results and writes the run report. Returns the exit
+// code of the first installation that failed.
+func synchronizeTargets(context *appContext, targets []*appContext, filesystemNodes map[string]*localFileStructure.FilesystemNode, formatter report.Formatter) int {
+	exitCode := 0
+	concurrencyOverrides := readConcurrencyOverrides(context, filesystemNodes)
+	for _, target := range targets {
+		if len(targets) > 1 {
+			logrus.Infof("Synchronizing %s", target.targetName)
+		}
+		targetExitCode, err := synchronizeTarget(target, filesystemNodes, concurrencyOverrides)
+		if err != nil {
+			logrus.Errorf("Synchronizing %s failed: %s", target.targetName, err)
+			if exitCode == 0 {
+				exitCode = targetExitCode
+			}
+		}
+	}
+
+	for _, target := range targets {
+		if len(targets) > 1 {
+			logrus.Infof("Results of %s", target.targetName)
+		}
+		target.report.Log()
+	}
+
+	if formatter != nil {
+		err := writeRunReport(formatter, targets)
+		if err != nil {
+			logrus.Error(err)
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+	}
+	return exitCode
+}
+
+// Uploads the entries of the manifest to the primary installation and prints the result of every entry. Exits with 13
+// if the manifest could not be read or an entry failed.
+func runManifest(context *appContext) {
+	entries, err := manifest.Read(*manifestFile)
+	if err != nil {
+		logErrorAndExit(err, 13)
+	}
+
+	err = loginWithRetries(context)
+	if err != nil {
+		logErrorAndExit(err, 2)
+	}
+
+	options := manifest.Options{
+		CreateCategories:   *createCategories,
+		ChecksumCalculator: context.checksumCalculator,
+		CategorySettings:   defaultCategorySettings(),
+		DeferMetadata:      *deferMetadata,
+		ParallelRequests:   *parallelUploads,
+	}
+	results, err := manifest.Upload(context.piwigo, context.piwigo, entries, options)
+	_ = context.piwigo.Logout()
+	if err != nil {
+		logErrorAndExit(err, 13)
+	}
+	err = manifest.WriteResults(os.Stdout, results, *jsonOutput)
+	if err != nil {
+		logErrorAndExit(err, 13)
+	}
+	if failed := manifest.Failed(results); failed > 0 {
+		logErrorAndExit(errors.New(fmt.Sprintf("%d of %d manifest entries failed", failed, len(results))), 13)
+	}
+}
+
+// Runs the self-test against the primary installation and exits with 11 if an operation failed.
+func runSelfTest(context *appContext) {
+	err := context.piwigo.Login()
+	if err != nil {
+		logErrorAndExit(errors.New(fmt.Sprintf("self-test failed to log in: %s", err)), 2)
+	}
+
+	err = selftest.Run(context.piwigo, context.piwigo, context.workDir)
+	_ = context.piwigo.Logout()
+	if err != nil {
+		logErrorAndExit(err, 11)
+	}
+	fmt.Println("self-test passed")
+}
+
+// Logs in to the piwigo installations. In the failover mode only the first installation accepting the login is
+// returned, otherwise all installations that accepted the login and the exit code of the failed logins.
+func loginTargets(context *appContext) ([]*appContext, int, error) {
+	var targets []*appContext
+	exitCode := 0
+	for _, target := range context.targets() {
+		err := loginWithRetries(target)
+		if err != nil {
+			if len(context.secondaries) == 0 {
+				return nil, 0, err
+			}
+			logrus.Errorf("Login to %s failed: %s", target.targetName, err)
+			exitCode = 2
+			continue
+		}
+
+		targets = append(targets, target)
+		if *targetMode == targetModeFailover {
+			return targets, 0, nil
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, 0, errors.New("the login to all piwigo installations failed")
+	}
+	return targets, exitCode, nil
+}
+
+// Logs out of the piwigo installation unless the session is borrowed by noLogin, as logging out would end the session
+// of the browser.
+func logout(target *appContext) {
+	if !target.borrowedSession {
+		_ = target.piwigo.Logout()
+	}
+}
+
+// Writes the local images that are in more than one category to stdout. Only the local files and the metadata store
+// are read, so no login is required.
+func printDuplicates(context *appContext) error {
+	filesystemNodes, err := scanLocalFiles(context)
 	if err != nil {
-		logErrorAndExit(err, 4)
+		return err
 	}
+	applyCategoryKeys(filesystemNodes)
+
+	duplicates := images.FindDuplicates(context.dataStore, filesystemNodes, context.checksumCalculator)
+	return images.WriteDuplicates(os.Stdout, duplicates, *jsonOutput)
+}
 
-	err = images.SynchronizeLocalImageMetadata(context.dataStore, context.dataStore, filesystemNodes, localFileStructure.CalculateFileCheckSums)
+// Writes how the local images diverge from the server to stdout without changing anything.
+func printReconciliation(context *appContext, filesystemNodes map[string]*localFileStructure.FilesystemNode, withName bool) error {
+	context.piwigo.UseLocalCategoryKeys(context.categoryNames.LocalKeys(filesystemNodes))
+	filesystemNodes, err := managedNodes(context, filesystemNodes)
 	if err != nil {
-		logErrorAndExit(err, 5)
+		return err
 	}
+	filesystemNodes, _ = pairRawFiles(filesystemNodes)
+	imageNodes, err := localFileStructure.SkipImagesIn(filesystemNodes, skipImagesIn)
+	if err != nil {
+		return err
+	}
+	reconciliation, err := images.ReconcileImages(context.piwigo, context.piwigo, context.dataStore, imageNodes, context.checksumCalculator)
+	if err != nil {
+		return err
+	}
+
+	if withName && !*jsonOutput {
+		fmt.Printf("%s\n", context.targetName)
+	}
+	return images.WriteReconciliation(os.Stdout, reconciliation, *jsonOutput)
+}
 
-	err = images.SynchronizePiwigoMetadata(context.piwigo, context.dataStore)
+// Synchronizes the scanned files to a single piwigo installation. Returns the exit code of the failed step.
+func synchronizeTarget(context *appContext, filesystemNodes map[string]*localFileStructure.FilesystemNode, concurrencyOverrides *localFileStructure.ConcurrencyOverrides) (int, error) {
+	run, err := startRun(context)
 	if err != nil {
-		logErrorAndExit(err, 6)
+		return 5, err
+	}
+
+	context.piwigo.UseLocalCategoryKeys(context.categoryNames.LocalKeys(filesystemNodes))
+	filesystemNodes, err = managedNodes(context, filesystemNodes)
+	if err != nil {
+		return 4, err
+	}
+	filesystemNodes, rawPairs := pairRawFiles(filesystemNodes)
+
+	categoryOptions := category.SynchronizeOptions{
+		RankOrder:        *categoryRank,
+		NumberOfWorkers:  *parallelCategories,
+		Settings:         readCategorySettings(context, filesystemNodes),
+		RetryInitialLoad: retryCategoryLoad(context),
+		Names:            context.categoryNames,
+		Match:            *categoryMatch,
+		Collision:        *categoryCollision,
+		Case:             *categoryCase,
+	}
+	if *continueOnAlbumError {
+		categoryOptions.Failures = category.NewCategoryFailures()
+	}
+	err = category.SynchronizeCategories(filesystemNodes, context.piwigo, context.dataStore, context.dataStore, categoryOptions)
+	if err != nil {
+		return 4, err
+	}
+	filesystemNodes = skipFailedCategories(context, filesystemNodes, categoryOptions.Failures)
+
+	imageNodes, err := localFileStructure.SkipImagesIn(filesystemNodes, skipImagesIn)
+	if err != nil {
+		return 3, err
+	}
+	imageNodes, fileProblems, err := localFileStructure.CheckFiles(imageNodes, *onEmptyFile)
+	if err != nil {
+		return 3, err
+	}
+	reportFileProblems(context, fileProblems)
+	localNodes := imageNodes
+	if *resumeWithinAlbums {
+		localNodes, err = images.SkipCompletedAlbumFiles(context.dataStore, imageNodes)
+		if err != nil {
+			return 5, err
+		}
+	}
+
+	err = images.SynchronizeLocalImageMetadata(context.dataStore, context.dataStore, localNodes, context.checksumCalculator, *hashConcurrency, *compareBy, *detectMovedFiles)
+	if err != nil {
+		return 5, err
+	}
+
+	err = images.ResumeInterruptedUploads(context.piwigo, context.dataStore)
+	if err != nil {
+		return 6, err
+	}
+
+	err = images.UpdateMovedImages(context.piwigo, context.dataStore)
+	if err != nil {
+		return 6, err
+	}
+
+	err = images.SynchronizePiwigoMetadata(context.piwigo, context.dataStore, *onConflict, *reconcileExisting, *compareBy)
+	if err != nil {
+		return 6, err
+	}
+
+	if *detectServerDeletions {
+		deletionOptions := images.ServerDeletionOptions{
+			SamplePercent:    *serverDeletionSample,
+			RunId:            run.RunId,
+			ParallelRequests: *parallelUploads,
+		}
+		err = images.DetectServerDeletions(context.piwigo, context.dataStore, deletionOptions)
+		if err != nil {
+			return 6, err
+		}
 	}
 
 	if *removeImages {
-		err = images.DeleteImages(context.piwigo, context.dataStore)
+		err = images.DeleteImages(context.piwigo, context.dataStore, context.prompt)
 		if err != nil {
-			logErrorAndExit(err, 7)
+			return 7, err
 		}
 	} else {
 		logrus.Info("The flag removeImages is disabled. Skipping...")
 	}
 
 	if !(*noUpload) {
-		err = images.UploadImages(context.piwigo, context.dataStore, *parallelUploads)
+		var albumCursors *images.AlbumCursors
+		if *resumeWithinAlbums {
+			albumCursors, err = images.NewAlbumCursors(context.dataStore, context.dataStore, imageNodes)
+			if err != nil {
+				return 5, err
+			}
+		}
+
+		uploaded := images.NewUploadedImages()
+		var deferred datastore.DeferredMetadataProvider
+		if *deferMetadata {
+			// the covers are chosen from the saved metadata in the metadata phase
+			uploaded = nil
+			deferred = context.dataStore
+		}
+		uploadOptions := images.UploadOptions{
+			NumberOfWorkers:       *parallelUploads,
+			MaxActiveAlbums:       *parallelAlbums,
+			ConcurrencyOverrides:  concurrencyOverrides,
+			MaxImageSizeInMB:      maxImageSizeInMB(context.piwigo),
+			FailOnOversizedImages: *failOnOversizedImages,
+			ValidateImages:        *validateImages,
+			MinImageWidth:         *minImageWidth,
+			MinImageHeight:        *minImageHeight,
+			SetDateAvailable:      *setDateAvailable,
+			DateCreationFrom:      *dateCreationFrom,
+			Timezone:              serverTimezone(),
+			MetadataFromIptc:      *metadataFromIptc,
+			NameSuffix:            *uniqueImageNames,
+			AlbumAtomic:           *albumAtomic,
+			PreviewFirst:          *previewFirst,
+			WorkDir:               context.workDir,
+			SetDimensions:         *setDimensions,
+			GenerateDerivatives:   *generateDerivatives,
+			KeepOriginal:          *keepOriginal,
+			VerifyMode:            *verifyMode,
+			Transformations:       context.transforms,
+			UploadOrder:           *uploadOrder,
+			PreUploadHook:         hooks.NewHook(runContext, "pre upload", *preUploadHook, *hookTimeout),
+			PostUploadHook:        hooks.NewHook(runContext, "post upload", *postUploadHook, *hookTimeout),
+			RequirePostUploadHook: *requirePostUploadHook,
+			MaxUploadFailures:     *maxUploadFailures,
+			RetryQuarantined:      *retryQuarantined,
+			NewerThanServer:       *newerThanServer,
+			OnFileChanged:         *onFileChanged,
+			ChecksumCalculator:    context.checksumCalculator,
+			Uploaded:              uploaded,
+			AlbumCursors:          albumCursors,
+			DeferredMetadata:      deferred,
+			RunId:                 run.RunId,
+			Report:                context.report,
+		}
+		if *clearQuarantine {
+			logrus.Infoln("Clearing the failed uploads of quarantined images")
+			err = context.dataStore.ClearImageFailures()
+			if err != nil {
+				return 8, err
+			}
+		}
+		progress := startProgress(context)
+		err = images.UploadImages(context.piwigo, context.dataStore, uploadOptions)
+		progress.Stop()
 		if err != nil {
-			logErrorAndExit(err, 8)
+			return 8, err
+		}
+
+		if !*deferMetadata {
+			err = describeUploadedImages(context, uploaded)
+			if err != nil {
+				return 8, err
+			}
+		}
+
+		if len(rawPairs) > 0 {
+			err = images.AttachRawFormats(context.piwigo, context.dataStore, context.dataStore, rawPairs)
+			if err != nil {
+				return 8, err
+			}
 		}
 	} else {
 		logrus.Warnln("Skipping upload of images as flag noUpload is set to true!")
 	}
 
-	_ = context.piwigo.Logout()
+	if *deferMetadata {
+		err = applyDeferredMetadata(context)
+		if err != nil {
+			return 8, err
+		}
+	}
+
+	err = context.dataStore.FinishRun(run, time.Now())
+	if err != nil {
+		return 5, err
+	}
+	return 0, nil
+}
+
+// Sets the covers and uploads the contact sheets of the categories images got uploaded to.
+func describeUploadedImages(context *appContext, uploaded *images.UploadedImages) error {
+	err := images.SetCategoryCovers(context.piwigo, context.dataStore, context.dataStore, uploaded, *coverPolicy, *overrideCover)
+	if err != nil {
+		return err
+	}
+
+	if !*generateContactSheet {
+		return nil
+	}
+	contactSheetOptions := images.ContactSheetOptions{
+		Columns:   *contactSheetColumns,
+		Rows:      *contactSheetRows,
+		Width:     *contactSheetWidth,
+		Height:    *contactSheetHeight,
+		MinImages: *contactSheetMinImages,
+		AsCover:   *contactSheetAsCover,
+		WorkDir:   context.workDir,
+	}
+	return images.UploadContactSheets(context.piwigo, context.piwigo, context.dataStore, context.dataStore, uploaded, contactSheetOptions)
+}
+
+// The metadata phase of deferMetadata. It also completes the metadata of earlier runs that got interrupted, even if
+// noUpload is set. The saved metadata is only removed after all of it got set.
+func applyDeferredMetadata(context *appContext) error {
+	uploaded, err := images.ApplyDeferredMetadata(context.piwigo, context.dataStore, *parallelUploads)
+	if err != nil {
+		return err
+	}
+	err = describeUploadedImages(context, uploaded)
+	if err != nil {
+		return err
+	}
+	return context.dataStore.DeleteDeferredMetadata()
+}
+
+// Starts a new run in the metadata store. A run that did not finish crashed or got killed, its interrupted
+// uploads are reconciled before the images get synchronized.
+func startRun(context *appContext) (datastore.RunData, error) {
+	unfinished, err := context.dataStore.UnfinishedRun()
+	if err == nil {
+		logrus.Warnf("Resuming run %d started at %s that did not finish", unfinished.RunId, unfinished.StartTime.Format(time.RFC3339))
+	} else if err != datastore.ErrorRecordNotFound {
+		return datastore.RunData{}, err
+	}
+
+	return context.dataStore.StartRun(time.Now())
+}
+
+// Adds the files that were skipped as they are empty or can not be read to the report of the run.
+func reportFileProblems(context *appContext, problems []localFileStructure.FileProblem) {
+	for _, problem := range problems {
+		if problem.Empty {
+			context.report.AddSkipped(problem.Path, problem.Reason)
+		} else {
+			context.report.AddFailed(problem.Path, problem.Reason)
+		}
+	}
+}
+
+// Removes the files of the categories that could not be created and adds the categories to the report of the run.
+func skipFailedCategories(context *appContext, filesystemNodes map[string]*localFileStructure.FilesystemNode, failures *category.CategoryFailures) map[string]*localFileStructure.FilesystemNode {
+	filesystemNodes, skipped := failures.SkipFiles(filesystemNodes)
+	for _, failed := range skipped {
+		reason := fmt.Sprintf("the category %s could not be created, skipped %d images - %s", failed.Key, failed.Files, failed.Reason)
+		context.report.AddSkipped(failed.Path, reason)
+	}
+	return filesystemNodes
+}
+
+// Applies the rawJpegPolicy to the scanned files. Returns the files to synchronize and the raw files to attach as
+// format by the path of their JPEG. The raw files that are only scanned to be attached are not synchronized.
+func pairRawFiles(filesystemNodes map[string]*localFileStructure.FilesystemNode) (map[string]*localFileStructure.FilesystemNode, map[string]*localFileStructure.FilesystemNode) {
+	if *rawJpegPolicy == rawJpegPolicyBoth {
+		return filesystemNodes, nil
+	}
+
+	pairs := localFileStructure.FindRawPairs(filesystemNodes)
+	filesystemNodes = localFileStructure.WithoutPairedRawFiles(filesystemNodes, pairs)
+	if *rawJpegPolicy == rawJpegPolicyJpegOnly {
+		logrus.Infof("Skipping %d raw files with a JPEG", len(pairs))
+		return filesystemNodes, nil
+	}
+
+	configured := make(map[string]struct{}, len(extensions))
+	for _, extension := range extensions {
+		configured["."+strings.ToLower(extension)] = struct{}{}
+	}
+	for path, node := range filesystemNodes {
+		_, isConfigured := configured[strings.ToLower(filepath.Ext(path))]
+		if !node.IsDir && !isConfigured && localFileStructure.IsRawFile(path) {
+			delete(filesystemNodes, path)
+		}
+	}
+	return filesystemNodes, pairs
+}
+
+// The time zone of the timezone flag, which is validated with the other flags. Nil uses the local time zone.
+func serverTimezone() *time.Location {
+	if *timezone == "" {
+		return nil
+	}
+	zone, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return nil
+	}
+	return zone
+}
+
+// The maximum size of the uploaded images of the maxImageSizeMB flag. Zero uses the maximum upload size reported by
+// the server, a negative value disables the check.
+func maxImageSizeInMB(server *piwigo.ServerContext) int {
+	if *maxImageSizeMB < 0 {
+		return 0
+	}
+	if *maxImageSizeMB == 0 {
+		return server.MaxUploadSizeInMB()
+	}
+	return *maxImageSizeMB
+}
+
+// The raw files are scanned to pair them with their JPEG even if their extensions are not configured.
+func scanExtensions() []string {
+	if *rawJpegPolicy != rawJpegPolicyLinked {
+		return extensions
+	}
+	scanned := append([]string{}, extensions...)
+	if len(scanned) == 0 {
+		scanned = append(scanned, "jpg", "png")
+	}
+	return append(scanned, localFileStructure.RawExtensions...)
+}
+
+// The images of an archive are not below a directory that could contain a concurrency marker file.
+func readConcurrencyOverrides(context *appContext, filesystemNodes map[string]*localFileStructure.FilesystemNode) *localFileStructure.ConcurrencyOverrides {
+	if *archive != "" {
+		return nil
+	}
+	return localFileStructure.ReadConcurrencyOverrides(context.localRootPath, filesystemNodes)
+}
+
+// The images of an archive are not below a directory that could contain a marker file with category settings.
+func readCategorySettings(context *appContext, filesystemNodes map[string]*localFileStructure.FilesystemNode) *category.Settings {
+	if *archive != "" {
+		return category.ReadSettings("", nil, defaultCategorySettings())
+	}
+	return category.ReadSettings(context.localRootPath, filesystemNodes, defaultCategorySettings())
+}
+
+// Only sends the comment setting if the flag is given, so the default of the server applies otherwise.
+func defaultCategorySettings() piwigo.CategorySettings {
+	settings := piwigo.CategorySettings{Status: *defaultAlbumStatus}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "albumsCommentable" {
+			settings.Commentable = albumsCommentable
+		}
+	})
+	return settings
+}
+
+// Changes the keys of the scanned nodes to the keys of the categories they get, e.g. without the rank prefixes, and
+// removes the directories that get no category.
+func applyCategoryKeys(filesystemNodes map[string]*localFileStructure.FilesystemNode) {
+	if !*createEmptyAlbums {
+		localFileStructure.RemoveEmptyDirectories(filesystemNodes)
+	}
+	if *stripRankPrefix {
+		localFileStructure.StripRankPrefixes(filesystemNodes)
+	}
+	if *categoryLayout == category.LayoutFlat {
+		category.FlattenLayout(filesystemNodes)
+	}
+}
+
+func scanLocalFiles(context *appContext) (map[string]*localFileStructure.FilesystemNode, error) {
+	if *archive != "" {
+		registerCleanup(localFileStructure.CloseArchives)
+		return localFileStructure.ScanArchive(*archive, scanExtensions(), ignoreDirs, *dirSuffixToSkip)
+	}
+
+	if *filesFrom == "" {
+		depthLimit := localFileStructure.DepthLimit{MaxDepth: *maxDepth, Flatten: *flattenBelowMaxDepth}
+		return localFileStructure.ScanLocalFileStructure(context.localRootPath, scanExtensions(), ignoreDirs, includes, *dirSuffixToSkip, depthLimit)
+	}
+
+	if *filesFrom == "-" {
+		logrus.Infoln("Reading the files to upload from stdin")
+		return localFileStructure.ScanFileList(os.Stdin, context.localRootPath, *dirSuffixToSkip)
+	}
+
+	file, err := os.Open(*filesFrom)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return localFileStructure.ScanFileList(file, context.localRootPath, *dirSuffixToSkip)
+}
+
+// The progress line is only written to a terminal unless it is enabled explicitly.
+func startProgress(context *appContext) *report.Progress {
+	if *quiet || !(*showProgress || isTerminal(os.Stderr)) {
+		return nil
+	}
+
+	imagesToUpload, err := context.dataStore.ImageMetadataToUpload()
+	if err != nil || len(imagesToUpload) == 0 {
+		return nil
+	}
+	return report.StartProgress(context.report, len(imagesToUpload), os.Stderr, 2*time.Second)
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func initializeLog() {
@@ -75,12 +754,90 @@ func initializeLog() {
 	}
 	logrus.SetLevel(level)
 
-	logrus.SetOutput(os.Stdout)
+	invalidLogFormat := false
+	switch *logFormat {
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	default:
+		invalidLogFormat = true
+	}
+
+	if *logFile != "" {
+		logWriter = &lumberjack.Logger{
+			Filename:   *logFile,
+			MaxSize:    *logFileMaxSizeMB,
+			MaxBackups: *logFileMaxBackups,
+		}
+		logrus.SetOutput(logWriter)
+	} else {
+		logrus.SetOutput(os.Stdout)
+	}
 
 	logrus.Infoln("Starting Piwigo directories to albums...")
+	if invalidLogFormat {
+		logrus.Warnf("Unknown log format %s, using text. Use one of text or json", *logFormat)
+	}
+}
+
+func registerCleanup(cleanup func()) {
+	cleanupMutex.Lock()
+	defer cleanupMutex.Unlock()
+	cleanupFunctions = append(cleanupFunctions, cleanup)
+}
+
+func runCleanup() {
+	cleanupMutex.Lock()
+	defer cleanupMutex.Unlock()
+	runCleanupFunctions()
+}
+
+// Runs the cleanup functions once and closes the log. The caller holds the cleanupMutex.
+func runCleanupFunctions() {
+	for i := len(cleanupFunctions) - 1; i >= 0; i-- {
+		cleanupFunctions[i]()
+	}
+	cleanupFunctions = nil
+	closeLog()
+}
+
+func closeLog() {
+	if logWriter == nil {
+		return
+	}
+	_ = logWriter.Close()
+	logWriter = nil
+	logrus.SetOutput(os.Stdout)
+}
+
+// Terminates the application on SIGINT and SIGTERM after the pending log lines are written to the log file. A daemon
+// waiting for its next synchronization stops without an error.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		if atomic.LoadInt32(&daemonIdle) == 1 {
+			logrus.Infof("Received signal %s. Stopping the daemon...", sig)
+			exit(0)
+		}
+		logrus.Warnf("Received signal %s. Terminating...", sig)
+		cancelRunContext()
+		exit(130)
+	}()
 }
 
 func logErrorAndExit(err error, exitCode int) {
 	logrus.Errorln(err)
+	exit(exitCode)
+}
+
+// Runs the cleanup and exits. The lock is kept, so a concurrent exit, e.g. of a signal while the run fails, blocks until
+// the application terminated.
+func exit(exitCode int) {
+	cleanupMutex.Lock()
+	runExitCode = exitCode
+	runCleanupFunctions()
 	os.Exit(exitCode)
 }
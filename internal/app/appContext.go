@@ -7,17 +7,43 @@ package app
 
 import (
 	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/category"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/confirm"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/transform"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
 	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 type appContext struct {
 	// think again if this is a good idea to have such a context!
-	piwigo        *piwigo.ServerContext
-	dataStore     *datastore.LocalDataStore
-	sessionId     string
-	localRootPath string
+	piwigo     *piwigo.ServerContext
+	dataStore  *datastore.LocalDataStore
+	report     *report.Report
+	workDir    *workdir.WorkDir
+	transforms *transform.Pipeline
+	prompt     *confirm.Prompt
+	// the names of the created categories, nil names them like their directories
+	categoryNames *category.NameMap
+	// calculates the md5sum for piwigo and the checksum to detect local changes
+	checksumCalculator localFileStructure.ChecksumCalculator
+	sessionId          string
+	localRootPath      string
+	// the name of the piwigo installation used in the log
+	targetName string
+	// the session given by sessionCookie is used, so there is no login and the session must not be logged out
+	borrowedSession bool
+	// the additional piwigo installations that get the same images
+	secondaries []*appContext
+	// shared by all installations as they upload through the same uplink
+	bandwidth *piwigo.BandwidthLimiter
 }
 
 func (c *appContext) useMetadataStore(connectionString string) error {
@@ -27,9 +53,10 @@ func (c *appContext) useMetadataStore(connectionString string) error {
 
 	logrus.Infof("Using SQL Lite data store with '%s'", connectionString)
 	c.dataStore = datastore.NewLocalDataStore()
-	err := c.dataStore.Initialize(connectionString)
-
-	return err
+	if *rebuildCache {
+		return c.dataStore.Rebuild(connectionString)
+	}
+	return c.dataStore.Initialize(connectionString)
 }
 
 func (c *appContext) usePiwigo(url string, user string, password string) error {
@@ -46,17 +73,284 @@ func (c *appContext) usePiwigo(url string, user string, password string) error {
 	}
 
 	c.piwigo = new(piwigo.ServerContext)
-	return c.piwigo.Initialize(url, user, password)
+	err := c.piwigo.Initialize(url, user, password)
+	if err != nil {
+		return err
+	}
+
+	c.piwigo.UseContext(runContext)
+	c.piwigo.UseRequestTimeout(*requestTimeout)
+	c.piwigo.UseRequestDump(*dumpRequests)
+	c.piwigo.UseBandwidthLimiter(c.bandwidth)
+	c.piwigo.UseSlowChunkWarning(*slowChunkFactor)
+	c.piwigo.UseAutoTunedUpload(*autoTuneUpload)
+	c.piwigo.UseTimezone(serverTimezone())
+	err = c.piwigo.UseManagedCategories(managedCategories)
+	if err != nil {
+		return err
+	}
+	err = c.useConnectionPool()
+	if err != nil {
+		return err
+	}
+	err = c.piwigo.UseChunkType(*chunkType)
+	if err != nil {
+		return err
+	}
+	err = c.usePartialUploads()
+	if err != nil {
+		return err
+	}
+	return c.piwigo.UseFilenameMode(*filenameSanitization, *preserveFilenameCase)
+}
+
+func (c *appContext) usePiwigoSession(url string, sessionCookie string) error {
+	if url == "" {
+		return errors.New("missing piwigo url")
+	}
+
+	// the session only allows reading as the upload settings are initialized during the login
+	if !*listCategories && !*statsOnly && *diffServer == "" && *planFile == "" {
+		return errors.New("noLogin can only be used with the read-only commands listCategories, statsOnly, diffServer and planFile")
+	}
+
+	c.piwigo = new(piwigo.ServerContext)
+	err := c.piwigo.InitializeWithSessionCookie(url, sessionCookie)
+	if err != nil {
+		return err
+	}
+
+	c.borrowedSession = true
+	c.piwigo.UseContext(runContext)
+	c.piwigo.UseRequestTimeout(*requestTimeout)
+	c.piwigo.UseRequestDump(*dumpRequests)
+	err = c.piwigo.UseManagedCategories(managedCategories)
+	if err != nil {
+		return err
+	}
+	return c.useConnectionPool()
+}
+
+// Remembers the chunks of interrupted uploads in the metadata store. Without a store, uploads always start over.
+func (c *appContext) usePartialUploads() error {
+	if c.dataStore == nil {
+		return c.piwigo.UsePartialUploads(*onPartialUpload, nil)
+	}
+	return c.piwigo.UsePartialUploads(*onPartialUpload, c.dataStore)
+}
+
+func (c *appContext) useBandwidthLimit(limit string) error {
+	bytesPerSecond, err := piwigo.ParseBandwidthLimit(limit)
+	if err != nil {
+		return err
+	}
+	if bytesPerSecond > 0 {
+		logrus.Infof("Limiting the uploads to %d bytes per second", bytesPerSecond)
+	}
+	c.bandwidth = piwigo.NewBandwidthLimiter(bytesPerSecond)
+	return nil
+}
+
+// Keeps an idle connection for every parallel request unless the pool is configured explicitly.
+func (c *appContext) useConnectionPool() error {
+	idleConns, idleConnsPerHost := connectionPoolSize()
+	return c.piwigo.UseConnectionPool(idleConns, idleConnsPerHost, *idleConnTimeout)
+}
+
+func connectionPoolSize() (int, int) {
+	idleConnsPerHost := *maxIdleConnsPerHost
+	if idleConnsPerHost == 0 {
+		idleConnsPerHost = *parallelUploads
+		if *parallelCategories > idleConnsPerHost {
+			idleConnsPerHost = *parallelCategories
+		}
+	}
+
+	idleConns := *maxIdleConns
+	if idleConns == 0 {
+		idleConns = 100
+		if idleConnsPerHost > idleConns {
+			idleConns = idleConnsPerHost
+		}
+	}
+	return idleConns, idleConnsPerHost
+}
+
+// Identifies the uploader in the logs of the server unless another user agent is configured.
+func (c *appContext) useHeaders(userAgent string, headers []string) error {
+	if userAgent == "" {
+		userAgent = fmt.Sprintf("PiwigoDirectoryUploader/%s", version)
+	}
+	return c.piwigo.UseHeaders(userAgent, headers)
+}
+
+func (c *appContext) useClientCertificate(certFile string, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	return c.piwigo.UseClientCertificate(certFile, keyFile)
+}
+
+// Prepares the contexts of the secondary piwigo installations. Every installation needs its own metadata store
+// as the ids of categories and images differ between the servers. The scanned files and checksums are shared.
+func (c *appContext) useSecondaryTargets(targetUrls []string) error {
+	if len(targetUrls) == 0 {
+		return nil
+	}
+	if *targetMode != targetModeReplicate && *targetMode != targetModeFailover {
+		return errors.New(fmt.Sprintf("unknown targetMode %s, use %s or %s", *targetMode, targetModeReplicate, targetModeFailover))
+	}
+
+	c.checksumCalculator = localFileStructure.NewCachingChecksumCalculator(c.checksumCalculator)
+	for _, targetUrl := range targetUrls {
+		target, err := piwigo.ParseTarget(targetUrl, *piwigoUser, *piwigoPassword)
+		if err != nil {
+			return err
+		}
+
+		secondary := &appContext{
+			report:             report.NewReport(),
+			workDir:            c.workDir,
+			transforms:         c.transforms,
+			categoryNames:      c.categoryNames,
+			prompt:             c.prompt,
+			checksumCalculator: c.checksumCalculator,
+			localRootPath:      c.localRootPath,
+			targetName:         target.Name(),
+			bandwidth:          c.bandwidth,
+		}
+		if *sqliteDb != "" {
+			err = secondary.useMetadataStore(targetDatabase(*sqliteDb, target))
+			if err != nil {
+				return err
+			}
+		}
+		err = secondary.usePiwigo(target.Url, target.Username, target.Password)
+		if err != nil {
+			return err
+		}
+		err = secondary.useClientCertificate(*clientCertFile, *clientKeyFile)
+		if err != nil {
+			return err
+		}
+		err = secondary.useHeaders(*userAgent, headers)
+		if err != nil {
+			return err
+		}
+		c.secondaries = append(c.secondaries, secondary)
+	}
+	return nil
+}
+
+// Derives the metadata store of a secondary target from the one of the primary, e.g. ./localstate-backup.example.com.db
+func targetDatabase(primaryDatabase string, target piwigo.Target) string {
+	extension := filepath.Ext(primaryDatabase)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(primaryDatabase, extension), target.Name(), extension)
+}
+
+// The primary and all secondary contexts.
+func (c *appContext) targets() []*appContext {
+	return append([]*appContext{c}, c.secondaries...)
+}
+
+func (c *appContext) useWorkDir(baseDir string) error {
+	var err error
+	c.workDir, err = workdir.Create(baseDir)
+	if err != nil {
+		return err
+	}
+
+	registerCleanup(func() {
+		err := c.workDir.Remove()
+		if err != nil {
+			logrus.Warnf("Could not remove work directory %s - %s", c.workDir.Path(), err)
+		}
+	})
+	return nil
+}
+
+func (c *appContext) useTransformations() {
+	c.transforms = transform.NewPipeline(c.workDir)
+	if *autoRotate {
+		c.transforms.Add("exif auto rotation", transform.AutoRotate)
+	}
+	// the orientation is needed by the auto rotation, so the exif data is removed afterwards
+	if *stripAllExif {
+		c.transforms.Add("exif removal", transform.StripAllExif)
+	} else if *stripGps {
+		c.transforms.Add("gps removal", transform.StripGps)
+	}
+}
+
+// The md5sum has to match the content that gets uploaded, so transformed images are hashed after the transformation.
+func (c *appContext) useChecksum(algorithm string) error {
+	calculator, err := localFileStructure.NewChecksumCalculator(algorithm)
+	if err != nil {
+		return err
+	}
+
+	if c.transforms.IsEmpty() {
+		c.checksumCalculator = calculator
+	} else {
+		c.checksumCalculator = c.transforms.NewChecksumCalculator(algorithm)
+	}
+
+	if *sidecarHashes {
+		if c.transforms.IsEmpty() {
+			c.checksumCalculator = localFileStructure.NewSidecarChecksumCalculator(c.checksumCalculator, *trustSidecarHashes)
+		} else {
+			logrus.Warn("The flag sidecarHashes is ignored as the transformed images have to be hashed after the transformation")
+		}
+	}
+	return nil
 }
 
 func newAppContext() (*appContext, error) {
 	logrus.Infoln("Preparing application context and configuration")
 
+	err := validateFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	err = readSecrets()
+	if err != nil {
+		return nil, err
+	}
+
 	context := new(appContext)
 	context.localRootPath = *imagesRootPath
+	context.targetName = piwigo.Target{Url: *piwigoUrl}.Name()
+
+	// listing the categories, the self-test, a manifest, applying a plan and reading an archive do not use the root path
+	if !*listCategories && !*selfTest && *manifestFile == "" && *applyPlan == "" && *archive == "" {
+		err = localFileStructure.CheckRootPath(context.localRootPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	context.report = report.NewReport()
+	context.prompt = confirm.NewPrompt(os.Stdin, os.Stderr, isTerminal(os.Stdin), *assumeYes)
+
+	err = context.useWorkDir(*workDir)
+	if err != nil {
+		return nil, err
+	}
+	context.useTransformations()
+
+	context.categoryNames, err = category.ReadNameMap(*categoryNameMap)
+	if err != nil {
+		return nil, err
+	}
+
+	err = context.useChecksum(*checksum)
+	if err != nil {
+		return nil, err
+	}
 
 	if *sqliteDb != "" {
-		err := context.useMetadataStore(*sqliteDb)
+		err = context.useMetadataStore(*sqliteDb)
 		if err != nil {
 			return nil, err
 		}
@@ -64,7 +358,34 @@ func newAppContext() (*appContext, error) {
 		logrus.Warnln("No persistence configured. Skipping metadata storage. This might affect performance on large collections!")
 	}
 
-	err := context.usePiwigo(*piwigoUrl, *piwigoUser, *piwigoPassword)
+	err = context.useBandwidthLimit(*bandwidthLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if *noLogin {
+		err = context.usePiwigoSession(*piwigoUrl, *sessionCookie)
+	} else {
+		err = context.usePiwigo(*piwigoUrl, *piwigoUser, *piwigoPassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = context.useClientCertificate(*clientCertFile, *clientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = context.useHeaders(*userAgent, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// read-only commands, the self-test, a manifest and a plan only use the primary installation
+	if !*listCategories && !*selfTest && *manifestFile == "" && *planFile == "" && *applyPlan == "" {
+		err = context.useSecondaryTargets(secondaryUrls)
+	}
 
 	return context, err
 }
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"testing"
+)
+
+func Test_connectionPoolSize(t *testing.T) {
+	tests := []struct {
+		name             string
+		flags            map[string]string
+		idleConns        int
+		idleConnsPerHost int
+	}{
+		{"defaults", map[string]string{}, 100, 4},
+		{"more parallel categories", map[string]string{"parallelCategories": "8"}, 100, 8},
+		{"more parallel requests than the default pool", map[string]string{"parallelUploads": "150"}, 150, 150},
+		{"configured pool", map[string]string{"maxIdleConns": "20", "maxIdleConnsPerHost": "10"}, 20, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+
+			idleConns, idleConnsPerHost := connectionPoolSize()
+			if idleConns != tt.idleConns || idleConnsPerHost != tt.idleConnsPerHost {
+				t.Errorf("expected %d and %d per host but got %d and %d", tt.idleConns, tt.idleConnsPerHost, idleConns, idleConnsPerHost)
+			}
+		})
+	}
+}
+
+func Test_usePiwigoSession_only_allows_read_only_commands(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   map[string]string
+		allowed bool
+	}{
+		{"synchronization", map[string]string{}, false},
+		{"applyPlan", map[string]string{"applyPlan": "plan.json"}, false},
+		{"listCategories", map[string]string{"listCategories": "true"}, true},
+		{"statsOnly", map[string]string{"statsOnly": "true"}, true},
+		{"diffServer", map[string]string{"diffServer": "2019/image.jpg"}, true},
+		{"planFile", map[string]string{"planFile": "plan.json"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+
+			context := &appContext{}
+			err := context.usePiwigoSession("https://example.com", "0123456789abcdef")
+			if tt.allowed && (err != nil || !context.borrowedSession) {
+				t.Errorf("expected the session to be used but got %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Error("expected the session to be refused")
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_runCleanup_runs_the_cleanup_functions_once(t *testing.T) {
+	var calls int32
+	registerCleanup(func() { atomic.AddInt32(&calls, 1) })
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runCleanup()
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected the cleanup to run once but it ran %d times", calls)
+	}
+}
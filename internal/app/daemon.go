@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// set to 1 while the daemon waits for its next synchronization, a termination then stops it without aborting a
+// synchronization that is still running
+var daemonIdle int32
+
+// Synchronizes the local files every interval until the application gets terminated. The sessions and the metadata
+// store are kept open between the synchronizations, so only the changes since the last one are uploaded. A failed
+// synchronization is logged and retried on the next one.
+func runDaemon(context *appContext, formatter report.Formatter) {
+	trigger := make(chan os.Signal, 1)
+	notifySyncTrigger(trigger)
+	logrus.Infof("Running as daemon, synchronizing every %s", *interval)
+
+	var targets []*appContext
+	registerCleanup(func() {
+		for _, target := range targets {
+			_ = target.piwigo.Logout()
+		}
+	})
+
+	for cycle := 1; ; cycle++ {
+		start := time.Now()
+		targets = runDaemonCycle(context, targets, formatter, cycle)
+
+		next, skipped := nextCycle(start, time.Now(), *interval)
+		if skipped > 0 {
+			logrus.Warnf("Synchronization %d took %s, longer than the interval of %s. Skipping %d scheduled synchronizations", cycle, time.Since(start).Round(time.Second), *interval, skipped)
+		}
+		waitForNextCycle(next, trigger)
+	}
+}
+
+// Runs a single synchronization of the daemon with a new report for every installation and logs its summary. Returns
+// the installations that are logged in for the next synchronization.
+func runDaemonCycle(context *appContext, targets []*appContext, formatter report.Formatter, cycle int) []*appContext {
+	start := time.Now()
+	logrus.Infof("Starting synchronization %d", cycle)
+
+	targets, exitCode, err := keepSessions(context, targets)
+	if err != nil {
+		logrus.Errorf("Synchronization %d failed with exit code 2: %s", cycle, err)
+		return targets
+	}
+
+	filesystemNodes, err := scanLocalFiles(context)
+	if err != nil {
+		logrus.Errorf("Synchronization %d failed with exit code 3: %s", cycle, err)
+		return targets
+	}
+	applyCategoryKeys(filesystemNodes)
+
+	data := make([]report.ReportData, 0, len(targets))
+	for _, target := range targets {
+		target.report = report.NewReport()
+	}
+	syncExitCode := synchronizeTargets(context, targets, filesystemNodes, formatter)
+	if exitCode == 0 {
+		exitCode = syncExitCode
+	}
+	for _, target := range targets {
+		data = append(data, target.report.Data(target.targetName))
+	}
+
+	totals := report.CombineData(data).Totals
+	logrus.Infof("Synchronization %d finished in %s with exit code %d: %d images uploaded, %d images matched existing, %d images skipped, %d images failed", cycle, time.Since(start).Round(time.Second), exitCode, totals.Uploaded, totals.Matched, totals.Skipped, totals.Failed)
+	return targets
+}
+
+// Keeps the sessions of the previous synchronization as long as the servers accept them. All installations log in
+// again if a session expired or an installation of the replicate mode could not log in last time.
+func keepSessions(context *appContext, targets []*appContext) ([]*appContext, int, error) {
+	if len(targets) == 0 || (*targetMode == targetModeReplicate && len(targets) < len(context.targets())) {
+		return loginTargets(context)
+	}
+	for _, target := range targets {
+		err := target.piwigo.VerifySession()
+		if err != nil {
+			logrus.Infof("The session of %s ended, logging in again - %s", target.targetName, err)
+			return loginTargets(context)
+		}
+	}
+	return targets, 0, nil
+}
+
+// Returns the start of the next synchronization on the schedule of the interval and the number of scheduled
+// synchronizations that are skipped, because the synchronization started at start is still running at now. Skipping
+// them keeps the synchronizations from overlapping or running back to back.
+func nextCycle(start time.Time, now time.Time, interval time.Duration) (time.Time, int) {
+	next := start.Add(interval)
+	skipped := 0
+	for !next.After(now) {
+		next = next.Add(interval)
+		skipped++
+	}
+	return next, skipped
+}
+
+// Waits until the next synchronization is due or the sync trigger is received. A trigger received during a
+// synchronization starts the next one right after it.
+func waitForNextCycle(next time.Time, trigger <-chan os.Signal) {
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	atomic.StoreInt32(&daemonIdle, 1)
+	defer atomic.StoreInt32(&daemonIdle, 0)
+	logrus.Infof("Next synchronization at %s", next.Format(time.RFC3339))
+	select {
+	case <-timer.C:
+	case sig := <-trigger:
+		logrus.Infof("Received signal %s. Synchronizing now...", sig)
+	}
+}
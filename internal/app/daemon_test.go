@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_nextCycle_keeps_the_schedule(t *testing.T) {
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     time.Time
+		skipped  int
+	}{
+		{"short synchronization", 5 * time.Minute, start.Add(30 * time.Minute), 0},
+		{"synchronization ending on the schedule", 30 * time.Minute, start.Add(60 * time.Minute), 1},
+		{"long synchronization", 75 * time.Minute, start.Add(90 * time.Minute), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, skipped := nextCycle(start, start.Add(tt.duration), 30*time.Minute)
+			if !next.Equal(tt.want) || skipped != tt.skipped {
+				t.Errorf("nextCycle() = %s, %d, want %s, %d", next, skipped, tt.want, tt.skipped)
+			}
+		})
+	}
+}
+
+func Test_waitForNextCycle_starts_on_the_trigger(t *testing.T) {
+	trigger := make(chan os.Signal, 1)
+	trigger <- syscall.SIGHUP
+
+	start := time.Now()
+	waitForNextCycle(start.Add(time.Hour), trigger)
+	if time.Since(start) > time.Minute {
+		t.Error("expected the trigger to end the wait")
+	}
+	if daemonIdle != 0 {
+		t.Error("expected the daemon to be busy after the wait")
+	}
+}
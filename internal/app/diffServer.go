@@ -0,0 +1,35 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/images"
+	"os"
+)
+
+// Downloads the image of diffServer and compares it with its local file. Exits with 15 if the image could not be
+// compared or the files differ.
+func runDiffServer(context *appContext) {
+	err := loginWithRetries(context)
+	if err != nil {
+		logErrorAndExit(err, 2)
+	}
+
+	diff, err := images.DiffServerImage(context.piwigo, context.dataStore, *diffServer)
+	logout(context)
+	if err != nil {
+		logErrorAndExit(err, 15)
+	}
+
+	err = diff.Write(os.Stdout)
+	if err != nil {
+		logErrorAndExit(err, 15)
+	}
+	if !diff.Matches() {
+		logErrorAndExit(errors.New("the image on the server differs from the local file"), 15)
+	}
+}
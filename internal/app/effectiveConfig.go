@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const redactedValue = "<redacted>"
+
+// Parts of flag names whose values are secrets. Boolean flags like expandPassword are never redacted.
+var secretFlagNames = []string{"password", "token", "cookie"}
+
+// Parts of header names whose values are secrets, e.g. Authorization or X-Api-Key.
+var secretHeaderNames = []string{"auth", "token", "secret", "cookie", "key", "pass", "session"}
+
+// The effective value of a flag after merging the configuration file, the environment and the command line.
+type configValue struct {
+	name      string
+	value     string
+	isDefault bool
+}
+
+// Returns the values of all flags sorted by name with all secrets redacted.
+func effectiveConfig(flags *flag.FlagSet) []configValue {
+	secrets := configSecrets(flags)
+	values := make([]configValue, 0)
+	flags.VisitAll(func(f *flag.Flag) {
+		values = append(values, configValue{
+			name:      f.Name,
+			value:     redactConfigValue(f, secrets),
+			isDefault: f.Value.String() == f.DefValue,
+		})
+	})
+	return values
+}
+
+// Writes the effective configuration in the format of the configuration file.
+func writeEffectiveConfig(writer io.Writer, values []configValue) error {
+	for _, value := range values {
+		_, err := fmt.Fprintf(writer, "%s = %s\n", value.name, value.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Summarizes the flags that differ from their default on a single line.
+func effectiveConfigSummary(values []configValue) string {
+	changed := make([]string, 0)
+	for _, value := range values {
+		if !value.isDefault {
+			changed = append(changed, fmt.Sprintf("%s=%q", value.name, value.value))
+		}
+	}
+	if len(changed) == 0 {
+		return "all flags use their default"
+	}
+	return strings.Join(changed, " ")
+}
+
+// The values of the secret flags. They are removed from all other values as well, e.g. if a password is part of a
+// hook command.
+func configSecrets(flags *flag.FlagSet) []string {
+	secrets := make([]string, 0)
+	flags.VisitAll(func(f *flag.Flag) {
+		if isSecretFlag(f) && f.Value.String() != "" {
+			secrets = append(secrets, f.Value.String())
+		}
+	})
+	return secrets
+}
+
+func isSecretFlag(f *flag.Flag) bool {
+	if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && boolFlag.IsBoolFlag() {
+		return false
+	}
+	return containsAny(f.Name, secretFlagNames)
+}
+
+func redactConfigValue(f *flag.Flag, secrets []string) string {
+	value := f.Value.String()
+	if value == "" {
+		return value
+	}
+	if isSecretFlag(f) {
+		return redactedValue
+	}
+
+	switch f.Name {
+	case "header":
+		if values, ok := f.Value.(*arrayFlags); ok {
+			value = redactHeaders(*values)
+		}
+	case "piwigoUrl", "secondaryPiwigoUrl", "pushGatewayUrl":
+		urls := strings.Split(value, ",")
+		for i := range urls {
+			urls[i] = redactUrl(urls[i])
+		}
+		value = strings.Join(urls, ",")
+	}
+
+	for _, secret := range secrets {
+		value = strings.ReplaceAll(value, secret, redactedValue)
+	}
+	return value
+}
+
+// Redacts the values of the headers whose names reveal a secret.
+func redactHeaders(headers []string) string {
+	redacted := make([]string, 0, len(headers))
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) == 2 && containsAny(parts[0], secretHeaderNames) {
+			header = parts[0] + ": " + redactedValue
+		}
+		redacted = append(redacted, header)
+	}
+	return strings.Join(redacted, ",")
+}
+
+// Redacts the password of the credentials given as part of the url.
+func redactUrl(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+	if _, hasPassword := parsed.User.Password(); !hasPassword {
+		return value
+	}
+	username := parsed.User.Username()
+	parsed.User = nil
+	return strings.Replace(parsed.String(), "://", "://"+url.PathEscape(username)+":"+redactedValue+"@", 1)
+}
+
+func containsAny(name string, parts []string) bool {
+	lowerName := strings.ToLower(name)
+	for _, part := range parts {
+		if strings.Contains(lowerName, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+)
+
+// The flags whose values may reference environment variables like ${HOME}/Pictures. Paths, urls and names are
+// expanded, the values of choices like uploadOrder are not. The password is only expanded if expandPassword is set
+// as passwords may contain a $ sign.
+func expandableFlags() []*string {
+	return []*string{
+		imagesRootPath,
+		sqliteDb,
+		logFile,
+		workDir,
+		filesFrom,
+		archive,
+		manifestFile,
+		piwigoUrl,
+		piwigoUser,
+		clientCertFile,
+		clientKeyFile,
+		pushGatewayUrl,
+		pushGatewayJob,
+		pushGatewayInstance,
+		preUploadHook,
+		postUploadHook,
+		userAgent,
+		secretsDir,
+	}
+}
+
+// Expands the environment variables of the flags given on the command line and in the configuration file.
+// Variables that are not set expand to an empty string.
+func expandEnvironmentVariables() {
+	for _, value := range expandableFlags() {
+		*value = expandEnvironment(*value)
+	}
+	for i := range secondaryUrls {
+		secondaryUrls[i] = expandEnvironment(secondaryUrls[i])
+	}
+	if *expandPassword {
+		*piwigoPassword = expandEnvironment(*piwigoPassword)
+	}
+}
+
+func expandEnvironment(value string) string {
+	return os.Expand(value, func(name string) string {
+		variable, found := os.LookupEnv(name)
+		if !found {
+			logrus.Warnf("The environment variable %s is not set and expands to an empty value", name)
+		}
+		return variable
+	})
+}
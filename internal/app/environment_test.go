@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_expandEnvironmentVariables_expands_set_variables(t *testing.T) {
+	setEnvironment(t, "UPLOADER_TEST_HOME", "/home/test")
+	setEnvironment(t, "UPLOADER_TEST_HOST", "example.com")
+	setFlags(t, map[string]string{
+		"imagesRootPath": "${UPLOADER_TEST_HOME}/Pictures",
+		"piwigoUrl":      "https://$UPLOADER_TEST_HOST/gallery",
+	})
+
+	expandEnvironmentVariables()
+
+	if *imagesRootPath != "/home/test/Pictures" {
+		t.Errorf("unexpected imagesRootPath %s", *imagesRootPath)
+	}
+	if *piwigoUrl != "https://example.com/gallery" {
+		t.Errorf("unexpected piwigoUrl %s", *piwigoUrl)
+	}
+}
+
+func Test_expandEnvironmentVariables_expands_unset_variables_to_empty_values(t *testing.T) {
+	_ = os.Unsetenv("UPLOADER_TEST_UNSET")
+	setFlags(t, map[string]string{"imagesRootPath": "${UPLOADER_TEST_UNSET}/Pictures"})
+
+	expandEnvironmentVariables()
+
+	if *imagesRootPath != "/Pictures" {
+		t.Errorf("unexpected imagesRootPath %s", *imagesRootPath)
+	}
+}
+
+func Test_expandEnvironmentVariables_expands_the_password_only_if_enabled(t *testing.T) {
+	setEnvironment(t, "UPLOADER_TEST_PASSWORD", "secret")
+	setFlags(t, map[string]string{"piwigoPassword": "pa$$${UPLOADER_TEST_PASSWORD}"})
+
+	expandEnvironmentVariables()
+	if *piwigoPassword != "pa$$${UPLOADER_TEST_PASSWORD}" {
+		t.Errorf("the password got expanded without expandPassword: %s", *piwigoPassword)
+	}
+
+	setFlags(t, map[string]string{"piwigoPassword": "${UPLOADER_TEST_PASSWORD}", "expandPassword": "true"})
+	expandEnvironmentVariables()
+	if *piwigoPassword != "secret" {
+		t.Errorf("unexpected password %s", *piwigoPassword)
+	}
+}
+
+func Test_expandEnvironmentVariables_expands_the_secondary_urls(t *testing.T) {
+	setEnvironment(t, "UPLOADER_TEST_HOST", "backup.example.com")
+	secondaryUrls = arrayFlags{"https://${UPLOADER_TEST_HOST}"}
+	t.Cleanup(func() { secondaryUrls = nil })
+
+	expandEnvironmentVariables()
+
+	if secondaryUrls[0] != "https://backup.example.com" {
+		t.Errorf("unexpected secondary url %s", secondaryUrls[0])
+	}
+}
+
+func setEnvironment(t *testing.T, name string, value string) {
+	err := os.Setenv(name, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Unsetenv(name) })
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/category"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/images"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"time"
+)
+
+// A combination of flags that contradict each other or a flag that has no effect without another one.
+type flagConflict struct {
+	conflicts func() bool
+	message   string
+}
+
+// All rules are kept here, so every combination is checked before anything gets prepared.
+var flagConflicts = []flagConflict{
+	{
+		conflicts: func() bool { return *archive != "" && *filesFrom != "" },
+		message:   "the flags archive and filesFrom can not be used together",
+	},
+	{
+		conflicts: func() bool { return *stripGps && *stripAllExif },
+		message:   "the flags stripGps and stripAllExif can not be used together, stripAllExif removes the GPS position as well",
+	},
+	{
+		conflicts: func() bool { return *showProgress && *quiet },
+		message:   "the flags progress and quiet can not be used together",
+	},
+	{
+		conflicts: func() bool { return *listCategories && *statsOnly },
+		message:   "the flags listCategories and statsOnly can not be used together",
+	},
+	{
+		conflicts: func() bool { return *dedupeCategories && (*listCategories || *statsOnly || *selfTest) },
+		message:   "the flag dedupeAcrossCategories can not be combined with listCategories, statsOnly or selfTest",
+	},
+	{
+		conflicts: func() bool { return *selfTest && (*listCategories || *statsOnly || *noLogin) },
+		message:   "the flag selfTest can not be combined with listCategories, statsOnly or noLogin",
+	},
+	{
+		conflicts: func() bool {
+			return *manifestFile != "" && (*listCategories || *statsOnly || *selfTest || *dedupeCategories)
+		},
+		message: "the flag manifest can not be combined with listCategories, statsOnly, selfTest or dedupeAcrossCategories",
+	},
+	{
+		conflicts: func() bool { return *createCategories && *manifestFile == "" },
+		message:   "the flag manifestCreateCategories requires manifest",
+	},
+	{
+		conflicts: func() bool { return *noUpload && *coverPolicy != "none" && !*deferMetadata },
+		message:   "the flags noUpload and coverPolicy can not be used together, the covers are set after the upload",
+	},
+	{
+		conflicts: func() bool { return *keepOriginal && (*autoRotate || *stripGps || *stripAllExif) },
+		message:   "the flag keepOriginal can not be combined with autoRotate, stripGps or stripAllExif as they change the original",
+	},
+	{
+		conflicts: func() bool { return *failOnOversizedImages && *maxImageSizeMB < 0 },
+		message:   "the flag failOnOversizedImages can not be used if maxImageSizeMB disables the size check",
+	},
+	{
+		conflicts: func() bool { return *overrideCover && *coverPolicy == "none" },
+		message:   "the flag overrideCover requires a coverPolicy",
+	},
+	{
+		conflicts: func() bool { return *requirePostUploadHook && *postUploadHook == "" },
+		message:   "the flag requirePostUploadHook requires postUploadHook",
+	},
+	{
+		conflicts: func() bool { return *retryQuarantined && *maxUploadFailures <= 0 },
+		message:   "the flag retryQuarantined requires maxUploadFailures",
+	},
+	{
+		conflicts: func() bool { return *noUpload && *generateContactSheet && !*deferMetadata },
+		message:   "the flags noUpload and generateContactSheet can not be used together, the contact sheets are uploaded after the images",
+	},
+	{
+		conflicts: func() bool { return *contactSheetAsCover && !*generateContactSheet },
+		message:   "the flag contactSheetAsCover requires generateContactSheet",
+	},
+	{
+		conflicts: func() bool { return *contactSheetAsCover && *coverPolicy != "none" },
+		message:   "the flags contactSheetAsCover and coverPolicy can not be used together",
+	},
+	{
+		conflicts: func() bool { return *sessionCookie != "" && !*noLogin },
+		message:   "the flag sessionCookie requires noLogin",
+	},
+	{
+		conflicts: func() bool { return piwigo.ValidateCategoryStatus(*defaultAlbumStatus) != nil },
+		message:   "the flag defaultAlbumStatus must be public or private",
+	},
+	{
+		conflicts: func() bool {
+			return *rawJpegPolicy != rawJpegPolicyJpegOnly && *rawJpegPolicy != rawJpegPolicyBoth && *rawJpegPolicy != rawJpegPolicyLinked
+		},
+		message: "the flag rawJpegPolicy must be jpegOnly, both or linked",
+	},
+	{
+		conflicts: func() bool { return *categoryMatch != category.MatchName && *categoryMatch != category.MatchPath },
+		message:   "the flag categoryMatch must be name or path",
+	},
+	{
+		conflicts: func() bool {
+			return *categoryCollision != category.CollisionReuse && *categoryCollision != category.CollisionCreateNew && *categoryCollision != category.CollisionError
+		},
+		message: "the flag categoryCollision must be reuse, createNew or error",
+	},
+	{
+		conflicts: func() bool {
+			return *categoryCase != category.CaseSensitive && *categoryCase != category.CaseInsensitive
+		},
+		message: "the flag categoryCase must be sensitive or insensitive",
+	},
+	{
+		conflicts: func() bool { return *categoryLayout != category.LayoutTree && *categoryLayout != category.LayoutFlat },
+		message:   "the flag categoryLayout must be tree or flat",
+	},
+	{
+		conflicts: func() bool {
+			return *exportTreeFormat != category.TreeFormatText && *exportTreeFormat != category.TreeFormatJson && *exportTreeFormat != category.TreeFormatDot
+		},
+		message: "the flag exportTreeFormat must be text, json or dot",
+	},
+	{
+		conflicts: func() bool {
+			return *onEmptyFile != localFileStructure.EmptyFileSkip && *onEmptyFile != localFileStructure.EmptyFileError
+		},
+		message: "the flag onEmptyFile must be skip or error",
+	},
+	{
+		conflicts: func() bool { return *sidecarHashes && *checksum != localFileStructure.ChecksumMd5 },
+		message:   "the flag sidecarHashes requires the checksum md5",
+	},
+	{
+		conflicts: func() bool { return *trustSidecarHashes && !*sidecarHashes },
+		message:   "the flag trustSidecarHashes requires sidecarHashes",
+	},
+	{
+		conflicts: func() bool { return *albumAtomic && (*deferMetadata || *noUpload) },
+		message:   "the flag albumAtomic can not be combined with deferMetadata or noUpload",
+	},
+	{
+		conflicts: func() bool { return *previewFirst && (*albumAtomic || *noUpload) },
+		message:   "the flag previewFirst can not be combined with albumAtomic or noUpload",
+	},
+	{
+		conflicts: func() bool {
+			return *exportTree != "" && (*interval > 0 || *statsOnly || *listCategories || *dedupeCategories || *selfTest || *manifestFile != "")
+		},
+		message: "the flag exportTree can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest or manifestFile",
+	},
+	{
+		conflicts: func() bool {
+			return *diffServer != "" && (*interval > 0 || *statsOnly || *listCategories || *dedupeCategories || *selfTest || *manifestFile != "" || *exportTree != "")
+		},
+		message: "the flag diffServer can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest, manifestFile or exportTree",
+	},
+	{
+		conflicts: func() bool {
+			return *planFile != "" && (*interval > 0 || *statsOnly || *listCategories || *dedupeCategories || *selfTest || *manifestFile != "" || *exportTree != "" || *diffServer != "" || *applyPlan != "")
+		},
+		message: "the flag planFile can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest, manifestFile, exportTree, diffServer or applyPlan",
+	},
+	{
+		conflicts: func() bool {
+			return *applyPlan != "" && (*interval > 0 || *statsOnly || *listCategories || *dedupeCategories || *selfTest || *manifestFile != "" || *exportTree != "" || *diffServer != "")
+		},
+		message: "the flag applyPlan can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest, manifestFile, exportTree or diffServer",
+	},
+	{
+		conflicts: func() bool {
+			return *detectServerDeletions && (*serverDeletionSample < 1 || *serverDeletionSample > 100)
+		},
+		message: "the flag serverDeletionSample must be a percentage between 1 and 100",
+	},
+	{
+		conflicts: func() bool { return *reportTemplate != "" && *reportFormat != "" && *reportFormat != "template" },
+		message:   "the flag reportTemplate can only be used with reportFormat template",
+	},
+	{
+		conflicts: func() bool { return *interval < 0 },
+		message:   "the flag interval can not be negative",
+	},
+	{
+		conflicts: func() bool {
+			return *interval > 0 && (*statsOnly || *listCategories || *dedupeCategories || *selfTest || *manifestFile != "")
+		},
+		message: "the flag interval can not be combined with statsOnly, listCategories, dedupeCategories, selfTest or manifestFile",
+	},
+	{
+		conflicts: func() bool { return *interval > 0 && (*archive != "" || *filesFrom == "-") },
+		message:   "the flag interval can not be combined with archive or filesFrom -, they are only read once",
+	},
+	{
+		conflicts: func() bool { return *maxDepth < 0 },
+		message:   "the flag maxDepth can not be negative",
+	},
+	{
+		conflicts: func() bool {
+			return *uniqueImageNames != "" && *uniqueImageNames != images.NameSuffixNumeric && *uniqueImageNames != images.NameSuffixHash
+		},
+		message: "the flag uniqueImageNames must be numeric, hash or empty",
+	},
+	{
+		conflicts: func() bool {
+			return *dateCreationFrom != "" && *dateCreationFrom != images.DateCreationExif && *dateCreationFrom != images.DateCreationModTime
+		},
+		message: "the flag dateCreationFrom must be exif, mtime or empty",
+	},
+	{
+		conflicts: func() bool {
+			_, err := time.LoadLocation(*timezone)
+			return err != nil
+		},
+		message: "the flag timezone must be the name of a time zone like Europe/Zurich or empty",
+	},
+	{
+		conflicts: func() bool {
+			return *verifyMode != images.VerifyFull && *verifyMode != images.VerifySampled && *verifyMode != images.VerifyNone
+		},
+		message: "the flag verifyMode must be full, sampled or none",
+	},
+	{
+		conflicts: func() bool { return *slowChunkFactor < 0 || *slowChunkFactor == 1 },
+		message:   "the flag slowChunkFactor must be zero or at least 2",
+	},
+	{
+		conflicts: func() bool { return *flattenBelowMaxDepth && *maxDepth == 0 },
+		message:   "the flag flattenBelowMaxDepth requires maxDepth",
+	},
+	{
+		conflicts: func() bool { return *maxDepth > 0 && (*archive != "" || *filesFrom != "") },
+		message:   "the flag maxDepth can not be combined with archive or filesFrom",
+	},
+}
+
+// Rejects the first combination of flags that makes no sense.
+func validateFlags() error {
+	for _, conflict := range flagConflicts {
+		if conflict.conflicts() {
+			return errors.New(conflict.message)
+		}
+	}
+	return nil
+}
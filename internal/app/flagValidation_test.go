@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"flag"
+	"testing"
+)
+
+func Test_validateFlags_accepts_the_defaults(t *testing.T) {
+	err := validateFlags()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_validateFlags_rejects_conflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		want  string
+	}{
+		{"archive and filesFrom", map[string]string{"archive": "images.zip", "filesFrom": "-"}, "the flags archive and filesFrom can not be used together"},
+		{"stripGps and stripAllExif", map[string]string{"stripGps": "true", "stripAllExif": "true"}, "the flags stripGps and stripAllExif can not be used together, stripAllExif removes the GPS position as well"},
+		{"progress and quiet", map[string]string{"progress": "true", "quiet": "true"}, "the flags progress and quiet can not be used together"},
+		{"listCategories and statsOnly", map[string]string{"listCategories": "true", "statsOnly": "true"}, "the flags listCategories and statsOnly can not be used together"},
+		{"dedupeAcrossCategories and statsOnly", map[string]string{"dedupeAcrossCategories": "true", "statsOnly": "true"}, "the flag dedupeAcrossCategories can not be combined with listCategories, statsOnly or selfTest"},
+		{"selfTest and listCategories", map[string]string{"selfTest": "true", "listCategories": "true"}, "the flag selfTest can not be combined with listCategories, statsOnly or noLogin"},
+		{"manifest and statsOnly", map[string]string{"manifest": "manifest.json", "statsOnly": "true"}, "the flag manifest can not be combined with listCategories, statsOnly, selfTest or dedupeAcrossCategories"},
+		{"manifestCreateCategories", map[string]string{"manifestCreateCategories": "true"}, "the flag manifestCreateCategories requires manifest"},
+		{"noUpload and coverPolicy", map[string]string{"noUpload": "true", "coverPolicy": "newest"}, "the flags noUpload and coverPolicy can not be used together, the covers are set after the upload"},
+		{"keepOriginal and autoRotate", map[string]string{"keepOriginal": "true", "autoRotate": "true"}, "the flag keepOriginal can not be combined with autoRotate, stripGps or stripAllExif as they change the original"},
+		{"keepOriginal and stripGps", map[string]string{"keepOriginal": "true", "stripGps": "true"}, "the flag keepOriginal can not be combined with autoRotate, stripGps or stripAllExif as they change the original"},
+		{"failOnOversizedImages", map[string]string{"failOnOversizedImages": "true", "maxImageSizeMB": "-1"}, "the flag failOnOversizedImages can not be used if maxImageSizeMB disables the size check"},
+		{"overrideCover", map[string]string{"overrideCover": "true"}, "the flag overrideCover requires a coverPolicy"},
+		{"requirePostUploadHook", map[string]string{"requirePostUploadHook": "true"}, "the flag requirePostUploadHook requires postUploadHook"},
+		{"retryQuarantined", map[string]string{"retryQuarantined": "true"}, "the flag retryQuarantined requires maxUploadFailures"},
+		{"noUpload and generateContactSheet", map[string]string{"noUpload": "true", "generateContactSheet": "true"}, "the flags noUpload and generateContactSheet can not be used together, the contact sheets are uploaded after the images"},
+		{"contactSheetAsCover", map[string]string{"contactSheetAsCover": "true"}, "the flag contactSheetAsCover requires generateContactSheet"},
+		{"contactSheetAsCover and coverPolicy", map[string]string{"generateContactSheet": "true", "contactSheetAsCover": "true", "coverPolicy": "newest"}, "the flags contactSheetAsCover and coverPolicy can not be used together"},
+		{"sessionCookie", map[string]string{"sessionCookie": "abc"}, "the flag sessionCookie requires noLogin"},
+		{"defaultAlbumStatus", map[string]string{"defaultAlbumStatus": "hidden"}, "the flag defaultAlbumStatus must be public or private"},
+		{"rawJpegPolicy", map[string]string{"rawJpegPolicy": "raw"}, "the flag rawJpegPolicy must be jpegOnly, both or linked"},
+		{"categoryMatch", map[string]string{"categoryMatch": "id"}, "the flag categoryMatch must be name or path"},
+		{"categoryCollision", map[string]string{"categoryCollision": "merge"}, "the flag categoryCollision must be reuse, createNew or error"},
+		{"categoryCase", map[string]string{"categoryCase": "upper"}, "the flag categoryCase must be sensitive or insensitive"},
+		{"categoryLayout", map[string]string{"categoryLayout": "nested"}, "the flag categoryLayout must be tree or flat"},
+		{"onEmptyFile", map[string]string{"onEmptyFile": "upload"}, "the flag onEmptyFile must be skip or error"},
+		{"sidecarHashes with sha1", map[string]string{"sidecarHashes": "true", "checksum": "sha1"}, "the flag sidecarHashes requires the checksum md5"},
+		{"trustSidecarHashes", map[string]string{"trustSidecarHashes": "true"}, "the flag trustSidecarHashes requires sidecarHashes"},
+		{"albumAtomic with deferMetadata", map[string]string{"albumAtomic": "true", "deferMetadata": "true"}, "the flag albumAtomic can not be combined with deferMetadata or noUpload"},
+		{"previewFirst with albumAtomic", map[string]string{"previewFirst": "true", "albumAtomic": "true"}, "the flag previewFirst can not be combined with albumAtomic or noUpload"},
+		{"diffServer with statsOnly", map[string]string{"diffServer": "12", "statsOnly": "true"}, "the flag diffServer can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest, manifestFile or exportTree"},
+		{"planFile with applyPlan", map[string]string{"planFile": "plan.json", "applyPlan": "plan.json"}, "the flag planFile can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest, manifestFile, exportTree, diffServer or applyPlan"},
+		{"applyPlan with interval", map[string]string{"applyPlan": "plan.json", "interval": "1h"}, "the flag applyPlan can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest, manifestFile, exportTree or diffServer"},
+		{"exportTreeFormat", map[string]string{"exportTreeFormat": "svg"}, "the flag exportTreeFormat must be text, json or dot"},
+		{"exportTree with listCategories", map[string]string{"exportTree": "tree.txt", "listCategories": "true"}, "the flag exportTree can not be combined with interval, statsOnly, listCategories, dedupeCategories, selfTest or manifestFile"},
+		{"reportTemplate and reportFormat", map[string]string{"reportTemplate": "report.tmpl", "reportFormat": "csv"}, "the flag reportTemplate can only be used with reportFormat template"},
+		{"serverDeletionSample", map[string]string{"detectServerDeletions": "true", "serverDeletionSample": "0"}, "the flag serverDeletionSample must be a percentage between 1 and 100"},
+		{"interval and statsOnly", map[string]string{"interval": "30m", "statsOnly": "true"}, "the flag interval can not be combined with statsOnly, listCategories, dedupeCategories, selfTest or manifestFile"},
+		{"interval and filesFrom", map[string]string{"interval": "30m", "filesFrom": "-"}, "the flag interval can not be combined with archive or filesFrom -, they are only read once"},
+		{"flattenBelowMaxDepth", map[string]string{"flattenBelowMaxDepth": "true"}, "the flag flattenBelowMaxDepth requires maxDepth"},
+		{"uniqueImageNames", map[string]string{"uniqueImageNames": "random"}, "the flag uniqueImageNames must be numeric, hash or empty"},
+		{"dateCreationFrom", map[string]string{"dateCreationFrom": "iptc"}, "the flag dateCreationFrom must be exif, mtime or empty"},
+		{"timezone", map[string]string{"timezone": "Mars/Olympus"}, "the flag timezone must be the name of a time zone like Europe/Zurich or empty"},
+		{"verifyMode", map[string]string{"verifyMode": "md5"}, "the flag verifyMode must be full, sampled or none"},
+		{"slowChunkFactor", map[string]string{"slowChunkFactor": "1"}, "the flag slowChunkFactor must be zero or at least 2"},
+		{"maxDepth and filesFrom", map[string]string{"maxDepth": "2", "filesFrom": "files.txt"}, "the flag maxDepth can not be combined with archive or filesFrom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+			err := validateFlags()
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("validateFlags() = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateFlags_accepts_flags_with_their_requirements(t *testing.T) {
+	setFlags(t, map[string]string{
+		"failOnOversizedImages": "true",
+		"maxImageSizeMB":        "10",
+		"overrideCover":         "true",
+		"coverPolicy":           "newest",
+		"retryQuarantined":      "true",
+		"maxUploadFailures":     "3",
+	})
+	err := validateFlags()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_validateFlags_accepts_the_metadata_phase_without_upload(t *testing.T) {
+	setFlags(t, map[string]string{
+		"noUpload":             "true",
+		"deferMetadata":        "true",
+		"coverPolicy":          "newest",
+		"generateContactSheet": "true",
+	})
+	err := validateFlags()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// Sets the flags for a single test and resets them to their defaults afterwards.
+func setFlags(t *testing.T, values map[string]string) {
+	for name, value := range values {
+		f := flag.Lookup(name)
+		if f == nil {
+			t.Fatalf("unknown flag %s", name)
+		}
+		err := flag.Set(name, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = flag.Set(f.Name, f.DefValue) })
+	}
+}
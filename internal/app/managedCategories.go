@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+// Drops the local directories and files outside of the managedCategories, so no category gets created and no image
+// gets uploaded that the server would refuse. The parents of the managed categories are kept to map the hierarchy.
+func managedNodes(context *appContext, nodes map[string]*localFileStructure.FilesystemNode) (map[string]*localFileStructure.FilesystemNode, error) {
+	scope, err := context.piwigo.ManagedScope()
+	if err != nil || scope == nil {
+		return nodes, err
+	}
+
+	remaining := make(map[string]*localFileStructure.FilesystemNode, len(nodes))
+	dropped := 0
+	for path, node := range nodes {
+		if node.IsDir && scope.IsVisible(node.Key) || !node.IsDir && scope.Contains(filepath.Dir(node.Key)) {
+			remaining[path] = node
+			continue
+		}
+		logrus.Tracef("%s: Skipping the file as it is outside of the managed categories", node.Path)
+		dropped++
+	}
+
+	if dropped > 0 {
+		logrus.Infof("Skipping %d directories and files of %s outside of the managed categories", dropped, context.targetName)
+	}
+	return remaining, nil
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/pushgateway"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Pushes the final metrics of the run to the pushgateway. This is meant for short living runs (e.g. cron)
+// that cannot be scraped. A failing push is logged but never fails the run.
+func pushRunMetrics(context *appContext, startTime time.Time) {
+	instance := *pushGatewayInstance
+	if instance == "" {
+		instance = context.localRootPath
+	}
+
+	// the metrics of all piwigo installations are summed up
+	var uploaded, matched, uploadedBytes, errors int64
+	for _, target := range context.targets() {
+		uploaded += int64(target.report.Uploaded())
+		matched += int64(target.report.Matched())
+		uploadedBytes += target.report.UploadedBytes()
+		errors += int64(len(target.report.Failed()))
+	}
+	if runExitCode != 0 {
+		errors++
+	}
+
+	metrics := []pushgateway.Metric{
+		{Name: "piwigo_uploader_run_duration_seconds", Help: "Duration of the last run in seconds.", Value: time.Since(startTime).Seconds()},
+		{Name: "piwigo_uploader_last_run_timestamp_seconds", Help: "Unix timestamp of the end of the last run.", Value: float64(time.Now().Unix())},
+		{Name: "piwigo_uploader_exit_code", Help: "Exit code of the last run.", Value: float64(runExitCode)},
+		{Name: "piwigo_uploader_uploaded_images", Help: "Number of images uploaded during the last run.", Value: float64(uploaded)},
+		{Name: "piwigo_uploader_matched_images", Help: "Number of images that already existed on the server during the last run.", Value: float64(matched)},
+		{Name: "piwigo_uploader_uploaded_bytes", Help: "Number of bytes uploaded during the last run.", Value: float64(uploadedBytes)},
+		{Name: "piwigo_uploader_errors", Help: "Number of errors during the last run.", Value: float64(errors)},
+	}
+
+	err := pushgateway.Push(*pushGatewayUrl, *pushGatewayJob, instance, metrics)
+	if err != nil {
+		logrus.Warnf("Could not push metrics to %s - %s", *pushGatewayUrl, err)
+		return
+	}
+	logrus.Infof("Pushed metrics of the run to %s", *pushGatewayUrl)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/manifest"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/plan"
+	"os"
+)
+
+// Writes the categories and images the synchronization of the primary installation would upload to planFile without
+// changing anything on the server or in the metadata store. Exits with 16 if the plan could not be made.
+func runPlan(context *appContext) {
+	err := loginWithRetries(context)
+	if err != nil {
+		logErrorAndExit(err, 2)
+	}
+
+	planned, err := createPlan(context)
+	logout(context)
+	if err != nil {
+		logErrorAndExit(err, 16)
+	}
+
+	err = planned.WriteFile(*planFile)
+	if err != nil {
+		logErrorAndExit(err, 16)
+	}
+}
+
+func createPlan(context *appContext) (plan.Plan, error) {
+	filesystemNodes, err := scanLocalFiles(context)
+	if err != nil {
+		return plan.Plan{}, err
+	}
+	applyCategoryKeys(filesystemNodes)
+
+	context.piwigo.UseLocalCategoryKeys(context.categoryNames.LocalKeys(filesystemNodes))
+	filesystemNodes, err = managedNodes(context, filesystemNodes)
+	if err != nil {
+		return plan.Plan{}, err
+	}
+	filesystemNodes, _ = pairRawFiles(filesystemNodes)
+	imageNodes, err := localFileStructure.SkipImagesIn(filesystemNodes, skipImagesIn)
+	if err != nil {
+		return plan.Plan{}, err
+	}
+	return plan.Create(context.piwigo, context.piwigo, context.dataStore, imageNodes, context.checksumCalculator, *piwigoUrl)
+}
+
+// Uploads the images of the plan of applyPlan to the primary installation and prints the result of every image.
+// Exits with 16 if the plan could not be read or an image failed.
+func runApplyPlan(context *appContext) {
+	planned, err := plan.Read(*applyPlan)
+	if err != nil {
+		logErrorAndExit(err, 16)
+	}
+	err = planned.CheckServer(*piwigoUrl)
+	if err != nil {
+		logErrorAndExit(err, 16)
+	}
+
+	err = loginWithRetries(context)
+	if err != nil {
+		logErrorAndExit(err, 2)
+	}
+
+	options := manifest.Options{
+		ChecksumCalculator: context.checksumCalculator,
+		CategorySettings:   defaultCategorySettings(),
+		DeferMetadata:      *deferMetadata,
+		ParallelRequests:   *parallelUploads,
+	}
+	results, err := plan.Apply(context.piwigo, context.piwigo, planned, options)
+	_ = context.piwigo.Logout()
+	if err != nil {
+		logErrorAndExit(err, 16)
+	}
+	err = manifest.WriteResults(os.Stdout, results, *jsonOutput)
+	if err != nil {
+		logErrorAndExit(err, 16)
+	}
+	if failed := manifest.Failed(results); failed > 0 {
+		logErrorAndExit(errors.New(fmt.Sprintf("%d of %d planned images failed", failed, len(results))), 16)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Starts the cpu profile of the run if cpuProfile is set and returns the function that stops it and writes the memory
+// profile to memProfile if it is set. The profiles are pprof files, e.g. for go tool pprof.
+func startProfiles(cpuProfile string, memProfile string) (func(), error) {
+	var cpuFile *os.File
+	if cpuProfile != "" {
+		var err error
+		cpuFile, err = os.Create(cpuProfile)
+		if err != nil {
+			return nil, err
+		}
+		err = pprof.StartCPUProfile(cpuFile)
+		if err != nil {
+			_ = cpuFile.Close()
+			return nil, err
+		}
+		logrus.Infof("Writing the cpu profile of the run to %s", cpuProfile)
+	}
+
+	stop := func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			err := cpuFile.Close()
+			if err != nil {
+				logrus.Errorf("Could not write the cpu profile %s - %s", cpuProfile, err)
+			}
+			cpuFile = nil
+		}
+		if memProfile != "" {
+			writeMemoryProfile(memProfile)
+		}
+	}
+	return stop, nil
+}
+
+// Writes the allocations of the whole run, which also hold the memory still in use at the end of the run.
+func writeMemoryProfile(memProfile string) {
+	file, err := os.Create(memProfile)
+	if err != nil {
+		logrus.Errorf("Could not create the memory profile %s - %s", memProfile, err)
+		return
+	}
+	defer file.Close()
+
+	// collects the garbage, so the memory in use is up to date
+	runtime.GC()
+	err = pprof.Lookup("allocs").WriteTo(file, 0)
+	if err != nil {
+		logrus.Errorf("Could not write the memory profile %s - %s", memProfile, err)
+		return
+	}
+	logrus.Infof("Wrote the memory profile of the run to %s", memProfile)
+}
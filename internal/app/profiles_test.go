@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_startProfiles_writes_both_profiles_when_stopped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cpuProfile := filepath.Join(dir, "cpu.pprof")
+	memProfile := filepath.Join(dir, "mem.pprof")
+
+	stop, err := startProfiles(cpuProfile, memProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	// stopping again like a signal during the cleanup does not fail
+	stop()
+
+	for _, profile := range []string{cpuProfile, memProfile} {
+		info, err := os.Stat(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("expected the profile %s to be written", profile)
+		}
+	}
+}
+
+func Test_startProfiles_without_files_writes_nothing(t *testing.T) {
+	stop, err := startProfiles("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+)
+
+// Returns the formatter of the report written at the end of the run, nil if no report is written. A template without
+// a format uses the template format. The template is parsed right away, so a broken template fails before anything
+// gets uploaded.
+func newReportFormatter() (report.Formatter, error) {
+	format := *reportFormat
+	if format == "" && *reportTemplate != "" {
+		format = report.FormatTemplate
+	}
+	if format == "" {
+		return nil, nil
+	}
+	return report.NewFormatter(format, *reportTemplate)
+}
+
+// Writes the report of all piwigo installations to the reportFile or to stdout.
+func writeRunReport(formatter report.Formatter, targets []*appContext) error {
+	data := make([]report.ReportData, 0, len(targets))
+	for _, target := range targets {
+		data = append(data, target.report.Data(target.targetName))
+	}
+
+	var writer io.Writer = os.Stdout
+	if *reportFile != "" {
+		file, err := os.Create(*reportFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("could not create the report file %s - %s", *reportFile, err))
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	err := formatter.Format(writer, report.CombineData(data))
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not write the report - %s", err))
+	}
+	if *reportFile != "" {
+		logrus.Infof("Wrote the report of the run to %s", *reportFile)
+	}
+	return nil
+}
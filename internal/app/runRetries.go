@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	gocontext "context"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Repeats a step of the run that failed before anything got changed on the server, e.g. the login or loading the
+// categories, if the server could not be reached. The delay doubles after every attempt. Failures the server
+// reported like invalid credentials are returned right away as a retry would fail the same way.
+func retryTransient(ctx gocontext.Context, step string, retries int, delay time.Duration, action func() error) error {
+	err := action()
+	for attempt := 1; attempt <= retries && piwigo.IsTransientError(err); attempt++ {
+		logrus.Warnf("%s failed, retrying in %s (%d of %d) - %s", step, delay, attempt, retries, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		err = action()
+		delay *= 2
+	}
+	return err
+}
+
+// Logs in to the piwigo installation and retries transient failures as configured by runRetries. A session borrowed
+// by noLogin is already logged in.
+func loginWithRetries(target *appContext) error {
+	if target.borrowedSession {
+		return nil
+	}
+	return retryTransient(runContext, "Login to "+target.targetName, *runRetries, *runRetryDelay, target.piwigo.Login)
+}
+
+// Loads the categories of the piwigo installation and retries transient failures as configured by runRetries.
+func retryCategoryLoad(target *appContext) func(load func() error) error {
+	return func(load func() error) error {
+		return retryTransient(runContext, "Loading the categories of "+target.targetName, *runRetries, *runRetryDelay, load)
+	}
+}
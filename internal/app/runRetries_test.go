@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	gocontext "context"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_retryTransient_retries_until_the_server_is_reachable(t *testing.T) {
+	calls := 0
+	err := retryTransient(gocontext.Background(), "Login", 3, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return &net.DNSError{Err: "no such host", Name: "example.com", IsTemporary: true}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected a success after 3 calls but got %v after %d calls", err, calls)
+	}
+}
+
+func Test_retryTransient_gives_up_after_the_retries(t *testing.T) {
+	calls := 0
+	err := retryTransient(gocontext.Background(), "Login", 2, time.Millisecond, func() error {
+		calls++
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "connection refused"}}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected the error after 3 calls but got %v after %d calls", err, calls)
+	}
+}
+
+func Test_retryTransient_does_not_retry_invalid_credentials(t *testing.T) {
+	calls := 0
+	err := retryTransient(gocontext.Background(), "Login", 3, time.Millisecond, func() error {
+		calls++
+		return &piwigo.PiwigoError{Method: "pwg.session.login", Code: 999, Message: "Invalid username/password"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected the login to fail right away but got %v after %d calls", err, calls)
+	}
+}
+
+func Test_retryTransient_stops_if_the_run_is_cancelled(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	calls := 0
+	err := retryTransient(ctx, "Login", 3, time.Hour, func() error {
+		calls++
+		return &net.DNSError{Err: "no such host", Name: "example.com"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected no retry of a cancelled run but got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The files in secretsDir, named like the keys of a Kubernetes secret mounted as directory.
+const (
+	secretFileUser     = "piwigo-user"
+	secretFilePassword = "piwigo-password"
+	secretFileToken    = "piwigo-token"
+)
+
+// Reads the credentials from the files in secretsDir. The user and the password are required to log in, the token is
+// the session cookie used by noLogin and only required then. Secrets found in the directory replace the flags.
+func readSecrets() error {
+	if *secretsDir == "" {
+		return nil
+	}
+
+	info, err := os.Stat(*secretsDir)
+	if err != nil || !info.IsDir() {
+		return errors.New(fmt.Sprintf("secretsDir %s is not a readable directory", *secretsDir))
+	}
+
+	secrets := []struct {
+		file     string
+		value    *string
+		required bool
+	}{
+		{secretFileUser, piwigoUser, !*noLogin},
+		{secretFilePassword, piwigoPassword, !*noLogin},
+		{secretFileToken, sessionCookie, *noLogin},
+	}
+	for _, secret := range secrets {
+		value, found, err := readSecret(filepath.Join(*secretsDir, secret.file))
+		if err != nil {
+			return err
+		}
+		if !found {
+			if secret.required {
+				return errors.New(fmt.Sprintf("the secret %s is missing in secretsDir %s", secret.file, *secretsDir))
+			}
+			continue
+		}
+
+		logrus.Debugf("Using the secret %s of secretsDir %s", secret.file, *secretsDir)
+		*secret.value = value
+	}
+	return nil
+}
+
+// Reads the secret without the surrounding whitespace, e.g. the line break an editor or a shell adds.
+// An empty secret is an error as it would only fail later with a less helpful message.
+func readSecret(path string) (string, bool, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.New(fmt.Sprintf("could not read the secret %s: %s", path, err))
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", false, errors.New(fmt.Sprintf("the secret %s is empty", path))
+	}
+	return value, true, nil
+}
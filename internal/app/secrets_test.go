@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_readSecrets_reads_and_trims_the_credentials(t *testing.T) {
+	directory := createSecretsDir(t, map[string]string{secretFileUser: "uploader\n", secretFilePassword: "  secret \n"})
+	setFlags(t, map[string]string{"secretsDir": directory, "piwigoUser": "flag-user", "piwigoPassword": "flag-password"})
+
+	err := readSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *piwigoUser != "uploader" || *piwigoPassword != "secret" {
+		t.Errorf("unexpected credentials %q and %q", *piwigoUser, *piwigoPassword)
+	}
+}
+
+func Test_readSecrets_requires_the_password(t *testing.T) {
+	directory := createSecretsDir(t, map[string]string{secretFileUser: "uploader"})
+	setFlags(t, map[string]string{"secretsDir": directory})
+
+	err := readSecrets()
+	if err == nil || !strings.Contains(err.Error(), "the secret piwigo-password is missing") {
+		t.Errorf("expected the missing password to be reported but got %v", err)
+	}
+}
+
+func Test_readSecrets_rejects_empty_secrets(t *testing.T) {
+	directory := createSecretsDir(t, map[string]string{secretFileUser: "uploader", secretFilePassword: "\n"})
+	setFlags(t, map[string]string{"secretsDir": directory})
+
+	err := readSecrets()
+	if err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("expected the empty password to be reported but got %v", err)
+	}
+}
+
+func Test_readSecrets_uses_only_the_token_without_login(t *testing.T) {
+	directory := createSecretsDir(t, map[string]string{secretFileToken: "pwg_id=abc\n"})
+	setFlags(t, map[string]string{"secretsDir": directory, "noLogin": "true"})
+
+	err := readSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *sessionCookie != "pwg_id=abc" {
+		t.Errorf("unexpected session cookie %q", *sessionCookie)
+	}
+}
+
+func Test_readSecrets_rejects_missing_directory(t *testing.T) {
+	setFlags(t, map[string]string{"secretsDir": filepath.Join(os.TempDir(), "missing-secrets-dir")})
+
+	err := readSecrets()
+	if err == nil {
+		t.Error("expected an error as the directory does not exist")
+	}
+}
+
+func createSecretsDir(t *testing.T, secrets map[string]string) string {
+	directory, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(directory) })
+
+	for name, value := range secrets {
+		err = ioutil.WriteFile(filepath.Join(directory, name), []byte(value), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return directory
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+// +build windows plan9
+
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import "os"
+
+// There is no SIGUSR1 on this platform, the daemon only synchronizes on its schedule.
+func notifySyncTrigger(trigger chan<- os.Signal) {
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/category"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+)
+
+// Writes the categories the local scan would lead to into the file of exportTree without contacting the server, so
+// neither the url nor the credentials of piwigo are required. Exits with 14 if the tree could not be written.
+func runTreeExport() {
+	err := validateFlags()
+	if err != nil {
+		logErrorAndExit(err, 1)
+	}
+
+	context := &appContext{localRootPath: *imagesRootPath}
+	if *archive == "" {
+		err = localFileStructure.CheckRootPath(context.localRootPath)
+		if err != nil {
+			logErrorAndExit(err, 1)
+		}
+	}
+	context.categoryNames, err = category.ReadNameMap(*categoryNameMap)
+	if err != nil {
+		logErrorAndExit(err, 1)
+	}
+
+	filesystemNodes, err := scanLocalFiles(context)
+	if err != nil {
+		logErrorAndExit(err, 3)
+	}
+	applyCategoryKeys(filesystemNodes)
+	filesystemNodes, _ = pairRawFiles(filesystemNodes)
+	filesystemNodes, err = localFileStructure.SkipImagesIn(filesystemNodes, skipImagesIn)
+	if err != nil {
+		logErrorAndExit(err, 3)
+	}
+
+	err = writePlannedTree(filesystemNodes, context.categoryNames)
+	if err != nil {
+		logErrorAndExit(err, 14)
+	}
+}
+
+// Writes the tree to the file of exportTree or to stdout for "-".
+func writePlannedTree(filesystemNodes map[string]*localFileStructure.FilesystemNode, names *category.NameMap) error {
+	var writer io.Writer = os.Stdout
+	if *exportTree != "-" {
+		file, err := os.Create(*exportTree)
+		if err != nil {
+			return errors.New(fmt.Sprintf("could not create the tree file %s - %s", *exportTree, err))
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	err := category.WritePlannedTree(filesystemNodes, names, writer, *exportTreeFormat)
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not write the category tree - %s", err))
+	}
+	if *exportTree != "-" {
+		logrus.Infof("Wrote the planned category tree to %s", *exportTree)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// How the server compares the names of categories.
+const (
+	// directories differing in case only get categories of their own
+	CaseSensitive = "sensitive"
+	// directories differing in case only share one category, e.g. for a server using a case insensitive collation
+	CaseInsensitive = "insensitive"
+)
+
+func validateCase(policy string) error {
+	if policy != "" && policy != CaseSensitive && policy != CaseInsensitive {
+		return errors.New(fmt.Sprintf("unknown category case %s. Use one of sensitive or insensitive", policy))
+	}
+	return nil
+}
+
+// Maps the directories whose paths differ in case only to a single canonical key, so they share one category and
+// their images are uploaded into it. The canonical key keeps the case of the existing category on the server. Without
+// one the first of the directories in lexical order names the category, so every run picks the same one. The keys and
+// names of the nodes are changed, their paths still point to the real files.
+func foldCategoryCase(nodes map[string]*localFileStructure.FilesystemNode, serverCategories map[string]*piwigo.Category) {
+	serverKeys := make(map[string]string, len(serverCategories))
+	for key := range serverCategories {
+		folded := strings.ToLower(key)
+		if existing, found := serverKeys[folded]; !found || key < existing {
+			serverKeys[folded] = key
+		}
+	}
+
+	var directories []*localFileStructure.FilesystemNode
+	for _, node := range nodes {
+		if node.IsDir {
+			directories = append(directories, node)
+		}
+	}
+	sort.Slice(directories, func(i, j int) bool {
+		depthI, depthJ := keyDepth(directories[i].Key), keyDepth(directories[j].Key)
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return directories[i].Key < directories[j].Key
+	})
+
+	// the canonical key of every directory by the folded key of the directory
+	canonicalKeys := make(map[string]string, len(directories))
+	canonicalDirectory := func(key string) string {
+		if canonical, found := canonicalKeys[strings.ToLower(key)]; found {
+			return canonical
+		}
+		return key
+	}
+	for _, node := range directories {
+		folded := strings.ToLower(node.Key)
+		canonical, found := canonicalKeys[folded]
+		if !found {
+			canonical = node.Key
+			if parent := filepath.Dir(node.Key); parent != "." {
+				canonical = filepath.Join(canonicalDirectory(parent), filepath.Base(node.Key))
+			}
+			if serverKey, onServer := serverKeys[strings.ToLower(canonical)]; onServer {
+				canonical = serverKey
+			}
+			canonicalKeys[folded] = canonical
+		}
+
+		if canonical != node.Key {
+			if found {
+				logrus.Infof("Merging the directory %s into the category %s as the server ignores the case of the names", node.Path, canonical)
+			} else {
+				logrus.Infof("Using the category %s for the directory %s as the server ignores the case of the names", canonical, node.Path)
+			}
+			node.Key = canonical
+			node.Name = filepath.Base(canonical)
+		}
+	}
+
+	for _, node := range nodes {
+		if !node.IsDir {
+			node.Key = filepath.Join(canonicalDirectory(filepath.Dir(node.Key)), filepath.Base(node.Key))
+		}
+	}
+}
+
+func keyDepth(key string) int {
+	return strings.Count(key, string(filepath.Separator))
+}
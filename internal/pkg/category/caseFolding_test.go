@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"testing"
+)
+
+func createCaseTestNodes() map[string]*localFileStructure.FilesystemNode {
+	nodes := make(map[string]*localFileStructure.FilesystemNode)
+	for _, key := range []string{"Holiday", "holiday", "holiday/Beach", "HOLIDAY/beach", "Other"} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), Name: filepath.Base(key), IsDir: true}
+	}
+	for _, key := range []string{"holiday/a.jpg", "HOLIDAY/beach/b.jpg", "Other/c.jpg"} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), Name: filepath.Base(key)}
+	}
+	return nodes
+}
+
+func Test_foldCategoryCase_merges_the_directories_into_the_first_one(t *testing.T) {
+	nodes := createCaseTestNodes()
+	foldCategoryCase(nodes, nil)
+
+	expected := map[string]string{
+		"Holiday":             "Holiday",
+		"holiday":             "Holiday",
+		"holiday/Beach":       "Holiday/beach",
+		"HOLIDAY/beach":       "Holiday/beach",
+		"Other":               "Other",
+		"holiday/a.jpg":       "Holiday/a.jpg",
+		"HOLIDAY/beach/b.jpg": "Holiday/beach/b.jpg",
+		"Other/c.jpg":         "Other/c.jpg",
+	}
+	for path, key := range expected {
+		if nodes[path].Key != key {
+			t.Errorf("expected the key %s for %s but got %s", key, path, nodes[path].Key)
+		}
+	}
+	if nodes["HOLIDAY/beach"].Name != "beach" {
+		t.Errorf("expected the name beach but got %s", nodes["HOLIDAY/beach"].Name)
+	}
+	if nodes["HOLIDAY/beach"].Path != filepath.Join("/photos", "HOLIDAY/beach") {
+		t.Errorf("expected the path to point to the directory but got %s", nodes["HOLIDAY/beach"].Path)
+	}
+}
+
+func Test_foldCategoryCase_keeps_the_case_of_the_server(t *testing.T) {
+	nodes := createCaseTestNodes()
+	serverCategories := map[string]*piwigo.Category{
+		"holiday":       {Id: 1, Key: "holiday", Name: "holiday"},
+		"holiday/BEACH": {Id: 2, Key: "holiday/BEACH", ParentId: 1, Name: "BEACH"},
+	}
+	foldCategoryCase(nodes, serverCategories)
+
+	expected := map[string]string{
+		"Holiday":             "holiday",
+		"holiday":             "holiday",
+		"holiday/Beach":       "holiday/BEACH",
+		"HOLIDAY/beach":       "holiday/BEACH",
+		"HOLIDAY/beach/b.jpg": "holiday/BEACH/b.jpg",
+	}
+	for path, key := range expected {
+		if nodes[path].Key != key {
+			t.Errorf("expected the key %s for %s but got %s", key, path, nodes[path].Key)
+		}
+	}
+}
+
+func Test_SynchronizeCategories_case_policies(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          string
+		expectedCreates []string
+	}{
+		{"sensitive", CaseSensitive, []string{"Holiday", "holiday", "holiday/Beach", "HOLIDAY/beach", "Other"}},
+		{"insensitive", CaseInsensitive, []string{"Holiday", "Holiday/beach", "Other"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			saved := make(map[string]datastore.CategoryData)
+			dbmock := NewMockCategoryProvider(mockCtrl)
+			dbmock.EXPECT().GetCategoryByKey(gomock.Any()).DoAndReturn(func(key string) (datastore.CategoryData, error) {
+				if category, found := saved[key]; found {
+					return category, nil
+				}
+				return datastore.CategoryData{}, datastore.ErrorRecordNotFound
+			}).AnyTimes()
+			dbmock.EXPECT().SaveCategory(gomock.Any()).DoAndReturn(func(category datastore.CategoryData) error {
+				saved[category.Key] = category
+				return nil
+			}).AnyTimes()
+			dbmock.EXPECT().GetCategoriesToCreate().Return(nil, nil).AnyTimes()
+
+			piwigoMock := NewMockCategoryApi(mockCtrl)
+			piwigoMock.EXPECT().GetAllCategories().Return(map[string]*piwigo.Category{}, nil).AnyTimes()
+
+			err := SynchronizeCategories(createCaseTestNodes(), piwigoMock, dbmock, NewMockImageMetadataProvider(mockCtrl), SynchronizeOptions{Case: test.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(saved) != len(test.expectedCreates) {
+				t.Errorf("expected %d categories but got %d", len(test.expectedCreates), len(saved))
+			}
+			for _, key := range test.expectedCreates {
+				if _, found := saved[key]; !found {
+					t.Errorf("expected the category %s", key)
+				}
+			}
+		})
+	}
+}
+
+func Test_SynchronizeCategories_rejects_unknown_case(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	err := SynchronizeCategories(createCaseTestNodes(), NewMockCategoryApi(mockCtrl), NewMockCategoryProvider(mockCtrl), NewMockImageMetadataProvider(mockCtrl), SynchronizeOptions{Case: "upper"})
+	if err == nil {
+		t.Error("expected an error for an unknown case policy")
+	}
+}
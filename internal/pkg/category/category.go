@@ -13,27 +13,104 @@ import (
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
 	"github.com/sirupsen/logrus"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
-func SynchronizeCategories(filesystemNodes map[string]*localFileStructure.FilesystemNode, piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider) error {
+type SynchronizeOptions struct {
+	// The created categories and their siblings are ranked in this order. Empty leaves the order to piwigo.
+	RankOrder string
+	// The number of categories of the same level that get created in parallel.
+	NumberOfWorkers int
+	// The status and comment settings of the created categories. Nil uses the defaults of the server.
+	Settings *Settings
+	// Repeats the initial loading of the categories if it fails, e.g. while the server can not be reached. Nil loads
+	// them once.
+	RetryInitialLoad func(load func() error) error
+	// The names of the created categories. Nil names them like their directories.
+	Names *NameMap
+	// How the directories are matched with the existing categories, MatchName or MatchPath. Empty matches by name.
+	Match string
+	// The policy for existing categories that collide with a directory if they are matched by path.
+	Collision string
+	// How the server compares the names of categories, CaseSensitive or CaseInsensitive. Empty compares them case
+	// sensitive.
+	Case string
+	// Collects the categories that could not be created and continues with the other ones. Nil stops the
+	// synchronization at the first category that could not be created.
+	Failures *CategoryFailures
+}
+
+// Creates the missing categories on the server and moves the categories of directories that moved locally.
+func SynchronizeCategories(filesystemNodes map[string]*localFileStructure.FilesystemNode, piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, imageDb datastore.ImageMetadataProvider, options SynchronizeOptions) error {
 	logrus.Debug("Entering SynchronizeCategories...")
 	defer logrus.Debug("Leaving SynchronizeCategories...")
 
-	err := updatePiwigoCategoriesFromServer(piwigoApi, db)
+	rankOrder := options.RankOrder
+	if rankOrder != RankOrderNone && rankOrder != RankOrderName && rankOrder != RankOrderPrefix {
+		return unknownRankOrderError(rankOrder)
+	}
+	err := validateMatching(options.Match, options.Collision)
+	if err != nil {
+		return err
+	}
+	err = validateCase(options.Case)
 	if err != nil {
 		return err
 	}
 
+	var serverCategories map[string]*piwigo.Category
+	load := func() error {
+		var err error
+		serverCategories, err = updatePiwigoCategoriesFromServer(piwigoApi, db, options.Match)
+		return err
+	}
+	if options.RetryInitialLoad != nil {
+		err = options.RetryInitialLoad(load)
+	} else {
+		err = load()
+	}
+	if err != nil {
+		return err
+	}
+
+	if options.Case == CaseInsensitive {
+		foldCategoryCase(filesystemNodes, serverCategories)
+	}
+
+	// moving a category changes the keys of all sub categories, so they are loaded again after every move
+	for {
+		var moved int
+		moved, err = moveRelocatedCategories(filesystemNodes, piwigoApi, db, imageDb)
+		if err != nil {
+			return err
+		}
+		if moved == 0 {
+			break
+		}
+
+		_, err = updatePiwigoCategoriesFromServer(piwigoApi, db, options.Match)
+		if err != nil {
+			return err
+		}
+	}
+
 	logrus.Infoln("Adding missing categories to local db...")
-	err = addMissingPiwigoCategoriesToLocalDb(db, filesystemNodes)
+	err = addMissingPiwigoCategoriesToLocalDb(db, filesystemNodes, options)
+	if err != nil {
+		return err
+	}
+
+	created, err := createMissingCategories(piwigoApi, db, options.NumberOfWorkers, options.Settings, options.Failures)
 	if err != nil {
 		return err
 	}
 
-	return createMissingCategories(piwigoApi, db)
+	return rankCreatedCategories(created, filesystemNodes, piwigoApi, db, rankOrder)
 }
 
-func addMissingPiwigoCategoriesToLocalDb(db datastore.CategoryProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode) error {
+func addMissingPiwigoCategoriesToLocalDb(db datastore.CategoryProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, options SynchronizeOptions) error {
 	logrus.Debug("Entering addMissingPiwigoCategoriesToLocalDb...")
 	defer logrus.Debug("Leave addMissingPiwigoCategoriesToLocalDb...")
 
@@ -43,23 +120,30 @@ func addMissingPiwigoCategoriesToLocalDb(db datastore.CategoryProvider, fileSyst
 			continue
 		}
 
-		_, err := db.GetCategoryByKey(file.Key)
-		if err == nil {
+		name := options.Names.Name(file.Key, file.Name)
+		category, err := db.GetCategoryByKey(file.Key)
+		if err == nil && !isCollision(category, file.Key, options.Match) {
 			logrus.Debugf("%s already exists.", file.Key)
 			continue
 		}
-		if err != datastore.ErrorRecordNotFound {
+		if err == nil {
+			category, err = resolveCollision(category, file.Key, name, options.Collision)
+			if err != nil {
+				return err
+			}
+		} else if err == datastore.ErrorRecordNotFound {
+			logrus.Debugf("Creating missing category %s", file.Key)
+			category = datastore.CategoryData{
+				Key:            file.Key,
+				Name:           name,
+				PiwigoParentId: 0,
+				PiwigoId:       0,
+				LocalPath:      file.Key,
+			}
+		} else {
 			return err
 		}
 
-		logrus.Debugf("Creating missing category %s", file.Key)
-		category := datastore.CategoryData{
-			Key:            file.Key,
-			Name:           file.Name,
-			PiwigoParentId: 0,
-			PiwigoId:       0,
-		}
-
 		err = db.SaveCategory(category)
 		if err != nil {
 			return err
@@ -68,25 +152,37 @@ func addMissingPiwigoCategoriesToLocalDb(db datastore.CategoryProvider, fileSyst
 	return nil
 }
 
-func updatePiwigoCategoriesFromServer(piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider) error {
+// Updates the categories of the local database with the categories of the server. Matching by path, a new category
+// whose path belongs to the category created for a directory, e.g. the existing category the directory collided with,
+// is not added to keep the directory using its own category. Returns the categories of the server by key.
+func updatePiwigoCategoriesFromServer(piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, match string) (map[string]*piwigo.Category, error) {
 	logrus.Debug("Entering updatePiwigoCategoriesFromServer")
 	defer logrus.Debug("Leaving updatePiwigoCategoriesFromServer")
 
 	categories, err := piwigoApi.GetAllCategories()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, pwgCat := range categories {
 		var dbCat datastore.CategoryData
 		dbCat, err = db.GetCategoryByPiwigoId(pwgCat.Id)
 		if err == datastore.ErrorRecordNotFound {
+			var shadowed bool
+			shadowed, err = isShadowedByLocalPath(pwgCat, db, match)
+			if err != nil {
+				return nil, err
+			}
+			if shadowed {
+				logrus.Debugf("Skipping category %s (%d) as its path belongs to the category of the directory", pwgCat.Key, pwgCat.Id)
+				continue
+			}
 			logrus.Debugf("Adding category %s", pwgCat.Key)
 			dbCat = datastore.CategoryData{
 				PiwigoId: pwgCat.Id,
 			}
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 
 		if dbCat.Name == pwgCat.Name && dbCat.Key == pwgCat.Key && dbCat.PiwigoParentId == pwgCat.ParentId {
@@ -94,61 +190,191 @@ func updatePiwigoCategoriesFromServer(piwigoApi piwigo.CategoryApi, db datastore
 			continue
 		}
 
+		// the recorded directory follows the category if it got moved
+		if dbCat.LocalPath != "" && dbCat.LocalPath == dbCat.Key {
+			dbCat.LocalPath = pwgCat.Key
+		}
 		dbCat.Name = pwgCat.Name
 		dbCat.Key = pwgCat.Key
 		dbCat.PiwigoParentId = pwgCat.ParentId
 
 		err = db.SaveCategory(dbCat)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return categories, nil
 }
 
-func createMissingCategories(piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider) error {
+// Creates the missing categories level by level. The categories of a level are independent of each other and are
+// created in parallel, their children are created after the whole level is done as they need the id of the parent.
+// If failures is set, the categories that fail and their children are collected in it instead of stopping.
+func createMissingCategories(piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, numberOfWorkers int, settings *Settings, failures *CategoryFailures) ([]datastore.CategoryData, error) {
 	logrus.Debug("Entering createMissingCategories...")
 	defer logrus.Debug("Leaving createMissingCategories...")
 
 	missingCategories, err := db.GetCategoriesToCreate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(missingCategories) == 0 {
 		logrus.Info("No categories missing on piwigo.")
-		return nil
+		return nil, nil
 	}
 
-	logrus.Infof("Creating %d categories", len(missingCategories))
+	if numberOfWorkers <= 0 {
+		numberOfWorkers = 1
+	}
 
-	for _, category := range missingCategories {
-		logrus.Infof("Creating category %s", category.Key)
+	logrus.Infof("Creating %d categories using %d workers", len(missingCategories), numberOfWorkers)
+	createdIds := newCategoryIdMap()
+	created := make([]datastore.CategoryData, 0, len(missingCategories))
 
-		var parentId int
-		parentId, err = getParentId(category, db)
+	for _, level := range groupCategoriesByLevel(missingCategories) {
+		level = skipChildrenOfFailedCategories(level, failures)
+		var createdInLevel []datastore.CategoryData
+		createdInLevel, err = createCategoryLevel(level, piwigoApi, db, createdIds, numberOfWorkers, settings, failures)
+		created = append(created, createdInLevel...)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
 
-		// create category on piwigo
-		id, err := piwigoApi.CreateCategory(parentId, category.Name)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Could not create category on piwigo: %s", err))
+	return created, nil
+}
+
+// Groups the categories by the depth of their key, starting with the root categories.
+func groupCategoriesByLevel(categories []datastore.CategoryData) [][]datastore.CategoryData {
+	levels := make(map[int][]datastore.CategoryData)
+	depths := make([]int, 0)
+	for _, category := range categories {
+		depth := strings.Count(filepath.Clean(category.Key), string(filepath.Separator))
+		if _, found := levels[depth]; !found {
+			depths = append(depths, depth)
 		}
+		levels[depth] = append(levels[depth], category)
+	}
 
-		// update local category information
-		category.PiwigoId = id
-		category.PiwigoParentId = parentId
+	sort.Ints(depths)
+	grouped := make([][]datastore.CategoryData, 0, len(depths))
+	for _, depth := range depths {
+		grouped = append(grouped, levels[depth])
+	}
+	return grouped
+}
 
-		err = db.SaveCategory(category)
+// Returns the categories of the level whose parent did not fail.
+func skipChildrenOfFailedCategories(level []datastore.CategoryData, failures *CategoryFailures) []datastore.CategoryData {
+	remaining := make([]datastore.CategoryData, 0, len(level))
+	for _, category := range level {
+		parentKey := filepath.Dir(category.Key)
+		if failures.failed(parentKey) {
+			failures.add(category.Key, parentFailedReason(parentKey))
+			continue
+		}
+		remaining = append(remaining, category)
+	}
+	return remaining
+}
+
+func createCategoryLevel(level []datastore.CategoryData, piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, createdIds *categoryIdMap, numberOfWorkers int, settings *Settings, failures *CategoryFailures) ([]datastore.CategoryData, error) {
+	workQueue := make(chan datastore.CategoryData)
+	results := make(chan categoryResult, len(level))
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < numberOfWorkers && i < len(level); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for category := range workQueue {
+				created, err := createCategory(category, piwigoApi, db, createdIds, settings)
+				results <- categoryResult{category: created, err: err}
+			}
+		}()
+	}
+
+	for _, category := range level {
+		workQueue <- category
+	}
+	close(workQueue)
+	wg.Wait()
+	close(results)
+
+	var firstErr error
+	created := make([]datastore.CategoryData, 0, len(level))
+	for result := range results {
+		if result.err != nil && failures != nil {
+			failures.add(result.category.Key, result.err.Error())
+			continue
+		}
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		created = append(created, result.category)
+	}
+	return created, firstErr
+}
+
+type categoryResult struct {
+	category datastore.CategoryData
+	err      error
+}
+
+func createCategory(category datastore.CategoryData, piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, createdIds *categoryIdMap, settings *Settings) (datastore.CategoryData, error) {
+	logrus.Infof("Creating category %s", category.Key)
+
+	parentId, found := createdIds.get(filepath.Dir(category.Key))
+	if !found {
+		var err error
+		parentId, err = getParentId(category, db)
 		if err != nil {
-			return err
+			return category, err
 		}
 	}
 
-	return nil
+	// create category on piwigo
+	id, err := piwigoApi.CreateCategoryWithSettings(parentId, category.Name, settings.Lookup(category.Key))
+	if err != nil {
+		return category, errors.New(fmt.Sprintf("Could not create category on piwigo: %s", err))
+	}
+
+	// update local category information
+	category.PiwigoId = id
+	category.PiwigoParentId = parentId
+	category.LocalPath = category.Key
+	createdIds.set(category.Key, id)
+
+	err = db.SaveCategory(category)
+	return category, err
+}
+
+// The ids of the categories created during this run by their key. Used by the workers of the next level to find
+// the id of their parent.
+type categoryIdMap struct {
+	mutex sync.Mutex
+	ids   map[string]int
+}
+
+func newCategoryIdMap() *categoryIdMap {
+	return &categoryIdMap{ids: make(map[string]int)}
+}
+
+func (m *categoryIdMap) get(key string) (int, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	id, found := m.ids[key]
+	return id, found
+}
+
+func (m *categoryIdMap) set(key string, id int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.ids[key] = id
 }
 
 func getParentId(category datastore.CategoryData, db datastore.CategoryProvider) (int, error) {
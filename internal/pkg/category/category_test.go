@@ -11,12 +11,15 @@ import (
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
 	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 //go:generate mockgen -destination=./piwigo_mock_test.go -package=category git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo CategoryApi,ImageApi
-//go:generate mockgen -destination=./datastore_mock_test.go -package=category git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore CategoryProvider
+//go:generate mockgen -destination=./datastore_mock_test.go -package=category git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore CategoryProvider,ImageMetadataProvider
 
 func Test_updatePiwigoCategoriesFromServer_adds_new_categories(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
@@ -34,7 +37,7 @@ func Test_updatePiwigoCategoriesFromServer_adds_new_categories(t *testing.T) {
 	piwigoMock := NewMockCategoryApi(mockCtrl)
 	piwigoMock.EXPECT().GetAllCategories().Return(piwigoCategories, nil).Times(1)
 
-	err := updatePiwigoCategoriesFromServer(piwigoMock, dbmock)
+	_, err := updatePiwigoCategoriesFromServer(piwigoMock, dbmock, MatchName)
 	if err != nil {
 		t.Error(err)
 	}
@@ -65,7 +68,7 @@ func Test_updatePiwigoCategoriesFromServer_updates_a_category(t *testing.T) {
 	piwigoMock := NewMockCategoryApi(mockCtrl)
 	piwigoMock.EXPECT().GetAllCategories().Return(piwigoCategories, nil).Times(1)
 
-	err := updatePiwigoCategoriesFromServer(piwigoMock, dbmock)
+	_, err := updatePiwigoCategoriesFromServer(piwigoMock, dbmock, MatchName)
 	if err != nil {
 		t.Error(err)
 	}
@@ -81,9 +84,9 @@ func Test_createMissingCategories_does_not_call_piwigo_if_there_is_no_category_m
 	dbmock.EXPECT().GetCategoriesToCreate().Return(categoriesToCreate, nil).Times(1)
 
 	piwigoMock := NewMockCategoryApi(mockCtrl)
-	piwigoMock.EXPECT().CreateCategory(gomock.Any(), gomock.Any()).Times(0)
+	piwigoMock.EXPECT().CreateCategoryWithSettings(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
 
-	err := createMissingCategories(piwigoMock, dbmock)
+	_, err := createMissingCategories(piwigoMock, dbmock, 1, nil, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -97,6 +100,7 @@ func Test_addMissingPiwigoCategoriesToLocalDb_creates_category_in_database(t *te
 	expectedCategory.PiwigoParentId = 0
 	expectedCategory.PiwigoId = 0
 	expectedCategory.CategoryId = 0
+	expectedCategory.LocalPath = expectedCategory.Key
 
 	fileNode := &localFileStructure.FilesystemNode{
 		Name:    expectedCategory.Name,
@@ -113,7 +117,29 @@ func Test_addMissingPiwigoCategoriesToLocalDb_creates_category_in_database(t *te
 	dbmock.EXPECT().GetCategoryByKey(fileNode.Key).Return(datastore.CategoryData{}, datastore.ErrorRecordNotFound).Times(1)
 	dbmock.EXPECT().SaveCategory(expectedCategory).Return(nil).Times(1)
 
-	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes)
+	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes, SynchronizeOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_addMissingPiwigoCategoriesToLocalDb_uses_the_mapped_name(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	names, err := parseNameMap(strings.NewReader("(\\d{4})-wedding\tWedding $1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{
+		"2019-wedding": {Name: "2019-wedding", Key: "2019-wedding", IsDir: true},
+	}
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoryByKey("2019-wedding").Return(datastore.CategoryData{}, datastore.ErrorRecordNotFound)
+	dbmock.EXPECT().SaveCategory(datastore.CategoryData{Key: "2019-wedding", Name: "Wedding 2019", LocalPath: "2019-wedding"}).Return(nil)
+
+	err = addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes, SynchronizeOptions{Names: names})
 	if err != nil {
 		t.Error(err)
 	}
@@ -137,7 +163,7 @@ func Test_addMissingPiwigoCategoriesToLocalDb_does_nothing_already_in_db(t *test
 	dbmock := NewMockCategoryProvider(mockCtrl)
 	dbmock.EXPECT().GetCategoryByKey(fileNode.Key).Return(datastore.CategoryData{}, nil).Times(1)
 
-	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes)
+	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes, SynchronizeOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -160,7 +186,7 @@ func Test_addMissingPiwigoCategoriesToLocalDb_does_nothing_if_list_contains_only
 
 	dbmock := NewMockCategoryProvider(mockCtrl)
 
-	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes)
+	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes, SynchronizeOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -174,7 +200,7 @@ func Test_addMissingPiwigoCategoriesToLocalDb_does_nothing_if_list_is_empty(t *t
 
 	dbmock := NewMockCategoryProvider(mockCtrl)
 
-	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes)
+	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes, SynchronizeOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -185,6 +211,7 @@ func Test_createMissingCategories_calls_piwigo_api_and_saves_returned_id(t *test
 	defer mockCtrl.Finish()
 
 	expectedCategory := createDbRootCategory()
+	expectedCategory.LocalPath = expectedCategory.Key
 	category := createDbRootCategory()
 	category.PiwigoId = 0
 
@@ -195,14 +222,74 @@ func Test_createMissingCategories_calls_piwigo_api_and_saves_returned_id(t *test
 	dbmock.EXPECT().SaveCategory(expectedCategory).Return(nil).Times(1)
 
 	piwigoMock := NewMockCategoryApi(mockCtrl)
-	piwigoMock.EXPECT().CreateCategory(0, category.Name).Return(1, nil).Times(1)
+	piwigoMock.EXPECT().CreateCategoryWithSettings(0, category.Name, piwigo.CategorySettings{}).Return(1, nil).Times(1)
 
-	err := createMissingCategories(piwigoMock, dbmock)
+	_, err := createMissingCategories(piwigoMock, dbmock, 1, nil, nil)
 	if err != nil {
 		t.Error(err)
 	}
 }
 
+func Test_createMissingCategories_creates_siblings_in_parallel_after_their_parent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoriesToCreate := []datastore.CategoryData{{Key: "2019", Name: "2019"}}
+	for i := 1; i <= 12; i++ {
+		name := fmt.Sprintf("%02d", i)
+		categoriesToCreate = append(categoriesToCreate, datastore.CategoryData{Key: filepath.Join("2019", name), Name: name})
+	}
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoriesToCreate().Return(categoriesToCreate, nil).Times(1)
+	dbmock.EXPECT().SaveCategory(gomock.Any()).Return(nil).Times(len(categoriesToCreate))
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	rootCreated := false
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().CreateCategoryWithSettings(gomock.Any(), gomock.Any(), gomock.Any()).Times(len(categoriesToCreate)).DoAndReturn(func(parentId int, name string, settings piwigo.CategorySettings) (int, error) {
+		mutex.Lock()
+		if name == "2019" {
+			if parentId != 0 {
+				t.Errorf("expected the root category without parent but got %d", parentId)
+			}
+			rootCreated = true
+		} else if !rootCreated || parentId != 100 {
+			t.Errorf("category %s got created with parent %d before its parent was done", name, parentId)
+		}
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		if name == "2019" {
+			return 100, nil
+		}
+		return 200, nil
+	})
+
+	created, err := createMissingCategories(piwigoMock, dbmock, 4, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != len(categoriesToCreate) {
+		t.Errorf("expected %d created categories but got %d", len(categoriesToCreate), len(created))
+	}
+	if maxRunning < 2 || maxRunning > 4 {
+		t.Errorf("expected the siblings to be created by up to 4 parallel workers but got %d", maxRunning)
+	}
+}
+
 func Test_getParentId_returns_0_for_root_nodes(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -291,7 +378,7 @@ func Test_SynchronizeCategories(t *testing.T) {
 	piwigoMock := NewMockCategoryApi(mockCtrl)
 	piwigoMock.EXPECT().GetAllCategories().Times(1)
 
-	err := SynchronizeCategories(fileSystemNodes, piwigoMock, dbmock)
+	err := SynchronizeCategories(fileSystemNodes, piwigoMock, dbmock, NewMockImageMetadataProvider(mockCtrl), SynchronizeOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+)
+
+// Modes used to match the local directories with the existing categories on the server.
+const (
+	// a directory uses the category with the same path of names on the server
+	MatchName = "name"
+	// a directory only uses the category the uploader created or adopted for it, which is recorded in the local
+	// database. Other categories with the same path of names are collisions.
+	MatchPath = "path"
+)
+
+// Policies for a directory that collides with an existing category the uploader did not create for it.
+const (
+	// the existing category is adopted by the directory
+	CollisionReuse = "reuse"
+	// another category with the same name is created next to the existing one
+	CollisionCreateNew = "createNew"
+	// the synchronization stops
+	CollisionError = "error"
+)
+
+// Reports if the directory with the given key collides with the category of the same path in the local database. That
+// is the case if the category exists on the server, but was neither created nor adopted for the directory.
+func isCollision(category datastore.CategoryData, key string, match string) bool {
+	return match == MatchPath && category.PiwigoId != 0 && category.LocalPath != key
+}
+
+// Decides what happens to the existing category the directory with the given key and category name collides with.
+// Returns the category to save for the directory. A category without piwigo id gets created on the server.
+func resolveCollision(existing datastore.CategoryData, key string, name string, policy string) (datastore.CategoryData, error) {
+	switch policy {
+	case CollisionReuse:
+		logrus.Infof("%s: adopting the existing category %s (%d)", key, existing.Key, existing.PiwigoId)
+		existing.LocalPath = key
+		return existing, nil
+	case CollisionCreateNew:
+		logrus.Infof("%s: creating a new category next to the existing category %s (%d)", key, existing.Key, existing.PiwigoId)
+		// the existing category is forgotten as the key belongs to the directory, the new category takes its record
+		return datastore.CategoryData{CategoryId: existing.CategoryId, Key: key, Name: name, LocalPath: key}, nil
+	case CollisionError:
+		return existing, errors.New(fmt.Sprintf("the directory %s matches the category %s (%d) that was not created for it. Use the category collision policy reuse or createNew to synchronize it", key, existing.Key, existing.PiwigoId))
+	default:
+		return existing, unknownCollisionPolicyError(policy)
+	}
+}
+
+// Reports if the path of the server category that is not in the local database belongs to another category that was
+// created or adopted for the directory with that path.
+func isShadowedByLocalPath(pwgCat *piwigo.Category, db datastore.CategoryProvider, match string) (bool, error) {
+	if match != MatchPath {
+		return false, nil
+	}
+	category, err := db.GetCategoryByKey(pwgCat.Key)
+	if err == datastore.ErrorRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return category.LocalPath == pwgCat.Key && category.PiwigoId != pwgCat.Id, nil
+}
+
+func validateMatching(match string, collision string) error {
+	if match != "" && match != MatchName && match != MatchPath {
+		return errors.New(fmt.Sprintf("unknown category match %s. Use one of name or path", match))
+	}
+	if match == MatchPath && collision != CollisionReuse && collision != CollisionCreateNew && collision != CollisionError {
+		return unknownCollisionPolicyError(collision)
+	}
+	return nil
+}
+
+func unknownCollisionPolicyError(policy string) error {
+	return errors.New(fmt.Sprintf("unknown category collision policy %s. Use one of reuse, createNew or error", policy))
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func Test_isCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		category datastore.CategoryData
+		match    string
+		want     bool
+	}{
+		{"matched by name", datastore.CategoryData{PiwigoId: 5, Key: "Paris"}, MatchName, false},
+		{"created for the directory", datastore.CategoryData{PiwigoId: 5, Key: "Paris", LocalPath: "Paris"}, MatchPath, false},
+		{"not created yet", datastore.CategoryData{Key: "Paris"}, MatchPath, false},
+		{"created for another directory", datastore.CategoryData{PiwigoId: 5, Key: "Paris", LocalPath: "Travel/Paris"}, MatchPath, true},
+		{"only loaded from the server", datastore.CategoryData{PiwigoId: 5, Key: "Paris"}, MatchPath, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCollision(tt.category, "Paris", tt.match); got != tt.want {
+				t.Errorf("isCollision() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveCollision(t *testing.T) {
+	existing := datastore.CategoryData{CategoryId: 3, PiwigoId: 5, PiwigoParentId: 2, Name: "Paris", Key: "Paris", CoverPiwigoId: 7}
+	tests := []struct {
+		policy  string
+		want    datastore.CategoryData
+		wantErr bool
+	}{
+		{CollisionReuse, datastore.CategoryData{CategoryId: 3, PiwigoId: 5, PiwigoParentId: 2, Name: "Paris", Key: "Paris", CoverPiwigoId: 7, LocalPath: "Paris"}, false},
+		{CollisionCreateNew, datastore.CategoryData{CategoryId: 3, Name: "Paris 2019", Key: "Paris", LocalPath: "Paris"}, false},
+		{CollisionError, existing, true},
+		{"merge", existing, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got, err := resolveCollision(existing, "Paris", "Paris 2019", tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveCollision() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveCollision() = %s, want %s", got.String(), tt.want.String())
+			}
+		})
+	}
+}
+
+func Test_addMissingPiwigoCategoriesToLocalDb_resolves_collisions_matching_by_path(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{
+		"Paris": {Name: "Paris", Key: "Paris", IsDir: true},
+		"Rome":  {Name: "Rome", Key: "Rome", IsDir: true},
+	}
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoryByKey("Paris").Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 5, Name: "Paris", Key: "Paris"}, nil)
+	dbmock.EXPECT().GetCategoryByKey("Rome").Return(datastore.CategoryData{CategoryId: 2, PiwigoId: 6, Name: "Rome", Key: "Rome", LocalPath: "Rome"}, nil)
+	dbmock.EXPECT().SaveCategory(datastore.CategoryData{CategoryId: 1, Name: "Paris", Key: "Paris", LocalPath: "Paris"}).Return(nil)
+
+	options := SynchronizeOptions{Match: MatchPath, Collision: CollisionCreateNew}
+	err := addMissingPiwigoCategoriesToLocalDb(dbmock, fileSystemNodes, options)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_updatePiwigoCategoriesFromServer_skips_categories_whose_path_belongs_to_a_directory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	piwigoCategories := map[string]*piwigo.Category{
+		"Paris": {Id: 5, Name: "Paris", Key: "Paris"},
+	}
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoryByPiwigoId(5).Return(datastore.CategoryData{}, datastore.ErrorRecordNotFound)
+	dbmock.EXPECT().GetCategoryByKey("Paris").Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 9, Name: "Paris", Key: "Paris", LocalPath: "Paris"}, nil)
+	dbmock.EXPECT().SaveCategory(gomock.Any()).Times(0)
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().GetAllCategories().Return(piwigoCategories, nil)
+
+	_, err := updatePiwigoCategoriesFromServer(piwigoMock, dbmock, MatchPath)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore (interfaces: CategoryProvider)
+// Source: git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore (interfaces: CategoryProvider,ImageMetadataProvider)
 
 // Package category is a generated GoMock package.
 package category
@@ -91,3 +91,187 @@ func (mr *MockCategoryProviderMockRecorder) SaveCategory(arg0 interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCategory", reflect.TypeOf((*MockCategoryProvider)(nil).SaveCategory), arg0)
 }
+
+// MockImageMetadataProvider is a mock of ImageMetadataProvider interface
+type MockImageMetadataProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockImageMetadataProviderMockRecorder
+}
+
+// MockImageMetadataProviderMockRecorder is the mock recorder for MockImageMetadataProvider
+type MockImageMetadataProviderMockRecorder struct {
+	mock *MockImageMetadataProvider
+}
+
+// NewMockImageMetadataProvider creates a new mock instance
+func NewMockImageMetadataProvider(ctrl *gomock.Controller) *MockImageMetadataProvider {
+	mock := &MockImageMetadataProvider{ctrl: ctrl}
+	mock.recorder = &MockImageMetadataProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockImageMetadataProvider) EXPECT() *MockImageMetadataProviderMockRecorder {
+	return m.recorder
+}
+
+// ClearImageFailures mocks base method
+func (m *MockImageMetadataProvider) ClearImageFailures() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearImageFailures")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearImageFailures indicates an expected call of ClearImageFailures
+func (mr *MockImageMetadataProviderMockRecorder) ClearImageFailures() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearImageFailures", reflect.TypeOf((*MockImageMetadataProvider)(nil).ClearImageFailures))
+}
+
+// DeleteMarkedImages mocks base method
+func (m *MockImageMetadataProvider) DeleteMarkedImages() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMarkedImages")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMarkedImages indicates an expected call of DeleteMarkedImages
+func (mr *MockImageMetadataProviderMockRecorder) DeleteMarkedImages() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMarkedImages", reflect.TypeOf((*MockImageMetadataProvider)(nil).DeleteMarkedImages))
+}
+
+// ImageMetadata mocks base method
+func (m *MockImageMetadataProvider) ImageMetadata(arg0 string) (datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadata", arg0)
+	ret0, _ := ret[0].(datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadata indicates an expected call of ImageMetadata
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadata(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadata", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadata), arg0)
+}
+
+// ImageMetadataAll mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataAll() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataAll")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataAll indicates an expected call of ImageMetadataAll
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataAll() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataAll", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataAll))
+}
+
+// ImageMetadataByFileId mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataByFileId(arg0 string) ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataByFileId", arg0)
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataByFileId indicates an expected call of ImageMetadataByFileId
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataByFileId(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataByFileId", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataByFileId), arg0)
+}
+
+// ImageMetadataInterrupted mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataInterrupted() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataInterrupted")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataInterrupted indicates an expected call of ImageMetadataInterrupted
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataInterrupted() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataInterrupted", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataInterrupted))
+}
+
+// ImageMetadataMoved mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataMoved() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataMoved")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataMoved indicates an expected call of ImageMetadataMoved
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataMoved() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataMoved", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataMoved))
+}
+
+// ImageMetadataToDelete mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataToDelete() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataToDelete")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataToDelete indicates an expected call of ImageMetadataToDelete
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataToDelete() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataToDelete", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataToDelete))
+}
+
+// ImageMetadataToUpload mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataToUpload() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataToUpload")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataToUpload indicates an expected call of ImageMetadataToUpload
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataToUpload() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataToUpload", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataToUpload))
+}
+
+// SaveImageMetadata mocks base method
+func (m *MockImageMetadataProvider) SaveImageMetadata(arg0 datastore.ImageMetaData) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveImageMetadata", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveImageMetadata indicates an expected call of SaveImageMetadata
+func (mr *MockImageMetadataProviderMockRecorder) SaveImageMetadata(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveImageMetadata", reflect.TypeOf((*MockImageMetadataProvider)(nil).SaveImageMetadata), arg0)
+}
+
+// SavePiwigoIdAndUpdateUploadFlag mocks base method
+func (m *MockImageMetadataProvider) SavePiwigoIdAndUpdateUploadFlag(arg0 string, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePiwigoIdAndUpdateUploadFlag", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePiwigoIdAndUpdateUploadFlag indicates an expected call of SavePiwigoIdAndUpdateUploadFlag
+func (mr *MockImageMetadataProviderMockRecorder) SavePiwigoIdAndUpdateUploadFlag(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePiwigoIdAndUpdateUploadFlag", reflect.TypeOf((*MockImageMetadataProvider)(nil).SavePiwigoIdAndUpdateUploadFlag), arg0, arg1)
+}
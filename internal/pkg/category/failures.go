@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+)
+
+// The categories that could not be created by their key and why. The synchronization continues with the other
+// categories, the failed ones stay missing and are created again on the next run.
+type CategoryFailures struct {
+	reasons map[string]string
+}
+
+// A category that could not be created with the number of its images that are skipped.
+type SkippedCategory struct {
+	Key string
+	// the path of the local directory
+	Path   string
+	Reason string
+	Files  int
+}
+
+func NewCategoryFailures() *CategoryFailures {
+	return &CategoryFailures{reasons: make(map[string]string)}
+}
+
+func (f *CategoryFailures) add(key string, reason string) {
+	logrus.Errorf("Could not create the category %s, skipping its images - %s", key, reason)
+	f.reasons[key] = reason
+}
+
+func (f *CategoryFailures) failed(key string) bool {
+	if f == nil {
+		return false
+	}
+	_, found := f.reasons[key]
+	return found
+}
+
+// Removes the files of the failed categories from the nodes, so their images are not uploaded to a category that does
+// not exist. Returns the remaining nodes and the failed categories ordered by key.
+func (f *CategoryFailures) SkipFiles(nodes map[string]*localFileStructure.FilesystemNode) (map[string]*localFileStructure.FilesystemNode, []SkippedCategory) {
+	if f == nil || len(f.reasons) == 0 {
+		return nodes, nil
+	}
+
+	skipped := make(map[string]*SkippedCategory, len(f.reasons))
+	for key, reason := range f.reasons {
+		skipped[key] = &SkippedCategory{Key: key, Path: key, Reason: reason}
+	}
+
+	remaining := make(map[string]*localFileStructure.FilesystemNode, len(nodes))
+	for path, node := range nodes {
+		if node.IsDir {
+			if category, found := skipped[node.Key]; found {
+				category.Path = node.Path
+			}
+			remaining[path] = node
+			continue
+		}
+		if category, found := skipped[filepath.Dir(node.Key)]; found {
+			category.Files++
+			continue
+		}
+		remaining[path] = node
+	}
+
+	categories := make([]SkippedCategory, 0, len(skipped))
+	for _, category := range skipped {
+		categories = append(categories, *category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Key < categories[j].Key })
+	return remaining, categories
+}
+
+func parentFailedReason(category string) string {
+	return fmt.Sprintf("the parent category %s could not be created", category)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"testing"
+)
+
+func Test_createMissingCategories_continues_after_failed_categories(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoriesToCreate := []datastore.CategoryData{
+		{Key: "Bad:Name", Name: "Bad:Name"},
+		{Key: filepath.Join("Bad:Name", "Beach"), Name: "Beach"},
+		{Key: "Good", Name: "Good"},
+	}
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoriesToCreate().Return(categoriesToCreate, nil)
+	dbmock.EXPECT().SaveCategory(gomock.Any()).DoAndReturn(func(category datastore.CategoryData) error {
+		if category.Key != "Good" {
+			t.Errorf("expected only the category Good to be saved but got %s", category.Key)
+		}
+		return nil
+	})
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().CreateCategoryWithSettings(0, "Bad:Name", gomock.Any()).Return(0, errors.New("invalid name"))
+	piwigoMock.EXPECT().CreateCategoryWithSettings(0, "Good", gomock.Any()).Return(5, nil)
+
+	failures := NewCategoryFailures()
+	created, err := createMissingCategories(piwigoMock, dbmock, 2, nil, failures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].PiwigoId != 5 {
+		t.Errorf("expected the category Good to be created but got %+v", created)
+	}
+	if !failures.failed("Bad:Name") || failures.reasons[filepath.Join("Bad:Name", "Beach")] != parentFailedReason("Bad:Name") {
+		t.Errorf("expected the failed category and its child but got %v", failures.reasons)
+	}
+}
+
+func Test_createMissingCategories_stops_without_failures(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoriesToCreate().Return([]datastore.CategoryData{{Key: "Bad:Name", Name: "Bad:Name"}}, nil)
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().CreateCategoryWithSettings(0, "Bad:Name", gomock.Any()).Return(0, &piwigo.PiwigoError{Code: 1003})
+
+	_, err := createMissingCategories(piwigoMock, dbmock, 1, nil, nil)
+	if err == nil {
+		t.Error("expected the synchronization to stop")
+	}
+}
+
+func Test_CategoryFailures_SkipFiles_skips_the_images_of_failed_categories(t *testing.T) {
+	nodes := make(map[string]*localFileStructure.FilesystemNode)
+	for _, key := range []string{"Bad", "Good"} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), IsDir: true}
+	}
+	for _, key := range []string{filepath.Join("Bad", "a.jpg"), filepath.Join("Bad", "b.jpg"), filepath.Join("Good", "c.jpg")} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key)}
+	}
+
+	failures := NewCategoryFailures()
+	failures.add("Bad", "invalid name")
+	remaining, skipped := failures.SkipFiles(nodes)
+
+	if len(remaining) != 3 || remaining[filepath.Join("Good", "c.jpg")] == nil {
+		t.Errorf("expected the directories and the image of Good to remain but got %d nodes", len(remaining))
+	}
+	expected := SkippedCategory{Key: "Bad", Path: filepath.Join("/photos", "Bad"), Reason: "invalid name", Files: 2}
+	if len(skipped) != 1 || skipped[0] != expected {
+		t.Errorf("expected %+v but got %+v", expected, skipped)
+	}
+}
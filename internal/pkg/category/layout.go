@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// How the directories are turned into categories.
+const (
+	// every directory gets a category below the category of its parent directory
+	LayoutTree = "tree"
+	// the directories get categories on the root level named by their whole path
+	LayoutFlat = "flat"
+)
+
+// joins the names of the directories to the name of their category in the flat layout
+const flatNameSeparator = " - "
+
+// Changes the keys of the nodes so every directory with images or without sub directories gets a category on the
+// root level, e.g. 2019/Summer/Beach gets the category "2019 - Summer - Beach". The directories that only hold other
+// directories are removed as they get no category. The paths of the nodes still point to the real files.
+func FlattenLayout(nodes map[string]*localFileStructure.FilesystemNode) {
+	hasFiles := make(map[string]bool)
+	hasDirectories := make(map[string]bool)
+	for _, node := range nodes {
+		if node.IsDir {
+			hasDirectories[filepath.Dir(node.Key)] = true
+		} else {
+			hasFiles[filepath.Dir(node.Key)] = true
+		}
+	}
+
+	// sorted, so the same directory wins every run if two of them get the same flat key
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return nodes[paths[i]].Key < nodes[paths[j]].Key })
+
+	flatDirectories := make(map[string]string)
+	flatFiles := make(map[string]string)
+	for _, path := range paths {
+		node := nodes[path]
+		if !node.IsDir {
+			continue
+		}
+		if hasDirectories[node.Key] && !hasFiles[node.Key] {
+			logrus.Debugf("%s: No category in the flat layout as the directory only holds directories", node.Path)
+			delete(nodes, path)
+			continue
+		}
+		key := flatKey(node.Key)
+		if other, exists := flatDirectories[key]; exists {
+			logrus.Warnf("Merging the directory %s into the category %s of %s as they get the same name in the flat layout", node.Path, key, other)
+		} else {
+			flatDirectories[key] = node.Path
+		}
+		node.Key = key
+		node.Name = key
+	}
+
+	for _, path := range paths {
+		node, found := nodes[path]
+		if !found || node.IsDir {
+			continue
+		}
+		directory := filepath.Dir(node.Key)
+		if directory == "." {
+			continue
+		}
+		key := filepath.Join(flatKey(directory), filepath.Base(node.Key))
+		if other, exists := flatFiles[key]; exists {
+			logrus.Warnf("Skipping %s as the image %s has the same name in the flat layout", node.Path, other)
+			delete(nodes, path)
+			continue
+		}
+		flatFiles[key] = node.Path
+		node.Key = key
+	}
+}
+
+func flatKey(key string) string {
+	return strings.Join(strings.Split(key, string(filepath.Separator)), flatNameSeparator)
+}
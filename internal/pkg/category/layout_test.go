@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"testing"
+)
+
+func createLayoutTestNodes() map[string]*localFileStructure.FilesystemNode {
+	nodes := make(map[string]*localFileStructure.FilesystemNode)
+	for _, key := range []string{"2019", "2019/Summer", "2019/Summer/Beach", "2019/Summer/Mountains", "2019/Winter", "Empty"} {
+		key = filepath.FromSlash(key)
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), Name: filepath.Base(key), IsDir: true}
+	}
+	for _, key := range []string{"2019/Summer/Beach/a.jpg", "2019/Summer/Mountains/b.jpg", "2019/Winter/c.jpg", "2019/Winter/d.jpg", "cover.jpg"} {
+		key = filepath.FromSlash(key)
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), Name: filepath.Base(key)}
+	}
+	return nodes
+}
+
+func Test_FlattenLayout_joins_the_names_of_the_directories(t *testing.T) {
+	nodes := createLayoutTestNodes()
+	FlattenLayout(nodes)
+
+	expected := map[string]string{
+		"2019/Summer/Beach":           "2019 - Summer - Beach",
+		"2019/Summer/Mountains":       "2019 - Summer - Mountains",
+		"2019/Winter":                 "2019 - Winter",
+		"Empty":                       "Empty",
+		"2019/Summer/Beach/a.jpg":     "2019 - Summer - Beach/a.jpg",
+		"2019/Summer/Mountains/b.jpg": "2019 - Summer - Mountains/b.jpg",
+		"2019/Winter/c.jpg":           "2019 - Winter/c.jpg",
+		"2019/Winter/d.jpg":           "2019 - Winter/d.jpg",
+		"cover.jpg":                   "cover.jpg",
+	}
+	if len(nodes) != len(expected) {
+		t.Errorf("expected %d nodes but got %d", len(expected), len(nodes))
+	}
+	for path, key := range expected {
+		node, found := nodes[filepath.FromSlash(path)]
+		if !found {
+			t.Errorf("expected the node %s", path)
+			continue
+		}
+		if node.Key != filepath.FromSlash(key) {
+			t.Errorf("expected the key %s for %s but got %s", key, path, node.Key)
+		}
+		if node.IsDir && node.Name != key {
+			t.Errorf("expected the name %s for %s but got %s", key, path, node.Name)
+		}
+		if node.Path != filepath.Join("/photos", filepath.FromSlash(path)) {
+			t.Errorf("expected the path of %s to point to the real file but got %s", path, node.Path)
+		}
+	}
+}
+
+func Test_FlattenLayout_creates_no_sub_categories(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := createLayoutTestNodes()
+	FlattenLayout(nodes)
+
+	var saved []datastore.CategoryData
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoryByKey(gomock.Any()).Return(datastore.CategoryData{}, datastore.ErrorRecordNotFound).AnyTimes()
+	dbmock.EXPECT().SaveCategory(gomock.Any()).DoAndReturn(func(category datastore.CategoryData) error {
+		saved = append(saved, category)
+		return nil
+	}).AnyTimes()
+
+	err := addMissingPiwigoCategoriesToLocalDb(dbmock, nodes, SynchronizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 4 {
+		t.Errorf("expected 4 categories but got %d", len(saved))
+	}
+	for _, category := range saved {
+		parentId, err := getParentId(category, dbmock)
+		if err != nil {
+			t.Error(err)
+		}
+		if parentId != 0 || filepath.Dir(category.Key) != "." {
+			t.Errorf("expected %s to be a root category", category.Key)
+		}
+	}
+}
+
+func Test_FlattenLayout_merges_directories_with_the_same_flat_name(t *testing.T) {
+	nodes := make(map[string]*localFileStructure.FilesystemNode)
+	for _, key := range []string{"a", filepath.Join("a", "b"), "a - b"} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), Name: filepath.Base(key), IsDir: true}
+	}
+	for _, key := range []string{filepath.Join("a", "x.jpg"), filepath.Join("a", "b", "x.jpg"), filepath.Join("a - b", "x.jpg")} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: filepath.Join("/photos", key), Name: filepath.Base(key)}
+	}
+	FlattenLayout(nodes)
+
+	if nodes[filepath.Join("a", "b")].Key != "a - b" || nodes["a - b"].Key != "a - b" {
+		t.Errorf("expected both directories to get the category a - b")
+	}
+	if _, found := nodes[filepath.Join("a - b", "x.jpg")]; !found {
+		t.Error("expected the first image of the merged category to be kept")
+	}
+	if _, found := nodes[filepath.Join("a", "b", "x.jpg")]; found {
+		t.Error("expected the image with the same name in the merged category to be skipped")
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Detects directories that got moved to another parent locally and moves the existing category on the server
+// instead of creating a new one. This keeps the album id, comments and representatives of the category.
+// A category is only moved on a confident match: a category that no longer exists locally with the same name
+// and the same image file names as the new directory. Everything else falls back to create the category.
+// Returns the number of moved categories.
+func moveRelocatedCategories(filesystemNodes map[string]*localFileStructure.FilesystemNode, piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, imageDb datastore.ImageMetadataProvider) (int, error) {
+	logrus.Debug("Entering moveRelocatedCategories...")
+	defer logrus.Debug("Leaving moveRelocatedCategories...")
+
+	newDirectories, localKeys, err := findNewDirectories(filesystemNodes, db)
+	if err != nil || len(newDirectories) == 0 {
+		return 0, err
+	}
+
+	categories, err := piwigoApi.GetAllCategories()
+	if err != nil {
+		return 0, err
+	}
+
+	vanishedCategories := make(map[string]*piwigo.Category)
+	for key, category := range categories {
+		if _, exists := localKeys[key]; !exists {
+			vanishedCategories[key] = category
+		}
+	}
+	if len(vanishedCategories) == 0 {
+		return 0, nil
+	}
+	vanishedIndex := piwigo.NewCategoryIndex(vanishedCategories)
+
+	images, err := imageDb.ImageMetadataAll()
+	if err != nil {
+		return 0, err
+	}
+	imagesByCategory := make(map[int][]datastore.ImageMetaData)
+	for _, img := range images {
+		imagesByCategory[img.CategoryPiwigoId] = append(imagesByCategory[img.CategoryPiwigoId], img)
+	}
+
+	localFiles := make(map[string]map[string]*localFileStructure.FilesystemNode)
+	for _, node := range filesystemNodes {
+		if node.IsDir {
+			continue
+		}
+		directoryKey := filepath.Dir(node.Key)
+		if localFiles[directoryKey] == nil {
+			localFiles[directoryKey] = make(map[string]*localFileStructure.FilesystemNode)
+		}
+		localFiles[directoryKey][node.Name] = node
+	}
+
+	moved := 0
+	movedKeys := make([]string, 0)
+	for _, directory := range newDirectories {
+		if isBelowAny(directory.Key, movedKeys) {
+			// the sub categories are moved with their parent
+			continue
+		}
+
+		files := localFiles[directory.Key]
+		candidate := findMoveCandidate(directory, files, vanishedIndex, imagesByCategory)
+		if candidate == nil {
+			continue
+		}
+
+		parentId, err := getParentId(datastore.CategoryData{Key: directory.Key, Name: directory.Name}, db)
+		if err != nil {
+			logrus.Debugf("%s: parent of moved category %d does not exist yet. Creating a new category.", directory.Key, candidate.Id)
+			continue
+		}
+
+		logrus.Infof("%s: moving existing category %s (%d) instead of creating a new one", directory.Key, candidate.Key, candidate.Id)
+		err = piwigoApi.MoveCategory(candidate.Id, parentId)
+		if err != nil {
+			return moved, err
+		}
+
+		relocateImages(imageDb, imagesByCategory[candidate.Id], files, directory.Key)
+		movedKeys = append(movedKeys, directory.Key)
+		moved++
+	}
+
+	return moved, nil
+}
+
+// Returns the local directories without an existing category sorted by key and the keys of all local directories.
+func findNewDirectories(filesystemNodes map[string]*localFileStructure.FilesystemNode, db datastore.CategoryProvider) ([]*localFileStructure.FilesystemNode, map[string]struct{}, error) {
+	newDirectories := make([]*localFileStructure.FilesystemNode, 0)
+	localKeys := make(map[string]struct{})
+	for _, node := range filesystemNodes {
+		if !node.IsDir {
+			continue
+		}
+		localKeys[node.Key] = struct{}{}
+
+		_, err := db.GetCategoryByKey(node.Key)
+		if err == datastore.ErrorRecordNotFound {
+			newDirectories = append(newDirectories, node)
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.Slice(newDirectories, func(i, j int) bool {
+		return newDirectories[i].Key < newDirectories[j].Key
+	})
+	return newDirectories, localKeys, nil
+}
+
+func findMoveCandidate(directory *localFileStructure.FilesystemNode, files map[string]*localFileStructure.FilesystemNode, vanishedCategories *piwigo.CategoryIndex, imagesByCategory map[int][]datastore.ImageMetaData) *piwigo.Category {
+	if len(files) == 0 {
+		return nil
+	}
+
+	var candidate *piwigo.Category
+	for _, category := range vanishedCategories.ByName(directory.Name) {
+		if !hasSameFiles(imagesByCategory[category.Id], files) {
+			continue
+		}
+		if candidate != nil {
+			logrus.Debugf("%s: found more than one category to move. Creating a new category.", directory.Key)
+			return nil
+		}
+		candidate = category
+	}
+	return candidate
+}
+
+func hasSameFiles(images []datastore.ImageMetaData, files map[string]*localFileStructure.FilesystemNode) bool {
+	if len(images) != len(files) {
+		return false
+	}
+	for _, img := range images {
+		if _, found := files[img.Filename]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+// The images keep their piwigo id and are not deleted and uploaded again as their files moved with the category.
+func relocateImages(imageDb datastore.ImageMetadataProvider, images []datastore.ImageMetaData, files map[string]*localFileStructure.FilesystemNode, categoryKey string) {
+	for _, img := range images {
+		file := files[img.Filename]
+		logrus.Debugf("%s: relocating image to %s", img.FullImagePath, file.Path)
+		img.FullImagePath = file.Path
+		img.CategoryPath = categoryKey
+		err := imageDb.SaveImageMetadata(img)
+		if err != nil {
+			logrus.Warnf("%s: could not relocate metadata of moved image - %s", file.Path, err)
+		}
+	}
+}
+
+func isBelowAny(key string, parentKeys []string) bool {
+	for _, parentKey := range parentKeys {
+		if strings.HasPrefix(key, parentKey+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
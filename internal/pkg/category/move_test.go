@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"testing"
+)
+
+func Test_moveRelocatedCategories_moves_category_with_same_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := createMovedDirectoryNodes("a.jpg", "b.jpg")
+
+	dbmock := createMoveCategoryDbMock(mockCtrl)
+	imageDbMock := NewMockImageMetadataProvider(mockCtrl)
+	imageDbMock.EXPECT().ImageMetadataAll().Return(createMovedImages("a.jpg", "b.jpg"), nil)
+	imageDbMock.EXPECT().SaveImageMetadata(gomock.Any()).DoAndReturn(func(img datastore.ImageMetaData) error {
+		if img.CategoryPath != filepath.Join("2020", "holiday") || img.FullImagePath != filepath.Join("/photos/2020/holiday", img.Filename) {
+			t.Errorf("image %s was not relocated: %s", img.Filename, img.String())
+		}
+		return nil
+	}).Times(2)
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().GetAllCategories().Return(createMoveServerCategories(), nil)
+	piwigoMock.EXPECT().MoveCategory(5, 1).Return(nil)
+
+	moved, err := moveRelocatedCategories(nodes, piwigoMock, dbmock, imageDbMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Errorf("expected one moved category but got %d", moved)
+	}
+}
+
+func Test_moveRelocatedCategories_does_not_move_category_with_different_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := createMovedDirectoryNodes("a.jpg", "c.jpg")
+
+	dbmock := createMoveCategoryDbMock(mockCtrl)
+	imageDbMock := NewMockImageMetadataProvider(mockCtrl)
+	imageDbMock.EXPECT().ImageMetadataAll().Return(createMovedImages("a.jpg", "b.jpg"), nil)
+	imageDbMock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().GetAllCategories().Return(createMoveServerCategories(), nil)
+	piwigoMock.EXPECT().MoveCategory(gomock.Any(), gomock.Any()).Times(0)
+
+	moved, err := moveRelocatedCategories(nodes, piwigoMock, dbmock, imageDbMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 0 {
+		t.Errorf("expected no moved category but got %d", moved)
+	}
+}
+
+func Test_moveRelocatedCategories_does_nothing_without_new_directories(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := map[string]*localFileStructure.FilesystemNode{
+		"/photos/2020": {Key: "2020", Path: "/photos/2020", Name: "2020", IsDir: true},
+	}
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoryByKey("2020").Return(datastore.CategoryData{PiwigoId: 1, Key: "2020", Name: "2020"}, nil)
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().GetAllCategories().Times(0)
+
+	moved, err := moveRelocatedCategories(nodes, piwigoMock, dbmock, NewMockImageMetadataProvider(mockCtrl))
+	if err != nil || moved != 0 {
+		t.Errorf("expected nothing to move but got %d - %v", moved, err)
+	}
+}
+
+func createMoveCategoryDbMock(mockCtrl *gomock.Controller) *MockCategoryProvider {
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	dbmock.EXPECT().GetCategoryByKey("2020").Return(datastore.CategoryData{PiwigoId: 1, Key: "2020", Name: "2020"}, nil).AnyTimes()
+	dbmock.EXPECT().GetCategoryByKey(filepath.Join("2020", "holiday")).Return(datastore.CategoryData{}, datastore.ErrorRecordNotFound).AnyTimes()
+	return dbmock
+}
+
+// the directory holiday got moved from 2019 to 2020
+func createMovedDirectoryNodes(fileNames ...string) map[string]*localFileStructure.FilesystemNode {
+	nodes := map[string]*localFileStructure.FilesystemNode{
+		"/photos/2020":         {Key: "2020", Path: "/photos/2020", Name: "2020", IsDir: true},
+		"/photos/2020/holiday": {Key: filepath.Join("2020", "holiday"), Path: "/photos/2020/holiday", Name: "holiday", IsDir: true},
+	}
+	for _, fileName := range fileNames {
+		path := filepath.Join("/photos/2020/holiday", fileName)
+		nodes[path] = &localFileStructure.FilesystemNode{Key: filepath.Join("2020", "holiday", fileName), Path: path, Name: fileName}
+	}
+	return nodes
+}
+
+func createMovedImages(fileNames ...string) []datastore.ImageMetaData {
+	images := make([]datastore.ImageMetaData, 0, len(fileNames))
+	for i, fileName := range fileNames {
+		images = append(images, datastore.ImageMetaData{
+			ImageId:          i + 1,
+			PiwigoId:         100 + i,
+			FullImagePath:    filepath.Join("/photos/2019/holiday", fileName),
+			Filename:         fileName,
+			CategoryPath:     filepath.Join("2019", "holiday"),
+			CategoryPiwigoId: 5,
+		})
+	}
+	return images
+}
+
+func createMoveServerCategories() map[string]*piwigo.Category {
+	return map[string]*piwigo.Category{
+		"2019":         {Id: 2, Name: "2019", Key: "2019"},
+		"2019/holiday": {Id: 5, ParentId: 2, Name: "holiday", Key: "2019/holiday"},
+		"2020":         {Id: 1, Name: "2020", Key: "2020"},
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Maps the directories to the names of their categories, e.g. to name the directory 2019-Q3-wedding "Wedding 2019 Q3".
+// Every line of the file holds a regular expression and the name separated by a tab:
+//
+//	# comments and empty lines are ignored
+//	^(\d{4})-Q(\d)-wedding$	Wedding $1 Q$2
+//	^Family/Misc$	Family pictures
+//
+// A pattern containing a slash has to match the whole path of the directory relative to the root path, other patterns
+// the name of the directory. The name may refer to the groups of the pattern like $1 or ${year}. The first matching
+// rule wins, directories no rule matches keep their name. The categories keep the path of their directory as their
+// identity, only the name shown by piwigo changes.
+type NameMap struct {
+	rules []nameRule
+}
+
+type nameRule struct {
+	pattern *regexp.Regexp
+	// the pattern is matched against the whole path instead of the name of the directory
+	matchPath bool
+	name      string
+}
+
+// Reads the rules of the file. An empty path returns nil which keeps the names of all directories.
+func ReadNameMap(path string) (*NameMap, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	names, err := parseNameMap(file)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid category name map %s: %s", path, err))
+	}
+	return names, nil
+}
+
+func parseNameMap(reader io.Reader) (*NameMap, error) {
+	names := &NameMap{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.New(fmt.Sprintf("line %d is not a pattern and a name separated by a tab", lineNumber))
+		}
+		pattern, err := regexp.Compile("^(?:" + parts[0] + ")$")
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d has an invalid pattern - %s", lineNumber, err))
+		}
+		names.rules = append(names.rules, nameRule{
+			pattern:   pattern,
+			matchPath: strings.Contains(parts[0], "/"),
+			name:      strings.TrimSpace(parts[1]),
+		})
+	}
+	return names, scanner.Err()
+}
+
+// Returns the name of the category of the directory with the given key and name.
+func (names *NameMap) Name(key string, name string) string {
+	if names == nil {
+		return name
+	}
+
+	path := filepath.ToSlash(key)
+	for _, rule := range names.rules {
+		subject := name
+		if rule.matchPath {
+			subject = path
+		}
+		match := rule.pattern.FindStringSubmatchIndex(subject)
+		if match == nil {
+			continue
+		}
+		mapped := strings.TrimSpace(string(rule.pattern.ExpandString(nil, rule.name, subject, match)))
+		if mapped == "" {
+			return name
+		}
+		return mapped
+	}
+	return name
+}
+
+// Returns the keys of the directories whose category got another name by the key their category has below its parent
+// on the server, which is the key of the parent directory joined with the name of the category. The server uses it to
+// find the directory of a category again.
+func (names *NameMap) LocalKeys(nodes map[string]*localFileStructure.FilesystemNode) map[string]string {
+	if names == nil {
+		return nil
+	}
+
+	keys := make(map[string]string)
+	for _, node := range nodes {
+		if !node.IsDir {
+			continue
+		}
+		name := names.Name(node.Key, node.Name)
+		if name == node.Name {
+			continue
+		}
+		serverKey := name
+		if parent := filepath.Dir(node.Key); parent != "." {
+			serverKey = parent + string(os.PathSeparator) + name
+		}
+		if other, found := keys[serverKey]; found {
+			logrus.Warnf("The directories %s and %s both get the category name %s", other, node.Key, name)
+		}
+		keys[serverKey] = node.Key
+	}
+	return keys
+}
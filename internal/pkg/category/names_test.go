@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_NameMap_the_first_matching_rule_wins(t *testing.T) {
+	names, err := parseNameMap(strings.NewReader("# albums of the family\n" +
+		"^Family/2019-Q3-wedding$\tOur wedding\n" +
+		"\n" +
+		"(?P<year>\\d{4})-Q(\\d)-(\\w+)\t$3 ${year} Q$2\n" +
+		"\\d{4}-.*\tMiscellaneous\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{filepath.Join("Family", "2019-Q3-wedding"), "Our wedding"},
+		{filepath.Join("Friends", "2019-Q3-wedding"), "wedding 2019 Q3"},
+		{"2020-Q1-skiing", "skiing 2020 Q1"},
+		{"2020-holidays", "Miscellaneous"},
+		{filepath.Join("Family", "Kids"), "Kids"},
+	}
+	for _, tt := range tests {
+		got := names.Name(tt.key, filepath.Base(tt.key))
+		if got != tt.want {
+			t.Errorf("Name(%s) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func Test_NameMap_rejects_invalid_rules(t *testing.T) {
+	for _, content := range []string{"no tab", "pattern\t ", "([a-z]\tname"} {
+		_, err := parseNameMap(strings.NewReader(content))
+		if err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+}
+
+func Test_NameMap_LocalKeys(t *testing.T) {
+	names, err := parseNameMap(strings.NewReader("(\\d{4})-wedding\tWedding $1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := map[string]*localFileStructure.FilesystemNode{
+		"2018-wedding":                          {Key: "2018-wedding", Name: "2018-wedding", IsDir: true},
+		filepath.Join("Family", "2019-wedding"): {Key: filepath.Join("Family", "2019-wedding"), Name: "2019-wedding", IsDir: true},
+		"Family":                                {Key: "Family", Name: "Family", IsDir: true},
+		filepath.Join("Family", "2019-wedding", "a.jpg"): {Key: filepath.Join("Family", "2019-wedding", "a.jpg"), Name: "a.jpg"},
+	}
+
+	keys := names.LocalKeys(nodes)
+	if len(keys) != 2 || keys["Wedding 2018"] != "2018-wedding" || keys[filepath.Join("Family", "Wedding 2019")] != filepath.Join("Family", "2019-wedding") {
+		t.Errorf("expected the keys of the renamed directories but got %v", keys)
+	}
+
+	var all *NameMap
+	if all.Name("2018-wedding", "2018-wedding") != "2018-wedding" || all.LocalKeys(nodes) != nil {
+		t.Error("expected a nil map to keep the names")
+	}
+}
@@ -7,7 +7,9 @@ package category
 import (
 	piwigo "git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
 	gomock "github.com/golang/mock/gomock"
+	io "io"
 	reflect "reflect"
+	time "time"
 )
 
 // MockCategoryApi is a mock of CategoryApi interface
@@ -48,6 +50,35 @@ func (mr *MockCategoryApiMockRecorder) CreateCategory(arg0, arg1 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockCategoryApi)(nil).CreateCategory), arg0, arg1)
 }
 
+// CreateCategoryWithSettings mocks base method
+func (m *MockCategoryApi) CreateCategoryWithSettings(arg0 int, arg1 string, arg2 piwigo.CategorySettings) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCategoryWithSettings", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCategoryWithSettings indicates an expected call of CreateCategoryWithSettings
+func (mr *MockCategoryApiMockRecorder) CreateCategoryWithSettings(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategoryWithSettings", reflect.TypeOf((*MockCategoryApi)(nil).CreateCategoryWithSettings), arg0, arg1, arg2)
+}
+
+// DeleteCategory mocks base method
+func (m *MockCategoryApi) DeleteCategory(arg0 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCategory", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCategory indicates an expected call of DeleteCategory
+func (mr *MockCategoryApiMockRecorder) DeleteCategory(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockCategoryApi)(nil).DeleteCategory), arg0)
+}
+
 // GetAllCategories mocks base method
 func (m *MockCategoryApi) GetAllCategories() (map[string]*piwigo.Category, error) {
 	m.ctrl.T.Helper()
@@ -63,6 +94,48 @@ func (mr *MockCategoryApiMockRecorder) GetAllCategories() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllCategories", reflect.TypeOf((*MockCategoryApi)(nil).GetAllCategories))
 }
 
+// MoveCategory mocks base method
+func (m *MockCategoryApi) MoveCategory(arg0, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveCategory", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MoveCategory indicates an expected call of MoveCategory
+func (mr *MockCategoryApiMockRecorder) MoveCategory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveCategory", reflect.TypeOf((*MockCategoryApi)(nil).MoveCategory), arg0, arg1)
+}
+
+// SetCategoryRank mocks base method
+func (m *MockCategoryApi) SetCategoryRank(arg0, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCategoryRank", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCategoryRank indicates an expected call of SetCategoryRank
+func (mr *MockCategoryApiMockRecorder) SetCategoryRank(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCategoryRank", reflect.TypeOf((*MockCategoryApi)(nil).SetCategoryRank), arg0, arg1)
+}
+
+// SetCategoryRepresentative mocks base method
+func (m *MockCategoryApi) SetCategoryRepresentative(arg0, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCategoryRepresentative", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCategoryRepresentative indicates an expected call of SetCategoryRepresentative
+func (mr *MockCategoryApiMockRecorder) SetCategoryRepresentative(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCategoryRepresentative", reflect.TypeOf((*MockCategoryApi)(nil).SetCategoryRepresentative), arg0, arg1)
+}
+
 // MockImageApi is a mock of ImageApi interface
 type MockImageApi struct {
 	ctrl     *gomock.Controller
@@ -100,6 +173,96 @@ func (mr *MockImageApiMockRecorder) DeleteImages(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteImages", reflect.TypeOf((*MockImageApi)(nil).DeleteImages), arg0)
 }
 
+// DownloadImage mocks base method
+func (m *MockImageApi) DownloadImage(arg0 int, arg1 io.Writer) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadImage", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DownloadImage indicates an expected call of DownloadImage
+func (mr *MockImageApiMockRecorder) DownloadImage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadImage", reflect.TypeOf((*MockImageApi)(nil).DownloadImage), arg0, arg1)
+}
+
+// DownloadImageRanges mocks base method
+func (m *MockImageApi) DownloadImageRanges(arg0 int, arg1 []piwigo.ByteRange) ([][]byte, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadImageRanges", arg0, arg1)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DownloadImageRanges indicates an expected call of DownloadImageRanges
+func (mr *MockImageApiMockRecorder) DownloadImageRanges(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadImageRanges", reflect.TypeOf((*MockImageApi)(nil).DownloadImageRanges), arg0, arg1)
+}
+
+// GenerateDerivatives mocks base method
+func (m *MockImageApi) GenerateDerivatives(arg0 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateDerivatives", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GenerateDerivatives indicates an expected call of GenerateDerivatives
+func (mr *MockImageApiMockRecorder) GenerateDerivatives(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateDerivatives", reflect.TypeOf((*MockImageApi)(nil).GenerateDerivatives), arg0)
+}
+
+// GetCategoryImages mocks base method
+func (m *MockImageApi) GetCategoryImages(arg0 int) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategoryImages", arg0)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategoryImages indicates an expected call of GetCategoryImages
+func (mr *MockImageApiMockRecorder) GetCategoryImages(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategoryImages", reflect.TypeOf((*MockImageApi)(nil).GetCategoryImages), arg0)
+}
+
+// GetImageInfo mocks base method
+func (m *MockImageApi) GetImageInfo(arg0 int) (*piwigo.ImageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImageInfo", arg0)
+	ret0, _ := ret[0].(*piwigo.ImageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImageInfo indicates an expected call of GetImageInfo
+func (mr *MockImageApiMockRecorder) GetImageInfo(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImageInfo", reflect.TypeOf((*MockImageApi)(nil).GetImageInfo), arg0)
+}
+
+// GetOrCreateTags mocks base method
+func (m *MockImageApi) GetOrCreateTags(arg0 []string) (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrCreateTags", arg0)
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrCreateTags indicates an expected call of GetOrCreateTags
+func (mr *MockImageApiMockRecorder) GetOrCreateTags(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrCreateTags", reflect.TypeOf((*MockImageApi)(nil).GetOrCreateTags), arg0)
+}
+
 // ImageCheckFile mocks base method
 func (m *MockImageApi) ImageCheckFile(arg0 int, arg1 string) (int, error) {
 	m.ctrl.T.Helper()
@@ -130,17 +293,62 @@ func (mr *MockImageApiMockRecorder) ImagesExistOnPiwigo(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImagesExistOnPiwigo", reflect.TypeOf((*MockImageApi)(nil).ImagesExistOnPiwigo), arg0)
 }
 
+// LatestCategoryImageDate mocks base method
+func (m *MockImageApi) LatestCategoryImageDate(arg0 int) (time.Time, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LatestCategoryImageDate", arg0)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// LatestCategoryImageDate indicates an expected call of LatestCategoryImageDate
+func (mr *MockImageApiMockRecorder) LatestCategoryImageDate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LatestCategoryImageDate", reflect.TypeOf((*MockImageApi)(nil).LatestCategoryImageDate), arg0)
+}
+
+// UpdateImagesInfo mocks base method
+func (m *MockImageApi) UpdateImagesInfo(arg0 []piwigo.ImageInfoUpdate, arg1 int) (piwigo.ImageInfoUpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateImagesInfo", arg0, arg1)
+	ret0, _ := ret[0].(piwigo.ImageInfoUpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateImagesInfo indicates an expected call of UpdateImagesInfo
+func (mr *MockImageApiMockRecorder) UpdateImagesInfo(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateImagesInfo", reflect.TypeOf((*MockImageApi)(nil).UpdateImagesInfo), arg0, arg1)
+}
+
+// UploadFormat mocks base method
+func (m *MockImageApi) UploadFormat(arg0 int, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadFormat", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadFormat indicates an expected call of UploadFormat
+func (mr *MockImageApiMockRecorder) UploadFormat(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadFormat", reflect.TypeOf((*MockImageApi)(nil).UploadFormat), arg0, arg1, arg2)
+}
+
 // UploadImage mocks base method
-func (m *MockImageApi) UploadImage(arg0 int, arg1, arg2 string, arg3 int) (int, error) {
+func (m *MockImageApi) UploadImage(arg0 int, arg1, arg2 string, arg3 int, arg4 string) (piwigo.UploadResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadImage", arg0, arg1, arg2, arg3)
-	ret0, _ := ret[0].(int)
+	ret := m.ctrl.Call(m, "UploadImage", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(piwigo.UploadResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UploadImage indicates an expected call of UploadImage
-func (mr *MockImageApiMockRecorder) UploadImage(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockImageApiMockRecorder) UploadImage(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadImage", reflect.TypeOf((*MockImageApi)(nil).UploadImage), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadImage", reflect.TypeOf((*MockImageApi)(nil).UploadImage), arg0, arg1, arg2, arg3, arg4)
 }
@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Orders used to rank created categories between their siblings.
+const (
+	// the rank is left to piwigo
+	RankOrderNone = ""
+	// the categories are ranked alphabetically by their name
+	RankOrderName = "name"
+	// the categories are ranked by the numeric prefix of the directory, e.g. "01 January" before "02 February"
+	RankOrderPrefix = "prefix"
+)
+
+type rankedDirectory struct {
+	key       string
+	name      string
+	rank      int
+	hasPrefix bool
+}
+
+// Ranks the siblings of all created categories in the given order. Only the directories that exist locally are
+// ranked, categories that only exist on the server keep their position relative to each other.
+func rankCreatedCategories(created []datastore.CategoryData, filesystemNodes map[string]*localFileStructure.FilesystemNode, piwigoApi piwigo.CategoryApi, db datastore.CategoryProvider, rankOrder string) error {
+	if rankOrder == RankOrderNone || len(created) == 0 {
+		return nil
+	}
+
+	parentKeys := make(map[string]struct{})
+	for _, category := range created {
+		parentKeys[filepath.Dir(category.Key)] = struct{}{}
+	}
+
+	siblings := make(map[string][]rankedDirectory)
+	for _, node := range filesystemNodes {
+		if !node.IsDir {
+			continue
+		}
+		parentKey := filepath.Dir(node.Key)
+		if _, ok := parentKeys[parentKey]; !ok {
+			continue
+		}
+
+		// the path still contains the prefix if it got stripped from the key
+		rank, _, hasPrefix := localFileStructure.ParseRankPrefix(filepath.Base(node.Path))
+		siblings[parentKey] = append(siblings[parentKey], rankedDirectory{key: node.Key, name: node.Name, rank: rank, hasPrefix: hasPrefix})
+	}
+
+	for parentKey, directories := range siblings {
+		err := sortRankedDirectories(directories, rankOrder)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("Ranking %d categories below %s", len(directories), parentKey)
+		for i, directory := range directories {
+			category, err := db.GetCategoryByKey(directory.key)
+			if err != nil {
+				return err
+			}
+
+			err = piwigoApi.SetCategoryRank(category.PiwigoId, i+1)
+			if err != nil {
+				return errors.New(fmt.Sprintf("Could not set the rank of category %s on piwigo: %s", directory.key, err))
+			}
+		}
+	}
+
+	return nil
+}
+
+func sortRankedDirectories(directories []rankedDirectory, rankOrder string) error {
+	byName := func(a, b rankedDirectory) bool {
+		nameA, nameB := strings.ToLower(a.name), strings.ToLower(b.name)
+		if nameA != nameB {
+			return nameA < nameB
+		}
+		return a.key < b.key
+	}
+
+	switch rankOrder {
+	case RankOrderName:
+		sort.Slice(directories, func(i, j int) bool {
+			return byName(directories[i], directories[j])
+		})
+	case RankOrderPrefix:
+		// directories without a prefix are ranked after the ones with a prefix
+		sort.Slice(directories, func(i, j int) bool {
+			a, b := directories[i], directories[j]
+			if a.hasPrefix != b.hasPrefix {
+				return a.hasPrefix
+			}
+			if a.rank != b.rank {
+				return a.rank < b.rank
+			}
+			return byName(a, b)
+		})
+	default:
+		return unknownRankOrderError(rankOrder)
+	}
+	return nil
+}
+
+func unknownRankOrderError(rankOrder string) error {
+	return errors.New(fmt.Sprintf("unknown category rank order %s. Use one of name or prefix", rankOrder))
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func createRankTestNodes() map[string]*localFileStructure.FilesystemNode {
+	return map[string]*localFileStructure.FilesystemNode{
+		"/photos/2019":             {Key: "2019", Path: "/photos/2019", Name: "2019", IsDir: true},
+		"/photos/2019/10 October":  {Key: "2019/October", Path: "/photos/2019/10 October", Name: "October", IsDir: true},
+		"/photos/2019/02 February": {Key: "2019/February", Path: "/photos/2019/02 February", Name: "February", IsDir: true},
+		"/photos/2019/Misc":        {Key: "2019/Misc", Path: "/photos/2019/Misc", Name: "Misc", IsDir: true},
+		"/photos/2019/a.jpg":       {Key: "2019/a.jpg", Path: "/photos/2019/a.jpg", Name: "a.jpg"},
+	}
+}
+
+func expectRankTestCategories(dbmock *MockCategoryProvider) {
+	dbmock.EXPECT().GetCategoryByKey("2019/February").Return(datastore.CategoryData{Key: "2019/February", PiwigoId: 2}, nil).AnyTimes()
+	dbmock.EXPECT().GetCategoryByKey("2019/October").Return(datastore.CategoryData{Key: "2019/October", PiwigoId: 10}, nil).AnyTimes()
+	dbmock.EXPECT().GetCategoryByKey("2019/Misc").Return(datastore.CategoryData{Key: "2019/Misc", PiwigoId: 20}, nil).AnyTimes()
+}
+
+func Test_rankCreatedCategories_ranks_siblings_by_prefix(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	expectRankTestCategories(dbmock)
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	gomock.InOrder(
+		piwigoMock.EXPECT().SetCategoryRank(2, 1).Return(nil),
+		piwigoMock.EXPECT().SetCategoryRank(10, 2).Return(nil),
+		piwigoMock.EXPECT().SetCategoryRank(20, 3).Return(nil),
+	)
+
+	created := []datastore.CategoryData{{Key: "2019/October", PiwigoId: 10}}
+	err := rankCreatedCategories(created, createRankTestNodes(), piwigoMock, dbmock, RankOrderPrefix)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_rankCreatedCategories_ranks_siblings_by_name(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	expectRankTestCategories(dbmock)
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	gomock.InOrder(
+		piwigoMock.EXPECT().SetCategoryRank(2, 1).Return(nil),
+		piwigoMock.EXPECT().SetCategoryRank(20, 2).Return(nil),
+		piwigoMock.EXPECT().SetCategoryRank(10, 3).Return(nil),
+	)
+
+	created := []datastore.CategoryData{{Key: "2019/October", PiwigoId: 10}}
+	err := rankCreatedCategories(created, createRankTestNodes(), piwigoMock, dbmock, RankOrderName)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_rankCreatedCategories_does_nothing_without_order(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockCategoryProvider(mockCtrl)
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().SetCategoryRank(gomock.Any(), gomock.Any()).Times(0)
+
+	created := []datastore.CategoryData{{Key: "2019/October", PiwigoId: 10}}
+	err := rankCreatedCategories(created, createRankTestNodes(), piwigoMock, dbmock, RankOrderNone)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SynchronizeCategories_rejects_unknown_rank_order(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	err := SynchronizeCategories(createRankTestNodes(), NewMockCategoryApi(mockCtrl), NewMockCategoryProvider(mockCtrl), NewMockImageMetadataProvider(mockCtrl), SynchronizeOptions{RankOrder: "random"})
+	if err == nil {
+		t.Error("expected an error for an unknown rank order")
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The file in a directory that overrides the settings of the categories created for the directory and all
+// directories below it, e.g.
+//
+//	status = private
+//	commentable = false
+const SettingsMarkerFile = ".piwigo-album"
+
+// The settings of the categories that get created. Every setting of a marker file applies to the whole subtree of
+// its directory until a deeper marker file sets it again. Settings no marker file sets use the defaults.
+type Settings struct {
+	defaults  piwigo.CategorySettings
+	overrides map[string]piwigo.CategorySettings
+}
+
+// Reads the marker files of the root path and all scanned directories. Invalid marker files are ignored with a
+// warning, so the defaults apply.
+func ReadSettings(rootPath string, nodes map[string]*localFileStructure.FilesystemNode, defaults piwigo.CategorySettings) *Settings {
+	settings := &Settings{defaults: defaults, overrides: make(map[string]piwigo.CategorySettings)}
+
+	directories := make(map[string]string)
+	if fullPathRoot, err := filepath.Abs(rootPath); err == nil && rootPath != "" {
+		directories["."] = fullPathRoot
+	}
+	for _, node := range nodes {
+		if node.IsDir {
+			directories[node.Key] = node.Path
+		}
+	}
+
+	for key, directory := range directories {
+		markerPath := filepath.Join(directory, SettingsMarkerFile)
+		content, err := ioutil.ReadFile(markerPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			logrus.Warnf("Could not read %s, using the default category settings - %s", markerPath, err)
+			continue
+		}
+
+		override, err := parseSettingsMarker(content)
+		if err != nil {
+			logrus.Warnf("Ignoring %s, using the default category settings - %s", markerPath, err)
+			continue
+		}
+		logrus.Debugf("Creating the categories below %s with the settings of %s", directory, markerPath)
+		settings.overrides[key] = override
+	}
+	return settings
+}
+
+func parseSettingsMarker(content []byte) (piwigo.CategorySettings, error) {
+	settings := piwigo.CategorySettings{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return settings, errors.New(fmt.Sprintf("%q is not a setting like status = private", line))
+		}
+		name := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		switch name {
+		case "status":
+			err := piwigo.ValidateCategoryStatus(value)
+			if err != nil || value == "" {
+				return settings, errors.New(fmt.Sprintf("%q is not a status, use public or private", value))
+			}
+			settings.Status = value
+		case "commentable":
+			commentable, err := strconv.ParseBool(value)
+			if err != nil {
+				return settings, errors.New(fmt.Sprintf("%q is not a boolean, use true or false", value))
+			}
+			settings.Commentable = &commentable
+		default:
+			return settings, errors.New(fmt.Sprintf("unknown setting %s, use status or commentable", name))
+		}
+	}
+	return settings, scanner.Err()
+}
+
+// Returns the settings of the category with the given key. Without settings the defaults of the server apply.
+func (settings *Settings) Lookup(key string) piwigo.CategorySettings {
+	if settings == nil {
+		return piwigo.CategorySettings{}
+	}
+
+	result := piwigo.CategorySettings{}
+	directory := filepath.Clean(key)
+	for {
+		if override, found := settings.overrides[directory]; found {
+			if result.Status == "" {
+				result.Status = override.Status
+			}
+			if result.Commentable == nil {
+				result.Commentable = override.Commentable
+			}
+		}
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			break
+		}
+		directory = parent
+	}
+
+	if result.Status == "" {
+		result.Status = settings.defaults.Status
+	}
+	if result.Commentable == nil {
+		result.Commentable = settings.defaults.Commentable
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ReadSettings_applies_the_nearest_marker_file(t *testing.T) {
+	root, err := ioutil.TempDir("", "categorySettings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	nodes := map[string]*localFileStructure.FilesystemNode{}
+	for _, key := range []string{"family", filepath.Join("family", "kids"), "holidays", "invalid"} {
+		path := filepath.Join(root, key)
+		err = os.MkdirAll(path, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: path, Name: filepath.Base(key), IsDir: true}
+	}
+	writeSettingsMarker(t, root, "commentable = false\n")
+	writeSettingsMarker(t, filepath.Join(root, "family"), "# only the family may see it\nstatus = private\n")
+	writeSettingsMarker(t, filepath.Join(root, "family", "kids"), "commentable = true\n")
+	writeSettingsMarker(t, filepath.Join(root, "invalid"), "status = hidden\n")
+
+	settings := ReadSettings(root, nodes, piwigo.CategorySettings{Status: piwigo.CategoryStatusPublic})
+
+	tests := []struct {
+		key         string
+		status      string
+		commentable bool
+	}{
+		{"holidays", piwigo.CategoryStatusPublic, false},
+		{"family", piwigo.CategoryStatusPrivate, false},
+		{filepath.Join("family", "kids"), piwigo.CategoryStatusPrivate, true},
+		{filepath.Join("family", "kids", "2019"), piwigo.CategoryStatusPrivate, true},
+		{"invalid", piwigo.CategoryStatusPublic, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := settings.Lookup(tt.key)
+			if got.Status != tt.status || got.Commentable == nil || *got.Commentable != tt.commentable {
+				t.Errorf("unexpected settings %+v, want status %s and commentable %t", got, tt.status, tt.commentable)
+			}
+		})
+	}
+}
+
+func Test_Settings_Lookup_without_settings_uses_the_server_defaults(t *testing.T) {
+	var settings *Settings
+	got := settings.Lookup("family")
+	if got.Status != "" || got.Commentable != nil {
+		t.Errorf("expected the defaults of the server but got %+v", got)
+	}
+}
+
+func Test_parseSettingsMarker_rejects_unknown_settings(t *testing.T) {
+	for _, content := range []string{"visible = false", "status private", "commentable = maybe"} {
+		_, err := parseSettingsMarker([]byte(content))
+		if err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
+
+func writeSettingsMarker(t *testing.T, directory string, content string) {
+	err := ioutil.WriteFile(filepath.Join(directory, SettingsMarkerFile), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The formats of the category trees.
+const (
+	TreeFormatText = "text"
+	TreeFormatJson = "json"
+	TreeFormatDot  = "dot"
+)
+
+type treeNode struct {
+	Id            int         `json:"id,omitempty"`
+	Key           string      `json:"key,omitempty"`
+	Name          string      `json:"name"`
+	NbImages      int         `json:"nbImages"`
+	TotalNbImages int         `json:"totalNbImages"`
+	Children      []*treeNode `json:"children,omitempty"`
+}
+
+// Loads all categories from the server and writes them as indented tree or as JSON to the given writer.
+func PrintCategoryTree(piwigoApi piwigo.CategoryApi, writer io.Writer, asJson bool) error {
+	logrus.Debug("Entering PrintCategoryTree")
+	defer logrus.Debug("Leaving PrintCategoryTree")
+
+	categories, err := piwigoApi.GetAllCategories()
+	if err != nil {
+		return err
+	}
+
+	format := TreeFormatText
+	if asJson {
+		format = TreeFormatJson
+	}
+	return writeTree(writer, buildCategoryTree(categories), format)
+}
+
+// Writes the categories that the synchronization of the scanned files would lead to without contacting the server.
+// The categories are named like they get created, the images are counted the same way as piwigo does: the images of
+// the category itself and the total including all sub categories. Categories that already exist on the server are
+// part of the tree as well, there is no difference between created and existing categories.
+func WritePlannedTree(filesystemNodes map[string]*localFileStructure.FilesystemNode, names *NameMap, writer io.Writer, format string) error {
+	logrus.Debug("Entering WritePlannedTree")
+	defer logrus.Debug("Leaving WritePlannedTree")
+
+	return writeTree(writer, buildPlannedTree(filesystemNodes, names), format)
+}
+
+func writeTree(writer io.Writer, roots []*treeNode, format string) error {
+	switch format {
+	case TreeFormatJson:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(roots)
+	case TreeFormatDot:
+		return writeDotTree(writer, roots)
+	case TreeFormatText:
+		for _, root := range roots {
+			err := writeTreeNode(writer, root, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("unknown tree format %s. Use one of text, json or dot", format))
+	}
+}
+
+func buildCategoryTree(categories map[string]*piwigo.Category) []*treeNode {
+	nodes := make(map[int]*treeNode, len(categories))
+	for _, category := range categories {
+		nodes[category.Id] = &treeNode{
+			Id:            category.Id,
+			Name:          category.Name,
+			NbImages:      category.NbImages,
+			TotalNbImages: category.TotalNbImages,
+		}
+	}
+
+	roots := make([]*treeNode, 0)
+	for _, category := range categories {
+		node := nodes[category.Id]
+		parent, parentFound := nodes[category.ParentId]
+		if category.ParentId == 0 || !parentFound {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	sortTreeNodes(roots)
+	return roots
+}
+
+// Builds the tree of the categories of the scanned directories, the same way addMissingPiwigoCategoriesToLocalDb
+// derives the categories. Images directly in the root path belong to no category and are not counted.
+func buildPlannedTree(filesystemNodes map[string]*localFileStructure.FilesystemNode, names *NameMap) []*treeNode {
+	nodes := make(map[string]*treeNode)
+	for _, file := range filesystemNodes {
+		if file.IsDir {
+			nodes[file.Key] = &treeNode{Key: filepath.ToSlash(file.Key), Name: names.Name(file.Key, file.Name)}
+		}
+	}
+
+	for _, file := range filesystemNodes {
+		if file.IsDir {
+			continue
+		}
+		if node, found := nodes[filepath.Dir(file.Key)]; found {
+			node.NbImages++
+		}
+	}
+
+	roots := make([]*treeNode, 0)
+	for key, node := range nodes {
+		parent, parentFound := nodes[filepath.Dir(key)]
+		if !parentFound {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	sortTreeNodes(roots)
+	for _, root := range roots {
+		countTotalImages(root)
+	}
+	return roots
+}
+
+func countTotalImages(node *treeNode) int {
+	node.TotalNbImages = node.NbImages
+	for _, child := range node.Children {
+		node.TotalNbImages += countTotalImages(child)
+	}
+	return node.TotalNbImages
+}
+
+func sortTreeNodes(nodes []*treeNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name == nodes[j].Name {
+			if nodes[i].Id == nodes[j].Id {
+				return nodes[i].Key < nodes[j].Key
+			}
+			return nodes[i].Id < nodes[j].Id
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		sortTreeNodes(node.Children)
+	}
+}
+
+func writeTreeNode(writer io.Writer, node *treeNode, level int) error {
+	var err error
+	if node.Id != 0 {
+		_, err = fmt.Fprintf(writer, "%s%s (id %d, %d images, %d total)\n", strings.Repeat("  ", level), node.Name, node.Id, node.NbImages, node.TotalNbImages)
+	} else {
+		_, err = fmt.Fprintf(writer, "%s%s (%d images, %d total)\n", strings.Repeat("  ", level), node.Name, node.NbImages, node.TotalNbImages)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, child := range node.Children {
+		err = writeTreeNode(writer, child, level+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the tree as Graphviz graph, e.g. to render it with "dot -Tsvg tree.dot -o tree.svg".
+func writeDotTree(writer io.Writer, roots []*treeNode) error {
+	_, err := io.WriteString(writer, "digraph categories {\n  rankdir=LR;\n  node [shape=box];\n")
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		err = writeDotNode(writer, root, nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(writer, "}\n")
+	return err
+}
+
+func writeDotNode(writer io.Writer, node *treeNode, parent *treeNode) error {
+	_, err := fmt.Fprintf(writer, "  %s [label=%s];\n", dotNodeId(node), dotQuote(fmt.Sprintf("%s\n%d images, %d total", node.Name, node.NbImages, node.TotalNbImages)))
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		_, err = fmt.Fprintf(writer, "  %s -> %s;\n", dotNodeId(parent), dotNodeId(node))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, child := range node.Children {
+		err = writeDotNode(writer, child, node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dotNodeId(node *treeNode) string {
+	if node.Key != "" {
+		return dotQuote(node.Key)
+	}
+	return dotQuote(fmt.Sprintf("%d", node.Id))
+}
+
+// Quotes the text as Graphviz string. Line breaks are kept as the escape sequence \n that starts a new line of a label.
+func dotQuote(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	text = strings.ReplaceAll(text, "\"", "\\\"")
+	text = strings.ReplaceAll(text, "\n", "\\n")
+	return "\"" + text + "\""
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package category
+
+import (
+	"bytes"
+	"encoding/json"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_PrintCategoryTree_writes_indented_tree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	piwigoCategories := createTwoServerCategories()
+	piwigoCategories["2019"].TotalNbImages = 3
+	piwigoCategories["2019/SubCategory"].NbImages = 3
+	piwigoCategories["2019/SubCategory"].TotalNbImages = 3
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().GetAllCategories().Return(piwigoCategories, nil).Times(1)
+
+	buffer := bytes.Buffer{}
+	err := PrintCategoryTree(piwigoMock, &buffer, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2019 (id 1, 0 images, 3 total)\n  SubCategory (id 2, 3 images, 3 total)\n"
+	if buffer.String() != expected {
+		t.Errorf("Unexpected tree output:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
+
+func Test_PrintCategoryTree_writes_json(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	piwigoMock := NewMockCategoryApi(mockCtrl)
+	piwigoMock.EXPECT().GetAllCategories().Return(createTwoServerCategories(), nil).Times(1)
+
+	buffer := bytes.Buffer{}
+	err := PrintCategoryTree(piwigoMock, &buffer, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roots []treeNode
+	err = json.Unmarshal(buffer.Bytes(), &roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(roots) != 1 || roots[0].Id != 1 || len(roots[0].Children) != 1 || roots[0].Children[0].Id != 2 {
+		t.Errorf("Unexpected json tree: %s", buffer.String())
+	}
+}
+
+func createPlannedTestNodes() map[string]*localFileStructure.FilesystemNode {
+	nodes := map[string]*localFileStructure.FilesystemNode{}
+	for _, key := range []string{"2019", filepath.Join("2019", "2019-Q3-wedding"), filepath.Join("2019", "Holidays"), "2020"} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Name: filepath.Base(key), IsDir: true}
+	}
+	for _, key := range []string{"cover.jpg", filepath.Join("2019", "a.jpg"), filepath.Join("2019", "Holidays", "b.jpg"), filepath.Join("2019", "Holidays", "c.jpg"), filepath.Join("2019", "2019-Q3-wedding", "d.jpg")} {
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Name: filepath.Base(key)}
+	}
+	return nodes
+}
+
+func Test_WritePlannedTree_writes_the_mapped_names_and_image_counts(t *testing.T) {
+	names, err := parseNameMap(strings.NewReader("(\\d{4})-Q(\\d)-wedding\tWedding $1 Q$2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	err = WritePlannedTree(createPlannedTestNodes(), names, &buffer, TreeFormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2019 (1 images, 4 total)\n  Holidays (2 images, 2 total)\n  Wedding 2019 Q3 (1 images, 1 total)\n2020 (0 images, 0 total)\n"
+	if buffer.String() != expected {
+		t.Errorf("Unexpected tree output:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
+
+func Test_WritePlannedTree_writes_json_with_the_keys(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := WritePlannedTree(createPlannedTestNodes(), nil, &buffer, TreeFormatJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roots []treeNode
+	err = json.Unmarshal(buffer.Bytes(), &roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 || roots[0].Key != "2019" || roots[0].TotalNbImages != 4 || len(roots[0].Children) != 2 || roots[0].Children[0].Key != "2019/2019-Q3-wedding" {
+		t.Errorf("Unexpected json tree: %s", buffer.String())
+	}
+}
+
+func Test_WritePlannedTree_writes_a_graphviz_graph(t *testing.T) {
+	nodes := map[string]*localFileStructure.FilesystemNode{
+		"Family": {Key: "Family", Name: "Family", IsDir: true},
+		filepath.Join("Family", "The \"Best\" Day"): {Key: filepath.Join("Family", "The \"Best\" Day"), Name: "The \"Best\" Day", IsDir: true},
+	}
+
+	buffer := bytes.Buffer{}
+	err := WritePlannedTree(nodes, nil, &buffer, TreeFormatDot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "digraph categories {\n  rankdir=LR;\n  node [shape=box];\n" +
+		"  \"Family\" [label=\"Family\\n0 images, 0 total\"];\n" +
+		"  \"Family/The \\\"Best\\\" Day\" [label=\"The \\\"Best\\\" Day\\n0 images, 0 total\"];\n" +
+		"  \"Family\" -> \"Family/The \\\"Best\\\" Day\";\n}\n"
+	if buffer.String() != expected {
+		t.Errorf("Unexpected graph:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
+
+func Test_WritePlannedTree_rejects_unknown_formats(t *testing.T) {
+	err := WritePlannedTree(createPlannedTestNodes(), nil, &bytes.Buffer{}, "svg")
+	if err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package confirm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// returned if the user did not confirm the action
+var ErrorNotConfirmed = errors.New("the action was not confirmed")
+
+// the number of affected entries printed before the list gets shortened
+const maxListedEntries = 20
+
+// Asks the user to confirm actions that change or remove content on the server. A nil prompt confirms everything.
+type Prompt struct {
+	input       *bufio.Reader
+	output      io.Writer
+	interactive bool
+	assumeYes   bool
+}
+
+// Creates a prompt reading the answer from the input. If the application does not run interactively, actions
+// are only confirmed with assumeYes as nobody can answer the prompt.
+func NewPrompt(input io.Reader, output io.Writer, interactive bool, assumeYes bool) *Prompt {
+	return &Prompt{
+		input:       bufio.NewReader(input),
+		output:      output,
+		interactive: interactive,
+		assumeYes:   assumeYes,
+	}
+}
+
+// Prints the affected entries and requires the user to type "yes". Returns ErrorNotConfirmed for any other answer.
+func (p *Prompt) Confirm(action string, affected []string) error {
+	if p == nil || p.assumeYes {
+		return nil
+	}
+
+	if !p.interactive {
+		return errors.New(fmt.Sprintf("%s requires a confirmation. Set the flag yes to run it without a terminal", action))
+	}
+
+	_, _ = fmt.Fprintf(p.output, "%s affects the following %d entries on the server:\n", action, len(affected))
+	for i, entry := range affected {
+		if i == maxListedEntries {
+			_, _ = fmt.Fprintf(p.output, "  ... and %d more\n", len(affected)-maxListedEntries)
+			break
+		}
+		_, _ = fmt.Fprintf(p.output, "  %s\n", entry)
+	}
+	_, _ = fmt.Fprint(p.output, "Type yes to continue: ")
+
+	answer, err := p.input.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if strings.TrimSpace(answer) != "yes" {
+		return ErrorNotConfirmed
+	}
+	return nil
+}
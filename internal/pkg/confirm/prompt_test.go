@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package confirm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Confirm_accepts_yes(t *testing.T) {
+	output := &bytes.Buffer{}
+	prompt := NewPrompt(strings.NewReader("yes\n"), output, true, false)
+
+	err := prompt.Confirm("Deleting images", []string{"a.jpg", "b.jpg"})
+	if err != nil {
+		t.Errorf("expected the action to be confirmed but got %s", err)
+	}
+
+	if !strings.Contains(output.String(), "a.jpg") || !strings.Contains(output.String(), "b.jpg") {
+		t.Errorf("expected the affected entries to be listed but got %s", output.String())
+	}
+}
+
+func Test_Confirm_rejects_other_answers(t *testing.T) {
+	for _, answer := range []string{"y\n", "no\n", "\n", ""} {
+		prompt := NewPrompt(strings.NewReader(answer), &bytes.Buffer{}, true, false)
+
+		err := prompt.Confirm("Deleting images", []string{"a.jpg"})
+		if err != ErrorNotConfirmed {
+			t.Errorf("answer %q: expected the action to be rejected but got %v", answer, err)
+		}
+	}
+}
+
+func Test_Confirm_without_terminal_requires_assume_yes(t *testing.T) {
+	prompt := NewPrompt(strings.NewReader("yes\n"), &bytes.Buffer{}, false, false)
+	err := prompt.Confirm("Deleting images", []string{"a.jpg"})
+	if err == nil {
+		t.Error("expected an error as nobody can confirm the action")
+	}
+
+	prompt = NewPrompt(strings.NewReader(""), &bytes.Buffer{}, false, true)
+	err = prompt.Confirm("Deleting images", []string{"a.jpg"})
+	if err != nil {
+		t.Errorf("expected the action to be confirmed by assume yes but got %s", err)
+	}
+}
+
+func Test_Confirm_shortens_long_lists(t *testing.T) {
+	affected := make([]string, 50)
+	for i := range affected {
+		affected[i] = "image.jpg"
+	}
+
+	output := &bytes.Buffer{}
+	prompt := NewPrompt(strings.NewReader("yes\n"), output, true, false)
+	_ = prompt.Confirm("Deleting images", affected)
+
+	if strings.Count(output.String(), "image.jpg") != maxListedEntries || !strings.Contains(output.String(), "and 30 more") {
+		t.Errorf("expected a shortened list but got %s", output.String())
+	}
+}
+
+func Test_Confirm_nil_prompt_confirms(t *testing.T) {
+	var prompt *Prompt
+	if err := prompt.Confirm("Deleting images", []string{"a.jpg"}); err != nil {
+		t.Errorf("expected a nil prompt to confirm but got %s", err)
+	}
+}
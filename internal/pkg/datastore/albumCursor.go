@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// The number of images of an album that are completely uploaded, counted from the first image ordered by path.
+// The fingerprint identifies the files of the album the position belongs to.
+type AlbumCursor struct {
+	CategoryKey string
+	Position    int
+	Fingerprint string
+}
+
+func (c *AlbumCursor) String() string {
+	return fmt.Sprintf("AlbumCursor{CategoryKey:%s, Position:%d, Fingerprint:%s}", c.CategoryKey, c.Position, c.Fingerprint)
+}
+
+type AlbumCursorProvider interface {
+	AlbumCursors() (map[string]AlbumCursor, error)
+	SaveAlbumCursor(cursor AlbumCursor) error
+	DeleteAlbumCursor(categoryKey string) error
+}
+
+// Returns the cursors of all albums by their category key.
+func (d *LocalDataStore) AlbumCursors() (map[string]AlbumCursor, error) {
+	logrus.Trace("Query all album cursors")
+	cursors := make(map[string]AlbumCursor)
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return cursors, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT categoryKey, position, fingerprint FROM albumCursor")
+	if err != nil {
+		return cursors, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cursor := AlbumCursor{}
+		err = rows.Scan(&cursor.CategoryKey, &cursor.Position, &cursor.Fingerprint)
+		if err != nil {
+			return cursors, err
+		}
+		cursors[cursor.CategoryKey] = cursor
+	}
+	return cursors, rows.Err()
+}
+
+// Saves the cursor and replaces the existing cursor of the album.
+func (d *LocalDataStore) SaveAlbumCursor(cursor AlbumCursor) error {
+	logrus.Tracef("Saving album cursor %s", cursor.String())
+	return d.executeStatement("saving the cursor of album "+cursor.CategoryKey,
+		"INSERT OR REPLACE INTO albumCursor (categoryKey, position, fingerprint) VALUES (?,?,?)",
+		cursor.CategoryKey, cursor.Position, cursor.Fingerprint)
+}
+
+func (d *LocalDataStore) DeleteAlbumCursor(categoryKey string) error {
+	logrus.Tracef("Deleting album cursor of %s", categoryKey)
+	return d.executeStatement("deleting the cursor of album "+categoryKey,
+		"DELETE FROM albumCursor WHERE categoryKey = ?", categoryKey)
+}
+
+func (d *LocalDataStore) executeStatement(description string, statement string, args ...interface{}) error {
+	db, err := d.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(statement, args...)
+	if err != nil {
+		logrus.Errorf("Rolling back transaction of %s", description)
+		errTx := tx.Rollback()
+		if errTx != nil {
+			logrus.Errorf("Rollback of transaction of %s failed!", description)
+		}
+		return err
+	}
+
+	logrus.Tracef("Committing %s", description)
+	return tx.Commit()
+}
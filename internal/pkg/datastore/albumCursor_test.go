@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"testing"
+)
+
+func Test_album_cursor_is_saved_replaced_and_deleted(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	cursors, err := dataStore.AlbumCursors()
+	if err != nil || len(cursors) != 0 {
+		t.Fatalf("expected no cursors in a new database but got %v, %v", cursors, err)
+	}
+
+	first := AlbumCursor{CategoryKey: "2019/shooting1", Position: 10, Fingerprint: "abc"}
+	other := AlbumCursor{CategoryKey: "2019/shooting2", Position: 3, Fingerprint: "def"}
+	for _, cursor := range []AlbumCursor{first, other} {
+		err = dataStore.SaveAlbumCursor(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the next run continues the album
+	advanced := first
+	advanced.Position = 20
+	err = dataStore.SaveAlbumCursor(advanced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursors, err = dataStore.AlbumCursors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cursors) != 2 || cursors[first.CategoryKey] != advanced || cursors[other.CategoryKey] != other {
+		t.Errorf("expected the cursors %v and %v but got %v", advanced, other, cursors)
+	}
+
+	err = dataStore.DeleteAlbumCursor(first.CategoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursors, err = dataStore.AlbumCursors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := cursors[first.CategoryKey]; found || len(cursors) != 1 {
+		t.Errorf("expected only the cursor of %s but got %v", other.CategoryKey, cursors)
+	}
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"github.com/sirupsen/logrus"
+)
+
+// Returns how many chunks of the image with the md5sum the server accepted and the chunk size they got sent with.
+// Returns zero chunks if no upload of the image got interrupted.
+func (d *LocalDataStore) ChunkProgress(md5sum string) (int, int, error) {
+	logrus.Tracef("Query chunk progress of %s", md5sum)
+	db, err := d.openDatabase()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	chunks, chunkSizeInKB := 0, 0
+	err = db.QueryRow("SELECT chunks, chunkSizeInKB FROM chunkProgress WHERE md5sum = ?", md5sum).Scan(&chunks, &chunkSizeInKB)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return chunks, chunkSizeInKB, err
+}
+
+// Saves the number of chunks sent and replaces the previous progress of the image.
+func (d *LocalDataStore) SaveChunkProgress(md5sum string, chunks int, chunkSizeInKB int) error {
+	logrus.Tracef("Saving chunk progress of %s: %d chunks of %d KB", md5sum, chunks, chunkSizeInKB)
+	return d.executeStatement("saving the chunk progress of "+md5sum,
+		"INSERT OR REPLACE INTO chunkProgress (md5sum, chunks, chunkSizeInKB) VALUES (?,?,?)",
+		md5sum, chunks, chunkSizeInKB)
+}
+
+func (d *LocalDataStore) DeleteChunkProgress(md5sum string) error {
+	logrus.Tracef("Deleting chunk progress of %s", md5sum)
+	return d.executeStatement("deleting the chunk progress of "+md5sum,
+		"DELETE FROM chunkProgress WHERE md5sum = ?", md5sum)
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"testing"
+)
+
+func Test_chunk_progress_is_saved_replaced_and_deleted(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	chunks, chunkSizeInKB, err := dataStore.ChunkProgress("2019-md5")
+	if err != nil || chunks != 0 || chunkSizeInKB != 0 {
+		t.Fatalf("expected no progress in a new database but got %d, %d, %v", chunks, chunkSizeInKB, err)
+	}
+
+	for _, sent := range []int{1, 2} {
+		err = dataStore.SaveChunkProgress("2019-md5", sent, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	chunks, chunkSizeInKB, err = dataStore.ChunkProgress("2019-md5")
+	if err != nil || chunks != 2 || chunkSizeInKB != 512 {
+		t.Errorf("expected 2 chunks of 512 KB but got %d, %d, %v", chunks, chunkSizeInKB, err)
+	}
+
+	err = dataStore.DeleteChunkProgress("2019-md5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, _, err = dataStore.ChunkProgress("2019-md5")
+	if err != nil || chunks != 0 {
+		t.Errorf("expected the progress to be deleted but got %d chunks, %v", chunks, err)
+	}
+}
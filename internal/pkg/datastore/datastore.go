@@ -22,27 +22,48 @@ type CategoryData struct {
 	PiwigoParentId int
 	Name           string
 	Key            string
+	// the piwigo id of the image the uploader set as representative of the category
+	CoverPiwigoId int
+	// the piwigo id of the contact sheet uploaded to the category
+	ContactSheetPiwigoId int
+	// the key of the directory the uploader created or adopted the category for. Empty if the category was only
+	// loaded from the server.
+	LocalPath string
 }
 
 func (cat *CategoryData) String() string {
-	return fmt.Sprintf("CategoryData{CategoryId:%d, PiwigoId:%d, PiwigoParentId:%d, Name:%s, Key:%s}", cat.CategoryId, cat.PiwigoId, cat.PiwigoParentId, cat.Name, cat.Key)
+	return fmt.Sprintf("CategoryData{CategoryId:%d, PiwigoId:%d, PiwigoParentId:%d, Name:%s, Key:%s, CoverPiwigoId:%d, ContactSheetPiwigoId:%d, LocalPath:%s}", cat.CategoryId, cat.PiwigoId, cat.PiwigoParentId, cat.Name, cat.Key, cat.CoverPiwigoId, cat.ContactSheetPiwigoId, cat.LocalPath)
 }
 
 type ImageMetaData struct {
-	ImageId          int
-	PiwigoId         int
-	FullImagePath    string
-	Filename         string
-	Md5Sum           string
+	ImageId       int
+	PiwigoId      int
+	FullImagePath string
+	Filename      string
+	Md5Sum        string
+	// checksum of the configured algorithm used to detect local changes, prefixed with the algorithm
+	Checksum         string
 	LastChange       time.Time
 	CategoryPath     string
 	CategoryPiwigoId int
 	UploadRequired   bool
 	DeleteRequired   bool
+	// number of consecutive failed uploads and the reason of the last one
+	FailureCount  int
+	FailureReason string
+	// the run that started the upload of the image. Zero if there is no upload in progress.
+	UploadRunId int
+	// identifies the uploaded content if images are not compared by md5sum, e.g. the size or the exif date
+	Identity string
+	// the size and the device and inode of the file, used to detect moved files. FileId is empty if unknown.
+	FileSize int64
+	FileId   string
+	// the category the image got moved away from locally. Zero if the category on the server is up to date.
+	PreviousCategoryPiwigoId int
 }
 
 func (img *ImageMetaData) String() string {
-	return fmt.Sprintf("ImageMetaData{ImageId:%d, PiwigoId:%d, CategoryPiwigoId:%d, RelPath:%s, File:%s, Md5:%s, Change:%sS, catpath:%s, UploadRequired: %t, DeleteRequired: %t}", img.ImageId, img.PiwigoId, img.CategoryPiwigoId, img.FullImagePath, img.Filename, img.Md5Sum, img.LastChange.String(), img.CategoryPath, img.UploadRequired, img.DeleteRequired)
+	return fmt.Sprintf("ImageMetaData{ImageId:%d, PiwigoId:%d, CategoryPiwigoId:%d, RelPath:%s, File:%s, Md5:%s, Checksum:%s, Change:%sS, catpath:%s, UploadRequired: %t, DeleteRequired: %t, FailureCount: %d, UploadRunId: %d}", img.ImageId, img.PiwigoId, img.CategoryPiwigoId, img.FullImagePath, img.Filename, img.Md5Sum, img.Checksum, img.LastChange.String(), img.CategoryPath, img.UploadRequired, img.DeleteRequired, img.FailureCount, img.UploadRunId)
 }
 
 type CategoryProvider interface {
@@ -60,6 +81,10 @@ type ImageMetadataProvider interface {
 	SaveImageMetadata(m ImageMetaData) error
 	SavePiwigoIdAndUpdateUploadFlag(md5Sum string, piwigoId int) error
 	DeleteMarkedImages() error
+	ClearImageFailures() error
+	ImageMetadataInterrupted() ([]ImageMetaData, error)
+	ImageMetadataByFileId(fileId string) ([]ImageMetaData, error)
+	ImageMetadataMoved() ([]ImageMetaData, error)
 }
 
 type LocalDataStore struct {
@@ -77,15 +102,47 @@ func (d *LocalDataStore) Initialize(connectionString string) error {
 
 	d.connectionString = connectionString
 
+	err := d.initializeDatabase()
+	if errors.Is(err, ErrorDatabaseCorrupt) {
+		logrus.Errorf("The database %s can not be trusted and gets rebuilt - %s", connectionString, err)
+		err = d.backupDatabase("corrupt")
+		if err != nil {
+			return err
+		}
+		err = d.initializeDatabase()
+	}
+	return err
+}
+
+// Moves the existing database aside and starts with an empty one, so all metadata is taken from the server and the
+// local files again.
+func (d *LocalDataStore) Rebuild(connectionString string) error {
+	if connectionString == "" {
+		return errors.New("connection string could not be empty")
+	}
+
+	d.connectionString = connectionString
+
+	err := d.backupDatabase("rebuilt")
+	if err != nil {
+		return err
+	}
+	return d.initializeDatabase()
+}
+
+func (d *LocalDataStore) initializeDatabase() error {
 	db, err := d.openDatabase()
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	err = d.createTablesIfNeeded(db)
+	err = checkIntegrity(db)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return d.createTablesIfNeeded(db)
 }
 
 func (d *LocalDataStore) ImageMetadata(fullImagePath string) (ImageMetaData, error) {
@@ -98,7 +155,7 @@ func (d *LocalDataStore) ImageMetadata(fullImagePath string) (ImageMetaData, err
 	}
 	defer db.Close()
 
-	stmt, err := db.Prepare("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired FROM image WHERE fullImagePath = ?")
+	stmt, err := db.Prepare("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image WHERE fullImagePath = ?")
 	if err != nil {
 		return img, err
 	}
@@ -131,7 +188,7 @@ func (d *LocalDataStore) ImageMetadataAll() ([]ImageMetaData, error) {
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired FROM image")
+	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image")
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +217,7 @@ func (d *LocalDataStore) ImageMetadataToDelete() ([]ImageMetaData, error) {
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired FROM image WHERE deleteRequired = 1")
+	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image WHERE deleteRequired = 1")
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +246,102 @@ func (d *LocalDataStore) ImageMetadataToUpload() ([]ImageMetaData, error) {
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired FROM image WHERE uploadRequired = 1 and deleteRequired = 0 order by fullImagePath asc")
+	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image WHERE uploadRequired = 1 and deleteRequired = 0 order by fullImagePath asc")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ImageMetaData
+	for rows.Next() {
+		img := &ImageMetaData{}
+		err = readImageMetadataFromRow(rows, img)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	err = rows.Err()
+
+	return images, err
+}
+
+// Returns the images whose upload was started by a run that did not finish it, e.g. as the run crashed.
+func (d *LocalDataStore) ImageMetadataInterrupted() ([]ImageMetaData, error) {
+	logrus.Tracef("Query all image metadata of interrupted uploads")
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image WHERE uploadRunId > 0 order by fullImagePath asc")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ImageMetaData
+	for rows.Next() {
+		img := &ImageMetaData{}
+		err = readImageMetadataFromRow(rows, img)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	err = rows.Err()
+
+	return images, err
+}
+
+// Returns the images last seen as the file with the given device and inode.
+func (d *LocalDataStore) ImageMetadataByFileId(fileId string) ([]ImageMetaData, error) {
+	logrus.Tracef("Query image metadata of file id %s", fileId)
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	stmt, err := db.Prepare("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image WHERE fileId = ? order by fullImagePath asc")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.Query(fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ImageMetaData
+	for rows.Next() {
+		img := &ImageMetaData{}
+		err = readImageMetadataFromRow(rows, img)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	err = rows.Err()
+
+	return images, err
+}
+
+// Returns the images that got moved to another category locally whose category is not yet updated on the server.
+func (d *LocalDataStore) ImageMetadataMoved() ([]ImageMetaData, error) {
+	logrus.Tracef("Query all image metadata of moved images")
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT imageId, piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId FROM image WHERE previousCategoryPiwigoId > 0 and deleteRequired = 0 order by fullImagePath asc")
 	if err != nil {
 		return nil, err
 	}
@@ -305,6 +457,34 @@ func (d *LocalDataStore) DeleteMarkedImages() error {
 	return tx.Commit()
 }
 
+// Resets the failed uploads of all images, so quarantined images get uploaded again.
+func (d *LocalDataStore) ClearImageFailures() error {
+	logrus.Trace("Clearing failed uploads in the database...")
+	db, err := d.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE image SET failureCount = 0, failureReason = '' WHERE failureCount > 0")
+	if err != nil {
+		logrus.Errorf("Rolling back transaction of clearing failed uploads")
+		errTx := tx.Rollback()
+		if errTx != nil {
+			logrus.Errorf("Rollback of transaction for clearing failed uploads failed!")
+		}
+		return err
+	}
+
+	logrus.Tracef("Committing cleared failed uploads")
+	return tx.Commit()
+}
+
 func (d *LocalDataStore) SaveCategory(category CategoryData) error {
 	logrus.Tracef("Saving category: %s", category.String())
 	db, err := d.openDatabase()
@@ -347,7 +527,7 @@ func (d *LocalDataStore) GetCategoryByPiwigoId(piwigoId int) (CategoryData, erro
 	}
 	defer db.Close()
 
-	stmt, err := db.Prepare("SELECT categoryId, piwigoId, piwigoParentId, name, key FROM category WHERE piwigoId = ?")
+	stmt, err := db.Prepare("SELECT categoryId, piwigoId, piwigoParentId, name, key, coverPiwigoId, contactSheetPiwigoId, localPath FROM category WHERE piwigoId = ?")
 	if err != nil {
 		return cat, err
 	}
@@ -381,7 +561,7 @@ func (d *LocalDataStore) GetCategoryByKey(key string) (CategoryData, error) {
 	}
 	defer db.Close()
 
-	stmt, err := db.Prepare("SELECT categoryId, piwigoId, piwigoParentId, name, key FROM category WHERE key = ?")
+	stmt, err := db.Prepare("SELECT categoryId, piwigoId, piwigoParentId, name, key, coverPiwigoId, contactSheetPiwigoId, localPath FROM category WHERE key = ?")
 	if err != nil {
 		return cat, err
 	}
@@ -414,7 +594,7 @@ func (d *LocalDataStore) GetCategoriesToCreate() ([]CategoryData, error) {
 	}
 	defer db.Close()
 
-	stmt, err := db.Prepare("SELECT categoryId, piwigoId, piwigoParentId, name, key FROM category WHERE piwigoId = 0 ORDER BY key")
+	stmt, err := db.Prepare("SELECT categoryId, piwigoId, piwigoParentId, name, key, coverPiwigoId, contactSheetPiwigoId, localPath FROM category WHERE piwigoId = 0 ORDER BY key")
 	if err != nil {
 		return nil, err
 	}
@@ -461,28 +641,93 @@ func (d *LocalDataStore) createTablesIfNeeded(db *sql.DB) error {
 		"categoryPath NVARCHAR(1000) NOT NULL," +
 		"categoryPiwigoId INTEGER NULL," +
 		"uploadRequired BIT NOT NULL," +
-		"deleteRequired BIT NOT NULL" +
+		"deleteRequired BIT NOT NULL," +
+		"checksum NVARCHAR(150) NOT NULL DEFAULT ''," +
+		"failureCount INTEGER NOT NULL DEFAULT 0," +
+		"failureReason NVARCHAR(1000) NOT NULL DEFAULT ''," +
+		"uploadRunId INTEGER NOT NULL DEFAULT 0," +
+		"identity NVARCHAR(150) NOT NULL DEFAULT ''," +
+		"fileSize INTEGER NOT NULL DEFAULT 0," +
+		"fileId NVARCHAR(100) NOT NULL DEFAULT ''," +
+		"previousCategoryPiwigoId INTEGER NOT NULL DEFAULT 0" +
 		");")
 	if err != nil {
 		return err
 	}
 
+	// databases created by older versions do not have all columns
+	err = d.addColumnIfMissing(db, "image", "checksum", "NVARCHAR(150) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "failureCount", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "failureReason", "NVARCHAR(1000) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "uploadRunId", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "identity", "NVARCHAR(150) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "fileSize", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "fileId", "NVARCHAR(100) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = d.addColumnIfMissing(db, "image", "previousCategoryPiwigoId", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS UX_ImageFullImagePath ON image (fullImagePath);")
 	if err != nil {
 		return err
 	}
 
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS IX_ImageFileId ON image (fileId) WHERE fileId <> '';")
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec("CREATE TABLE IF NOT EXISTS category (" +
 		"categoryId INTEGER PRIMARY KEY," +
 		"piwigoId INTEGER NULL," +
 		"piwigoParentId INTEGER NULL," +
 		"name NVARCHAR(255) NOT NULL," +
-		"key NVARCHAR(1000) NOT NULL" +
+		"key NVARCHAR(1000) NOT NULL," +
+		"coverPiwigoId INTEGER NOT NULL DEFAULT 0," +
+		"contactSheetPiwigoId INTEGER NOT NULL DEFAULT 0," +
+		"localPath NVARCHAR(1000) NOT NULL DEFAULT ''" +
 		");")
 	if err != nil {
 		return err
 	}
 
+	err = d.addColumnIfMissing(db, "category", "coverPiwigoId", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = d.addColumnIfMissing(db, "category", "contactSheetPiwigoId", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = d.addColumnIfMissing(db, "category", "localPath", "NVARCHAR(1000) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS UX_Category_Key ON category (key);")
 	if err != nil {
 		return err
@@ -493,52 +738,132 @@ func (d *LocalDataStore) createTablesIfNeeded(db *sql.DB) error {
 		return err
 	}
 
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS run (" +
+		"runId INTEGER PRIMARY KEY," +
+		"startTime DATETIME NOT NULL," +
+		"endTime DATETIME NULL," +
+		"interrupted BIT NOT NULL DEFAULT 0" +
+		");")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS albumCursor (" +
+		"categoryKey NVARCHAR(1000) PRIMARY KEY," +
+		"position INTEGER NOT NULL," +
+		"fingerprint NVARCHAR(50) NOT NULL" +
+		");")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS chunkProgress (" +
+		"md5sum NVARCHAR(50) PRIMARY KEY," +
+		"chunks INTEGER NOT NULL," +
+		"chunkSizeInKB INTEGER NOT NULL" +
+		");")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS deferredMetadata (" +
+		"piwigoId INTEGER NOT NULL," +
+		"categoryPiwigoId INTEGER NOT NULL," +
+		"dateAvailable DATETIME NOT NULL," +
+		"width INTEGER NOT NULL DEFAULT 0," +
+		"height INTEGER NOT NULL DEFAULT 0," +
+		"filesize INTEGER NOT NULL DEFAULT 0," +
+		"PRIMARY KEY (piwigoId, categoryPiwigoId)" +
+		");")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS rawFormats (" +
+		"rawPath NVARCHAR(1000) PRIMARY KEY," +
+		"piwigoId INTEGER NOT NULL," +
+		"lastChange DATETIME NOT NULL" +
+		");")
+	if err != nil {
+		return err
+	}
+
 	logrus.Debug("Database successfully initialized")
 	return nil
 }
 
+func (d *LocalDataStore) addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int
+		var name, columnType string
+		var notNull, primaryKey int
+		var defaultValue sql.NullString
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	_ = rows.Close()
+
+	logrus.Infof("Adding missing column %s to table %s", column, table)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	return err
+}
+
 func readImageMetadataFromRow(rows *sql.Rows, img *ImageMetaData) error {
-	err := rows.Scan(&img.ImageId, &img.PiwigoId, &img.FullImagePath, &img.Filename, &img.Md5Sum, &img.LastChange, &img.CategoryPath, &img.CategoryPiwigoId, &img.UploadRequired, &img.DeleteRequired)
+	err := rows.Scan(&img.ImageId, &img.PiwigoId, &img.FullImagePath, &img.Filename, &img.Md5Sum, &img.LastChange, &img.CategoryPath, &img.CategoryPiwigoId, &img.UploadRequired, &img.DeleteRequired, &img.Checksum, &img.FailureCount, &img.FailureReason, &img.UploadRunId, &img.Identity, &img.FileSize, &img.FileId, &img.PreviousCategoryPiwigoId)
 	return err
 }
 
 func (d *LocalDataStore) insertImageMetaData(tx *sql.Tx, data ImageMetaData) error {
-	stmt, err := tx.Prepare("INSERT INTO image (piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired) VALUES (?,?,?,?,?,?,?,?,?)")
+	stmt, err := tx.Prepare("INSERT INTO image (piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired, checksum, failureCount, failureReason, uploadRunId, identity, fileSize, fileId, previousCategoryPiwigoId) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(data.PiwigoId, data.FullImagePath, data.Filename, data.Md5Sum, data.LastChange, data.CategoryPath, data.CategoryPiwigoId, data.UploadRequired, data.DeleteRequired)
+	_, err = stmt.Exec(data.PiwigoId, data.FullImagePath, data.Filename, data.Md5Sum, data.LastChange, data.CategoryPath, data.CategoryPiwigoId, data.UploadRequired, data.DeleteRequired, data.Checksum, data.FailureCount, data.FailureReason, data.UploadRunId, data.Identity, data.FileSize, data.FileId, data.PreviousCategoryPiwigoId)
 	return err
 }
 
 func (d *LocalDataStore) updateImageMetaData(tx *sql.Tx, data ImageMetaData) error {
-	stmt, err := tx.Prepare("UPDATE image SET piwigoId = ?, fullImagePath = ?, fileName = ?, md5sum = ?, lastChanged = ?, categoryPath = ?, categoryPiwigoId = ?, uploadRequired = ?, deleteRequired = ? WHERE imageId = ?")
+	stmt, err := tx.Prepare("UPDATE image SET piwigoId = ?, fullImagePath = ?, fileName = ?, md5sum = ?, lastChanged = ?, categoryPath = ?, categoryPiwigoId = ?, uploadRequired = ?, deleteRequired = ?, checksum = ?, failureCount = ?, failureReason = ?, uploadRunId = ?, identity = ?, fileSize = ?, fileId = ?, previousCategoryPiwigoId = ? WHERE imageId = ?")
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(data.PiwigoId, data.FullImagePath, data.Filename, data.Md5Sum, data.LastChange, data.CategoryPath, data.CategoryPiwigoId, data.UploadRequired, data.DeleteRequired, data.ImageId)
+	_, err = stmt.Exec(data.PiwigoId, data.FullImagePath, data.Filename, data.Md5Sum, data.LastChange, data.CategoryPath, data.CategoryPiwigoId, data.UploadRequired, data.DeleteRequired, data.Checksum, data.FailureCount, data.FailureReason, data.UploadRunId, data.Identity, data.FileSize, data.FileId, data.PreviousCategoryPiwigoId, data.ImageId)
 	return err
 }
 
 func readCategoryFromRow(rows *sql.Rows, cat *CategoryData) error {
-	err := rows.Scan(&cat.CategoryId, &cat.PiwigoId, &cat.PiwigoParentId, &cat.Name, &cat.Key)
+	err := rows.Scan(&cat.CategoryId, &cat.PiwigoId, &cat.PiwigoParentId, &cat.Name, &cat.Key, &cat.CoverPiwigoId, &cat.ContactSheetPiwigoId, &cat.LocalPath)
 	return err
 }
 
 func (d *LocalDataStore) updateCategoryData(tx *sql.Tx, data CategoryData) error {
-	stmt, err := tx.Prepare("UPDATE category SET piwigoId = ?, piwigoParentId = ?, name = ?, key = ? WHERE categoryId = ?")
+	stmt, err := tx.Prepare("UPDATE category SET piwigoId = ?, piwigoParentId = ?, name = ?, key = ?, coverPiwigoId = ?, contactSheetPiwigoId = ?, localPath = ? WHERE categoryId = ?")
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(data.PiwigoId, data.PiwigoParentId, data.Name, data.Key, data.CategoryId)
+	_, err = stmt.Exec(data.PiwigoId, data.PiwigoParentId, data.Name, data.Key, data.CoverPiwigoId, data.ContactSheetPiwigoId, data.LocalPath, data.CategoryId)
 	return err
 }
 
 func (d *LocalDataStore) insertCategoryData(tx *sql.Tx, data CategoryData) error {
-	stmt, err := tx.Prepare("INSERT INTO category (piwigoId, piwigoParentId, name, key) VALUES (?,?,?,?)")
+	stmt, err := tx.Prepare("INSERT INTO category (piwigoId, piwigoParentId, name, key, coverPiwigoId, contactSheetPiwigoId, localPath) VALUES (?,?,?,?,?,?,?)")
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(data.PiwigoId, data.PiwigoParentId, data.Name, data.Key)
+	_, err = stmt.Exec(data.PiwigoId, data.PiwigoParentId, data.Name, data.Key, data.CoverPiwigoId, data.ContactSheetPiwigoId, data.LocalPath)
 	return err
 }
@@ -6,6 +6,7 @@
 package datastore
 
 import (
+	"database/sql"
 	"os"
 	"strings"
 	"testing"
@@ -167,6 +168,54 @@ func Test_save_and_query_for_deleted_records_do_contain_images(t *testing.T) {
 	ensureMetadataAreEqual("todelete", img1, imgLoad, t)
 }
 
+func Test_initialize_adds_missing_columns_to_existing_database(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	defer cleanupDatabase(t)
+
+	db, err := sql.Open("sqlite3", databaseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE image (imageId INTEGER PRIMARY KEY, piwigoId INTEGER NULL, fullImagePath NVARCHAR(1000) NOT NULL, fileName NVARCHAR(255) NOT NULL, md5sum NVARCHAR(50) NOT NULL, lastChanged DATETIME NOT NULL, categoryPath NVARCHAR(1000) NOT NULL, categoryPiwigoId INTEGER NULL, uploadRequired BIT NOT NULL, deleteRequired BIT NOT NULL);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO image (piwigoId, fullImagePath, fileName, md5sum, lastChanged, categoryPath, categoryPiwigoId, uploadRequired, deleteRequired) VALUES (1, 'old.jpg', 'old.jpg', 'aabb', '2019-01-01 00:00:00', 'root', 1, 0, 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE category (categoryId INTEGER PRIMARY KEY, piwigoId INTEGER NULL, piwigoParentId INTEGER NULL, name NVARCHAR(255) NOT NULL, key NVARCHAR(1000) NOT NULL);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO category (piwigoId, piwigoParentId, name, key) VALUES (1, 0, 'root', 'root')")
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataStore := setupDatabase(t)
+
+	imgLoad := loadMetadataShouldNotFail("migrated", dataStore, "old.jpg", t)
+	if imgLoad.Checksum != "" || imgLoad.Md5Sum != "aabb" {
+		t.Errorf("unexpected image loaded from migrated database: %s", imgLoad.String())
+	}
+
+	category, err := dataStore.GetCategoryByKey("root")
+	if err != nil || category.CoverPiwigoId != 0 || category.LocalPath != "" {
+		t.Errorf("unexpected category loaded from migrated database: %s - %v", category.String(), err)
+	}
+
+	img := getExampleImageMetadata("new.jpg")
+	saveImageShouldNotFail("insert", dataStore, img, t)
+	imgLoad = loadMetadataShouldNotFail("insert", dataStore, "new.jpg", t)
+	if imgLoad.Checksum != img.Checksum {
+		t.Errorf("checksum not stored in migrated database. Got: %s - want: %s", imgLoad.Checksum, img.Checksum)
+	}
+}
+
 func Test_load_metadata_not_found(t *testing.T) {
 	if !dbinitOk {
 		t.Skip("Skipping test as TestDataStoreInitialize failed!")
@@ -288,6 +337,34 @@ func Test_deleteMarkedImages_should_remove_records(t *testing.T) {
 	}
 }
 
+func Test_clearImageFailures_should_reset_failed_uploads(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	img := getExampleImageMetadata("blah/foo/bar.jpg")
+	img.FailureCount = 3
+	img.FailureReason = "corrupt file"
+	saveImageShouldNotFail("failed", dataStore, img, t)
+
+	imgLoad := loadMetadataShouldNotFail("failed", dataStore, img.FullImagePath, t)
+	if imgLoad.FailureCount != 3 || imgLoad.FailureReason != "corrupt file" {
+		t.Errorf("failure not stored. Got: %d %s", imgLoad.FailureCount, imgLoad.FailureReason)
+	}
+
+	err := dataStore.ClearImageFailures()
+	if err != nil {
+		t.Fatalf("Could not clear failed uploads! %s", err)
+	}
+
+	imgLoad = loadMetadataShouldNotFail("cleared", dataStore, img.FullImagePath, t)
+	if imgLoad.FailureCount != 0 || imgLoad.FailureReason != "" {
+		t.Errorf("failure not cleared. Got: %d %s", imgLoad.FailureCount, imgLoad.FailureReason)
+	}
+}
+
 func Test_saveCategory_should_store_records(t *testing.T) {
 	if !dbinitOk {
 		t.Skip("Skipping test as TestDataStoreInitialize failed!")
@@ -349,6 +426,9 @@ func Test_saveCategory_should_update_records(t *testing.T) {
 	category.Key = category.Name
 	category.PiwigoId = 2
 	category.PiwigoParentId = 3
+	category.CoverPiwigoId = 4
+	category.ContactSheetPiwigoId = 5
+	category.LocalPath = "2019"
 
 	saveCategoryShouldNotFail("updatecategory", dataStore, category, t)
 
@@ -405,6 +485,40 @@ func Test_GetCategoriesToCreate(t *testing.T) {
 	ensureLoadedCategoryIsExpectedCategory(categories[0], category, t)
 }
 
+func Test_query_moved_images_by_file_id(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	img1 := getExampleImageMetadata("blah/foo/bar.jpg")
+	img1.FileSize = 2048
+	img1.FileId = "1:42"
+	img1.PreviousCategoryPiwigoId = 99
+	img2 := getExampleImageMetadata("blah/foo/bar2.jpg")
+	img2.FileId = "1:43"
+
+	saveImageShouldNotFail("movedimages", dataStore, img1, t)
+	saveImageShouldNotFail("movedimages", dataStore, img2, t)
+
+	images, err := dataStore.ImageMetadataByFileId("1:42")
+	if err != nil {
+		t.Fatalf("Could not query images by file id! %s", err)
+	}
+	if len(images) != 1 || images[0].FullImagePath != img1.FullImagePath || images[0].FileSize != 2048 || images[0].PreviousCategoryPiwigoId != 99 {
+		t.Errorf("Expected only %s but got %v", img1.FullImagePath, images)
+	}
+
+	images, err = dataStore.ImageMetadataMoved()
+	if err != nil {
+		t.Fatalf("Could not query moved images! %s", err)
+	}
+	if len(images) != 1 || images[0].FullImagePath != img1.FullImagePath {
+		t.Errorf("Expected only %s to be moved but got %v", img1.FullImagePath, images)
+	}
+}
+
 func saveImageShouldNotFail(action string, dataStore *LocalDataStore, img ImageMetaData, t *testing.T) {
 	err := dataStore.SaveImageMetadata(img)
 	if err != nil {
@@ -449,6 +563,7 @@ func getExampleImageMetadata(filePath string) ImageMetaData {
 		FullImagePath:    filePath,
 		PiwigoId:         1,
 		Md5Sum:           "aabbccddeeff",
+		Checksum:         "sha1:aabbccddeeff00112233",
 		LastChange:       time.Now().UTC(),
 		Filename:         "bar.jpg",
 		CategoryPath:     "blah/foo",
@@ -488,4 +603,13 @@ func ensureLoadedCategoryIsExpectedCategory(loaded CategoryData, expected Catego
 	if loaded.PiwigoParentId != expected.PiwigoParentId {
 		t.Errorf("category update failed. Got: %d - want: %d", loaded.PiwigoParentId, expected.PiwigoParentId)
 	}
+	if loaded.CoverPiwigoId != expected.CoverPiwigoId {
+		t.Errorf("category update failed. Got: %d - want: %d", loaded.CoverPiwigoId, expected.CoverPiwigoId)
+	}
+	if loaded.ContactSheetPiwigoId != expected.ContactSheetPiwigoId {
+		t.Errorf("category update failed. Got: %d - want: %d", loaded.ContactSheetPiwigoId, expected.ContactSheetPiwigoId)
+	}
+	if loaded.LocalPath != expected.LocalPath {
+		t.Errorf("category update failed. Got: %s - want: %s", loaded.LocalPath, expected.LocalPath)
+	}
 }
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// The metadata of an uploaded image that is set in the metadata phase after all images got uploaded. It is kept
+// until the phase completed, so an interrupted phase is repeated by the next run.
+type DeferredMetadata struct {
+	PiwigoId         int
+	CategoryPiwigoId int
+	// the date available to set, zero keeps the date of the upload
+	DateAvailable time.Time
+	// the dimensions in pixels and the file size in kilobytes of the uploaded file, zero if they are not set
+	Width    int
+	Height   int
+	Filesize int
+}
+
+func (m *DeferredMetadata) String() string {
+	return fmt.Sprintf("DeferredMetadata{PiwigoId:%d, CategoryPiwigoId:%d, DateAvailable:%s, Width:%d, Height:%d, Filesize:%d}", m.PiwigoId, m.CategoryPiwigoId, m.DateAvailable.String(), m.Width, m.Height, m.Filesize)
+}
+
+type DeferredMetadataProvider interface {
+	DeferredMetadata() ([]DeferredMetadata, error)
+	SaveDeferredMetadata(metadata DeferredMetadata) error
+	DeleteDeferredMetadata() error
+}
+
+// Returns the metadata of all images whose metadata phase did not complete, ordered by piwigo id.
+func (d *LocalDataStore) DeferredMetadata() ([]DeferredMetadata, error) {
+	logrus.Trace("Query all deferred metadata")
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT piwigoId, categoryPiwigoId, dateAvailable, width, height, filesize FROM deferredMetadata ORDER BY piwigoId, categoryPiwigoId")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make([]DeferredMetadata, 0)
+	for rows.Next() {
+		m := DeferredMetadata{}
+		err = rows.Scan(&m.PiwigoId, &m.CategoryPiwigoId, &m.DateAvailable, &m.Width, &m.Height, &m.Filesize)
+		if err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, m)
+	}
+	return metadata, rows.Err()
+}
+
+// Saves the metadata and replaces the metadata saved earlier for the image in the same category.
+func (d *LocalDataStore) SaveDeferredMetadata(metadata DeferredMetadata) error {
+	logrus.Tracef("Saving deferred metadata %s", metadata.String())
+	return d.executeStatement(fmt.Sprintf("saving the deferred metadata of image %d", metadata.PiwigoId),
+		"INSERT OR REPLACE INTO deferredMetadata (piwigoId, categoryPiwigoId, dateAvailable, width, height, filesize) VALUES (?,?,?,?,?,?)",
+		metadata.PiwigoId, metadata.CategoryPiwigoId, metadata.DateAvailable, metadata.Width, metadata.Height, metadata.Filesize)
+}
+
+// Marks the metadata phase as completed by removing the metadata of all images.
+func (d *LocalDataStore) DeleteDeferredMetadata() error {
+	logrus.Trace("Deleting all deferred metadata")
+	return d.executeStatement("deleting the deferred metadata", "DELETE FROM deferredMetadata")
+}
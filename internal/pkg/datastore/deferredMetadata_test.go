@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_deferred_metadata_is_saved_replaced_and_deleted(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	dateAvailable := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	saved := []DeferredMetadata{
+		{PiwigoId: 7, CategoryPiwigoId: 2},
+		{PiwigoId: 5, CategoryPiwigoId: 2, Width: 40, Height: 30},
+		{PiwigoId: 5, CategoryPiwigoId: 2, DateAvailable: dateAvailable, Width: 40, Height: 30, Filesize: 12},
+	}
+	for _, metadata := range saved {
+		err := dataStore.SaveDeferredMetadata(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metadata, err := dataStore.DeferredMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 2 {
+		t.Fatalf("expected the metadata of two images but got %v", metadata)
+	}
+	if !metadata[0].DateAvailable.Equal(dateAvailable) || metadata[0].Filesize != 12 || metadata[1].PiwigoId != 7 || !metadata[1].DateAvailable.IsZero() {
+		t.Errorf("expected the replaced metadata ordered by piwigo id but got %v", metadata)
+	}
+
+	err = dataStore.DeleteDeferredMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err = dataStore.DeferredMetadata()
+	if err != nil || len(metadata) != 0 {
+		t.Errorf("expected the metadata to be deleted but got %v, %v", metadata, err)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"time"
+)
+
+// The database is damaged, e.g. by a power loss while it got written. Its content can not be trusted.
+var ErrorDatabaseCorrupt = errors.New("the database is corrupt")
+
+// A damaged database found by the integrity check or reported by sqlite. It matches ErrorDatabaseCorrupt with
+// errors.Is and keeps the problem to show what is damaged.
+type corruptDatabaseError struct {
+	problem string
+}
+
+func (e *corruptDatabaseError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrorDatabaseCorrupt, e.problem)
+}
+
+func (e *corruptDatabaseError) Is(target error) bool {
+	return target == ErrorDatabaseCorrupt
+}
+
+// Runs the integrity check of sqlite on the whole database. A file that is not a database at all is reported as
+// corrupt as well.
+func checkIntegrity(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return corruptionError(err)
+	}
+	defer rows.Close()
+
+	problems := make([]string, 0)
+	for rows.Next() {
+		var result string
+		err = rows.Scan(&result)
+		if err != nil {
+			return corruptionError(err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return corruptionError(err)
+	}
+
+	if len(problems) > 0 {
+		return &corruptDatabaseError{problem: strings.Join(problems, "; ")}
+	}
+	return nil
+}
+
+// Only a damaged file is reported as corrupt. Other failures like a locked database or missing permissions are kept
+// as they are, so the file is not replaced for a problem a new file would not solve.
+func corruptionError(err error) error {
+	var sqliteError sqlite3.Error
+	if errors.As(err, &sqliteError) && (sqliteError.Code == sqlite3.ErrCorrupt || sqliteError.Code == sqlite3.ErrNotADB) {
+		return &corruptDatabaseError{problem: err.Error()}
+	}
+	return err
+}
+
+// Moves the database file and its journals aside, so the next access starts with an empty database that gets
+// filled from the server and the local files again. The file is kept as backup named with the reason, e.g.
+// localstate.db.corrupt-20200301-120000, to look into the problem.
+func (d *LocalDataStore) backupDatabase(reason string) error {
+	path := d.databaseFile()
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.%s-%s", path, reason, time.Now().Format("20060102-150405"))
+	err := os.Rename(path, backupPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not move the database %s to %s: %s", path, backupPath, err))
+	}
+	for _, journal := range []string{"-journal", "-wal", "-shm"} {
+		if _, err := os.Stat(path + journal); err == nil {
+			_ = os.Rename(path+journal, backupPath+journal)
+		}
+	}
+
+	logrus.Warnf("Moved the database %s to %s, the metadata is rebuilt from the server and the local files", path, backupPath)
+	return nil
+}
+
+// The file of the database without the uri prefix and the parameters of the connection string. In-memory databases
+// have no file.
+func (d *LocalDataStore) databaseFile() string {
+	path := strings.TrimPrefix(d.connectionString, "file:")
+	if index := strings.Index(path, "?"); index >= 0 {
+		if strings.Contains(path[index:], "mode=memory") {
+			return ""
+		}
+		path = path[:index]
+	}
+	if path == ":memory:" {
+		return ""
+	}
+	return path
+}
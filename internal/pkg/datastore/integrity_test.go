@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Initialize_rebuilds_a_file_that_is_no_database(t *testing.T) {
+	databasePath := tempDatabasePath(t)
+	garbage := bytes.Repeat([]byte("not a sqlite database "), 1000)
+	err := ioutil.WriteFile(databasePath, garbage, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataStore := NewLocalDataStore()
+	err = dataStore.Initialize(databasePath)
+	if err != nil {
+		t.Fatalf("expected the corrupt database to be rebuilt but got %s", err)
+	}
+
+	assertDatabaseBackup(t, databasePath, "corrupt", garbage)
+	assertDatabaseIsUsable(t, dataStore)
+}
+
+func Test_Initialize_rebuilds_a_database_with_damaged_pages(t *testing.T) {
+	databasePath := tempDatabasePath(t)
+	dataStore := NewLocalDataStore()
+	err := dataStore.Initialize(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		saveImageShouldNotFail("fill", dataStore, getExampleImageMetadata(filepath.Join("blah", strings.Repeat("x", i), "bar.jpg")), t)
+	}
+
+	// overwrite everything behind the first page like a write that got interrupted by a power loss
+	content, err := ioutil.ReadFile(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 4096; i < len(content); i++ {
+		content[i] = 0xA5
+	}
+	err = ioutil.WriteFile(databasePath, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewLocalDataStore().Initialize(databasePath)
+	if err != nil {
+		t.Fatalf("expected the corrupt database to be rebuilt but got %s", err)
+	}
+
+	assertDatabaseBackup(t, databasePath, "corrupt", content)
+	images, err := dataStore.ImageMetadataAll()
+	if err != nil || len(images) != 0 {
+		t.Errorf("expected an empty database but got %d images - %v", len(images), err)
+	}
+	assertDatabaseIsUsable(t, dataStore)
+}
+
+func Test_Rebuild_keeps_a_backup_of_the_healthy_database(t *testing.T) {
+	databasePath := tempDatabasePath(t)
+	dataStore := NewLocalDataStore()
+	err := dataStore.Initialize(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveImageShouldNotFail("before rebuild", dataStore, getExampleImageMetadata("blah/foo/bar.jpg"), t)
+
+	err = dataStore.Rebuild(databasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDatabaseBackup(t, databasePath, "rebuilt", nil)
+	_, err = dataStore.ImageMetadata("blah/foo/bar.jpg")
+	if err != ErrorRecordNotFound {
+		t.Errorf("expected the rebuilt database to be empty but got %v", err)
+	}
+}
+
+func Test_databaseFile_strips_the_connection_parameters(t *testing.T) {
+	tests := map[string]string{
+		"./localstate.db":                     "./localstate.db",
+		"file:localstate.db?cache=shared":     "localstate.db",
+		":memory:":                            "",
+		"file:memdb?mode=memory&cache=shared": "",
+	}
+	for connectionString, want := range tests {
+		dataStore := &LocalDataStore{connectionString: connectionString}
+		if got := dataStore.databaseFile(); got != want {
+			t.Errorf("databaseFile() of %s = %s, want %s", connectionString, got, want)
+		}
+	}
+}
+
+func tempDatabasePath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "datastoreIntegrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "localstate.db")
+}
+
+// Checks that the replaced database is kept next to the new one. The content is only compared if given.
+func assertDatabaseBackup(t *testing.T, databasePath string, reason string, content []byte) {
+	backups, err := filepath.Glob(databasePath + "." + reason + "-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected a single backup of the database but got %v", backups)
+	}
+	if content == nil {
+		return
+	}
+	backup, err := ioutil.ReadFile(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backup, content) {
+		t.Error("the backup differs from the replaced database")
+	}
+}
+
+func assertDatabaseIsUsable(t *testing.T, dataStore *LocalDataStore) {
+	img := getExampleImageMetadata("blah/foo/bar.jpg")
+	saveImageShouldNotFail("after rebuild", dataStore, img, t)
+	loadMetadataShouldNotFail("after rebuild", dataStore, img.FullImagePath, t)
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// A raw file that got attached as format to the uploaded image of its JPEG. It is remembered to attach it again only
+// if the raw file or the image changed.
+type RawFormat struct {
+	RawPath    string
+	PiwigoId   int
+	LastChange time.Time
+}
+
+func (f *RawFormat) String() string {
+	return fmt.Sprintf("RawFormat{RawPath:%s, PiwigoId:%d, LastChange:%s}", f.RawPath, f.PiwigoId, f.LastChange.String())
+}
+
+type RawFormatProvider interface {
+	RawFormat(rawPath string) (RawFormat, error)
+	SaveRawFormat(format RawFormat) error
+}
+
+// Returns the format attached for the raw file or ErrorRecordNotFound if it was not attached yet.
+func (d *LocalDataStore) RawFormat(rawPath string) (RawFormat, error) {
+	logrus.Tracef("Query raw format of %s", rawPath)
+	format := RawFormat{}
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return format, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow("SELECT rawPath, piwigoId, lastChange FROM rawFormats WHERE rawPath = ?", rawPath).Scan(&format.RawPath, &format.PiwigoId, &format.LastChange)
+	if err == sql.ErrNoRows {
+		return format, ErrorRecordNotFound
+	}
+	return format, err
+}
+
+// Saves the attached format and replaces the one saved earlier for the raw file.
+func (d *LocalDataStore) SaveRawFormat(format RawFormat) error {
+	logrus.Tracef("Saving raw format %s", format.String())
+	return d.executeStatement("saving the raw format "+format.RawPath,
+		"INSERT OR REPLACE INTO rawFormats (rawPath, piwigoId, lastChange) VALUES (?,?,?)",
+		format.RawPath, format.PiwigoId, format.LastChange)
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_raw_format_is_saved_and_replaced(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	_, err := dataStore.RawFormat("/images/IMG_0001.CR2")
+	if err != ErrorRecordNotFound {
+		t.Fatalf("expected ErrorRecordNotFound but got %v", err)
+	}
+
+	lastChange := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	for _, piwigoId := range []int{5, 7} {
+		err = dataStore.SaveRawFormat(RawFormat{RawPath: "/images/IMG_0001.CR2", PiwigoId: piwigoId, LastChange: lastChange})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	format, err := dataStore.RawFormat("/images/IMG_0001.CR2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.PiwigoId != 7 || !format.LastChange.Equal(lastChange) {
+		t.Errorf("expected the replaced format but got %s", format.String())
+	}
+}
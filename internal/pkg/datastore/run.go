@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// A synchronization run. Runs without end time were interrupted, e.g. by a crash, and are resumed by the next run.
+type RunData struct {
+	RunId       int
+	StartTime   time.Time
+	EndTime     time.Time
+	Interrupted bool
+}
+
+func (r *RunData) String() string {
+	return fmt.Sprintf("RunData{RunId:%d, StartTime:%s, EndTime:%s, Interrupted:%t}", r.RunId, r.StartTime.String(), r.EndTime.String(), r.Interrupted)
+}
+
+type RunProvider interface {
+	UnfinishedRun() (RunData, error)
+	StartRun(startTime time.Time) (RunData, error)
+	FinishRun(run RunData, endTime time.Time) error
+}
+
+// Returns the last run that did not finish or ErrorRecordNotFound if all runs finished.
+func (d *LocalDataStore) UnfinishedRun() (RunData, error) {
+	logrus.Trace("Query the last unfinished run")
+	run := RunData{}
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return run, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT runId, startTime FROM run WHERE endTime IS NULL ORDER BY runId DESC LIMIT 1")
+	if err != nil {
+		return run, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return run, ErrorRecordNotFound
+	}
+	err = rows.Scan(&run.RunId, &run.StartTime)
+	if err != nil {
+		return run, err
+	}
+	return run, rows.Err()
+}
+
+// Starts a new run. All runs that did not finish are marked as interrupted.
+func (d *LocalDataStore) StartRun(startTime time.Time) (RunData, error) {
+	logrus.Tracef("Starting run at %s", startTime)
+	run := RunData{StartTime: startTime}
+
+	db, err := d.openDatabase()
+	if err != nil {
+		return run, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return run, err
+	}
+
+	run.RunId, err = d.insertRunData(tx, startTime)
+	if err != nil {
+		logrus.Errorf("Rolling back transaction of the start of a run")
+		errTx := tx.Rollback()
+		if errTx != nil {
+			logrus.Errorf("Rollback of transaction of the start of a run failed!")
+		}
+		return run, err
+	}
+
+	logrus.Tracef("Committing start of run %d", run.RunId)
+	return run, tx.Commit()
+}
+
+func (d *LocalDataStore) insertRunData(tx *sql.Tx, startTime time.Time) (int, error) {
+	_, err := tx.Exec("UPDATE run SET endTime = ?, interrupted = 1 WHERE endTime IS NULL", startTime)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO run (startTime) VALUES (?)", startTime)
+	if err != nil {
+		return 0, err
+	}
+	runId, err := result.LastInsertId()
+	return int(runId), err
+}
+
+func (d *LocalDataStore) FinishRun(run RunData, endTime time.Time) error {
+	logrus.Tracef("Finishing run %d at %s", run.RunId, endTime)
+	db, err := d.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE run SET endTime = ? WHERE runId = ?", endTime, run.RunId)
+	if err != nil {
+		logrus.Errorf("Rolling back transaction of the end of run %d", run.RunId)
+		errTx := tx.Rollback()
+		if errTx != nil {
+			logrus.Errorf("Rollback of transaction of the end of run %d failed!", run.RunId)
+		}
+		return err
+	}
+
+	logrus.Tracef("Committing end of run %d", run.RunId)
+	return tx.Commit()
+}
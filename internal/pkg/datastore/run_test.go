@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_unfinished_run_is_found_after_crash(t *testing.T) {
+	if !dbinitOk {
+		t.Skip("Skipping test as TestDataStoreInitialize failed!")
+	}
+	dataStore := setupDatabase(t)
+	defer cleanupDatabase(t)
+
+	_, err := dataStore.UnfinishedRun()
+	if err != ErrorRecordNotFound {
+		t.Fatalf("expected no unfinished run in a new database but got %v", err)
+	}
+
+	// the first run crashes while uploading an image
+	startTime := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	crashedRun, err := dataStore.StartRun(startTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := getExampleImageMetadata("blah/foo/bar.jpg")
+	img.UploadRunId = crashedRun.RunId
+	saveImageShouldNotFail("in progress", dataStore, img, t)
+	saveImageShouldNotFail("pending", dataStore, getExampleImageMetadata("blah/foo/other.jpg"), t)
+
+	unfinished, err := dataStore.UnfinishedRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unfinished.RunId != crashedRun.RunId || !unfinished.StartTime.Equal(startTime) {
+		t.Errorf("expected the crashed run %v but got %v", crashedRun, unfinished)
+	}
+
+	interrupted, err := dataStore.ImageMetadataInterrupted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interrupted) != 1 || interrupted[0].FullImagePath != img.FullImagePath || interrupted[0].UploadRunId != crashedRun.RunId {
+		t.Errorf("expected the interrupted upload of %s but got %v", img.FullImagePath, interrupted)
+	}
+
+	// the next run resumes and finishes
+	run, err := dataStore.StartRun(startTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.RunId == crashedRun.RunId {
+		t.Error("the new run got the id of the crashed run")
+	}
+	err = dataStore.FinishRun(run, startTime.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dataStore.UnfinishedRun()
+	if err != ErrorRecordNotFound {
+		t.Errorf("expected all runs to be finished but got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package hooks
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// An executable that is called for every image, e.g. to check an image before the upload or to record the upload
+// somewhere else. A nil hook does nothing.
+type Hook struct {
+	name        string
+	command     string
+	timeout     time.Duration
+	baseContext gocontext.Context
+}
+
+// Creates a hook calling the given executable. Returns nil if no command is given. The hook is cancelled with the
+// given context and if it runs longer than the timeout. A timeout of zero disables it.
+func NewHook(ctx gocontext.Context, name string, command string, timeout time.Duration) *Hook {
+	if command == "" {
+		return nil
+	}
+
+	return &Hook{
+		name:        name,
+		command:     command,
+		timeout:     timeout,
+		baseContext: ctx,
+	}
+}
+
+// Runs the hook with the given arguments. The environment of the application is passed on, extended by the given
+// variables in the form "KEY=value". A non zero exit code is returned as error including the output of the hook.
+func (h *Hook) Run(args []string, environment []string) error {
+	if h == nil {
+		return nil
+	}
+
+	ctx, cancel := h.newContext()
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.command, args...)
+	cmd.Env = append(os.Environ(), environment...)
+
+	logrus.Debugf("Running %s hook %s %s", h.name, h.command, strings.Join(args, " "))
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == gocontext.DeadlineExceeded {
+		return errors.New(fmt.Sprintf("%s hook did not finish within %s", h.name, h.timeout))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s hook failed: %s %s", h.name, err, strings.TrimSpace(string(output))))
+	}
+
+	logrus.Tracef("Output of %s hook: %s", h.name, output)
+	return nil
+}
+
+func (h *Hook) newContext() (gocontext.Context, gocontext.CancelFunc) {
+	if h.timeout <= 0 {
+		return gocontext.WithCancel(h.baseContext)
+	}
+	return gocontext.WithTimeout(h.baseContext, h.timeout)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package hooks
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createHookScript(t *testing.T, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts are shell scripts")
+	}
+
+	dir, err := ioutil.TempDir("", "hooktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "hook.sh")
+	err = ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_NewHook_returns_nil_without_command(t *testing.T) {
+	hook := NewHook(gocontext.Background(), "pre upload", "", time.Minute)
+	if hook != nil {
+		t.Fatal("expected no hook without command")
+	}
+
+	err := hook.Run([]string{"a.jpg"}, nil)
+	if err != nil {
+		t.Errorf("a nil hook should do nothing but got %s", err)
+	}
+}
+
+func Test_Run_passes_arguments_and_environment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooktest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputFile := filepath.Join(dir, "output.txt")
+
+	script := createHookScript(t, `echo "$1 $2 $PIWIGO_IMAGE_ID" > "`+outputFile+`"`)
+	hook := NewHook(gocontext.Background(), "post upload", script, time.Minute)
+
+	err = hook.Run([]string{"a.jpg", "5"}, []string{"PIWIGO_IMAGE_ID=5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(output)) != "a.jpg 5 5" {
+		t.Errorf("unexpected hook output %s", output)
+	}
+}
+
+func Test_Run_returns_error_with_output_on_non_zero_exit(t *testing.T) {
+	script := createHookScript(t, "echo contains gps data\nexit 3")
+	hook := NewHook(gocontext.Background(), "pre upload", script, time.Minute)
+
+	err := hook.Run([]string{"a.jpg"}, nil)
+	if err == nil {
+		t.Fatal("expected an error for a non zero exit code")
+	}
+	if !strings.Contains(err.Error(), "contains gps data") {
+		t.Errorf("expected the output of the hook in the error but got %s", err)
+	}
+}
+
+func Test_Run_stops_hook_after_timeout(t *testing.T) {
+	script := createHookScript(t, "exec sleep 5")
+	hook := NewHook(gocontext.Background(), "pre upload", script, 100*time.Millisecond)
+
+	start := time.Now()
+	err := hook.Run(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "did not finish") {
+		t.Errorf("expected a timeout error but got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Error("the hook was not stopped after the timeout")
+	}
+}
+
+func Test_Run_stops_hook_on_cancelled_context(t *testing.T) {
+	script := createHookScript(t, "exec sleep 5")
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	hook := NewHook(ctx, "pre upload", script, 0)
+
+	err := hook.Run(nil, nil)
+	if err == nil {
+		t.Error("expected an error as the context is cancelled")
+	}
+}
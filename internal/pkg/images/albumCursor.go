@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Removes the files of each album that are completely uploaded according to the cursor of the album, so they are
+// not checked for changes again. A cursor only applies as long as the files of the album are the same, it is deleted
+// as soon as files got added or removed. Directories are always kept.
+func SkipCompletedAlbumFiles(cursorProvider datastore.AlbumCursorProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode) (map[string]*localFileStructure.FilesystemNode, error) {
+	cursors, err := cursorProvider.AlbumCursors()
+	if err != nil {
+		return nil, err
+	}
+	if len(cursors) == 0 {
+		return fileSystemNodes, nil
+	}
+
+	skipped := make(map[string]bool)
+	for categoryKey, files := range albumFiles(fileSystemNodes) {
+		cursor, found := cursors[categoryKey]
+		if !found {
+			continue
+		}
+		if cursor.Fingerprint != albumFingerprint(files) || cursor.Position > len(files) {
+			logrus.Infof("The files of album %s changed since the last run, checking all of them again", categoryKey)
+			err = cursorProvider.DeleteAlbumCursor(categoryKey)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		logrus.Infof("Resuming album %s after %d of %d uploaded images", categoryKey, cursor.Position, len(files))
+		for _, file := range files[:cursor.Position] {
+			skipped[file.Key] = true
+		}
+	}
+
+	remaining := make(map[string]*localFileStructure.FilesystemNode, len(fileSystemNodes)-len(skipped))
+	for key, node := range fileSystemNodes {
+		if !skipped[key] {
+			remaining[key] = node
+		}
+	}
+	return remaining, nil
+}
+
+// Tracks how many images of each album are completely uploaded, counted from the first image ordered by path. The
+// cursor of an album only advances over images without gap, so a failed image keeps the cursor in front of it.
+// The cursor of a completed album is deleted to check all of its files for changes on the next run.
+type AlbumCursors struct {
+	mutex    sync.Mutex
+	provider datastore.AlbumCursorProvider
+	images   map[string]*albumProgress
+}
+
+type albumProgress struct {
+	cursor    datastore.AlbumCursor
+	paths     []string
+	completed map[string]bool
+	// the position stored in the metadata store, -1 if the album has no cursor
+	stored int
+}
+
+// Creates the cursors of all albums of the scanned files. Images that do not have to be uploaded count as completed.
+func NewAlbumCursors(cursorProvider datastore.AlbumCursorProvider, metadataProvider datastore.ImageMetadataProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode) (*AlbumCursors, error) {
+	storedCursors, err := cursorProvider.AlbumCursors()
+	if err != nil {
+		return nil, err
+	}
+	imagesToUpload, err := metadataProvider.ImageMetadataToUpload()
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string]bool, len(imagesToUpload))
+	for _, img := range imagesToUpload {
+		pending[img.FullImagePath] = true
+	}
+
+	cursors := &AlbumCursors{provider: cursorProvider, images: make(map[string]*albumProgress)}
+	for categoryKey, files := range albumFiles(fileSystemNodes) {
+		progress := &albumProgress{
+			cursor:    datastore.AlbumCursor{CategoryKey: categoryKey, Fingerprint: albumFingerprint(files)},
+			paths:     make([]string, 0, len(files)),
+			completed: make(map[string]bool, len(files)),
+			stored:    -1,
+		}
+		if stored, found := storedCursors[categoryKey]; found {
+			progress.stored = stored.Position
+		}
+		for _, file := range files {
+			progress.paths = append(progress.paths, file.Path)
+			progress.completed[file.Path] = !pending[file.Path]
+			cursors.images[file.Path] = progress
+		}
+		cursors.advance(progress)
+	}
+	return cursors, nil
+}
+
+// Marks the image as uploaded and advances the cursor of its album.
+func (cursors *AlbumCursors) complete(imagePath string) {
+	if cursors == nil {
+		return
+	}
+
+	cursors.mutex.Lock()
+	defer cursors.mutex.Unlock()
+	progress, found := cursors.images[imagePath]
+	if !found {
+		return
+	}
+	progress.completed[imagePath] = true
+	cursors.advance(progress)
+}
+
+func (cursors *AlbumCursors) advance(progress *albumProgress) {
+	for progress.cursor.Position < len(progress.paths) && progress.completed[progress.paths[progress.cursor.Position]] {
+		progress.cursor.Position++
+	}
+
+	var err error
+	if progress.cursor.Position == len(progress.paths) {
+		if progress.stored < 0 {
+			return
+		}
+		logrus.Debugf("All images of album %s are uploaded, deleting its cursor", progress.cursor.CategoryKey)
+		err = cursors.provider.DeleteAlbumCursor(progress.cursor.CategoryKey)
+		progress.stored = -1
+	} else if progress.cursor.Position != progress.stored && progress.cursor.Position > 0 {
+		err = cursors.provider.SaveAlbumCursor(progress.cursor)
+		progress.stored = progress.cursor.Position
+	}
+	if err != nil {
+		logrus.Warnf("Could not save the cursor of album %s - %s", progress.cursor.CategoryKey, err)
+	}
+}
+
+// Groups the files by the category key of their album and orders them by path.
+func albumFiles(fileSystemNodes map[string]*localFileStructure.FilesystemNode) map[string][]*localFileStructure.FilesystemNode {
+	albums := make(map[string][]*localFileStructure.FilesystemNode)
+	for _, node := range fileSystemNodes {
+		if node.IsDir {
+			continue
+		}
+		categoryKey := filepath.Dir(node.Key)
+		albums[categoryKey] = append(albums[categoryKey], node)
+	}
+	for _, files := range albums {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+	}
+	return albums
+}
+
+// Identifies the files of an album by their names. Adding, removing or renaming a file changes the fingerprint.
+func albumFingerprint(files []*localFileStructure.FilesystemNode) string {
+	hash := sha1.New()
+	for _, file := range files {
+		_, _ = hash.Write([]byte(file.Name))
+		_, _ = hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func createAlbumNodes(files ...string) map[string]*localFileStructure.FilesystemNode {
+	nodes := map[string]*localFileStructure.FilesystemNode{
+		"album": {Key: "album", Path: "/photos/album", Name: "album", IsDir: true},
+	}
+	for _, file := range files {
+		key := "album/" + file
+		nodes[key] = &localFileStructure.FilesystemNode{Key: key, Path: "/photos/" + key, Name: file}
+	}
+	return nodes
+}
+
+func Test_SkipCompletedAlbumFiles_skips_the_uploaded_images_of_the_album(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := createAlbumNodes("c.jpg", "a.jpg", "b.jpg")
+	nodes["other/d.jpg"] = &localFileStructure.FilesystemNode{Key: "other/d.jpg", Path: "/photos/other/d.jpg", Name: "d.jpg"}
+	cursor := datastore.AlbumCursor{CategoryKey: "album", Position: 2, Fingerprint: albumFingerprint(albumFiles(nodes)["album"])}
+
+	cursorProvider := NewMockAlbumCursorProvider(mockCtrl)
+	cursorProvider.EXPECT().AlbumCursors().Return(map[string]datastore.AlbumCursor{"album": cursor}, nil)
+
+	remaining, err := SkipCompletedAlbumFiles(cursorProvider, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"album", "album/c.jpg", "other/d.jpg"} {
+		if _, found := remaining[key]; !found {
+			t.Errorf("expected %s to be checked", key)
+		}
+	}
+	if len(remaining) != 3 {
+		t.Errorf("expected a.jpg and b.jpg to be skipped but got %v", remaining)
+	}
+}
+
+func Test_SkipCompletedAlbumFiles_resets_the_cursor_if_files_got_added(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cursor := datastore.AlbumCursor{CategoryKey: "album", Position: 2, Fingerprint: albumFingerprint(albumFiles(createAlbumNodes("a.jpg", "b.jpg", "c.jpg"))["album"])}
+	nodes := createAlbumNodes("a.jpg", "b.jpg", "c.jpg", "new.jpg")
+
+	cursorProvider := NewMockAlbumCursorProvider(mockCtrl)
+	cursorProvider.EXPECT().AlbumCursors().Return(map[string]datastore.AlbumCursor{"album": cursor}, nil)
+	cursorProvider.EXPECT().DeleteAlbumCursor("album").Times(1)
+
+	remaining, err := SkipCompletedAlbumFiles(cursorProvider, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != len(nodes) {
+		t.Errorf("expected all files to be checked but got %v", remaining)
+	}
+}
+
+func Test_AlbumCursors_advance_over_completed_images_without_gap(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := createAlbumNodes("a.jpg", "b.jpg", "c.jpg")
+	fingerprint := albumFingerprint(albumFiles(nodes)["album"])
+	pending := []datastore.ImageMetaData{{FullImagePath: "/photos/album/b.jpg"}, {FullImagePath: "/photos/album/c.jpg"}}
+
+	cursorProvider := NewMockAlbumCursorProvider(mockCtrl)
+	cursorProvider.EXPECT().AlbumCursors().Return(map[string]datastore.AlbumCursor{}, nil)
+	metadataProvider := NewMockImageMetadataProvider(mockCtrl)
+	metadataProvider.EXPECT().ImageMetadataToUpload().Return(pending, nil)
+
+	// a.jpg got uploaded by an earlier run
+	cursorProvider.EXPECT().SaveAlbumCursor(datastore.AlbumCursor{CategoryKey: "album", Position: 1, Fingerprint: fingerprint}).Times(1)
+	cursors, err := NewAlbumCursors(cursorProvider, metadataProvider, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c.jpg completes before b.jpg, so the cursor stays in front of b.jpg
+	cursors.complete("/photos/album/c.jpg")
+
+	// the completed album gets checked completely on the next run
+	cursorProvider.EXPECT().DeleteAlbumCursor("album").Times(1)
+	cursors.complete("/photos/album/b.jpg")
+}
+
+func Test_AlbumCursors_does_not_save_completed_albums(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cursorProvider := NewMockAlbumCursorProvider(mockCtrl)
+	cursorProvider.EXPECT().AlbumCursors().Return(map[string]datastore.AlbumCursor{}, nil)
+	metadataProvider := NewMockImageMetadataProvider(mockCtrl)
+	metadataProvider.EXPECT().ImageMetadataToUpload().Return(nil, nil)
+
+	cursors, err := NewAlbumCursors(cursorProvider, metadataProvider, createAlbumNodes("a.jpg", "b.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursors.complete("/photos/album/a.jpg")
+}
+
+func Test_uploadImages_advances_the_album_cursor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	nodes := createAlbumNodes("file.jpg", "later.jpg")
+	img := createTestImageMetaData(0)
+	img.FullImagePath = "/photos/album/file.jpg"
+
+	cursorProvider := NewMockAlbumCursorProvider(mockCtrl)
+	cursorProvider.EXPECT().AlbumCursors().Return(map[string]datastore.AlbumCursor{}, nil)
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	// later.jpg is still pending, it is not uploaded in this run, e.g. as it is quarantined
+	later := datastore.ImageMetaData{FullImagePath: "/photos/album/later.jpg"}
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img, later}, nil)
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+	cursors, err := NewAlbumCursors(cursorProvider, dbmock, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "1234", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	cursorProvider.EXPECT().SaveAlbumCursor(datastore.AlbumCursor{CategoryKey: "album", Position: 1, Fingerprint: albumFingerprint(albumFiles(nodes)["album"])}).Times(1)
+
+	err = UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, AlbumCursors: cursors})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
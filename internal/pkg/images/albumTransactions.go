@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+)
+
+const rolledBackReason = "rolled back as not all images of the album could be uploaded"
+
+// Makes the upload of every album all or nothing. An album is committed once all of its images queued in the run
+// are uploaded. Otherwise the images that got created in the album during the run are deleted on the server and
+// uploaded again by the next run. Images that already existed on the server keep their new content, as their
+// previous one is gone. The cursors of the albums only advance for committed albums.
+type albumTransactions struct {
+	mutex  sync.Mutex
+	albums map[int]*albumTransaction
+}
+
+type albumTransaction struct {
+	queued int
+	// the images that completed in the run, the ones created in the run separately
+	completed []datastore.ImageMetaData
+	created   []datastore.ImageMetaData
+}
+
+func newAlbumTransactions(images []datastore.ImageMetaData) *albumTransactions {
+	transactions := &albumTransactions{albums: make(map[int]*albumTransaction)}
+	for _, img := range images {
+		transactions.album(img.CategoryPiwigoId).queued++
+	}
+	return transactions
+}
+
+func (transactions *albumTransactions) album(categoryId int) *albumTransaction {
+	album, found := transactions.albums[categoryId]
+	if !found {
+		album = &albumTransaction{}
+		transactions.albums[categoryId] = album
+	}
+	return album
+}
+
+// Records the image that no longer has to be uploaded in the run. Created marks an image that did not exist on the
+// server before.
+func (transactions *albumTransactions) complete(img datastore.ImageMetaData, created bool) {
+	transactions.mutex.Lock()
+	defer transactions.mutex.Unlock()
+	album := transactions.album(img.CategoryPiwigoId)
+	album.completed = append(album.completed, img)
+	if created {
+		album.created = append(album.created, img)
+	}
+}
+
+// Commits the albums whose images all completed and rolls back the other ones. Returns the ids of the deleted images.
+func (transactions *albumTransactions) finish(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, options UploadOptions) (map[int]bool, error) {
+	categoryIds := make([]int, 0, len(transactions.albums))
+	for categoryId := range transactions.albums {
+		categoryIds = append(categoryIds, categoryId)
+	}
+	sort.Ints(categoryIds)
+
+	// an image uploaded once for the same content in several albums is kept for the albums that got committed
+	committed := make(map[int]bool)
+	for _, album := range transactions.albums {
+		if album.isComplete() {
+			for _, img := range album.completed {
+				committed[img.PiwigoId] = true
+			}
+		}
+	}
+
+	deleted := make(map[int]bool)
+	for _, categoryId := range categoryIds {
+		album := transactions.albums[categoryId]
+		if album.isComplete() {
+			for _, img := range album.completed {
+				completeAlbumCursor(img, options)
+			}
+			continue
+		}
+		album.keepCommitted(committed)
+
+		logrus.Warnf("Only %d of %d images of album %d got uploaded, rolling back the %d images created in the album", len(album.completed), album.queued, categoryId, len(album.created))
+		err := rollbackAlbum(piwigoCtx, metadataProvider, album, options)
+		if err != nil {
+			return deleted, errors.New(fmt.Sprintf("could not roll back album %d - %s", categoryId, err))
+		}
+		for _, img := range album.created {
+			deleted[img.PiwigoId] = true
+			options.Uploaded.remove(img.CategoryPiwigoId, img.PiwigoId)
+		}
+	}
+	return deleted, nil
+}
+
+func (album *albumTransaction) isComplete() bool {
+	return len(album.completed) == album.queued
+}
+
+// Removes the created images whose content is also used by a committed album from the images to roll back.
+func (album *albumTransaction) keepCommitted(committed map[int]bool) {
+	created := album.created[:0]
+	for _, img := range album.created {
+		if committed[img.PiwigoId] {
+			logrus.Warnf("%s: keeping image %d as it is used by another album that got uploaded completely", img.FullImagePath, img.PiwigoId)
+			continue
+		}
+		created = append(created, img)
+	}
+	album.created = created
+}
+
+func rollbackAlbum(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, album *albumTransaction, options UploadOptions) error {
+	if len(album.created) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(album.created))
+	for _, img := range album.created {
+		ids = append(ids, img.PiwigoId)
+	}
+	err := piwigoCtx.DeleteImages(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range album.created {
+		img.PiwigoId = 0
+		img.UploadRequired = true
+		err = metadataProvider.SaveImageMetadata(img)
+		if err != nil {
+			return err
+		}
+		options.Report.AddRolledBack(img.FullImagePath, rolledBackReason)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func Test_uploadImages_rolls_back_albums_with_failed_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newImage := func(path string, piwigoId int, categoryId int) datastore.ImageMetaData {
+		return datastore.ImageMetaData{FullImagePath: path, Md5Sum: path, PiwigoId: piwigoId, CategoryPiwigoId: categoryId, UploadRequired: true}
+	}
+	images := []datastore.ImageMetaData{
+		newImage("2019/a.jpg", 0, 2),
+		newImage("2019/b.jpg", 0, 2),
+		newImage("2019/c.jpg", 7, 2),
+		newImage("2020/d.jpg", 0, 3),
+	}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Return(images, nil)
+	rolledBack := newImage("2019/a.jpg", 0, 2)
+	dbmock.EXPECT().SaveImageMetadata(rolledBack).Times(1)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).AnyTimes()
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "2019/a.jpg", "2019/a.jpg", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 10}, nil)
+	piwigomock.EXPECT().UploadImage(0, "2019/b.jpg", "2019/b.jpg", 2, gomock.Any()).Return(piwigo.UploadResult{}, errors.New("server error"))
+	piwigomock.EXPECT().UploadImage(7, "2019/c.jpg", "2019/c.jpg", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 7}, nil)
+	piwigomock.EXPECT().UploadImage(0, "2020/d.jpg", "2020/d.jpg", 3, gomock.Any()).Return(piwigo.UploadResult{ImageId: 11}, nil)
+	// the image that existed before the run keeps its new content
+	piwigomock.EXPECT().DeleteImages([]int{10}).Times(1).Return(nil)
+
+	uploaded := NewUploadedImages()
+	uploadReport := report.NewReport()
+	options := UploadOptions{NumberOfWorkers: 1, AlbumAtomic: true, Uploaded: uploaded, Report: uploadReport}
+	err := UploadImages(piwigomock, dbmock, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded.contains(2, 10) || !uploaded.contains(2, 7) || !uploaded.contains(3, 11) {
+		t.Errorf("expected the rolled back image to be removed from the uploaded images")
+	}
+	if uploadReport.Uploaded() != 2 || len(uploadReport.Failed()) != 2 {
+		t.Errorf("expected 2 uploaded and 2 failed images but got %d and %v", uploadReport.Uploaded(), uploadReport.Failed())
+	}
+}
+
+func Test_uploadImages_commits_complete_albums(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, img.Md5Sum, 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().DeleteImages(gomock.Any()).Times(0)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, AlbumAtomic: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/transform"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// How local files are matched with the uploaded images. The md5sum is always sent to the server, the other modes only
+// decide if a file is considered as already uploaded.
+const (
+	// the content has to be the same
+	CompareByMd5 = "md5"
+	// the filename within the album and the file size have to be the same
+	CompareByPathSize = "pathSize"
+	// the filename within the album and the date the photo was taken have to be the same
+	CompareByPathExifDate = "pathExifDate"
+)
+
+// The exif data is at the beginning of a jpeg, so only the first part of the file is read to find the date.
+const exifDateReadLimit = 256 * 1024
+
+func checkCompareBy(compareBy string) error {
+	if compareBy != "" && compareBy != CompareByMd5 && compareBy != CompareByPathSize && compareBy != CompareByPathExifDate {
+		return errors.New(fmt.Sprintf("unknown compareBy %s. Use one of md5, pathSize or pathExifDate", compareBy))
+	}
+	return nil
+}
+
+func comparesByPath(compareBy string) bool {
+	return compareBy == CompareByPathSize || compareBy == CompareByPathExifDate
+}
+
+// Returns what identifies the content of the file in the given mode, e.g. "size:1024" or "exif:2019:01:02 03:04:05".
+// Returns an empty identity if the file is compared by md5sum or has no exif date.
+func fileIdentity(filePath string, compareBy string) (string, error) {
+	switch compareBy {
+	case CompareByPathSize:
+		fileInfo, err := localFileStructure.Stat(filePath)
+		if err != nil {
+			return "", err
+		}
+		return "size:" + strconv.FormatInt(fileInfo.Size(), 10), nil
+	case CompareByPathExifDate:
+		date, found, err := readExifDate(filePath)
+		if err != nil || !found {
+			return "", err
+		}
+		return "exif:" + date, nil
+	default:
+		return "", nil
+	}
+}
+
+func readExifDate(filePath string) (string, bool, error) {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(file, exifDateReadLimit))
+	if err != nil {
+		return "", false, err
+	}
+	date, found, err := transform.ExifDate(content)
+	if err == transform.ErrorUnsupportedFormat {
+		return "", false, nil
+	}
+	if err != nil && len(content) == exifDateReadLimit {
+		// the exif data is larger than expected, e.g. because of a big preview image
+		content, err = readWholeFile(filePath)
+		if err != nil {
+			return "", false, err
+		}
+		return transform.ExifDate(content)
+	}
+	return date, found, err
+}
+
+func readWholeFile(filePath string) ([]byte, error) {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// The stored identity only replaces the md5sum check of images that are already uploaded and up to date.
+func identityDidNotChange(metadata *datastore.ImageMetaData, identity string, compareBy string) bool {
+	return comparesByPath(compareBy) && metadata.PiwigoId > 0 && !metadata.UploadRequired && identity != "" && metadata.Identity == identity
+}
+
+// Checks if the image on the server has the same filename and the same size or exif date as the local file.
+// Piwigo stores the size in KB, so files that differ by less than a KB are considered as equal.
+func matchesServerImage(img datastore.ImageMetaData, info *piwigo.ImageInfo, compareBy string) bool {
+	if !strings.EqualFold(info.File, img.Filename) || img.Identity == "" {
+		return false
+	}
+
+	switch compareBy {
+	case CompareByPathSize:
+		size, err := strconv.ParseInt(strings.TrimPrefix(img.Identity, "size:"), 10, 64)
+		return err == nil && int(size/1024) == info.Filesize
+	case CompareByPathExifDate:
+		date := strings.TrimPrefix(img.Identity, "exif:")
+		return exifDateToPiwigoDate(date) == info.DateCreation
+	default:
+		return false
+	}
+}
+
+// Converts "2006:01:02 15:04:05" to the format piwigo uses for the creation date.
+func exifDateToPiwigoDate(date string) string {
+	if len(date) < 10 {
+		return date
+	}
+	return strings.Replace(date[:10], ":", "-", 2) + date[10:]
+}
+
+// Looks up the images that are not known by their md5sum in the album they belong to. The images of each album are
+// only fetched once. A matching image gets the piwigo id and the md5sum of the server, so it is not uploaded again.
+func updatePiwigoIdByPath(provider datastore.ImageMetadataProvider, piwigoCtx piwigo.ImageApi, compareBy string) error {
+	if !comparesByPath(compareBy) {
+		return nil
+	}
+	logrus.Infof("Checking pending files that are unknown by their md5sum using %s...", compareBy)
+
+	images, err := provider.ImageMetadataToUpload()
+	if err != nil {
+		return err
+	}
+
+	categoryImages := make(map[int][]*piwigo.ImageInfo)
+	for _, img := range images {
+		if img.PiwigoId > 0 || img.CategoryPiwigoId == 0 {
+			continue
+		}
+
+		serverImages, found := categoryImages[img.CategoryPiwigoId]
+		if !found {
+			serverImages = loadCategoryImages(piwigoCtx, img.CategoryPiwigoId)
+			categoryImages[img.CategoryPiwigoId] = serverImages
+		}
+
+		for _, info := range serverImages {
+			if !matchesServerImage(img, info, compareBy) {
+				continue
+			}
+
+			logrus.Infof("%s: matches image %d on the server by %s, it is not uploaded again.", img.FullImagePath, info.Id, compareBy)
+			img.PiwigoId = info.Id
+			img.UploadRequired = false
+			if info.Md5Sum != "" {
+				img.Md5Sum = info.Md5Sum
+			}
+			err = provider.SaveImageMetadata(img)
+			if err != nil {
+				logrus.Warnf("Could not save image data of image %s", img.FullImagePath)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func loadCategoryImages(piwigoCtx piwigo.ImageApi, categoryId int) []*piwigo.ImageInfo {
+	imageIds, err := piwigoCtx.GetCategoryImages(categoryId)
+	if err != nil {
+		logrus.Warnf("Could not get the images of category %d - %s", categoryId, err)
+		return nil
+	}
+
+	infos := make([]*piwigo.ImageInfo, 0, len(imageIds))
+	for _, imageId := range imageIds {
+		info, err := piwigoCtx.GetImageInfo(imageId)
+		if err != nil {
+			logrus.Warnf("Could not get image %d of category %d - %s", imageId, categoryId, err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
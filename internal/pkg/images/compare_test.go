@@ -0,0 +1,224 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_checkCompareBy(t *testing.T) {
+	for _, compareBy := range []string{"", CompareByMd5, CompareByPathSize, CompareByPathExifDate} {
+		if err := checkCompareBy(compareBy); err != nil {
+			t.Errorf("%q should be valid but got %s", compareBy, err)
+		}
+	}
+	if err := checkCompareBy("name"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func Test_fileIdentity(t *testing.T) {
+	dir := createCompareTestDir(t)
+	sizePath := filepath.Join(dir, "size.jpg")
+	writeCompareTestFile(t, sizePath, make([]byte, 2048))
+	exifPath := filepath.Join(dir, "exif.jpg")
+	writeCompareTestFile(t, exifPath, createJpegWithDateTime("2019:01:02 03:04:05"))
+
+	tests := []struct {
+		name      string
+		path      string
+		compareBy string
+		want      string
+	}{
+		{name: "md5", path: sizePath, compareBy: CompareByMd5, want: ""},
+		{name: "pathSize", path: sizePath, compareBy: CompareByPathSize, want: "size:2048"},
+		{name: "pathExifDate", path: exifPath, compareBy: CompareByPathExifDate, want: "exif:2019:01:02 03:04:05"},
+		{name: "pathExifDate without exif", path: sizePath, compareBy: CompareByPathExifDate, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := fileIdentity(test.path, test.compareBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity != test.want {
+				t.Errorf("expected identity %q but got %q", test.want, identity)
+			}
+		})
+	}
+}
+
+// A changed file of an uploaded image is only uploaded again if its identity changed in the selected mode.
+func Test_synchronize_local_image_metadata_decides_upload_by_compareBy(t *testing.T) {
+	tests := []struct {
+		name           string
+		compareBy      string
+		storedIdentity string
+		currentSize    int
+		uploadRequired bool
+	}{
+		{name: "md5 uploads changed content", compareBy: CompareByMd5, storedIdentity: "", currentSize: 1024, uploadRequired: true},
+		{name: "pathSize skips the same size", compareBy: CompareByPathSize, storedIdentity: "size:1024", currentSize: 1024, uploadRequired: false},
+		{name: "pathSize uploads a changed size", compareBy: CompareByPathSize, storedIdentity: "size:1024", currentSize: 2048, uploadRequired: true},
+		{name: "pathExifDate uploads files without exif date", compareBy: CompareByPathExifDate, storedIdentity: "", currentSize: 1024, uploadRequired: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			path := filepath.Join(createCompareTestDir(t), "abc.jpg")
+			writeCompareTestFile(t, path, make([]byte, test.currentSize))
+			node := &localFileStructure.FilesystemNode{Key: "2019/abc.jpg", Path: path, Name: "abc.jpg", ModTime: time.Date(2019, 02, 01, 0, 0, 0, 0, time.UTC)}
+
+			stored := datastore.ImageMetaData{
+				ImageId:       1,
+				PiwigoId:      5,
+				FullImagePath: path,
+				Filename:      "abc.jpg",
+				Md5Sum:        "uploaded",
+				Checksum:      "sha1:uploaded",
+				Identity:      test.storedIdentity,
+				LastChange:    time.Date(2019, 01, 01, 0, 0, 0, 0, time.UTC),
+			}
+
+			db := NewMockImageMetadataProvider(mockCtrl)
+			db.EXPECT().ImageMetadata(node.Path).Return(stored, nil)
+			db.EXPECT().ImageMetadataAll()
+			db.EXPECT().SaveImageMetadata(gomock.Any()).DoAndReturn(func(img datastore.ImageMetaData) error {
+				if img.UploadRequired != test.uploadRequired {
+					t.Errorf("expected upload required %t but got %t", test.uploadRequired, img.UploadRequired)
+				}
+				if !test.uploadRequired && img.Md5Sum != stored.Md5Sum {
+					t.Errorf("expected the md5sum %s of the uploaded image but got %s", stored.Md5Sum, img.Md5Sum)
+				}
+				if test.uploadRequired && img.Md5Sum != path {
+					t.Errorf("expected the new md5sum %s but got %s", path, img.Md5Sum)
+				}
+				return nil
+			})
+
+			err := SynchronizeLocalImageMetadata(db, NewMockCategoryProvider(mockCtrl), map[string]*localFileStructure.FilesystemNode{node.Key: node}, testChecksumCalculator, 1, test.compareBy, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func Test_synchronize_local_image_metadata_rejects_unknown_compareBy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	err := SynchronizeLocalImageMetadata(NewMockImageMetadataProvider(mockCtrl), NewMockCategoryProvider(mockCtrl), nil, testChecksumCalculator, 1, "name", false)
+	if err == nil {
+		t.Error("expected an error for an unknown compareBy")
+	}
+}
+
+// Images unknown by their md5sum are matched with the images of their album on the server.
+func Test_updatePiwigoIdByPath_decides_by_compareBy(t *testing.T) {
+	serverImage := &piwigo.ImageInfo{Id: 7, File: "ABC.jpg", Md5Sum: "server", Filesize: 2, DateCreation: "2019-01-02 03:04:05"}
+
+	tests := []struct {
+		name      string
+		compareBy string
+		identity  string
+		matches   bool
+	}{
+		{name: "pathSize matches the size in KB", compareBy: CompareByPathSize, identity: "size:2100", matches: true},
+		{name: "pathSize with another size", compareBy: CompareByPathSize, identity: "size:4096", matches: false},
+		{name: "pathExifDate matches the creation date", compareBy: CompareByPathExifDate, identity: "exif:2019:01:02 03:04:05", matches: true},
+		{name: "pathExifDate with another date", compareBy: CompareByPathExifDate, identity: "exif:2019:01:02 03:04:06", matches: false},
+		{name: "pathExifDate without exif date", compareBy: CompareByPathExifDate, identity: "", matches: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			img := datastore.ImageMetaData{ImageId: 1, FullImagePath: "/photos/abc.jpg", Filename: "abc.jpg", Md5Sum: "local", Identity: test.identity, CategoryPiwigoId: 3, UploadRequired: true}
+			other := datastore.ImageMetaData{ImageId: 2, FullImagePath: "/photos/def.jpg", Filename: "def.jpg", Md5Sum: "other", Identity: test.identity, CategoryPiwigoId: 3, UploadRequired: true}
+
+			db := NewMockImageMetadataProvider(mockCtrl)
+			db.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img, other}, nil)
+			piwigoMock := NewMockImageApi(mockCtrl)
+			piwigoMock.EXPECT().GetCategoryImages(3).Return([]int{7}, nil).Times(1)
+			piwigoMock.EXPECT().GetImageInfo(7).Return(serverImage, nil).Times(1)
+
+			if test.matches {
+				expected := img
+				expected.PiwigoId = 7
+				expected.Md5Sum = "server"
+				expected.UploadRequired = false
+				db.EXPECT().SaveImageMetadata(expected)
+			}
+
+			err := updatePiwigoIdByPath(db, piwigoMock, test.compareBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func Test_updatePiwigoIdByPath_does_nothing_by_md5(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	err := updatePiwigoIdByPath(NewMockImageMetadataProvider(mockCtrl), NewMockImageApi(mockCtrl), CompareByMd5)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createCompareTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func writeCompareTestFile(t *testing.T, path string, content []byte) {
+	err := ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Creates a minimal jpeg whose exif data only contains the date of the last change.
+func createJpegWithDateTime(dateTime string) []byte {
+	order := binary.LittleEndian
+	tiff := bytes.Buffer{}
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, order, uint16(42))
+	_ = binary.Write(&tiff, order, uint32(8))
+	_ = binary.Write(&tiff, order, uint16(1))
+	_ = binary.Write(&tiff, order, []uint16{0x0132, 2})
+	_ = binary.Write(&tiff, order, []uint32{20, 26})
+	_ = binary.Write(&tiff, order, uint32(0))
+	tiff.WriteString(dateTime + "\x00")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	jpeg := bytes.Buffer{}
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	_ = binary.Write(&jpeg, binary.BigEndian, uint16(len(payload)+2))
+	jpeg.Write(payload)
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// Limits the parallel uploads of the subtrees with a concurrency marker file. All other images share the global limit.
+// The number of workers is raised to the highest limit, so a subtree may upload faster than the global setting.
+type uploadLimiter struct {
+	mutex     sync.Mutex
+	overrides *localFileStructure.ConcurrencyOverrides
+	global    chan struct{}
+	subtrees  map[string]chan struct{}
+}
+
+func newUploadLimiter(numberOfWorkers int, overrides *localFileStructure.ConcurrencyOverrides) *uploadLimiter {
+	return &uploadLimiter{
+		overrides: overrides,
+		global:    make(chan struct{}, numberOfWorkers),
+		subtrees:  make(map[string]chan struct{}),
+	}
+}
+
+// The number of workers required to reach the limits of all subtrees.
+func (limiter *uploadLimiter) workers() int {
+	if max := limiter.overrides.Max(); max > cap(limiter.global) {
+		return max
+	}
+	return cap(limiter.global)
+}
+
+// Blocks until the subtree of the image may start another upload. The returned function releases it again.
+func (limiter *uploadLimiter) acquire(imagePath string) func() {
+	slots := limiter.slots(imagePath)
+	slots <- struct{}{}
+	return func() {
+		<-slots
+	}
+}
+
+func (limiter *uploadLimiter) slots(imagePath string) chan struct{} {
+	directory, limit, found := limiter.overrides.Lookup(imagePath)
+	if !found {
+		return limiter.global
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	slots, exists := limiter.subtrees[directory]
+	if !exists {
+		slots = make(chan struct{}, limit)
+		limiter.subtrees[directory] = slots
+	}
+	return slots
+}
+
+// Limits the number of albums whose images are uploaded at the same time. The images of an album are queued together
+// and the next album is queued as soon as all images of an active album are done. The images are still uploaded by the
+// shared workers, so the limit of parallel uploads applies as well. A nil limiter does not limit the albums.
+type albumLimiter struct {
+	mutex   sync.Mutex
+	slots   chan struct{}
+	pending map[string]int
+}
+
+func newAlbumLimiter(maxAlbums int) *albumLimiter {
+	if maxAlbums <= 0 {
+		return nil
+	}
+	return &albumLimiter{slots: make(chan struct{}, maxAlbums), pending: make(map[string]int)}
+}
+
+// Blocks until another album may be queued and marks its images as pending.
+func (limiter *albumLimiter) start(album string, images int) {
+	if limiter == nil || images == 0 {
+		return
+	}
+	limiter.slots <- struct{}{}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.pending[album] = images
+	logrus.Debugf("Uploading the %d images of album %s", images, album)
+}
+
+// Releases the album once the last of its images is done, no matter if the upload succeeded.
+func (limiter *albumLimiter) done(img datastore.ImageMetaData) {
+	if limiter == nil {
+		return
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.pending[img.CategoryPath]--
+	if limiter.pending[img.CategoryPath] <= 0 {
+		delete(limiter.pending, img.CategoryPath)
+		<-limiter.slots
+	}
+}
+
+// Groups the images by album. The albums keep the order of their first image and the images their order within the
+// album.
+func groupByAlbum(images []datastore.ImageMetaData) [][]datastore.ImageMetaData {
+	positions := make(map[string]int)
+	albums := make([][]datastore.ImageMetaData, 0)
+	for _, img := range images {
+		position, found := positions[img.CategoryPath]
+		if !found {
+			position = len(albums)
+			positions[img.CategoryPath] = position
+			albums = append(albums, nil)
+		}
+		albums[position] = append(albums[position], img)
+	}
+	return albums
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_uploadLimiter_without_overrides_uses_the_global_number_of_workers(t *testing.T) {
+	limiter := newUploadLimiter(4, nil)
+
+	if limiter.workers() != 4 {
+		t.Errorf("unexpected number of workers %d", limiter.workers())
+	}
+	if maxParallel := runLimitedUploads(limiter, "/images/ssd/image.jpg", 4, 12); maxParallel != 4 {
+		t.Errorf("expected 4 parallel uploads but got %d", maxParallel)
+	}
+}
+
+func Test_uploadLimiter_limits_the_subtree_of_a_marker(t *testing.T) {
+	root := createConcurrencyMarker(t, "network", "1")
+	scanned := map[string]*localFileStructure.FilesystemNode{
+		"network": {Path: filepath.Join(root, "network"), IsDir: true},
+	}
+	overrides := localFileStructure.ReadConcurrencyOverrides(root, scanned)
+	limiter := newUploadLimiter(4, overrides)
+
+	if maxParallel := runLimitedUploads(limiter, filepath.Join(root, "network", "image.jpg"), 4, 8); maxParallel != 1 {
+		t.Errorf("expected 1 parallel upload but got %d", maxParallel)
+	}
+}
+
+func Test_uploadLimiter_raises_the_workers_for_higher_overrides(t *testing.T) {
+	root := createConcurrencyMarker(t, "", "8")
+	overrides := localFileStructure.ReadConcurrencyOverrides(root, nil)
+	limiter := newUploadLimiter(2, overrides)
+
+	if limiter.workers() != 8 {
+		t.Errorf("unexpected number of workers %d", limiter.workers())
+	}
+	if maxParallel := runLimitedUploads(limiter, filepath.Join(root, "image.jpg"), 8, 16); maxParallel != 8 {
+		t.Errorf("expected 8 parallel uploads but got %d", maxParallel)
+	}
+}
+
+func createConcurrencyMarker(t *testing.T, directory string, content string) string {
+	root, err := ioutil.TempDir("", "limiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	err = os.MkdirAll(filepath.Join(root, directory), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, directory, localFileStructure.ConcurrencyMarkerFile), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// Runs the uploads on the given number of workers and returns the highest number of parallel uploads.
+func runLimitedUploads(limiter *uploadLimiter, imagePath string, workers int, uploads int) int32 {
+	var running, maxParallel int32
+	queue := make(chan struct{}, uploads)
+	for i := 0; i < uploads; i++ {
+		queue <- struct{}{}
+	}
+	close(queue)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range queue {
+				release := limiter.acquire(imagePath)
+				current := atomic.AddInt32(&running, 1)
+				for {
+					max := atomic.LoadInt32(&maxParallel)
+					if current <= max || atomic.CompareAndSwapInt32(&maxParallel, max, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	return maxParallel
+}
+
+func Test_albumLimiter_limits_the_albums_in_flight(t *testing.T) {
+	images := make([]datastore.ImageMetaData, 0)
+	for album := 0; album < 5; album++ {
+		for i := 0; i < 3; i++ {
+			images = append(images, datastore.ImageMetaData{FullImagePath: fmt.Sprintf("/album%d/%d.jpg", album, i), CategoryPath: fmt.Sprintf("album%d", album)})
+		}
+	}
+
+	albums := newAlbumLimiter(2)
+	workQueue := make(chan datastore.ImageMetaData, 4)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go uploadQueueProducer(images, workQueue, albums, &wg)
+
+	mutex := sync.Mutex{}
+	active := make(map[string]int)
+	maxAlbums := 0
+	processed := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for img := range workQueue {
+				mutex.Lock()
+				active[img.CategoryPath]++
+				if len(active) > maxAlbums {
+					maxAlbums = len(active)
+				}
+				mutex.Unlock()
+				time.Sleep(5 * time.Millisecond)
+
+				// the album has to leave the active ones before the limiter releases it
+				mutex.Lock()
+				processed++
+				active[img.CategoryPath]--
+				if active[img.CategoryPath] == 0 {
+					delete(active, img.CategoryPath)
+				}
+				mutex.Unlock()
+				albums.done(img)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if processed != len(images) {
+		t.Errorf("processed %d images, want %d", processed, len(images))
+	}
+	if maxAlbums > 2 {
+		t.Errorf("expected at most 2 albums in flight but got %d", maxAlbums)
+	}
+}
+
+func Test_groupByAlbum_keeps_the_order(t *testing.T) {
+	images := []datastore.ImageMetaData{
+		{FullImagePath: "/b/1.jpg", CategoryPath: "b"},
+		{FullImagePath: "/a/1.jpg", CategoryPath: "a"},
+		{FullImagePath: "/b/2.jpg", CategoryPath: "b"},
+	}
+
+	albums := groupByAlbum(images)
+	if len(albums) != 2 || len(albums[0]) != 2 || len(albums[1]) != 1 {
+		t.Fatalf("unexpected albums %v", albums)
+	}
+	if albums[0][0].FullImagePath != "/b/1.jpg" || albums[0][1].FullImagePath != "/b/2.jpg" || albums[1][0].FullImagePath != "/a/1.jpg" {
+		t.Errorf("unexpected order %v", albums)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/sirupsen/logrus"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The filename of the contact sheet uploaded to every album. The underscore keeps it apart from the images.
+const ContactSheetFilename = "_contact-sheet.jpg"
+
+var contactSheetBackground = color.RGBA{R: 32, G: 32, B: 32, A: 255}
+
+type ContactSheetOptions struct {
+	// the number of thumbnails per row and the number of rows
+	Columns int
+	Rows    int
+	// the size of the contact sheet in pixels
+	Width  int
+	Height int
+	// albums with fewer images get no contact sheet
+	MinImages int
+	// sets the contact sheet as representative of the album
+	AsCover bool
+	// holds the generated contact sheets until they are uploaded
+	WorkDir *workdir.WorkDir
+}
+
+// Uploads a contact sheet with thumbnails of the images to every album with at least MinImages images. The sheet of an
+// album is only generated again if images got uploaded to it during the run or if it has none yet. Albums with more
+// images than thumbnails get a sample spread evenly over all images ordered by path. A sheet that did not change is
+// not uploaded again.
+func UploadContactSheets(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, categoryDb datastore.CategoryProvider, imageDb datastore.ImageMetadataProvider, uploaded *UploadedImages, options ContactSheetOptions) error {
+	logrus.Debug("Entering UploadContactSheets")
+	defer logrus.Debug("Leaving UploadContactSheets")
+
+	if options.Columns <= 0 || options.Rows <= 0 || options.Width < options.Columns || options.Height < options.Rows {
+		return errors.New(fmt.Sprintf("a contact sheet of %dx%d pixels can not hold %dx%d thumbnails", options.Width, options.Height, options.Columns, options.Rows))
+	}
+
+	images, err := imageDb.ImageMetadataAll()
+	if err != nil {
+		return err
+	}
+	albums := make(map[int][]datastore.ImageMetaData)
+	for _, img := range images {
+		if img.PiwigoId > 0 && img.CategoryPiwigoId > 0 && !img.DeleteRequired {
+			albums[img.CategoryPiwigoId] = append(albums[img.CategoryPiwigoId], img)
+		}
+	}
+	categoryIds := make([]int, 0, len(albums))
+	for categoryId := range albums {
+		categoryIds = append(categoryIds, categoryId)
+	}
+	sort.Ints(categoryIds)
+
+	changed := make(map[int]bool)
+	for _, categoryId := range uploaded.categories() {
+		changed[categoryId] = true
+	}
+
+	for _, categoryId := range categoryIds {
+		if len(albums[categoryId]) < options.MinImages {
+			logrus.Debugf("Category %d has only %d images. Skipping the contact sheet...", categoryId, len(albums[categoryId]))
+			continue
+		}
+		category, err := categoryDb.GetCategoryByPiwigoId(categoryId)
+		if err != nil {
+			logrus.Warnf("Could not load category %d - %s. Skipping the contact sheet...", categoryId, err)
+			continue
+		}
+		if category.ContactSheetPiwigoId > 0 && !changed[categoryId] {
+			continue
+		}
+
+		err = uploadContactSheet(categoryApi, imageApi, categoryDb, category, albums[categoryId], options)
+		if err != nil {
+			logrus.Warnf("%s: could not upload the contact sheet - %s", category.Key, err)
+		}
+	}
+	return nil
+}
+
+func uploadContactSheet(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, categoryDb datastore.CategoryProvider, category datastore.CategoryData, images []datastore.ImageMetaData, options ContactSheetOptions) error {
+	sheetPath, md5sum, err := writeContactSheet(category.PiwigoId, images, options)
+	if err != nil {
+		return err
+	}
+
+	correlationId := piwigo.NewCorrelationId()
+	log := piwigo.CorrelationLog(correlationId)
+	sheetId := category.ContactSheetPiwigoId
+	upToDate := false
+	if sheetId > 0 {
+		state, err := imageApi.ImageCheckFile(sheetId, md5sum)
+		switch {
+		case errors.Is(err, piwigo.ErrorImageNotFound):
+			log.Infof("%s: The contact sheet %d was removed from the server, uploading a new one", category.Key, sheetId)
+			sheetId = 0
+		case err != nil:
+			return err
+		case state == piwigo.ImageStateUptodate:
+			log.Debugf("%s: The contact sheet %d did not change", category.Key, sheetId)
+			upToDate = true
+		}
+	}
+
+	if !upToDate {
+		result, err := imageApi.UploadImage(sheetId, sheetPath, md5sum, category.PiwigoId, correlationId)
+		if err != nil {
+			return err
+		}
+		sheetId = result.ImageId
+		log.Infof("%s: Uploaded the contact sheet as image %d", category.Key, sheetId)
+	}
+
+	if options.AsCover && category.CoverPiwigoId != sheetId {
+		err = categoryApi.SetCategoryRepresentative(category.PiwigoId, sheetId)
+		if err != nil {
+			return err
+		}
+		log.Infof("%s: Set the contact sheet %d as representative", category.Key, sheetId)
+		category.CoverPiwigoId = sheetId
+	} else if category.ContactSheetPiwigoId == sheetId {
+		return nil
+	}
+
+	category.ContactSheetPiwigoId = sheetId
+	return categoryDb.SaveCategory(category)
+}
+
+// Draws the thumbnails into a grid and writes the sheet as jpeg to the work directory. Returns the path and the md5sum
+// of the file. Images that can not be decoded leave their cell empty.
+func writeContactSheet(categoryId int, images []datastore.ImageMetaData, options ContactSheetOptions) (string, string, error) {
+	sheet := image.NewRGBA(image.Rect(0, 0, options.Width, options.Height))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(contactSheetBackground), image.Point{}, draw.Src)
+
+	cellWidth := options.Width / options.Columns
+	cellHeight := options.Height / options.Rows
+	padding := cellWidth / 40
+	for index, img := range selectContactSheetImages(images, options.Columns*options.Rows) {
+		decoded, err := decodeImage(img.FullImagePath)
+		if err != nil {
+			logrus.Warnf("%s: could not add the image to the contact sheet - %s", img.FullImagePath, err)
+			continue
+		}
+		column := index % options.Columns
+		row := index / options.Columns
+		cell := image.Rect(column*cellWidth, row*cellHeight, (column+1)*cellWidth, (row+1)*cellHeight).Inset(padding)
+		drawThumbnail(sheet, cell, decoded)
+	}
+
+	content := bytes.Buffer{}
+	err := jpeg.Encode(&content, sheet, &jpeg.Options{Quality: 85})
+	if err != nil {
+		return "", "", err
+	}
+
+	// every album gets its own directory as the filename is used as the name of the image on the server
+	directory := filepath.Join(options.WorkDir.Path(), fmt.Sprintf("contactSheet-%d", categoryId))
+	err = os.MkdirAll(directory, 0700)
+	if err != nil {
+		return "", "", err
+	}
+	sheetPath := filepath.Join(directory, ContactSheetFilename)
+	err = ioutil.WriteFile(sheetPath, content.Bytes(), 0600)
+	if err != nil {
+		return "", "", err
+	}
+
+	checksum := md5.Sum(content.Bytes())
+	return sheetPath, hex.EncodeToString(checksum[:]), nil
+}
+
+// Returns at most count images ordered by path, spread evenly over all images.
+func selectContactSheetImages(images []datastore.ImageMetaData, count int) []datastore.ImageMetaData {
+	sorted := make([]datastore.ImageMetaData, len(images))
+	copy(sorted, images)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].FullImagePath < sorted[j].FullImagePath
+	})
+	if len(sorted) <= count {
+		return sorted
+	}
+
+	selected := make([]datastore.ImageMetaData, count)
+	for i := range selected {
+		selected[i] = sorted[i*len(sorted)/count]
+	}
+	return selected
+}
+
+func decodeImage(filePath string) (image.Image, error) {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoded, _, err := image.Decode(file)
+	return decoded, err
+}
+
+// Scales the image to fit into the cell keeping its aspect ratio and centers it. The pixels are sampled without
+// smoothing which is good enough for thumbnails.
+func drawThumbnail(sheet *image.RGBA, cell image.Rectangle, img image.Image) {
+	source := img.Bounds()
+	if source.Empty() || cell.Empty() {
+		return
+	}
+
+	width := cell.Dx()
+	height := source.Dy() * width / source.Dx()
+	if height > cell.Dy() {
+		height = cell.Dy()
+		width = source.Dx() * height / source.Dy()
+	}
+	if width < 1 || height < 1 {
+		return
+	}
+
+	left := cell.Min.X + (cell.Dx()-width)/2
+	top := cell.Min.Y + (cell.Dy()-height)/2
+	for y := 0; y < height; y++ {
+		sourceY := source.Min.Y + (2*y+1)*source.Dy()/(2*height)
+		for x := 0; x < width; x++ {
+			sourceX := source.Min.X + (2*x+1)*source.Dx()/(2*width)
+			sheet.Set(left+x, top+y, img.At(sourceX, sourceY))
+		}
+	}
+}
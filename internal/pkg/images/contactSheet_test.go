@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/golang/mock/gomock"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_UploadContactSheets_uploads_the_sheet_of_albums_with_enough_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	workDir := createContactSheetWorkDir(t)
+	images := append(createContactSheetTestImages(t, workDir, 3, 3), createContactSheetTestImages(t, workDir, 4, 1)...)
+	category := datastore.CategoryData{CategoryId: 1, PiwigoId: 3, Key: "2019/holidays"}
+	categoryToSave := category
+	categoryToSave.ContactSheetPiwigoId = 20
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(category, nil)
+	categoryDb.EXPECT().SaveCategory(categoryToSave).Times(1)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(images, nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().UploadImage(0, gomock.Any(), gomock.Any(), 3, gomock.Any()).Times(1).DoAndReturn(func(piwigoId int, filePath string, md5sum string, category int, correlationId string) (piwigo.UploadResult, error) {
+		if filepath.Base(filePath) != ContactSheetFilename {
+			t.Errorf("unexpected contact sheet filename %s", filePath)
+		}
+		return piwigo.UploadResult{ImageId: 20}, nil
+	})
+
+	err := UploadContactSheets(NewMockCategoryApi(mockCtrl), imageApi, categoryDb, imageDb, NewUploadedImages(), contactSheetTestOptions(workDir, false))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UploadContactSheets_skips_albums_without_new_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	workDir := createContactSheetWorkDir(t)
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 3, ContactSheetPiwigoId: 20}, nil)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createContactSheetTestImages(t, workDir, 3, 2), nil)
+
+	err := UploadContactSheets(NewMockCategoryApi(mockCtrl), NewMockImageApi(mockCtrl), categoryDb, imageDb, NewUploadedImages(), contactSheetTestOptions(workDir, false))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UploadContactSheets_keeps_an_unchanged_sheet_and_sets_it_as_cover(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	workDir := createContactSheetWorkDir(t)
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+	category := datastore.CategoryData{CategoryId: 1, PiwigoId: 3, ContactSheetPiwigoId: 20}
+	categoryToSave := category
+	categoryToSave.CoverPiwigoId = 20
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(category, nil)
+	categoryDb.EXPECT().SaveCategory(categoryToSave).Times(1)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createContactSheetTestImages(t, workDir, 3, 2), nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImageCheckFile(20, gomock.Any()).Times(1).Return(piwigo.ImageStateUptodate, nil)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().SetCategoryRepresentative(3, 20).Times(1)
+
+	err := UploadContactSheets(categoryApi, imageApi, categoryDb, imageDb, uploaded, contactSheetTestOptions(workDir, true))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UploadContactSheets_replaces_a_changed_sheet(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	workDir := createContactSheetWorkDir(t)
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 3, ContactSheetPiwigoId: 20}, nil)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createContactSheetTestImages(t, workDir, 3, 2), nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImageCheckFile(20, gomock.Any()).Times(1).Return(piwigo.ImageStateDifferent, nil)
+	imageApi.EXPECT().UploadImage(20, gomock.Any(), gomock.Any(), 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 20}, nil)
+
+	err := UploadContactSheets(NewMockCategoryApi(mockCtrl), imageApi, categoryDb, imageDb, uploaded, contactSheetTestOptions(workDir, false))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UploadContactSheets_rejects_a_grid_larger_than_the_sheet(t *testing.T) {
+	options := ContactSheetOptions{Columns: 4, Rows: 4, Width: 3, Height: 100}
+	err := UploadContactSheets(nil, nil, nil, nil, nil, options)
+	if err == nil {
+		t.Error("expected the grid to be rejected")
+	}
+}
+
+func Test_writeContactSheet_writes_a_jpeg_of_the_configured_size(t *testing.T) {
+	workDir := createContactSheetWorkDir(t)
+	images := createContactSheetTestImages(t, workDir, 3, 5)
+	images = append(images, datastore.ImageMetaData{FullImagePath: filepath.Join(workDir.Path(), "missing.png")})
+
+	sheetPath, md5sum, err := writeContactSheet(3, images, contactSheetTestOptions(workDir, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md5sum == "" {
+		t.Error("expected the md5sum of the contact sheet")
+	}
+
+	file, err := os.Open(sheetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	config, err := jpeg.DecodeConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 120 || config.Height != 80 {
+		t.Errorf("contact sheet has %dx%d pixels, want 120x80", config.Width, config.Height)
+	}
+}
+
+func Test_selectContactSheetImages_spreads_the_sample_over_all_images(t *testing.T) {
+	images := make([]datastore.ImageMetaData, 0)
+	for i := 9; i >= 0; i-- {
+		images = append(images, datastore.ImageMetaData{FullImagePath: fmt.Sprintf("/album/%02d.jpg", i)})
+	}
+
+	selected := selectContactSheetImages(images, 4)
+	want := []string{"/album/00.jpg", "/album/02.jpg", "/album/05.jpg", "/album/07.jpg"}
+	if len(selected) != len(want) {
+		t.Fatalf("got %d images, want %d", len(selected), len(want))
+	}
+	for i := range want {
+		if selected[i].FullImagePath != want[i] {
+			t.Errorf("image %d is %s, want %s", i, selected[i].FullImagePath, want[i])
+		}
+	}
+}
+
+func Test_drawThumbnail_keeps_the_aspect_ratio(t *testing.T) {
+	sheet := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 10; y++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	drawThumbnail(sheet, sheet.Bounds(), img)
+
+	if sheet.RGBAAt(20, 20) != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Error("expected the center of the cell to be covered")
+	}
+	if sheet.RGBAAt(20, 5).A != 0 || sheet.RGBAAt(20, 35).A != 0 {
+		t.Error("expected the thumbnail to be centered vertically")
+	}
+}
+
+func contactSheetTestOptions(workDir *workdir.WorkDir, asCover bool) ContactSheetOptions {
+	return ContactSheetOptions{Columns: 3, Rows: 2, Width: 120, Height: 80, MinImages: 2, AsCover: asCover, WorkDir: workDir}
+}
+
+func createContactSheetWorkDir(t *testing.T) *workdir.WorkDir {
+	dir, err := workdir.Create("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dir.Remove() })
+	return dir
+}
+
+// Writes png images of the given category to the work directory and returns their metadata.
+func createContactSheetTestImages(t *testing.T, workDir *workdir.WorkDir, categoryId int, count int) []datastore.ImageMetaData {
+	images := make([]datastore.ImageMetaData, 0, count)
+	for i := 0; i < count; i++ {
+		file, err := workDir.CreateFile("contactSheet*.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+		img.Set(i%30, 0, color.RGBA{R: uint8(i * 40), A: 255})
+		err = png.Encode(file, img)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, datastore.ImageMetaData{ImageId: categoryId*100 + i, PiwigoId: categoryId*100 + i, FullImagePath: file.Name(), CategoryPiwigoId: categoryId})
+	}
+	return images
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+)
+
+// Policies how the representative of the categories images got uploaded to is chosen.
+const (
+	// the representative is left to piwigo
+	CoverPolicyNone = "none"
+	// the image with the latest modification date
+	CoverPolicyNewest = "newest"
+	// the image with the earliest modification date
+	CoverPolicyOldest = "oldest"
+	// the first image sorted by filename
+	CoverPolicyFirstAlphabetical = "firstAlphabetical"
+)
+
+// Collects the images uploaded during the run by category. A nil collection ignores all images.
+type UploadedImages struct {
+	mutex  sync.Mutex
+	images map[int]map[int]bool
+}
+
+func NewUploadedImages() *UploadedImages {
+	return &UploadedImages{images: make(map[int]map[int]bool)}
+}
+
+func (u *UploadedImages) add(categoryId int, piwigoId int) {
+	if u == nil || categoryId <= 0 || piwigoId <= 0 {
+		return
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.images[categoryId] == nil {
+		u.images[categoryId] = make(map[int]bool)
+	}
+	u.images[categoryId][piwigoId] = true
+}
+
+func (u *UploadedImages) remove(categoryId int, piwigoId int) {
+	if u == nil {
+		return
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	delete(u.images[categoryId], piwigoId)
+	if len(u.images[categoryId]) == 0 {
+		delete(u.images, categoryId)
+	}
+}
+
+func (u *UploadedImages) contains(categoryId int, piwigoId int) bool {
+	if u == nil {
+		return false
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.images[categoryId][piwigoId]
+}
+
+// The ids of the categories images got uploaded to, ordered by id.
+func (u *UploadedImages) categories() []int {
+	if u == nil {
+		return nil
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	categoryIds := make([]int, 0, len(u.images))
+	for categoryId := range u.images {
+		categoryIds = append(categoryIds, categoryId)
+	}
+	sort.Ints(categoryIds)
+	return categoryIds
+}
+
+// Sets the representative of every category images got uploaded to according to the policy. The cover is chosen from
+// all uploaded images of the category, not only the ones of this run. Categories with a representative that was
+// neither set by the uploader nor picked by piwigo from the images of this run are considered as set manually and are
+// only changed if overrideCover is set.
+func SetCategoryCovers(categoryApi piwigo.CategoryApi, categoryDb datastore.CategoryProvider, imageDb datastore.ImageMetadataProvider, uploaded *UploadedImages, policy string, overrideCover bool) error {
+	logrus.Debug("Entering SetCategoryCovers")
+	defer logrus.Debug("Leaving SetCategoryCovers")
+
+	if policy != CoverPolicyNone && policy != CoverPolicyNewest && policy != CoverPolicyOldest && policy != CoverPolicyFirstAlphabetical {
+		return errors.New(fmt.Sprintf("unknown cover policy %s. Use one of none, newest, oldest or firstAlphabetical", policy))
+	}
+
+	categoryIds := uploaded.categories()
+	if policy == CoverPolicyNone || len(categoryIds) == 0 {
+		return nil
+	}
+
+	images, err := imageDb.ImageMetadataAll()
+	if err != nil {
+		return err
+	}
+	candidates := make(map[int][]datastore.ImageMetaData)
+	for _, img := range images {
+		if img.PiwigoId > 0 && !img.DeleteRequired {
+			candidates[img.CategoryPiwigoId] = append(candidates[img.CategoryPiwigoId], img)
+		}
+	}
+
+	categories, err := categoryApi.GetAllCategories()
+	if err != nil {
+		return err
+	}
+	index := piwigo.NewCategoryIndex(categories)
+
+	for _, categoryId := range categoryIds {
+		serverCategory, found := index.ById(categoryId)
+		if !found {
+			logrus.Warnf("Category %d not found on the server. Skipping the cover...", categoryId)
+			continue
+		}
+		category, err := categoryDb.GetCategoryByPiwigoId(categoryId)
+		if err != nil {
+			logrus.Warnf("Could not load category %s - %s. Skipping the cover...", serverCategory.Key, err)
+			continue
+		}
+
+		cover := selectCover(candidates[categoryId], policy)
+		if cover == 0 || (cover == serverCategory.RepresentativeId && cover == category.CoverPiwigoId) {
+			continue
+		}
+
+		representative := serverCategory.RepresentativeId
+		setManually := representative > 0 && representative != category.CoverPiwigoId && !uploaded.contains(categoryId, representative)
+		if setManually && !overrideCover {
+			logrus.Infof("%s: Keeping the representative %d that was not set by the uploader", serverCategory.Key, representative)
+			continue
+		}
+
+		err = categoryApi.SetCategoryRepresentative(categoryId, cover)
+		if err != nil {
+			logrus.Warnf("%s: could not set image %d as representative - %s", serverCategory.Key, cover, err)
+			continue
+		}
+		logrus.Infof("%s: Set image %d as representative", serverCategory.Key, cover)
+
+		category.CoverPiwigoId = cover
+		err = categoryDb.SaveCategory(category)
+		if err != nil {
+			logrus.Warnf("Could not save the cover of category %s", category.Key)
+		}
+	}
+	return nil
+}
+
+// Returns the piwigo id of the image chosen by the policy or zero if there is no image.
+func selectCover(images []datastore.ImageMetaData, policy string) int {
+	if len(images) == 0 {
+		return 0
+	}
+
+	sorted := make([]datastore.ImageMetaData, len(images))
+	copy(sorted, images)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case policy == CoverPolicyNewest && !a.LastChange.Equal(b.LastChange):
+			return a.LastChange.After(b.LastChange)
+		case policy == CoverPolicyOldest && !a.LastChange.Equal(b.LastChange):
+			return a.LastChange.Before(b.LastChange)
+		case policy == CoverPolicyFirstAlphabetical && a.Filename != b.Filename:
+			return a.Filename < b.Filename
+		}
+		return a.FullImagePath < b.FullImagePath
+	})
+	return sorted[0].PiwigoId
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func Test_SetCategoryCovers_sets_the_newest_image(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+
+	category := datastore.CategoryData{CategoryId: 1, PiwigoId: 3, Name: "holidays", Key: "2019/holidays"}
+	categoryToSave := category
+	categoryToSave.CoverPiwigoId = 12
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(category, nil)
+	categoryDb.EXPECT().SaveCategory(categoryToSave).Times(1)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createCoverTestImages(), nil)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(coverTestCategories(0), nil)
+	categoryApi.EXPECT().SetCategoryRepresentative(3, 12).Times(1)
+
+	err := SetCategoryCovers(categoryApi, categoryDb, imageDb, uploaded, CoverPolicyNewest, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SetCategoryCovers_replaces_the_representative_piwigo_picked(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// piwigo sets one of the uploaded images as representative of categories without one
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 3}, nil)
+	categoryDb.EXPECT().SaveCategory(gomock.Any()).Times(1)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createCoverTestImages(), nil)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(coverTestCategories(11), nil)
+	categoryApi.EXPECT().SetCategoryRepresentative(3, 10).Times(1)
+
+	err := SetCategoryCovers(categoryApi, categoryDb, imageDb, uploaded, CoverPolicyOldest, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SetCategoryCovers_keeps_manually_set_representatives(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 3, CoverPiwigoId: 12}, nil)
+	categoryDb.EXPECT().SaveCategory(gomock.Any()).Times(0)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createCoverTestImages(), nil)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(coverTestCategories(99), nil)
+	categoryApi.EXPECT().SetCategoryRepresentative(gomock.Any(), gomock.Any()).Times(0)
+
+	err := SetCategoryCovers(categoryApi, categoryDb, imageDb, uploaded, CoverPolicyNewest, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SetCategoryCovers_overrides_manually_set_representatives(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+
+	categoryDb := NewMockCategoryProvider(mockCtrl)
+	categoryDb.EXPECT().GetCategoryByPiwigoId(3).Times(1).Return(datastore.CategoryData{CategoryId: 1, PiwigoId: 3, CoverPiwigoId: 12}, nil)
+	categoryDb.EXPECT().SaveCategory(gomock.Any()).Times(1)
+
+	imageDb := NewMockImageMetadataProvider(mockCtrl)
+	imageDb.EXPECT().ImageMetadataAll().Times(1).Return(createCoverTestImages(), nil)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(coverTestCategories(99), nil)
+	categoryApi.EXPECT().SetCategoryRepresentative(3, 12).Times(1)
+
+	err := SetCategoryCovers(categoryApi, categoryDb, imageDb, uploaded, CoverPolicyNewest, true)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SetCategoryCovers_does_nothing_without_policy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	uploaded := NewUploadedImages()
+	uploaded.add(3, 11)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(0)
+
+	err := SetCategoryCovers(categoryApi, NewMockCategoryProvider(mockCtrl), NewMockImageMetadataProvider(mockCtrl), uploaded, CoverPolicyNone, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SetCategoryCovers_fails_on_unknown_policy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	err := SetCategoryCovers(NewMockCategoryApi(mockCtrl), NewMockCategoryProvider(mockCtrl), NewMockImageMetadataProvider(mockCtrl), nil, "random", false)
+	if err == nil {
+		t.Error("Expected an error as the policy is unknown")
+	}
+}
+
+func Test_selectCover(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{CoverPolicyNewest, 12},
+		{CoverPolicyOldest, 10},
+		{CoverPolicyFirstAlphabetical, 11},
+	}
+	for _, tt := range tests {
+		if got := selectCover(createCoverTestImages()[:3], tt.policy); got != tt.want {
+			t.Errorf("selectCover(%s) = %d, want %d", tt.policy, got, tt.want)
+		}
+	}
+	if got := selectCover(nil, CoverPolicyNewest); got != 0 {
+		t.Errorf("selectCover without images = %d, want 0", got)
+	}
+}
+
+func Test_uploadImages_collects_the_uploaded_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	uploaded := NewUploadedImages()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, Uploaded: uploaded})
+	if err != nil {
+		t.Error(err)
+	}
+	if !uploaded.contains(2, 5) {
+		t.Errorf("The uploaded image was not collected for its category")
+	}
+}
+
+func coverTestCategories(representativeId int) map[string]*piwigo.Category {
+	return map[string]*piwigo.Category{
+		"2019/holidays": {Id: 3, ParentId: 1, Name: "holidays", Key: "2019/holidays", RepresentativeId: representativeId},
+	}
+}
+
+func createCoverTestImages() []datastore.ImageMetaData {
+	return []datastore.ImageMetaData{
+		{PiwigoId: 10, CategoryPiwigoId: 3, FullImagePath: "2019/holidays/c.jpg", Filename: "c.jpg", LastChange: time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{PiwigoId: 11, CategoryPiwigoId: 3, FullImagePath: "2019/holidays/a.jpg", Filename: "a.jpg", LastChange: time.Date(2019, 7, 2, 0, 0, 0, 0, time.UTC)},
+		{PiwigoId: 12, CategoryPiwigoId: 3, FullImagePath: "2019/holidays/b.jpg", Filename: "b.jpg", LastChange: time.Date(2019, 7, 3, 0, 0, 0, 0, time.UTC)},
+		// images that are removed or belong to other categories are never used as cover
+		{PiwigoId: 13, CategoryPiwigoId: 3, FullImagePath: "2019/holidays/d.jpg", Filename: "0.jpg", LastChange: time.Date(2019, 7, 4, 0, 0, 0, 0, time.UTC), DeleteRequired: true},
+		{PiwigoId: 14, CategoryPiwigoId: 4, FullImagePath: "2019/work/e.jpg", Filename: "e.jpg", LastChange: time.Date(2019, 7, 5, 0, 0, 0, 0, time.UTC)},
+	}
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore (interfaces: ImageMetadataProvider,CategoryProvider)
+// Source: git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore (interfaces: ImageMetadataProvider,CategoryProvider,AlbumCursorProvider,DeferredMetadataProvider,RawFormatProvider)
 
 // Package images is a generated GoMock package.
 package images
@@ -33,6 +33,20 @@ func (m *MockImageMetadataProvider) EXPECT() *MockImageMetadataProviderMockRecor
 	return m.recorder
 }
 
+// ClearImageFailures mocks base method
+func (m *MockImageMetadataProvider) ClearImageFailures() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearImageFailures")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearImageFailures indicates an expected call of ClearImageFailures
+func (mr *MockImageMetadataProviderMockRecorder) ClearImageFailures() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearImageFailures", reflect.TypeOf((*MockImageMetadataProvider)(nil).ClearImageFailures))
+}
+
 // DeleteMarkedImages mocks base method
 func (m *MockImageMetadataProvider) DeleteMarkedImages() error {
 	m.ctrl.T.Helper()
@@ -77,6 +91,51 @@ func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataAll() *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataAll", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataAll))
 }
 
+// ImageMetadataByFileId mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataByFileId(arg0 string) ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataByFileId", arg0)
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataByFileId indicates an expected call of ImageMetadataByFileId
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataByFileId(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataByFileId", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataByFileId), arg0)
+}
+
+// ImageMetadataInterrupted mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataInterrupted() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataInterrupted")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataInterrupted indicates an expected call of ImageMetadataInterrupted
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataInterrupted() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataInterrupted", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataInterrupted))
+}
+
+// ImageMetadataMoved mocks base method
+func (m *MockImageMetadataProvider) ImageMetadataMoved() ([]datastore.ImageMetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageMetadataMoved")
+	ret0, _ := ret[0].([]datastore.ImageMetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageMetadataMoved indicates an expected call of ImageMetadataMoved
+func (mr *MockImageMetadataProviderMockRecorder) ImageMetadataMoved() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageMetadataMoved", reflect.TypeOf((*MockImageMetadataProvider)(nil).ImageMetadataMoved))
+}
+
 // ImageMetadataToDelete mocks base method
 func (m *MockImageMetadataProvider) ImageMetadataToDelete() ([]datastore.ImageMetaData, error) {
 	m.ctrl.T.Helper()
@@ -216,3 +275,187 @@ func (mr *MockCategoryProviderMockRecorder) SaveCategory(arg0 interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCategory", reflect.TypeOf((*MockCategoryProvider)(nil).SaveCategory), arg0)
 }
+
+// MockAlbumCursorProvider is a mock of AlbumCursorProvider interface
+type MockAlbumCursorProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockAlbumCursorProviderMockRecorder
+}
+
+// MockAlbumCursorProviderMockRecorder is the mock recorder for MockAlbumCursorProvider
+type MockAlbumCursorProviderMockRecorder struct {
+	mock *MockAlbumCursorProvider
+}
+
+// NewMockAlbumCursorProvider creates a new mock instance
+func NewMockAlbumCursorProvider(ctrl *gomock.Controller) *MockAlbumCursorProvider {
+	mock := &MockAlbumCursorProvider{ctrl: ctrl}
+	mock.recorder = &MockAlbumCursorProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAlbumCursorProvider) EXPECT() *MockAlbumCursorProviderMockRecorder {
+	return m.recorder
+}
+
+// AlbumCursors mocks base method
+func (m *MockAlbumCursorProvider) AlbumCursors() (map[string]datastore.AlbumCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AlbumCursors")
+	ret0, _ := ret[0].(map[string]datastore.AlbumCursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AlbumCursors indicates an expected call of AlbumCursors
+func (mr *MockAlbumCursorProviderMockRecorder) AlbumCursors() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AlbumCursors", reflect.TypeOf((*MockAlbumCursorProvider)(nil).AlbumCursors))
+}
+
+// DeleteAlbumCursor mocks base method
+func (m *MockAlbumCursorProvider) DeleteAlbumCursor(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAlbumCursor", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAlbumCursor indicates an expected call of DeleteAlbumCursor
+func (mr *MockAlbumCursorProviderMockRecorder) DeleteAlbumCursor(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAlbumCursor", reflect.TypeOf((*MockAlbumCursorProvider)(nil).DeleteAlbumCursor), arg0)
+}
+
+// SaveAlbumCursor mocks base method
+func (m *MockAlbumCursorProvider) SaveAlbumCursor(arg0 datastore.AlbumCursor) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAlbumCursor", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAlbumCursor indicates an expected call of SaveAlbumCursor
+func (mr *MockAlbumCursorProviderMockRecorder) SaveAlbumCursor(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAlbumCursor", reflect.TypeOf((*MockAlbumCursorProvider)(nil).SaveAlbumCursor), arg0)
+}
+
+// MockDeferredMetadataProvider is a mock of DeferredMetadataProvider interface
+type MockDeferredMetadataProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeferredMetadataProviderMockRecorder
+}
+
+// MockDeferredMetadataProviderMockRecorder is the mock recorder for MockDeferredMetadataProvider
+type MockDeferredMetadataProviderMockRecorder struct {
+	mock *MockDeferredMetadataProvider
+}
+
+// NewMockDeferredMetadataProvider creates a new mock instance
+func NewMockDeferredMetadataProvider(ctrl *gomock.Controller) *MockDeferredMetadataProvider {
+	mock := &MockDeferredMetadataProvider{ctrl: ctrl}
+	mock.recorder = &MockDeferredMetadataProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockDeferredMetadataProvider) EXPECT() *MockDeferredMetadataProviderMockRecorder {
+	return m.recorder
+}
+
+// DeferredMetadata mocks base method
+func (m *MockDeferredMetadataProvider) DeferredMetadata() ([]datastore.DeferredMetadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeferredMetadata")
+	ret0, _ := ret[0].([]datastore.DeferredMetadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeferredMetadata indicates an expected call of DeferredMetadata
+func (mr *MockDeferredMetadataProviderMockRecorder) DeferredMetadata() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeferredMetadata", reflect.TypeOf((*MockDeferredMetadataProvider)(nil).DeferredMetadata))
+}
+
+// DeleteDeferredMetadata mocks base method
+func (m *MockDeferredMetadataProvider) DeleteDeferredMetadata() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDeferredMetadata")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDeferredMetadata indicates an expected call of DeleteDeferredMetadata
+func (mr *MockDeferredMetadataProviderMockRecorder) DeleteDeferredMetadata() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDeferredMetadata", reflect.TypeOf((*MockDeferredMetadataProvider)(nil).DeleteDeferredMetadata))
+}
+
+// SaveDeferredMetadata mocks base method
+func (m *MockDeferredMetadataProvider) SaveDeferredMetadata(arg0 datastore.DeferredMetadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveDeferredMetadata", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveDeferredMetadata indicates an expected call of SaveDeferredMetadata
+func (mr *MockDeferredMetadataProviderMockRecorder) SaveDeferredMetadata(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDeferredMetadata", reflect.TypeOf((*MockDeferredMetadataProvider)(nil).SaveDeferredMetadata), arg0)
+}
+
+// MockRawFormatProvider is a mock of RawFormatProvider interface
+type MockRawFormatProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockRawFormatProviderMockRecorder
+}
+
+// MockRawFormatProviderMockRecorder is the mock recorder for MockRawFormatProvider
+type MockRawFormatProviderMockRecorder struct {
+	mock *MockRawFormatProvider
+}
+
+// NewMockRawFormatProvider creates a new mock instance
+func NewMockRawFormatProvider(ctrl *gomock.Controller) *MockRawFormatProvider {
+	mock := &MockRawFormatProvider{ctrl: ctrl}
+	mock.recorder = &MockRawFormatProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRawFormatProvider) EXPECT() *MockRawFormatProviderMockRecorder {
+	return m.recorder
+}
+
+// RawFormat mocks base method
+func (m *MockRawFormatProvider) RawFormat(arg0 string) (datastore.RawFormat, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RawFormat", arg0)
+	ret0, _ := ret[0].(datastore.RawFormat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RawFormat indicates an expected call of RawFormat
+func (mr *MockRawFormatProviderMockRecorder) RawFormat(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RawFormat", reflect.TypeOf((*MockRawFormatProvider)(nil).RawFormat), arg0)
+}
+
+// SaveRawFormat mocks base method
+func (m *MockRawFormatProvider) SaveRawFormat(arg0 datastore.RawFormat) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRawFormat", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRawFormat indicates an expected call of SaveRawFormat
+func (mr *MockRawFormatProviderMockRecorder) SaveRawFormat(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRawFormat", reflect.TypeOf((*MockRawFormatProvider)(nil).SaveRawFormat), arg0)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// Where the creation date of uploaded images is taken from. Piwigo stores the dates without a time zone and shows them
+// as they are.
+const (
+	// the date the photo was taken from the exif data, which is the time of the camera without a time zone. It is
+	// sent unchanged. Images without exif date get their file modification date.
+	DateCreationExif = "exif"
+	// the modification date of the file, which is a point in time and sent in the time zone of the server
+	DateCreationModTime = "mtime"
+)
+
+// the format of the dates in the exif data
+const exifDateFormat = "2006:01:02 15:04:05"
+
+func checkDateCreationSource(source string) error {
+	if source != "" && source != DateCreationExif && source != DateCreationModTime {
+		return errors.New(fmt.Sprintf("unknown source %s of the creation date. Use one of exif or mtime", source))
+	}
+	return nil
+}
+
+func addCreationDate(img datastore.ImageMetaData, options UploadOptions, infoUpdates *imageInfoUpdates, correlationId string, log *logrus.Entry) {
+	date, err := creationDate(img, options.DateCreationFrom, options.Timezone)
+	if err != nil {
+		log.Warnf("%s: could not read the creation date of image %d - %s", img.FullImagePath, img.PiwigoId, err)
+		return
+	}
+	if date.IsZero() {
+		return
+	}
+	update := piwigo.NewImageDetailsUpdate(img.PiwigoId, "", date, nil)
+	update.CorrelationId = correlationId
+	infoUpdates.add(update)
+}
+
+// Returns the creation date of the image or the zero time if the server keeps the date it read itself.
+func creationDate(img datastore.ImageMetaData, source string, zone *time.Location) (time.Time, error) {
+	switch source {
+	case DateCreationExif:
+		date, found, err := readExifDate(img.FullImagePath)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !found {
+			return serverDate(img.LastChange, zone), nil
+		}
+		return parseExifDate(date)
+	case DateCreationModTime:
+		return serverDate(img.LastChange, zone), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// Returns the date available of setDateAvailable, which is the date the photo was taken. It is the creation date of
+// dateCreationFrom or the exif date if no source is set, and the file modification date if neither is found.
+func availableDate(img datastore.ImageMetaData, options UploadOptions, log *logrus.Entry) time.Time {
+	source := options.DateCreationFrom
+	if source == "" {
+		source = DateCreationExif
+	}
+	date, err := creationDate(img, source, options.Timezone)
+	if err != nil {
+		log.Debugf("%s: could not read the date the photo was taken, using the modification date - %s", img.FullImagePath, err)
+	}
+	if err != nil || date.IsZero() {
+		return serverDate(img.LastChange, options.Timezone)
+	}
+	return date
+}
+
+// Parses the exif date as UTC, which keeps the time of the camera as it is. Converting it to a time zone would shift
+// it by the difference to the time zone of the camera or move a time skipped by a daylight saving time change.
+func parseExifDate(date string) (time.Time, error) {
+	date = strings.TrimRight(date, "\x00 ")
+	parsed, err := time.Parse(exifDateFormat, date)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("invalid exif date %s", date))
+	}
+	return parsed, nil
+}
+
+// Returns the time in the time zone the server interprets the dates in. Nil keeps the time zone of the date, which is
+// the local time zone for the dates of the files.
+func serverDate(date time.Time, zone *time.Location) time.Time {
+	if zone == nil {
+		return date
+	}
+	return date.In(zone)
+}
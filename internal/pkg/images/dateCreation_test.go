@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func sentCreationDate(date time.Time) string {
+	return piwigo.NewImageDetailsUpdate(1, "", date, nil).Fields.Get("date_creation")
+}
+
+func Test_creationDate_sends_the_modification_date_in_the_time_zone_across_daylight_saving_time(t *testing.T) {
+	zone, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		modified time.Time
+		expected string
+	}{
+		{time.Date(2020, 3, 29, 0, 30, 0, 0, time.UTC), "2020-03-29 01:30:00"},
+		// the clocks skip from 02:00 to 03:00
+		{time.Date(2020, 3, 29, 1, 30, 0, 0, time.UTC), "2020-03-29 03:30:00"},
+		{time.Date(2020, 10, 25, 0, 30, 0, 0, time.UTC), "2020-10-25 02:30:00"},
+		// the clocks go back from 03:00 to 02:00
+		{time.Date(2020, 10, 25, 1, 30, 0, 0, time.UTC), "2020-10-25 02:30:00"},
+		{time.Date(2020, 10, 25, 23, 30, 0, 0, time.UTC), "2020-10-26 00:30:00"},
+	}
+	for _, test := range tests {
+		img := datastore.ImageMetaData{FullImagePath: "/photos/a.jpg", LastChange: test.modified}
+		date, err := creationDate(img, DateCreationModTime, zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent := sentCreationDate(date); sent != test.expected {
+			t.Errorf("expected %s for %s but got %s", test.expected, test.modified, sent)
+		}
+	}
+}
+
+func Test_parseExifDate_keeps_the_time_of_the_camera(t *testing.T) {
+	// the time does not exist in central europe as the clocks skip it
+	date, err := parseExifDate("2020:03:29 02:30:00\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent := sentCreationDate(date); sent != "2020-03-29 02:30:00" {
+		t.Errorf("expected the exif date unchanged but got %s", sent)
+	}
+}
+
+func Test_creationDate_uses_the_modification_date_without_exif_date(t *testing.T) {
+	file, err := ioutil.TempFile("", "noexif*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_ = file.Close()
+
+	modified := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+	img := datastore.ImageMetaData{FullImagePath: file.Name(), LastChange: modified}
+	date, err := creationDate(img, DateCreationExif, time.FixedZone("UTC-5", -5*3600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent := sentCreationDate(date); sent != "2020-07-01 05:00:00" {
+		t.Errorf("expected the modification date in the time zone but got %s", sent)
+	}
+}
+
+func Test_creationDate_without_source_keeps_the_date_of_the_server(t *testing.T) {
+	date, err := creationDate(datastore.ImageMetaData{LastChange: time.Now()}, "", nil)
+	if err != nil || !date.IsZero() {
+		t.Errorf("expected no creation date but got %s - %v", date, err)
+	}
+}
+
+func Test_availableDate_uses_the_date_the_photo_was_taken(t *testing.T) {
+	file, err := ioutil.TempFile("", "exif*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(createJpegWithDateTime("2019:01:02 03:04:05"))
+	_ = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := datastore.ImageMetaData{FullImagePath: file.Name(), LastChange: time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)}
+	log := logrus.WithField("test", t.Name())
+	if sent := sentCreationDate(availableDate(img, UploadOptions{}, log)); sent != "2019-01-02 03:04:05" {
+		t.Errorf("expected the exif date but got %s", sent)
+	}
+	if sent := sentCreationDate(availableDate(img, UploadOptions{DateCreationFrom: DateCreationModTime}, log)); sent != "2020-07-01 10:00:00" {
+		t.Errorf("expected the modification date of dateCreationFrom but got %s", sent)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// Sets the metadata the upload saved with UploadOptions.DeferredMetadata: the date available and the missing
+// dimensions of all images are sent with as few requests as possible. Returns the images by category to choose the
+// covers and the contact sheets afterwards. The saved metadata is kept, the caller removes it once the whole metadata
+// phase completed, so a failing or interrupted phase is repeated by the next run.
+func ApplyDeferredMetadata(piwigoCtx piwigo.ImageApi, provider datastore.DeferredMetadataProvider, parallelRequests int) (*UploadedImages, error) {
+	logrus.Debug("Entering ApplyDeferredMetadata")
+	defer logrus.Debug("Leaving ApplyDeferredMetadata")
+
+	uploaded := NewUploadedImages()
+	metadata, err := provider.DeferredMetadata()
+	if err != nil {
+		return uploaded, err
+	}
+	if len(metadata) == 0 {
+		logrus.Info("No deferred metadata to set.")
+		return uploaded, nil
+	}
+	if parallelRequests <= 0 {
+		parallelRequests = 1
+	}
+
+	logrus.Infof("Setting the deferred metadata of %d images", len(metadata))
+	infoUpdates := &imageInfoUpdates{}
+	checks := make([]datastore.DeferredMetadata, 0)
+	for _, m := range metadata {
+		uploaded.add(m.CategoryPiwigoId, m.PiwigoId)
+		if !m.DateAvailable.IsZero() {
+			infoUpdates.add(piwigo.NewDateAvailableUpdate(m.PiwigoId, m.DateAvailable))
+		}
+		if m.Width > 0 || m.Filesize > 0 {
+			checks = append(checks, m)
+		}
+	}
+
+	err = addMissingDimensions(piwigoCtx, checks, infoUpdates, parallelRequests)
+	if err != nil {
+		return uploaded, err
+	}
+	return uploaded, infoUpdates.apply(piwigoCtx, parallelRequests)
+}
+
+// Requests the info of the images with the given number of parallel requests to add the dimensions the server is
+// missing. Images that got deleted on the server in the meantime are skipped.
+func addMissingDimensions(piwigoCtx piwigo.ImageApi, metadata []datastore.DeferredMetadata, infoUpdates *imageInfoUpdates, parallelRequests int) error {
+	queue := make(chan datastore.DeferredMetadata)
+	failures := make(chan error, len(metadata))
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range queue {
+				file := uploadedFile{width: m.Width, height: m.Height, filesize: m.Filesize}
+				update, missing, err := missingDimensionsUpdate(piwigoCtx, m.PiwigoId, file)
+				if errors.Is(err, piwigo.ErrorImageNotFound) {
+					logrus.Warnf("Image %d no longer exists on the server. Skipping its dimensions...", m.PiwigoId)
+					continue
+				}
+				if err != nil {
+					failures <- errors.New(fmt.Sprintf("could not check the dimensions of image %d - %s", m.PiwigoId, err))
+					continue
+				}
+				if missing {
+					infoUpdates.add(update)
+				}
+			}
+		}()
+	}
+
+	for _, m := range metadata {
+		queue <- m
+	}
+	close(queue)
+	wg.Wait()
+	close(failures)
+
+	// the first failure, nil if all requests succeeded
+	return <-failures
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_uploadImages_saves_the_deferred_metadata_instead_of_setting_it(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = dimensionsPng
+	img.LastChange = time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	deferredmock := NewMockDeferredMetadataProvider(mockCtrl)
+	expected := datastore.DeferredMetadata{PiwigoId: 5, CategoryPiwigoId: 2, DateAvailable: img.LastChange, Width: 7, Height: 5, Filesize: 1}
+	deferredmock.EXPECT().SaveDeferredMetadata(expected).Times(1).Return(nil)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, dimensionsPng, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GetImageInfo(gomock.Any()).Times(0)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), gomock.Any()).Times(0)
+
+	options := UploadOptions{NumberOfWorkers: 1, SetDateAvailable: true, SetDimensions: true, DeferredMetadata: deferredmock}
+	err := UploadImages(piwigomock, dbmock, options)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ApplyDeferredMetadata_sets_the_metadata_of_all_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dateAvailable := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	deferredmock := NewMockDeferredMetadataProvider(mockCtrl)
+	deferredmock.EXPECT().DeferredMetadata().Times(1).Return([]datastore.DeferredMetadata{
+		{PiwigoId: 5, CategoryPiwigoId: 2, DateAvailable: dateAvailable, Width: 7, Height: 5, Filesize: 1},
+		{PiwigoId: 6, CategoryPiwigoId: 3},
+		{PiwigoId: 8, CategoryPiwigoId: 3, Width: 7, Height: 5},
+	}, nil)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().GetImageInfo(5).Times(1).Return(&piwigo.ImageInfo{Id: 5, Filesize: 1}, nil)
+	piwigomock.EXPECT().GetImageInfo(8).Times(1).Return(nil, piwigo.ErrorImageNotFound)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), 2).Times(1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		expected := []piwigo.ImageInfoUpdate{piwigo.NewDateAvailableUpdate(5, dateAvailable), piwigo.NewDimensionsUpdate(5, 7, 5, 0)}
+		if !reflect.DeepEqual(updates, expected) {
+			t.Errorf("expected the updates %v but got %v", expected, updates)
+		}
+		return piwigo.ImageInfoUpdateResult{Updates: 2, Images: 1, Requests: 1}, nil
+	})
+
+	uploaded, err := ApplyDeferredMetadata(piwigomock, deferredmock, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(uploaded.categories(), []int{2, 3}) || !uploaded.contains(3, 6) {
+		t.Errorf("expected the images of both categories for the covers but got %v", uploaded.categories())
+	}
+}
+
+func Test_ApplyDeferredMetadata_fails_if_the_metadata_could_not_be_set(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	deferredmock := NewMockDeferredMetadataProvider(mockCtrl)
+	deferredmock.EXPECT().DeferredMetadata().Times(1).Return([]datastore.DeferredMetadata{
+		{PiwigoId: 5, CategoryPiwigoId: 2, DateAvailable: time.Now()},
+		{PiwigoId: 6, CategoryPiwigoId: 2, Width: 7, Height: 5},
+	}, nil)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().GetImageInfo(6).Times(1).Return(nil, errors.New("connection refused"))
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := ApplyDeferredMetadata(piwigomock, deferredmock, 1)
+	if err == nil {
+		t.Error("expected the failing request to fail the metadata phase")
+	}
+}
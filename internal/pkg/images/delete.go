@@ -6,12 +6,14 @@
 package images
 
 import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/confirm"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
 	"github.com/sirupsen/logrus"
 )
 
-func DeleteImages(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider) error {
+// Deletes the images that no longer exist locally. Deleting images on the server has to be confirmed by the prompt.
+func DeleteImages(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, prompt *confirm.Prompt) error {
 	logrus.Debug("Starting deleteImages")
 	defer logrus.Debug("Finished deleteImages successfully")
 
@@ -28,14 +30,21 @@ func DeleteImages(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMet
 	logrus.Infof("Deleting %d images from piwigo", len(images))
 
 	var piwigoIds []int = nil
+	var piwigoImages []string = nil
 	for _, img := range images {
 		if img.PiwigoId > 0 {
 			logrus.Tracef("Adding %d to deletable list", img.PiwigoId)
 			piwigoIds = append(piwigoIds, img.PiwigoId)
+			piwigoImages = append(piwigoImages, img.FullImagePath)
 		}
 	}
 
 	if len(piwigoIds) > 0 {
+		err = prompt.Confirm("Deleting images", piwigoImages)
+		if err != nil {
+			return err
+		}
+
 		err = piwigoCtx.DeleteImages(piwigoIds)
 		if err != nil {
 			return err
@@ -6,8 +6,11 @@
 package images
 
 import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/confirm"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
 	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -27,7 +30,7 @@ func Test_deleteImages_should_call_piwigo_and_remove_metadata(t *testing.T) {
 	piwigomock := NewMockImageApi(mockCtrl)
 	piwigomock.EXPECT().DeleteImages([]int{5}).Times(1).Return(nil)
 
-	err := DeleteImages(piwigomock, dbmock)
+	err := DeleteImages(piwigomock, dbmock, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -49,7 +52,7 @@ func Test_deleteImages_should_not_call_piwigo_for_not_uploaded_images_and_remove
 	piwigomock := NewMockImageApi(mockCtrl)
 	piwigomock.EXPECT().DeleteImages(gomock.Any()).Times(0)
 
-	err := DeleteImages(piwigomock, dbmock)
+	err := DeleteImages(piwigomock, dbmock, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -68,8 +71,31 @@ func Test_deleteImages_should_not_call_anything_if_no_images_are_marked_for_dele
 	piwigomock := NewMockImageApi(mockCtrl)
 	piwigomock.EXPECT().DeleteImages(gomock.Any()).Times(0)
 
-	err := DeleteImages(piwigomock, dbmock)
+	err := DeleteImages(piwigomock, dbmock, nil)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func Test_deleteImages_should_not_delete_anything_if_not_confirmed(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(5)
+	img.UploadRequired = false
+	img.DeleteRequired = true
+	images := []datastore.ImageMetaData{img}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToDelete().Times(1).Return(images, nil)
+	dbmock.EXPECT().DeleteMarkedImages().Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().DeleteImages(gomock.Any()).Times(0)
+
+	prompt := confirm.NewPrompt(strings.NewReader("no\n"), ioutil.Discard, true, false)
+	err := DeleteImages(piwigomock, dbmock, prompt)
+	if err != confirm.ErrorNotConfirmed {
+		t.Errorf("expected the deletion to be rejected but got %v", err)
+	}
+}
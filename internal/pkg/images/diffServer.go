@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// The comparison of a local file with the file of its image on the server.
+type ImageDiff struct {
+	PiwigoId   int
+	LocalPath  string
+	LocalSize  int64
+	LocalMd5   string
+	ServerSize int64
+	ServerMd5  string
+	// the offset of the first byte that differs, -1 if the files are equal
+	FirstDifference int64
+}
+
+func (d ImageDiff) Matches() bool {
+	return d.FirstDifference < 0
+}
+
+// Writes the sizes and the md5sums of both files and whether they match.
+func (d ImageDiff) Write(writer io.Writer) error {
+	result := "match"
+	if !d.Matches() {
+		result = fmt.Sprintf("mismatch, the files differ from byte %d", d.FirstDifference)
+	}
+	_, err := fmt.Fprintf(writer, "Image %d: %s\n  local:  %s, %d bytes, md5 %s\n  server: %d bytes, md5 %s\n",
+		d.PiwigoId, result, d.LocalPath, d.LocalSize, d.LocalMd5, d.ServerSize, d.ServerMd5)
+	return err
+}
+
+// Downloads the image from the server and compares it byte by byte with the local file. The target is either the
+// piwigo id of the image or the path of the local file, the other one is looked up in the local database.
+func DiffServerImage(imageApi piwigo.ImageApi, provider datastore.ImageMetadataProvider, target string) (ImageDiff, error) {
+	img, err := findDiffTarget(provider, target)
+	if err != nil {
+		return ImageDiff{}, err
+	}
+
+	file, err := localFileStructure.OpenFile(img.FullImagePath)
+	if err != nil {
+		return ImageDiff{}, err
+	}
+	defer file.Close()
+
+	comparer := newFileComparer(file)
+	serverHash := md5.New()
+	serverSize, err := imageApi.DownloadImage(img.PiwigoId, io.MultiWriter(serverHash, comparer))
+	if err != nil {
+		return ImageDiff{}, err
+	}
+	localSize, err := comparer.finish()
+	if err != nil {
+		return ImageDiff{}, err
+	}
+
+	diff := ImageDiff{
+		PiwigoId:        img.PiwigoId,
+		LocalPath:       img.FullImagePath,
+		LocalSize:       localSize,
+		LocalMd5:        fmt.Sprintf("%x", comparer.hash.Sum(nil)),
+		ServerSize:      serverSize,
+		ServerMd5:       fmt.Sprintf("%x", serverHash.Sum(nil)),
+		FirstDifference: comparer.firstDifference,
+	}
+	if diff.FirstDifference < 0 && localSize != serverSize {
+		// one file is the start of the other one
+		diff.FirstDifference = localSize
+		if serverSize < localSize {
+			diff.FirstDifference = serverSize
+		}
+	}
+	return diff, nil
+}
+
+func findDiffTarget(provider datastore.ImageMetadataProvider, target string) (datastore.ImageMetaData, error) {
+	piwigoId, err := strconv.Atoi(target)
+	if err != nil {
+		img, err := provider.ImageMetadata(target)
+		if err == datastore.ErrorRecordNotFound {
+			return img, errors.New(fmt.Sprintf("the file %s is not in the local database", target))
+		}
+		if err != nil {
+			return img, err
+		}
+		if img.PiwigoId <= 0 {
+			return img, errors.New(fmt.Sprintf("the file %s is not uploaded yet", target))
+		}
+		return img, nil
+	}
+
+	images, err := provider.ImageMetadataAll()
+	if err != nil {
+		return datastore.ImageMetaData{}, err
+	}
+	for _, img := range images {
+		if img.PiwigoId == piwigoId {
+			return img, nil
+		}
+	}
+	return datastore.ImageMetaData{}, errors.New(fmt.Sprintf("there is no local file of image %d in the local database", piwigoId))
+}
+
+// Compares the written bytes with the content of the local file and calculates the md5sum of the local file.
+type fileComparer struct {
+	local  *bufio.Reader
+	hash   hash.Hash
+	buffer []byte
+	// the number of bytes compared so far
+	offset          int64
+	firstDifference int64
+	localEnded      bool
+}
+
+func newFileComparer(local io.Reader) *fileComparer {
+	hash := md5.New()
+	return &fileComparer{local: bufio.NewReader(io.TeeReader(local, hash)), hash: hash, firstDifference: -1}
+}
+
+func (c *fileComparer) Write(serverBytes []byte) (int, error) {
+	if c.firstDifference >= 0 || c.localEnded {
+		return len(serverBytes), nil
+	}
+
+	if cap(c.buffer) < len(serverBytes) {
+		c.buffer = make([]byte, len(serverBytes))
+	}
+	localBytes := c.buffer[:len(serverBytes)]
+	read, err := io.ReadFull(c.local, localBytes)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.localEnded = true
+	} else if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < read; i++ {
+		if localBytes[i] != serverBytes[i] {
+			c.firstDifference = c.offset + int64(i)
+			break
+		}
+	}
+	c.offset += int64(read)
+	return len(serverBytes), nil
+}
+
+// Reads the rest of the local file to complete its md5sum. Returns the size of the local file.
+func (c *fileComparer) finish() (int64, error) {
+	rest, err := io.Copy(ioutil.Discard, c.local)
+	return c.offset + rest, err
+}
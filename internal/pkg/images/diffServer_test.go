@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"github.com/golang/mock/gomock"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_DiffServerImage(t *testing.T) {
+	local := []byte("the content of the local image")
+	tests := []struct {
+		name            string
+		server          string
+		firstDifference int64
+	}{
+		{"equal", string(local), -1},
+		{"changed byte", "the content of the LOCAL image", 19},
+		{"truncated on the server", "the content", 11},
+		{"longer on the server", string(local) + " and more", int64(len(local))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			file, err := ioutil.TempFile("", "diff*.jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = os.Remove(file.Name()) })
+			_, _ = file.Write(local)
+			_ = file.Close()
+
+			dbmock := NewMockImageMetadataProvider(mockCtrl)
+			dbmock.EXPECT().ImageMetadata(file.Name()).Return(datastore.ImageMetaData{PiwigoId: 5, FullImagePath: file.Name()}, nil)
+
+			piwigomock := NewMockImageApi(mockCtrl)
+			piwigomock.EXPECT().DownloadImage(5, gomock.Any()).DoAndReturn(func(piwigoId int, writer io.Writer) (int64, error) {
+				// small writes compare the file in several parts
+				return io.CopyBuffer(writer, strings.NewReader(tt.server), make([]byte, 4))
+			})
+
+			diff, err := DiffServerImage(piwigomock, dbmock, file.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff.FirstDifference != tt.firstDifference || diff.Matches() != (tt.firstDifference < 0) {
+				t.Errorf("expected the first difference at %d but got %d", tt.firstDifference, diff.FirstDifference)
+			}
+			if diff.LocalSize != int64(len(local)) || diff.ServerSize != int64(len(tt.server)) {
+				t.Errorf("unexpected sizes %d and %d", diff.LocalSize, diff.ServerSize)
+			}
+			if (diff.LocalMd5 == diff.ServerMd5) != (tt.firstDifference < 0) {
+				t.Errorf("unexpected md5sums %s and %s", diff.LocalMd5, diff.ServerMd5)
+			}
+		})
+	}
+}
+
+func Test_DiffServerImage_finds_the_local_file_by_piwigo_id(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{{PiwigoId: 4, FullImagePath: "other.jpg"}, {PiwigoId: 5, FullImagePath: dimensionsPng}}, nil)
+
+	content, err := ioutil.ReadFile(dimensionsPng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().DownloadImage(5, gomock.Any()).DoAndReturn(func(piwigoId int, writer io.Writer) (int64, error) {
+		return io.Copy(writer, bytes.NewReader(content))
+	})
+
+	diff, err := DiffServerImage(piwigomock, dbmock, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Matches() || diff.LocalPath != dimensionsPng || diff.LocalMd5 != diff.ServerMd5 {
+		t.Errorf("expected the fixture to match but got %+v", diff)
+	}
+}
+
+func Test_DiffServerImage_rejects_files_that_are_not_uploaded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadata("new.jpg").Return(datastore.ImageMetaData{FullImagePath: "new.jpg", UploadRequired: true}, nil)
+	dbmock.EXPECT().ImageMetadata("unknown.jpg").Return(datastore.ImageMetaData{}, datastore.ErrorRecordNotFound)
+	piwigomock := NewMockImageApi(mockCtrl)
+
+	for _, target := range []string{"new.jpg", "unknown.jpg"} {
+		_, err := DiffServerImage(piwigomock, dbmock, target)
+		if err == nil {
+			t.Errorf("expected an error for %s", target)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"image"
+)
+
+// The dimensions and the size of the file that got sent to the server. They differ from the local file if the image
+// got transformed before the upload.
+type uploadedFile struct {
+	width  int
+	height int
+	// in kilobytes like piwigo stores it
+	filesize int
+}
+
+// Reads the dimensions from the header of the file without decoding the pixels. Returns false for formats that can
+// not be decoded, e.g. raw files or videos.
+func readUploadedFile(filePath string, log *logrus.Entry) (uploadedFile, bool) {
+	width, height, err := imageDimensions(filePath)
+	if err == image.ErrFormat {
+		log.Debugf("%s: the dimensions of the format can not be read, leaving them to the server", filePath)
+		return uploadedFile{}, false
+	}
+	if err != nil {
+		log.Warnf("%s: could not read the dimensions of the image - %s", filePath, err)
+		return uploadedFile{}, false
+	}
+	return uploadedFile{width: width, height: height, filesize: int((fileSize(filePath) + 1023) / 1024)}, true
+}
+
+// Returns the update of the dimensions and the file size the server did not fill in itself after the upload, e.g. as
+// it could not read the format. The values the server already has are kept. Returns false if nothing is missing.
+func missingDimensionsUpdate(piwigoCtx piwigo.ImageApi, imageId int, file uploadedFile) (piwigo.ImageInfoUpdate, bool, error) {
+	info, err := piwigoCtx.GetImageInfo(imageId)
+	if err != nil {
+		return piwigo.ImageInfoUpdate{}, false, err
+	}
+
+	width, height, filesize := 0, 0, 0
+	if info.Width <= 0 || info.Height <= 0 {
+		width, height = file.width, file.height
+	}
+	if info.Filesize <= 0 {
+		filesize = file.filesize
+	}
+	if width == 0 && filesize == 0 {
+		return piwigo.ImageInfoUpdate{}, false, nil
+	}
+
+	logrus.Debugf("Setting the missing dimensions %dx%d and file size %d KB of image %d", width, height, filesize, imageId)
+	return piwigo.NewDimensionsUpdate(imageId, width, height, filesize), true, nil
+}
+
+func setMissingDimensions(piwigoCtx piwigo.ImageApi, imageId int, file uploadedFile, infoUpdates *imageInfoUpdates, correlationId string, log *logrus.Entry) {
+	update, missing, err := missingDimensionsUpdate(piwigoCtx, imageId, file)
+	if err != nil {
+		log.Warnf("could not check the dimensions of image %d - %s", imageId, err)
+		return
+	}
+	if missing {
+		update.CorrelationId = correlationId
+		infoUpdates.add(update)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// a png of 7x5 pixels and 83 bytes
+const dimensionsPng = "testdata/dimensions.png"
+
+func Test_readUploadedFile_reads_the_dimensions_of_the_fixture(t *testing.T) {
+	file, found := readUploadedFile(dimensionsPng, logrus.NewEntry(logrus.StandardLogger()))
+	if !found {
+		t.Fatal("expected the dimensions of the png to be read")
+	}
+	if file.width != 7 || file.height != 5 || file.filesize != 1 {
+		t.Errorf("expected 7x5 pixels and 1 KB but got %dx%d pixels and %d KB", file.width, file.height, file.filesize)
+	}
+}
+
+func Test_uploadImages_sets_the_missing_dimensions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = dimensionsPng
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, dimensionsPng, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GetImageInfo(5).Times(1).Return(&piwigo.ImageInfo{Id: 5, Filesize: 1}, nil)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), 1).Times(1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		// the file size is already known to the server
+		expected := piwigo.NewDimensionsUpdate(5, 7, 5, 0)
+		if len(updates) != 1 || !reflect.DeepEqual(updates[0].Fields, expected.Fields) {
+			t.Errorf("expected the update %v but got %v", expected, updates)
+		}
+		return piwigo.ImageInfoUpdateResult{Updates: 1, Images: 1, Requests: 1}, nil
+	})
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, SetDimensions: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_keeps_the_dimensions_of_the_server(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = dimensionsPng
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, dimensionsPng, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GetImageInfo(5).Times(1).Return(&piwigo.ImageInfo{Id: 5, Width: 7, Height: 5, Filesize: 1}, nil)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), gomock.Any()).Times(0)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, SetDimensions: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_skips_the_dimensions_of_unknown_formats(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dir, err := ioutil.TempDir("", "dimensionstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	rawFile := filepath.Join(dir, "image.cr2")
+	err = ioutil.WriteFile(rawFile, []byte("not an image the uploader can decode"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = rawFile
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, rawFile, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GetImageInfo(gomock.Any()).Times(0)
+
+	err = UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, SetDimensions: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
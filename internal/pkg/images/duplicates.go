@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"strings"
+)
+
+// An image with the same content in more than one category.
+type Duplicate struct {
+	Md5Sum     string   `json:"md5sum"`
+	Categories []string `json:"categories"`
+	Files      []string `json:"files"`
+}
+
+// Finds the local images whose content is in more than one category by their md5sum. Copies of an image in the same
+// category are not reported. Nothing is changed on the server or in the metadata store.
+func FindDuplicates(provider datastore.ImageMetadataProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator localFileStructure.ChecksumCalculator) []Duplicate {
+	logrus.Debug("Entering FindDuplicates")
+	defer logrus.Debug("Leaving FindDuplicates")
+
+	localImages, _ := collectLocalImages(provider, fileSystemNodes, checksumCalculator)
+
+	byMd5sum := make(map[string][]localImage)
+	for _, img := range localImages {
+		byMd5sum[img.md5sum] = append(byMd5sum[img.md5sum], img)
+	}
+
+	duplicates := make([]Duplicate, 0)
+	for md5sum, sameContent := range byMd5sum {
+		categories := make(map[string]bool)
+		files := make([]string, 0, len(sameContent))
+		for _, img := range sameContent {
+			categories[img.categoryKey] = true
+			files = append(files, img.path)
+		}
+		if len(categories) < 2 {
+			continue
+		}
+
+		duplicate := Duplicate{Md5Sum: md5sum, Categories: make([]string, 0, len(categories)), Files: files}
+		for categoryKey := range categories {
+			duplicate.Categories = append(duplicate.Categories, categoryKey)
+		}
+		sort.Strings(duplicate.Categories)
+		sort.Strings(duplicate.Files)
+		duplicates = append(duplicates, duplicate)
+	}
+
+	// the images in the most categories first, the others by their first file to get a stable output
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i].Categories) != len(duplicates[j].Categories) {
+			return len(duplicates[i].Categories) > len(duplicates[j].Categories)
+		}
+		return duplicates[i].Files[0] < duplicates[j].Files[0]
+	})
+	return duplicates
+}
+
+// Writes the duplicates as JSON or as a summary followed by the categories and files of each duplicate.
+func WriteDuplicates(writer io.Writer, duplicates []Duplicate, asJson bool) error {
+	if asJson {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(duplicates)
+	}
+
+	if len(duplicates) == 0 {
+		_, err := fmt.Fprintln(writer, "No image is in more than one category")
+		return err
+	}
+
+	affectedCategories := make(map[string]bool)
+	for _, duplicate := range duplicates {
+		for _, categoryKey := range duplicate.Categories {
+			affectedCategories[categoryKey] = true
+		}
+	}
+	_, err := fmt.Fprintf(writer, "%d images are in more than one category, %d categories are affected\n", len(duplicates), len(affectedCategories))
+	if err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		_, err = fmt.Fprintf(writer, "\n%s in %d categories: %s\n", duplicate.Md5Sum, len(duplicate.Categories), strings.Join(duplicate.Categories, ", "))
+		if err != nil {
+			return err
+		}
+		for _, file := range duplicate.Files {
+			if _, err = fmt.Fprintf(writer, "  %s\n", file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
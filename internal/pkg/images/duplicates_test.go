@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"encoding/json"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/golang/mock/gomock"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_FindDuplicates_reports_images_in_more_than_one_category(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	modTime := time.Date(2019, 01, 01, 00, 0, 0, 0, time.UTC)
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{
+		"2019":             {Key: "2019", Path: "2019", Name: "2019", IsDir: true},
+		"best":             {Key: "best", Path: "best", Name: "best", IsDir: true},
+		"2019/a.jpg":       {Key: "2019/a.jpg", Path: "2019/a.jpg", Name: "a.jpg", ModTime: modTime},
+		"best/a.jpg":       {Key: "best/a.jpg", Path: "best/a.jpg", Name: "a.jpg", ModTime: modTime},
+		"2019/b.jpg":       {Key: "2019/b.jpg", Path: "2019/b.jpg", Name: "b.jpg", ModTime: modTime},
+		"2019/b-copy.jpg":  {Key: "2019/b-copy.jpg", Path: "2019/b-copy.jpg", Name: "b-copy.jpg", ModTime: modTime},
+		"best/c.jpg":       {Key: "best/c.jpg", Path: "best/c.jpg", Name: "c.jpg", ModTime: modTime},
+		"2019/unknown.jpg": {Key: "2019/unknown.jpg", Path: "2019/unknown.jpg", Name: "unknown.jpg", ModTime: modTime},
+	}
+
+	stored := map[string]string{"2019/a.jpg": "a", "best/a.jpg": "a", "2019/b.jpg": "b", "2019/b-copy.jpg": "b", "best/c.jpg": "c"}
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadata(gomock.Any()).AnyTimes().DoAndReturn(func(path string) (datastore.ImageMetaData, error) {
+		md5sum, found := stored[path]
+		if !found {
+			return datastore.ImageMetaData{}, datastore.ErrorRecordNotFound
+		}
+		return datastore.ImageMetaData{Md5Sum: md5sum, LastChange: modTime}, nil
+	})
+	checksumCalculator := func(filePath string) (string, string, error) {
+		return "c", "c", nil
+	}
+
+	duplicates := FindDuplicates(db, fileSystemNodes, checksumCalculator)
+
+	expected := []Duplicate{
+		{Md5Sum: "a", Categories: []string{"2019", "best"}, Files: []string{"2019/a.jpg", "best/a.jpg"}},
+		{Md5Sum: "c", Categories: []string{"2019", "best"}, Files: []string{"2019/unknown.jpg", "best/c.jpg"}},
+	}
+	if !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("unexpected duplicates %+v", duplicates)
+	}
+}
+
+func Test_WriteDuplicates_writes_summary_and_json(t *testing.T) {
+	duplicates := []Duplicate{{Md5Sum: "a", Categories: []string{"2019", "best"}, Files: []string{"2019/a.jpg", "best/a.jpg"}}}
+
+	text := &bytes.Buffer{}
+	err := WriteDuplicates(text, duplicates, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "1 images are in more than one category, 2 categories are affected") || !strings.Contains(text.String(), "a in 2 categories: 2019, best") {
+		t.Errorf("unexpected summary %s", text.String())
+	}
+
+	asJson := &bytes.Buffer{}
+	err = WriteDuplicates(asJson, duplicates, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Duplicate
+	if err = json.Unmarshal(asJson.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, duplicates) {
+		t.Errorf("unexpected json %s - %v", asJson.String(), err)
+	}
+}
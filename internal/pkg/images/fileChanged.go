@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// Policies how to handle images that changed after their md5sum got calculated, e.g. as a camera is still writing them.
+const (
+	// the image is skipped and uploaded on the next run
+	FileChangedSkip = "skip"
+	// the md5sum is calculated again and the image gets uploaded
+	FileChangedRetry = "retry"
+	// the upload is stopped
+	FileChangedError = "error"
+)
+
+const fileChangedReason = "the file changed after its md5sum got calculated"
+
+// Remembers the first error that stops all upload workers. The workers drain the queue afterwards.
+type uploadAbort struct {
+	mutex sync.Mutex
+	err   error
+}
+
+func (a *uploadAbort) set(err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+func (a *uploadAbort) get() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.err
+}
+
+func checkFileChangedPolicy(policy string) error {
+	if policy != "" && policy != FileChangedSkip && policy != FileChangedRetry && policy != FileChangedError {
+		return errors.New(fmt.Sprintf("unknown file changed policy %s. Use one of skip, retry or error", policy))
+	}
+	return nil
+}
+
+// The server rejects an upload if the content does not match the md5sum, so the modification date is compared with
+// the one of the md5sum calculation. Images whose file can not be read are not considered as changed.
+func fileChangedSinceHashing(img datastore.ImageMetaData) bool {
+	fileInfo, err := localFileStructure.Stat(img.FullImagePath)
+	if err != nil {
+		return false
+	}
+	return !fileInfo.ModTime().Equal(img.LastChange)
+}
+
+// Handles an image that changed since its md5sum got calculated according to the OnFileChanged policy. Returns true if
+// the image is uploaded. The returned error stops the upload of all images.
+func handleChangedFile(img *datastore.ImageMetaData, options UploadOptions, log *logrus.Entry) (bool, error) {
+	if options.OnFileChanged == "" || !fileChangedSinceHashing(*img) {
+		return true, nil
+	}
+
+	// changed files get rejected by the server with a confusing message, so this is logged before anything is sent
+	log.Warnf("%s: %s. This is not an error of the server.", img.FullImagePath, fileChangedReason)
+
+	switch options.OnFileChanged {
+	case FileChangedRetry:
+		err := rehashChangedFile(img, options, log)
+		if err != nil {
+			log.Warnf("%s: could not calculate the md5sum of the changed file - %s. Skipping...", img.FullImagePath, err)
+			options.Report.AddFailed(img.FullImagePath, err.Error())
+			return false, nil
+		}
+		return true, nil
+	case FileChangedError:
+		options.Report.AddFailed(img.FullImagePath, fileChangedReason)
+		return false, errors.New(fmt.Sprintf("%s: %s. Stopping the upload", img.FullImagePath, fileChangedReason))
+	default:
+		log.Warnf("%s: Skipping the image, it gets uploaded on the next run.", img.FullImagePath)
+		options.Report.AddSkipped(img.FullImagePath, fileChangedReason)
+		return false, nil
+	}
+}
+
+func rehashChangedFile(img *datastore.ImageMetaData, options UploadOptions, log *logrus.Entry) error {
+	fileInfo, err := localFileStructure.Stat(img.FullImagePath)
+	if err != nil {
+		return err
+	}
+	md5sum, checksum, err := options.ChecksumCalculator(img.FullImagePath)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("%s: Uploading the changed file with the new md5sum %s", img.FullImagePath, md5sum)
+	img.Md5Sum = md5sum
+	img.Checksum = checksum
+	img.LastChange = fileInfo.ModTime()
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"github.com/golang/mock/gomock"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_uploadImages_uploads_unchanged_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = createTestFileOfSize(t, 1024)
+	img.LastChange = fileModTime(t, img.FullImagePath)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, OnFileChanged: FileChangedError, Report: report.NewReport()})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_skips_changed_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createChangedTestImage(t)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, OnFileChanged: FileChangedSkip, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(uploadReport.Skipped()) != 1 {
+		t.Errorf("The changed image should be reported as skipped")
+	}
+}
+
+func Test_uploadImages_uploads_changed_files_with_new_md5sum(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createChangedTestImage(t)
+
+	imgToSave := img
+	imgToSave.Md5Sum = "5678"
+	imgToSave.Checksum = "md5:5678"
+	imgToSave.LastChange = fileModTime(t, img.FullImagePath)
+	imgToSave.PiwigoId = 5
+	imgToSave.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "5678", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	options := UploadOptions{
+		NumberOfWorkers: 1,
+		OnFileChanged:   FileChangedRetry,
+		ChecksumCalculator: func(filePath string) (string, string, error) {
+			return "5678", "md5:5678", nil
+		},
+		Report: report.NewReport(),
+	}
+	err := UploadImages(piwigomock, dbmock, options)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_stops_on_changed_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createChangedTestImage(t)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, OnFileChanged: FileChangedError, Report: uploadReport})
+	if err == nil {
+		t.Error("Expected an error as the image changed")
+	}
+	if len(uploadReport.Failed()) != 1 {
+		t.Errorf("The changed image should be reported as failed")
+	}
+}
+
+func Test_uploadImages_fails_on_unknown_file_changed_policy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{}, nil)
+
+	err := UploadImages(NewMockImageApi(mockCtrl), dbmock, UploadOptions{NumberOfWorkers: 1, OnFileChanged: "ignore"})
+	if err == nil {
+		t.Error("Expected an error as the policy is unknown")
+	}
+}
+
+// Creates an image whose file got modified after the md5sum got calculated.
+func createChangedTestImage(t *testing.T) datastore.ImageMetaData {
+	img := createTestImageMetaData(0)
+	img.FullImagePath = createTestFileOfSize(t, 1024)
+	img.LastChange = fileModTime(t, img.FullImagePath).Add(-time.Minute)
+	return img
+}
+
+func fileModTime(t *testing.T, filePath string) time.Time {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileInfo.ModTime()
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// Collects the info updates of the uploaded images to send them together after all uploads finished instead of one
+// request per image between the uploads.
+type imageInfoUpdates struct {
+	mutex   sync.Mutex
+	updates []piwigo.ImageInfoUpdate
+	// the keywords of all images are resolved to tags at once before the updates are sent
+	iptc []iptcInfo
+}
+
+func (infoUpdates *imageInfoUpdates) add(update piwigo.ImageInfoUpdate) {
+	infoUpdates.mutex.Lock()
+	defer infoUpdates.mutex.Unlock()
+	infoUpdates.updates = append(infoUpdates.updates, update)
+}
+
+func (infoUpdates *imageInfoUpdates) addIptc(info iptcInfo) {
+	infoUpdates.mutex.Lock()
+	defer infoUpdates.mutex.Unlock()
+	infoUpdates.iptc = append(infoUpdates.iptc, info)
+}
+
+// Drops the updates of the images that got deleted again.
+func (infoUpdates *imageInfoUpdates) remove(piwigoIds map[int]bool) {
+	if len(piwigoIds) == 0 {
+		return
+	}
+	infoUpdates.mutex.Lock()
+	defer infoUpdates.mutex.Unlock()
+
+	updates := infoUpdates.updates[:0]
+	for _, update := range infoUpdates.updates {
+		if !piwigoIds[update.PiwigoId] {
+			updates = append(updates, update)
+		}
+	}
+	infoUpdates.updates = updates
+	iptc := infoUpdates.iptc[:0]
+	for _, info := range infoUpdates.iptc {
+		if !piwigoIds[info.piwigoId] {
+			iptc = append(iptc, info)
+		}
+	}
+	infoUpdates.iptc = iptc
+}
+
+// Sends the collected updates. Failing updates are only logged as the images got uploaded anyway, the error is
+// returned for the callers that repeat them.
+func (infoUpdates *imageInfoUpdates) apply(piwigoCtx piwigo.ImageApi, parallelRequests int) error {
+	infoUpdates.resolveIptc(piwigoCtx)
+	if len(infoUpdates.updates) == 0 {
+		return nil
+	}
+
+	result, err := piwigoCtx.UpdateImagesInfo(infoUpdates.updates, parallelRequests)
+	if err != nil {
+		logrus.Warnf("Could not update the info of all uploaded images - %s", err)
+	}
+	logrus.Infof("Updated the info of %d images with %d requests, %d requests saved by merging %d updates", result.Images, result.Requests, result.Updates-result.Requests, result.Updates)
+	return err
+}
+
+// Turns the IPTC fields into updates. If the tags can not be created, the name and the comment are set anyway.
+func (infoUpdates *imageInfoUpdates) resolveIptc(piwigoCtx piwigo.ImageApi) {
+	if len(infoUpdates.iptc) == 0 {
+		return
+	}
+
+	var keywords []string
+	for _, info := range infoUpdates.iptc {
+		keywords = append(keywords, info.iptc.Keywords...)
+	}
+	tagIds, err := piwigoCtx.GetOrCreateTags(keywords)
+	if err != nil {
+		logrus.Warnf("Could not create the tags of the IPTC keywords - %s", err)
+	}
+	for _, info := range infoUpdates.iptc {
+		infoUpdates.updates = append(infoUpdates.updates, newIptcUpdates(info, tagIds)...)
+	}
+	infoUpdates.iptc = nil
+}
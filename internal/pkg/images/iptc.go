@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/transform"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// The IPTC fields of an uploaded image that are set once the keywords got resolved to tags.
+type iptcInfo struct {
+	piwigoId      int
+	correlationId string
+	iptc          transform.Iptc
+}
+
+// Reads the IPTC fields of the uploaded image to set them as name, comment and tags. Images without IPTC data keep
+// what the server read from the file. A unique name replaces the ObjectName. Returns false if the image has no IPTC
+// data.
+func addIptcInfo(img datastore.ImageMetaData, uniqueName string, infoUpdates *imageInfoUpdates, correlationId string, log *logrus.Entry) bool {
+	iptc, found, err := readIptc(img.FullImagePath)
+	if err != nil {
+		log.Warnf("%s: could not read the IPTC data - %s", img.FullImagePath, err)
+		return false
+	}
+	if !found {
+		log.Debugf("%s: the image has no IPTC data", img.FullImagePath)
+		return false
+	}
+	if uniqueName != "" {
+		iptc.Name = uniqueName
+	}
+	infoUpdates.addIptc(iptcInfo{piwigoId: img.PiwigoId, correlationId: correlationId, iptc: iptc})
+	return true
+}
+
+// Returns the update of the name, the comment and the tags. The ObjectName replaces the name piwigo derived from the
+// file name and the Caption-Abstract the comment. The keywords are added to the existing tags of the image.
+func newIptcUpdates(info iptcInfo, tagIds map[string]int) []piwigo.ImageInfoUpdate {
+	ids := make([]int, 0, len(info.iptc.Keywords))
+	for _, keyword := range info.iptc.Keywords {
+		if id, found := tagIds[keyword]; found {
+			ids = append(ids, id)
+		}
+	}
+	details := piwigo.NewImageDetailsUpdate(info.piwigoId, info.iptc.Name, time.Time{}, ids)
+	details.CorrelationId = info.correlationId
+	comment := piwigo.NewCommentUpdate(info.piwigoId, info.iptc.Caption)
+	comment.CorrelationId = info.correlationId
+	return []piwigo.ImageInfoUpdate{details, comment}
+}
+
+func readIptc(filePath string) (transform.Iptc, bool, error) {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return transform.Iptc{}, false, err
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(file, exifDateReadLimit))
+	if err != nil {
+		return transform.Iptc{}, false, err
+	}
+	iptc, found, err := transform.ReadIptc(content)
+	if err == transform.ErrorUnsupportedFormat {
+		return transform.Iptc{}, false, nil
+	}
+	if err != nil && len(content) == exifDateReadLimit {
+		// the IPTC data follows the exif data, which may be larger than expected
+		content, err = readWholeFile(filePath)
+		if err != nil {
+			return transform.Iptc{}, false, err
+		}
+		return transform.ReadIptc(content)
+	}
+	return iptc, found, err
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Writes the header of a jpeg whose APP13 segment holds the given IPTC datasets of the application record.
+func createIptcJpeg(t *testing.T, datasets map[byte][]string) string {
+	records := bytes.Buffer{}
+	for _, dataset := range []byte{5, 25, 120} {
+		for _, value := range datasets[dataset] {
+			records.Write([]byte{0x1C, 2, dataset})
+			_ = binary.Write(&records, binary.BigEndian, uint16(len(value)))
+			records.WriteString(value)
+		}
+	}
+	payload := bytes.Buffer{}
+	payload.WriteString("Photoshop 3.0\x008BIM\x04\x04\x00\x00")
+	_ = binary.Write(&payload, binary.BigEndian, uint32(records.Len()))
+	payload.Write(records.Bytes())
+
+	content := bytes.Buffer{}
+	content.Write([]byte{0xFF, 0xD8, 0xFF, 0xED})
+	_ = binary.Write(&content, binary.BigEndian, uint16(payload.Len()+2))
+	content.Write(payload.Bytes())
+	content.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+
+	file, err := ioutil.TempFile("", "iptc*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+	_, _ = file.Write(content.Bytes())
+	_ = file.Close()
+	return file.Name()
+}
+
+func Test_uploadImages_sets_the_iptc_metadata(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = createIptcJpeg(t, map[byte][]string{5: {"Eiffel Tower"}, 25: {"Paris", "Night"}, 120: {"The tower at night"}})
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GetOrCreateTags([]string{"Paris", "Night"}).Times(1).Return(map[string]int{"Paris": 3, "Night": 7}, nil)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), 1).Times(1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		fields := make(map[string]string)
+		for _, update := range updates {
+			if update.PiwigoId != 5 {
+				t.Errorf("expected an update of image 5 but got %d", update.PiwigoId)
+			}
+			for key := range update.Fields {
+				fields[key] = update.Fields.Get(key)
+			}
+		}
+		if fields["name"] != "Eiffel Tower" || fields["comment"] != "The tower at night" || fields["tag_ids"] != "3,7" {
+			t.Errorf("unexpected fields %v", fields)
+		}
+		return piwigo.ImageInfoUpdateResult{Updates: len(updates), Images: 1, Requests: 1}, nil
+	})
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MetadataFromIptc: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_keeps_the_metadata_of_images_without_iptc(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = dimensionsPng
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, dimensionsPng, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GetOrCreateTags(gomock.Any()).Times(0)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), gomock.Any()).Times(0)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MetadataFromIptc: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
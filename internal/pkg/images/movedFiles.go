@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync"
+)
+
+// Detects new files that are known files moved to another path, so they are neither hashed nor uploaded again.
+// A file counts as moved only if exactly one known image has the same device, inode, size and modification date and
+// its old path no longer exists. In every other case the file is hashed like a new file. A known image is claimed by
+// at most one new file, e.g. if the file got hard linked to two new paths before the old one got removed.
+type moveDetector struct {
+	enabled bool
+	mutex   sync.Mutex
+	claimed map[int]bool
+}
+
+func newMoveDetector(enabled bool) *moveDetector {
+	return &moveDetector{enabled: enabled, claimed: make(map[int]bool)}
+}
+
+// Returns the metadata of the known image moved to the new file. The metadata of the new file has to contain its
+// path and category.
+func (detector *moveDetector) movedFile(imageDb datastore.ImageMetadataProvider, file *localFileStructure.FilesystemNode, metadata datastore.ImageMetaData) (datastore.ImageMetaData, bool) {
+	if !detector.enabled || file.FileId == "" || file.Size <= 0 || metadata.CategoryPiwigoId <= 0 {
+		return metadata, false
+	}
+
+	candidates, err := imageDb.ImageMetadataByFileId(file.FileId)
+	if err != nil {
+		logrus.Warnf("Could not look up the moved files of %s, calculating its checksum - %s", file.Path, err)
+		return metadata, false
+	}
+
+	var moved []datastore.ImageMetaData
+	for _, candidate := range candidates {
+		if candidate.FullImagePath == file.Path || candidate.Md5Sum == "" || candidate.FileSize != file.Size || !candidate.LastChange.Equal(file.ModTime) {
+			continue
+		}
+		if _, err = localFileStructure.Stat(candidate.FullImagePath); !os.IsNotExist(err) {
+			// the old path still exists or can not be checked, e.g. a hard link
+			continue
+		}
+		moved = append(moved, candidate)
+	}
+	if len(moved) != 1 {
+		if len(moved) > 1 {
+			logrus.Debugf("%s matches %d moved files, calculating its checksum", file.Path, len(moved))
+		}
+		return metadata, false
+	}
+
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+	if detector.claimed[moved[0].ImageId] {
+		logrus.Debugf("%s already got moved to another file, calculating the checksum of %s", moved[0].FullImagePath, file.Path)
+		return metadata, false
+	}
+	detector.claimed[moved[0].ImageId] = true
+
+	logrus.Infof("%s got moved to %s", moved[0].FullImagePath, file.Path)
+	return moveImageMetadata(moved[0], metadata), true
+}
+
+// Assigns the known image to the path and category of the new file. An uploaded image remembers the category it got
+// moved away from until the category got updated on the server.
+func moveImageMetadata(known datastore.ImageMetaData, metadata datastore.ImageMetaData) datastore.ImageMetaData {
+	moved := known
+	moved.FullImagePath = metadata.FullImagePath
+	moved.Filename = metadata.Filename
+	moved.CategoryPath = metadata.CategoryPath
+	moved.CategoryPiwigoId = metadata.CategoryPiwigoId
+	moved.DeleteRequired = false
+
+	if moved.PiwigoId > 0 && known.CategoryPiwigoId != moved.CategoryPiwigoId && moved.PreviousCategoryPiwigoId == 0 {
+		moved.PreviousCategoryPiwigoId = known.CategoryPiwigoId
+	}
+	if moved.PreviousCategoryPiwigoId == moved.CategoryPiwigoId {
+		// moved back before the server got updated
+		moved.PreviousCategoryPiwigoId = 0
+	}
+	return moved
+}
+
+// Moves the images that got moved locally to their new category on the server. The image keeps all other categories,
+// the category it got moved away from is kept as well if another local file still uses the image in it.
+func UpdateMovedImages(piwigoCtx piwigo.ImageApi, provider datastore.ImageMetadataProvider) error {
+	logrus.Debug("Entering UpdateMovedImages")
+	defer logrus.Debug("Leaving UpdateMovedImages")
+
+	images, err := provider.ImageMetadataMoved()
+	if err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		logrus.Debug("There are no moved images to update on the server.")
+		return nil
+	}
+
+	all, err := provider.ImageMetadataAll()
+	if err != nil {
+		return err
+	}
+	usedCategories := make(map[int]map[int]bool)
+	for _, img := range all {
+		if img.PiwigoId == 0 || img.DeleteRequired {
+			continue
+		}
+		if usedCategories[img.PiwigoId] == nil {
+			usedCategories[img.PiwigoId] = make(map[int]bool)
+		}
+		usedCategories[img.PiwigoId][img.CategoryPiwigoId] = true
+	}
+
+	logrus.Infof("Updating the category of %d moved images", len(images))
+	for _, img := range images {
+		if img.PiwigoId > 0 {
+			info, err := piwigoCtx.GetImageInfo(img.PiwigoId)
+			if errors.Is(err, piwigo.ErrorImageNotFound) {
+				// reconcileExisting uploads the image again to its new category
+				logrus.Warnf("%s: the moved image %d no longer exists on the server", img.FullImagePath, img.PiwigoId)
+				img.PreviousCategoryPiwigoId = 0
+				err = provider.SaveImageMetadata(img)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			categories := movedImageCategories(info.CategoryIds, img, usedCategories[img.PiwigoId])
+			logrus.Debugf("%s: moving image %d from category %d to %d", img.FullImagePath, img.PiwigoId, img.PreviousCategoryPiwigoId, img.CategoryPiwigoId)
+			_, err = piwigoCtx.UpdateImagesInfo([]piwigo.ImageInfoUpdate{piwigo.NewCategoriesUpdate(img.PiwigoId, categories)}, 1)
+			if err != nil {
+				return err
+			}
+		}
+
+		img.PreviousCategoryPiwigoId = 0
+		err = provider.SaveImageMetadata(img)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The categories of the image after the move, in the order of the server with the new category appended.
+func movedImageCategories(serverCategories []int, img datastore.ImageMetaData, usedCategories map[int]bool) []int {
+	categories := make([]int, 0, len(serverCategories)+1)
+	containsNew := false
+	for _, categoryId := range serverCategories {
+		if categoryId == img.PreviousCategoryPiwigoId && !usedCategories[categoryId] {
+			continue
+		}
+		if categoryId == img.CategoryPiwigoId {
+			containsNew = true
+		}
+		categories = append(categories, categoryId)
+	}
+	if !containsNew {
+		categories = append(categories, img.CategoryPiwigoId)
+	}
+	return categories
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_movedFile_takes_over_the_metadata_of_the_moved_file(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	modTime := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	file := &localFileStructure.FilesystemNode{Key: "2020/b.jpg", Path: "/images/2020/b.jpg", Name: "b.jpg", ModTime: modTime, Size: 2048, FileId: "1:42"}
+	known := datastore.ImageMetaData{ImageId: 3, PiwigoId: 7, FullImagePath: "/nonexisting/2019/a.jpg", Filename: "a.jpg", Md5Sum: "1234", CategoryPath: "2019", CategoryPiwigoId: 2, LastChange: modTime, FileSize: 2048, FileId: "1:42"}
+
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadataByFileId("1:42").Times(2).Return([]datastore.ImageMetaData{known}, nil)
+
+	detector := newMoveDetector(true)
+	moved, found := detector.movedFile(db, file, datastore.ImageMetaData{FullImagePath: file.Path, Filename: file.Name, CategoryPath: "2020", CategoryPiwigoId: 4})
+	if !found {
+		t.Fatal("expected the file to be detected as moved")
+	}
+	if moved.ImageId != 3 || moved.PiwigoId != 7 || moved.Md5Sum != "1234" || moved.FullImagePath != file.Path || moved.Filename != "b.jpg" || moved.CategoryPiwigoId != 4 || moved.PreviousCategoryPiwigoId != 2 {
+		t.Errorf("unexpected metadata of the moved file %v", moved)
+	}
+
+	_, found = detector.movedFile(db, &localFileStructure.FilesystemNode{Path: "/images/2021/b.jpg", ModTime: modTime, Size: 2048, FileId: "1:42"}, datastore.ImageMetaData{CategoryPiwigoId: 5})
+	if found {
+		t.Error("a moved file must only be taken over by a single new file")
+	}
+}
+
+func Test_movedFile_hashes_the_file_if_it_is_uncertain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "movedFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	existing := filepath.Join(dir, "a.jpg")
+	err = ioutil.WriteFile(existing, []byte("a"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	known := datastore.ImageMetaData{ImageId: 3, PiwigoId: 7, FullImagePath: "/nonexisting/2019/a.jpg", Md5Sum: "1234", CategoryPiwigoId: 2, LastChange: modTime, FileSize: 2048, FileId: "1:42"}
+	otherSize := known
+	otherSize.FileSize = 1024
+	otherDate := known
+	otherDate.LastChange = modTime.Add(time.Second)
+	oldPathExists := known
+	oldPathExists.FullImagePath = existing
+	second := known
+	second.ImageId = 4
+	second.FullImagePath = "/nonexisting/2019/c.jpg"
+
+	tests := []struct {
+		name       string
+		candidates []datastore.ImageMetaData
+	}{
+		{"size changed", []datastore.ImageMetaData{otherSize}},
+		{"modification date changed", []datastore.ImageMetaData{otherDate}},
+		{"old path exists", []datastore.ImageMetaData{oldPathExists}},
+		{"several candidates", []datastore.ImageMetaData{known, second}},
+		{"no candidate", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			db := NewMockImageMetadataProvider(mockCtrl)
+			db.EXPECT().ImageMetadataByFileId("1:42").Times(1).Return(tt.candidates, nil)
+
+			file := &localFileStructure.FilesystemNode{Path: "/images/2020/b.jpg", ModTime: modTime, Size: 2048, FileId: "1:42"}
+			_, found := newMoveDetector(true).movedFile(db, file, datastore.ImageMetaData{CategoryPiwigoId: 4})
+			if found {
+				t.Error("expected the file to be hashed")
+			}
+		})
+	}
+}
+
+func Test_movedFile_is_disabled_by_default(t *testing.T) {
+	file := &localFileStructure.FilesystemNode{Path: "/images/2020/b.jpg", Size: 2048, FileId: "1:42"}
+	_, found := newMoveDetector(false).movedFile(nil, file, datastore.ImageMetaData{CategoryPiwigoId: 4})
+	if found {
+		t.Error("expected no moved files if the detection is disabled")
+	}
+}
+
+func Test_moveImageMetadata_clears_the_previous_category_if_moved_back(t *testing.T) {
+	known := datastore.ImageMetaData{PiwigoId: 7, CategoryPiwigoId: 4, PreviousCategoryPiwigoId: 2}
+	moved := moveImageMetadata(known, datastore.ImageMetaData{CategoryPiwigoId: 2})
+	if moved.PreviousCategoryPiwigoId != 0 {
+		t.Errorf("expected no pending move but got the previous category %d", moved.PreviousCategoryPiwigoId)
+	}
+
+	notUploaded := datastore.ImageMetaData{CategoryPiwigoId: 2}
+	moved = moveImageMetadata(notUploaded, datastore.ImageMetaData{CategoryPiwigoId: 4})
+	if moved.PreviousCategoryPiwigoId != 0 {
+		t.Errorf("an image that is not uploaded has no category to update but got %d", moved.PreviousCategoryPiwigoId)
+	}
+}
+
+func Test_UpdateMovedImages_replaces_the_previous_category(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	moved := datastore.ImageMetaData{ImageId: 1, PiwigoId: 7, FullImagePath: "/2020/b.jpg", CategoryPiwigoId: 4, PreviousCategoryPiwigoId: 2}
+	sharedMoved := datastore.ImageMetaData{ImageId: 2, PiwigoId: 8, FullImagePath: "/2020/c.jpg", CategoryPiwigoId: 4, PreviousCategoryPiwigoId: 2}
+	sharedCopy := datastore.ImageMetaData{ImageId: 3, PiwigoId: 8, FullImagePath: "/2019/c.jpg", CategoryPiwigoId: 2}
+
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadataMoved().Times(1).Return([]datastore.ImageMetaData{moved, sharedMoved}, nil)
+	db.EXPECT().ImageMetadataAll().Times(1).Return([]datastore.ImageMetaData{moved, sharedMoved, sharedCopy}, nil)
+	movedSaved := moved
+	movedSaved.PreviousCategoryPiwigoId = 0
+	sharedSaved := sharedMoved
+	sharedSaved.PreviousCategoryPiwigoId = 0
+	db.EXPECT().SaveImageMetadata(movedSaved).Times(1)
+	db.EXPECT().SaveImageMetadata(sharedSaved).Times(1)
+
+	piwigoMock := NewMockImageApi(mockCtrl)
+	piwigoMock.EXPECT().GetImageInfo(7).Times(1).Return(&piwigo.ImageInfo{Id: 7, CategoryIds: []int{2, 9}}, nil)
+	piwigoMock.EXPECT().GetImageInfo(8).Times(1).Return(&piwigo.ImageInfo{Id: 8, CategoryIds: []int{2}}, nil)
+	piwigoMock.EXPECT().UpdateImagesInfo([]piwigo.ImageInfoUpdate{piwigo.NewCategoriesUpdate(7, []int{9, 4})}, 1).Times(1)
+	piwigoMock.EXPECT().UpdateImagesInfo([]piwigo.ImageInfoUpdate{piwigo.NewCategoriesUpdate(8, []int{2, 4})}, 1).Times(1)
+
+	err := UpdateMovedImages(piwigoMock, db)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UpdateMovedImages_forgets_the_move_of_deleted_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	moved := datastore.ImageMetaData{ImageId: 1, PiwigoId: 7, FullImagePath: "/2020/b.jpg", CategoryPiwigoId: 4, PreviousCategoryPiwigoId: 2}
+	saved := moved
+	saved.PreviousCategoryPiwigoId = 0
+
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadataMoved().Times(1).Return([]datastore.ImageMetaData{moved}, nil)
+	db.EXPECT().ImageMetadataAll().Times(1).Return([]datastore.ImageMetaData{moved}, nil)
+	db.EXPECT().SaveImageMetadata(saved).Times(1)
+
+	piwigoMock := NewMockImageApi(mockCtrl)
+	piwigoMock.EXPECT().GetImageInfo(7).Times(1).Return(nil, &piwigo.PiwigoError{Method: "pwg.images.getInfo", Code: 404})
+
+	err := UpdateMovedImages(piwigoMock, db)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// The date the latest image got added to a category on the server. A category without images or one the server does
+// not know is not found.
+type categoryDate struct {
+	latest time.Time
+	found  bool
+}
+
+// Trusts the server instead of the local metadata and keeps only the images that changed after the latest image got
+// added to their category on the server. Images of categories the server does not know yet or without any images are
+// all uploaded.
+func removeImagesNotNewerThanServer(piwigoCtx piwigo.ImageApi, images []datastore.ImageMetaData, options UploadOptions) ([]datastore.ImageMetaData, error) {
+	if !options.NewerThanServer {
+		return images, nil
+	}
+
+	dates := make(map[int]categoryDate)
+	imagesToUpload := make([]datastore.ImageMetaData, 0, len(images))
+	for _, img := range images {
+		if img.CategoryPiwigoId <= 0 {
+			imagesToUpload = append(imagesToUpload, img)
+			continue
+		}
+
+		date, loaded := dates[img.CategoryPiwigoId]
+		if !loaded {
+			latest, found, err := piwigoCtx.LatestCategoryImageDate(img.CategoryPiwigoId)
+			if err != nil && !errors.Is(err, piwigo.ErrorNotFound) {
+				return nil, err
+			}
+			date = categoryDate{latest: latest, found: found && err == nil}
+			dates[img.CategoryPiwigoId] = date
+			if date.found {
+				logrus.Debugf("The latest image of category %d got added on %s", img.CategoryPiwigoId, latest)
+			} else {
+				logrus.Debugf("Category %d has no images on the server, uploading all of its images", img.CategoryPiwigoId)
+			}
+		}
+
+		if !date.found || img.LastChange.After(date.latest) {
+			imagesToUpload = append(imagesToUpload, img)
+			continue
+		}
+		logrus.Tracef("%s: Skipping the image as it is not newer than the latest image of its category on the server", img.FullImagePath)
+	}
+
+	if skipped := len(images) - len(imagesToUpload); skipped > 0 {
+		logrus.Infof("Skipping %d images that are not newer than the latest image of their category on the server", skipped)
+	}
+	return imagesToUpload, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func Test_removeImagesNotNewerThanServer_keeps_the_newer_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	latest := time.Date(2020, 4, 12, 18, 0, 0, 0, time.Local)
+	images := []datastore.ImageMetaData{
+		{FullImagePath: "/2019/old.jpg", CategoryPiwigoId: 3, LastChange: latest.Add(-time.Hour)},
+		{FullImagePath: "/2019/latest.jpg", CategoryPiwigoId: 3, LastChange: latest},
+		{FullImagePath: "/2019/new.jpg", CategoryPiwigoId: 3, LastChange: latest.Add(time.Hour)},
+		{FullImagePath: "/2020/empty.jpg", CategoryPiwigoId: 4, LastChange: latest.Add(-time.Hour)},
+		{FullImagePath: "/2020/removed.jpg", CategoryPiwigoId: 5, LastChange: latest.Add(-time.Hour)},
+		{FullImagePath: "/2021/unknown.jpg", LastChange: latest.Add(-time.Hour)},
+	}
+
+	piwigoMock := NewMockImageApi(mockCtrl)
+	piwigoMock.EXPECT().LatestCategoryImageDate(3).Times(1).Return(latest, true, nil)
+	piwigoMock.EXPECT().LatestCategoryImageDate(4).Times(1).Return(time.Time{}, false, nil)
+	piwigoMock.EXPECT().LatestCategoryImageDate(5).Times(1).Return(time.Time{}, false, &piwigo.PiwigoError{Method: "pwg.categories.getImages", Code: 404})
+
+	imagesToUpload, err := removeImagesNotNewerThanServer(piwigoMock, images, UploadOptions{NewerThanServer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/2019/new.jpg", "/2020/empty.jpg", "/2020/removed.jpg", "/2021/unknown.jpg"}
+	if len(imagesToUpload) != len(want) {
+		t.Fatalf("got %d images to upload, want %d", len(imagesToUpload), len(want))
+	}
+	for i := range want {
+		if imagesToUpload[i].FullImagePath != want[i] {
+			t.Errorf("image %d is %s, want %s", i, imagesToUpload[i].FullImagePath, want[i])
+		}
+	}
+}
+
+func Test_removeImagesNotNewerThanServer_fails_if_the_server_can_not_be_asked(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	images := []datastore.ImageMetaData{{FullImagePath: "/2019/new.jpg", CategoryPiwigoId: 3}}
+	piwigoMock := NewMockImageApi(mockCtrl)
+	piwigoMock.EXPECT().LatestCategoryImageDate(3).Times(1).Return(time.Time{}, false, errors.New("timeout"))
+
+	_, err := removeImagesNotNewerThanServer(piwigoMock, images, UploadOptions{NewerThanServer: true})
+	if err == nil {
+		t.Error("expected the error of the server")
+	}
+}
+
+func Test_removeImagesNotNewerThanServer_is_disabled_by_default(t *testing.T) {
+	images := []datastore.ImageMetaData{{FullImagePath: "/2019/new.jpg", CategoryPiwigoId: 3}}
+	imagesToUpload, err := removeImagesNotNewerThanServer(nil, images, UploadOptions{})
+	if err != nil || len(imagesToUpload) != 1 {
+		t.Errorf("expected all images without asking the server, got %d images and %v", len(imagesToUpload), err)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Piwigo keeps the uploaded file as original and serves resized web versions, unless it is configured to resize
+// the originals after the upload. The dimensions stored on the server are compared with the local file to report
+// which representation ended up on the server.
+func checkOriginalKept(piwigoCtx piwigo.ImageApi, img datastore.ImageMetaData, options UploadOptions, log *logrus.Entry) {
+	width, height, err := imageDimensions(img.FullImagePath)
+	if err != nil {
+		log.Debugf("%s: could not read the dimensions of the image - %s", img.FullImagePath, err)
+		return
+	}
+
+	info, err := piwigoCtx.GetImageInfo(img.PiwigoId)
+	if err != nil {
+		log.Warnf("%s: could not check if the original of image %d was kept - %s", img.FullImagePath, img.PiwigoId, err)
+		return
+	}
+
+	if info.Width < width || info.Height < height {
+		reason := fmt.Sprintf("the server resized the original of %dx%d pixels to %dx%d pixels. Disable the resize after upload in the piwigo settings to keep the originals", width, height, info.Width, info.Height)
+		log.Warnf("%s: %s", img.FullImagePath, reason)
+		options.Report.AddResized(img.FullImagePath, reason)
+		return
+	}
+	log.Infof("%s: Uploaded the original of %dx%d pixels, the web sizes are served by piwigo", img.FullImagePath, width, height)
+}
+
+func imageDimensions(filePath string) (int, int, error) {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
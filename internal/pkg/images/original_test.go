@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"github.com/golang/mock/gomock"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_uploadImages_keeps_the_original(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = createTestJpeg(t, 40, 30)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GenerateDerivatives(5).Times(1).Return(nil)
+	piwigomock.EXPECT().GetImageInfo(5).Times(1).Return(&piwigo.ImageInfo{Id: 5, Width: 40, Height: 30}, nil)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, KeepOriginal: true, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+	if uploadReport.Uploaded() != 1 || len(uploadReport.Resized()) != 0 {
+		t.Errorf("The original should be reported as uploaded")
+	}
+}
+
+func Test_uploadImages_reports_originals_resized_by_the_server(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = createTestJpeg(t, 40, 30)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GenerateDerivatives(5).Times(1).Return(nil)
+	piwigomock.EXPECT().GetImageInfo(5).Times(1).Return(&piwigo.ImageInfo{Id: 5, Width: 20, Height: 15}, nil)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, KeepOriginal: true, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(uploadReport.Resized()) != 1 {
+		t.Errorf("The resized original should be reported")
+	}
+}
+
+func createTestJpeg(t *testing.T, width int, height int) string {
+	file, err := ioutil.TempFile("", "originaltest*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+
+	err = jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, width, height)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
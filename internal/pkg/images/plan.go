@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// A local image that is missing or different on the server.
+type PlannedImage struct {
+	Path        string
+	CategoryKey string
+	Md5Sum      string
+	// the size and the modification date of the file when the md5sum got calculated
+	Size    int64
+	ModTime time.Time
+	// the image on the server that gets replaced, zero uploads a new image
+	PiwigoId int
+	// the image on the server with the same content, which is only added to the category instead of being uploaded
+	ExistingId int
+}
+
+// Returns the local images that have to be uploaded ordered by path. Like ReconcileImages it changes nothing on the
+// server or in the metadata store. Images whose content is already on the server are returned with the id of the
+// existing image, as the upload adds that image to their category unless it is already in it.
+func PlanImages(imageApi piwigo.ImageApi, provider datastore.ImageMetadataProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator localFileStructure.ChecksumCalculator) ([]PlannedImage, error) {
+	logrus.Debug("Entering PlanImages")
+	defer logrus.Debug("Leaving PlanImages")
+
+	localImages, _ := collectLocalImages(provider, fileSystemNodes, checksumCalculator)
+	md5sums := make([]string, 0, len(localImages))
+	for _, img := range localImages {
+		md5sums = append(md5sums, img.md5sum)
+	}
+	existingImages := map[string]int{}
+	if len(md5sums) > 0 {
+		var err error
+		existingImages, err = imageApi.ImagesExistOnPiwigo(md5sums)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	planned := make([]PlannedImage, 0)
+	for _, img := range localImages {
+		plannedImage := PlannedImage{Path: img.path, CategoryKey: img.categoryKey, Md5Sum: img.md5sum, Size: img.size, ModTime: img.modTime}
+		if existingId := existingImages[img.md5sum]; existingId > 0 {
+			plannedImage.ExistingId = existingId
+			planned = append(planned, plannedImage)
+			continue
+		}
+		if img.piwigoId > 0 {
+			state, err := imageApi.ImageCheckFile(img.piwigoId, img.md5sum)
+			if err != nil && !errors.Is(err, piwigo.ErrorImageNotFound) {
+				return nil, err
+			}
+			if err == nil && state == piwigo.ImageStateUptodate {
+				continue
+			}
+			if err == nil {
+				plannedImage.PiwigoId = img.piwigoId
+			} else {
+				logrus.Debugf("Image %d of %s not found on the server, planning it as new image - %s", img.piwigoId, img.path, err)
+			}
+		}
+		planned = append(planned, plannedImage)
+	}
+
+	sort.Slice(planned, func(i, j int) bool { return planned[i].Path < planned[j].Path })
+	return planned, nil
+}
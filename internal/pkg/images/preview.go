@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/transform"
+	"github.com/sirupsen/logrus"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// the longest side of the generated previews of images without exif thumbnail
+const previewSize = 480
+
+// Uploads a preview of every new jpeg image, so the gallery can be browsed before the originals are uploaded. The
+// preview is the exif thumbnail or a small copy of the image if there is none. It gets the md5sum of the original, so
+// the original replaces it in the same image on the server as soon as it gets uploaded. The previewed images stay
+// scheduled, so the originals are uploaded by the next run if the run stops in between. Returns the images with the
+// piwigo ids of the previews.
+func uploadPreviews(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, images []datastore.ImageMetaData, limiter *uploadLimiter, numberOfWorkers int, options UploadOptions) []datastore.ImageMetaData {
+	// the content queued for several images is uploaded once and shared, which may be by another image than the preview
+	contentCount := make(map[string]int, len(images))
+	for _, img := range images {
+		contentCount[img.Md5Sum]++
+	}
+
+	var indexes []int
+	for i, img := range images {
+		if img.PiwigoId == 0 && contentCount[img.Md5Sum] == 1 {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return images
+	}
+
+	logrus.Infof("Uploading the previews of %d images before the originals", len(indexes))
+	workQueue := make(chan int, numberOfWorkers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < numberOfWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range workQueue {
+				// every worker changes only the images of its own indexes
+				release := limiter.acquire(images[index].FullImagePath)
+				images[index] = uploadImagePreview(piwigoCtx, metadataProvider, images[index], options)
+				release()
+			}
+		}()
+	}
+	for _, index := range indexes {
+		workQueue <- index
+	}
+	close(workQueue)
+	wg.Wait()
+	return images
+}
+
+func uploadImagePreview(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, img datastore.ImageMetaData, options UploadOptions) datastore.ImageMetaData {
+	correlationId := piwigo.NewCorrelationId()
+	log := imageLog(correlationId, img)
+
+	if options.ValidateImages && validateImage(img.FullImagePath, options) != nil {
+		// the upload of the original reports the invalid image
+		return img
+	}
+
+	previewPath, cleanup, found, err := writePreview(img, options)
+	if err != nil {
+		log.Warnf("%s: could not create the preview, uploading the original only - %s", img.FullImagePath, err)
+		return img
+	}
+	if !found {
+		log.Debugf("%s: no preview needed, uploading the original only", img.FullImagePath)
+		return img
+	}
+	defer cleanup()
+
+	result, err := piwigoCtx.UploadImage(0, previewPath, img.Md5Sum, img.CategoryPiwigoId, correlationId)
+	if err != nil {
+		log.Warnf("%s: could not upload the preview, uploading the original only - %s", img.FullImagePath, err)
+		return img
+	}
+	if result.MatchedExisting {
+		// the content is already on the server, the upload of the original matches it again
+		return img
+	}
+
+	img.PiwigoId = result.ImageId
+	err = metadataProvider.SaveImageMetadata(img)
+	if err != nil {
+		log.Warnf("%s: could not save the preview %d - %s", img.FullImagePath, img.PiwigoId, err)
+	}
+	log.Infof("%s: Uploaded a preview as image %d", img.FullImagePath, img.PiwigoId)
+	return img
+}
+
+// Writes the preview of the image with the name of the image to the work directory. Returns false if the format has
+// no preview.
+func writePreview(img datastore.ImageMetaData, options UploadOptions) (string, func(), bool, error) {
+	noCleanup := func() {}
+	file, err := localFileStructure.OpenFile(img.FullImagePath)
+	if err != nil {
+		return "", noCleanup, false, err
+	}
+	content, err := ioutil.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return "", noCleanup, false, err
+	}
+
+	preview, found, err := createPreview(content)
+	if err == transform.ErrorUnsupportedFormat {
+		return "", noCleanup, false, nil
+	}
+	if err != nil || !found {
+		return "", noCleanup, found, err
+	}
+
+	// every image gets its own directory as the filename is used as the name of the image on the server
+	directory := filepath.Join(options.WorkDir.Path(), fmt.Sprintf("preview-%s", img.Md5Sum))
+	err = os.MkdirAll(directory, 0700)
+	if err != nil {
+		return "", noCleanup, false, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(directory)
+	}
+	previewPath := filepath.Join(directory, filepath.Base(img.FullImagePath))
+	err = ioutil.WriteFile(previewPath, preview, 0600)
+	if err != nil {
+		cleanup()
+		return "", noCleanup, false, err
+	}
+	return previewPath, cleanup, true, nil
+}
+
+// Returns the exif thumbnail of jpeg images or a small copy of the image if it has none.
+func createPreview(content []byte) ([]byte, bool, error) {
+	thumbnail, found, err := transform.ExifThumbnail(content)
+	if err == transform.ErrorUnsupportedFormat || found {
+		return thumbnail, found, err
+	}
+	if err != nil {
+		logrus.Debugf("Ignoring the invalid exif thumbnail - %s", err)
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, false, err
+	}
+	bounds := decoded.Bounds()
+	if bounds.Dx() <= previewSize && bounds.Dy() <= previewSize {
+		// the image is not larger than its preview
+		return nil, false, nil
+	}
+
+	width, height := previewSize, bounds.Dy()*previewSize/bounds.Dx()
+	if bounds.Dy() > bounds.Dx() {
+		width, height = bounds.Dx()*previewSize/bounds.Dy(), previewSize
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	preview := image.NewRGBA(image.Rect(0, 0, width, height))
+	drawThumbnail(preview, preview.Bounds(), decoded)
+
+	encoded := bytes.Buffer{}
+	err = jpeg.Encode(&encoded, preview, &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, false, err
+	}
+	return encoded.Bytes(), true, nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/transform"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/golang/mock/gomock"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func encodePreviewTestJpeg(t *testing.T, width int, height int) []byte {
+	encoded := bytes.Buffer{}
+	err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, width, height)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func Test_createPreview_scales_images_without_exif_thumbnail(t *testing.T) {
+	preview, found, err := createPreview(encodePreviewTestJpeg(t, 1000, 500))
+	if err != nil || !found {
+		t.Fatalf("expected a preview but got %t, %v", found, err)
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(preview))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds().Dx() != previewSize || decoded.Bounds().Dy() != previewSize/2 {
+		t.Errorf("expected a preview of %dx%d pixels but got %s", previewSize, previewSize/2, decoded.Bounds())
+	}
+}
+
+func Test_createPreview_skips_small_images_and_other_formats(t *testing.T) {
+	_, found, err := createPreview(encodePreviewTestJpeg(t, previewSize, 100))
+	if err != nil || found {
+		t.Errorf("expected no preview of a small image but got %t, %v", found, err)
+	}
+
+	_, _, err = createPreview([]byte("\x89PNG\r\n\x1a\n"))
+	if err != transform.ErrorUnsupportedFormat {
+		t.Errorf("expected ErrorUnsupportedFormat but got %v", err)
+	}
+}
+
+func Test_uploadImages_uploads_the_preview_before_the_original(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	workDir, err := workdir.Create("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = workDir.Remove() })
+	file, err := workDir.CreateFile("photo*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.Write(encodePreviewTestJpeg(t, 1000, 800))
+	_ = file.Close()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = file.Name()
+
+	previewed := img
+	previewed.PiwigoId = 7
+	uploaded := previewed
+	uploaded.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img}, nil)
+	piwigomock := NewMockImageApi(mockCtrl)
+	gomock.InOrder(
+		piwigomock.EXPECT().UploadImage(0, gomock.Any(), "1234", 2, gomock.Any()).DoAndReturn(func(piwigoId int, filePath string, md5sum string, category int, correlationId string) (piwigo.UploadResult, error) {
+			if filePath == img.FullImagePath || filepath.Base(filePath) != filepath.Base(img.FullImagePath) {
+				t.Errorf("expected the preview with the name of the image but got %s", filePath)
+			}
+			content, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				t.Error(err)
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(content))
+			if err != nil || config.Width != previewSize {
+				t.Errorf("expected a preview with a width of %d but got %d, %v", previewSize, config.Width, err)
+			}
+			return piwigo.UploadResult{ImageId: 7}, nil
+		}),
+		dbmock.EXPECT().SaveImageMetadata(previewed),
+		piwigomock.EXPECT().UploadImage(7, img.FullImagePath, "1234", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 7}, nil),
+		dbmock.EXPECT().SaveImageMetadata(uploaded),
+	)
+
+	err = UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, PreviewFirst: true, WorkDir: workDir})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_uploads_no_preview_of_existing_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(5)
+	uploaded := img
+	uploaded.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(uploaded)
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(5, img.FullImagePath, "1234", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, PreviewFirst: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
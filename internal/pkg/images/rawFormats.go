@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sort"
+)
+
+// Attaches the raw files of the pairs found by localFileStructure.FindRawPairs as format to the uploaded images of
+// their JPEGs. A raw file is attached again if it changed or its JPEG got uploaded as another image. The raw files of
+// JPEGs that are not uploaded yet are attached by a later run. Failed raw files are logged and reported as one error
+// after all pairs got processed.
+func AttachRawFormats(piwigoCtx piwigo.ImageApi, imageDb datastore.ImageMetadataProvider, formatDb datastore.RawFormatProvider, pairs map[string]*localFileStructure.FilesystemNode) error {
+	logrus.Debug("Entering AttachRawFormats")
+	defer logrus.Debug("Leaving AttachRawFormats")
+
+	jpegs := make([]string, 0, len(pairs))
+	for jpeg := range pairs {
+		jpegs = append(jpegs, jpeg)
+	}
+	sort.Strings(jpegs)
+
+	attached := 0
+	failed := 0
+	for _, jpeg := range jpegs {
+		raw := pairs[jpeg]
+		image, err := imageDb.ImageMetadata(jpeg)
+		if err == datastore.ErrorRecordNotFound || (err == nil && (image.PiwigoId == 0 || image.UploadRequired)) {
+			logrus.Debugf("Attaching the raw file %s after %s got uploaded", raw.Path, jpeg)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		format, err := formatDb.RawFormat(raw.Path)
+		if err == nil && format.PiwigoId == image.PiwigoId && format.LastChange.Equal(raw.ModTime) {
+			logrus.Tracef("The raw file %s is already attached to image %d", raw.Path, image.PiwigoId)
+			continue
+		}
+		if err != nil && err != datastore.ErrorRecordNotFound {
+			return err
+		}
+
+		err = piwigoCtx.UploadFormat(image.PiwigoId, raw.Path, "")
+		if err != nil {
+			logrus.Errorf("Could not attach the raw file %s to image %d - %s", raw.Path, image.PiwigoId, err)
+			failed++
+			continue
+		}
+		err = formatDb.SaveRawFormat(datastore.RawFormat{RawPath: raw.Path, PiwigoId: image.PiwigoId, LastChange: raw.ModTime})
+		if err != nil {
+			return err
+		}
+		attached++
+	}
+
+	logrus.Infof("Attached %d raw files to their JPEG", attached)
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("could not attach %d raw files to their JPEG", failed))
+	}
+	return nil
+}
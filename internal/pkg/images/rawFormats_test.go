@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func Test_AttachRawFormats_attaches_new_and_changed_raw_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	modTime := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	pairs := map[string]*localFileStructure.FilesystemNode{
+		"a/IMG_1.jpg": {Path: "a/IMG_1.CR2", ModTime: modTime},
+		"a/IMG_2.jpg": {Path: "a/IMG_2.cr2", ModTime: modTime},
+		"a/IMG_3.jpg": {Path: "a/IMG_3.NEF", ModTime: modTime},
+		"a/IMG_4.jpg": {Path: "a/IMG_4.NEF", ModTime: modTime},
+	}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadata("a/IMG_1.jpg").Return(datastore.ImageMetaData{PiwigoId: 1}, nil)
+	dbmock.EXPECT().ImageMetadata("a/IMG_2.jpg").Return(datastore.ImageMetaData{PiwigoId: 2}, nil)
+	dbmock.EXPECT().ImageMetadata("a/IMG_3.jpg").Return(datastore.ImageMetaData{PiwigoId: 3}, nil)
+	dbmock.EXPECT().ImageMetadata("a/IMG_4.jpg").Return(datastore.ImageMetaData{}, datastore.ErrorRecordNotFound)
+
+	formatmock := NewMockRawFormatProvider(mockCtrl)
+	formatmock.EXPECT().RawFormat("a/IMG_1.CR2").Return(datastore.RawFormat{}, datastore.ErrorRecordNotFound)
+	formatmock.EXPECT().RawFormat("a/IMG_2.cr2").Return(datastore.RawFormat{RawPath: "a/IMG_2.cr2", PiwigoId: 2, LastChange: modTime}, nil)
+	formatmock.EXPECT().RawFormat("a/IMG_3.NEF").Return(datastore.RawFormat{RawPath: "a/IMG_3.NEF", PiwigoId: 3, LastChange: modTime.Add(-time.Hour)}, nil)
+	formatmock.EXPECT().SaveRawFormat(datastore.RawFormat{RawPath: "a/IMG_1.CR2", PiwigoId: 1, LastChange: modTime}).Return(nil)
+	formatmock.EXPECT().SaveRawFormat(datastore.RawFormat{RawPath: "a/IMG_3.NEF", PiwigoId: 3, LastChange: modTime}).Return(nil)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadFormat(1, "a/IMG_1.CR2", gomock.Any()).Return(nil)
+	piwigomock.EXPECT().UploadFormat(3, "a/IMG_3.NEF", gomock.Any()).Return(nil)
+
+	err := AttachRawFormats(piwigomock, dbmock, formatmock, pairs)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_AttachRawFormats_reports_failed_raw_files(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	pairs := map[string]*localFileStructure.FilesystemNode{
+		"IMG_1.jpg": {Path: "IMG_1.CR2"},
+	}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadata("IMG_1.jpg").Return(datastore.ImageMetaData{PiwigoId: 1}, nil)
+
+	formatmock := NewMockRawFormatProvider(mockCtrl)
+	formatmock.EXPECT().RawFormat("IMG_1.CR2").Return(datastore.RawFormat{}, datastore.ErrorRecordNotFound)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadFormat(1, "IMG_1.CR2", gomock.Any()).Return(errors.New("formats are disabled"))
+
+	err := AttachRawFormats(piwigomock, dbmock, formatmock, pairs)
+	if err == nil {
+		t.Error("expected an error for the failed raw file")
+	}
+}
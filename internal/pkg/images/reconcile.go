@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+// How the local images and the images of the managed categories on the server diverge.
+type Reconciliation struct {
+	LocalImages  int `json:"localImages"`
+	ServerImages int `json:"serverImages"`
+	UpToDate     int `json:"upToDate"`
+	Different    int `json:"different"`
+	Missing      int `json:"missing"`
+	// images in the managed categories on the server without a local file
+	ServerOnly int `json:"serverOnly"`
+}
+
+type localImage struct {
+	path        string
+	categoryKey string
+	md5sum      string
+	piwigoId    int
+	size        int64
+	modTime     time.Time
+}
+
+// Compares the local images with the server without changing anything on the server or in the metadata store.
+// The categories of the local directories are the managed categories whose images are counted as server images.
+func ReconcileImages(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, provider datastore.ImageMetadataProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator localFileStructure.ChecksumCalculator) (Reconciliation, error) {
+	logrus.Debug("Entering ReconcileImages")
+	defer logrus.Debug("Leaving ReconcileImages")
+
+	result := Reconciliation{}
+
+	localImages, categoryKeys := collectLocalImages(provider, fileSystemNodes, checksumCalculator)
+	result.LocalImages = len(localImages)
+
+	md5sums := make([]string, 0, len(localImages))
+	for _, img := range localImages {
+		md5sums = append(md5sums, img.md5sum)
+	}
+	existingImages := map[string]int{}
+	if len(md5sums) > 0 {
+		var err error
+		existingImages, err = imageApi.ImagesExistOnPiwigo(md5sums)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	knownIds := make(map[int]bool)
+	for _, img := range localImages {
+		if piwigoId := existingImages[img.md5sum]; piwigoId > 0 {
+			knownIds[piwigoId] = true
+			result.UpToDate++
+			continue
+		}
+		if img.piwigoId == 0 {
+			result.Missing++
+			continue
+		}
+
+		state, err := imageApi.ImageCheckFile(img.piwigoId, img.md5sum)
+		if err != nil {
+			logrus.Debugf("Image %d of %s not found on the server - %s", img.piwigoId, img.path, err)
+			result.Missing++
+			continue
+		}
+		knownIds[img.piwigoId] = true
+		if state == piwigo.ImageStateUptodate {
+			result.UpToDate++
+		} else {
+			result.Different++
+		}
+	}
+
+	categories, err := categoryApi.GetAllCategories()
+	if err != nil {
+		return result, err
+	}
+
+	index := piwigo.NewCategoryIndex(categories)
+	serverIds := make(map[int]bool)
+	for key := range categoryKeys {
+		category, ok := index.ByKey(key)
+		if !ok {
+			continue
+		}
+		imageIds, err := imageApi.GetCategoryImages(category.Id)
+		if err != nil {
+			return result, err
+		}
+		for _, imageId := range imageIds {
+			serverIds[imageId] = true
+		}
+	}
+
+	result.ServerImages = len(serverIds)
+	for imageId := range serverIds {
+		if !knownIds[imageId] {
+			result.ServerOnly++
+		}
+	}
+
+	return result, nil
+}
+
+// Uses the stored md5sum of unchanged files and calculates the md5sum of all others.
+func collectLocalImages(provider datastore.ImageMetadataProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator localFileStructure.ChecksumCalculator) ([]localImage, map[string]bool) {
+	localImages := make([]localImage, 0, len(fileSystemNodes))
+	categoryKeys := make(map[string]bool)
+
+	for _, file := range fileSystemNodes {
+		if file.IsDir {
+			categoryKeys[file.Key] = true
+			continue
+		}
+		categoryKey := filepath.Dir(file.Key)
+		categoryKeys[categoryKey] = true
+
+		img := localImage{path: file.Path, categoryKey: categoryKey, size: file.Size, modTime: file.ModTime}
+		metadata, err := provider.ImageMetadata(file.Path)
+		if err == nil {
+			img.piwigoId = metadata.PiwigoId
+			if fileDidNotChange(&metadata, file) {
+				img.md5sum = metadata.Md5Sum
+			}
+		}
+
+		if img.md5sum == "" {
+			img.md5sum, _, err = checksumCalculator(file.Path)
+			if err != nil {
+				logrus.Warnf("Could not calculate checksum for file %s. Skipping...", file.Path)
+				continue
+			}
+		}
+		localImages = append(localImages, img)
+	}
+	return localImages, categoryKeys
+}
+
+// Writes the reconciliation as table or as JSON.
+func WriteReconciliation(writer io.Writer, reconciliation Reconciliation, asJson bool) error {
+	if asJson {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reconciliation)
+	}
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', tabwriter.AlignRight)
+	rows := []struct {
+		name  string
+		value int
+	}{
+		{"Local images", reconciliation.LocalImages},
+		{"Server images", reconciliation.ServerImages},
+		{"Up to date", reconciliation.UpToDate},
+		{"Different", reconciliation.Different},
+		{"Missing on server", reconciliation.Missing},
+		{"Only on server", reconciliation.ServerOnly},
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(table, "%s\t%d\t\n", row.name, row.value); err != nil {
+			return err
+		}
+	}
+	return table.Flush()
+}
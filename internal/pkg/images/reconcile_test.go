@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ReconcileImages_counts_divergence_without_changes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	modTime := time.Date(2019, 01, 01, 00, 0, 0, 0, time.UTC)
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{
+		"2019":       {Key: "2019", Path: "2019", Name: "2019", IsDir: true},
+		"2019/a.jpg": {Key: "2019/a.jpg", Path: "2019/a.jpg", Name: "a.jpg", ModTime: modTime},
+		"2019/b.jpg": {Key: "2019/b.jpg", Path: "2019/b.jpg", Name: "b.jpg", ModTime: modTime},
+		"2019/c.jpg": {Key: "2019/c.jpg", Path: "2019/c.jpg", Name: "c.jpg", ModTime: modTime},
+	}
+
+	// the metadata store is only read, nothing gets saved
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadata("2019/a.jpg").Return(datastore.ImageMetaData{}, datastore.ErrorRecordNotFound)
+	db.EXPECT().ImageMetadata("2019/b.jpg").Return(datastore.ImageMetaData{PiwigoId: 2, Md5Sum: "stored-b", LastChange: modTime}, nil)
+	db.EXPECT().ImageMetadata("2019/c.jpg").Return(datastore.ImageMetaData{}, datastore.ErrorRecordNotFound)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Return(map[string]int{"2019/a.jpg": 1, "stored-b": 0, "2019/c.jpg": 0}, nil)
+	imageApi.EXPECT().ImageCheckFile(2, "stored-b").Return(piwigo.ImageStateDifferent, nil)
+	imageApi.EXPECT().GetCategoryImages(7).Return([]int{1, 2, 9}, nil)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Return(map[string]*piwigo.Category{
+		"2019":  {Id: 7, Name: "2019", Key: "2019"},
+		"other": {Id: 8, Name: "other", Key: "other"},
+	}, nil)
+
+	reconciliation, err := ReconcileImages(categoryApi, imageApi, db, fileSystemNodes, testChecksumCalculator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Reconciliation{LocalImages: 3, ServerImages: 3, UpToDate: 1, Different: 1, Missing: 1, ServerOnly: 1}
+	if reconciliation != expected {
+		t.Errorf("expected %+v but got %+v", expected, reconciliation)
+	}
+}
+
+func Test_ReconcileImages_counts_removed_server_images_as_missing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{
+		"2019/a.jpg": {Key: "2019/a.jpg", Path: "2019/a.jpg", Name: "a.jpg"},
+	}
+
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadata("2019/a.jpg").Return(datastore.ImageMetaData{PiwigoId: 4, Md5Sum: "old", LastChange: time.Now()}, nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo([]string{"2019/a.jpg"}).Return(map[string]int{"2019/a.jpg": 0}, nil)
+	imageApi.EXPECT().ImageCheckFile(4, "2019/a.jpg").Return(-1, errors.New("image not found"))
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Return(map[string]*piwigo.Category{}, nil)
+
+	reconciliation, err := ReconcileImages(categoryApi, imageApi, db, fileSystemNodes, testChecksumCalculator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reconciliation.Missing != 1 || reconciliation.UpToDate != 0 || reconciliation.ServerImages != 0 {
+		t.Errorf("unexpected reconciliation %+v", reconciliation)
+	}
+}
+
+func Test_WriteReconciliation_as_table_and_json(t *testing.T) {
+	reconciliation := Reconciliation{LocalImages: 12, ServerImages: 10, UpToDate: 8, Different: 1, Missing: 3, ServerOnly: 1}
+
+	var table bytes.Buffer
+	err := WriteReconciliation(&table, reconciliation, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), "Local images  12") || !strings.Contains(table.String(), "Only on server   1") {
+		t.Errorf("unexpected table\n%s", table.String())
+	}
+
+	var jsonOutput bytes.Buffer
+	err = WriteReconciliation(&jsonOutput, reconciliation, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(jsonOutput.String(), `"serverOnly": 1`) || !strings.Contains(jsonOutput.String(), `"localImages": 12`) {
+		t.Errorf("unexpected json %s", jsonOutput.String())
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+)
+
+// Reconciles the images whose upload got interrupted by a crash of a previous run. Their state on the server is unknown,
+// so they are looked up by md5sum. Images that made it to the server and to their category are marked as done, all
+// others get uploaded again, which only adds the image to its category if the server already knows the content.
+// Completed images are never touched, so a restart does not query the server for everything again. Only the uploads
+// are resumed, the categories are synchronized like on every run.
+func ResumeInterruptedUploads(piwigoCtx piwigo.ImageApi, provider datastore.ImageMetadataProvider) error {
+	logrus.Debug("Entering ResumeInterruptedUploads")
+	defer logrus.Debug("Leaving ResumeInterruptedUploads")
+
+	images, err := provider.ImageMetadataInterrupted()
+	if err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		logrus.Debug("There are no interrupted uploads to resume.")
+		return nil
+	}
+
+	logrus.Infof("Resuming %d interrupted uploads of a previous run", len(images))
+	md5sums := make([]string, 0, len(images))
+	for _, img := range images {
+		md5sums = append(md5sums, img.Md5Sum)
+	}
+
+	existingImages, err := piwigoCtx.ImagesExistOnPiwigo(md5sums)
+	if err != nil {
+		return err
+	}
+
+	categoryImages := make(map[int]map[int]bool)
+	for _, img := range images {
+		piwigoId := existingImages[img.Md5Sum]
+		inCategory := false
+		if piwigoId > 0 {
+			inCategory, err = isInCategory(piwigoCtx, categoryImages, img.CategoryPiwigoId, piwigoId)
+			if err != nil {
+				return err
+			}
+		}
+
+		if inCategory {
+			logrus.Infof("%s: interrupted upload completed on the server as %d", img.FullImagePath, piwigoId)
+			img.PiwigoId = piwigoId
+			img.UploadRequired = false
+		} else if piwigoId > 0 {
+			logrus.Infof("%s: interrupted upload reached the server as %d but not the category %d. Uploading it again.", img.FullImagePath, piwigoId, img.CategoryPiwigoId)
+			img.UploadRequired = true
+		} else {
+			logrus.Infof("%s: interrupted upload did not reach the server. Uploading it again.", img.FullImagePath)
+			img.UploadRequired = true
+		}
+		img.UploadRunId = 0
+
+		err = provider.SaveImageMetadata(img)
+		if err != nil {
+			logrus.Warnf("Could not save image data of image %s", img.FullImagePath)
+		}
+	}
+
+	return nil
+}
+
+// Checks if the image is in the category. The images of each category are only loaded once.
+func isInCategory(piwigoCtx piwigo.ImageApi, categoryImages map[int]map[int]bool, categoryId int, piwigoId int) (bool, error) {
+	ids, found := categoryImages[categoryId]
+	if !found {
+		images, err := piwigoCtx.GetCategoryImages(categoryId)
+		if err != nil {
+			return false, err
+		}
+		ids = make(map[int]bool, len(images))
+		for _, id := range images {
+			ids[id] = true
+		}
+		categoryImages[categoryId] = ids
+	}
+	return ids[piwigoId], nil
+}
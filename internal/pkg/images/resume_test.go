@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func Test_uploadImages_marks_the_image_while_uploading(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+
+	inProgress := img
+	inProgress.UploadRunId = 3
+
+	uploaded := img
+	uploaded.PiwigoId = 5
+	uploaded.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	gomock.InOrder(
+		dbmock.EXPECT().SaveImageMetadata(inProgress).Times(1),
+		dbmock.EXPECT().SaveImageMetadata(uploaded).Times(1),
+	)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, RunId: 3})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ResumeInterruptedUploads_completes_images_found_on_the_server(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// the run crashed after the image reached the server but before the id got saved
+	img := createTestImageMetaData(0)
+	img.UploadRunId = 3
+
+	resumed := img
+	resumed.UploadRunId = 0
+	resumed.PiwigoId = 5
+	resumed.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataInterrupted().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(resumed).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo([]string{"1234"}).Times(1).Return(map[string]int{"1234": 5}, nil)
+	piwigomock.EXPECT().GetCategoryImages(2).Times(1).Return([]int{4, 5}, nil)
+
+	err := ResumeInterruptedUploads(piwigomock, dbmock)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ResumeInterruptedUploads_uploads_images_missing_in_their_category_again(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// the content is on the server, but in another category
+	img := createTestImageMetaData(0)
+	img.UploadRunId = 3
+
+	resumed := img
+	resumed.UploadRunId = 0
+	resumed.UploadRequired = true
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataInterrupted().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(resumed).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo([]string{"1234"}).Times(1).Return(map[string]int{"1234": 5}, nil)
+	piwigomock.EXPECT().GetCategoryImages(2).Times(1).Return([]int{4}, nil)
+
+	err := ResumeInterruptedUploads(piwigomock, dbmock)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ResumeInterruptedUploads_uploads_missing_images_again(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// the run crashed before the image reached the server
+	img := createTestImageMetaData(0)
+	img.UploadRunId = 3
+
+	resumed := img
+	resumed.UploadRunId = 0
+	resumed.UploadRequired = true
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataInterrupted().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(resumed).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo([]string{"1234"}).Times(1).Return(map[string]int{}, nil)
+
+	err := ResumeInterruptedUploads(piwigomock, dbmock)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ResumeInterruptedUploads_does_not_query_the_server_without_interrupted_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataInterrupted().Times(1).Return([]datastore.ImageMetaData{}, nil)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Times(0)
+
+	err := ResumeInterruptedUploads(piwigomock, dbmock)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ResumeInterruptedUploads_keeps_the_images_on_server_errors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.UploadRunId = 3
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataInterrupted().Times(1).Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Times(1).Return(nil, errors.New("server down"))
+
+	err := ResumeInterruptedUploads(piwigomock, dbmock)
+	if err == nil {
+		t.Error("expected the error of the server")
+	}
+}
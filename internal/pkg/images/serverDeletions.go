@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+type ServerDeletionOptions struct {
+	// The percentage of the uploaded images that is verified per run, 100 verifies all of them.
+	SamplePercent int
+	// The id of the running run. It selects the images of the sample, so the next runs verify the other images.
+	RunId int
+	// The number of images that are requested at the same time.
+	ParallelRequests int
+}
+
+// Verifies that a sample of the uploaded images still exists on the server and uploads the ones the server lost
+// again, e.g. as an admin cleaned up the server. Every image is requested with pwg.images.getInfo, so the images are
+// split into groups by the sample and every run verifies the next group. All images are verified once within 100 /
+// SamplePercent runs.
+func DetectServerDeletions(piwigoCtx piwigo.ImageApi, provider datastore.ImageMetadataProvider, options ServerDeletionOptions) error {
+	logrus.Debug("Entering DetectServerDeletions")
+	defer logrus.Debug("Leaving DetectServerDeletions")
+
+	if options.SamplePercent < 1 || options.SamplePercent > 100 {
+		return errors.New(fmt.Sprintf("invalid sample of %d%% to detect server deletions, use 1 to 100", options.SamplePercent))
+	}
+
+	images, err := provider.ImageMetadataAll()
+	if err != nil {
+		return err
+	}
+
+	groups := (100 + options.SamplePercent - 1) / options.SamplePercent
+	group := options.RunId % groups
+	sample := make([]datastore.ImageMetaData, 0)
+	for _, img := range images {
+		if img.PiwigoId > 0 && !img.UploadRequired && !img.DeleteRequired && img.ImageId%groups == group {
+			sample = append(sample, img)
+		}
+	}
+	if len(sample) == 0 {
+		logrus.Debug("There are no uploaded images in the sample to verify on the server.")
+		return nil
+	}
+
+	logrus.Infof("Verifying that %d of the uploaded images still exist on the server (group %d of %d)", len(sample), group+1, groups)
+	missing, err := findDeletedImages(piwigoCtx, sample, options.ParallelRequests)
+	if err != nil {
+		return err
+	}
+	for _, img := range missing {
+		reuploadMissingImage(provider, img)
+	}
+	logrus.Infof("Found %d of %d verified images deleted on the server", len(missing), len(sample))
+	return nil
+}
+
+// Returns the images the server does not know anymore. Fails if an image could not be verified, so an unreachable
+// server does not cause all images to be uploaded again.
+func findDeletedImages(piwigoCtx piwigo.ImageApi, images []datastore.ImageMetaData, parallelRequests int) ([]datastore.ImageMetaData, error) {
+	if parallelRequests <= 0 {
+		parallelRequests = 1
+	}
+
+	mutex := sync.Mutex{}
+	missing := make([]datastore.ImageMetaData, 0)
+	var failure error
+	queue := make(chan datastore.ImageMetaData)
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for img := range queue {
+				_, err := piwigoCtx.GetImageInfo(img.PiwigoId)
+				if err == nil {
+					continue
+				}
+
+				mutex.Lock()
+				if errors.Is(err, piwigo.ErrorImageNotFound) {
+					missing = append(missing, img)
+				} else if failure == nil {
+					failure = errors.New(fmt.Sprintf("%s: could not verify image %d on the server - %s", img.FullImagePath, img.PiwigoId, err))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, img := range images {
+		queue <- img
+	}
+	close(queue)
+	wg.Wait()
+	return missing, failure
+}
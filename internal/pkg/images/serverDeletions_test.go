@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func createServerDeletionTestImages() []datastore.ImageMetaData {
+	images := make([]datastore.ImageMetaData, 0)
+	for imageId := 1; imageId <= 4; imageId++ {
+		img := createTestImageMetaData(imageId + 10)
+		img.ImageId = imageId
+		img.UploadRequired = false
+		images = append(images, img)
+	}
+	// not uploaded yet, so there is nothing to verify
+	pending := createTestImageMetaData(0)
+	pending.ImageId = 6
+	return append(images, pending)
+}
+
+func Test_DetectServerDeletions_uploads_the_deleted_images_again(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Times(1).Return(createServerDeletionTestImages(), nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1).DoAndReturn(func(img datastore.ImageMetaData) error {
+		if img.ImageId != 3 || img.PiwigoId != 0 || !img.UploadRequired {
+			t.Errorf("expected image 3 to be uploaded again but got %s", img.String())
+		}
+		return nil
+	})
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	for _, piwigoId := range []int{11, 12, 14} {
+		piwigomock.EXPECT().GetImageInfo(piwigoId).Times(1).Return(&piwigo.ImageInfo{Id: piwigoId}, nil)
+	}
+	piwigomock.EXPECT().GetImageInfo(13).Times(1).Return(nil, piwigo.ErrorImageNotFound)
+
+	err := DetectServerDeletions(piwigomock, dbmock, ServerDeletionOptions{SamplePercent: 100, RunId: 7, ParallelRequests: 2})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_DetectServerDeletions_verifies_the_images_in_rotation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Times(2).Return(createServerDeletionTestImages(), nil)
+
+	// a sample of 40% splits the images into three groups, run 3 verifies the first and run 4 the second one
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().GetImageInfo(13).Times(1).Return(&piwigo.ImageInfo{Id: 13}, nil)
+	piwigomock.EXPECT().GetImageInfo(11).Times(1).Return(&piwigo.ImageInfo{Id: 11}, nil)
+	piwigomock.EXPECT().GetImageInfo(14).Times(1).Return(&piwigo.ImageInfo{Id: 14}, nil)
+
+	for _, runId := range []int{3, 4} {
+		err := DetectServerDeletions(piwigomock, dbmock, ServerDeletionOptions{SamplePercent: 40, RunId: runId, ParallelRequests: 1})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func Test_DetectServerDeletions_keeps_the_images_if_the_server_fails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Times(1).Return(createServerDeletionTestImages(), nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().GetImageInfo(12).Times(1).Return(nil, errors.New("connection refused"))
+	piwigomock.EXPECT().GetImageInfo(gomock.Any()).Times(3).Return(nil, piwigo.ErrorImageNotFound)
+
+	err := DetectServerDeletions(piwigomock, dbmock, ServerDeletionOptions{SamplePercent: 100, ParallelRequests: 1})
+	if err == nil {
+		t.Error("expected the failing request to fail the verification")
+	}
+}
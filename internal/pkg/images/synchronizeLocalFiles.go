@@ -15,17 +15,24 @@ import (
 	"sync"
 )
 
-type fileChecksumCalculator func(filePath string) (string, error)
-
 // Update the local image metadata by walking through all found files and check if the modification date has changed
 // or if they are new to the local database. If the files is new or changed, the md5sum will be rebuilt as well.
-func SynchronizeLocalImageMetadata(imageDb datastore.ImageMetadataProvider, categoryDb datastore.CategoryProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator fileChecksumCalculator) error {
+// The checksums are calculated by hashConcurrency workers, zero or less uses one worker per usable CPU.
+// If compareBy is not md5, uploaded files whose size or exif date did not change are not uploaded again.
+// If detectMovedFiles is set, new files that are known files moved to another path keep their metadata without being
+// hashed again.
+func SynchronizeLocalImageMetadata(imageDb datastore.ImageMetadataProvider, categoryDb datastore.CategoryProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator localFileStructure.ChecksumCalculator, hashConcurrency int, compareBy string, detectMovedFiles bool) error {
 	logrus.Debug("Starting SynchronizeLocalImageMetadata")
 	defer logrus.Debug("Leaving SynchronizeLocalImageMetadata")
 
 	logrus.Info("Synchronizing local image metadata database with local available images")
 
-	err := synchronizeLocalImageMetadataScanNewFiles(fileSystemNodes, imageDb, categoryDb, checksumCalculator)
+	err := checkCompareBy(compareBy)
+	if err != nil {
+		return err
+	}
+
+	err = synchronizeLocalImageMetadataScanNewFiles(fileSystemNodes, imageDb, categoryDb, checksumCalculator, hashConcurrency, compareBy, newMoveDetector(detectMovedFiles))
 	if err != nil {
 		return err
 	}
@@ -37,11 +44,30 @@ func SynchronizeLocalImageMetadata(imageDb datastore.ImageMetadataProvider, cate
 	return nil
 }
 
-func synchronizeLocalImageMetadataScanNewFiles(fileSystemNodes map[string]*localFileStructure.FilesystemNode, imageDb datastore.ImageMetadataProvider, categoryDb datastore.CategoryProvider, checksumCalculator fileChecksumCalculator) error {
+// A file whose checksum got calculated and whose metadata has to be saved.
+type hashedFile struct {
+	file     localFileStructure.FilesystemNode
+	metadata datastore.ImageMetaData
+	md5sum   string
+	checksum string
+	identity string
+	// only the path or the file id changed, the metadata is saved as it is
+	moved bool
+}
+
+// The files are hashed and saved in two stages connected by a channel. The hashing workers are bound by the disk
+// and the CPU while saving is bound by the metadata store, so neither of them waits for the other. The channel holds
+// at most one hashed file per worker to keep the memory bound if saving is slower than hashing.
+func synchronizeLocalImageMetadataScanNewFiles(fileSystemNodes map[string]*localFileStructure.FilesystemNode, imageDb datastore.ImageMetadataProvider, categoryDb datastore.CategoryProvider, checksumCalculator localFileStructure.ChecksumCalculator, hashConcurrency int, compareBy string, moves *moveDetector) error {
 	logrus.Debug("Entering synchronizeLocalImageMetadataScanNewFiles")
 	defer logrus.Debug("Leaving synchronizeLocalImageMetadataScanNewFiles")
 
+	if hashConcurrency <= 0 {
+		hashConcurrency = runtime.GOMAXPROCS(0)
+	}
+
 	workQueue := make(chan localFileStructure.FilesystemNode, 128)
+	hashedQueue := make(chan hashedFile, hashConcurrency)
 
 	wg := sync.WaitGroup{}
 
@@ -49,12 +75,18 @@ func synchronizeLocalImageMetadataScanNewFiles(fileSystemNodes map[string]*local
 	logrus.Debug("Starting change detection producer")
 	go checkFileForChangesProducer(fileSystemNodes, workQueue, &wg)
 
-	for i := 0; i < runtime.NumCPU(); i++ {
+	hashWg := sync.WaitGroup{}
+	for i := 0; i < hashConcurrency; i++ {
 		logrus.Debugf("Starting image change detection worker %d", i)
-		wg.Add(1)
-		go checkFileForChangesWorker(workQueue, &wg, imageDb, categoryDb, checksumCalculator)
+		hashWg.Add(1)
+		go checkFileForChangesWorker(workQueue, hashedQueue, &hashWg, imageDb, categoryDb, checksumCalculator, compareBy, moves)
 	}
 
+	wg.Add(1)
+	go saveHashedFilesWorker(hashedQueue, &wg, imageDb, compareBy)
+
+	hashWg.Wait()
+	close(hashedQueue)
 	wg.Wait()
 	return nil
 }
@@ -67,7 +99,7 @@ func checkFileForChangesProducer(fileSystemNodes map[string]*localFileStructure.
 	close(workQueue)
 }
 
-func checkFileForChangesWorker(workQueue <-chan localFileStructure.FilesystemNode, waitGroup *sync.WaitGroup, imageDb datastore.ImageMetadataProvider, categoryDb datastore.CategoryProvider, checksumCalculator fileChecksumCalculator) {
+func checkFileForChangesWorker(workQueue <-chan localFileStructure.FilesystemNode, hashedQueue chan<- hashedFile, waitGroup *sync.WaitGroup, imageDb datastore.ImageMetadataProvider, categoryDb datastore.CategoryProvider, checksumCalculator localFileStructure.ChecksumCalculator, compareBy string, moves *moveDetector) {
 	for file := range workQueue {
 		if file.IsDir {
 			// we are only interested in files not directories
@@ -91,6 +123,10 @@ func checkFileForChangesWorker(workQueue <-chan localFileStructure.FilesystemNod
 				logrus.Warnf("No category found for image %s - %s", file.Path, err)
 			}
 
+			if moved, found := moves.movedFile(imageDb, &file, metadata); found {
+				hashedQueue <- hashedFile{file: file, metadata: moved, moved: true}
+				continue
+			}
 		} else if err != nil {
 			logrus.Errorf("Could not get metadata due to trouble. Cancelling - %s", err)
 			continue
@@ -98,19 +134,69 @@ func checkFileForChangesWorker(workQueue <-chan localFileStructure.FilesystemNod
 
 		if fileDidNotChange(&metadata, &file) {
 			logrus.Debugf("No changes found for file %s", file.Path)
+			if moves.enabled && file.FileId != "" && (metadata.FileId != file.FileId || metadata.FileSize != file.Size) {
+				// files saved by older versions or restored from a backup are recognized if they get moved later
+				metadata.FileSize = file.Size
+				metadata.FileId = file.FileId
+				hashedQueue <- hashedFile{file: file, metadata: metadata, moved: true}
+			}
 			continue
 		}
 
-		metadata.UploadRequired = !metadata.LastChange.Equal(file.ModTime) || metadata.PiwigoId == 0
-		metadata.DeleteRequired = false
-		metadata.LastChange = file.ModTime
-		metadata.Md5Sum, err = checksumCalculator(file.Path)
+		md5sum, checksum, err := checksumCalculator(file.Path)
 		if err != nil {
 			logrus.Warnf("Could not calculate checksum for file %s. Skipping...", file.Path)
 			continue
 		}
 
-		err = imageDb.SaveImageMetadata(metadata)
+		identity, err := fileIdentity(file.Path, compareBy)
+		if err != nil {
+			logrus.Warnf("Could not read the %s of file %s, comparing it by md5sum - %s", compareBy, file.Path, err)
+		}
+
+		hashedQueue <- hashedFile{file: file, metadata: metadata, md5sum: md5sum, checksum: checksum, identity: identity}
+	}
+	waitGroup.Done()
+}
+
+func saveHashedFilesWorker(hashedQueue <-chan hashedFile, waitGroup *sync.WaitGroup, imageDb datastore.ImageMetadataProvider, compareBy string) {
+	for hashed := range hashedQueue {
+		metadata := hashed.metadata
+		file := hashed.file
+		md5sum := hashed.md5sum
+
+		if hashed.moved {
+			err := imageDb.SaveImageMetadata(metadata)
+			if err != nil {
+				logrus.Errorf("Error during save of metadata of %s - %s", file.Path, err)
+			}
+			continue
+		}
+
+		if contentDidNotChange(&metadata, hashed.checksum) {
+			// only the modification date changed, e.g. by copying or touching the file
+			logrus.Debugf("Content of file %s did not change", file.Path)
+		} else if identityDidNotChange(&metadata, hashed.identity, compareBy) {
+			// the md5sum of the uploaded version is kept, otherwise the server reports a conflict
+			logrus.Debugf("File %s changed but has the same %s, it is not uploaded again", file.Path, compareBy)
+			md5sum = metadata.Md5Sum
+		} else {
+			metadata.UploadRequired = !metadata.LastChange.Equal(file.ModTime) || metadata.PiwigoId == 0
+		}
+		if metadata.Checksum != hashed.checksum {
+			// a changed file may be fixed, so the failed uploads of the old content no longer count
+			metadata.FailureCount = 0
+			metadata.FailureReason = ""
+		}
+		metadata.DeleteRequired = false
+		metadata.LastChange = file.ModTime
+		metadata.Md5Sum = md5sum
+		metadata.Checksum = hashed.checksum
+		metadata.Identity = hashed.identity
+		metadata.FileSize = file.Size
+		metadata.FileId = file.FileId
+
+		err := imageDb.SaveImageMetadata(metadata)
 		if err != nil {
 			logrus.Errorf("Error during save of metadata of %s - %s", file.Path, err)
 		}
@@ -128,7 +214,7 @@ func synchronizeLocalImageMetadataFindFilesToDelete(imageDb datastore.ImageMetad
 	}
 
 	for _, img := range images {
-		if _, err = os.Stat(img.FullImagePath); os.IsNotExist(err) {
+		if _, err = localFileStructure.Stat(img.FullImagePath); os.IsNotExist(err) {
 			img.UploadRequired = false
 			img.DeleteRequired = true
 			err = imageDb.SaveImageMetadata(img)
@@ -140,6 +226,10 @@ func synchronizeLocalImageMetadataFindFilesToDelete(imageDb datastore.ImageMetad
 	return nil
 }
 
+func contentDidNotChange(metadata *datastore.ImageMetaData, checksum string) bool {
+	return metadata.PiwigoId > 0 && !metadata.UploadRequired && metadata.Checksum != "" && metadata.Checksum == checksum
+}
+
 func fileDidNotChange(metadata *datastore.ImageMetaData, file *localFileStructure.FilesystemNode) bool {
 	return metadata.LastChange.Equal(file.ModTime) && !metadata.DeleteRequired
 }
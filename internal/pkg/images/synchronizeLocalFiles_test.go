@@ -6,12 +6,16 @@
 package images
 
 //go:generate mockgen -destination=./piwigo_mock_test.go -package=images git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo CategoryApi,ImageApi
-//go:generate mockgen -destination=./datastore_mock_test.go -package=images git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore ImageMetadataProvider,CategoryProvider
+//go:generate mockgen -destination=./datastore_mock_test.go -package=images git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore ImageMetadataProvider,CategoryProvider,AlbumCursorProvider,DeferredMetadataProvider,RawFormatProvider
 
 import (
+	"fmt"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
 	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -30,7 +34,7 @@ func Test_synchronize_local_image_metadata_should_find_nothing_if_empty(t *testi
 
 	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{}
 
-	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator)
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -64,7 +68,7 @@ func Test_synchronize_local_image_metadata_should_add_new_metadata(t *testing.T)
 	db.EXPECT().SaveImageMetadata(image).Times(1)
 
 	// execute the sync metadata based on the file system results
-	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator)
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -99,7 +103,7 @@ func Test_synchronize_local_image_metadata_should_mark_unchanged_entries_without
 	db.EXPECT().SaveImageMetadata(imageExptected).Times(1)
 
 	// execute the sync metadata based on the file system results
-	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator)
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -136,7 +140,40 @@ func Test_synchronize_local_image_metadata_should_mark_changed_entries_as_upload
 	db.EXPECT().SaveImageMetadata(imageExptected).Times(1)
 
 	// execute the sync metadata based on the file system results
-	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator)
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_synchronize_local_image_metadata_should_not_mark_touched_files_with_same_checksum_as_uploads(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoryMock := NewMockCategoryProvider(mockCtrl)
+
+	testFileSystemNode := &localFileStructure.FilesystemNode{
+		Key:     "2019/shooting1/abc.jpg",
+		ModTime: time.Date(2019, 01, 01, 01, 0, 0, 0, time.UTC),
+		Name:    "abc.jpg",
+		Path:    "2019/shooting1/abc.jpg",
+		IsDir:   false}
+
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{}
+	fileSystemNodes[testFileSystemNode.Key] = testFileSystemNode
+
+	imageExptected := createImageMetaDataFromFilesystem(testFileSystemNode, 1, false, false)
+
+	imageStored := imageExptected
+	imageStored.LastChange = time.Date(2019, 01, 01, 00, 0, 0, 0, time.UTC)
+
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadataAll().Times(1)
+	db.EXPECT().ImageMetadata(testFileSystemNode.Key).Return(imageStored, nil).Times(1)
+	db.EXPECT().SaveImageMetadata(imageExptected).Times(1)
+
+	// execute the sync metadata based on the file system results
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -173,7 +210,7 @@ func Test_synchronize_local_image_metadata_should_not_mark_unchanged_files_to_up
 	db.EXPECT().SaveImageMetadata(imageExptected).Times(1)
 
 	// execute the sync metadata based on the file system results
-	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator)
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -202,7 +239,7 @@ func Test_synchronize_local_image_metadata_should_not_process_directories(t *tes
 	db.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
 
 	// execute the sync metadata based on the file system results
-	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator)
+	err := SynchronizeLocalImageMetadata(db, categoryMock, fileSystemNodes, testChecksumCalculator, 0, CompareByMd5, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -229,9 +266,77 @@ func Test_synchronizeLocalImageMetadataFindFilesToDelete(t *testing.T) {
 	}
 }
 
+// Hashing and saving one file after the other, as a baseline for the pipelined synchronization.
+func BenchmarkSynchronizeLocalImageMetadataSequential(b *testing.B) {
+	fileSystemNodes, db, _, checksumCalculator := setupSynchronizeBenchmark(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, file := range fileSystemNodes {
+			md5sum, checksum, err := checksumCalculator(file.Path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = db.SaveImageMetadata(datastore.ImageMetaData{FullImagePath: file.Path, Md5Sum: md5sum, Checksum: checksum})
+		}
+	}
+}
+
+func BenchmarkSynchronizeLocalImageMetadataPipelined(b *testing.B) {
+	fileSystemNodes, db, categoryMock, checksumCalculator := setupSynchronizeBenchmark(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := synchronizeLocalImageMetadataScanNewFiles(fileSystemNodes, db, categoryMock, checksumCalculator, 0, CompareByMd5, newMoveDetector(false))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Creates a directory of many files and a metadata store whose writes take about as long as a sqlite insert.
+func setupSynchronizeBenchmark(b *testing.B) (map[string]*localFileStructure.FilesystemNode, *MockImageMetadataProvider, *MockCategoryProvider, localFileStructure.ChecksumCalculator) {
+	mockCtrl := gomock.NewController(b)
+	b.Cleanup(mockCtrl.Finish)
+
+	dir, err := ioutil.TempDir("", "hashbenchmark")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	content := make([]byte, 256*1024)
+	fileSystemNodes := map[string]*localFileStructure.FilesystemNode{}
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("image%03d.jpg", i)
+		path := filepath.Join(dir, name)
+		content[0] = byte(i)
+		err = ioutil.WriteFile(path, content, 0644)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fileSystemNodes[name] = &localFileStructure.FilesystemNode{Key: name, Path: path, Name: name, ModTime: time.Now()}
+	}
+
+	db := NewMockImageMetadataProvider(mockCtrl)
+	db.EXPECT().ImageMetadata(gomock.Any()).AnyTimes().Return(datastore.ImageMetaData{}, datastore.ErrorRecordNotFound)
+	db.EXPECT().SaveImageMetadata(gomock.Any()).AnyTimes().DoAndReturn(func(datastore.ImageMetaData) error {
+		time.Sleep(100 * time.Microsecond)
+		return nil
+	})
+	categoryMock := NewMockCategoryProvider(mockCtrl)
+	categoryMock.EXPECT().GetCategoryByKey(gomock.Any()).AnyTimes().Return(datastore.CategoryData{PiwigoId: 1}, nil)
+
+	checksumCalculator, err := localFileStructure.NewChecksumCalculator(localFileStructure.ChecksumMd5)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return fileSystemNodes, db, categoryMock, checksumCalculator
+}
+
 // to make the sync testable, we pass in a simple mock that returns the filepath as checksum
-func testChecksumCalculator(file string) (string, error) {
-	return file, nil
+func testChecksumCalculator(file string) (string, string, error) {
+	return file, "sha1:" + file, nil
 }
 
 func createTestImageMetaData(piwigoId int) datastore.ImageMetaData {
@@ -249,6 +354,7 @@ func createTestImageMetaData(piwigoId int) datastore.ImageMetaData {
 func createImageMetaDataFromFilesystem(testFileSystemNode *localFileStructure.FilesystemNode, piwigoId int, uploadRequired bool, deleteRequired bool) datastore.ImageMetaData {
 	imageExptected := datastore.ImageMetaData{
 		Md5Sum:         testFileSystemNode.Key,
+		Checksum:       "sha1:" + testFileSystemNode.Key,
 		FullImagePath:  testFileSystemNode.Key,
 		PiwigoId:       piwigoId,
 		UploadRequired: uploadRequired,
@@ -6,18 +6,45 @@
 package images
 
 import (
+	"errors"
+	"fmt"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
 	"github.com/sirupsen/logrus"
 )
 
+// Policies how to handle images that are up to date in the local metadata but differ on the server.
+const (
+	// the local file is uploaded again to replace the image on the server
+	ConflictPolicyLocal = "local"
+	// the local metadata is updated to match the server, the image on the server is kept
+	ConflictPolicyServer = "server"
+	// the conflict is logged and nothing is changed
+	ConflictPolicySkip = "skip"
+)
+
 // This method aggregates the check for files with missing piwigoids and if changed files need to be uploaded again.
-func SynchronizePiwigoMetadata(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider) error {
+// If reconcileExisting is set, uploaded images that no longer exist on the server are uploaded again.
+// If compareBy is not md5, images unknown by their md5sum are looked up by their filename in their album as well.
+func SynchronizePiwigoMetadata(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, conflictPolicy string, reconcileExisting bool, compareBy string) error {
 	logrus.Debug("Entering SynchronizePiwigoMetadata")
 	defer logrus.Debug("Leaving SynchronizePiwigoMetadata")
 
+	if conflictPolicy != ConflictPolicyLocal && conflictPolicy != ConflictPolicyServer && conflictPolicy != ConflictPolicySkip {
+		return errors.New(fmt.Sprintf("unknown conflict policy %s. Use one of local, server or skip", conflictPolicy))
+	}
+	err := checkCompareBy(compareBy)
+	if err != nil {
+		return err
+	}
+
 	// TODO: check if category has to be assigned (image possibly added to two albums -> only uploaded once but assigned multiple times) -> implement later
-	err := updatePiwigoIdIfAlreadyUploaded(metadataProvider, piwigoCtx)
+	err = updatePiwigoIdIfAlreadyUploaded(metadataProvider, piwigoCtx)
+	if err != nil {
+		return err
+	}
+
+	err = updatePiwigoIdByPath(metadataProvider, piwigoCtx, compareBy)
 	if err != nil {
 		return err
 	}
@@ -27,6 +54,11 @@ func SynchronizePiwigoMetadata(piwigoCtx piwigo.ImageApi, metadataProvider datas
 		return err
 	}
 
+	err = checkPiwigoForConflicts(metadataProvider, piwigoCtx, conflictPolicy, reconcileExisting)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -117,3 +149,92 @@ func checkPiwigoForChangedImages(provider datastore.ImageMetadataProvider, piwig
 
 	return nil
 }
+
+// Checks if the images that are up to date in the local metadata still match the version on the server. This detects
+// images that got changed on the server (e.g. edited using the piwigo ui). To keep the number of requests low, the
+// md5sums are looked up in batches and only images whose md5sum is no longer known by the server are fetched.
+// Images missing on the server are only uploaded again if reconcileExisting is set. Otherwise the categories
+// that already exist are assumed to be complete.
+func checkPiwigoForConflicts(provider datastore.ImageMetadataProvider, piwigoCtx piwigo.ImageApi, conflictPolicy string, reconcileExisting bool) error {
+	logrus.Info("Checking uploaded files for changes on the server...")
+	defer logrus.Info("Finished checking uploaded files for changes on the server...")
+
+	images, err := provider.ImageMetadataAll()
+	if err != nil {
+		return err
+	}
+
+	uploadedImages := make([]datastore.ImageMetaData, 0, len(images))
+	md5sums := make([]string, 0, len(images))
+	for _, img := range images {
+		if img.PiwigoId > 0 && !img.UploadRequired && !img.DeleteRequired {
+			uploadedImages = append(uploadedImages, img)
+			md5sums = append(md5sums, img.Md5Sum)
+		}
+	}
+
+	if len(uploadedImages) == 0 {
+		logrus.Debug("There are no uploaded images to check for conflicts.")
+		return nil
+	}
+
+	existResults, err := piwigoCtx.ImagesExistOnPiwigo(md5sums)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range uploadedImages {
+		if existResults[img.Md5Sum] == img.PiwigoId {
+			continue
+		}
+
+		var info *piwigo.ImageInfo
+		info, err = piwigoCtx.GetImageInfo(img.PiwigoId)
+		if errors.Is(err, piwigo.ErrorImageNotFound) && reconcileExisting {
+			reuploadMissingImage(provider, img)
+			continue
+		}
+		if err != nil {
+			logrus.Warnf("%s: could not get image %d from the server to check for conflicts - %s", img.FullImagePath, img.PiwigoId, err)
+			continue
+		}
+
+		if info.Md5Sum == "" || info.Md5Sum == img.Md5Sum {
+			continue
+		}
+
+		resolveConflict(provider, img, info, conflictPolicy)
+	}
+
+	return nil
+}
+
+func reuploadMissingImage(provider datastore.ImageMetadataProvider, img datastore.ImageMetaData) {
+	logrus.Infof("%s: image %d is missing on the server. Uploading it again.", img.FullImagePath, img.PiwigoId)
+	img.PiwigoId = 0
+	img.UploadRequired = true
+
+	err := provider.SaveImageMetadata(img)
+	if err != nil {
+		logrus.Warnf("Could not save image data of image %s", img.FullImagePath)
+	}
+}
+
+func resolveConflict(provider datastore.ImageMetadataProvider, img datastore.ImageMetaData, info *piwigo.ImageInfo, conflictPolicy string) {
+	switch conflictPolicy {
+	case ConflictPolicyLocal:
+		logrus.Infof("%s: image %d differs on the server. Uploading the local file again.", img.FullImagePath, img.PiwigoId)
+		img.UploadRequired = true
+	case ConflictPolicyServer:
+		logrus.Infof("%s: image %d differs on the server. Keeping the version of the server.", img.FullImagePath, img.PiwigoId)
+		img.Md5Sum = info.Md5Sum
+	default:
+		logrus.Warnf("%s: image %d differs on the server (local md5sum %s, server md5sum %s). Skipping...", img.FullImagePath, img.PiwigoId, img.Md5Sum, info.Md5Sum)
+		return
+	}
+
+	err := provider.SaveImageMetadata(img)
+	if err != nil {
+		logrus.Warnf("Could not save image data of image %s", img.FullImagePath)
+	}
+}
@@ -200,3 +200,150 @@ func Test_updatePiwigoIdIfAlreadyUploaded_with_image_to_check_missing_on_server(
 		t.Error(err)
 	}
 }
+
+func Test_checkPiwigoForConflicts_does_not_fetch_matching_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createUploadedTestImageMetaData()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo([]string{img.Md5Sum}).Return(map[string]int{img.Md5Sum: img.PiwigoId}, nil)
+	piwigomock.EXPECT().GetImageInfo(gomock.Any()).Times(0)
+
+	err := checkPiwigoForConflicts(dbmock, piwigomock, ConflictPolicyLocal, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_checkPiwigoForConflicts_local_policy_marks_image_for_upload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createUploadedTestImageMetaData()
+	imgToSave := img
+	imgToSave.UploadRequired = true
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := createConflictingPiwigoMock(mockCtrl, img)
+
+	err := checkPiwigoForConflicts(dbmock, piwigomock, ConflictPolicyLocal, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_checkPiwigoForConflicts_server_policy_updates_md5sum(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createUploadedTestImageMetaData()
+	imgToSave := img
+	imgToSave.Md5Sum = "server"
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := createConflictingPiwigoMock(mockCtrl, img)
+
+	err := checkPiwigoForConflicts(dbmock, piwigomock, ConflictPolicyServer, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_checkPiwigoForConflicts_skip_policy_changes_nothing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createUploadedTestImageMetaData()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := createConflictingPiwigoMock(mockCtrl, img)
+
+	err := checkPiwigoForConflicts(dbmock, piwigomock, ConflictPolicySkip, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_checkPiwigoForConflicts_reconcile_uploads_missing_image_again(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createUploadedTestImageMetaData()
+	imgToSave := img
+	imgToSave.PiwigoId = 0
+	imgToSave.UploadRequired = true
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := createMissingImagePiwigoMock(mockCtrl, img)
+
+	err := checkPiwigoForConflicts(dbmock, piwigomock, ConflictPolicySkip, true)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_checkPiwigoForConflicts_without_reconcile_ignores_missing_image(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createUploadedTestImageMetaData()
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := createMissingImagePiwigoMock(mockCtrl, img)
+
+	err := checkPiwigoForConflicts(dbmock, piwigomock, ConflictPolicySkip, false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SynchronizePiwigoMetadata_rejects_unknown_conflict_policy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	err := SynchronizePiwigoMetadata(NewMockImageApi(mockCtrl), NewMockImageMetadataProvider(mockCtrl), "unknown", false, CompareByMd5)
+	if err == nil {
+		t.Error("Expected an error for an unknown conflict policy")
+	}
+}
+
+func createUploadedTestImageMetaData() datastore.ImageMetaData {
+	img := createTestImageMetaData(5)
+	img.UploadRequired = false
+	return img
+}
+
+func createConflictingPiwigoMock(mockCtrl *gomock.Controller, img datastore.ImageMetaData) *MockImageApi {
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo([]string{img.Md5Sum}).Return(map[string]int{img.Md5Sum: 0}, nil)
+	piwigomock.EXPECT().GetImageInfo(img.PiwigoId).Return(&piwigo.ImageInfo{Id: img.PiwigoId, Md5Sum: "server"}, nil)
+	return piwigomock
+}
+
+func createMissingImagePiwigoMock(mockCtrl *gomock.Controller, img datastore.ImageMetaData) *MockImageApi {
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().ImagesExistOnPiwigo([]string{img.Md5Sum}).Return(map[string]int{img.Md5Sum: 0}, nil)
+	piwigomock.EXPECT().GetImageInfo(img.PiwigoId).Return(nil, piwigo.ErrorImageNotFound)
+	return piwigomock
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// How the names of images that would get the same name as another image of their category are made unique.
+const (
+	// appends the position of the image among the images with the same name ordered by path, like "Sunset (2)"
+	NameSuffixNumeric = "numeric"
+	// appends the beginning of the md5sum of the image, like "Sunset (3f2a9c1b)", which does not change if other
+	// images with the same name are added
+	NameSuffixHash = "hash"
+)
+
+// the number of characters of the md5sum appended by NameSuffixHash
+const nameSuffixHashLength = 8
+
+func checkNameSuffix(suffix string) error {
+	if suffix != "" && suffix != NameSuffixNumeric && suffix != NameSuffixHash {
+		return errors.New(fmt.Sprintf("unknown name suffix %s. Use one of numeric or hash", suffix))
+	}
+	return nil
+}
+
+// The unique names of the images to upload whose name collides with another image of the same category by path.
+type uniqueNames struct {
+	names map[string]string
+}
+
+// Returns the unique name of the image or false if the image keeps the name of its file or its IPTC ObjectName.
+func (n *uniqueNames) lookup(filePath string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	name, found := n.names[filePath]
+	return name, found
+}
+
+// Finds the images to upload that get the same name as another local image of their category. The first of them by
+// path keeps the name, the others get the suffix. All local images of the categories are considered, so the same
+// image gets the same name on every run. The names are the ObjectNames if metadataFromIptc is set and the file names
+// otherwise, which is the name piwigo gives the uploaded images.
+func findUniqueNames(metadataProvider datastore.ImageMetadataProvider, images []datastore.ImageMetaData, suffix string, metadataFromIptc bool) (*uniqueNames, error) {
+	if suffix == "" || len(images) == 0 {
+		return nil, nil
+	}
+
+	uploaded := make(map[int]bool)
+	for _, img := range images {
+		uploaded[img.CategoryPiwigoId] = true
+	}
+	queued := make(map[string]bool, len(images))
+	for _, img := range images {
+		queued[img.FullImagePath] = true
+	}
+
+	all, err := metadataProvider.ImageMetadataAll()
+	if err != nil {
+		return nil, err
+	}
+	categories := make(map[int][]datastore.ImageMetaData)
+	for _, img := range all {
+		if uploaded[img.CategoryPiwigoId] && !img.DeleteRequired {
+			categories[img.CategoryPiwigoId] = append(categories[img.CategoryPiwigoId], img)
+		}
+	}
+
+	unique := &uniqueNames{names: make(map[string]string)}
+	for _, category := range categories {
+		for path, name := range uniqueCategoryNames(category, suffix, metadataFromIptc) {
+			if queued[path] {
+				unique.names[path] = name
+			}
+		}
+	}
+	if len(unique.names) > 0 {
+		logrus.Infof("Disambiguated the names of %d images that got the same name as another image of their category", len(unique.names))
+	}
+	return unique, nil
+}
+
+// Returns the new names of the images of the category whose name is already used by another one.
+func uniqueCategoryNames(images []datastore.ImageMetaData, suffix string, metadataFromIptc bool) map[string]string {
+	sort.Slice(images, func(i, j int) bool { return images[i].FullImagePath < images[j].FullImagePath })
+
+	type namedImage struct {
+		img      datastore.ImageMetaData
+		name     string
+		fromFile bool
+	}
+	used := make(map[string]bool, len(images))
+	byName := make(map[string][]namedImage)
+	var names []string
+	for _, img := range images {
+		name, fromFile := displayName(img, metadataFromIptc)
+		if _, found := byName[name]; !found {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], namedImage{img: img, name: name, fromFile: fromFile})
+		used[name] = true
+	}
+
+	renamed := make(map[string]string)
+	for _, name := range names {
+		collisions := byName[name]
+		for i, collision := range collisions[1:] {
+			var unique string
+			for attempt := 0; ; attempt++ {
+				value := strconv.Itoa(i + 2 + attempt)
+				if suffix == NameSuffixHash {
+					value = collision.img.Md5Sum
+					if len(value) > nameSuffixHashLength {
+						value = value[:nameSuffixHashLength]
+					}
+					if attempt > 0 {
+						// another image with the same name has the same content
+						value = fmt.Sprintf("%s-%d", value, attempt+1)
+					}
+				}
+				unique = appendNameSuffix(collision.name, collision.fromFile, value)
+				if !used[unique] {
+					break
+				}
+			}
+			used[unique] = true
+			renamed[collision.img.FullImagePath] = unique
+		}
+	}
+	return renamed
+}
+
+// Returns the name of the image on the server and whether it is the name of the file.
+func displayName(img datastore.ImageMetaData, metadataFromIptc bool) (string, bool) {
+	if metadataFromIptc {
+		iptc, found, err := readIptc(img.FullImagePath)
+		if err == nil && found && iptc.Name != "" {
+			return iptc.Name, false
+		}
+	}
+	return filepath.Base(img.FullImagePath), true
+}
+
+// Appends the suffix to the name, in front of the extension if the name is a file name.
+func appendNameSuffix(name string, fromFile bool, suffix string) string {
+	extension := ""
+	if fromFile {
+		extension = filepath.Ext(name)
+		name = name[:len(name)-len(extension)]
+	}
+	return fmt.Sprintf("%s (%s)%s", name, suffix, extension)
+}
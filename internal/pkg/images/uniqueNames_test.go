@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"testing"
+)
+
+func createUniqueNameTestImages() []datastore.ImageMetaData {
+	return []datastore.ImageMetaData{
+		{FullImagePath: "/photos/b/IMG (2).jpg", Md5Sum: "22222222222222222222222222222222", CategoryPiwigoId: 2},
+		{FullImagePath: "/photos/a/IMG.jpg", Md5Sum: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", CategoryPiwigoId: 2},
+		{FullImagePath: "/photos/c/Other.jpg", Md5Sum: "cccccccccccccccccccccccccccccccc", CategoryPiwigoId: 2},
+		{FullImagePath: "/photos/A/IMG.jpg", Md5Sum: "11111111111111111111111111111111", CategoryPiwigoId: 2},
+	}
+}
+
+func Test_uniqueCategoryNames_numbers_the_images_with_the_same_name(t *testing.T) {
+	renamed := uniqueCategoryNames(createUniqueNameTestImages(), NameSuffixNumeric, false)
+
+	// the first image by path keeps the name and the suffix skips the name of the other image
+	if len(renamed) != 1 || renamed["/photos/a/IMG.jpg"] != "IMG (3).jpg" {
+		t.Errorf("unexpected names %v", renamed)
+	}
+}
+
+func Test_uniqueCategoryNames_appends_the_md5sum(t *testing.T) {
+	renamed := uniqueCategoryNames(createUniqueNameTestImages(), NameSuffixHash, false)
+
+	if len(renamed) != 1 || renamed["/photos/a/IMG.jpg"] != "IMG (aaaaaaaa).jpg" {
+		t.Errorf("unexpected names %v", renamed)
+	}
+}
+
+func Test_uniqueCategoryNames_is_independent_of_the_order(t *testing.T) {
+	images := createUniqueNameTestImages()
+	reversed := make([]datastore.ImageMetaData, 0, len(images))
+	for i := len(images) - 1; i >= 0; i-- {
+		reversed = append(reversed, images[i])
+	}
+
+	first := uniqueCategoryNames(images, NameSuffixNumeric, false)
+	second := uniqueCategoryNames(reversed, NameSuffixNumeric, false)
+	if len(first) != len(second) || first["/photos/a/IMG.jpg"] != second["/photos/a/IMG.jpg"] {
+		t.Errorf("expected the same names on every run but got %v and %v", first, second)
+	}
+}
+
+func Test_uploadImages_names_images_with_the_same_name_uniquely(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = "/photos/a/IMG.jpg"
+	uploaded := img
+	uploaded.PiwigoId = 5
+	uploaded.UploadRequired = false
+	other := datastore.ImageMetaData{FullImagePath: "/photos/A/IMG.jpg", PiwigoId: 4, Md5Sum: "4321", CategoryPiwigoId: 2}
+	otherCategory := datastore.ImageMetaData{FullImagePath: "/photos/0/IMG.jpg", PiwigoId: 3, Md5Sum: "5678", CategoryPiwigoId: 3}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().ImageMetadataAll().Return([]datastore.ImageMetaData{img, other, otherCategory}, nil)
+	dbmock.EXPECT().SaveImageMetadata(uploaded)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, img.FullImagePath, "1234", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), 1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		if len(updates) != 1 || updates[0].PiwigoId != 5 || updates[0].Fields.Get("name") != "IMG (2).jpg" {
+			t.Errorf("expected the unique name of image 5 but got %v", updates)
+		}
+		return piwigo.ImageInfoUpdateResult{}, nil
+	})
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, NameSuffix: NameSuffixNumeric})
+	if err != nil {
+		t.Error(err)
+	}
+}
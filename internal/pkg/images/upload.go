@@ -6,15 +6,110 @@
 package images
 
 import (
+	"errors"
+	"fmt"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/hooks"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/transform"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
 	"github.com/sirupsen/logrus"
+	"strconv"
 	"sync"
+	"time"
 )
 
+type UploadOptions struct {
+	NumberOfWorkers int
+	// The number of albums whose images are uploaded at the same time. The images are grouped by album in the order
+	// of their first image. Zero uploads the images of all albums at the same time.
+	MaxActiveAlbums int
+	// Overrides the number of workers for the images below directories with a concurrency marker file.
+	ConcurrencyOverrides *localFileStructure.ConcurrencyOverrides
+	// Images larger than this are not uploaded. Zero disables the check.
+	MaxImageSizeInMB int
+	// If set, oversized images abort the upload before anything is sent instead of being skipped.
+	FailOnOversizedImages bool
+	// Decodes the images before the upload and reports the corrupt ones as invalid instead of uploading them.
+	ValidateImages bool
+	// The minimum dimensions of validated images. Zero disables the check.
+	MinImageWidth  int
+	MinImageHeight int
+	// Sets the date available of uploaded images to the date of the file instead of the time of the upload.
+	SetDateAvailable bool
+	// Sets the creation date of uploaded images from the exif date or the date of the file, DateCreationExif or
+	// DateCreationModTime. Empty keeps the date the server read from the image.
+	DateCreationFrom string
+	// The time zone the server interprets the dates in, the dates of the files are sent in it. Nil uses the local time
+	// zone.
+	Timezone *time.Location
+	// Sets the dimensions and the file size of uploaded images the server did not fill in, read from the header of the
+	// uploaded file.
+	SetDimensions bool
+	// Lets the server generate the derivatives of uploaded images right away instead of on the first view.
+	GenerateDerivatives bool
+	// Uploads the images untouched as originals and lets the server generate the web sizes right away. The stored
+	// image is checked to report originals the server resized.
+	KeepOriginal bool
+	// Transformations applied to the images before the upload. Nil uploads the files as they are.
+	Transformations *transform.Pipeline
+	// The order in which the images are queued. Empty keeps the order of the metadata store.
+	UploadOrder string
+	// Called with the image path before the upload. The image is skipped if the hook fails.
+	PreUploadHook *hooks.Hook
+	// Called with the image path and the piwigo id after the upload.
+	PostUploadHook *hooks.Hook
+	// If set, a failing post upload hook marks the image as failed and keeps it scheduled for the next run.
+	RequirePostUploadHook bool
+	// Images are quarantined after this many consecutive failed uploads and skipped on later runs. Zero disables it.
+	MaxUploadFailures int
+	// Uploads quarantined images again instead of skipping them.
+	RetryQuarantined bool
+	// Uploads only the images that changed after the latest image got added to their category on the server.
+	NewerThanServer bool
+	// What happens with images that changed after their md5sum got calculated: skip, retry or error. Empty uploads
+	// them without checking.
+	OnFileChanged string
+	// Calculates the md5sum of changed images again if OnFileChanged is retry.
+	ChecksumCalculator localFileStructure.ChecksumCalculator
+	// Collects the uploaded images by category to choose the covers afterwards. Nil does not collect them.
+	Uploaded *UploadedImages
+	// Tracks how many images of each album got uploaded to resume within the album on the next run. Nil does not track
+	// them. The images are uploaded ordered by path if no upload order is set.
+	AlbumCursors *AlbumCursors
+	// Saves the date available, the dimensions and the images for the covers instead of setting them right away, so
+	// they are set by ApplyDeferredMetadata after all images got uploaded. Nil sets them during the upload.
+	DeferredMetadata datastore.DeferredMetadataProvider
+	// Sets the name, the comment and the tags of the uploaded images from their IPTC ObjectName, Caption-Abstract and
+	// Keywords.
+	MetadataFromIptc bool
+	// Deletes the images created in an album during the run again if not all images of the album could be uploaded,
+	// so albums are uploaded all or nothing. Requires the permission to delete images.
+	AlbumAtomic bool
+	// Uploads a preview of the new jpeg images before the originals, so the gallery can be browsed early. The
+	// previews are written to the work directory.
+	PreviewFirst bool
+	WorkDir      *workdir.WorkDir
+	// Compares the file stored on the server with the uploaded file after the upload: full, sampled or none. A
+	// differing file is reported as failed upload and uploaded again on the next run.
+	VerifyMode string
+	// The id of the running upload run. Images are marked with it while they are uploaded to resume them after a crash.
+	RunId  int
+	Report *report.Report
+	// Appends a suffix to the names of images that would get the same name as another image of their category:
+	// numeric or hash. Empty keeps the names.
+	NameSuffix string
+	// the albums of the run if AlbumAtomic is set
+	transactions *albumTransactions
+	// the images to upload that get a unique name
+	names *uniqueNames
+}
+
 // Uploads the pending images to the piwigo gallery and assign the category of to the image.
 // Update local metadata and set upload flag to false. Also updates the piwigo image id if there was a difference.
-func UploadImages(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, numberOfWorkers int) error {
+func UploadImages(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, options UploadOptions) error {
 	logrus.Debug("Starting uploadImages")
 	defer logrus.Debug("Finished uploadImages successfully")
 
@@ -23,65 +118,487 @@ func UploadImages(piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMet
 		return err
 	}
 
+	err = checkFileChangedPolicy(options.OnFileChanged)
+	if err != nil {
+		return err
+	}
+	err = checkVerifyMode(options.VerifyMode)
+	if err != nil {
+		return err
+	}
+	err = checkNameSuffix(options.NameSuffix)
+	if err != nil {
+		return err
+	}
+	err = checkDateCreationSource(options.DateCreationFrom)
+	if err != nil {
+		return err
+	}
+
+	images = removeQuarantinedImages(images, options)
+
+	images, err = removeImagesNotNewerThanServer(piwigoCtx, images, options)
+	if err != nil {
+		return err
+	}
+
+	images, err = removeOversizedImages(images, options)
+	if err != nil {
+		return err
+	}
+
+	uploadOrder := options.UploadOrder
+	if uploadOrder == "" && options.AlbumCursors != nil {
+		// the cursors only advance over images without gap
+		uploadOrder = UploadOrderPath
+	}
+	err = sortImages(images, uploadOrder)
+	if err != nil {
+		return err
+	}
+
 	if len(images) == 0 {
 		logrus.Info("No images to upload.")
 		return nil
 	}
 
+	numberOfWorkers := options.NumberOfWorkers
 	if numberOfWorkers <= 0 {
 		logrus.Warnf("Invalid numbers of worker set: %d falling back to default of 4", numberOfWorkers)
 		numberOfWorkers = 4
 	}
 
+	if options.AlbumAtomic {
+		options.transactions = newAlbumTransactions(images)
+	}
+	options.names, err = findUniqueNames(metadataProvider, images, options.NameSuffix, options.MetadataFromIptc)
+	if err != nil {
+		return err
+	}
+
+	limiter := newUploadLimiter(numberOfWorkers, options.ConcurrencyOverrides)
+	numberOfWorkers = limiter.workers()
+	albums := newAlbumLimiter(options.MaxActiveAlbums)
+
+	if options.PreviewFirst {
+		images = uploadPreviews(piwigoCtx, metadataProvider, images, limiter, numberOfWorkers, options)
+	}
+
 	logrus.Infof("Uploading %d images to piwigo using %d workers", len(images), numberOfWorkers)
 	workQueue := make(chan datastore.ImageMetaData, numberOfWorkers)
 
 	wg := sync.WaitGroup{}
+	uploads := newUploadGroup()
+	infoUpdates := &imageInfoUpdates{}
+	abort := &uploadAbort{}
 
 	wg.Add(1)
-	go uploadQueueProducer(images, workQueue, &wg)
+	go uploadQueueProducer(images, workQueue, albums, &wg)
 
 	for i := 0; i < numberOfWorkers; i++ {
 		logrus.Debugf("Starting image upload worker %d", i)
 		wg.Add(1)
-		go uploadQueueWorker(workQueue, piwigoCtx, metadataProvider, &wg)
+		go uploadQueueWorker(workQueue, piwigoCtx, metadataProvider, uploads, limiter, albums, infoUpdates, abort, options, &wg)
 	}
 
 	wg.Wait()
-	return nil
+	if options.transactions != nil {
+		deleted, err := options.transactions.finish(piwigoCtx, metadataProvider, options)
+		infoUpdates.remove(deleted)
+		if err != nil {
+			infoUpdates.apply(piwigoCtx, numberOfWorkers)
+			return err
+		}
+	}
+	infoUpdates.apply(piwigoCtx, numberOfWorkers)
+	return abort.get()
 }
 
-func uploadQueueWorker(workQueue <-chan datastore.ImageMetaData, piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, waitGroup *sync.WaitGroup) {
-	for img := range workQueue {
-		logrus.Debugf("%s: uploading image to piwigo", img.FullImagePath)
+func removeQuarantinedImages(images []datastore.ImageMetaData, options UploadOptions) []datastore.ImageMetaData {
+	if options.MaxUploadFailures <= 0 {
+		return images
+	}
 
-		imgId, err := piwigoCtx.UploadImage(img.PiwigoId, img.FullImagePath, img.Md5Sum, img.CategoryPiwigoId)
-		if err != nil {
-			logrus.Warnf("%s: could not upload image. Continuing with the next image.", img.FullImagePath)
+	imagesToUpload := make([]datastore.ImageMetaData, 0, len(images))
+	for _, img := range images {
+		if !isQuarantined(img, options) {
+			imagesToUpload = append(imagesToUpload, img)
 			continue
 		}
 
-		if imgId > 0 && imgId != img.PiwigoId {
-			img.PiwigoId = imgId
-			logrus.Debugf("%s: Updating image %d with piwigo id %d", img.FullImagePath, img.ImageId, img.PiwigoId)
+		if options.RetryQuarantined {
+			logrus.Infof("%s: Retrying quarantined image", img.FullImagePath)
+			imagesToUpload = append(imagesToUpload, img)
+			continue
 		}
-		logrus.Infof("%s: Successfully uploaded", img.FullImagePath)
 
-		img.UploadRequired = false
-		err = metadataProvider.SaveImageMetadata(img)
+		logrus.Debugf("%s: Skipping quarantined image", img.FullImagePath)
+		options.Report.AddQuarantined(img.FullImagePath, fmt.Sprintf("%d failed uploads, last error: %s", img.FailureCount, img.FailureReason))
+	}
+	return imagesToUpload
+}
+
+func isQuarantined(img datastore.ImageMetaData, options UploadOptions) bool {
+	return options.MaxUploadFailures > 0 && img.FailureCount >= options.MaxUploadFailures
+}
+
+// Checks the size of all images before the upload starts. This prevents failing uploads deep in the
+// chunk upload if the server does not accept files of that size.
+func removeOversizedImages(images []datastore.ImageMetaData, options UploadOptions) ([]datastore.ImageMetaData, error) {
+	if options.MaxImageSizeInMB <= 0 {
+		return images, nil
+	}
+
+	maxSizeInBytes := int64(options.MaxImageSizeInMB) * 1024 * 1024
+	imagesToUpload := make([]datastore.ImageMetaData, 0, len(images))
+	numberOfOversizedImages := 0
+
+	for _, img := range images {
+		fileInfo, err := localFileStructure.Stat(img.FullImagePath)
 		if err != nil {
-			logrus.Warnf("%s: could not save uploaded image. Continuing with the next image.", img.FullImagePath)
+			reason := fmt.Sprintf("could not check the size of the image: %s", err)
+			logrus.Warnf("%s: %s. Skipping...", img.FullImagePath, reason)
+			options.Report.AddSkipped(img.FullImagePath, reason)
+			continue
+		}
+		if fileInfo.Size() <= maxSizeInBytes {
+			imagesToUpload = append(imagesToUpload, img)
 			continue
 		}
+
+		numberOfOversizedImages++
+		reason := fmt.Sprintf("size of %d MB exceeds the maximum of %d MB", fileInfo.Size()/1024/1024, options.MaxImageSizeInMB)
+		if options.FailOnOversizedImages {
+			logrus.Errorf("%s: %s", img.FullImagePath, reason)
+			continue
+		}
+
+		logrus.Warnf("%s: %s. Skipping...", img.FullImagePath, reason)
+		options.Report.AddSkipped(img.FullImagePath, reason)
+	}
+
+	if options.FailOnOversizedImages && numberOfOversizedImages > 0 {
+		return nil, errors.New(fmt.Sprintf("%d images exceed the maximum size of %d MB. Nothing got uploaded", numberOfOversizedImages, options.MaxImageSizeInMB))
+	}
+
+	return imagesToUpload, nil
+}
+
+func uploadQueueWorker(workQueue <-chan datastore.ImageMetaData, piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, uploads *uploadGroup, limiter *uploadLimiter, albums *albumLimiter, infoUpdates *imageInfoUpdates, abort *uploadAbort, options UploadOptions, waitGroup *sync.WaitGroup) {
+	for img := range workQueue {
+		uploadQueuedImage(img, piwigoCtx, metadataProvider, uploads, limiter, infoUpdates, abort, options)
+		albums.done(img)
 	}
 	waitGroup.Done()
 }
 
-func uploadQueueProducer(imagesToUpload []datastore.ImageMetaData, workQueue chan<- datastore.ImageMetaData, waitGroup *sync.WaitGroup) {
-	for _, img := range imagesToUpload {
-		logrus.Debugf("%s: Adding image to queue", img.FullImagePath)
-		workQueue <- img
+func uploadQueuedImage(img datastore.ImageMetaData, piwigoCtx piwigo.ImageApi, metadataProvider datastore.ImageMetadataProvider, uploads *uploadGroup, limiter *uploadLimiter, infoUpdates *imageInfoUpdates, abort *uploadAbort, options UploadOptions) {
+	if abort.get() != nil {
+		return
+	}
+
+	correlationId := piwigo.NewCorrelationId()
+	log := imageLog(correlationId, img)
+	// images that already existed on the server are not deleted if the album is rolled back
+	created := img.PiwigoId == 0
+
+	upload, err := handleChangedFile(&img, options, log)
+	if err != nil {
+		log.Error(err)
+		abort.set(err)
+		return
+	}
+	if !upload {
+		return
+	}
+
+	if options.ValidateImages {
+		err = validateImage(img.FullImagePath, options)
+		if err != nil {
+			// the image stays scheduled, so it gets uploaded as soon as the file got fixed
+			log.Warnf("%s: %s. Skipping...", img.FullImagePath, err)
+			options.Report.AddInvalid(img.FullImagePath, err.Error())
+			return
+		}
+	}
+
+	err = options.PreUploadHook.Run([]string{img.FullImagePath}, hookEnvironment(img))
+	if err != nil {
+		log.Warnf("%s: %s. Skipping...", img.FullImagePath, err)
+		options.Report.AddSkipped(img.FullImagePath, err.Error())
+		return
+	}
+
+	log.Debugf("%s: uploading image to piwigo", img.FullImagePath)
+	markUploadInProgress(&img, metadataProvider, options, log)
+
+	matchedExisting := false
+	dimensions, hasDimensions := uploadedFile{}, false
+	release := limiter.acquire(img.FullImagePath)
+	imgId, shared, err := uploads.do(img.Md5Sum, img.CategoryPiwigoId, func() (int, error) {
+		result, file, found, err := uploadImage(piwigoCtx, img, options, correlationId, log)
+		matchedExisting = result.MatchedExisting
+		dimensions, hasDimensions = file, found
+		return result.ImageId, err
+	})
+	release()
+	img.UploadRunId = 0
+	if err != nil && options.OnFileChanged != "" && fileChangedSinceHashing(img) {
+		log.Warnf("%s: %s and got rejected. This is not an error of the server.", img.FullImagePath, fileChangedReason)
+		err = errors.New(fmt.Sprintf("%s during the upload - %s", fileChangedReason, err))
+	}
+	if err != nil && imgId > 0 && errors.Is(err, errorServerFileDiffers) {
+		// the next run replaces the file of the created image instead of matching its broken content
+		img.PiwigoId = imgId
+	}
+	if err != nil {
+		log.Warnf("%s: could not upload image. Continuing with the next image.", img.FullImagePath)
+		options.Report.AddFailed(img.FullImagePath, err.Error())
+		saveUploadFailure(img, err, metadataProvider, options, log)
+		return
+	}
+	img.FailureCount = 0
+	img.FailureReason = ""
+
+	if shared {
+		log.Infof("%s: Image with the same content already uploaded as %d", img.FullImagePath, imgId)
+		img.PiwigoId = imgId
+		options.Uploaded.add(img.CategoryPiwigoId, img.PiwigoId)
+		deferMetadata(datastore.DeferredMetadata{PiwigoId: img.PiwigoId, CategoryPiwigoId: img.CategoryPiwigoId}, options, log)
+		img.UploadRequired = runPostUploadHook(img, options, log) != nil
+		err = metadataProvider.SaveImageMetadata(img)
+		if err != nil {
+			log.Warnf("%s: could not save uploaded image. Continuing with the next image.", img.FullImagePath)
+			return
+		}
+		completeAlbumImage(img, false, options)
+		return
+	}
+
+	if matchedExisting {
+		// the content is already on the server, only the category got assigned
+		log.Infof("%s: Matched existing image %d on the server", img.FullImagePath, imgId)
+		img.PiwigoId = imgId
+		options.Uploaded.add(img.CategoryPiwigoId, img.PiwigoId)
+		deferMetadata(datastore.DeferredMetadata{PiwigoId: img.PiwigoId, CategoryPiwigoId: img.CategoryPiwigoId}, options, log)
+		err = runPostUploadHook(img, options, log)
+		if err == nil {
+			options.Report.AddMatched(img.FullImagePath)
+		}
+		img.UploadRequired = err != nil
+		err = metadataProvider.SaveImageMetadata(img)
+		if err != nil {
+			log.Warnf("%s: could not save matched image. Continuing with the next image.", img.FullImagePath)
+			return
+		}
+		completeAlbumImage(img, false, options)
+		return
+	}
+
+	if imgId > 0 && imgId != img.PiwigoId {
+		img.PiwigoId = imgId
+		log.Debugf("%s: Updating image %d with piwigo id %d", img.FullImagePath, img.ImageId, img.PiwigoId)
+	}
+	log.Infof("%s: Successfully uploaded", img.FullImagePath)
+	options.Uploaded.add(img.CategoryPiwigoId, img.PiwigoId)
+
+	if options.DeferredMetadata != nil {
+		metadata := datastore.DeferredMetadata{PiwigoId: img.PiwigoId, CategoryPiwigoId: img.CategoryPiwigoId}
+		if options.SetDateAvailable {
+			metadata.DateAvailable = availableDate(img, options, log)
+		}
+		if hasDimensions {
+			metadata.Width, metadata.Height, metadata.Filesize = dimensions.width, dimensions.height, dimensions.filesize
+		}
+		deferMetadata(metadata, options, log)
+	} else {
+		if options.SetDateAvailable {
+			update := piwigo.NewDateAvailableUpdate(img.PiwigoId, availableDate(img, options, log))
+			update.CorrelationId = correlationId
+			infoUpdates.add(update)
+		}
+
+		if hasDimensions {
+			setMissingDimensions(piwigoCtx, img.PiwigoId, dimensions, infoUpdates, correlationId, log)
+		}
+	}
+
+	addCreationDate(img, options, infoUpdates, correlationId, log)
+
+	name, rename := options.names.lookup(img.FullImagePath)
+	if rename {
+		log.Infof("%s: Naming image %d %s as another image of the category has the same name", img.FullImagePath, img.PiwigoId, name)
+	}
+	if options.MetadataFromIptc && addIptcInfo(img, name, infoUpdates, correlationId, log) {
+		// the name is set with the IPTC fields
+		rename = false
+	}
+	if rename {
+		update := piwigo.NewImageDetailsUpdate(img.PiwigoId, name, time.Time{}, nil)
+		update.CorrelationId = correlationId
+		infoUpdates.add(update)
+	}
+
+	if options.GenerateDerivatives || options.KeepOriginal {
+		err = piwigoCtx.GenerateDerivatives(img.PiwigoId)
+		if err != nil {
+			log.Warnf("%s: could not generate the derivatives of image %d - %s", img.FullImagePath, img.PiwigoId, err)
+		}
+	}
+
+	if options.KeepOriginal {
+		checkOriginalKept(piwigoCtx, img, options, log)
+	}
+
+	err = runPostUploadHook(img, options, log)
+	if err == nil {
+		options.Report.AddUploaded(img.FullImagePath, fileSize(img.FullImagePath))
+	}
+	img.UploadRequired = err != nil
+	err = metadataProvider.SaveImageMetadata(img)
+	if err != nil {
+		log.Warnf("%s: could not save uploaded image. Continuing with the next image.", img.FullImagePath)
+		return
+	}
+	completeAlbumImage(img, created, options)
+}
+
+// Saves the metadata of the image for the metadata phase. It is saved before the image is marked as uploaded, so a
+// crash in between uploads the image again instead of losing its metadata.
+func deferMetadata(metadata datastore.DeferredMetadata, options UploadOptions, log *logrus.Entry) {
+	if options.DeferredMetadata == nil {
+		return
+	}
+	err := options.DeferredMetadata.SaveDeferredMetadata(metadata)
+	if err != nil {
+		log.Warnf("could not save the deferred metadata of image %d - %s", metadata.PiwigoId, err)
+	}
+}
+
+// Records the image that got uploaded or matched in the run. The cursor of its album advances right away unless
+// its album is uploaded all or nothing.
+func completeAlbumImage(img datastore.ImageMetaData, created bool, options UploadOptions) {
+	if options.transactions != nil {
+		options.transactions.complete(img, created)
+		return
+	}
+	completeAlbumCursor(img, options)
+}
+
+// Advances the cursor of the album once the image no longer has to be uploaded, e.g. if the post upload hook succeeded.
+func completeAlbumCursor(img datastore.ImageMetaData, options UploadOptions) {
+	if !img.UploadRequired {
+		options.AlbumCursors.complete(img.FullImagePath)
+	}
+}
+
+// Marks the image with the running run before the upload starts. If the run crashes, the next run finds the image
+// with an unknown state on the server and reconciles it.
+func markUploadInProgress(img *datastore.ImageMetaData, metadataProvider datastore.ImageMetadataProvider, options UploadOptions, log *logrus.Entry) {
+	if options.RunId <= 0 {
+		return
+	}
+
+	img.UploadRunId = options.RunId
+	err := metadataProvider.SaveImageMetadata(*img)
+	if err != nil {
+		log.Warnf("%s: could not mark the upload as in progress - %s", img.FullImagePath, err)
+	}
+}
+
+// Counts the consecutive failed uploads of the image to quarantine it after too many of them.
+func saveUploadFailure(img datastore.ImageMetaData, uploadError error, metadataProvider datastore.ImageMetadataProvider, options UploadOptions, log *logrus.Entry) {
+	img.FailureCount++
+	img.FailureReason = uploadError.Error()
+	if isQuarantined(img, options) {
+		log.Warnf("%s: failed %d times in a row and gets quarantined", img.FullImagePath, img.FailureCount)
+	}
+
+	err := metadataProvider.SaveImageMetadata(img)
+	if err != nil {
+		log.Warnf("%s: could not save the failed upload - %s", img.FullImagePath, err)
+	}
+}
+
+// Runs the post upload hook. Only returns an error if the hook is required, the image is then reported as failed
+// and has to be uploaded again.
+func runPostUploadHook(img datastore.ImageMetaData, options UploadOptions, log *logrus.Entry) error {
+	err := options.PostUploadHook.Run([]string{img.FullImagePath, strconv.Itoa(img.PiwigoId)}, hookEnvironment(img))
+	if err == nil {
+		return nil
+	}
+
+	if !options.RequirePostUploadHook {
+		log.Warnf("%s: %s", img.FullImagePath, err)
+		return nil
+	}
+
+	log.Errorf("%s: %s. The image stays scheduled for the upload.", img.FullImagePath, err)
+	options.Report.AddFailed(img.FullImagePath, err.Error())
+	return err
+}
+
+func hookEnvironment(img datastore.ImageMetaData) []string {
+	return []string{
+		fmt.Sprintf("PIWIGO_IMAGE_PATH=%s", img.FullImagePath),
+		fmt.Sprintf("PIWIGO_IMAGE_MD5=%s", img.Md5Sum),
+		fmt.Sprintf("PIWIGO_IMAGE_ID=%d", img.PiwigoId),
+		fmt.Sprintf("PIWIGO_CATEGORY_ID=%d", img.CategoryPiwigoId),
+	}
+}
+
+// Uploads the image with the transformations applied. The dimensions are read from the uploaded file before it gets
+// cleaned up if SetDimensions is enabled.
+func uploadImage(piwigoCtx piwigo.ImageApi, img datastore.ImageMetaData, options UploadOptions, correlationId string, log *logrus.Entry) (piwigo.UploadResult, uploadedFile, bool, error) {
+	filePath, cleanup, err := options.Transformations.Prepare(img.FullImagePath)
+	if err != nil {
+		return piwigo.UploadResult{}, uploadedFile{}, false, err
+	}
+	defer cleanup()
+
+	result, err := piwigoCtx.UploadImage(img.PiwigoId, filePath, img.Md5Sum, img.CategoryPiwigoId, correlationId)
+	if err == nil && !result.MatchedExisting && options.VerifyMode != "" && options.VerifyMode != VerifyNone {
+		err = verifyUpload(piwigoCtx, result.ImageId, filePath, options.VerifyMode, log)
+		if err != nil && !errors.Is(err, errorServerFileDiffers) {
+			log.Warnf("%s: could not verify the file of image %d - %s", img.FullImagePath, result.ImageId, err)
+			err = nil
+		}
+	}
+	if err != nil || result.MatchedExisting || !options.SetDimensions {
+		return result, uploadedFile{}, false, err
+	}
+	file, found := readUploadedFile(filePath, log)
+	return result, file, found, nil
+}
+
+// Returns the logger for all lines of the image while it is uploaded. The attempt counts the failed uploads of
+// earlier runs, so retries of the same image can be told apart.
+func imageLog(correlationId string, img datastore.ImageMetaData) *logrus.Entry {
+	return piwigo.CorrelationLog(correlationId).WithField("attempt", img.FailureCount+1)
+}
+
+func uploadQueueProducer(imagesToUpload []datastore.ImageMetaData, workQueue chan<- datastore.ImageMetaData, albums *albumLimiter, waitGroup *sync.WaitGroup) {
+	batches := [][]datastore.ImageMetaData{imagesToUpload}
+	if albums != nil {
+		batches = groupByAlbum(imagesToUpload)
+	}
+	for _, batch := range batches {
+		if len(batch) > 0 {
+			albums.start(batch[0].CategoryPath, len(batch))
+		}
+		for _, img := range batch {
+			logrus.Debugf("%s: Adding image to queue", img.FullImagePath)
+			workQueue <- img
+		}
 	}
 	waitGroup.Done()
 	close(workQueue)
 }
+
+func fileSize(filePath string) int64 {
+	fileInfo, err := localFileStructure.Stat(filePath)
+	if err != nil {
+		return 0
+	}
+	return fileInfo.Size()
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"sync"
+)
+
+type uploadCall struct {
+	done     chan struct{}
+	category int
+	piwigoId int
+	err      error
+}
+
+// The upload group makes sure that images with the same md5sum are uploaded only once per run, even if they get
+// scheduled on different workers at the same time. The callers of the same md5sum and category share the resulting
+// piwigo id.
+type uploadGroup struct {
+	mutex sync.Mutex
+	calls map[string]*uploadCall
+}
+
+func newUploadGroup() *uploadGroup {
+	return &uploadGroup{calls: make(map[string]*uploadCall)}
+}
+
+// Executes the upload if there is no running or successfully finished upload with the same md5sum. The boolean
+// result is true if the result was shared from the upload of another caller in the same category, which is the
+// piwigo id or the error if that upload failed. Callers of another category wait for the running upload and execute
+// their own afterwards, which adds the image to their category as the server already knows its content.
+func (g *uploadGroup) do(md5sum string, category int, upload func() (int, error)) (int, bool, error) {
+	g.mutex.Lock()
+	if call, found := g.calls[md5sum]; found {
+		g.mutex.Unlock()
+		<-call.done
+		if call.category != category {
+			piwigoId, err := upload()
+			return piwigoId, false, err
+		}
+		return call.piwigoId, true, call.err
+	}
+
+	call := &uploadCall{done: make(chan struct{}), category: category}
+	g.calls[md5sum] = call
+	g.mutex.Unlock()
+
+	call.piwigoId, call.err = upload()
+
+	// failed uploads are removed from the group to let other images with the same content try again
+	if call.err != nil {
+		g.mutex.Lock()
+		delete(g.calls, md5sum)
+		g.mutex.Unlock()
+	}
+	close(call.done)
+
+	return call.piwigoId, false, call.err
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_uploadGroup_collapses_concurrent_uploads(t *testing.T) {
+	group := newUploadGroup()
+	var numberOfUploads int32
+	start := make(chan struct{})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			id, _, err := group.do("1234", 2, func() (int, error) {
+				atomic.AddInt32(&numberOfUploads, 1)
+				time.Sleep(50 * time.Millisecond)
+				return 5, nil
+			})
+			if err != nil || id != 5 {
+				t.Errorf("Expected id 5 without error but got %d - %v", id, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if numberOfUploads != 1 {
+		t.Errorf("Expected exactly one upload but got %d", numberOfUploads)
+	}
+}
+
+func Test_uploadGroup_retries_failed_uploads(t *testing.T) {
+	group := newUploadGroup()
+
+	_, _, err := group.do("1234", 2, func() (int, error) {
+		return 0, errors.New("upload failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the error of the upload")
+	}
+
+	id, shared, err := group.do("1234", 2, func() (int, error) {
+		return 5, nil
+	})
+	if err != nil || shared || id != 5 {
+		t.Errorf("Expected a new upload after the failed one but got %d, shared %t - %v", id, shared, err)
+	}
+}
+
+func Test_uploadGroup_uploads_again_for_another_category(t *testing.T) {
+	group := newUploadGroup()
+
+	_, _, err := group.do("1234", 2, func() (int, error) {
+		return 5, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded := false
+	id, shared, err := group.do("1234", 3, func() (int, error) {
+		uploaded = true
+		return 5, nil
+	})
+	if err != nil || shared || !uploaded || id != 5 {
+		t.Errorf("Expected an upload for the other category but got %d, shared %t, uploaded %t - %v", id, shared, uploaded, err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"path/filepath"
+	"sort"
+)
+
+// Orders in which the images are handed to the upload workers.
+const (
+	// sorted by the filename, images with the same name are sorted by their path
+	UploadOrderName = "name"
+	// sorted by the last modification, oldest first
+	UploadOrderModTime = "mtime"
+	// sorted by the file size, smallest first
+	UploadOrderSize = "size"
+	// sorted by the full path of the image
+	UploadOrderPath = "path"
+)
+
+// Sorts the images in the given upload order. An empty order keeps the order of the metadata store.
+// All orders fall back to the full path for equal values to get the same order on every run.
+func sortImages(images []datastore.ImageMetaData, uploadOrder string) error {
+	var less func(a, b datastore.ImageMetaData) bool
+
+	switch uploadOrder {
+	case "":
+		return nil
+	case UploadOrderName:
+		less = func(a, b datastore.ImageMetaData) bool {
+			return filepath.Base(a.FullImagePath) < filepath.Base(b.FullImagePath)
+		}
+	case UploadOrderModTime:
+		less = func(a, b datastore.ImageMetaData) bool {
+			return a.LastChange.Before(b.LastChange)
+		}
+	case UploadOrderSize:
+		sizes := make(map[string]int64, len(images))
+		for _, img := range images {
+			sizes[img.FullImagePath] = fileSize(img.FullImagePath)
+		}
+		less = func(a, b datastore.ImageMetaData) bool {
+			return sizes[a.FullImagePath] < sizes[b.FullImagePath]
+		}
+	case UploadOrderPath:
+		less = func(a, b datastore.ImageMetaData) bool {
+			return false
+		}
+	default:
+		return errors.New(fmt.Sprintf("unknown upload order %s. Use one of name, mtime, size or path", uploadOrder))
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		if less(images[i], images[j]) {
+			return true
+		}
+		if less(images[j], images[i]) {
+			return false
+		}
+		return images[i].FullImagePath < images[j].FullImagePath
+	})
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"testing"
+	"time"
+)
+
+func Test_sortImages_orders_images(t *testing.T) {
+	small := createTestFileOfSize(t, 10)
+	large := createTestFileOfSize(t, 1000)
+	now := time.Now()
+
+	tests := []struct {
+		order    string
+		images   []datastore.ImageMetaData
+		expected []string
+	}{
+		{
+			order: UploadOrderPath,
+			images: []datastore.ImageMetaData{
+				{FullImagePath: "/b/a.jpg"}, {FullImagePath: "/a/b.jpg"}, {FullImagePath: "/a/a.jpg"},
+			},
+			expected: []string{"/a/a.jpg", "/a/b.jpg", "/b/a.jpg"},
+		},
+		{
+			order: UploadOrderName,
+			images: []datastore.ImageMetaData{
+				{FullImagePath: "/b/a.jpg"}, {FullImagePath: "/a/b.jpg"}, {FullImagePath: "/a/a.jpg"},
+			},
+			expected: []string{"/a/a.jpg", "/b/a.jpg", "/a/b.jpg"},
+		},
+		{
+			order: UploadOrderModTime,
+			images: []datastore.ImageMetaData{
+				{FullImagePath: "/c.jpg", LastChange: now},
+				{FullImagePath: "/b.jpg", LastChange: now.Add(-time.Hour)},
+				{FullImagePath: "/a.jpg", LastChange: now},
+			},
+			expected: []string{"/b.jpg", "/a.jpg", "/c.jpg"},
+		},
+		{
+			order: UploadOrderSize,
+			images: []datastore.ImageMetaData{
+				{FullImagePath: large}, {FullImagePath: small},
+			},
+			expected: []string{small, large},
+		},
+		{
+			order: "",
+			images: []datastore.ImageMetaData{
+				{FullImagePath: "/b.jpg"}, {FullImagePath: "/a.jpg"},
+			},
+			expected: []string{"/b.jpg", "/a.jpg"},
+		},
+	}
+
+	for _, test := range tests {
+		err := sortImages(test.images, test.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, img := range test.images {
+			if img.FullImagePath != test.expected[i] {
+				t.Errorf("order %s: expected %s at position %d but got %s", test.order, test.expected[i], i, img.FullImagePath)
+			}
+		}
+	}
+}
+
+func Test_sortImages_rejects_unknown_order(t *testing.T) {
+	err := sortImages([]datastore.ImageMetaData{{FullImagePath: "/a.jpg"}}, "random")
+	if err == nil {
+		t.Error("expected an error for an unknown upload order")
+	}
+}
@@ -6,9 +6,18 @@
 package images
 
 import (
+	"context"
+	"errors"
 	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/hooks"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
 	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_uploadImages_saves_new_id_to_db(t *testing.T) {
@@ -27,9 +36,9 @@ func Test_uploadImages_saves_new_id_to_db(t *testing.T) {
 	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
 
 	piwigomock := NewMockImageApi(mockCtrl)
-	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2).Times(1).Return(5, nil)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
 
-	err := UploadImages(piwigomock, dbmock, 1)
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1})
 	if err != nil {
 		t.Error(err)
 	}
@@ -50,9 +59,438 @@ func Test_uploadImages_saves_same_id_to_db(t *testing.T) {
 	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
 
 	piwigomock := NewMockImageApi(mockCtrl)
-	piwigomock.EXPECT().UploadImage(5, "/nonexisting/file.jpg", "1234", 2).Times(1).Return(5, nil)
+	piwigomock.EXPECT().UploadImage(5, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
 
-	err := UploadImages(piwigomock, dbmock, 1)
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_skips_oversized_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FullImagePath = createTestFileOfSize(t, 1024*1024+1)
+	images := []datastore.ImageMetaData{img}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MaxImageSizeInMB: 1, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(uploadReport.Skipped()) != 1 {
+		t.Errorf("The oversized image should be reported as skipped")
+	}
+}
+
+func Test_uploadImages_skips_images_whose_size_can_not_be_read(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	images := []datastore.ImageMetaData{img}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MaxImageSizeInMB: 1, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(uploadReport.Skipped()) != 1 {
+		t.Errorf("The image whose size can not be read should be reported as skipped")
+	}
+}
+
+func Test_uploadImages_fails_on_oversized_images_before_uploading(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	smallImg := createTestImageMetaData(0)
+	smallImg.FullImagePath = createTestFileOfSize(t, 1024)
+	largeImg := createTestImageMetaData(0)
+	largeImg.FullImagePath = createTestFileOfSize(t, 1024*1024+1)
+	images := []datastore.ImageMetaData{smallImg, largeImg}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MaxImageSizeInMB: 1, FailOnOversizedImages: true})
+	if err == nil {
+		t.Error("Expected an error as one image exceeds the maximum size")
+	}
+}
+
+func createTestFileOfSize(t *testing.T, size int64) string {
+	file, err := ioutil.TempFile("", "uploadtest*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+
+	err = file.Truncate(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func Test_uploadImages_sets_date_available_if_enabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(5)
+	img.LastChange = time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	images := []datastore.ImageMetaData{img}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	uploadCorrelationId := ""
+	piwigomock.EXPECT().UploadImage(5, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).DoAndReturn(func(piwigoId int, filePath string, md5sum string, category int, correlationId string) (piwigo.UploadResult, error) {
+		uploadCorrelationId = correlationId
+		return piwigo.UploadResult{ImageId: 5}, nil
+	})
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), 1).Times(1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		// the update is logged with the same correlation id as the upload of the image
+		expected := piwigo.NewDateAvailableUpdate(5, img.LastChange)
+		expected.CorrelationId = uploadCorrelationId
+		if uploadCorrelationId == "" || !reflect.DeepEqual(updates, []piwigo.ImageInfoUpdate{expected}) {
+			t.Errorf("expected the update %v but got %v", expected, updates)
+		}
+		return piwigo.ImageInfoUpdateResult{Updates: 1, Images: 1, Requests: 1}, nil
+	})
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, SetDateAvailable: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_uploads_same_content_only_once(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img1 := createTestImageMetaData(0)
+	img2 := createTestImageMetaData(0)
+	img2.ImageId = 2
+	img2.FullImagePath = "/nonexisting/copy.jpg"
+	images := []datastore.ImageMetaData{img1, img2}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(2).DoAndReturn(func(img datastore.ImageMetaData) error {
+		if img.PiwigoId != 5 {
+			t.Errorf("%s: expected the shared piwigo id 5 but got %d", img.FullImagePath, img.PiwigoId)
+		}
+		return nil
+	})
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, gomock.Any(), "1234", 2, gomock.Any()).Times(1).DoAndReturn(func(piwigoId int, filePath string, md5sum string, category int, correlationId string) (piwigo.UploadResult, error) {
+		// keep the upload running to let the second worker pick up the image with the same content
+		time.Sleep(50 * time.Millisecond)
+		return piwigo.UploadResult{ImageId: 5}, nil
+	})
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 2})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_adds_same_content_to_each_category(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img1 := createTestImageMetaData(0)
+	img2 := createTestImageMetaData(0)
+	img2.ImageId = 2
+	img2.FullImagePath = "/nonexisting/other/file.jpg"
+	img2.CategoryPiwigoId = 3
+	images := []datastore.ImageMetaData{img1, img2}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(2)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).DoAndReturn(func(piwigoId int, filePath string, md5sum string, category int, correlationId string) (piwigo.UploadResult, error) {
+		// keep the upload running to let the second worker pick up the image with the same content
+		time.Sleep(50 * time.Millisecond)
+		return piwigo.UploadResult{ImageId: 5}, nil
+	})
+	// the server adds the uploaded image to the category of the second image
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/other/file.jpg", "1234", 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5, MatchedExisting: true}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 2})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_skips_image_if_pre_upload_hook_fails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	images := []datastore.ImageMetaData{createTestImageMetaData(0)}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{
+		NumberOfWorkers: 1,
+		PreUploadHook:   hooks.NewHook(context.Background(), "pre upload", "false", time.Minute),
+		Report:          uploadReport,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(uploadReport.Skipped()) != 1 {
+		t.Errorf("expected the image to be skipped but got %d skipped", len(uploadReport.Skipped()))
+	}
+}
+
+func Test_uploadImages_keeps_image_scheduled_if_required_post_upload_hook_fails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	images := []datastore.ImageMetaData{img}
+
+	imgToSave := img
+	imgToSave.PiwigoId = 5
+	imgToSave.UploadRequired = true
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{
+		NumberOfWorkers:       1,
+		PostUploadHook:        hooks.NewHook(context.Background(), "post upload", "false", time.Minute),
+		RequirePostUploadHook: true,
+		Report:                uploadReport,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(uploadReport.Failed()) != 1 || uploadReport.Uploaded() != 0 {
+		t.Errorf("expected the image to be failed but got %d uploaded and %d failed", uploadReport.Uploaded(), len(uploadReport.Failed()))
+	}
+}
+
+func Test_uploadImages_ignores_failing_post_upload_hook_by_default(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	images := []datastore.ImageMetaData{img}
+
+	imgToSave := img
+	imgToSave.PiwigoId = 5
+	imgToSave.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{
+		NumberOfWorkers: 1,
+		PostUploadHook:  hooks.NewHook(context.Background(), "post upload", "false", time.Minute),
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_counts_matched_existing_image(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	images := []datastore.ImageMetaData{img}
+
+	imgToSave := img
+	imgToSave.PiwigoId = 7
+	imgToSave.UploadRequired = false
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 7, MatchedExisting: true}, nil)
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, SetDateAvailable: true, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if uploadReport.Matched() != 1 || uploadReport.Uploaded() != 0 {
+		t.Errorf("expected one matched image but got %d matched and %d uploaded", uploadReport.Matched(), uploadReport.Uploaded())
+	}
+}
+
+func Test_uploadImages_counts_failed_uploads(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FailureCount = 1
+	images := []datastore.ImageMetaData{img}
+
+	imgToSave := img
+	imgToSave.FailureCount = 2
+	imgToSave.FailureReason = "server error"
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{}, errors.New("server error"))
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MaxUploadFailures: 3})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_skips_quarantined_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FailureCount = 3
+	img.FailureReason = "server error"
+	images := []datastore.ImageMetaData{img}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(0)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MaxUploadFailures: 3, Report: uploadReport})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(uploadReport.Quarantined()) != 1 {
+		t.Errorf("expected the image to be reported as quarantined but got %d", len(uploadReport.Quarantined()))
+	}
+}
+
+func Test_uploadImages_retries_quarantined_images_and_resets_failures(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	img := createTestImageMetaData(0)
+	img.FailureCount = 3
+	img.FailureReason = "server error"
+	images := []datastore.ImageMetaData{img}
+
+	imgToSave := img
+	imgToSave.PiwigoId = 5
+	imgToSave.UploadRequired = false
+	imgToSave.FailureCount = 0
+	imgToSave.FailureReason = ""
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(imgToSave).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, MaxUploadFailures: 3, RetryQuarantined: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_generates_derivatives_if_enabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	images := []datastore.ImageMetaData{createTestImageMetaData(0)}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, "/nonexisting/file.jpg", "1234", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+	piwigomock.EXPECT().GenerateDerivatives(5).Times(1).Return(nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, GenerateDerivatives: true})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImages_sets_the_date_available_after_all_uploads(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	first := createTestImageMetaData(5)
+	second := createTestImageMetaData(6)
+	second.FullImagePath = "/nonexisting/second.jpg"
+	second.Md5Sum = "5678"
+	images := []datastore.ImageMetaData{first, second}
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return(images, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(2)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), 2, gomock.Any()).Times(2).DoAndReturn(func(piwigoId int, filePath string, md5sum string, category int, correlationId string) (piwigo.UploadResult, error) {
+		return piwigo.UploadResult{ImageId: piwigoId}, nil
+	})
+	piwigomock.EXPECT().UpdateImagesInfo(gomock.Len(2), 2).Times(1).Return(piwigo.ImageInfoUpdateResult{Updates: 2, Images: 2, Requests: 2}, nil)
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 2, SetDateAvailable: true})
 	if err != nil {
 		t.Error(err)
 	}
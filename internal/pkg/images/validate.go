@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"github.com/sirupsen/logrus"
+	"image"
+	_ "image/gif"
+	"path/filepath"
+	"strings"
+)
+
+// The formats that are decoded to validate the images. Files of other formats are uploaded without validation.
+var validatedExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+}
+
+// Decodes the whole image to detect corrupt files, e.g. truncated by an aborted copy, before they are sent to the
+// server. The server would reject them or store a broken image. Returns why the image is invalid.
+func validateImage(filePath string, options UploadOptions) error {
+	if !validatedExtensions[strings.ToLower(filepath.Ext(filePath))] {
+		logrus.Debugf("%s: the format can not be validated, uploading it as it is", filePath)
+		return nil
+	}
+
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoded, format, err := image.Decode(file)
+	if err == image.ErrFormat {
+		return errors.New("the file is not a jpeg, png or gif image")
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("the %s image could not be decoded - %s", format, err))
+	}
+
+	width := decoded.Bounds().Dx()
+	height := decoded.Bounds().Dy()
+	if width < options.MinImageWidth || height < options.MinImageHeight {
+		return errors.New(fmt.Sprintf("the image of %dx%d pixels is smaller than the minimum of %dx%d pixels", width, height, options.MinImageWidth, options.MinImageHeight))
+	}
+	return nil
+}
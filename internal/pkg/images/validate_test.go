@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/report"
+	"github.com/golang/mock/gomock"
+	"path/filepath"
+	"testing"
+)
+
+// the first two thirds of a jpeg of 64x48 pixels
+const truncatedJpeg = "testdata/truncated.jpg"
+
+func Test_validateImage(t *testing.T) {
+	notAnImage := filepath.Join(createCompareTestDir(t), "text.jpg")
+	writeCompareTestFile(t, notAnImage, []byte("this is not an image"))
+	unsupported := filepath.Join(createCompareTestDir(t), "movie.mp4")
+	writeCompareTestFile(t, unsupported, []byte("not decoded"))
+
+	tests := []struct {
+		name    string
+		path    string
+		options UploadOptions
+		valid   bool
+	}{
+		{name: "valid jpeg", path: createTestJpeg(t, 40, 30), valid: true},
+		{name: "truncated jpeg", path: truncatedJpeg, valid: false},
+		{name: "not an image", path: notAnImage, valid: false},
+		{name: "format without validation", path: unsupported, valid: true},
+		{name: "large enough", path: createTestJpeg(t, 40, 30), options: UploadOptions{MinImageWidth: 40, MinImageHeight: 30}, valid: true},
+		{name: "too small", path: createTestJpeg(t, 40, 30), options: UploadOptions{MinImageWidth: 41}, valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateImage(test.path, test.options)
+			if test.valid && err != nil {
+				t.Errorf("expected a valid image but got %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an invalid image")
+			}
+		})
+	}
+}
+
+func Test_uploadImages_reports_invalid_images_without_uploading_them(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	truncated := createTestImageMetaData(0)
+	truncated.FullImagePath = truncatedJpeg
+	valid := createTestImageMetaData(0)
+	valid.ImageId = 2
+	valid.Md5Sum = "5678"
+	valid.FullImagePath = createTestJpeg(t, 40, 30)
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Times(1).Return([]datastore.ImageMetaData{truncated, valid}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).Times(1)
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, valid.FullImagePath, "5678", 2, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 5}, nil)
+
+	uploadReport := report.NewReport()
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, ValidateImages: true, Report: uploadReport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := uploadReport.Invalid()
+	if len(invalid) != 1 || invalid[0].Path != truncated.FullImagePath || uploadReport.Uploaded() != 1 {
+		t.Errorf("expected the truncated image to be reported as invalid but got %v", invalid)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+)
+
+// How the file stored on the server is compared with the uploaded file after the upload.
+const (
+	// the file is not compared
+	VerifyNone = "none"
+	// the whole file is downloaded and compared byte by byte
+	VerifyFull = "full"
+	// only the head, the middle and the tail of the file are downloaded and compared
+	VerifySampled = "sampled"
+)
+
+// the number of bytes compared at the head, the middle and the tail of the file by VerifySampled
+const verifySampleLength = 64 * 1024
+
+// the uploaded image stays scheduled and replaces the stored file on the next run
+var errorServerFileDiffers = errors.New("the file stored on the server differs from the uploaded file")
+
+// A stored file that differs from the uploaded one. It matches errorServerFileDiffers with errors.Is and describes
+// where the files differ.
+type serverFileDiffersError struct {
+	difference string
+}
+
+func (e *serverFileDiffersError) Error() string {
+	return errorServerFileDiffers.Error() + e.difference
+}
+
+func (e *serverFileDiffersError) Is(target error) bool {
+	return target == errorServerFileDiffers
+}
+
+func checkVerifyMode(mode string) error {
+	if mode != "" && mode != VerifyNone && mode != VerifyFull && mode != VerifySampled {
+		return errors.New(fmt.Sprintf("unknown verify mode %s. Use one of full, sampled or none", mode))
+	}
+	return nil
+}
+
+// Compares the uploaded file with the file the server stores for the image. Returns errorServerFileDiffers if they
+// differ. The sampled comparison only finds changes within the compared ranges and changes of the size, which makes
+// it a cheap check of large files. Servers that do not support range requests get the full comparison.
+func verifyUpload(piwigoCtx piwigo.ImageApi, piwigoId int, filePath string, mode string, log *logrus.Entry) error {
+	if mode == VerifySampled {
+		err := verifySampled(piwigoCtx, piwigoId, filePath)
+		if err != piwigo.ErrorRangesNotSupported {
+			return err
+		}
+		log.Warnf("%s: %s, verifying the whole file of image %d", filePath, err, piwigoId)
+	}
+	return verifyFull(piwigoCtx, piwigoId, filePath)
+}
+
+func verifyFull(piwigoCtx piwigo.ImageApi, piwigoId int, filePath string) error {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	comparer := newFileComparer(file)
+	serverSize, err := piwigoCtx.DownloadImage(piwigoId, comparer)
+	if err != nil {
+		return err
+	}
+	localSize, err := comparer.finish()
+	if err != nil {
+		return err
+	}
+	if comparer.firstDifference >= 0 {
+		return &serverFileDiffersError{difference: fmt.Sprintf(" from byte %d", comparer.firstDifference)}
+	}
+	return compareSizes(localSize, serverSize)
+}
+
+func verifySampled(piwigoCtx piwigo.ImageApi, piwigoId int, filePath string) error {
+	fileInfo, err := localFileStructure.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	localSize := fileInfo.Size()
+	if localSize <= 3*verifySampleLength {
+		// the ranges would cover the whole file anyway
+		return verifyFull(piwigoCtx, piwigoId, filePath)
+	}
+
+	ranges := sampleRanges(localSize)
+	contents, serverSize, err := piwigoCtx.DownloadImageRanges(piwigoId, ranges)
+	if err != nil {
+		return err
+	}
+
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// the ranges are ordered by their offset, so the file is read once from the start
+	position := int64(0)
+	for i, byteRange := range ranges {
+		_, err = io.CopyN(ioutil.Discard, file, byteRange.Offset-position)
+		if err != nil {
+			return err
+		}
+		local := make([]byte, byteRange.Length)
+		_, err = io.ReadFull(file, local)
+		if err != nil {
+			return err
+		}
+		position = byteRange.Offset + byteRange.Length
+
+		if !bytes.Equal(local, contents[i]) {
+			return &serverFileDiffersError{difference: fmt.Sprintf(" within the bytes %d to %d", byteRange.Offset, position-1)}
+		}
+	}
+	return compareSizes(localSize, serverSize)
+}
+
+func compareSizes(localSize int64, serverSize int64) error {
+	if localSize != serverSize {
+		return &serverFileDiffersError{difference: fmt.Sprintf(", it has %d instead of %d bytes", serverSize, localSize)}
+	}
+	return nil
+}
+
+// Returns the head, the middle and the tail of a file of the given size.
+func sampleRanges(size int64) []piwigo.ByteRange {
+	return []piwigo.ByteRange{
+		{Offset: 0, Length: verifySampleLength},
+		{Offset: (size - verifySampleLength) / 2, Length: verifySampleLength},
+		{Offset: size - verifySampleLength, Length: verifySampleLength},
+	}
+}
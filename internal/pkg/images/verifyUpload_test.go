@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package images
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"io"
+	"testing"
+)
+
+// Writes a file larger than the sampled ranges and returns its path and content.
+func createVerifyTestFile(t *testing.T) (string, []byte) {
+	workDir, err := workdir.Create("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = workDir.Remove() })
+
+	content := make([]byte, 5*verifySampleLength+123)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	file, err := workDir.CreateFile("image*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.Write(content)
+	_ = file.Close()
+	return file.Name(), content
+}
+
+// Serves the ranges of the given content like the server does.
+func serveRanges(content []byte) func(int, []piwigo.ByteRange) ([][]byte, int64, error) {
+	return func(piwigoId int, ranges []piwigo.ByteRange) ([][]byte, int64, error) {
+		contents := make([][]byte, len(ranges))
+		for i, byteRange := range ranges {
+			end := byteRange.Offset + byteRange.Length
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			contents[i] = content[byteRange.Offset:end]
+		}
+		return contents, int64(len(content)), nil
+	}
+}
+
+func Test_verifyUpload_sampled_finds_a_changed_middle_byte(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filePath, content := createVerifyTestFile(t)
+	serverContent := append([]byte(nil), content...)
+	serverContent[len(serverContent)/2] ^= 0xff
+
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().DownloadImageRanges(7, gomock.Any()).DoAndReturn(serveRanges(content))
+	piwigomock.EXPECT().DownloadImageRanges(8, gomock.Any()).DoAndReturn(serveRanges(serverContent))
+
+	log := logrus.NewEntry(logrus.StandardLogger())
+	err := verifyUpload(piwigomock, 7, filePath, VerifySampled, log)
+	if err != nil {
+		t.Errorf("expected the unchanged file to match but got %v", err)
+	}
+	err = verifyUpload(piwigomock, 8, filePath, VerifySampled, log)
+	if !errors.Is(err, errorServerFileDiffers) {
+		t.Errorf("expected the changed middle byte to be found but got %v", err)
+	}
+}
+
+func Test_verifyUpload_sampled_finds_a_different_size(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filePath, content := createVerifyTestFile(t)
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().DownloadImageRanges(7, gomock.Any()).DoAndReturn(func(piwigoId int, ranges []piwigo.ByteRange) ([][]byte, int64, error) {
+		contents, _, err := serveRanges(content)(piwigoId, ranges)
+		return contents, int64(len(content)) + 1, err
+	})
+
+	err := verifyUpload(piwigomock, 7, filePath, VerifySampled, logrus.NewEntry(logrus.StandardLogger()))
+	if !errors.Is(err, errorServerFileDiffers) {
+		t.Errorf("expected the different size to be found but got %v", err)
+	}
+}
+
+func Test_verifyUpload_sampled_downloads_the_whole_file_without_range_support(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filePath, content := createVerifyTestFile(t)
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().DownloadImageRanges(7, gomock.Any()).Return(nil, int64(0), piwigo.ErrorRangesNotSupported)
+	piwigomock.EXPECT().DownloadImage(7, gomock.Any()).DoAndReturn(func(piwigoId int, writer io.Writer) (int64, error) {
+		written, err := writer.Write(content)
+		return int64(written), err
+	})
+
+	err := verifyUpload(piwigomock, 7, filePath, VerifySampled, logrus.NewEntry(logrus.StandardLogger()))
+	if err != nil {
+		t.Errorf("expected the file to match but got %v", err)
+	}
+}
+
+func Test_uploadImages_keeps_images_with_a_differing_server_file_scheduled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filePath, content := createVerifyTestFile(t)
+	img := createTestImageMetaData(0)
+	img.FullImagePath = filePath
+
+	dbmock := NewMockImageMetadataProvider(mockCtrl)
+	dbmock.EXPECT().ImageMetadataToUpload().Return([]datastore.ImageMetaData{img}, nil)
+	dbmock.EXPECT().SaveImageMetadata(gomock.Any()).DoAndReturn(func(saved datastore.ImageMetaData) error {
+		if !saved.UploadRequired || saved.PiwigoId != 7 || saved.FailureCount != 1 {
+			t.Errorf("expected image 7 to stay scheduled as failed upload but got %+v", saved)
+		}
+		return nil
+	})
+	piwigomock := NewMockImageApi(mockCtrl)
+	piwigomock.EXPECT().UploadImage(0, filePath, "1234", 2, gomock.Any()).Return(piwigo.UploadResult{ImageId: 7}, nil)
+	piwigomock.EXPECT().DownloadImage(7, gomock.Any()).DoAndReturn(func(piwigoId int, writer io.Writer) (int64, error) {
+		written, err := writer.Write(content[:len(content)-1])
+		return int64(written), err
+	})
+
+	err := UploadImages(piwigomock, dbmock, UploadOptions{NumberOfWorkers: 1, VerifyMode: VerifyFull})
+	if err != nil {
+		t.Error(err)
+	}
+}
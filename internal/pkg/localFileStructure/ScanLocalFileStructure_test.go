@@ -5,13 +5,19 @@
 
 package localFileStructure
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
 
 func Test_ScanLocalFileStructure_should_find_testfile(t *testing.T) {
 	supportedExtensions := make([]string, 0)
 	supportedExtensions = append(supportedExtensions, "jpg")
 
-	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), 0)
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), make([]string, 0), 0, DepthLimit{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,7 +42,7 @@ func Test_ScanLocalFileStructure_should_find_testfile_with_trimmed_folder(t *tes
 	supportedExtensions := make([]string, 0)
 	supportedExtensions = append(supportedExtensions, "jpg")
 
-	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), 1)
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), make([]string, 0), 1, DepthLimit{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -72,7 +78,7 @@ func Test_ScanLocalFileStructure_should_ignore_test_directory(t *testing.T) {
 
 	ignores := make([]string, 0)
 	ignores = append(ignores, "images")
-	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, ignores, 0)
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, ignores, make([]string, 0), 0, DepthLimit{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,7 +92,7 @@ func Test_ScanLocalFileStructure_should_not_find_jpg_when_only_png_supported(t *
 	supportedExtensions := make([]string, 0)
 	supportedExtensions = append(supportedExtensions, "png")
 
-	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), 0)
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), make([]string, 0), 0, DepthLimit{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -106,3 +112,171 @@ func Test_ScanLocalFileStructure_should_not_find_jpg_when_only_png_supported(t *
 		t.Errorf("Did find the testimage. This should not happen as png is searched but jpg found")
 	}
 }
+
+func Test_ScanLocalFileStructure_should_include_matching_directory(t *testing.T) {
+	supportedExtensions := make([]string, 0)
+	supportedExtensions = append(supportedExtensions, "jpg")
+
+	includes := make([]string, 0)
+	includes = append(includes, "IMAGES")
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), includes, 0, DepthLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 2 { // 1x folder, 1x image
+		t.Errorf("Did not find expected testfiles. Expected the folder and the image but got %d entries", len(images))
+	}
+}
+
+func Test_ScanLocalFileStructure_should_include_parent_directory_of_matching_file(t *testing.T) {
+	supportedExtensions := make([]string, 0)
+	supportedExtensions = append(supportedExtensions, "jpg")
+
+	includes := make([]string, 0)
+	includes = append(includes, "images/test*.jpg")
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), includes, 0, DepthLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containsFolder := false
+	containsTestImage := false
+	for _, img := range images {
+		if img.IsDir && img.Name == "images" {
+			containsFolder = true
+		}
+		if !img.IsDir && img.Name == "testimage.jpg" {
+			containsTestImage = true
+		}
+	}
+
+	if !containsTestImage {
+		t.Errorf("Did not find the expected testimage.")
+	}
+	if !containsFolder {
+		t.Errorf("The parent folder of the included image should be present.")
+	}
+}
+
+func Test_ScanLocalFileStructure_should_skip_everything_not_included(t *testing.T) {
+	supportedExtensions := make([]string, 0)
+	supportedExtensions = append(supportedExtensions, "jpg")
+
+	includes := make([]string, 0)
+	includes = append(includes, "nomatch*")
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), includes, 0, DepthLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 0 {
+		t.Errorf("Did find %d entries. Expected no files as nothing matches the include pattern!", len(images))
+	}
+}
+
+func Test_ScanLocalFileStructure_fails_on_invalid_include_pattern(t *testing.T) {
+	supportedExtensions := make([]string, 0)
+	supportedExtensions = append(supportedExtensions, "jpg")
+
+	includes := make([]string, 0)
+	includes = append(includes, "images[")
+	_, err := ScanLocalFileStructure("../../../test/", supportedExtensions, make([]string, 0), includes, 0, DepthLimit{})
+	if err == nil {
+		t.Error("expected an error as the only include pattern is invalid instead of including everything")
+	}
+}
+
+func Test_ScanLocalFileStructure_should_apply_ignores_after_includes(t *testing.T) {
+	supportedExtensions := make([]string, 0)
+	supportedExtensions = append(supportedExtensions, "jpg")
+
+	includes := make([]string, 0)
+	includes = append(includes, "images")
+	ignores := make([]string, 0)
+	ignores = append(ignores, "images")
+	images, err := ScanLocalFileStructure("../../../test/", supportedExtensions, ignores, includes, 0, DepthLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 0 {
+		t.Errorf("Did find %d entries. Expected no files as the included folder is ignored as well!", len(images))
+	}
+}
+
+// Creates the images a/1.jpg, a/b/2.jpg, a/b/c/3.jpg and a/b/c/1.jpg and returns the sorted keys of the scan.
+func scanDepthTestTree(t *testing.T, includes []string, depthLimit DepthLimit) []string {
+	root, err := ioutil.TempDir("", "depth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	for _, file := range []string{"a/1.jpg", "a/b/2.jpg", "a/b/c/3.jpg", "a/b/c/1.jpg"} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(file), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nodes, err := ScanLocalFileStructure(root, []string{"jpg"}, nil, includes, 0, depthLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		keys = append(keys, filepath.ToSlash(node.Key))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func Test_ScanLocalFileStructure_skips_the_directories_below_the_maximum_depth(t *testing.T) {
+	keys := scanDepthTestTree(t, nil, DepthLimit{MaxDepth: 2})
+
+	want := []string{"a", "a/1.jpg", "a/b", "a/b/2.jpg"}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %v but got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("expected %v but got %v", want, keys)
+		}
+	}
+}
+
+func Test_ScanLocalFileStructure_flattens_the_directories_below_the_maximum_depth(t *testing.T) {
+	keys := scanDepthTestTree(t, nil, DepthLimit{MaxDepth: 1, Flatten: true})
+
+	// a/b/c/1.jpg is skipped as it gets the same key as a/1.jpg
+	want := []string{"a", "a/1.jpg", "a/2.jpg", "a/3.jpg"}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %v but got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("expected %v but got %v", want, keys)
+		}
+	}
+}
+
+func Test_ScanLocalFileStructure_flattens_only_the_included_images(t *testing.T) {
+	keys := scanDepthTestTree(t, []string{"c"}, DepthLimit{MaxDepth: 1, Flatten: true})
+
+	// the excluded a/1.jpg does not hide a/b/c/1.jpg
+	want := []string{"a", "a/1.jpg", "a/3.jpg"}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %v but got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("expected %v but got %v", want, keys)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Images inside an archive are addressed by the path of the archive followed by this separator
+// and the path of the entry inside the archive, e.g. /photos/2019.zip!/summer/IMG_0001.jpg
+const ArchivePathSeparator = "!/"
+
+var supportedArchiveSuffixes = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// opened archives are kept for the whole run to prevent reading the index of the archive for every entry
+var openArchives = make(map[string]*archiveIndex)
+var openArchivesMutex sync.Mutex
+
+type archiveEntry struct {
+	name    string
+	isDir   bool
+	modTime time.Time
+	info    os.FileInfo
+}
+
+type archiveIndex struct {
+	path      string
+	zipReader *zip.ReadCloser
+	zipFiles  map[string]*zip.File
+	entries   map[string]archiveEntry
+}
+
+func IsSupportedArchive(filePath string) bool {
+	lowerPath := strings.ToLower(filePath)
+	for _, suffix := range supportedArchiveSuffixes {
+		if strings.HasSuffix(lowerPath, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func buildArchivePath(archivePath string, entryName string) string {
+	return archivePath + ArchivePathSeparator + entryName
+}
+
+func splitArchivePath(filePath string) (string, string, bool) {
+	separatorIndex := strings.Index(filePath, ArchivePathSeparator)
+	if separatorIndex < 0 {
+		return "", "", false
+	}
+	archivePath := filePath[:separatorIndex]
+	if !IsSupportedArchive(archivePath) {
+		return "", "", false
+	}
+	return archivePath, filePath[separatorIndex+len(ArchivePathSeparator):], true
+}
+
+func openArchive(archivePath string) (*archiveIndex, error) {
+	openArchivesMutex.Lock()
+	defer openArchivesMutex.Unlock()
+
+	if archive, found := openArchives[archivePath]; found {
+		return archive, nil
+	}
+
+	archive := &archiveIndex{path: archivePath, entries: make(map[string]archiveEntry)}
+	var err error
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		err = archive.readZipIndex()
+	} else {
+		err = archive.readTarIndex()
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not read archive %s: %s", archivePath, err))
+	}
+
+	logrus.Debugf("Read index of archive %s with %d entries", archivePath, len(archive.entries))
+	openArchives[archivePath] = archive
+	return archive, nil
+}
+
+// Closes all archives opened during the run.
+func CloseArchives() {
+	openArchivesMutex.Lock()
+	defer openArchivesMutex.Unlock()
+
+	for archivePath, archive := range openArchives {
+		if archive.zipReader != nil {
+			_ = archive.zipReader.Close()
+		}
+		delete(openArchives, archivePath)
+	}
+}
+
+func (a *archiveIndex) readZipIndex() error {
+	reader, err := zip.OpenReader(a.path)
+	if err != nil {
+		return err
+	}
+
+	a.zipReader = reader
+	a.zipFiles = make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		name := strings.TrimSuffix(file.Name, "/")
+		a.zipFiles[name] = file
+		a.entries[name] = archiveEntry{name: name, isDir: file.FileInfo().IsDir(), modTime: file.Modified, info: file.FileInfo()}
+	}
+	return nil
+}
+
+func (a *archiveIndex) readTarIndex() error {
+	reader, closer, err := a.openTarReader()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		name := strings.TrimSuffix(path.Clean(header.Name), "/")
+		a.entries[name] = archiveEntry{name: name, isDir: header.Typeflag == tar.TypeDir, modTime: header.ModTime, info: header.FileInfo()}
+	}
+}
+
+func (a *archiveIndex) openTarReader() (*tar.Reader, io.Closer, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lowerPath := strings.ToLower(a.path)
+	if strings.HasSuffix(lowerPath, ".gz") || strings.HasSuffix(lowerPath, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(gzipReader), file, nil
+	}
+	return tar.NewReader(file), file, nil
+}
+
+func (a *archiveIndex) stat(name string) (os.FileInfo, error) {
+	entry, found := a.entries[name]
+	if !found {
+		return nil, &os.PathError{Op: "stat", Path: buildArchivePath(a.path, name), Err: os.ErrNotExist}
+	}
+	return entry.info, nil
+}
+
+// Opens the entry for reading. Zip entries are read directly, tar archives are read up to the entry
+// as they do not support random access.
+func (a *archiveIndex) open(name string) (io.ReadCloser, error) {
+	if _, err := a.stat(name); err != nil {
+		return nil, err
+	}
+
+	if a.zipFiles != nil {
+		return a.zipFiles[name].Open()
+	}
+
+	reader, closer, err := a.openTarReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			_ = closer.Close()
+			return nil, err
+		}
+		if strings.TrimSuffix(path.Clean(header.Name), "/") == name {
+			return &tarEntryReader{Reader: reader, closer: closer}, nil
+		}
+	}
+}
+
+type tarEntryReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *tarEntryReader) Close() error {
+	return r.closer.Close()
+}
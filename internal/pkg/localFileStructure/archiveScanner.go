@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Reads the structure of a zip or tar archive without extracting it. The directories inside the archive
+// are used to build the categories the same way as on the filesystem. Directories that are only implied
+// by the path of an entry are added as well.
+func ScanArchive(archivePath string, extensions []string, ignoreDirs []string, dirSuffixToSkip int) (map[string]*FilesystemNode, error) {
+	if !IsSupportedArchive(archivePath) {
+		return nil, errors.New(fmt.Sprintf("unsupported archive %s. Supported are %s", archivePath, strings.Join(supportedArchiveSuffixes, ", ")))
+	}
+
+	fullArchivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Scanning archive %s for images...", fullArchivePath)
+
+	archive, err := openArchive(fullArchivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreDirsMap := make(map[string]struct{}, len(ignoreDirs))
+	for _, ignoredFolder := range ignoreDirs {
+		ignoreDirsMap[strings.ToLower(ignoredFolder)] = struct{}{}
+	}
+	extensionsMap := buildExtensionsMap(extensions)
+
+	fileMap := make(map[string]*FilesystemNode)
+	for _, entry := range archive.entries {
+		if entry.isDir || isIgnoredArchiveEntry(entry.name, ignoreDirsMap) {
+			continue
+		}
+
+		_, extensionSupported := extensionsMap[strings.ToLower(path.Ext(entry.name))]
+		if !extensionSupported {
+			continue
+		}
+
+		directory := path.Dir(entry.name)
+		key := filepath.Join(trimPathForKey(filepath.FromSlash(directory), "", dirSuffixToSkip), path.Base(entry.name))
+		entryPath := buildArchivePath(fullArchivePath, entry.name)
+		fileMap[entryPath] = &FilesystemNode{
+			Key:     key,
+			Path:    entryPath,
+			Name:    filepath.Base(key),
+			IsDir:   false,
+			ModTime: entry.modTime,
+		}
+
+		addArchiveDirectories(fileMap, archive, directory, dirSuffixToSkip)
+	}
+
+	numberOfDirectories := 0
+	numberOfImages := 0
+	for _, node := range fileMap {
+		if node.IsDir {
+			numberOfDirectories += 1
+		} else {
+			numberOfImages += 1
+		}
+	}
+
+	logrus.Infof("Found %d directories and %d images in the archive", numberOfDirectories, numberOfImages)
+
+	return fileMap, nil
+}
+
+func addArchiveDirectories(fileMap map[string]*FilesystemNode, archive *archiveIndex, directory string, dirSuffixToSkip int) {
+	for directory != "." && directory != "/" {
+		directoryPath := buildArchivePath(archive.path, directory)
+		if _, exists := fileMap[directoryPath]; exists {
+			return
+		}
+
+		key := trimPathForKey(filepath.FromSlash(directory), "", dirSuffixToSkip)
+		node := &FilesystemNode{
+			Key:   key,
+			Path:  directoryPath,
+			Name:  filepath.Base(key),
+			IsDir: true,
+		}
+		if entry, found := archive.entries[directory]; found {
+			node.ModTime = entry.modTime
+		}
+		fileMap[directoryPath] = node
+
+		directory = path.Dir(directory)
+	}
+}
+
+// Hidden and ignored directories are skipped like on the filesystem. This also removes the resource forks
+// some archivers add to the archive.
+func isIgnoredArchiveEntry(name string, ignoreDirsMap map[string]struct{}) bool {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+		if _, ignored := ignoreDirsMap[strings.ToLower(part)]; ignored && i < len(parts)-1 {
+			return true
+		}
+	}
+	return false
+}
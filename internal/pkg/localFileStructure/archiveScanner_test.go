@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var archiveTestEntries = map[string]string{
+	"2019/summer/IMG_0001.jpg":     "first image",
+	"2019/summer/IMG_0002.JPG":     "second image",
+	"2019/notes.txt":               "not an image",
+	"2019/.hidden/IMG_0003.jpg":    "hidden image",
+	"__MACOSX/2019/._IMG_0001.jpg": "resource fork",
+}
+
+func Test_ScanArchive_should_read_zip_structure(t *testing.T) {
+	archivePath := createTestArchive(t, "photos.zip", writeZipArchive)
+	assertArchiveStructure(t, archivePath)
+}
+
+func Test_ScanArchive_should_read_tar_gz_structure(t *testing.T) {
+	archivePath := createTestArchive(t, "photos.tar.gz", writeTarGzArchive)
+	assertArchiveStructure(t, archivePath)
+}
+
+func Test_ScanArchive_should_fail_on_unsupported_archive(t *testing.T) {
+	_, err := ScanArchive("photos.rar", nil, nil, 0)
+	if err == nil {
+		t.Error("Expected an error as rar archives are not supported")
+	}
+}
+
+func Test_Stat_should_report_missing_archive_entry(t *testing.T) {
+	archivePath := createTestArchive(t, "photos.zip", writeZipArchive)
+
+	_, err := Stat(buildArchivePath(archivePath, "2019/missing.jpg"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error but got %v", err)
+	}
+}
+
+func assertArchiveStructure(t *testing.T, archivePath string) {
+	nodes, err := ScanArchive(archivePath, []string{"jpg"}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 4 { // 2x folder, 2x image
+		t.Fatalf("Expected 2 images and 2 folders but got %d entries", len(nodes))
+	}
+
+	imagePath := buildArchivePath(archivePath, "2019/summer/IMG_0001.jpg")
+	image, found := nodes[imagePath]
+	if !found || image.IsDir || image.Key != filepath.Join("2019", "summer", "IMG_0001.jpg") {
+		t.Fatalf("Did not find the expected image %s", imagePath)
+	}
+
+	folder, found := nodes[buildArchivePath(archivePath, "2019/summer")]
+	if !found || !folder.IsDir || folder.Key != filepath.Join("2019", "summer") || folder.Name != "summer" {
+		t.Errorf("Did not find the expected folder of the image")
+	}
+
+	if _, found := nodes[buildArchivePath(archivePath, "2019")]; !found {
+		t.Errorf("Did not find the implicit parent folder")
+	}
+
+	md5sum, err := CalculateFileCheckSums(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md5sum != fmt.Sprintf("%x", md5.Sum([]byte("first image"))) {
+		t.Errorf("Unexpected md5sum %s of the archive entry", md5sum)
+	}
+
+	info, err := Stat(imagePath)
+	if err != nil || info.Name() != "IMG_0001.jpg" || info.Size() != int64(len("first image")) {
+		t.Errorf("Unexpected file info %v of the archive entry - %v", info, err)
+	}
+}
+
+func createTestArchive(t *testing.T, name string, writeArchive func(writer io.Writer) error) string {
+	dir, err := ioutil.TempDir("", "archivetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(dir, name)
+	t.Cleanup(func() {
+		CloseArchives()
+		_ = os.RemoveAll(dir)
+	})
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = writeArchive(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func writeZipArchive(writer io.Writer) error {
+	zipWriter := zip.NewWriter(writer)
+	for name, content := range archiveTestEntries {
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(entry, content); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func writeTarGzArchive(writer io.Writer) error {
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range archiveTestEntries {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tarWriter, content); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
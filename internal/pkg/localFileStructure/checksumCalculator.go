@@ -7,14 +7,110 @@ package localFileStructure
 
 import (
 	"crypto/md5"
+	"crypto/sha1"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"hash"
 	"io"
-	"os"
+	"sync"
+	"time"
 )
 
+// Algorithms supported to detect local changes. Piwigo always gets the md5sum.
+const (
+	ChecksumMd5  = "md5"
+	ChecksumSha1 = "sha1"
+)
+
+// Returns the md5sum required by piwigo and the checksum used to detect local changes.
+type ChecksumCalculator func(filePath string) (string, string, error)
+
+// Creates a calculator that calculates the md5sum and the checksum of the given algorithm while reading the file once.
+func NewChecksumCalculator(algorithm string) (ChecksumCalculator, error) {
+	if algorithm != ChecksumMd5 && algorithm != ChecksumSha1 {
+		return nil, errors.New(fmt.Sprintf("unknown checksum algorithm %s. Use one of md5 or sha1", algorithm))
+	}
+
+	return func(filePath string) (string, string, error) {
+		file, err := OpenFile(filePath)
+		if err != nil {
+			logrus.Errorf("Could not open file %s", filePath)
+			return "", "", err
+		}
+		defer file.Close()
+
+		md5sum, checksum, err := CalculateCheckSums(file, algorithm)
+		if err != nil {
+			logrus.Errorf("Could calculate checksums of file %s", filePath)
+			return "", "", err
+		}
+
+		logrus.Tracef("Calculated md5 sum of %s - %s, checksum %s", filePath, md5sum, checksum)
+		return md5sum, checksum, nil
+	}, nil
+}
+
+// Remembers the checksums of every file, so multiple synchronizations of the same files during a run read them only once.
+// Files that got modified since their checksums got calculated are read again.
+func NewCachingChecksumCalculator(calculator ChecksumCalculator) ChecksumCalculator {
+	type checksums struct {
+		md5sum   string
+		checksum string
+		modTime  time.Time
+	}
+	var mutex sync.Mutex
+	cache := make(map[string]checksums)
+
+	return func(filePath string) (string, string, error) {
+		var modTime time.Time
+		if fileInfo, err := Stat(filePath); err == nil {
+			modTime = fileInfo.ModTime()
+		}
+
+		mutex.Lock()
+		cached, ok := cache[filePath]
+		mutex.Unlock()
+		if ok && cached.modTime.Equal(modTime) {
+			return cached.md5sum, cached.checksum, nil
+		}
+
+		md5sum, checksum, err := calculator(filePath)
+		if err != nil {
+			return "", "", err
+		}
+
+		mutex.Lock()
+		cache[filePath] = checksums{md5sum: md5sum, checksum: checksum, modTime: modTime}
+		mutex.Unlock()
+		return md5sum, checksum, nil
+	}
+}
+
+// Calculates the md5sum and the checksum of the given algorithm. The checksum is prefixed with the algorithm
+// to detect a change of the algorithm.
+func CalculateCheckSums(reader io.Reader, algorithm string) (string, string, error) {
+	md5Hash := md5.New()
+	var checksumHash hash.Hash
+	writer := io.Writer(md5Hash)
+	if algorithm == ChecksumSha1 {
+		checksumHash = sha1.New()
+		writer = io.MultiWriter(md5Hash, checksumHash)
+	}
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		return "", "", err
+	}
+
+	md5sum := fmt.Sprintf("%x", md5Hash.Sum(nil))
+	if checksumHash == nil {
+		return md5sum, ChecksumMd5 + ":" + md5sum, nil
+	}
+	return md5sum, fmt.Sprintf("%s:%x", algorithm, checksumHash.Sum(nil)), nil
+}
+
 func CalculateFileCheckSums(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+	file, err := OpenFile(filePath)
 	if err != nil {
 		logrus.Errorf("Could not open file %s", filePath)
 		return "", err
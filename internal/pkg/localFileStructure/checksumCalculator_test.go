@@ -8,7 +8,10 @@ package localFileStructure
 import (
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestCalculateFileCheckSumsWithValidFile(t *testing.T) {
@@ -41,3 +44,80 @@ func TestCalculateFileCheckSumsWithWrongPath(t *testing.T) {
 		t.Errorf("the error was not logged")
 	}
 }
+
+func TestNewChecksumCalculatorWithSha1(t *testing.T) {
+	calculator, err := NewChecksumCalculator(ChecksumSha1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md5sum, checksum, err := calculator("../../../test/md5testfile.txt")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if md5sum != "2e7c66bd6657b1a8659ba05af26a0f7e" {
+		t.Errorf("wrong md5 sum provided: got %s", md5sum)
+	}
+	if checksum != "sha1:ebe2494f17398ec6100252cd5a9072b559f22d69" {
+		t.Errorf("wrong sha1 checksum provided: got %s", checksum)
+	}
+}
+
+func TestNewChecksumCalculatorWithUnknownAlgorithm(t *testing.T) {
+	_, err := NewChecksumCalculator("crc32")
+	if err == nil {
+		t.Error("there was no error using an unknown checksum algorithm")
+	}
+}
+
+func TestCachingChecksumCalculatorReadsFilesOnce(t *testing.T) {
+	calls := 0
+	calculator := NewCachingChecksumCalculator(func(filePath string) (string, string, error) {
+		calls++
+		return "md5-" + filePath, "md5:" + filePath, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		md5sum, checksum, err := calculator("a.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md5sum != "md5-a.jpg" || checksum != "md5:a.jpg" {
+			t.Errorf("unexpected checksums %s %s", md5sum, checksum)
+		}
+	}
+	_, _, _ = calculator("b.jpg")
+
+	if calls != 2 {
+		t.Errorf("expected the checksums of two files to be calculated once but got %d calculations", calls)
+	}
+}
+
+func TestCachingChecksumCalculatorReadsModifiedFilesAgain(t *testing.T) {
+	file, err := ioutil.TempFile("", "checksumtest*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+	defer os.Remove(file.Name())
+
+	calls := 0
+	calculator := NewCachingChecksumCalculator(func(filePath string) (string, string, error) {
+		calls++
+		return "md5", "md5:", nil
+	})
+
+	_, _, _ = calculator(file.Name())
+	modTime := time.Now().Add(time.Minute)
+	err = os.Chtimes(file.Name(), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _ = calculator(file.Name())
+	_, _, _ = calculator(file.Name())
+
+	if calls != 2 {
+		t.Errorf("expected the modified file to be read again once but got %d calculations", calls)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The file in a directory that overrides the number of parallel uploads of all images below the directory.
+const ConcurrencyMarkerFile = ".piwigo-concurrency"
+
+// The highest number of parallel uploads a marker file may set.
+const MaxConcurrencyOverride = 32
+
+// The number of parallel uploads of the directories containing a marker file. Each directory applies to its whole
+// subtree until a deeper directory has its own marker file.
+type ConcurrencyOverrides struct {
+	limits map[string]int
+}
+
+// Reads the marker files of the root path and all scanned directories. Marker files that do not contain a number
+// between 1 and MaxConcurrencyOverride are ignored with a warning, so the global setting applies.
+func ReadConcurrencyOverrides(rootPath string, nodes map[string]*FilesystemNode) *ConcurrencyOverrides {
+	overrides := &ConcurrencyOverrides{limits: make(map[string]int)}
+
+	directories := make([]string, 0)
+	if fullPathRoot, err := filepath.Abs(rootPath); err == nil {
+		directories = append(directories, fullPathRoot)
+	}
+	for _, node := range nodes {
+		if node.IsDir {
+			directories = append(directories, node.Path)
+		}
+	}
+
+	for _, directory := range directories {
+		markerPath := filepath.Join(directory, ConcurrencyMarkerFile)
+		content, err := ioutil.ReadFile(markerPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			logrus.Warnf("Could not read %s, using the global number of parallel uploads - %s", markerPath, err)
+			continue
+		}
+
+		limit, err := parseConcurrencyMarker(content)
+		if err != nil {
+			logrus.Warnf("Ignoring %s, using the global number of parallel uploads - %s", markerPath, err)
+			continue
+		}
+		logrus.Infof("Uploading the images below %s with %d parallel uploads", directory, limit)
+		overrides.limits[directory] = limit
+	}
+	return overrides
+}
+
+func parseConcurrencyMarker(content []byte) (int, error) {
+	value := strings.TrimSpace(string(content))
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MaxConcurrencyOverride {
+		return 0, errors.New(fmt.Sprintf("%q is not a number between 1 and %d", value, MaxConcurrencyOverride))
+	}
+	return limit, nil
+}
+
+// Returns the directory of the nearest marker file above the image and its number of parallel uploads.
+// Returns false if the global setting applies.
+func (overrides *ConcurrencyOverrides) Lookup(imagePath string) (string, int, bool) {
+	if overrides == nil || len(overrides.limits) == 0 {
+		return "", 0, false
+	}
+
+	directory := filepath.Dir(imagePath)
+	for {
+		if limit, found := overrides.limits[directory]; found {
+			return directory, limit, true
+		}
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return "", 0, false
+		}
+		directory = parent
+	}
+}
+
+// The highest number of parallel uploads of all marker files or zero if there are none.
+func (overrides *ConcurrencyOverrides) Max() int {
+	if overrides == nil {
+		return 0
+	}
+
+	max := 0
+	for _, limit := range overrides.limits {
+		if limit > max {
+			max = limit
+		}
+	}
+	return max
+}
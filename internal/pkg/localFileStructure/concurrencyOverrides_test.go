@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ReadConcurrencyOverrides_applies_the_nearest_marker_to_the_subtree(t *testing.T) {
+	root := createConcurrencyTestTree(t, map[string]string{
+		"network":       "1\n",
+		"network/local": "8",
+	})
+	nodes := scanConcurrencyTestTree(t, root)
+
+	overrides := ReadConcurrencyOverrides(root, nodes)
+
+	directory, limit, found := overrides.Lookup(filepath.Join(root, "network", "2019", "image.jpg"))
+	if !found || limit != 1 || directory != filepath.Join(root, "network") {
+		t.Errorf("expected the limit 1 of the network directory but got %d of %s", limit, directory)
+	}
+	_, limit, found = overrides.Lookup(filepath.Join(root, "network", "local", "image.jpg"))
+	if !found || limit != 8 {
+		t.Errorf("expected the limit 8 of the nested directory but got %d", limit)
+	}
+	_, _, found = overrides.Lookup(filepath.Join(root, "ssd", "image.jpg"))
+	if found {
+		t.Error("expected the global setting for directories without a marker file")
+	}
+	if overrides.Max() != 8 {
+		t.Errorf("unexpected max %d", overrides.Max())
+	}
+}
+
+func Test_ReadConcurrencyOverrides_reads_the_marker_of_the_root_path(t *testing.T) {
+	root := createConcurrencyTestTree(t, map[string]string{"": "2"})
+
+	overrides := ReadConcurrencyOverrides(root, scanConcurrencyTestTree(t, root))
+
+	_, limit, found := overrides.Lookup(filepath.Join(root, "ssd", "image.jpg"))
+	if !found || limit != 2 {
+		t.Errorf("expected the limit 2 of the root path but got %d", limit)
+	}
+}
+
+func Test_ReadConcurrencyOverrides_ignores_invalid_markers(t *testing.T) {
+	for _, content := range []string{"", "fast", "0", "-1", "33", "2.5"} {
+		root := createConcurrencyTestTree(t, map[string]string{"network": content})
+
+		overrides := ReadConcurrencyOverrides(root, scanConcurrencyTestTree(t, root))
+
+		if _, _, found := overrides.Lookup(filepath.Join(root, "network", "image.jpg")); found {
+			t.Errorf("expected the marker %q to be ignored", content)
+		}
+	}
+}
+
+func Test_ConcurrencyOverrides_nil_uses_the_global_setting(t *testing.T) {
+	var overrides *ConcurrencyOverrides
+
+	if _, _, found := overrides.Lookup("/images/image.jpg"); found || overrides.Max() != 0 {
+		t.Error("expected no overrides")
+	}
+}
+
+func createConcurrencyTestTree(t *testing.T, markers map[string]string) string {
+	root, err := ioutil.TempDir("", "concurrency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	for _, directory := range []string{"network/2019", "network/local", "ssd"} {
+		err = os.MkdirAll(filepath.Join(root, directory), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for directory, content := range markers {
+		err = ioutil.WriteFile(filepath.Join(root, directory, ConcurrencyMarkerFile), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func scanConcurrencyTestTree(t *testing.T, root string) map[string]*FilesystemNode {
+	nodes, err := ScanLocalFileStructure(root, []string{"jpg"}, nil, nil, 0, DepthLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+// Removes the directories that hold no images, neither directly nor in one of their sub directories, so they get no
+// category. Returns the number of removed directories.
+func RemoveEmptyDirectories(nodes map[string]*FilesystemNode) int {
+	imageCounts := countImagesPerDirectory(nodes)
+
+	removed := 0
+	for path, node := range nodes {
+		if node.IsDir && imageCounts[node.Key] == 0 {
+			logrus.Debugf("%s: No category as the directory holds no images", node.Path)
+			delete(nodes, path)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		logrus.Infof("Skipping %d directories without images, use createEmptyAlbums to create their categories", removed)
+	}
+	return removed
+}
+
+// Returns the number of images in every directory including the images of its sub directories by the key of the
+// directory.
+func countImagesPerDirectory(nodes map[string]*FilesystemNode) map[string]int {
+	imageCounts := make(map[string]int)
+	for _, node := range nodes {
+		if node.IsDir {
+			continue
+		}
+		directory := filepath.Dir(node.Key)
+		for directory != "." && directory != string(filepath.Separator) {
+			imageCounts[directory]++
+			directory = filepath.Dir(directory)
+		}
+	}
+	return imageCounts
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_RemoveEmptyDirectories_removes_branches_without_images(t *testing.T) {
+	nodes := make(map[string]*FilesystemNode)
+	for _, key := range []string{"2019", "2019/Summer", "2019/Summer/cache", "cache", "cache/thumbs", "cache/thumbs/small", "2020"} {
+		key = filepath.FromSlash(key)
+		nodes[key] = &FilesystemNode{Key: key, Name: filepath.Base(key), IsDir: true}
+	}
+	for _, key := range []string{"2019/Summer/a.jpg", "2020/b.jpg"} {
+		key = filepath.FromSlash(key)
+		nodes[key] = &FilesystemNode{Key: key, Name: filepath.Base(key)}
+	}
+
+	removed := RemoveEmptyDirectories(nodes)
+
+	if removed != 4 {
+		t.Errorf("expected 4 removed directories but got %d", removed)
+	}
+	expected := []string{"2019", "2019/Summer", "2020", "2019/Summer/a.jpg", "2020/b.jpg"}
+	if len(nodes) != len(expected) {
+		t.Errorf("expected %d nodes but got %d", len(expected), len(nodes))
+	}
+	for _, key := range expected {
+		if _, found := nodes[filepath.FromSlash(key)]; !found {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import "os"
+
+// The file info has no inode on this platform, so moved files are always detected by their checksum.
+func fileId(info os.FileInfo) string {
+	return ""
+}
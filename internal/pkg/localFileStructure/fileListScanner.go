@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Builds the filesystem nodes from a newline delimited list of files instead of walking the images root.
+// Each file has to exist, must be a regular file and has to be located below the given root path. The categories
+// are derived of the path relative to the root path, the same way as ScanLocalFileStructure does.
+func ScanFileList(fileList io.Reader, path string, dirSuffixToSkip int) (map[string]*FilesystemNode, error) {
+	fullPathRoot, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Reading the list of images below %s...", fullPathRoot)
+
+	fileMap := make(map[string]*FilesystemNode)
+	fullPathReplace := fmt.Sprintf("%s%c", fullPathRoot, os.PathSeparator)
+	numberOfImages := 0
+
+	scanner := bufio.NewScanner(fileList)
+	for scanner.Scan() {
+		filePath := strings.TrimSpace(scanner.Text())
+		if filePath == "" {
+			continue
+		}
+
+		filePath, err = filepath.Abs(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(filePath, fullPathReplace) {
+			return nil, errors.New(fmt.Sprintf("the file %s is not located below the images root %s", filePath, fullPathRoot))
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return nil, errors.New(fmt.Sprintf("the file %s is not a regular file", filePath))
+		}
+
+		if _, exists := fileMap[filePath]; exists {
+			logrus.Debugf("Skipping duplicate entry %s", filePath)
+			continue
+		}
+
+		key := buildKey(filePath, info, fullPathReplace, dirSuffixToSkip)
+		fileMap[filePath] = &FilesystemNode{
+			Key:     key,
+			Path:    filePath,
+			Name:    filepath.Base(key),
+			IsDir:   false,
+			ModTime: info.ModTime(),
+		}
+		numberOfImages += 1
+
+		err = addDirectoriesOfFile(fileMap, filePath, fullPathRoot, fullPathReplace, dirSuffixToSkip)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Found %d images in the list of files", numberOfImages)
+
+	return fileMap, nil
+}
+
+func addDirectoriesOfFile(fileMap map[string]*FilesystemNode, filePath string, fullPathRoot string, fullPathReplace string, dirSuffixToSkip int) error {
+	directory := filepath.Dir(filePath)
+	for directory != fullPathRoot {
+		if _, exists := fileMap[directory]; exists {
+			return nil
+		}
+
+		info, err := os.Stat(directory)
+		if err != nil {
+			return err
+		}
+
+		key := buildKey(directory, info, fullPathReplace, dirSuffixToSkip)
+		fileMap[directory] = &FilesystemNode{
+			Key:     key,
+			Path:    directory,
+			Name:    filepath.Base(key),
+			IsDir:   true,
+			ModTime: info.ModTime(),
+		}
+		directory = filepath.Dir(directory)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_ScanFileList_should_build_file_and_directory(t *testing.T) {
+	imagePath, _ := filepath.Abs("../../../test/images/testimage.jpg")
+
+	images, err := ScanFileList(strings.NewReader(imagePath+"\n\n"), "../../../test/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 2 { // 1x folder, 1x image
+		t.Fatalf("Expected the image and its folder but got %d entries", len(images))
+	}
+
+	image, found := images[imagePath]
+	if !found || image.IsDir || image.Key != "images/testimage.jpg" {
+		t.Errorf("Did not find the expected testimage.")
+	}
+
+	folder, found := images[filepath.Dir(imagePath)]
+	if !found || !folder.IsDir || folder.Key != "images" {
+		t.Errorf("Did not find the expected folder of the testimage.")
+	}
+}
+
+func Test_ScanFileList_should_fail_on_missing_file(t *testing.T) {
+	imagePath, _ := filepath.Abs("../../../test/images/missing.jpg")
+
+	_, err := ScanFileList(strings.NewReader(imagePath), "../../../test/", 0)
+	if err == nil {
+		t.Error("Expected an error as the file does not exist")
+	}
+}
+
+func Test_ScanFileList_should_fail_on_directory(t *testing.T) {
+	directoryPath, _ := filepath.Abs("../../../test/images")
+
+	_, err := ScanFileList(strings.NewReader(directoryPath), "../../../test/", 0)
+	if err == nil {
+		t.Error("Expected an error as the entry is a directory")
+	}
+}
+
+func Test_ScanFileList_should_fail_on_file_outside_of_root(t *testing.T) {
+	imagePath, _ := filepath.Abs("../../../test/images/testimage.jpg")
+
+	_, err := ScanFileList(strings.NewReader(imagePath), "../../../internal/", 0)
+	if err == nil {
+		t.Error("Expected an error as the file is not below the root path")
+	}
+}
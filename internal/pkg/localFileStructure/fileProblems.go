@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Policies for files without content.
+const (
+	// the empty file is skipped with a warning
+	EmptyFileSkip = "skip"
+	// the synchronization stops
+	EmptyFileError = "error"
+)
+
+// A file that is not synchronized as it is empty or can not be read.
+type FileProblem struct {
+	Path   string
+	Reason string
+	// the file is readable but empty, all other problems are read errors
+	Empty bool
+}
+
+// Returns the nodes without the files that are empty or can not be read, together with the problems of the removed
+// files sorted by their path. The files are kept in the local database, so their images are neither uploaded nor
+// deleted on the server. With the policy EmptyFileError an empty file returns an error instead.
+func CheckFiles(nodes map[string]*FilesystemNode, onEmptyFile string) (map[string]*FilesystemNode, []FileProblem, error) {
+	remaining := make(map[string]*FilesystemNode, len(nodes))
+	var problems []FileProblem
+	var emptyFiles []string
+	for path, node := range nodes {
+		if node.IsDir {
+			remaining[path] = node
+			continue
+		}
+
+		problem, found := checkFile(node.Path)
+		if !found {
+			remaining[path] = node
+			continue
+		}
+		if problem.Empty {
+			emptyFiles = append(emptyFiles, node.Path)
+			logrus.Warnf("%s: Skipping the file as it is empty", node.Path)
+		} else {
+			logrus.Errorf("%s: Skipping the file - %s", node.Path, problem.Reason)
+		}
+		problems = append(problems, problem)
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	if onEmptyFile == EmptyFileError && len(emptyFiles) > 0 {
+		sort.Strings(emptyFiles)
+		return nil, nil, errors.New(fmt.Sprintf("found %d empty files: %s", len(emptyFiles), strings.Join(emptyFiles, ", ")))
+	}
+	return remaining, problems, nil
+}
+
+func checkFile(filePath string) (FileProblem, bool) {
+	info, err := Stat(filePath)
+	if err != nil {
+		return FileProblem{Path: filePath, Reason: readErrorReason(err)}, true
+	}
+	if info.Size() == 0 {
+		return FileProblem{Path: filePath, Reason: "the file is empty", Empty: true}, true
+	}
+
+	file, err := OpenFile(filePath)
+	if err != nil {
+		return FileProblem{Path: filePath, Reason: readErrorReason(err)}, true
+	}
+	_ = file.Close()
+	return FileProblem{}, false
+}
+
+func readErrorReason(err error) string {
+	if errors.Is(err, os.ErrPermission) {
+		return "no permission to read the file"
+	}
+	return fmt.Sprintf("the file can not be read - %s", err)
+}
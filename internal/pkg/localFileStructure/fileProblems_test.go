@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_CheckFiles_skips_empty_and_unreadable_files(t *testing.T) {
+	root, err := ioutil.TempDir("", "fileProblems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	nodes := map[string]*FilesystemNode{"album": {Key: "album", Path: filepath.Join(root, "album"), IsDir: true}}
+	for name, content := range map[string]string{"image.jpg": "jpeg", "empty.jpg": "", "locked.jpg": "jpeg"} {
+		path := filepath.Join(root, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		nodes[name] = &FilesystemNode{Key: name, Path: path, Name: name}
+	}
+	lockedPath := filepath.Join(root, "locked.jpg")
+	if err := os.Chmod(lockedPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(lockedPath, 0644) })
+	// the permissions do not keep root from reading the file
+	unreadable := true
+	if file, err := os.Open(lockedPath); err == nil {
+		_ = file.Close()
+		unreadable = false
+	}
+
+	remaining, problems, err := CheckFiles(nodes, EmptyFileSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FileProblem{{Path: filepath.Join(root, "empty.jpg"), Reason: "the file is empty", Empty: true}}
+	if unreadable {
+		expected = append(expected, FileProblem{Path: lockedPath, Reason: "no permission to read the file"})
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems but got %v", len(expected), problems)
+	}
+	for i := range expected {
+		if problems[i] != expected[i] {
+			t.Errorf("expected problem %v but got %v", expected[i], problems[i])
+		}
+	}
+	if len(remaining) != len(nodes)-len(expected) {
+		t.Errorf("expected %d remaining nodes but got %d", len(nodes)-len(expected), len(remaining))
+	}
+	for _, key := range []string{"album", "image.jpg"} {
+		if _, found := remaining[key]; !found {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+}
+
+func Test_CheckFiles_returns_an_error_for_empty_files(t *testing.T) {
+	file, err := ioutil.TempFile("", "empty*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+	_ = file.Close()
+
+	nodes := map[string]*FilesystemNode{"empty.jpg": {Key: "empty.jpg", Path: file.Name(), Name: "empty.jpg"}}
+	_, _, err = CheckFiles(nodes, EmptyFileError)
+	if err == nil {
+		t.Error("expected an error for the empty file")
+	}
+}
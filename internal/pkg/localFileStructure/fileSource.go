@@ -0,0 +1,39 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"io"
+	"os"
+)
+
+// Opens the image for reading. The path may point to a file on the filesystem or to an entry of an archive.
+func OpenFile(filePath string) (io.ReadCloser, error) {
+	archivePath, entryName, isArchive := splitArchivePath(filePath)
+	if !isArchive {
+		return os.Open(filePath)
+	}
+
+	archive, err := openArchive(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return archive.open(entryName)
+}
+
+// Returns the file info of the image. The path may point to a file on the filesystem or to an entry of an archive.
+func Stat(filePath string) (os.FileInfo, error) {
+	archivePath, entryName, isArchive := splitArchivePath(filePath)
+	if !isArchive {
+		return os.Stat(filePath)
+	}
+
+	archive, err := openArchive(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return archive.stat(entryName)
+}
@@ -20,13 +20,29 @@ type FilesystemNode struct {
 	Name    string
 	IsDir   bool
 	ModTime time.Time
+	// the size and the device and inode of files on the filesystem. FileId is empty if the platform has no inodes.
+	Size   int64
+	FileId string
 }
 
 func (n *FilesystemNode) String() string {
 	return fmt.Sprintf("FilesystemNode: %s", n.Path)
 }
 
-func ScanLocalFileStructure(path string, extensions []string, ignoreDirs []string, dirSuffixToSkip int) (map[string]*FilesystemNode, error) {
+// Limits how deep the scan descends below the root path.
+type DepthLimit struct {
+	// the number of directory levels below the root path that are scanned, zero scans all levels
+	MaxDepth int
+	// the images of the directories below MaxDepth are added to their parent directory on the level MaxDepth instead
+	// of being skipped
+	Flatten bool
+}
+
+// Walks the given path and collects all directories and supported images below it.
+// If include patterns are given, only the matching entries, everything below matching directories and the
+// parent directories required to build the category hierarchy are returned. Ignored directories are removed afterwards.
+// The directories below the maximum depth of the limit are skipped or flattened.
+func ScanLocalFileStructure(path string, extensions []string, ignoreDirs []string, includes []string, dirSuffixToSkip int, depthLimit DepthLimit) (map[string]*FilesystemNode, error) {
 	fullPathRoot, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
@@ -37,23 +53,23 @@ func ScanLocalFileStructure(path string, extensions []string, ignoreDirs []strin
 		ignoreDirsMap[strings.ToLower(ignoredFolder)] = struct{}{}
 	}
 
-	extensionsMap := make(map[string]struct{}, len(extensions))
-	for _, extension := range extensions {
-		extensionsMap["."+strings.ToLower(extension)] = struct{}{}
-	}
-
-	if len(extensionsMap) == 0 {
-		logrus.Debug("No extensions specified, adding jpg and png")
-		extensionsMap[".jpg"] = struct{}{}
-		extensionsMap[".png"] = struct{}{}
+	extensionsMap := buildExtensionsMap(extensions)
+	includeMatcher, err := newPathMatcher(includes)
+	if err != nil {
+		return nil, err
 	}
 
 	logrus.Infof("Scanning %s for images...", fullPathRoot)
 
 	fileMap := make(map[string]*FilesystemNode)
 	fullPathReplace := fmt.Sprintf("%s%c", fullPathRoot, os.PathSeparator)
-	numberOfDirectories := 0
-	numberOfImages := 0
+
+	// directories that are not included by any pattern are kept aside as they may be needed
+	// as parents of included entries further down the tree.
+	excludedDirectories := make(map[string]*FilesystemNode)
+	includedDirectories := make(map[string]struct{})
+	// the paths of the images by key while flattening, two images of different directories may get the same key
+	flattenedKeys := make(map[string]string)
 
 	err = filepath.Walk(fullPathRoot, func(path string, info os.FileInfo, err error) error {
 		if fullPathRoot == path {
@@ -74,6 +90,19 @@ func ScanLocalFileStructure(path string, extensions []string, ignoreDirs []strin
 			return filepath.SkipDir
 		}
 
+		level := directoryLevel(path, info, fullPathReplace)
+		if depthLimit.MaxDepth > 0 && info.IsDir() && level > depthLimit.MaxDepth {
+			if !depthLimit.Flatten {
+				logrus.Infof("Skipping %s as it is deeper than the maximum depth of %d", path, depthLimit.MaxDepth)
+				return filepath.SkipDir
+			}
+			logrus.Debugf("Adding the images of %s to its parent on level %d", path, depthLimit.MaxDepth)
+			if isIncluded(includeMatcher, includedDirectories, path, fullPathReplace, info.Name()) {
+				includedDirectories[path] = struct{}{}
+			}
+			return nil
+		}
+
 		extension := strings.ToLower(filepath.Ext(path))
 		_, extensionSupported := extensionsMap[extension]
 		if !extensionSupported && !info.IsDir() {
@@ -81,20 +110,48 @@ func ScanLocalFileStructure(path string, extensions []string, ignoreDirs []strin
 		}
 
 		key := buildKey(path, info, fullPathReplace, dirSuffixToSkip)
+		if depthLimit.MaxDepth > 0 && depthLimit.Flatten && !info.IsDir() {
+			if level > depthLimit.MaxDepth {
+				directory := filepath.Dir(path)
+				for i := level; i > depthLimit.MaxDepth; i-- {
+					directory = filepath.Dir(directory)
+				}
+				key = filepath.Join(trimPathForKey(directory, fullPathReplace, dirSuffixToSkip), info.Name())
+			}
+		}
 
-		fileMap[path] = &FilesystemNode{
+		node := &FilesystemNode{
 			Key:     key,
 			Path:    path,
 			Name:    filepath.Base(key),
 			IsDir:   info.IsDir(),
 			ModTime: info.ModTime(),
 		}
+		if !info.IsDir() {
+			node.Size = info.Size()
+			node.FileId = fileId(info)
+		}
+
+		if !isIncluded(includeMatcher, includedDirectories, path, fullPathReplace, info.Name()) {
+			if info.IsDir() {
+				excludedDirectories[path] = node
+			}
+			return nil
+		}
+
+		if depthLimit.MaxDepth > 0 && depthLimit.Flatten && !info.IsDir() {
+			// only the included images take the key, so an excluded image does not hide an included one
+			if other, exists := flattenedKeys[key]; exists {
+				logrus.Warnf("Skipping %s as the image %s has the same name after flattening", path, other)
+				return nil
+			}
+			flattenedKeys[key] = path
+		}
 
 		if info.IsDir() {
-			numberOfDirectories += 1
-		} else {
-			numberOfImages += 1
+			includedDirectories[path] = struct{}{}
 		}
+		fileMap[path] = node
 
 		return nil
 	})
@@ -103,11 +160,91 @@ func ScanLocalFileStructure(path string, extensions []string, ignoreDirs []strin
 		return nil, err
 	}
 
+	if !includeMatcher.isEmpty() {
+		addParentDirectories(fileMap, excludedDirectories, fullPathRoot)
+	}
+
+	numberOfDirectories := 0
+	numberOfImages := 0
+	for _, node := range fileMap {
+		if node.IsDir {
+			numberOfDirectories += 1
+		} else {
+			numberOfImages += 1
+		}
+	}
+
 	logrus.Infof("Found %d directories and %d images on the local filesystem", numberOfDirectories, numberOfImages)
 
 	return fileMap, nil
 }
 
+func buildExtensionsMap(extensions []string) map[string]struct{} {
+	extensionsMap := make(map[string]struct{}, len(extensions))
+	for _, extension := range extensions {
+		extensionsMap["."+strings.ToLower(extension)] = struct{}{}
+	}
+
+	if len(extensionsMap) == 0 {
+		logrus.Debug("No extensions specified, adding jpg and png")
+		extensionsMap[".jpg"] = struct{}{}
+		extensionsMap[".png"] = struct{}{}
+	}
+	return extensionsMap
+}
+
+func isIncluded(includeMatcher *pathMatcher, includedDirectories map[string]struct{}, path string, fullPathReplace string, name string) bool {
+	if includeMatcher.isEmpty() {
+		return true
+	}
+
+	if _, parentIncluded := includedDirectories[filepath.Dir(path)]; parentIncluded {
+		return true
+	}
+
+	relativePath := strings.Replace(path, fullPathReplace, "", 1)
+	if includeMatcher.matches(relativePath, name) {
+		logrus.Tracef("Including %s as it matches an include pattern", path)
+		return true
+	}
+	return false
+}
+
+// All parents of the included entries need to be present to create the category hierarchy.
+func addParentDirectories(fileMap map[string]*FilesystemNode, excludedDirectories map[string]*FilesystemNode, fullPathRoot string) {
+	includedPaths := make([]string, 0, len(fileMap))
+	for path := range fileMap {
+		includedPaths = append(includedPaths, path)
+	}
+
+	for _, path := range includedPaths {
+		parent := filepath.Dir(path)
+		for parent != fullPathRoot && parent != filepath.Dir(parent) {
+			if _, exists := fileMap[parent]; exists {
+				break
+			}
+			node, found := excludedDirectories[parent]
+			if !found {
+				// the flattened directories below the maximum depth are not part of the scan
+				parent = filepath.Dir(parent)
+				continue
+			}
+			logrus.Tracef("Adding parent directory %s of included entry %s", parent, path)
+			fileMap[parent] = node
+			parent = filepath.Dir(parent)
+		}
+	}
+}
+
+// The level of a directory below the root path starting with 1, the level of the directory of a file.
+func directoryLevel(path string, info os.FileInfo, fullPathReplace string) int {
+	level := strings.Count(strings.Replace(path, fullPathReplace, "", 1), string(os.PathSeparator))
+	if info.IsDir() {
+		return level + 1
+	}
+	return level
+}
+
 func buildKey(path string, info os.FileInfo, fullPathReplace string, dirSuffixToSkip int) string {
 	if info.IsDir() {
 		return trimPathForKey(path, fullPathReplace, dirSuffixToSkip)
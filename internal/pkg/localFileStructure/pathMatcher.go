@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The pathMatcher uses the same semantics as the ignored directories: the comparison is case insensitive
+// and a pattern matches the name of the file or directory. Additionally, shell globs are supported and a pattern
+// may contain path separators to match the path relative to the images root.
+type pathMatcher struct {
+	patterns []string
+}
+
+// Returns an error for an invalid pattern, as dropping it would change what gets synchronized, e.g. an empty list of
+// include patterns includes everything.
+func newPathMatcher(patterns []string) (*pathMatcher, error) {
+	matcher := &pathMatcher{patterns: make([]string, 0, len(patterns))}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid pattern %s - %s", pattern, err))
+		}
+		matcher.patterns = append(matcher.patterns, strings.ToLower(filepath.Clean(pattern)))
+	}
+	return matcher, nil
+}
+
+func (m *pathMatcher) isEmpty() bool {
+	return len(m.patterns) == 0
+}
+
+func (m *pathMatcher) matches(relativePath string, name string) bool {
+	lowerPath := strings.ToLower(relativePath)
+	lowerName := strings.ToLower(name)
+	for _, pattern := range m.patterns {
+		if matched, _ := filepath.Match(pattern, lowerName); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, lowerPath); matched {
+			return true
+		}
+	}
+	return false
+}
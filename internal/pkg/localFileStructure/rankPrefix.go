@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// a number at the start of a directory name separated by a space, dot, underscore or dash, e.g. "01 January"
+var rankPrefixPattern = regexp.MustCompile(`^(\d+)[ ._-]+(.+)$`)
+
+// Splits a directory name like "01 January" into its rank 1 and the name "January".
+// Returns false if the name has no numeric prefix.
+func ParseRankPrefix(name string) (int, string, bool) {
+	matches := rankPrefixPattern.FindStringSubmatch(name)
+	if matches == nil {
+		return 0, name, false
+	}
+
+	rank, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, name, false
+	}
+	return rank, matches[2], true
+}
+
+// Removes the numeric rank prefix of all directories in the keys and names of the nodes, so the categories
+// are named without it. The paths are kept and still point to the real files.
+func StripRankPrefixes(nodes map[string]*FilesystemNode) {
+	for _, node := range nodes {
+		if node.IsDir {
+			node.Key = stripRankPrefixOfDirectories(node.Key)
+			node.Name = filepath.Base(node.Key)
+			continue
+		}
+		node.Key = filepath.Join(stripRankPrefixOfDirectories(filepath.Dir(node.Key)), filepath.Base(node.Key))
+	}
+}
+
+func stripRankPrefixOfDirectories(key string) string {
+	parts := strings.Split(key, string(filepath.Separator))
+	for i, part := range parts {
+		_, parts[i], _ = ParseRankPrefix(part)
+	}
+	return strings.Join(parts, string(filepath.Separator))
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2019 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"testing"
+)
+
+func Test_ParseRankPrefix(t *testing.T) {
+	tests := []struct {
+		name         string
+		expectedRank int
+		expectedName string
+		expectedOk   bool
+	}{
+		{name: "01 January", expectedRank: 1, expectedName: "January", expectedOk: true},
+		{name: "12_December", expectedRank: 12, expectedName: "December", expectedOk: true},
+		{name: "3 - March", expectedRank: 3, expectedName: "March", expectedOk: true},
+		{name: "January", expectedRank: 0, expectedName: "January", expectedOk: false},
+		{name: "2019", expectedRank: 0, expectedName: "2019", expectedOk: false},
+		{name: "4x4", expectedRank: 0, expectedName: "4x4", expectedOk: false},
+	}
+
+	for _, test := range tests {
+		rank, name, ok := ParseRankPrefix(test.name)
+		if rank != test.expectedRank || name != test.expectedName || ok != test.expectedOk {
+			t.Errorf("%s: expected %d, %s, %t but got %d, %s, %t", test.name, test.expectedRank, test.expectedName, test.expectedOk, rank, name, ok)
+		}
+	}
+}
+
+func Test_StripRankPrefixes_keeps_the_paths(t *testing.T) {
+	nodes := map[string]*FilesystemNode{
+		"/photos/2019/01 January":          {Key: "2019/01 January", Path: "/photos/2019/01 January", Name: "01 January", IsDir: true},
+		"/photos/2019/01 January/01 a.jpg": {Key: "2019/01 January/01 a.jpg", Path: "/photos/2019/01 January/01 a.jpg", Name: "01 a.jpg"},
+	}
+
+	StripRankPrefixes(nodes)
+
+	dir := nodes["/photos/2019/01 January"]
+	if dir.Key != "2019/January" || dir.Name != "January" || dir.Path != "/photos/2019/01 January" {
+		t.Errorf("unexpected directory node %s, %s, %s", dir.Key, dir.Name, dir.Path)
+	}
+
+	file := nodes["/photos/2019/01 January/01 a.jpg"]
+	if file.Key != "2019/January/01 a.jpg" || file.Name != "01 a.jpg" {
+		t.Errorf("unexpected file node %s, %s", file.Key, file.Name)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The extensions of the raw files of cameras that are paired with the JPEG of the same shot.
+var RawExtensions = []string{"3fr", "arw", "cr2", "cr3", "crw", "dng", "erf", "kdc", "mrw", "nef", "nrw", "orf", "pef", "raf", "raw", "rw2", "rwl", "sr2", "srf", "srw", "x3f"}
+
+// Reports if the file has the extension of a raw file, ignoring its case.
+func IsRawFile(path string) bool {
+	extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	for _, rawExtension := range RawExtensions {
+		if extension == rawExtension {
+			return true
+		}
+	}
+	return false
+}
+
+func isJpegFile(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return extension == ".jpg" || extension == ".jpeg"
+}
+
+// Returns the raw files that have a JPEG with the same name in the same directory by the path of the JPEG, e.g.
+// IMG_0001.CR2 is paired with IMG_0001.jpg. The extensions are compared ignoring their case, the names are not. If a
+// shot has more than one raw file or JPEG, the first of each by path is paired.
+func FindRawPairs(nodes map[string]*FilesystemNode) map[string]*FilesystemNode {
+	paths := make([]string, 0, len(nodes))
+	for path, node := range nodes {
+		if !node.IsDir {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	jpegs := make(map[string]string)
+	raws := make(map[string]*FilesystemNode)
+	for _, path := range paths {
+		shot := strings.TrimSuffix(path, filepath.Ext(path))
+		if _, found := jpegs[shot]; !found && isJpegFile(path) {
+			jpegs[shot] = path
+		}
+		if _, found := raws[shot]; !found && IsRawFile(path) {
+			raws[shot] = nodes[path]
+		}
+	}
+
+	pairs := make(map[string]*FilesystemNode)
+	for shot, jpeg := range jpegs {
+		if raw, found := raws[shot]; found {
+			logrus.Tracef("Pairing the raw file %s with %s", raw.Path, jpeg)
+			pairs[jpeg] = raw
+		}
+	}
+	logrus.Debugf("Found %d raw files with a JPEG", len(pairs))
+	return pairs
+}
+
+// Returns the nodes without the raw files of the pairs.
+func WithoutPairedRawFiles(nodes map[string]*FilesystemNode, pairs map[string]*FilesystemNode) map[string]*FilesystemNode {
+	paired := make(map[string]struct{}, len(pairs))
+	for _, raw := range pairs {
+		paired[raw.Path] = struct{}{}
+	}
+
+	remaining := make(map[string]*FilesystemNode, len(nodes))
+	for path, node := range nodes {
+		if _, found := paired[node.Path]; found {
+			continue
+		}
+		remaining[path] = node
+	}
+	return remaining
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func createRawPairNodes(paths ...string) map[string]*FilesystemNode {
+	nodes := make(map[string]*FilesystemNode)
+	for _, path := range paths {
+		path = filepath.FromSlash(path)
+		nodes[path] = &FilesystemNode{Path: path, Key: path, Name: filepath.Base(path)}
+	}
+	nodes[filepath.FromSlash("/images")] = &FilesystemNode{Path: filepath.FromSlash("/images"), IsDir: true}
+	return nodes
+}
+
+func Test_FindRawPairs_ignores_the_case_of_the_extensions(t *testing.T) {
+	nodes := createRawPairNodes(
+		"/images/IMG_0001.JPG", "/images/IMG_0001.cr2",
+		"/images/IMG_0002.jpeg", "/images/IMG_0002.NEF",
+		"/images/IMG_0003.Jpg", "/images/IMG_0003.Dng",
+		"/images/IMG_0004.jpg",
+		"/images/IMG_0005.CR2",
+		"/images/img_0006.jpg", "/images/IMG_0006.CR2",
+		"/images/other/IMG_0001.CR2")
+
+	pairs := FindRawPairs(nodes)
+
+	want := map[string]string{
+		"/images/IMG_0001.JPG":  "/images/IMG_0001.cr2",
+		"/images/IMG_0002.jpeg": "/images/IMG_0002.NEF",
+		"/images/IMG_0003.Jpg":  "/images/IMG_0003.Dng",
+	}
+	if len(pairs) != len(want) {
+		t.Fatalf("expected %d pairs but got %v", len(want), pairs)
+	}
+	for jpeg, raw := range want {
+		pair, found := pairs[filepath.FromSlash(jpeg)]
+		if !found || pair.Path != filepath.FromSlash(raw) {
+			t.Errorf("expected %s to be paired with %s but got %v", jpeg, raw, pair)
+		}
+	}
+
+	remaining := WithoutPairedRawFiles(nodes, pairs)
+	if len(remaining) != len(nodes)-len(want) {
+		t.Errorf("expected the paired raw files to be removed but got %d nodes", len(remaining))
+	}
+	if _, found := remaining[filepath.FromSlash("/images/IMG_0005.CR2")]; !found {
+		t.Error("expected the raw file without JPEG to be kept")
+	}
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Checks if the root path is an existing directory. The error contains the resolved absolute path
+// as a relative path depends on the working directory the application got started in.
+func CheckRootPath(path string) error {
+	if path == "" {
+		return errors.New("missing imagesRootPath. Please provide the directory to synchronize")
+	}
+
+	fullPath, err := filepath.Abs(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not resolve imagesRootPath %s: %s", path, err))
+	}
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		return errors.New(fmt.Sprintf("imagesRootPath %s (%s) does not exist", path, fullPath))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not access imagesRootPath %s (%s): %s", path, fullPath, err))
+	}
+	if !info.IsDir() {
+		return errors.New(fmt.Sprintf("imagesRootPath %s (%s) is not a directory", path, fullPath))
+	}
+	return nil
+}
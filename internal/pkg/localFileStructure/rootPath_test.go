@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_CheckRootPath_accepts_directory(t *testing.T) {
+	err := CheckRootPath("../../../test/images")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_CheckRootPath_rejects_empty_path(t *testing.T) {
+	err := CheckRootPath("")
+	if err == nil {
+		t.Error("Expected an error as the path is empty")
+	}
+}
+
+func Test_CheckRootPath_rejects_missing_path_with_absolute_path_in_error(t *testing.T) {
+	fullPath, _ := filepath.Abs("../../../test/missing")
+
+	err := CheckRootPath("../../../test/missing")
+	if err == nil || !strings.Contains(err.Error(), fullPath) {
+		t.Errorf("Expected an error containing %s but got %v", fullPath, err)
+	}
+}
+
+func Test_CheckRootPath_rejects_file(t *testing.T) {
+	err := CheckRootPath("../../../test/images/testimage.jpg")
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Expected an error as the path is a file but got %v", err)
+	}
+}
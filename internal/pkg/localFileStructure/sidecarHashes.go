@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"bufio"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// the format of md5sum: the hash followed by the file name, which is marked with * in binary mode
+	gnuSidecarLine = regexp.MustCompile(`^([0-9a-fA-F]{32})(?:\s+\*?(.+))?$`)
+	// the format of md5 on BSD and macOS
+	bsdSidecarLine = regexp.MustCompile(`^MD5 \((.+)\) = ([0-9a-fA-F]{32})$`)
+)
+
+// Creates a calculator that takes the md5sum of a file from its sidecar file, which is named like the file or its
+// name without extension plus .md5. The sidecar has to be at least as new as the file, so a file that changed after
+// its hash got written is read again. With trust the age of the sidecar is not checked.
+//
+// The sidecar holds the lines of md5sum or the BSD md5. A line without file name is only used from the sidecar named
+// like the file, as the sidecar without extension may belong to a JPEG and its raw file. Files without a valid
+// sidecar and the entries of archives are read by the given calculator. The checksum to detect local changes is the
+// md5sum, so the calculator must use the algorithm md5.
+func NewSidecarChecksumCalculator(calculator ChecksumCalculator, trust bool) ChecksumCalculator {
+	return func(filePath string) (string, string, error) {
+		if md5sum, found := readSidecarHash(filePath, trust); found {
+			logrus.Tracef("Using the md5 sum of %s from its sidecar - %s", filePath, md5sum)
+			return md5sum, ChecksumMd5 + ":" + md5sum, nil
+		}
+		return calculator(filePath)
+	}
+}
+
+func readSidecarHash(filePath string, trust bool) (string, bool) {
+	if _, _, isArchive := splitArchivePath(filePath); isArchive {
+		return "", false
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return "", false
+	}
+
+	for i, sidecarPath := range sidecarPaths(filePath) {
+		sidecarInfo, err := os.Stat(sidecarPath)
+		if err != nil || sidecarInfo.IsDir() {
+			continue
+		}
+		if !trust && sidecarInfo.ModTime().Before(fileInfo.ModTime()) {
+			logrus.Debugf("%s: Ignoring the sidecar %s as the file changed after it was written", filePath, sidecarPath)
+			continue
+		}
+		if md5sum, found := parseSidecar(sidecarPath, filepath.Base(filePath), i == 0); found {
+			return md5sum, true
+		}
+	}
+	return "", false
+}
+
+func sidecarPaths(filePath string) []string {
+	paths := []string{filePath + ".md5"}
+	if extension := filepath.Ext(filePath); extension != "" {
+		paths = append(paths, strings.TrimSuffix(filePath, extension)+".md5")
+	}
+	return paths
+}
+
+// Returns the md5sum of the file with the given name from the sidecar. Malformed lines are skipped with a warning.
+func parseSidecar(sidecarPath string, fileName string, allowUnnamed bool) (string, bool) {
+	sidecar, err := os.Open(sidecarPath)
+	if err != nil {
+		logrus.Warnf("Could not read the sidecar %s - %s", sidecarPath, err)
+		return "", false
+	}
+	defer sidecar.Close()
+
+	scanner := bufio.NewScanner(sidecar)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var md5sum, name string
+		if match := gnuSidecarLine.FindStringSubmatch(line); match != nil {
+			md5sum, name = match[1], match[2]
+		} else if match := bsdSidecarLine.FindStringSubmatch(line); match != nil {
+			md5sum, name = match[2], match[1]
+		} else {
+			logrus.Warnf("Ignoring the malformed line %d of the sidecar %s", lineNumber, sidecarPath)
+			continue
+		}
+
+		if (name == "" && allowUnnamed) || filepath.Base(filepath.FromSlash(name)) == fileName {
+			return strings.ToLower(md5sum), true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.Warnf("Could not read the sidecar %s - %s", sidecarPath, err)
+	}
+	return "", false
+}
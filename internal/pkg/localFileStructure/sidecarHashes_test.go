@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const sidecarHash = "0123456789abcdef0123456789abcdef"
+
+func Test_NewSidecarChecksumCalculator(t *testing.T) {
+	root, err := ioutil.TempDir("", "sidecarHashes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	modTime := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeFile := func(name string, content string, modTime time.Time) string {
+		path := filepath.Join(root, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		sidecar string
+		content string
+		age     time.Duration
+		trust   bool
+		want    string
+	}{
+		{"hash only", "a.jpg.md5", sidecarHash, 0, false, sidecarHash},
+		{"md5sum line", "b.jpg.md5", "# written by another tool\n" + sidecarHash + "  b.jpg\n", 0, false, sidecarHash},
+		{"binary mode and upper case", "c.jpg.md5", "0123456789ABCDEF0123456789ABCDEF *c.jpg", 0, false, sidecarHash},
+		{"bsd line", "d.jpg.md5", "MD5 (d.jpg) = " + sidecarHash, 0, false, sidecarHash},
+		{"shared with the raw file", "e.md5", "ffffffffffffffffffffffffffffffff  e.CR2\n" + sidecarHash + "  e.jpg\n", 0, false, sidecarHash},
+		{"unnamed hash in the shared sidecar", "f.md5", sidecarHash, 0, false, "calculated"},
+		{"malformed", "g.jpg.md5", "not a hash  g.jpg", 0, false, "calculated"},
+		{"other file", "h.jpg.md5", sidecarHash + "  other.jpg", 0, false, "calculated"},
+		{"older than the file", "i.jpg.md5", sidecarHash, -time.Hour, false, "calculated"},
+		{"trusted although older", "j.jpg.md5", sidecarHash, -time.Hour, true, sidecarHash},
+		{"missing", "", "", 0, false, "calculated"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imagePath := writeFile(string(rune('a'+i))+".jpg", "jpeg", modTime)
+			if tt.sidecar != "" {
+				writeFile(tt.sidecar, tt.content, modTime.Add(tt.age))
+			}
+
+			calculated := func(filePath string) (string, string, error) {
+				return "calculated", ChecksumMd5 + ":calculated", nil
+			}
+			md5sum, checksum, err := NewSidecarChecksumCalculator(calculated, tt.trust)(imagePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if md5sum != tt.want || checksum != ChecksumMd5+":"+tt.want {
+				t.Errorf("got md5sum %s and checksum %s, want %s", md5sum, checksum, tt.want)
+			}
+		})
+	}
+}
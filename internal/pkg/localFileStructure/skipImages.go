@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+// Returns the nodes without the files below the directories that match one of the patterns, so their categories are
+// still created but their images are not uploaded. The patterns use the same semantics as the include patterns and
+// are matched against the name and the key of every directory above a file. Returns an error for an invalid pattern.
+func SkipImagesIn(nodes map[string]*FilesystemNode, patterns []string) (map[string]*FilesystemNode, error) {
+	matcher, err := newPathMatcher(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if matcher.isEmpty() {
+		return nodes, nil
+	}
+
+	remaining := make(map[string]*FilesystemNode, len(nodes))
+	skipped := 0
+	for path, node := range nodes {
+		if !node.IsDir && isBelowMatchingDirectory(matcher, node.Key) {
+			logrus.Tracef("%s: Skipping the image as its directory matches skipImagesIn", node.Path)
+			skipped++
+			continue
+		}
+		remaining[path] = node
+	}
+
+	if skipped > 0 {
+		logrus.Infof("Skipping %d images in directories matching skipImagesIn, their categories are still created", skipped)
+	}
+	return remaining, nil
+}
+
+func isBelowMatchingDirectory(matcher *pathMatcher, key string) bool {
+	directory := filepath.Dir(key)
+	for directory != "." && directory != string(filepath.Separator) {
+		if matcher.matches(directory, filepath.Base(directory)) {
+			return true
+		}
+		directory = filepath.Dir(directory)
+	}
+	return false
+}
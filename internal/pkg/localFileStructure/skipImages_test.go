@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package localFileStructure
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_SkipImagesIn_keeps_the_directories(t *testing.T) {
+	nodes := make(map[string]*FilesystemNode)
+	for _, key := range []string{"2019", "2019/raw", "2019/raw/old", "2019/exports", "2020"} {
+		key = filepath.FromSlash(key)
+		nodes[key] = &FilesystemNode{Key: key, Name: filepath.Base(key), IsDir: true}
+	}
+	for _, key := range []string{"2019/a.jpg", "2019/raw/b.jpg", "2019/raw/old/c.jpg", "2019/exports/d.jpg", "2020/e.jpg", "2020/Raw.jpg"} {
+		key = filepath.FromSlash(key)
+		nodes[key] = &FilesystemNode{Key: key, Name: filepath.Base(key)}
+	}
+
+	remaining, err := SkipImagesIn(nodes, []string{"RAW", "20*/exports"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"2019", "2019/raw", "2019/raw/old", "2019/exports", "2020", "2019/a.jpg", "2020/e.jpg", "2020/Raw.jpg"}
+	if len(remaining) != len(expected) {
+		t.Errorf("expected %d nodes but got %d", len(expected), len(remaining))
+	}
+	for _, key := range expected {
+		if _, found := remaining[filepath.FromSlash(key)]; !found {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+}
+
+func Test_SkipImagesIn_without_patterns_keeps_all_nodes(t *testing.T) {
+	nodes := map[string]*FilesystemNode{"raw/a.jpg": {Key: "raw/a.jpg", Name: "a.jpg"}}
+	if remaining, _ := SkipImagesIn(nodes, nil); len(remaining) != 1 {
+		t.Error("expected all nodes to be kept")
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// The layouts accepted as date of an entry. Dates without a time zone are in the local time zone like the dates
+// shown by piwigo.
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// A file that gets uploaded exactly as specified. The category is either the id of an existing category or the key of
+// the category, e.g. "2019/holidays", that may be created by the upload.
+type Entry struct {
+	LocalPath  string   `json:"localPath"`
+	CategoryId int      `json:"categoryId"`
+	Category   string   `json:"category"`
+	Name       string   `json:"name"`
+	Tags       []string `json:"tags"`
+	Date       string   `json:"date"`
+	// the image on the server that gets replaced by the file, zero uploads a new image
+	PiwigoId int `json:"piwigoId,omitempty"`
+}
+
+// Reads the entries of the manifest, a JSON array of entries. Relative paths are resolved against the directory of
+// the manifest.
+func Read(manifestPath string) ([]Entry, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0)
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not read the manifest %s - %s", manifestPath, err))
+	}
+
+	directory := filepath.Dir(manifestPath)
+	for i := range entries {
+		if entries[i].LocalPath != "" && !filepath.IsAbs(entries[i].LocalPath) {
+			entries[i].LocalPath = filepath.Join(directory, entries[i].LocalPath)
+		}
+	}
+	return entries, nil
+}
+
+// Checks the fields of the entry that do not need the server.
+func (entry Entry) validate() error {
+	if entry.LocalPath == "" {
+		return errors.New("the entry has no localPath")
+	}
+	if entry.CategoryId <= 0 && entry.Category == "" {
+		return errors.New("the entry has neither a categoryId nor a category")
+	}
+	if entry.CategoryId > 0 && entry.Category != "" {
+		return errors.New("the entry has a categoryId and a category, use only one of them")
+	}
+	_, err := entry.date()
+	return err
+}
+
+// The date of the entry or the zero time if it has none.
+func (entry Entry) date() (time.Time, error) {
+	if entry.Date == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout, entry.Date, time.Local)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("the date %s is not in the format 2006-01-02 15:04:05, 2006-01-02 or RFC3339", entry.Date))
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package manifest
+
+//go:generate mockgen -destination=./piwigo_mock_test.go -package=manifest git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo CategoryApi,ImageApi
+
+import (
+	"bytes"
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Read_resolves_the_paths_relative_to_the_manifest(t *testing.T) {
+	dir := createManifestTestDir(t)
+	manifestPath := filepath.Join(dir, "manifest.json")
+	writeManifestTestFile(t, manifestPath, `[{"localPath":"images/a.jpg","categoryId":3},{"localPath":"/absolute/b.jpg","category":"2019/holidays"}]`)
+
+	entries, err := Read(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].LocalPath != filepath.Join(dir, "images", "a.jpg") || entries[0].CategoryId != 3 {
+		t.Errorf("unexpected entry %v", entries[0])
+	}
+	if entries[1].LocalPath != "/absolute/b.jpg" || entries[1].Category != "2019/holidays" {
+		t.Errorf("unexpected entry %v", entries[1])
+	}
+}
+
+func Test_Read_rejects_invalid_json(t *testing.T) {
+	dir := createManifestTestDir(t)
+	manifestPath := filepath.Join(dir, "manifest.json")
+	writeManifestTestFile(t, manifestPath, `{"localPath":"a.jpg"}`)
+
+	_, err := Read(manifestPath)
+	if err == nil {
+		t.Error("expected an error for a manifest that is not an array")
+	}
+}
+
+func Test_Entry_validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		valid bool
+	}{
+		{"category id", Entry{LocalPath: "a.jpg", CategoryId: 3}, true},
+		{"category key and date", Entry{LocalPath: "a.jpg", Category: "2019", Date: "2019-07-01 12:30:00"}, true},
+		{"date only", Entry{LocalPath: "a.jpg", CategoryId: 3, Date: "2019-07-01"}, true},
+		{"rfc3339", Entry{LocalPath: "a.jpg", CategoryId: 3, Date: "2019-07-01T12:30:00+02:00"}, true},
+		{"no path", Entry{CategoryId: 3}, false},
+		{"no category", Entry{LocalPath: "a.jpg"}, false},
+		{"both categories", Entry{LocalPath: "a.jpg", CategoryId: 3, Category: "2019"}, false},
+		{"invalid date", Entry{LocalPath: "a.jpg", CategoryId: 3, Date: "01.07.2019"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func Test_Upload_uploads_the_entries_as_specified(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dir := createManifestTestDir(t)
+	first := filepath.Join(dir, "first.jpg")
+	second := filepath.Join(dir, "second.jpg")
+	writeManifestTestFile(t, first, "first")
+	writeManifestTestFile(t, second, "second")
+	entries := []Entry{
+		{LocalPath: first, CategoryId: 3, Name: "Sunset", Tags: []string{"beach"}, Date: "2019-07-01 12:30:00"},
+		{LocalPath: second, Category: "2019/holidays/beach"},
+		{LocalPath: filepath.Join(dir, "missing.jpg"), CategoryId: 3},
+		{LocalPath: first, CategoryId: 99},
+	}
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{
+		"2019": {Id: 3, Name: "2019", Key: "2019"},
+	}, nil)
+	categoryApi.EXPECT().CreateCategoryWithSettings(3, "holidays", piwigo.CategorySettings{}).Times(1).Return(4, nil)
+	categoryApi.EXPECT().CreateCategoryWithSettings(4, "beach", piwigo.CategorySettings{}).Times(1).Return(5, nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().GetOrCreateTags([]string{"beach"}).Times(1).Return(map[string]int{"beach": 7}, nil)
+	imageApi.EXPECT().UploadImage(0, first, "md5-"+first, 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 10}, nil)
+	imageApi.EXPECT().UploadImage(0, second, "md5-"+second, 5, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 11, MatchedExisting: true}, nil)
+	imageApi.EXPECT().UpdateImagesInfo(gomock.Any(), 1).Times(1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		fields := updates[0].Fields
+		if updates[0].PiwigoId != 10 || fields.Get("name") != "Sunset" || fields.Get("tag_ids") != "7" || fields.Get("date_creation") != "2019-07-01 12:30:00" {
+			t.Errorf("unexpected update %v", updates[0])
+		}
+		return piwigo.ImageInfoUpdateResult{}, nil
+	})
+
+	results, err := Upload(categoryApi, imageApi, entries, Options{CreateCategories: true, ChecksumCalculator: manifestTestChecksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Result{
+		{LocalPath: first, CategoryId: 3, PiwigoId: 10, Result: ResultUploaded},
+		{LocalPath: second, CategoryId: 5, PiwigoId: 11, Result: ResultMatched},
+		{LocalPath: entries[2].LocalPath, CategoryId: 3, Result: ResultFailed},
+		{LocalPath: first, CategoryId: 0, Result: ResultFailed, Reason: "the category 99 does not exist on the server"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i := range want {
+		got := results[i]
+		if got.LocalPath != want[i].LocalPath || got.CategoryId != want[i].CategoryId || got.PiwigoId != want[i].PiwigoId || got.Result != want[i].Result {
+			t.Errorf("result %d is %v, want %v", i, got, want[i])
+		}
+		if want[i].Reason != "" && got.Reason != want[i].Reason {
+			t.Errorf("result %d failed with %s, want %s", i, got.Reason, want[i].Reason)
+		}
+	}
+	if Failed(results) != 2 {
+		t.Errorf("expected 2 failed entries but got %d", Failed(results))
+	}
+}
+
+func Test_Upload_does_not_create_categories_by_default(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dir := createManifestTestDir(t)
+	file := filepath.Join(dir, "first.jpg")
+	writeManifestTestFile(t, file, "first")
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{}, nil)
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().GetOrCreateTags(gomock.Any()).Times(1).Return(map[string]int{}, nil)
+
+	results, err := Upload(categoryApi, imageApi, []Entry{{LocalPath: file, Category: "2019"}}, Options{ChecksumCalculator: manifestTestChecksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Result != ResultFailed || results[0].Reason != "the category 2019 does not exist on the server" {
+		t.Errorf("unexpected result %v", results[0])
+	}
+}
+
+func Test_Upload_sends_the_deferred_info_of_all_entries_together(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	dir := createManifestTestDir(t)
+	first := filepath.Join(dir, "first.jpg")
+	second := filepath.Join(dir, "second.jpg")
+	writeManifestTestFile(t, first, "first")
+	writeManifestTestFile(t, second, "second")
+	entries := []Entry{
+		{LocalPath: first, CategoryId: 3, Name: "Sunset"},
+		{LocalPath: second, CategoryId: 3},
+		{LocalPath: second, CategoryId: 3, Name: "Sunrise"},
+	}
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{
+		"2019": {Id: 3, Name: "2019", Key: "2019"},
+	}, nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().GetOrCreateTags([]string{}).Times(1).Return(map[string]int{}, nil)
+	imageApi.EXPECT().UploadImage(0, first, "md5-"+first, 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 10}, nil)
+	imageApi.EXPECT().UploadImage(0, second, "md5-"+second, 3, gomock.Any()).Times(2).Return(piwigo.UploadResult{ImageId: 11}, nil)
+	imageApi.EXPECT().UpdateImagesInfo(gomock.Any(), 4).Times(1).DoAndReturn(func(updates []piwigo.ImageInfoUpdate, parallelRequests int) (piwigo.ImageInfoUpdateResult, error) {
+		if len(updates) != 2 || updates[0].Fields.Get("name") != "Sunset" || updates[1].Fields.Get("name") != "Sunrise" {
+			t.Errorf("expected the names of both entries in the order of the manifest but got %v", updates)
+		}
+		return piwigo.ImageInfoUpdateResult{}, errors.New("connection refused")
+	})
+
+	results, err := Upload(categoryApi, imageApi, entries, Options{ChecksumCalculator: manifestTestChecksum, DeferMetadata: true, ParallelRequests: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Result != ResultFailed || results[1].Result != ResultUploaded || results[2].Result != ResultFailed {
+		t.Errorf("expected the entries with info to fail but got %v", results)
+	}
+}
+
+func Test_WriteResults_writes_a_table(t *testing.T) {
+	results := []Result{
+		{LocalPath: "/images/a.jpg", CategoryId: 3, PiwigoId: 10, Result: ResultUploaded},
+		{LocalPath: "/images/b.jpg", CategoryId: 3, Result: ResultFailed, Reason: "timeout"},
+	}
+
+	buffer := bytes.Buffer{}
+	err := WriteResults(&buffer, results, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+	if !strings.Contains(output, "uploaded  10     3         /images/a.jpg") || !strings.HasSuffix(output, "2 entries, 1 failed\n") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func manifestTestChecksum(filePath string) (string, string, error) {
+	return "md5-" + filePath, "", nil
+}
+
+func createManifestTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func writeManifestTestFile(t *testing.T, path string, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// The results of the entries.
+const (
+	// the file got uploaded
+	ResultUploaded = "uploaded"
+	// the content already existed on the server and only got assigned to the category
+	ResultMatched = "matched"
+	ResultFailed  = "failed"
+)
+
+type Options struct {
+	// Creates the categories given by key that do not exist on the server. Otherwise their entries fail.
+	CreateCategories bool
+	// Calculates the md5sum of the files.
+	ChecksumCalculator localFileStructure.ChecksumCalculator
+	// The status and comment settings of the created categories.
+	CategorySettings piwigo.CategorySettings
+	// Sets the names, dates and tags after all entries got uploaded with as few requests as possible instead of right
+	// after the upload of every entry.
+	DeferMetadata bool
+	// The number of parallel requests of the deferred metadata.
+	ParallelRequests int
+}
+
+// What happened with an entry of the manifest.
+type Result struct {
+	LocalPath  string `json:"localPath"`
+	CategoryId int    `json:"categoryId"`
+	PiwigoId   int    `json:"piwigoId"`
+	Result     string `json:"result"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Uploads the entries exactly as specified without looking at the directories or the local metadata. An image with
+// content that already exists on the server is only assigned to the category, so a manifest can be uploaded again.
+// The name, the date and the tags of the entries are set after the upload. A failing entry does not stop the others,
+// the returned results are in the order of the manifest.
+func Upload(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, entries []Entry, options Options) ([]Result, error) {
+	logrus.Debug("Entering manifest.Upload")
+	defer logrus.Debug("Leaving manifest.Upload")
+
+	categories, err := categoryApi.GetAllCategories()
+	if err != nil {
+		return nil, err
+	}
+	resolver := &categoryResolver{
+		categoryApi: categoryApi,
+		index:       piwigo.NewCategoryIndex(categories),
+		created:     make(map[string]int),
+		create:      options.CreateCategories,
+		settings:    options.CategorySettings,
+	}
+
+	tagIds, err := imageApi.GetOrCreateTags(entryTags(entries))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(entries))
+	deferred := make(map[int]piwigo.ImageInfoUpdate)
+	for _, entry := range entries {
+		result, update := uploadEntry(imageApi, resolver, tagIds, entry, options)
+		if update != nil {
+			deferred[len(results)] = *update
+		}
+		if result.Result == ResultFailed {
+			logrus.Warnf("%s: %s", entry.LocalPath, result.Reason)
+		}
+		results = append(results, result)
+	}
+	updateDeferredEntries(imageApi, results, deferred, options.ParallelRequests)
+	return results, nil
+}
+
+// Sends the info of all uploaded entries together. As the server does not report which of the updates failed, all
+// entries with an update are failed if the updates could not be sent.
+func updateDeferredEntries(imageApi piwigo.ImageApi, results []Result, deferred map[int]piwigo.ImageInfoUpdate, parallelRequests int) {
+	if len(deferred) == 0 {
+		return
+	}
+
+	updates := make([]piwigo.ImageInfoUpdate, 0, len(deferred))
+	for i := range results {
+		if update, found := deferred[i]; found {
+			updates = append(updates, update)
+		}
+	}
+	if parallelRequests <= 0 {
+		parallelRequests = 1
+	}
+	logrus.Infof("Setting the deferred info of %d entries", len(updates))
+	_, err := imageApi.UpdateImagesInfo(updates, parallelRequests)
+	if err == nil {
+		return
+	}
+
+	for i := range deferred {
+		results[i].Reason = fmt.Sprintf("uploaded as image %d but the info could not be set - %s", results[i].PiwigoId, err)
+		results[i].Result = ResultFailed
+		logrus.Warnf("%s: %s", results[i].LocalPath, results[i].Reason)
+	}
+}
+
+// Uploads the entry and returns the update of its info if it is deferred.
+func uploadEntry(imageApi piwigo.ImageApi, resolver *categoryResolver, tagIds map[string]int, entry Entry, options Options) (Result, *piwigo.ImageInfoUpdate) {
+	result := Result{LocalPath: entry.LocalPath, CategoryId: entry.CategoryId, Result: ResultFailed}
+
+	err := entry.validate()
+	if err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+	_, err = localFileStructure.Stat(entry.LocalPath)
+	if err != nil {
+		result.Reason = fmt.Sprintf("the file can not be read - %s", err)
+		return result, nil
+	}
+	result.CategoryId, err = resolver.resolve(entry)
+	if err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+
+	md5sum, _, err := options.ChecksumCalculator(entry.LocalPath)
+	if err != nil {
+		result.Reason = fmt.Sprintf("could not calculate the md5sum - %s", err)
+		return result, nil
+	}
+
+	correlationId := piwigo.NewCorrelationId()
+	uploaded, err := imageApi.UploadImage(entry.PiwigoId, entry.LocalPath, md5sum, result.CategoryId, correlationId)
+	if err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+	result.PiwigoId = uploaded.ImageId
+
+	date, _ := entry.date()
+	ids := make([]int, 0, len(entry.Tags))
+	for _, tag := range entry.Tags {
+		ids = append(ids, tagIds[tag])
+	}
+	update := piwigo.NewImageDetailsUpdate(uploaded.ImageId, entry.Name, date, ids)
+	update.CorrelationId = correlationId
+	var deferred *piwigo.ImageInfoUpdate
+	if len(update.Fields) > 0 && options.DeferMetadata {
+		deferred = &update
+	} else if len(update.Fields) > 0 {
+		_, err = imageApi.UpdateImagesInfo([]piwigo.ImageInfoUpdate{update}, 1)
+		if err != nil {
+			result.Reason = fmt.Sprintf("uploaded as image %d but the info could not be set - %s", uploaded.ImageId, err)
+			return result, nil
+		}
+	}
+
+	result.Result = ResultUploaded
+	if uploaded.MatchedExisting {
+		result.Result = ResultMatched
+	}
+	piwigo.CorrelationLog(correlationId).Infof("%s: %s as image %d in category %d", entry.LocalPath, result.Result, result.PiwigoId, result.CategoryId)
+	return result, deferred
+}
+
+// The tags of all valid entries, every tag once.
+func entryTags(entries []Entry) []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, entry := range entries {
+		if entry.validate() != nil {
+			continue
+		}
+		for _, tag := range entry.Tags {
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// Looks up the categories of the entries and creates the missing ones given by key if enabled.
+type categoryResolver struct {
+	categoryApi piwigo.CategoryApi
+	index       *piwigo.CategoryIndex
+	created     map[string]int
+	create      bool
+	settings    piwigo.CategorySettings
+}
+
+func (resolver *categoryResolver) resolve(entry Entry) (int, error) {
+	if entry.CategoryId > 0 {
+		if _, found := resolver.index.ById(entry.CategoryId); !found {
+			return 0, errors.New(fmt.Sprintf("the category %d does not exist on the server", entry.CategoryId))
+		}
+		return entry.CategoryId, nil
+	}
+
+	key := filepath.Clean(filepath.FromSlash(entry.Category))
+	parentId := 0
+	path := ""
+	for _, name := range strings.Split(key, string(os.PathSeparator)) {
+		path = filepath.Join(path, name)
+		if category, found := resolver.index.ByKey(path); found {
+			parentId = category.Id
+			continue
+		}
+		if id, found := resolver.created[path]; found {
+			parentId = id
+			continue
+		}
+		if !resolver.create {
+			return 0, errors.New(fmt.Sprintf("the category %s does not exist on the server", path))
+		}
+
+		id, err := resolver.categoryApi.CreateCategoryWithSettings(parentId, name, resolver.settings)
+		if err != nil {
+			return 0, err
+		}
+		resolver.created[path] = id
+		parentId = id
+	}
+	return parentId, nil
+}
+
+// The number of entries that failed.
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Result == ResultFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Writes the result of every entry as table or as JSON.
+func WriteResults(writer io.Writer, results []Result, asJson bool) error {
+	if asJson {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(table, "Result\tImage\tCategory\tFile\tReason"); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if _, err := fmt.Fprintf(table, "%s\t%d\t%d\t%s\t%s\n", result.Result, result.PiwigoId, result.CategoryId, result.LocalPath, result.Reason); err != nil {
+			return err
+		}
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(writer, "%d entries, %d failed\n", len(results), Failed(results))
+	return err
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+)
+
+// the smallest chunk size tried by the tuning of the uploads
+const minTunedChunkSizeInKB = 64
+
+// the space of the other form values of a chunk request
+const chunkRequestOverhead = 256
+
+const probeRequestPrefix = "method=pwg.session.getStatus&probe="
+
+// Measures the size of the requests the server accepts after the login instead of relying on the chunk size of the
+// upload form alone. Piwigo does not report the limits of php like post_max_size or those of a proxy in front of it,
+// so requests with the size of a chunk are sent to pwg.session.getStatus and the chunk size is halved until the
+// server accepts them. The configured chunk size is kept if the server accepts none of them.
+func (context *ServerContext) UseAutoTunedUpload(enabled bool) {
+	context.autoTuneUpload = enabled
+}
+
+func (context *ServerContext) tuneUploadChunkSize() {
+	configured := context.chunkSizeInKB
+	for size := configured; ; size /= 2 {
+		requestSize := chunkRequestSize(size)
+		err := context.probeRequestSize(requestSize)
+		if err == nil {
+			if size == configured {
+				logrus.Infof("Tuned the uploads: the server accepts requests of %d KB, using the configured chunk size of %d KB", requestSize/1024, size)
+			} else {
+				logrus.Warnf("Tuned the uploads: using a chunk size of %d KB instead of the configured %d KB as the server only accepts requests of %d KB. Check post_max_size of php and the request size limit of a proxy on the server", size, configured, requestSize/1024)
+			}
+			context.chunkSizeInKB = size
+			return
+		}
+		if errors.Is(err, gocontext.Canceled) {
+			return
+		}
+		logrus.Infof("Tuning the uploads: the server rejected a request of %d KB for a chunk of %d KB - %s", requestSize/1024, size, err)
+
+		if size/2 < minTunedChunkSizeInKB {
+			break
+		}
+	}
+	logrus.Warnf("Could not tune the uploads as the server rejected all probe requests, using the configured chunk size of %d KB", configured)
+}
+
+// Returns the size of the request of a chunk, whose data is sent base64 encoded with escaped + and / characters.
+func chunkRequestSize(chunkSizeInKB int) int {
+	encoded := (1024*chunkSizeInKB + 2) / 3 * 4
+	// two of the 64 characters of base64 are escaped with three characters
+	return encoded + encoded/16 + chunkRequestOverhead
+}
+
+// Sends a request of the given size to the server. Returns an error if the server does not answer it like any
+// other request, e.g. as php dropped the form that exceeds post_max_size or a proxy rejected it.
+func (context *ServerContext) probeRequestSize(requestSize int) error {
+	padding := requestSize - len(probeRequestPrefix)
+	if padding < 0 {
+		padding = 0
+	}
+	newBody := func() io.Reader {
+		return io.MultiReader(strings.NewReader(probeRequestPrefix), io.LimitReader(paddingReader{}, int64(padding)))
+	}
+
+	var response getStatusResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	return context.executePiwigoStreamRequest(ctx, "pwg.session.getStatus", newBody, &response)
+}
+
+// Returns an endless stream of letters to fill the probe requests.
+type paddingReader struct{}
+
+func (paddingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The units of a bandwidth limit. They are powers of 1024 like the chunk size.
+var bandwidthUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// Parses a bandwidth limit like 2MB/s, 500KB/s or 1048576 into bytes per second. An empty limit or zero means
+// unlimited.
+func ParseBandwidthLimit(limit string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(limit))
+	value = strings.TrimSuffix(value, "/s")
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	for _, unit := range bandwidthUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.multiplier
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid bandwidth limit %s, use a size per second like 2MB/s or 500KB/s", limit))
+	}
+	bytesPerSecond := int64(number * multiplier)
+	if number > 0 && bytesPerSecond < 1 {
+		return 0, errors.New(fmt.Sprintf("the bandwidth limit %s is less than one byte per second", limit))
+	}
+	return bytesPerSecond, nil
+}
+
+// A token bucket that limits the bytes per second written by all uploads sharing it, e.g. the parallel upload
+// workers and the secondary installations that use the same uplink.
+//
+// Every write reserves its bytes right away and waits until the bucket has refilled enough to cover them. The mutex
+// is only held to take the reservation and never while waiting, so the writers get their bytes in the order they
+// asked for them and a very low limit only makes them wait longer.
+type BandwidthLimiter struct {
+	mutex          sync.Mutex
+	bytesPerSecond float64
+	// the largest write that passes without waiting, a tenth of a second keeps the transfer smooth
+	burst  int64
+	tokens float64
+	last   time.Time
+	// replaced in the tests to run without waiting
+	now        func() time.Time
+	sleepUntil func(ctx gocontext.Context, until time.Time) error
+}
+
+// Creates a limiter for the given bytes per second. It returns nil for an unlimited bandwidth.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := bytesPerSecond / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &BandwidthLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+		burst:          burst,
+		tokens:         float64(burst),
+		now:            time.Now,
+		sleepUntil:     sleepUntil,
+	}
+}
+
+// Waits until the given number of bytes may be written. It returns early with the error of the context if it is done.
+func (limiter *BandwidthLimiter) wait(ctx gocontext.Context, bytes int) error {
+	limiter.mutex.Lock()
+	now := limiter.now()
+	if !limiter.last.IsZero() {
+		limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.bytesPerSecond
+		if limiter.tokens > float64(limiter.burst) {
+			limiter.tokens = float64(limiter.burst)
+		}
+	}
+	limiter.last = now
+	limiter.tokens -= float64(bytes)
+	missing := -limiter.tokens
+	limiter.mutex.Unlock()
+
+	if missing <= 0 {
+		return nil
+	}
+	return limiter.sleepUntil(ctx, now.Add(time.Duration(missing/limiter.bytesPerSecond*float64(time.Second))))
+}
+
+func sleepUntil(ctx gocontext.Context, until time.Time) error {
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Writes to the underlying writer at the speed of the limiter. Large writes are split at the burst of the limiter.
+type limitedWriter struct {
+	ctx     gocontext.Context
+	writer  io.Writer
+	limiter *BandwidthLimiter
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := len(p)
+		if int64(end-written) > w.limiter.burst {
+			end = written + int(w.limiter.burst)
+		}
+
+		err := w.limiter.wait(w.ctx, end-written)
+		if err != nil {
+			return written, err
+		}
+		n, err := w.writer.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Limits the bytes per second of the chunk uploads. The same limiter can be shared by several server contexts.
+// A nil limiter does not limit the uploads.
+func (context *ServerContext) UseBandwidthLimiter(limiter *BandwidthLimiter) {
+	context.bandwidth = limiter
+}
+
+// Wraps the writer of an upload with the bandwidth limiter of the context if there is one.
+func (context *ServerContext) limitBandwidth(ctx gocontext.Context, writer io.Writer) io.Writer {
+	if context.bandwidth == nil {
+		return writer
+	}
+	return &limitedWriter{ctx: ctx, writer: writer, limiter: context.bandwidth}
+}
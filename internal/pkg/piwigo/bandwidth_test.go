@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"bytes"
+	gocontext "context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_ParseBandwidthLimit(t *testing.T) {
+	tests := []struct {
+		limit   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"1048576", 1048576, false},
+		{"2MB/s", 2 << 20, false},
+		{"500 KB/s", 500 << 10, false},
+		{"1.5m", 3 << 19, false},
+		{"1GiB/s", 1 << 30, false},
+		{"fast", 0, true},
+		{"-2MB/s", 0, true},
+		{"0.1B/s", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			got, err := ParseBandwidthLimit(tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidthLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBandwidthLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_BandwidthLimiter_is_shared_by_concurrent_writers(t *testing.T) {
+	limiter := NewBandwidthLimiter(400 << 10)
+	writers := 4
+	data := make([]byte, 50<<10)
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writer := &limitedWriter{ctx: gocontext.Background(), writer: ioutil.Discard, limiter: limiter}
+			_, err := writer.Write(data)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// all but the initial burst of 40KB have to wait for the limit of 400KB/s
+	expected := time.Duration(float64(writers*len(data)-int(limiter.burst)) / limiter.bytesPerSecond * float64(time.Second))
+	if elapsed < expected-50*time.Millisecond || elapsed > expected+400*time.Millisecond {
+		t.Errorf("writing took %s, expected about %s", elapsed, expected)
+	}
+}
+
+func Test_BandwidthLimiter_completes_with_a_very_low_limit(t *testing.T) {
+	limiter := NewBandwidthLimiter(1)
+	clock := newFakeClock()
+	limiter.now = clock.now
+	limiter.sleepUntil = clock.sleepUntil
+
+	writers := 3
+	results := make([]bytes.Buffer, writers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writer := &limitedWriter{ctx: gocontext.Background(), writer: &results[i], limiter: limiter}
+			_, err := writer.Write(make([]byte, 100))
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		if results[i].Len() != 100 {
+			t.Errorf("writer %d wrote %d bytes, expected 100", i, results[i].Len())
+		}
+	}
+	// the first byte passes with the burst, every other byte takes a second
+	if clock.elapsed() != 299*time.Second {
+		t.Errorf("writing took %s, expected 299s", clock.elapsed())
+	}
+}
+
+func Test_BandwidthLimiter_stops_waiting_if_the_request_is_cancelled(t *testing.T) {
+	limiter := NewBandwidthLimiter(1)
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	writer := &limitedWriter{ctx: ctx, writer: ioutil.Discard, limiter: limiter}
+	written, err := writer.Write(make([]byte, 10))
+	if err != gocontext.Canceled {
+		t.Errorf("expected the write to be cancelled but got %v", err)
+	}
+	if written != 1 {
+		t.Errorf("expected only the burst to be written but got %d bytes", written)
+	}
+}
+
+// A clock that jumps to the end of every wait, so the tests do not have to wait for a low limit.
+type fakeClock struct {
+	mutex   sync.Mutex
+	start   time.Time
+	current time.Time
+}
+
+func newFakeClock() *fakeClock {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &fakeClock{start: start, current: start}
+}
+
+func (clock *fakeClock) now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.current
+}
+
+func (clock *fakeClock) sleepUntil(_ gocontext.Context, until time.Time) error {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	if until.After(clock.current) {
+		clock.current = until
+	}
+	return nil
+}
+
+func (clock *fakeClock) elapsed() time.Duration {
+	return clock.now().Sub(clock.start)
+}
@@ -6,9 +6,11 @@
 package piwigo
 
 import (
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strconv"
 )
 
 type Category struct {
@@ -16,6 +18,39 @@ type Category struct {
 	ParentId int
 	Name     string
 	Key      string
+	// number of images directly assigned to the category
+	NbImages int
+	// number of images in the category including all sub categories
+	TotalNbImages int
+	// the image shown as cover of the category, zero if there is none
+	RepresentativeId int
+}
+
+// The statuses of a category. Private categories are only visible to the users and groups granted access.
+const (
+	CategoryStatusPublic  = "public"
+	CategoryStatusPrivate = "private"
+)
+
+// The settings a category gets when it is created. Empty settings use the defaults configured on the server, which are
+// public and commentable unless changed by the administrator.
+type CategorySettings struct {
+	// CategoryStatusPublic or CategoryStatusPrivate
+	Status string
+	// whether the users may comment the images of the category
+	Commentable *bool
+}
+
+func (settings CategorySettings) validate() error {
+	return ValidateCategoryStatus(settings.Status)
+}
+
+// Checks that the status is public, private or empty for the default of the server.
+func ValidateCategoryStatus(status string) error {
+	if status != "" && status != CategoryStatusPublic && status != CategoryStatusPrivate {
+		return errors.New(fmt.Sprintf("unknown category status %s. Use one of public or private", status))
+	}
+	return nil
 }
 
 func buildLookupMap(categories map[int]*Category) map[string]*Category {
@@ -30,7 +65,18 @@ func buildLookupMap(categories map[int]*Category) map[string]*Category {
 func buildCategoryMap(statusResponse *getCategoryListResponse) map[int]*Category {
 	categories := map[int]*Category{}
 	for _, category := range statusResponse.Result.Categories {
-		categories[category.ID] = &Category{Id: category.ID, ParentId: category.IDUppercat, Name: category.Name, Key: category.Name}
+		categories[category.ID] = &Category{
+			Id:            category.ID,
+			ParentId:      category.IDUppercat,
+			Name:          category.Name,
+			Key:           category.Name,
+			NbImages:      category.NbImages,
+			TotalNbImages: category.TotalNbImages,
+		}
+		// piwigo returns the id as string and null for categories without representative
+		if representativeId, err := strconv.Atoi(category.RepresentativePictureID); err == nil {
+			categories[category.ID].RepresentativeId = representativeId
+		}
 	}
 	return categories
 }
@@ -55,3 +101,34 @@ func buildCategoryKeys(categories map[int]*Category) {
 		category.Key = key
 	}
 }
+
+// Uses the keys of the local directories for the categories that got created with another name than their directory,
+// so they are found by the key of their directory. The keys of the categories are the key of their parent joined with
+// their name.
+func (context *ServerContext) UseLocalCategoryKeys(keys map[string]string) {
+	context.localKeys = keys
+}
+
+func (context *ServerContext) applyLocalCategoryKeys(categories map[int]*Category) {
+	if len(context.localKeys) == 0 {
+		return
+	}
+	keys := make(map[int]string, len(categories))
+	for id, category := range categories {
+		keys[id] = context.localCategoryKey(category, categories)
+	}
+	for id, key := range keys {
+		categories[id].Key = key
+	}
+}
+
+func (context *ServerContext) localCategoryKey(category *Category, categories map[int]*Category) string {
+	key := category.Name
+	if parent, found := categories[category.ParentId]; found && category.ParentId != 0 {
+		key = fmt.Sprintf("%s%c%s", context.localCategoryKey(parent, categories), os.PathSeparator, category.Name)
+	}
+	if localKey, found := context.localKeys[key]; found {
+		return localKey
+	}
+	return key
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Looks up the categories loaded from the server by key, id or name without scanning all categories.
+type CategoryIndex struct {
+	byKey  map[string]*Category
+	byId   map[int]*Category
+	byName map[string][]*Category
+}
+
+// Builds the index once after the categories are loaded from the server.
+func NewCategoryIndex(categories map[string]*Category) *CategoryIndex {
+	index := &CategoryIndex{
+		byKey:  make(map[string]*Category, len(categories)),
+		byId:   make(map[int]*Category, len(categories)),
+		byName: make(map[string][]*Category),
+	}
+	for _, category := range categories {
+		index.byKey[normalizeCategoryKey(category.Key)] = category
+		index.byId[category.Id] = category
+		index.byName[category.Name] = append(index.byName[category.Name], category)
+	}
+
+	// categories with the same name are returned in a stable order
+	for _, sameName := range index.byName {
+		sort.Slice(sameName, func(i, j int) bool {
+			return sameName[i].Id < sameName[j].Id
+		})
+	}
+	return index
+}
+
+// Keys are compared as cleaned paths, so "2019/holidays/" finds the category "2019/holidays".
+func normalizeCategoryKey(key string) string {
+	return filepath.Clean(key)
+}
+
+func (index *CategoryIndex) ByKey(key string) (*Category, bool) {
+	category, found := index.byKey[normalizeCategoryKey(key)]
+	return category, found
+}
+
+func (index *CategoryIndex) ById(id int) (*Category, bool) {
+	category, found := index.byId[id]
+	return category, found
+}
+
+// Returns all categories with the given name ordered by id. Categories in different parents may share a name.
+func (index *CategoryIndex) ByName(name string) []*Category {
+	return index.byName[name]
+}
+
+func (index *CategoryIndex) Len() int {
+	return len(index.byId)
+}
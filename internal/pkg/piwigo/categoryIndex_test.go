@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"testing"
+)
+
+func createTestCategories() map[string]*Category {
+	return map[string]*Category{
+		"2019":          {Id: 1, Name: "2019", Key: "2019"},
+		"2019/holidays": {Id: 5, ParentId: 1, Name: "holidays", Key: "2019/holidays"},
+		"2020":          {Id: 2, Name: "2020", Key: "2020"},
+		"2020/holidays": {Id: 3, ParentId: 2, Name: "holidays", Key: "2020/holidays"},
+	}
+}
+
+func Test_CategoryIndex_ByKey(t *testing.T) {
+	index := NewCategoryIndex(createTestCategories())
+
+	for _, key := range []string{"2019/holidays", "2019/holidays/", "2019//holidays"} {
+		category, found := index.ByKey(key)
+		if !found || category.Id != 5 {
+			t.Errorf("%s: expected category 5 but got %v", key, category)
+		}
+	}
+
+	if _, found := index.ByKey("2021"); found {
+		t.Error("found a category that does not exist")
+	}
+}
+
+func Test_CategoryIndex_ById(t *testing.T) {
+	index := NewCategoryIndex(createTestCategories())
+
+	category, found := index.ById(3)
+	if !found || category.Key != "2020/holidays" {
+		t.Errorf("expected category 2020/holidays but got %v", category)
+	}
+	if _, found = index.ById(42); found {
+		t.Error("found a category that does not exist")
+	}
+	if index.Len() != 4 {
+		t.Errorf("expected 4 categories but got %d", index.Len())
+	}
+}
+
+func Test_CategoryIndex_ByName_returns_all_categories_ordered_by_id(t *testing.T) {
+	index := NewCategoryIndex(createTestCategories())
+
+	categories := index.ByName("holidays")
+	if len(categories) != 2 || categories[0].Id != 3 || categories[1].Id != 5 {
+		t.Errorf("unexpected categories %v", categories)
+	}
+	if len(index.ByName("unknown")) != 0 {
+		t.Error("found a category that does not exist")
+	}
+}
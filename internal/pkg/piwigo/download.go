@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// A part of the file of an image requested with DownloadImageRanges.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// the server sent the whole file instead of the requested range
+var ErrorRangesNotSupported = errors.New("the server does not support range requests")
+
+var contentRangePattern = regexp.MustCompile(`^bytes (?:\d+-\d+|\*)/(\d+)$`)
+
+// Writes the file of the image as the server stores it to the writer. This is the uploaded original unless the
+// server resized it after the upload. Returns the number of bytes written.
+func (context *ServerContext) DownloadImage(piwigoId int, writer io.Writer) (int64, error) {
+	elementUrl, err := context.elementUrl(piwigoId)
+	if err != nil {
+		return 0, err
+	}
+
+	logrus.Debugf("Downloading image %d from %s", piwigoId, elementUrl)
+
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	response, err := context.getElement(ctx, elementUrl, "")
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, errors.New(fmt.Sprintf("could not download image %d: got status %s", piwigoId, response.Status))
+	}
+	return io.Copy(writer, response.Body)
+}
+
+// Downloads only the given ranges of the file of the image as the server stores it, which is much cheaper than the
+// whole file for large images. Returns the content of every range and the size of the whole file. A range beyond the
+// end of the file is returned shorter or empty. Returns ErrorRangesNotSupported if the server answers with the whole
+// file instead.
+func (context *ServerContext) DownloadImageRanges(piwigoId int, ranges []ByteRange) ([][]byte, int64, error) {
+	elementUrl, err := context.elementUrl(piwigoId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logrus.Debugf("Downloading %d ranges of image %d from %s", len(ranges), piwigoId, elementUrl)
+
+	contents := make([][]byte, len(ranges))
+	size := int64(-1)
+	for i, byteRange := range ranges {
+		if byteRange.Length <= 0 {
+			contents[i] = []byte{}
+			continue
+		}
+		content, total, err := context.downloadRange(piwigoId, elementUrl, byteRange)
+		if err != nil {
+			return nil, 0, err
+		}
+		contents[i] = content
+		size = total
+	}
+	if size < 0 {
+		return nil, 0, errors.New(fmt.Sprintf("no range of image %d requested", piwigoId))
+	}
+	return contents, size, nil
+}
+
+func (context *ServerContext) downloadRange(piwigoId int, elementUrl string, byteRange ByteRange) ([]byte, int64, error) {
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	header := fmt.Sprintf("bytes=%d-%d", byteRange.Offset, byteRange.Offset+byteRange.Length-1)
+	response, err := context.getElement(ctx, elementUrl, header)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the range starts behind the end of the file
+		size, err := parseContentRange(piwigoId, response.Header.Get("Content-Range"))
+		return []byte{}, size, err
+	case http.StatusOK:
+		return nil, 0, ErrorRangesNotSupported
+	default:
+		return nil, 0, errors.New(fmt.Sprintf("could not download image %d: got status %s", piwigoId, response.Status))
+	}
+
+	size, err := parseContentRange(piwigoId, response.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, 0, err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(response.Body, byteRange.Length))
+	return content, size, err
+}
+
+// Returns the size of the whole file from the Content-Range header of a range response.
+func parseContentRange(piwigoId int, contentRange string) (int64, error) {
+	match := contentRangePattern.FindStringSubmatch(contentRange)
+	if match == nil {
+		return 0, errors.New(fmt.Sprintf("could not download image %d: got the invalid content range %q", piwigoId, contentRange))
+	}
+	return strconv.ParseInt(match[1], 10, 64)
+}
+
+// Returns the absolute url of the file of the image.
+func (context *ServerContext) elementUrl(piwigoId int) (string, error) {
+	info, err := context.GetImageInfo(piwigoId)
+	if err != nil {
+		return "", err
+	}
+	if info.ElementUrl == "" {
+		return "", errors.New(fmt.Sprintf("the server returned no file url for image %d", piwigoId))
+	}
+
+	baseUrl, err := url.Parse(context.url)
+	if err != nil {
+		return "", err
+	}
+	elementUrl, err := baseUrl.Parse(info.ElementUrl)
+	if err != nil {
+		return "", err
+	}
+	return elementUrl.String(), nil
+}
+
+// Requests the file of an image, only the given range of it if the range is not empty.
+func (context *ServerContext) getElement(ctx gocontext.Context, elementUrl string, byteRange string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, elementUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	context.addRequestHeaders(request)
+	if byteRange != "" {
+		request.Header.Set("Range", byteRange)
+	}
+	client := context.newHttpClient()
+	return client.Do(request)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_DownloadImage_writes_the_file_of_the_element_url(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload/2019/IMG_1.jpg":
+			_, _ = w.Write([]byte("jpeg content"))
+		case "/upload/missing.jpg":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			element := "upload/2019/IMG_1.jpg"
+			if r.PostFormValue("image_id") == "6" {
+				element = "upload/missing.jpg"
+			}
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":5,"element_url":"` + element + `"}}`))
+		}
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL + "/"}
+	content := bytes.Buffer{}
+	written, err := context.DownloadImage(5, &content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 12 || content.String() != "jpeg content" {
+		t.Errorf("unexpected download of %d bytes %q", written, content.String())
+	}
+
+	_, err = context.DownloadImage(6, &bytes.Buffer{})
+	if err == nil {
+		t.Error("expected an error for the missing file")
+	}
+}
+
+func Test_DownloadImageRanges_returns_the_requested_ranges(t *testing.T) {
+	file := []byte("0123456789abcdefghij")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload/IMG_1.jpg":
+			http.ServeContent(w, r, "IMG_1.jpg", time.Time{}, bytes.NewReader(file))
+		case "/upload/IMG_2.jpg":
+			_, _ = w.Write(file)
+		default:
+			element := "upload/IMG_1.jpg"
+			if r.PostFormValue("image_id") == "6" {
+				element = "upload/IMG_2.jpg"
+			}
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":5,"element_url":"` + element + `"}}`))
+		}
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL + "/"}
+	contents, size, err := context.DownloadImageRanges(5, []ByteRange{{Offset: 0, Length: 3}, {Offset: 18, Length: 5}, {Offset: 30, Length: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(file)) || string(contents[0]) != "012" || string(contents[1]) != "ij" || len(contents[2]) != 0 {
+		t.Errorf("unexpected ranges %q of a file of %d bytes", contents, size)
+	}
+
+	_, _, err = context.DownloadImageRanges(6, []ByteRange{{Offset: 0, Length: 3}})
+	if err != ErrorRangesNotSupported {
+		t.Errorf("expected ErrorRangesNotSupported but got %v", err)
+	}
+}
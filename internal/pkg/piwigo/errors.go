@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The error codes of the piwigo web service.
+const (
+	piwigoErrorAccessDenied     = 401
+	piwigoErrorForbidden        = 403
+	piwigoErrorNotFound         = 404
+	piwigoErrorInvalidMethod    = 501
+	piwigoErrorInvalidLogin     = 999
+	piwigoErrorMissingParameter = 1002
+	piwigoErrorInvalidParameter = 1003
+)
+
+// Conditions of failed requests that can be checked with errors.Is independent of the method that failed.
+var (
+	ErrorAccessDenied     = errors.New("access denied")
+	ErrorInvalidLogin     = errors.New("invalid username or password")
+	ErrorNotFound         = errors.New("not found")
+	ErrorMethodNotFound   = errors.New("method not supported by the server")
+	ErrorInvalidParameter = errors.New("invalid parameter")
+	// the server kept answering with 429 Too Many Requests
+	ErrorThrottled = errors.New("the server is throttling the requests")
+	// the server answered with something else than JSON, e.g. the error page of a proxy
+	ErrorUnexpectedResponse = errors.New("unexpected response of the server")
+)
+
+// A request the piwigo web service answered with the state "fail". Use errors.As to get the method and the error
+// code reported by the server.
+type PiwigoError struct {
+	Method  string
+	Code    int
+	Message string
+}
+
+func (e *PiwigoError) Error() string {
+	return fmt.Sprintf("%s failed with error %d: %s", e.Method, e.Code, e.Message)
+}
+
+// Matches the sentinel conditions by the error code. A missing image is reported as ErrorImageNotFound as well.
+func (e *PiwigoError) Is(target error) bool {
+	switch target {
+	case ErrorAccessDenied:
+		return e.Code == piwigoErrorAccessDenied || e.Code == piwigoErrorForbidden
+	case ErrorInvalidLogin:
+		return e.Code == piwigoErrorInvalidLogin
+	case ErrorNotFound:
+		return e.Code == piwigoErrorNotFound
+	case ErrorImageNotFound:
+		return e.Code == piwigoErrorNotFound && strings.HasPrefix(e.Method, "pwg.images.")
+	case ErrorMethodNotFound:
+		return e.Code == piwigoErrorInvalidMethod
+	case ErrorInvalidParameter:
+		return e.Code == piwigoErrorMissingParameter || e.Code == piwigoErrorInvalidParameter
+	}
+	return false
+}
+
+// A request the server answered with something else than JSON, like the HTML error page of a proxy or a php error. It
+// matches ErrorUnexpectedResponse with errors.Is and keeps the beginning of the body to show what the server sent.
+type UnexpectedResponseError struct {
+	Method      string
+	StatusCode  int
+	Status      string
+	ContentType string
+	Snippet     string
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("%s: the server returned %s %s instead of JSON - %s", e.Method, e.kind(), e.Status, e.Snippet)
+}
+
+func (e *UnexpectedResponseError) Is(target error) bool {
+	return target == ErrorUnexpectedResponse
+}
+
+func (e *UnexpectedResponseError) kind() string {
+	switch {
+	case e.Snippet == "":
+		return "an empty response"
+	case strings.Contains(e.ContentType, "html"):
+		return "HTML"
+	case e.ContentType == "":
+		return "a response"
+	}
+	return e.ContentType
+}
+
+// Reports if a request failed before the server answered, e.g. as the name of the server could not be resolved, the
+// connection got refused or reset or the request timed out, or if the server kept throttling it or a gateway in front
+// of it was unavailable. Such a request may succeed later. An answer of the server like invalid credentials, a failed
+// TLS handshake or an invalid certificate and a cancelled run are never transient.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, gocontext.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrorThrottled) {
+		return true
+	}
+	var unexpectedResponse *UnexpectedResponseError
+	if errors.As(err, &unexpectedResponse) {
+		switch unexpectedResponse.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var piwigoError *PiwigoError
+	if errors.As(err, &piwigoError) || isTlsError(err) {
+		return false
+	}
+
+	var opError *net.OpError
+	var dnsError *net.DNSError
+	if errors.As(err, &opError) || errors.As(err, &dnsError) {
+		return true
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Reports if the TLS handshake failed as the certificate is not trusted or the server sent an alert. Retrying does not
+// change the outcome.
+func isTlsError(err error) bool {
+	var alertError tls.AlertError
+	var recordHeaderError tls.RecordHeaderError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var certificateInvalidError x509.CertificateInvalidError
+	var hostnameError x509.HostnameError
+	if errors.As(err, &alertError) || errors.As(err, &recordHeaderError) || errors.As(err, &unknownAuthorityError) ||
+		errors.As(err, &certificateInvalidError) || errors.As(err, &hostnameError) {
+		return true
+	}
+	// the alerts of the server are reported as an OpError with an unexported error type
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Op == "remote error"
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_executePiwigoRequest_returns_the_error_of_the_server(t *testing.T) {
+	server := createFailingServer(`{"stat":"fail","err":501,"message":"Method name is not valid"}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.SetCategoryRepresentative(3, 7)
+
+	var piwigoError *PiwigoError
+	if !errors.As(err, &piwigoError) {
+		t.Fatalf("expected a PiwigoError but got %v", err)
+	}
+	if piwigoError.Method != "pwg.categories.setRepresentative" || piwigoError.Code != 501 || piwigoError.Message != "Method name is not valid" {
+		t.Errorf("unexpected error %+v", piwigoError)
+	}
+	if !errors.Is(err, ErrorMethodNotFound) || errors.Is(err, ErrorNotFound) {
+		t.Errorf("unexpected conditions of %s", err)
+	}
+}
+
+func Test_UpdateImagesInfo_keeps_the_error_of_the_server(t *testing.T) {
+	server := createFailingServer(`{"stat":"fail","err":401,"message":"Access denied"}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	_, err := context.UpdateImagesInfo([]ImageInfoUpdate{{PiwigoId: 3}, {PiwigoId: 4}}, 1)
+	if !errors.Is(err, ErrorAccessDenied) {
+		t.Errorf("expected access denied but got %v", err)
+	}
+}
+
+func Test_GetImageInfo_reports_missing_images(t *testing.T) {
+	server := createFailingServer(`{"stat":"fail","err":404,"message":"image_id not found"}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	_, err := context.GetImageInfo(3)
+	if !errors.Is(err, ErrorImageNotFound) || !errors.Is(err, ErrorNotFound) {
+		t.Errorf("expected the image to be not found but got %v", err)
+	}
+}
+
+func Test_Login_reports_invalid_credentials(t *testing.T) {
+	server := createFailingServer(`{"stat":"fail","err":999,"message":"Invalid username\/password"}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.Login()
+	if !errors.Is(err, ErrorInvalidLogin) {
+		t.Errorf("expected an invalid login but got %v", err)
+	}
+}
+
+func Test_PiwigoError_Is(t *testing.T) {
+	tests := []struct {
+		err      *PiwigoError
+		target   error
+		expected bool
+	}{
+		{&PiwigoError{Method: "pwg.categories.add", Code: 401}, ErrorAccessDenied, true},
+		{&PiwigoError{Method: "pwg.images.delete", Code: 403}, ErrorAccessDenied, true},
+		{&PiwigoError{Method: "pwg.categories.move", Code: 404}, ErrorImageNotFound, false},
+		{&PiwigoError{Method: "pwg.images.add", Code: 1002}, ErrorInvalidParameter, true},
+		{&PiwigoError{Method: "pwg.images.add", Code: 1003}, ErrorInvalidParameter, true},
+		{&PiwigoError{Method: "pwg.images.add", Code: 500}, ErrorInvalidParameter, false},
+	}
+	for _, tt := range tests {
+		if errors.Is(tt.err, tt.target) != tt.expected {
+			t.Errorf("expected errors.Is(%s, %s) to be %t", tt.err, tt.target, tt.expected)
+		}
+	}
+}
+
+func createFailingServer(response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(response))
+	}))
+}
+
+func Test_IsTransientError_of_a_login(t *testing.T) {
+	server := createFailingServer(`{"stat":"fail","err":999,"message":"Invalid username\/password"}`)
+	context := &ServerContext{url: server.URL}
+	err := context.Login()
+	if IsTransientError(err) {
+		t.Errorf("invalid credentials must not be retried but got a transient %v", err)
+	}
+
+	server.Close()
+	err = context.Login()
+	if !IsTransientError(err) {
+		t.Errorf("a refused connection should be transient but got %v", err)
+	}
+
+	context.url = "http://nonexisting.invalid"
+	err = context.Login()
+	if !IsTransientError(err) {
+		t.Errorf("a failed name resolution should be transient but got %v", err)
+	}
+}
+
+func Test_IsTransientError_of_a_failed_tls_handshake(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.Login()
+	if err == nil || IsTransientError(err) {
+		t.Errorf("an untrusted certificate must not be retried but got %v", err)
+	}
+	if IsTransientError(&net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}) {
+		t.Error("an alert of the server must not be retried")
+	}
+	if !IsTransientError(&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}) {
+		t.Error("a reset connection should be transient")
+	}
+}
+
+func Test_IsTransientError_of_a_cancelled_run(t *testing.T) {
+	if IsTransientError(fmt.Errorf("login failed - %w", gocontext.Canceled)) {
+		t.Error("a cancelled run must not be retried")
+	}
+	if IsTransientError(errors.New("did not get a valid piwigo token")) {
+		t.Error("an unknown error must not be retried")
+	}
+}
+
+func createHtmlServer(status int, page string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(page))
+	}))
+}
+
+func Test_executePiwigoRequest_reports_html_instead_of_json(t *testing.T) {
+	server := createHtmlServer(http.StatusBadGateway, "<html>\n<head><title>502 Bad Gateway</title></head>\n<body>\n<center><h1>502 Bad Gateway</h1></center>\n<hr><center>nginx</center>\n</body>\n</html>\n")
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.SetCategoryRepresentative(3, 7)
+
+	var unexpectedResponse *UnexpectedResponseError
+	if !errors.As(err, &unexpectedResponse) || !errors.Is(err, ErrorUnexpectedResponse) {
+		t.Fatalf("expected an UnexpectedResponseError but got %v", err)
+	}
+	expected := "pwg.categories.setRepresentative: the server returned HTML 502 Bad Gateway instead of JSON - 502 Bad Gateway 502 Bad Gateway nginx"
+	if err.Error() != expected {
+		t.Errorf("expected %q but got %q", expected, err)
+	}
+	if !IsTransientError(err) {
+		t.Error("an unavailable gateway should be transient")
+	}
+}
+
+func Test_Login_reports_html_instead_of_json(t *testing.T) {
+	server := createHtmlServer(http.StatusOK, "<!DOCTYPE html><html><body><p>Fatal error: Allowed memory size exhausted</p></body></html>")
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.Login()
+	if !errors.Is(err, ErrorUnexpectedResponse) {
+		t.Fatalf("expected an unexpected response but got %v", err)
+	}
+	if IsTransientError(err) {
+		t.Errorf("an error page of the server must not be retried but got a transient %v", err)
+	}
+}
+
+func Test_responseSnippet_truncates_long_responses(t *testing.T) {
+	snippet := responseSnippet([]byte(strings.Repeat("é", responseSnippetLength+10)))
+	if snippet != strings.Repeat("é", responseSnippetLength)+"..." {
+		t.Errorf("unexpected snippet %s", snippet)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The ways the original filename of an upload may be cleaned up before it is sent to the server.
+// The local file itself is never changed, so the md5sum and the content stay the same.
+const (
+	FilenameKeep          = "keep"
+	FilenameAscii         = "ascii"
+	FilenameReplaceSpaces = "replaceSpaces"
+)
+
+// the transliteration of the common non ascii letters
+var asciiTransliterations = map[rune]string{
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'å': "a", 'ā': "a", 'ą': "a", 'æ': "ae",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Å': "A", 'Ā': "A", 'Ą': "A", 'Æ': "Ae",
+	'ç': "c", 'ć': "c", 'č': "c", 'Ç': "C", 'Ć': "C", 'Č': "C",
+	'ď': "d", 'đ': "d", 'ð': "d", 'Ď': "D", 'Đ': "D", 'Ð': "D",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ę': "E", 'Ě': "E",
+	'ğ': "g", 'Ğ': "G",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ī': "I", 'İ': "I",
+	'ł': "l", 'ľ': "l", 'Ł': "L", 'Ľ': "L",
+	'ñ': "n", 'ń': "n", 'ň': "n", 'Ñ': "N", 'Ń': "N", 'Ň': "N",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ø': "O", 'Ō': "O", 'Ő': "O", 'Œ': "Oe",
+	'ř': "r", 'Ř': "R",
+	'ś': "s", 'š': "s", 'ş': "s", 'Ś': "S", 'Š': "S", 'Ş': "S",
+	'ť': "t", 'ţ': "t", 'þ': "th", 'Ť': "T", 'Ţ': "T", 'Þ': "Th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'Ù': "U", 'Ú': "U", 'Û': "U", 'Ū': "U", 'Ů': "U", 'Ű': "U",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y", 'Ÿ': "Y",
+	'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+	'–': "-", '—': "-", '‘': "'", '’': "'", '“': "", '”': "", '„': "", '…': "...", '€': "EUR",
+}
+
+func unknownFilenameModeError(mode string) error {
+	return errors.New(fmt.Sprintf("unknown filename mode %s, use %s, %s or %s", mode, FilenameKeep, FilenameAscii, FilenameReplaceSpaces))
+}
+
+// Cleans up the given filename according to the mode. Lowercases the result if the case should not be preserved.
+func SanitizeFilename(filename string, mode string, preserveCase bool) (string, error) {
+	var sanitized string
+	switch mode {
+	case "", FilenameKeep:
+		sanitized = filename
+	case FilenameAscii:
+		sanitized = transliterateToAscii(filename)
+	case FilenameReplaceSpaces:
+		sanitized = replaceSpaces(filename)
+	default:
+		return "", unknownFilenameModeError(mode)
+	}
+
+	if !preserveCase {
+		sanitized = strings.ToLower(sanitized)
+	}
+	return sanitized, nil
+}
+
+// Replaces all letters outside of the printable ascii range. Letters without a known transliteration become an underscore.
+func transliterateToAscii(filename string) string {
+	var builder strings.Builder
+	for _, r := range filename {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			builder.WriteRune(r)
+		case unicode.IsSpace(r):
+			builder.WriteRune(' ')
+		case unicode.Is(unicode.Mn, r):
+			// combining marks of decomposed letters are dropped and leave the base letter
+		default:
+			if replacement, ok := asciiTransliterations[r]; ok {
+				builder.WriteString(replacement)
+			} else {
+				builder.WriteRune('_')
+			}
+		}
+	}
+	return builder.String()
+}
+
+// Replaces all kind of whitespaces with an underscore.
+func replaceSpaces(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, filename)
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"testing"
+)
+
+func Test_SanitizeFilename_ascii_transliterates_unicode(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{filename: "Zürich Fähre.jpg", expected: "Zuerich Faehre.jpg"},
+		{filename: "Straße in Köln.JPG", expected: "Strasse in Koeln.JPG"},
+		{filename: "Café déjà vu.jpg", expected: "Cafe deja vu.jpg"},
+		{filename: "Cafe\u0301 decomposed.jpg", expected: "Cafe decomposed.jpg"},
+		{filename: "Łódź Kraków.png", expected: "Lodz Krakow.png"},
+		{filename: "Smørrebrød Ærø.jpg", expected: "Smorrebrod Aero.jpg"},
+		{filename: "İstanbul Çay.jpg", expected: "Istanbul Cay.jpg"},
+		{filename: "Urlaub – 2020 “Strand”.jpg", expected: "Urlaub - 2020 Strand.jpg"},
+		{filename: "東京タワー.jpg", expected: "_____.jpg"},
+		{filename: "party 🎉.jpg", expected: "party _.jpg"},
+		{filename: "no break.jpg", expected: "no break.jpg"},
+		{filename: "plain-ascii_01.jpg", expected: "plain-ascii_01.jpg"},
+	}
+
+	for _, test := range tests {
+		sanitized, err := SanitizeFilename(test.filename, FilenameAscii, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sanitized != test.expected {
+			t.Errorf("%s: expected %s but got %s", test.filename, test.expected, sanitized)
+		}
+	}
+}
+
+func Test_SanitizeFilename_keeps_filename_as_is(t *testing.T) {
+	for _, mode := range []string{"", FilenameKeep} {
+		sanitized, err := SanitizeFilename("Scan 1984 Zürich.TIF", mode, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sanitized != "Scan 1984 Zürich.TIF" {
+			t.Errorf("mode %q changed the filename to %s", mode, sanitized)
+		}
+	}
+}
+
+func Test_SanitizeFilename_replaces_spaces(t *testing.T) {
+	sanitized, err := SanitizeFilename("IMG 2020 (1)\tcopy.jpg", FilenameReplaceSpaces, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sanitized != "IMG_2020_(1)_copy.jpg" {
+		t.Errorf("unexpected filename %s", sanitized)
+	}
+}
+
+func Test_SanitizeFilename_lowercases_if_case_is_not_preserved(t *testing.T) {
+	sanitized, err := SanitizeFilename("IMG 0001.JPG", FilenameReplaceSpaces, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sanitized != "img_0001.jpg" {
+		t.Errorf("unexpected filename %s", sanitized)
+	}
+}
+
+func Test_SanitizeFilename_rejects_unknown_mode(t *testing.T) {
+	_, err := SanitizeFilename("image.jpg", "slugify", true)
+	if err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"path/filepath"
+	"strconv"
+)
+
+// Attaches the file as additional format to the image, e.g. the raw file of a JPEG. Users can download the format
+// next to the image. The file is sent in chunks of the upload chunk size of the server. Requires piwigo 11 or newer
+// with the formats enabled by $conf['enable_formats'] = true.
+func (context *ServerContext) UploadFormat(imageId int, filePath string, correlationId string) error {
+	err := context.requireManagedImages([]int{imageId})
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := localFileStructure.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size() == 0 {
+		return errors.New(fmt.Sprintf("the format %s is empty", filePath))
+	}
+	if context.chunkSizeInKB <= 0 {
+		return errors.New("the chunk size of the server is unknown, log in before uploading a format")
+	}
+
+	pwgToken, err := context.getPiwigoToken()
+	if err != nil {
+		return err
+	}
+
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	log := CorrelationLog(correlationId)
+	log.Infof("Uploading %s as format of image %d", filePath, imageId)
+
+	buffer := make([]byte, 1024*context.chunkSizeInKB)
+	numberOfChunks := expectedChunks(fileInfo.Size(), int64(len(buffer)))
+	for chunk := int64(0); chunk < numberOfChunks; chunk++ {
+		readBytes, err := io.ReadFull(file, buffer)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return errors.New(fmt.Sprintf("could not read chunk %d of %d of the format %s - %s", chunk, numberOfChunks, filePath, err))
+		}
+
+		formData := url.Values{}
+		formData.Set("method", "pwg.images.upload")
+		formData.Set("format_of", strconv.Itoa(imageId))
+		formData.Set("name", fileInfo.Name())
+		formData.Set("chunk", strconv.FormatInt(chunk, 10))
+		formData.Set("chunks", strconv.FormatInt(numberOfChunks, 10))
+		formData.Set("pwg_token", pwgToken)
+
+		log.Tracef("Uploading chunk %d of %d of the format %s", chunk, numberOfChunks, filePath)
+		err = context.uploadFormatChunk(formData, filepath.Base(filePath), buffer[:readBytes])
+		if err != nil {
+			return errors.New(fmt.Sprintf("could not upload chunk %d of the format %s - %s", chunk, filePath, err))
+		}
+	}
+	return nil
+}
+
+// Streams the chunk as multipart form like the upload form of piwigo, which is the only way to send a format.
+func (context *ServerContext) uploadFormatChunk(formData url.Values, fileName string, chunk []byte) error {
+	context.dumpRequest(formData, len(chunk))
+
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+
+	newBody := func() (io.Reader, string) {
+		body, bodyWriter := io.Pipe()
+		writer := multipart.NewWriter(context.limitBandwidth(ctx, bodyWriter))
+		go func() {
+			_ = bodyWriter.CloseWithError(writeFormatForm(writer, formData, fileName, chunk))
+		}()
+		return body, writer.FormDataContentType()
+	}
+
+	var response uploadChunkResponse
+	return context.executePiwigoBodyRequest(ctx, formData.Get("method"), newBody, &response)
+}
+
+func writeFormatForm(writer *multipart.Writer, formData url.Values, fileName string, chunk []byte) error {
+	for name := range formData {
+		err := writer.WriteField(name, formData.Get(name))
+		if err != nil {
+			return err
+		}
+	}
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(chunk)
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func Test_UploadFormat_sends_the_file_in_chunks(t *testing.T) {
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	var received []byte
+	var chunks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.PostFormValue("method") {
+		case "pwg.session.getStatus":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"pwg_token":"token"}}`))
+		case "pwg.images.upload":
+			if r.PostFormValue("format_of") != "3" || r.PostFormValue("chunks") != "3" || r.PostFormValue("pwg_token") != "token" {
+				t.Errorf("Unexpected form %v", r.PostForm)
+			}
+			chunks = append(chunks, r.PostFormValue("chunk"))
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			data, _ := ioutil.ReadAll(file)
+			received = append(received, data...)
+			_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+		default:
+			t.Errorf("Unexpected method %s", r.PostFormValue("method"))
+		}
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "format*.CR2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+	_, _ = file.Write(content)
+	_ = file.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 1}
+	err = context.UploadFormat(3, file.Name(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 || chunks[0] != "0" || chunks[2] != "2" {
+		t.Errorf("Unexpected chunks %v", chunks)
+	}
+	if !bytes.Equal(received, content) {
+		t.Error("the server did not receive the content of the format")
+	}
+}
+
+func Test_UploadFormat_rejects_empty_files(t *testing.T) {
+	file, err := ioutil.TempFile("", "format*.CR2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+	_ = file.Close()
+
+	context := &ServerContext{chunkSizeInKB: 1}
+	err = context.UploadFormat(3, file.Name(), "")
+	if err == nil {
+		t.Error("expected an error for an empty format")
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Parses a header given as "Key: Value". The key has to be a valid header name and the value must not contain line breaks.
+func ParseHeader(header string) (string, string, error) {
+	separator := strings.Index(header, ":")
+	if separator < 0 {
+		return "", "", errors.New(fmt.Sprintf("the header %q is not of the form \"Key: Value\"", header))
+	}
+
+	key := strings.TrimSpace(header[:separator])
+	value := strings.TrimSpace(header[separator+1:])
+	if !isHeaderName(key) {
+		return "", "", errors.New(fmt.Sprintf("the header %q has an invalid name %q", header, key))
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", "", errors.New(fmt.Sprintf("the value of the header %s must not contain line breaks", key))
+	}
+	return http.CanonicalHeaderKey(key), value, nil
+}
+
+// Header names are tokens as defined by RFC 7230.
+func isHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sets the configured headers and the user agent of every request to the server.
+func (context *ServerContext) addRequestHeaders(request *http.Request) {
+	for key, values := range context.headers {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+	if context.userAgent != "" {
+		request.Header.Set("User-Agent", context.userAgent)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_ParseHeader(t *testing.T) {
+	key, value, err := ParseHeader("x-proxy-token:  abc: def ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "X-Proxy-Token" || value != "abc: def" {
+		t.Errorf("unexpected header %s: %s", key, value)
+	}
+}
+
+func Test_ParseHeader_rejects_malformed_headers(t *testing.T) {
+	for _, header := range []string{"X-Proxy-Token", ": value", "X Proxy: value", "X-Proxy: a\r\nX-Other: b"} {
+		_, _, err := ParseHeader(header)
+		if err == nil {
+			t.Errorf("%q: expected an error for a malformed header", header)
+		}
+	}
+}
+
+func Test_executePiwigoRequest_sends_user_agent_and_headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != "PiwigoDirectoryUploader/1.0" {
+			t.Errorf("unexpected user agent %s", r.UserAgent())
+		}
+		if r.Header.Get("X-Proxy-Token") != "secret" {
+			t.Errorf("missing custom header in %v", r.Header)
+		}
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			t.Errorf("the content type must not be replaced by a custom header: %s", r.Header.Get("Content-Type"))
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.UseHeaders("PiwigoDirectoryUploader/1.0", []string{"X-Proxy-Token: secret", "Content-Type: text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	var response logoutResponse
+	err = context.executePiwigoRequest(ctx, url.Values{"method": {"pwg.session.logout"}}, &response)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A change of the info of an image. Fields that are not set remain unchanged on the server.
+type ImageInfoUpdate struct {
+	PiwigoId int
+	Fields   url.Values
+	// Connects the log lines of the request with the upload of the image. Optional.
+	CorrelationId string
+}
+
+// How many updates got requested and how many requests were sent to the server to apply them.
+type ImageInfoUpdateResult struct {
+	Updates  int
+	Images   int
+	Requests int
+}
+
+// Sets the date the image was added to the gallery. This controls the position of the image in the recent
+// additions instead of using the date of the upload.
+func NewDateAvailableUpdate(piwigoId int, dateAvailable time.Time) ImageInfoUpdate {
+	fields := url.Values{}
+	fields.Set("date_available", formatPiwigoDate(dateAvailable))
+	return ImageInfoUpdate{PiwigoId: piwigoId, Fields: fields}
+}
+
+// Sets the name and the creation date of the image and adds the tags to the existing ones. Empty values and a zero
+// date remain unchanged on the server.
+func NewImageDetailsUpdate(piwigoId int, name string, dateCreation time.Time, tagIds []int) ImageInfoUpdate {
+	fields := url.Values{}
+	if name != "" {
+		fields.Set("name", name)
+	}
+	if !dateCreation.IsZero() {
+		fields.Set("date_creation", formatPiwigoDate(dateCreation))
+	}
+	if len(tagIds) > 0 {
+		fields.Set("tag_ids", FormatTagIds(tagIds))
+	}
+	return ImageInfoUpdate{PiwigoId: piwigoId, Fields: fields}
+}
+
+// Sets the description of the image that is shown below it. An empty comment remains unchanged on the server.
+func NewCommentUpdate(piwigoId int, comment string) ImageInfoUpdate {
+	fields := url.Values{}
+	if comment != "" {
+		fields.Set("comment", comment)
+	}
+	return ImageInfoUpdate{PiwigoId: piwigoId, Fields: fields}
+}
+
+// Sets the dimensions in pixels and the file size in kilobytes of the image, e.g. if the server could not read them
+// from the uploaded file. Zero values remain unchanged on the server.
+func NewDimensionsUpdate(piwigoId int, width int, height int, filesize int) ImageInfoUpdate {
+	fields := url.Values{}
+	if width > 0 && height > 0 {
+		fields.Set("width", strconv.Itoa(width))
+		fields.Set("height", strconv.Itoa(height))
+	}
+	if filesize > 0 {
+		fields.Set("filesize", strconv.Itoa(filesize))
+	}
+	return ImageInfoUpdate{PiwigoId: piwigoId, Fields: fields}
+}
+
+// Replaces the categories of the image with the given ones.
+func NewCategoriesUpdate(piwigoId int, categoryIds []int) ImageInfoUpdate {
+	ids := make([]string, 0, len(categoryIds))
+	for _, categoryId := range categoryIds {
+		ids = append(ids, strconv.Itoa(categoryId))
+	}
+	fields := url.Values{}
+	fields.Set("categories", strings.Join(ids, ";"))
+	fields.Set("multiple_value_mode", "replace")
+	return ImageInfoUpdate{PiwigoId: piwigoId, Fields: fields}
+}
+
+// Applies the updates with as few requests as possible. Piwigo only accepts a single image per pwg.images.setInfo
+// call, so all updates of the same image are merged into one request and the requests of different images are
+// sent with the given number of parallel requests. A later update of a field replaces an earlier one.
+func (context *ServerContext) UpdateImagesInfo(updates []ImageInfoUpdate, parallelRequests int) (ImageInfoUpdateResult, error) {
+	err := context.requireManagedUpdates(updates)
+	if err != nil {
+		return ImageInfoUpdateResult{Updates: len(updates)}, err
+	}
+
+	merged := mergeImageInfoUpdates(updates)
+	result := ImageInfoUpdateResult{Updates: len(updates), Images: len(merged)}
+	if len(merged) == 0 {
+		return result, nil
+	}
+	if parallelRequests <= 0 {
+		parallelRequests = 1
+	}
+
+	queue := make(chan ImageInfoUpdate, len(merged))
+	for _, update := range merged {
+		queue <- update
+	}
+	close(queue)
+
+	mutex := sync.Mutex{}
+	failed := 0
+	var firstError error
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for update := range queue {
+				err := updateImageInfo(context, update.PiwigoId, update.Fields, update.CorrelationId)
+				mutex.Lock()
+				result.Requests++
+				if err != nil {
+					failed++
+					if firstError == nil {
+						firstError = err
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return result, fmt.Errorf("could not update the info of %d of %d images - %w", failed, len(merged), firstError)
+	}
+	return result, nil
+}
+
+// Merges the updates per image and keeps the order in which the images got updated first. The merged request is
+// logged with the correlation id of the first update.
+func mergeImageInfoUpdates(updates []ImageInfoUpdate) []ImageInfoUpdate {
+	merged := make([]ImageInfoUpdate, 0, len(updates))
+	positions := make(map[int]int, len(updates))
+	for _, update := range updates {
+		position, found := positions[update.PiwigoId]
+		if !found {
+			position = len(merged)
+			positions[update.PiwigoId] = position
+			merged = append(merged, ImageInfoUpdate{PiwigoId: update.PiwigoId, Fields: url.Values{}})
+		}
+		if merged[position].CorrelationId == "" {
+			merged[position].CorrelationId = update.CorrelationId
+		}
+		for field, values := range update.Fields {
+			merged[position].Fields[field] = values
+		}
+	}
+
+	if len(merged) < len(updates) {
+		logrus.Debugf("Merged %d image info updates into %d requests", len(updates), len(merged))
+	}
+	return merged
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// The log fields that connect all log lines of an image while many images are uploaded in parallel.
+const (
+	// identifies an image from entering the upload until its info got updated
+	LogFieldCorrelationId = "correlationId"
+	// identifies a chunk of an image, it starts with the correlation id of the image
+	LogFieldChunkId = "chunkId"
+)
+
+// Creates a short random id to find all log lines of an image, e.g. using grep.
+func NewCorrelationId() string {
+	id := make([]byte, 4)
+	_, err := rand.Read(id)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// Returns the logger for the lines of an image. Without a correlation id, the lines are logged without the field.
+func CorrelationLog(correlationId string) *logrus.Entry {
+	if correlationId == "" {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	return logrus.WithField(LogFieldCorrelationId, correlationId)
+}
+
+func chunkLog(correlationId string, position int64) *logrus.Entry {
+	log := CorrelationLog(correlationId)
+	if correlationId == "" {
+		return log
+	}
+	return log.WithField(LogFieldChunkId, fmt.Sprintf("%s-%d", correlationId, position))
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"testing"
+	"time"
+)
+
+func Test_NewCorrelationId_creates_short_unique_ids(t *testing.T) {
+	first := NewCorrelationId()
+	second := NewCorrelationId()
+	if len(first) != 8 || first == second {
+		t.Errorf("expected two different ids of 8 characters but got %s and %s", first, second)
+	}
+}
+
+func Test_CorrelationLog_without_id_has_no_fields(t *testing.T) {
+	if fields := CorrelationLog("").Data; len(fields) != 0 {
+		t.Errorf("expected no fields but got %v", fields)
+	}
+}
+
+func Test_chunkLog_adds_the_position_to_the_correlation_id(t *testing.T) {
+	fields := chunkLog("3f9a01bc", 4).Data
+	if fields[LogFieldCorrelationId] != "3f9a01bc" || fields[LogFieldChunkId] != "3f9a01bc-4" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func Test_uploadImageChunk_logs_failures_with_the_chunk_id(t *testing.T) {
+	hook := test.NewGlobal()
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks)) })
+
+	server := createFailingServer(`{"stat":"fail","err":1003,"message":"invalid chunk"}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := uploadImageChunk(context, []byte("chunk"), "1234", 2, "3f9a01bc")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Data[LogFieldChunkId] != "3f9a01bc-2" || entry.Data[LogFieldCorrelationId] != "3f9a01bc" {
+		t.Errorf("expected the failure to be logged with the chunk id but got %v", entry)
+	}
+}
+
+func Test_mergeImageInfoUpdates_keeps_the_first_correlation_id(t *testing.T) {
+	first := NewDateAvailableUpdate(5, time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC))
+	first.CorrelationId = "first"
+	second := ImageInfoUpdate{PiwigoId: 5, CorrelationId: "second"}
+
+	merged := mergeImageInfoUpdates([]ImageInfoUpdate{first, second})
+	if len(merged) != 1 || merged[0].CorrelationId != "first" {
+		t.Errorf("expected a single update with the first correlation id but got %v", merged)
+	}
+}
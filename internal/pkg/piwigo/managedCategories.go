@@ -0,0 +1,380 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The operation would change or read a category or an image outside of the managed categories.
+var ErrorUnmanagedCategory = errors.New("outside of the managed categories")
+
+// An operation that got refused as it is outside of the managed categories. It matches ErrorUnmanagedCategory with
+// errors.Is and names the category or image that is not managed.
+type UnmanagedCategoryError struct {
+	Target string
+}
+
+func (e *UnmanagedCategoryError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrorUnmanagedCategory, e.Target)
+}
+
+func (e *UnmanagedCategoryError) Is(target error) bool {
+	return target == ErrorUnmanagedCategory
+}
+
+// The subtrees of the categories the uploader may change. The keys are the paths of the categories like the keys of
+// GetAllCategories. A nil scope contains every category.
+type ManagedScope struct {
+	prefixes []string
+}
+
+// Reports if the category with the given key is one of the managed categories or below one of them.
+func (scope *ManagedScope) Contains(key string) bool {
+	if scope == nil {
+		return true
+	}
+	for _, prefix := range scope.prefixes {
+		if key == prefix || strings.HasPrefix(key, prefix+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports if the category with the given key is managed or a parent of a managed category. The parents are visible to
+// build the hierarchy of the managed categories, but they are never changed.
+func (scope *ManagedScope) IsVisible(key string) bool {
+	if scope.Contains(key) {
+		return true
+	}
+	for _, prefix := range scope.prefixes {
+		if strings.HasPrefix(prefix, key+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keeps the configured categories and what is known about the categories and images of the server to check every
+// operation before it gets sent.
+type managedCategories struct {
+	mutex sync.Mutex
+	// the configured categories, the ids are resolved to keys as soon as the categories are loaded
+	ids   []int
+	paths []string
+	scope *ManagedScope
+	// the keys of all categories of the server by id, nil until the categories got loaded
+	keys map[int]string
+	// whether all categories of an image are managed
+	images map[int]bool
+}
+
+// Limits all operations to the subtrees of the given categories, given by id like 12 or by path like
+// "2019/Holidays". Categories and images outside of them are invisible: they are not returned by GetAllCategories
+// and ImagesExistOnPiwigo, and every change to them fails with ErrorUnmanagedCategory. An image is only changed or
+// deleted if all of its categories are managed. Without categories, all categories are managed.
+func (context *ServerContext) UseManagedCategories(categories []string) error {
+	managed := &managedCategories{images: make(map[int]bool)}
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if id, err := strconv.Atoi(category); err == nil {
+			if id <= 0 {
+				return errors.New(fmt.Sprintf("invalid managed category id %d", id))
+			}
+			managed.ids = append(managed.ids, id)
+			continue
+		}
+
+		path := strings.Trim(filepath.FromSlash(category), string(os.PathSeparator))
+		if path == "" {
+			return errors.New(fmt.Sprintf("invalid managed category %q, use the id or the path of a category", category))
+		}
+		managed.paths = append(managed.paths, filepath.Clean(path))
+	}
+
+	if len(managed.ids) == 0 && len(managed.paths) == 0 {
+		context.managed = nil
+		return nil
+	}
+	managed.scope = &ManagedScope{prefixes: managed.paths}
+	logrus.Infof("Only managing the categories %s", strings.Join(categories, ", "))
+	context.managed = managed
+	return nil
+}
+
+// Returns the scope of the managed categories with the configured ids resolved, nil if all categories are managed.
+func (context *ServerContext) ManagedScope() (*ManagedScope, error) {
+	if context.managed == nil {
+		return nil, nil
+	}
+	err := context.loadManagedCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	context.managed.mutex.Lock()
+	defer context.managed.mutex.Unlock()
+	return context.managed.scope, nil
+}
+
+// Remembers the keys of the categories and resolves the configured ids.
+func (managed *managedCategories) update(categories map[int]*Category) {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+
+	managed.keys = make(map[int]string, len(categories))
+	for _, category := range categories {
+		managed.keys[category.Id] = category.Key
+	}
+
+	prefixes := append([]string{}, managed.paths...)
+	for _, id := range managed.ids {
+		key, found := managed.keys[id]
+		if !found {
+			logrus.Warnf("The managed category %d does not exist on the server", id)
+			continue
+		}
+		prefixes = append(prefixes, key)
+	}
+	managed.scope = &ManagedScope{prefixes: prefixes}
+}
+
+func (managed *managedCategories) containsCategory(categoryId int) bool {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	key, found := managed.keys[categoryId]
+	return found && managed.scope.Contains(key)
+}
+
+// The key of a category that gets created or moved below the given parent. Zero is the root.
+func (managed *managedCategories) childKey(parentId int, name string) (string, bool) {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	if parentId == 0 {
+		return name, true
+	}
+	parentKey, found := managed.keys[parentId]
+	if !found {
+		return "", false
+	}
+	return parentKey + string(os.PathSeparator) + name, true
+}
+
+func (managed *managedCategories) addCategory(categoryId int, key string) {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	managed.keys[categoryId] = key
+}
+
+func (managed *managedCategories) setImage(imageId int, isManaged bool) {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	managed.images[imageId] = isManaged
+}
+
+func (managed *managedCategories) forgetImage(imageId int) {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	delete(managed.images, imageId)
+}
+
+func (managed *managedCategories) image(imageId int) (bool, bool) {
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	isManaged, found := managed.images[imageId]
+	return isManaged, found
+}
+
+func (context *ServerContext) loadManagedCategories() error {
+	context.managed.mutex.Lock()
+	loaded := context.managed.keys != nil
+	context.managed.mutex.Unlock()
+	if loaded {
+		return nil
+	}
+
+	categories, err := context.loadCategories()
+	if err != nil {
+		return err
+	}
+	context.managed.update(categories)
+	return nil
+}
+
+// Fails if the category is not managed.
+func (context *ServerContext) requireManagedCategory(categoryId int) error {
+	if context.managed == nil {
+		return nil
+	}
+	err := context.loadManagedCategories()
+	if err != nil {
+		return err
+	}
+	if !context.managed.containsCategory(categoryId) {
+		return &UnmanagedCategoryError{Target: fmt.Sprintf("category %d", categoryId)}
+	}
+	return nil
+}
+
+// Fails if the category would not be managed after getting created or moved below the given parent.
+func (context *ServerContext) requireManagedChild(parentId int, name string) (string, error) {
+	if context.managed == nil {
+		return "", nil
+	}
+	err := context.loadManagedCategories()
+	if err != nil {
+		return "", err
+	}
+
+	key, found := context.managed.childKey(parentId, name)
+	if localKey, isLocal := context.localKeys[key]; isLocal {
+		key = localKey
+	}
+	context.managed.mutex.Lock()
+	contained := found && context.managed.scope.Contains(key)
+	context.managed.mutex.Unlock()
+	if !contained {
+		return "", &UnmanagedCategoryError{Target: fmt.Sprintf("category %s below %d", name, parentId)}
+	}
+	return key, nil
+}
+
+// Fails if one of the images is in a category that is not managed. The categories of the images are requested from
+// the server once and remembered. Images that do not exist are not checked.
+func (context *ServerContext) requireManagedImages(imageIds []int) error {
+	if context.managed == nil {
+		return nil
+	}
+	for _, imageId := range imageIds {
+		isManaged, err := context.isManagedImage(imageId)
+		if err != nil {
+			return err
+		}
+		if !isManaged {
+			return &UnmanagedCategoryError{Target: fmt.Sprintf("image %d is in a category that is not managed", imageId)}
+		}
+	}
+	return nil
+}
+
+func (context *ServerContext) isManagedImage(imageId int) (bool, error) {
+	if isManaged, found := context.managed.image(imageId); found {
+		return isManaged, nil
+	}
+	err := context.loadManagedCategories()
+	if err != nil {
+		return false, err
+	}
+
+	info, err := context.GetImageInfo(imageId)
+	if errors.Is(err, ErrorImageNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	isManaged := len(info.CategoryIds) > 0
+	for _, categoryId := range info.CategoryIds {
+		if !context.managed.containsCategory(categoryId) {
+			isManaged = false
+			break
+		}
+	}
+	context.managed.setImage(imageId, isManaged)
+	return isManaged, nil
+}
+
+// Fails if one of the updates changes an image that is not managed or assigns a category that is not managed.
+func (context *ServerContext) requireManagedUpdates(updates []ImageInfoUpdate) error {
+	if context.managed == nil {
+		return nil
+	}
+	for _, update := range updates {
+		err := context.requireManagedImages([]int{update.PiwigoId})
+		if err != nil {
+			return err
+		}
+		categories := update.Fields.Get("categories")
+		if categories == "" {
+			continue
+		}
+		for _, category := range strings.Split(categories, ";") {
+			categoryId, err := strconv.Atoi(category)
+			if err != nil {
+				return errors.New(fmt.Sprintf("invalid category %s in the update of image %d", category, update.PiwigoId))
+			}
+			err = context.requireManagedCategory(categoryId)
+			if err != nil {
+				return err
+			}
+		}
+		context.managed.forgetImage(update.PiwigoId)
+	}
+	return nil
+}
+
+// Hides the categories outside of the managed categories except the parents of the managed ones.
+func (context *ServerContext) visibleCategories(categories map[int]*Category) map[int]*Category {
+	if context.managed == nil {
+		return categories
+	}
+	context.managed.update(categories)
+
+	context.managed.mutex.Lock()
+	defer context.managed.mutex.Unlock()
+	visible := make(map[int]*Category, len(categories))
+	for id, category := range categories {
+		if context.managed.scope.IsVisible(category.Key) {
+			visible[id] = category
+		}
+	}
+	return visible
+}
+
+// Hides the existing images that are in a category that is not managed, so they are uploaded to the managed
+// categories instead of being taken over.
+func (context *ServerContext) visibleImages(existing map[string]int) error {
+	if context.managed == nil {
+		return nil
+	}
+	for md5sum, imageId := range existing {
+		if imageId == 0 {
+			continue
+		}
+		isManaged, err := context.isManagedImage(imageId)
+		if err != nil {
+			return err
+		}
+		if !isManaged {
+			logrus.Debugf("Ignoring the existing image %d with md5sum %s as it is not in a managed category", imageId, md5sum)
+			existing[md5sum] = 0
+		}
+	}
+	return nil
+}
+
+// Fails if the category is not managed or would not be managed below the new parent.
+func (context *ServerContext) requireManagedMove(categoryId int, parentId int) error {
+	err := context.requireManagedCategory(categoryId)
+	if err != nil || context.managed == nil {
+		return err
+	}
+
+	context.managed.mutex.Lock()
+	name := filepath.Base(context.managed.keys[categoryId])
+	context.managed.mutex.Unlock()
+	_, err = context.requireManagedChild(parentId, name)
+	return err
+}
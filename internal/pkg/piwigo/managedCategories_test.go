@@ -0,0 +1,255 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// A server with the categories Family (1), Family/2019 (2), Family/2020 (3) and Shared (4). Image 7 is in Family/2019,
+// image 8 in Family/2019 and Shared. The methods that change something are recorded.
+func createManagedCategoriesServer(t *testing.T) (*httptest.Server, *[]string) {
+	mutex := sync.Mutex{}
+	changes := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		method := r.PostForm.Get("method")
+		switch method {
+		case "pwg.categories.getList":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"categories":[` +
+				`{"id":1,"name":"Family"},` +
+				`{"id":2,"name":"2019","id_uppercat":"1"},` +
+				`{"id":3,"name":"2020","id_uppercat":"1"},` +
+				`{"id":4,"name":"Shared"}]}}`))
+		case "pwg.images.getInfo":
+			if r.PostForm.Get("image_id") == "7" {
+				_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":7,"categories":[{"id":2}]}}`))
+			} else {
+				_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":8,"categories":[{"id":2},{"id":4}]}}`))
+			}
+		case "pwg.images.exist":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"aaaa":"7","bbbb":"8","cccc":null}}`))
+		case "pwg.session.getStatus":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"admin","pwg_token":"token"}}`))
+		case "pwg.categories.add":
+			mutex.Lock()
+			changes = append(changes, method+" "+r.PostForm.Get("name"))
+			mutex.Unlock()
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":9}}`))
+		default:
+			mutex.Lock()
+			changes = append(changes, method)
+			mutex.Unlock()
+			_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+		}
+	}))
+	return server, &changes
+}
+
+func Test_GetAllCategories_hides_the_unmanaged_categories(t *testing.T) {
+	server, _ := createManagedCategoriesServer(t)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.UseManagedCategories([]string{"Family/2019"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := context.GetAllCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 2 || categories["Family"] == nil || categories[filepath.Join("Family", "2019")] == nil {
+		t.Errorf("expected the managed category and its parent but got %v", categories)
+	}
+}
+
+func Test_DeleteImages_outside_of_the_managed_categories_is_refused(t *testing.T) {
+	server, changes := createManagedCategoriesServer(t)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.UseManagedCategories([]string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.DeleteImages([]int{7, 8})
+	if !errors.Is(err, ErrorUnmanagedCategory) {
+		t.Errorf("expected the deletion of the shared image to be refused but got %v", err)
+	}
+	err = context.DeleteCategory(4)
+	if !errors.Is(err, ErrorUnmanagedCategory) {
+		t.Errorf("expected the deletion of the unmanaged category to be refused but got %v", err)
+	}
+	if len(*changes) != 0 {
+		t.Fatalf("expected nothing to be changed but got %v", *changes)
+	}
+
+	err = context.DeleteImages([]int{7})
+	if err != nil {
+		t.Error(err)
+	}
+	err = context.DeleteCategory(3)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(*changes) != 2 {
+		t.Errorf("expected the managed image and category to be deleted but got %v", *changes)
+	}
+}
+
+func Test_CreateCategory_only_creates_managed_categories(t *testing.T) {
+	server, changes := createManagedCategoriesServer(t)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.UseManagedCategories([]string{"Family", "Holidays"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = context.CreateCategory(4, "2021")
+	if !errors.Is(err, ErrorUnmanagedCategory) {
+		t.Errorf("expected the category below Shared to be refused but got %v", err)
+	}
+	_, err = context.CreateCategory(0, "Other")
+	if !errors.Is(err, ErrorUnmanagedCategory) {
+		t.Errorf("expected the category Other to be refused but got %v", err)
+	}
+
+	id, err := context.CreateCategory(0, "Holidays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = context.SetCategoryRank(id, 1)
+	if err != nil {
+		t.Errorf("expected the created category to be managed but got %v", err)
+	}
+	_, err = context.CreateCategory(1, "2021")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(*changes) != 3 {
+		t.Errorf("expected the managed categories to be created but got %v", *changes)
+	}
+}
+
+func Test_ImagesExistOnPiwigo_hides_the_unmanaged_images(t *testing.T) {
+	server, _ := createManagedCategoriesServer(t)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.UseManagedCategories([]string{"Family"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := context.ImagesExistOnPiwigo([]string{"aaaa", "bbbb", "cccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing["aaaa"] != 7 || existing["bbbb"] != 0 || existing["cccc"] != 0 {
+		t.Errorf("expected only the image of the managed category but got %v", existing)
+	}
+}
+
+func Test_UploadImage_does_not_take_over_unmanaged_images(t *testing.T) {
+	server, changes := createManagedCategoriesServer(t)
+	defer server.Close()
+	file, err := ioutil.TempFile("", "unmanagedimage*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, _ = file.WriteString("image")
+	_ = file.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	err = context.UseManagedCategories([]string{"Family"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = context.UploadImage(0, file.Name(), "bbbb", 2, "")
+	for _, change := range *changes {
+		if change == "pwg.images.setInfo" {
+			t.Fatalf("expected the shared image not to be added to the category but got %v", *changes)
+		}
+	}
+	if len(*changes) == 0 || (*changes)[0] != "pwg.images.addChunk" {
+		t.Errorf("expected the image to be uploaded but got %v", *changes)
+	}
+}
+
+func Test_UpdateImagesInfo_refuses_to_assign_unmanaged_categories(t *testing.T) {
+	server, changes := createManagedCategoriesServer(t)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.UseManagedCategories([]string{"Family"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = context.UpdateImagesInfo([]ImageInfoUpdate{NewCategoriesUpdate(7, []int{2, 4})}, 1)
+	if !errors.Is(err, ErrorUnmanagedCategory) {
+		t.Errorf("expected the update to be refused but got %v", err)
+	}
+	if len(*changes) != 0 {
+		t.Errorf("expected nothing to be changed but got %v", *changes)
+	}
+}
+
+func Test_UseManagedCategories_rejects_invalid_categories(t *testing.T) {
+	context := &ServerContext{}
+	for _, category := range []string{"-3", "/"} {
+		err := context.UseManagedCategories([]string{category})
+		if err == nil {
+			t.Errorf("expected %s to be rejected", category)
+		}
+	}
+	err := context.UseManagedCategories(nil)
+	if err != nil || context.managed != nil {
+		t.Errorf("expected all categories to be managed without categories but got %v", err)
+	}
+}
+
+func Test_ManagedScope(t *testing.T) {
+	scope := &ManagedScope{prefixes: []string{filepath.Join("Family", "2019")}}
+	tests := []struct {
+		key      string
+		contains bool
+		visible  bool
+	}{
+		{filepath.Join("Family", "2019"), true, true},
+		{filepath.Join("Family", "2019", "Summer"), true, true},
+		{"Family", false, true},
+		{filepath.Join("Family", "2020"), false, false},
+		{filepath.Join("Family", "20190"), false, false},
+		{"Shared", false, false},
+	}
+	for _, tt := range tests {
+		if scope.Contains(tt.key) != tt.contains || scope.IsVisible(tt.key) != tt.visible {
+			t.Errorf("%s: expected contains %t and visible %t", tt.key, tt.contains, tt.visible)
+		}
+	}
+
+	var all *ManagedScope
+	if !all.Contains("Shared") || !all.IsVisible("Shared") {
+		t.Error("expected a nil scope to contain all categories")
+	}
+}
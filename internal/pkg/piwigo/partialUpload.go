@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// How the upload of an image continues if a previous upload of the same content got interrupted after some chunks.
+//
+// Piwigo keeps the chunks sent with pwg.images.addChunk in its upload buffer, named by the md5sum, the type and the
+// position of the chunk. pwg.images.add merges all chunks of the md5sum ordered by position into the image and
+// removes them. The web service can neither list nor remove the chunks, so the chunks of an interrupted upload stay on
+// the server and get merged into the next upload of the same content. A chunk sent again replaces the chunk at the
+// same position. Stale chunks only corrupt the image if they are at positions the next upload does not reach, which
+// happens if the chunk size changed in between.
+const (
+	// all chunks are sent again with the chunk size of the interrupted upload, so every stale chunk gets replaced
+	PartialUploadRestart = "restart"
+	// the chunks the server already accepted are skipped
+	PartialUploadResume = "resume"
+)
+
+// Remembers the chunks of an image the server accepted until the image got added.
+type ChunkProgressStore interface {
+	ChunkProgress(md5sum string) (int, int, error)
+	SaveChunkProgress(md5sum string, chunks int, chunkSizeInKB int) error
+	DeleteChunkProgress(md5sum string) error
+}
+
+// Sets how interrupted uploads are continued. Without a store, every upload starts with the first chunk and the
+// configured chunk size.
+func (context *ServerContext) UsePartialUploads(mode string, store ChunkProgressStore) error {
+	if mode != PartialUploadRestart && mode != PartialUploadResume {
+		return errors.New(fmt.Sprintf("unknown partial upload mode %s. Use one of restart or resume", mode))
+	}
+	context.partialUploads = mode
+	context.chunkProgress = store
+	return nil
+}
+
+// Returns the first chunk to send and the chunk size to use for the upload of the image.
+func (context *ServerContext) partialUploadStart(md5sum string, resume bool, log *logrus.Entry) (int, int) {
+	if context.chunkProgress == nil {
+		return 0, context.chunkSizeInKB
+	}
+
+	chunks, chunkSizeInKB, err := context.chunkProgress.ChunkProgress(md5sum)
+	if err != nil {
+		log.Warnf("Could not load the chunks of an interrupted upload of %s, starting with the first chunk - %s", md5sum, err)
+		return 0, context.chunkSizeInKB
+	}
+	if chunks <= 0 || chunkSizeInKB <= 0 {
+		return 0, context.chunkSizeInKB
+	}
+
+	if chunkSizeInKB != context.chunkSizeInKB {
+		log.Infof("Using the chunk size of %d KB of the interrupted upload of %s", chunkSizeInKB, md5sum)
+	}
+	if resume {
+		log.Infof("Resuming the interrupted upload of %s after %d chunks", md5sum, chunks)
+		return chunks, chunkSizeInKB
+	}
+	log.Infof("Restarting the interrupted upload of %s that sent %d chunks", md5sum, chunks)
+	return 0, chunkSizeInKB
+}
+
+// Records the chunks the server accepted. Restarted uploads only need the chunk size, so it is saved once.
+func (context *ServerContext) saveChunkProgress(md5sum string, chunks int, chunkSizeInKB int, resume bool, log *logrus.Entry) {
+	if context.chunkProgress == nil || (!resume && chunks > 1) {
+		return
+	}
+	err := context.chunkProgress.SaveChunkProgress(md5sum, chunks, chunkSizeInKB)
+	if err != nil {
+		log.Warnf("Could not save the chunk progress of %s - %s", md5sum, err)
+	}
+}
+
+// Forgets the chunks once the server merged them into the image.
+func (context *ServerContext) clearChunkProgress(md5sum string, log *logrus.Entry) {
+	if context.chunkProgress == nil {
+		return
+	}
+	err := context.chunkProgress.DeleteChunkProgress(md5sum)
+	if err != nil {
+		log.Warnf("Could not delete the chunk progress of %s - %s", md5sum, err)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+type testChunkProgress struct {
+	chunks        int
+	chunkSizeInKB int
+	saved         []int
+	deleted       bool
+}
+
+func (store *testChunkProgress) ChunkProgress(md5sum string) (int, int, error) {
+	return store.chunks, store.chunkSizeInKB, nil
+}
+
+func (store *testChunkProgress) SaveChunkProgress(md5sum string, chunks int, chunkSizeInKB int) error {
+	store.chunks = chunks
+	store.chunkSizeInKB = chunkSizeInKB
+	store.saved = append(store.saved, chunks)
+	return nil
+}
+
+func (store *testChunkProgress) DeleteChunkProgress(md5sum string) error {
+	store.chunks = 0
+	store.chunkSizeInKB = 0
+	store.deleted = true
+	return nil
+}
+
+func Test_UploadImage_resumes_after_the_sent_chunks(t *testing.T) {
+	filePath := createPartialUploadTestFile(t, 5*1024)
+
+	var positions []string
+	var checked bool
+	server := newPartialUploadTestServer(t, &positions, &checked, "equals")
+	defer server.Close()
+
+	store := &testChunkProgress{chunks: 2, chunkSizeInKB: 1}
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	if err := context.UsePartialUploads(PartialUploadResume, store); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := context.UploadImage(0, filePath, "1234", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.ImageId != 3 {
+		t.Errorf("expected image 3 but got %d", result.ImageId)
+	}
+	if len(positions) != 3 || positions[0] != "2" || positions[2] != "4" {
+		t.Errorf("expected the chunks 2 to 4 with the chunk size of the interrupted upload but got %v", positions)
+	}
+	if !checked {
+		t.Error("expected the resumed upload to be checked by the server")
+	}
+	if len(store.saved) != 3 || !store.deleted {
+		t.Errorf("expected the progress to be saved after each chunk and deleted at the end but got %v", store.saved)
+	}
+}
+
+func Test_UploadImage_sends_all_chunks_again_if_the_resumed_upload_differs(t *testing.T) {
+	filePath := createPartialUploadTestFile(t, 3*1024)
+
+	var positions []string
+	var checked bool
+	server := newPartialUploadTestServer(t, &positions, &checked, "differs")
+	defer server.Close()
+
+	store := &testChunkProgress{chunks: 2, chunkSizeInKB: 1}
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 1}
+	if err := context.UsePartialUploads(PartialUploadResume, store); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := context.UploadImage(0, filePath, "1234", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"2", "0", "1", "2"}
+	if len(positions) != len(want) {
+		t.Fatalf("expected the chunks %v but got %v", want, positions)
+	}
+	for i := range want {
+		if positions[i] != want[i] {
+			t.Errorf("expected the chunks %v but got %v", want, positions)
+		}
+	}
+}
+
+func Test_UploadImage_restarts_with_the_chunk_size_of_the_interrupted_upload(t *testing.T) {
+	filePath := createPartialUploadTestFile(t, 3*1024)
+
+	var positions []string
+	var checked bool
+	server := newPartialUploadTestServer(t, &positions, &checked, "equals")
+	defer server.Close()
+
+	store := &testChunkProgress{chunks: 2, chunkSizeInKB: 1}
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	if err := context.UsePartialUploads(PartialUploadRestart, store); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := context.UploadImage(0, filePath, "1234", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(positions) != 3 || positions[0] != "0" {
+		t.Errorf("expected all 3 chunks but got %v", positions)
+	}
+	if checked {
+		t.Error("a restarted upload does not need to be checked")
+	}
+	if len(store.saved) != 1 || !store.deleted {
+		t.Errorf("expected the progress to be saved once and deleted at the end but got %v", store.saved)
+	}
+}
+
+func Test_UsePartialUploads_rejects_unknown_modes(t *testing.T) {
+	context := &ServerContext{}
+	if err := context.UsePartialUploads("continue", nil); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func newPartialUploadTestServer(t *testing.T, positions *[]string, checked *bool, checkResult string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		switch r.PostForm.Get("method") {
+		case "pwg.images.exist":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"1234":null}}`))
+		case "pwg.images.addChunk":
+			*positions = append(*positions, r.PostForm.Get("position"))
+			_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+		case "pwg.images.add":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"image_id":3}}`))
+		case "pwg.images.checkFiles":
+			*checked = true
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"file":"` + checkResult + `"}}`))
+		default:
+			t.Errorf("Unexpected call of %s", r.PostForm.Get("method"))
+			_, _ = w.Write([]byte(`{"stat":"fail","result":null}`))
+		}
+	}))
+}
+
+func createPartialUploadTestFile(t *testing.T, size int64) string {
+	file, err := ioutil.TempFile("", "partialupload*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+	_ = file.Truncate(size)
+	_ = file.Close()
+	return file.Name()
+}
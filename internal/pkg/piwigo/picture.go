@@ -10,11 +10,14 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
 	"github.com/sirupsen/logrus"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
-	"os"
 	"strconv"
+	"time"
 )
 
 const (
@@ -23,69 +26,209 @@ const (
 	ImageStateDifferent = 1
 )
 
-func uploadImageChunks(filePath string, context *ServerContext, fileSizeInKB int64, md5sum string) error {
-	file, err := os.Open(filePath)
+// The information the server holds about an uploaded image.
+type ImageInfo struct {
+	Id            int
+	File          string
+	Name          string
+	Md5Sum        string
+	DateAvailable string
+	DateCreation  string
+	Filesize      int
+	Width         int
+	Height        int
+	ElementUrl    string
+	CategoryIds   []int
+}
+
+// The result of an upload. If an image with the same md5sum already existed on the server, the content
+// is not uploaded again and the existing image is returned.
+type UploadResult struct {
+	ImageId         int
+	MatchedExisting bool
+}
+
+// returned if the requested image does not exist on the server
+var ErrorImageNotFound = errors.New("image not found")
+
+// the type of the chunks core piwigo expects
+const defaultChunkType = "file"
+
+// the date format used by piwigo for all date fields
+const piwigoDateFormat = "2006-01-02 15:04:05"
+
+// Sends the chunks of the file. An interrupted upload of the same content is continued as configured by
+// UsePartialUploads. Returns true if chunks the server got earlier have been skipped. Fails if the number of chunks
+// read does not match the file size, as the file got truncated or changed while reading.
+func uploadImageChunks(filePath string, context *ServerContext, fileSize int64, md5sum string, correlationId string, resume bool) (bool, error) {
+	file, err := localFileStructure.OpenFile(filePath)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer file.Close()
 
-	reader := bufio.NewReader(file)
-	bufferSize := 1024 * context.chunkSizeInKB
+	log := CorrelationLog(correlationId)
+	firstChunk, chunkSizeInKB := context.partialUploadStart(md5sum, resume, log)
+
+	bufferSize := 1024 * chunkSizeInKB
+	reader := bufio.NewReaderSize(file, bufferSize)
 	buffer := make([]byte, bufferSize)
-	numberOfChunks := (fileSizeInKB / int64(context.chunkSizeInKB)) + 1
+	numberOfChunks := expectedChunks(fileSize, int64(bufferSize))
 	currentChunk := int64(0)
 
+	if firstChunk > 0 {
+		_, err = io.CopyN(ioutil.Discard, reader, int64(firstChunk)*int64(bufferSize))
+		if err != nil {
+			log.Warnf("The file %s is shorter than the %d chunks already sent, sending all chunks again - %s", filePath, firstChunk, err)
+			_, err = uploadImageChunks(filePath, context, fileSize, md5sum, correlationId, false)
+			return false, err
+		}
+		currentChunk = int64(firstChunk)
+	}
+
 	for {
-		logrus.Tracef("Processing chunk %d of %d of %s", currentChunk, numberOfChunks, filePath)
+		chunkLog(correlationId, currentChunk).Tracef("Processing chunk %d of %d of %s", currentChunk, numberOfChunks, filePath)
 
-		readBytes, readError := reader.Read(buffer)
-		if readError == io.EOF && readBytes == 0 {
+		// archive entries are decompressed while reading and may return fewer bytes per read than a chunk
+		readBytes, readError := io.ReadFull(reader, buffer)
+		if readError == io.EOF {
 			break
 		}
-		if readError != io.EOF && readError != nil {
-			return readError
+		if readError != io.ErrUnexpectedEOF && readError != nil {
+			return false, readError
 		}
 
-		encodedChunk := base64.StdEncoding.EncodeToString(buffer[:readBytes])
-
-		uploadError := uploadImageChunk(context, encodedChunk, md5sum, currentChunk)
+		started := time.Now()
+		uploadError := uploadImageChunk(context, buffer[:readBytes], md5sum, currentChunk, correlationId)
 		if uploadError != nil {
-			return uploadError
+			return false, uploadError
 		}
+		context.timeChunk(filePath, currentChunk, numberOfChunks, time.Since(started), chunkLog(correlationId, currentChunk))
 
 		currentChunk++
+		context.saveChunkProgress(md5sum, int(currentChunk), chunkSizeInKB, resume, log)
 	}
 
-	return nil
+	if currentChunk != numberOfChunks {
+		return false, errors.New(fmt.Sprintf("sent %d chunks of %s but expected %d chunks for %d bytes, the file got truncated or changed while reading", currentChunk, filePath, numberOfChunks, fileSize))
+	}
+	return firstChunk > 0, nil
+}
+
+// The number of chunks of a file. A file that ends on a chunk boundary has no additional empty chunk and an empty
+// file has no chunks at all.
+func expectedChunks(fileSize int64, chunkSize int64) int64 {
+	return (fileSize + chunkSize - 1) / chunkSize
 }
 
-func uploadImageChunk(context *ServerContext, base64chunk string, md5sum string, position int64) error {
+// Uploads the chunk by streaming the form to the server. The base64 encoded and escaped data is written directly to
+// the request body instead of building the whole form in memory. This keeps the memory usage at the size of the
+// chunk buffer, which is reused for all chunks, regardless of the number of parallel uploads.
+func uploadImageChunk(context *ServerContext, chunk []byte, md5sum string, position int64, correlationId string) error {
+	log := chunkLog(correlationId, position)
+
 	formData := url.Values{}
 	formData.Set("method", "pwg.images.addChunk")
-	formData.Set("data", base64chunk)
 	formData.Set("original_sum", md5sum)
 	// required by the API for compatibility
-	formData.Set("type", "file")
+	formData.Set("type", context.uploadChunkType())
 	formData.Set("position", strconv.FormatInt(position, 10))
 
-	logrus.Tracef("Uploading chunk %d of file with sum %s", position, md5sum)
+	log.Tracef("Uploading chunk %d of file with sum %s", position, md5sum)
+	context.dumpRequest(formData, len(chunk))
+
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+
+	newBody := func() io.Reader {
+		body, bodyWriter := io.Pipe()
+		go func() {
+			_ = bodyWriter.CloseWithError(writeChunkForm(context.limitBandwidth(ctx, bodyWriter), formData, chunk))
+		}()
+		return body
+	}
 
 	var response uploadChunkResponse
-	err := context.executePiwigoRequest(formData, &response)
+	err := context.executePiwigoStreamRequest(ctx, formData.Get("method"), newBody, &response)
 	if err != nil {
-		logrus.Errorf("Got state %s while uploading chunk %d of %s", response.Status, position, md5sum)
-		return errors.New(fmt.Sprintf("Got state %s while uploading chunk %d of %s", response.Status, position, md5sum))
+		log.Errorf("Could not upload chunk %d of %s - %s", position, md5sum, err)
+		return fmt.Errorf("could not upload chunk %d of %s - %w", position, md5sum, err)
 	}
 
 	return nil
 }
 
-func uploadImageFinal(context *ServerContext, piwigoId int, originalFilename string, md5sum string, categoryId int) (int, error) {
+func (context *ServerContext) uploadChunkType() string {
+	if context.chunkType == "" {
+		return defaultChunkType
+	}
+	return context.chunkType
+}
+
+func writeChunkForm(writer io.Writer, formData url.Values, chunk []byte) error {
+	_, err := io.WriteString(writer, formData.Encode()+"&data=")
+	if err != nil {
+		return err
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, &formValueEscaper{writer: writer})
+	_, err = encoder.Write(chunk)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// The formValueEscaper escapes the characters of the base64 alphabet that are not allowed
+// in a form value the same way as url.QueryEscape does.
+type formValueEscaper struct {
+	writer io.Writer
+	buffer [4096]byte
+}
+
+func (e *formValueEscaper) Write(p []byte) (int, error) {
+	const hex = "0123456789ABCDEF"
+	position := 0
+	for _, c := range p {
+		if position+3 > len(e.buffer) {
+			if _, err := e.writer.Write(e.buffer[:position]); err != nil {
+				return 0, err
+			}
+			position = 0
+		}
+
+		if c == '+' || c == '/' || c == '=' {
+			e.buffer[position] = '%'
+			e.buffer[position+1] = hex[c>>4]
+			e.buffer[position+2] = hex[c&15]
+			position += 3
+		} else {
+			e.buffer[position] = c
+			position++
+		}
+	}
+
+	if _, err := e.writer.Write(e.buffer[:position]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func uploadImageFinal(context *ServerContext, piwigoId int, originalFilename string, md5sum string, categoryId int, correlationId string) (int, error) {
+	log := CorrelationLog(correlationId)
+
+	uploadFilename, err := SanitizeFilename(originalFilename, context.filenameMode, !context.lowercaseFilenames)
+	if err != nil {
+		return 0, err
+	}
+	if uploadFilename != originalFilename {
+		log.Infof("Uploading file %s with the sanitized filename %s", originalFilename, uploadFilename)
+	}
+
 	formData := url.Values{}
 	formData.Set("method", "pwg.images.add")
 	formData.Set("original_sum", md5sum)
-	formData.Set("original_filename", originalFilename)
+	formData.Set("original_filename", uploadFilename)
 	formData.Set("name", originalFilename)
 	formData.Set("categories", strconv.Itoa(categoryId))
 
@@ -95,14 +238,119 @@ func uploadImageFinal(context *ServerContext, piwigoId int, originalFilename str
 		formData.Set("image_id", strconv.Itoa(piwigoId))
 	}
 
-	logrus.Debugf("Finalizing upload of file %s with sum %s to category %d", originalFilename, md5sum, categoryId)
+	log.Debugf("Finalizing upload of file %s with sum %s to category %d", originalFilename, md5sum, categoryId)
 
 	var response fileAddResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
-		logrus.Errorf("Got state %s while adding image %s", response.Status, originalFilename)
-		return 0, errors.New(fmt.Sprintf("Got state %s while adding image %s", response.Status, originalFilename))
+		log.Errorf("Could not add image %s - %s", originalFilename, err)
+		return 0, fmt.Errorf("could not add image %s - %w", originalFilename, err)
 	}
 
 	return response.Result.ImageID, nil
 }
+
+func generateDerivatives(context *ServerContext, piwigoId int) error {
+	formData := url.Values{}
+	formData.Set("method", "pwg.images.getInfo")
+	formData.Set("image_id", strconv.Itoa(piwigoId))
+
+	var response imageInfoResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		return err
+	}
+
+	baseUrl, err := url.Parse(context.url)
+	if err != nil {
+		return err
+	}
+
+	for _, size := range context.availableSizes {
+		derivative, found := response.Result.Derivatives[size]
+		if !found || derivative.URL == "" {
+			logrus.Debugf("No derivative of size %s for image %d", size, piwigoId)
+			continue
+		}
+
+		derivativeUrl, err := baseUrl.Parse(derivative.URL)
+		if err != nil {
+			return err
+		}
+
+		err = requestDerivative(context, derivativeUrl.String())
+		if err != nil {
+			return errors.New(fmt.Sprintf("could not generate derivative %s of image %d: %s", size, piwigoId, err))
+		}
+		logrus.Tracef("Generated derivative %s of image %d", size, piwigoId)
+	}
+	return nil
+}
+
+// Piwigo generates a missing derivative on the first request of its url.
+func requestDerivative(context *ServerContext, derivativeUrl string) error {
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, derivativeUrl, nil)
+	if err != nil {
+		return err
+	}
+	context.addRequestHeaders(request)
+
+	client := context.newHttpClient()
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(ioutil.Discard, response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("got status %s", response.Status))
+	}
+	return nil
+}
+
+// Adds the image to the category and keeps all other categories of the image.
+func addImageToCategory(context *ServerContext, piwigoId int, categoryId int, correlationId string) error {
+	formData := url.Values{}
+	formData.Set("categories", strconv.Itoa(categoryId))
+	formData.Set("multiple_value_mode", "append")
+
+	return updateImageInfo(context, piwigoId, formData, correlationId)
+}
+
+// Updates the given fields of an existing image. Fields that are not present in the form data remain unchanged on the server.
+func updateImageInfo(context *ServerContext, piwigoId int, formData url.Values, correlationId string) error {
+	log := CorrelationLog(correlationId)
+
+	formData.Set("method", "pwg.images.setInfo")
+	formData.Set("image_id", strconv.Itoa(piwigoId))
+	formData.Set("single_value_mode", "replace")
+
+	log.Tracef("Updating image info of image %d", piwigoId)
+
+	var response setInfoResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		log.Errorf("Could not update the info of image %d - %s", piwigoId, err)
+		return fmt.Errorf("could not update the info of image %d - %w", piwigoId, err)
+	}
+
+	return nil
+}
+
+func formatPiwigoDate(date time.Time) string {
+	return date.Format(piwigoDateFormat)
+}
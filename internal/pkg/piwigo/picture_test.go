@@ -0,0 +1,270 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func Test_uploadImageChunk_streams_encoded_form(t *testing.T) {
+	chunk := make([]byte, 3000)
+	for i := range chunk {
+		chunk[i] = byte(i * 7)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("data") != base64.StdEncoding.EncodeToString(chunk) {
+			t.Error("The chunk data was not encoded correctly")
+		}
+		if r.PostForm.Get("method") != "pwg.images.addChunk" || r.PostForm.Get("original_sum") != "1234" || r.PostForm.Get("position") != "3" || r.PostForm.Get("type") != "file" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	err := uploadImageChunk(context, chunk, "1234", 3, "")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_uploadImageChunk_sends_the_configured_chunk_type(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("type") != "thumb" {
+			t.Errorf("expected the chunk type thumb but got %s", r.PostForm.Get("type"))
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	err := context.UseChunkType("thumb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = uploadImageChunk(context, []byte("chunk"), "1234", 0, "")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UseChunkType_rejects_empty_type(t *testing.T) {
+	context := &ServerContext{}
+	if err := context.UseChunkType(" "); err == nil {
+		t.Error("expected an error for an empty chunk type")
+	}
+}
+
+func Test_UploadImage_assigns_existing_image_instead_of_uploading(t *testing.T) {
+	file, err := ioutil.TempFile("", "existingimage*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_ = file.Close()
+
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		methods = append(methods, r.PostForm.Get("method"))
+
+		switch r.PostForm.Get("method") {
+		case "pwg.images.exist":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"1234":"7"}}`))
+		case "pwg.images.setInfo":
+			if r.PostForm.Get("image_id") != "7" || r.PostForm.Get("categories") != "2" || r.PostForm.Get("multiple_value_mode") != "append" {
+				t.Errorf("Unexpected form values %v", r.PostForm)
+			}
+			_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+		default:
+			t.Errorf("Unexpected call of %s", r.PostForm.Get("method"))
+			_, _ = w.Write([]byte(`{"stat":"fail","result":null}`))
+		}
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	result, err := context.UploadImage(0, file.Name(), "1234", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.ImageId != 7 || !result.MatchedExisting {
+		t.Errorf("expected the existing image 7 to be matched but got %+v", result)
+	}
+	if len(methods) != 2 {
+		t.Errorf("expected only the lookup and the category assignment but got %v", methods)
+	}
+}
+
+func Test_GenerateDerivatives_requests_available_sizes(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			requested = append(requested, r.URL.RawQuery)
+			_, _ = w.Write([]byte("image"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":7,"derivatives":{` +
+			`"square":{"url":"/i.php?/upload/a-sq.jpg"},` +
+			`"thumb":{"url":"/i.php?/upload/a-th.jpg"},` +
+			`"xxlarge":{"url":"/i.php?/upload/a-xx.jpg"}}}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL + "/ws.php?format=json", availableSizes: []string{"square", "thumb", "medium"}}
+	err := context.GenerateDerivatives(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requested) != 2 || requested[0] != "/upload/a-sq.jpg" || requested[1] != "/upload/a-th.jpg" {
+		t.Errorf("expected the square and thumb derivatives to be requested but got %v", requested)
+	}
+}
+
+func Test_GenerateDerivatives_fails_on_error_status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":7,"derivatives":{"thumb":{"url":"/i.php?/upload/a-th.jpg"}}}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL + "/ws.php?format=json", availableSizes: []string{"thumb"}}
+	err := context.GenerateDerivatives(7)
+	if err == nil {
+		t.Error("expected an error as the derivative could not be generated")
+	}
+}
+
+func BenchmarkUploadImageChunks(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(ioutil.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "chunkbenchmark*.jpg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	fileSize := int64(8 * 1024 * 1024)
+	_ = file.Truncate(fileSize)
+	_ = file.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+
+	b.ReportAllocs()
+	b.SetBytes(fileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = uploadImageChunks(file.Name(), context, fileSize, "1234", "", false)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_uploadImageFinal_sends_sanitized_filename(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("original_filename") != "zuerich faehre.jpg" {
+			t.Errorf("Unexpected original filename %s", r.PostForm.Get("original_filename"))
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"image_id":3}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 512}
+	err := context.UseFilenameMode(FilenameAscii, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = uploadImageFinal(context, 0, "Zürich Fähre.jpg", "1234", 2, "")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// Writes a file of the given size and uploads it in chunks of 1 KB. Returns the positions of the chunks received by
+// the server.
+func uploadTestChunks(t *testing.T, fileSize int64, expectedSize int64) ([]string, error) {
+	var positions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		positions = append(positions, r.PostForm.Get("position"))
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "chunks*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(file.Name()) })
+	_ = file.Truncate(fileSize)
+	_ = file.Close()
+
+	context := &ServerContext{url: server.URL, chunkSizeInKB: 1}
+	_, err = uploadImageChunks(file.Name(), context, expectedSize, "1234", "", false)
+	return positions, err
+}
+
+func Test_uploadImageChunks_sends_the_expected_number_of_chunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileSize int64
+		chunks   int
+	}{
+		{"empty file", 0, 0},
+		{"one byte", 1, 1},
+		{"exactly on a chunk boundary", 2048, 2},
+		{"one byte over a chunk boundary", 2049, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, err := uploadTestChunks(t, tt.fileSize, tt.fileSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(positions) != tt.chunks {
+				t.Errorf("expected %d chunks but got the positions %v", tt.chunks, positions)
+			}
+		})
+	}
+}
+
+func Test_uploadImageChunks_fails_if_the_file_is_shorter_than_expected(t *testing.T) {
+	_, err := uploadTestChunks(t, 2048, 2049)
+	if err == nil {
+		t.Error("expected an error as a chunk is missing")
+	}
+}
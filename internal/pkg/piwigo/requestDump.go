@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const redacted = "<redacted>"
+
+// Parts of form keys whose values are never logged. The keys are compared ignoring the case, so e.g. "password",
+// "new_password" and "pwg_token" are all redacted.
+var sensitiveFormKeys = []string{"pass", "token", "secret", "cookie", "auth", "key"}
+
+// Logs the method and the form values of every request at trace level if enabled. It is meant to debug servers that
+// treat parameters differently than expected. Secrets are redacted.
+func (context *ServerContext) UseRequestDump(enabled bool) {
+	context.dumpRequests = enabled
+	if enabled && !logrus.IsLevelEnabled(logrus.TraceLevel) {
+		logrus.Warn("The requests are only dumped with the log level trace")
+	}
+}
+
+// The chunk data is streamed to the server, so only its size is logged.
+func (context *ServerContext) dumpRequest(formData url.Values, chunkSize int) {
+	if !context.dumpRequests || !logrus.IsLevelEnabled(logrus.TraceLevel) {
+		return
+	}
+
+	parameters := context.redactFormData(formData)
+	if chunkSize > 0 {
+		parameters += fmt.Sprintf(" data=<%d bytes>", chunkSize)
+	}
+	logrus.Tracef("Request %s: %s", formData.Get("method"), parameters)
+}
+
+// Formats the form values sorted by key. Values of sensitive keys and the chunk data are replaced, the password and
+// the session cookie are removed from all other values as well in case they ended up in an unexpected parameter.
+func (context *ServerContext) redactFormData(formData url.Values) string {
+	keys := make([]string, 0, len(formData))
+	for key := range formData {
+		if key != "method" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	secrets := context.secrets()
+	parameters := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range formData[key] {
+			parameters = append(parameters, key+"="+redactFormValue(key, value, secrets))
+		}
+	}
+	return strings.Join(parameters, " ")
+}
+
+func redactFormValue(key string, value string, secrets []string) string {
+	if key == "data" {
+		return fmt.Sprintf("<%d bytes>", len(value))
+	}
+
+	lowerKey := strings.ToLower(key)
+	for _, sensitive := range sensitiveFormKeys {
+		if strings.Contains(lowerKey, sensitive) {
+			return redacted
+		}
+	}
+
+	for _, secret := range secrets {
+		value = strings.ReplaceAll(value, secret, redacted)
+	}
+	return value
+}
+
+func (context *ServerContext) secrets() []string {
+	secrets := make([]string, 0, 2)
+	if context.password != "" {
+		secrets = append(secrets, context.password)
+	}
+	if context.cookies != nil && context.url != "" {
+		if serviceUrl, err := url.Parse(context.url); err == nil {
+			for _, cookie := range context.cookies.Cookies(serviceUrl) {
+				if cookie.Value != "" {
+					secrets = append(secrets, cookie.Value)
+				}
+			}
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Captures the log lines at trace level and restores the log level and the hooks afterwards.
+func captureTraceLog(t *testing.T) *test.Hook {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.TraceLevel)
+	hook := test.NewGlobal()
+	t.Cleanup(func() {
+		logrus.SetLevel(level)
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	})
+	return hook
+}
+
+func Test_redactFormData_removes_secrets(t *testing.T) {
+	context := &ServerContext{password: "s3cret!"}
+	formData := url.Values{}
+	formData.Set("method", "pwg.session.login")
+	formData.Set("username", "admin")
+	formData.Set("password", "s3cret!")
+	formData.Set("New_Password", "other")
+	formData.Set("pwg_token", "token")
+	formData.Set("data", "YWJj")
+	formData.Set("comment", "contains s3cret! by accident")
+
+	dumped := context.redactFormData(formData)
+
+	expected := "New_Password=<redacted> comment=contains <redacted> by accident data=<4 bytes> password=<redacted> pwg_token=<redacted> username=admin"
+	if dumped != expected {
+		t.Errorf("expected %q but got %q", expected, dumped)
+	}
+}
+
+func Test_Login_dumps_the_request_without_password(t *testing.T) {
+	hook := captureTraceLog(t)
+	server := createFailingServer(`{"stat":"ok","result":true}`)
+	defer server.Close()
+
+	context := &ServerContext{}
+	err := context.Initialize(server.URL, "admin", "s3cret!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	context.UseRequestDump(true)
+	_ = context.Login()
+
+	dumped := false
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, "s3cret!") {
+			t.Errorf("the password got logged: %s", entry.Message)
+		}
+		dumped = dumped || entry.Message == "Request pwg.session.login: password=<redacted> username=admin"
+	}
+	if !dumped {
+		t.Error("expected the login request to be dumped")
+	}
+}
+
+func Test_uploadImageChunk_dumps_only_the_size_of_the_chunk(t *testing.T) {
+	hook := captureTraceLog(t)
+	server := createFailingServer(`{"stat":"ok","result":null}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, dumpRequests: true}
+	err := uploadImageChunk(context, []byte("chunk"), "1234", 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Request pwg.images.addChunk: original_sum=1234 position=3 type=file data=<5 bytes>"
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == expected {
+			return
+		}
+	}
+	t.Errorf("expected the request %q to be dumped", expected)
+}
+
+func Test_requests_are_not_dumped_by_default(t *testing.T) {
+	hook := captureTraceLog(t)
+	server := createFailingServer(`{"stat":"ok","result":null}`)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	_ = uploadImageChunk(context, []byte("chunk"), "1234", 3, "")
+
+	for _, entry := range hook.AllEntries() {
+		if strings.HasPrefix(entry.Message, "Request ") {
+			t.Errorf("expected no dumped request but got %s", entry.Message)
+		}
+	}
+}
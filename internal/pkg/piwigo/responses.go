@@ -5,17 +5,28 @@
 
 package piwigo
 
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
 type responseStatuser interface {
 	responseStatus() string
 }
 
-type loginResponse struct {
+// The error code and message of a request that failed. Only set if the state is "fail".
+type errorResponse struct {
 	Status      string `json:"stat"`
-	Result      bool   `json:"result"`
 	ErrorNumber int    `json:"err"`
 	Message     string `json:"message"`
 }
 
+type loginResponse struct {
+	Status string `json:"stat"`
+	Result bool   `json:"result"`
+}
+
 func (r loginResponse) responseStatus() string {
 	return r.Status
 }
@@ -34,6 +45,7 @@ type getStatusResponse struct {
 		AvailableSizes      []string `json:"available_sizes"`
 		UploadFileTypes     string   `json:"upload_file_types"`
 		UploadFormChunkSize int      `json:"upload_form_chunk_size"`
+		UploadMaxFilesize   phpSize  `json:"upload_max_filesize"`
 	} `json:"result"`
 }
 
@@ -113,6 +125,15 @@ func (r fileAddResponse) responseStatus() string {
 	return r.Status
 }
 
+type setInfoResponse struct {
+	Status string      `json:"stat"`
+	Result interface{} `json:"result"`
+}
+
+func (r setInfoResponse) responseStatus() string {
+	return r.Status
+}
+
 type imageExistResponse struct {
 	Status string            `json:"stat"`
 	Result map[string]string `json:"result"`
@@ -139,3 +160,188 @@ type deleteResponse struct {
 func (r deleteResponse) responseStatus() string {
 	return r.Status
 }
+
+type deleteCategoryResponse struct {
+	Status string      `json:"stat"`
+	Result interface{} `json:"result"`
+}
+
+func (r deleteCategoryResponse) responseStatus() string {
+	return r.Status
+}
+
+type moveCategoryResponse struct {
+	Status string      `json:"stat"`
+	Result interface{} `json:"result"`
+}
+
+func (r moveCategoryResponse) responseStatus() string {
+	return r.Status
+}
+
+type setCategoryRankResponse struct {
+	Status string      `json:"stat"`
+	Result interface{} `json:"result"`
+}
+
+func (r setCategoryRankResponse) responseStatus() string {
+	return r.Status
+}
+
+type setCategoryRepresentativeResponse struct {
+	Status string      `json:"stat"`
+	Result interface{} `json:"result"`
+}
+
+func (r setCategoryRepresentativeResponse) responseStatus() string {
+	return r.Status
+}
+
+type imageInfoResponse struct {
+	Status string `json:"stat"`
+	Result struct {
+		ID            int         `json:"id"`
+		File          string      `json:"file"`
+		Name          string      `json:"name"`
+		Md5Sum        string      `json:"md5sum"`
+		DateAvailable string      `json:"date_available"`
+		DateCreation  string      `json:"date_creation"`
+		Filesize      flexibleInt `json:"filesize"`
+		Width         flexibleInt `json:"width"`
+		Height        flexibleInt `json:"height"`
+		ElementURL    string      `json:"element_url"`
+		Categories    []struct {
+			ID int `json:"id"`
+		} `json:"categories"`
+		Derivatives map[string]struct {
+			URL string `json:"url"`
+		} `json:"derivatives"`
+	} `json:"result"`
+}
+
+func (r imageInfoResponse) responseStatus() string {
+	return r.Status
+}
+
+type categoryImagesResponse struct {
+	Status string `json:"stat"`
+	Result struct {
+		Paging struct {
+			Page    int `json:"page"`
+			PerPage int `json:"per_page"`
+			Count   int `json:"count"`
+		} `json:"paging"`
+		Images []struct {
+			ID            int    `json:"id"`
+			DateAvailable string `json:"date_available"`
+		} `json:"images"`
+	} `json:"result"`
+}
+
+func (r categoryImagesResponse) responseStatus() string {
+	return r.Status
+}
+
+type tagListResponse struct {
+	Status string `json:"stat"`
+	Result struct {
+		Tags []struct {
+			ID   flexibleInt `json:"id"`
+			Name string      `json:"name"`
+		} `json:"tags"`
+	} `json:"result"`
+}
+
+func (r tagListResponse) responseStatus() string {
+	return r.Status
+}
+
+type addTagResponse struct {
+	Status string `json:"stat"`
+	Result struct {
+		Info string      `json:"info"`
+		ID   flexibleInt `json:"id"`
+	} `json:"result"`
+}
+
+func (r addTagResponse) responseStatus() string {
+	return r.Status
+}
+
+// Piwigo returns some numeric values as string or null depending on the version and the database.
+type flexibleInt int
+
+func (i *flexibleInt) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*i = flexibleInt(v)
+	case string:
+		if v == "" {
+			*i = 0
+			return nil
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*i = flexibleInt(parsed)
+	default:
+		*i = 0
+	}
+	return nil
+}
+
+// A size in bytes the server reports either as number or in the shorthand notation of php like 8M or 2G.
+type phpSize int64
+
+func (size *phpSize) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*size = phpSize(v)
+	case string:
+		parsed, err := parsePhpSize(v)
+		if err != nil {
+			return err
+		}
+		*size = phpSize(parsed)
+	default:
+		*size = 0
+	}
+	return nil
+}
+
+func parsePhpSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch value[len(value)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return parsed * multiplier, nil
+}
@@ -6,28 +6,60 @@
 package piwigo
 
 import (
+	"bytes"
+	gocontext "context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
 	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
+// the number of images loaded per request while listing the images of a category
+const categoryImagesPageSize = 500
+
+// the number of characters of an unexpected response shown in its error
+const responseSnippetLength = 200
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
 type CategoryApi interface {
 	GetAllCategories() (map[string]*Category, error)
 	CreateCategory(parentId int, name string) (int, error)
+	CreateCategoryWithSettings(parentId int, name string, settings CategorySettings) (int, error)
+	MoveCategory(categoryId int, parentId int) error
+	SetCategoryRank(categoryId int, rank int) error
+	SetCategoryRepresentative(categoryId int, imageId int) error
+	DeleteCategory(categoryId int) error
 }
 
 type ImageApi interface {
 	ImageCheckFile(piwigoId int, md5sum string) (int, error)
 	ImagesExistOnPiwigo(md5sums []string) (map[string]int, error)
-	UploadImage(piwigoId int, filePath string, md5sum string, category int) (int, error)
+	GetImageInfo(piwigoId int) (*ImageInfo, error)
+	UploadImage(piwigoId int, filePath string, md5sum string, category int, correlationId string) (UploadResult, error)
+	UploadFormat(imageId int, filePath string, correlationId string) error
+	UpdateImagesInfo(updates []ImageInfoUpdate, parallelRequests int) (ImageInfoUpdateResult, error)
+	GenerateDerivatives(piwigoId int) error
 	DeleteImages(imageIds []int) error
+	GetCategoryImages(categoryId int) ([]int, error)
+	LatestCategoryImageDate(categoryId int) (time.Time, bool, error)
+	GetOrCreateTags(names []string) (map[string]int, error)
+	DownloadImage(piwigoId int, writer io.Writer) (int64, error)
+	DownloadImageRanges(piwigoId int, ranges []ByteRange) ([][]byte, int64, error)
 }
 
 type ServerContext struct {
@@ -36,29 +68,245 @@ type ServerContext struct {
 	password      string
 	chunkSizeInKB int
 	cookies       *cookiejar.Jar
+	transport     *http.Transport
+	// the jar is created by the first request, which may be sent by one of several parallel workers
+	cookiesOnce sync.Once
+	// the derivative sizes configured on the server
+	availableSizes []string
+	// the maximum file size of uploads reported by the server, zero if it does not report one
+	maxUploadSizeInBytes int64
+	// all requests get cancelled as soon as this context is done
+	baseContext    gocontext.Context
+	requestTimeout time.Duration
+	// how the original filename of uploads gets cleaned up
+	filenameMode       string
+	lowercaseFilenames bool
+	// sent with every request, e.g. to pass a reverse proxy
+	userAgent string
+	headers   http.Header
+	// logs the form values of every request at trace level
+	dumpRequests bool
+	// the type parameter of the chunk uploads, empty uses defaultChunkType
+	chunkType string
+	// how interrupted uploads continue and where their chunks are remembered, see UsePartialUploads
+	partialUploads string
+	chunkProgress  ChunkProgressStore
+	// limits the bytes per second of the chunk uploads, nil uploads at full speed
+	bandwidth *BandwidthLimiter
+	// the durations of the uploaded chunks to warn about slow ones, nil does not time the chunks
+	chunkTimings *chunkTimings
+	// measures the size of the requests the server accepts after the login, see UseAutoTunedUpload
+	autoTuneUpload bool
+	// the time zone the server interprets the dates in, nil uses the local time zone
+	timezone *time.Location
+	// slows down the requests while the server throttles them, nil does not retry throttled requests
+	throttle *requestThrottle
+	// the only categories that get changed, nil manages all categories
+	managed *managedCategories
+	// the keys of the local directories by the key of their categories that got another name, see UseLocalCategoryKeys
+	localKeys map[string]string
 }
 
 func (context *ServerContext) Initialize(baseUrl string, username string, password string) error {
-	if baseUrl == "" {
-		return errors.New("please provide a valid piwigo server base URL")
+	if username == "" {
+		return errors.New("please provide a valid username for the given piwigo server")
 	}
-	_, err := url.Parse(baseUrl)
+
+	err := context.initializeServer(baseUrl)
 	if err != nil {
 		return err
 	}
 
-	if username == "" {
-		return errors.New("please provide a valid username for the given piwigo server")
-	}
-
-	context.url = fmt.Sprintf("%s/ws.php?format=json", baseUrl)
 	context.username = username
 	context.password = password
+
+	return nil
+}
+
+// Initializes the context with an existing session instead of logging in, e.g. a session cookie copied from the browser
+// where the login uses single sign on or two factor authentication. The cookie may be given as "name=value" or as the
+// value of the piwigo session cookie "pwg_id". Call VerifySession instead of Login to check the session.
+func (context *ServerContext) InitializeWithSessionCookie(baseUrl string, sessionCookie string) error {
+	if sessionCookie == "" {
+		return errors.New("please provide the session cookie to use an existing session")
+	}
+
+	err := context.initializeServer(baseUrl)
+	if err != nil {
+		return err
+	}
+
+	serverUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		return err
+	}
+
+	name, value := "pwg_id", strings.TrimSpace(sessionCookie)
+	if separator := strings.Index(value, "="); separator > 0 {
+		name, value = value[:separator], value[separator+1:]
+	}
+
+	context.initializeCookieJarIfRequired()
+	context.cookies.SetCookies(serverUrl, []*http.Cookie{{Name: name, Value: value, Path: "/"}})
+	return nil
+}
+
+func (context *ServerContext) initializeServer(baseUrl string) error {
+	serviceUrl, err := buildServiceUrl(baseUrl)
+	if err != nil {
+		return err
+	}
+
+	context.url = serviceUrl
 	context.chunkSizeInKB = 512
+	context.transport = http.DefaultTransport.(*http.Transport).Clone()
+	context.baseContext = gocontext.Background()
+	context.throttle = newRequestThrottle()
+	return nil
+}
+
+// Uses the given context as parent of all requests. Cancelling it aborts the requests in flight,
+// including running uploads.
+func (context *ServerContext) UseContext(ctx gocontext.Context) {
+	context.baseContext = ctx
+}
+
+// Sets the deadline of a single request to the server. Zero disables the timeout.
+func (context *ServerContext) UseRequestTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		logrus.Infof("Using a timeout of %s for every request to the server", timeout)
+	}
+	context.requestTimeout = timeout
+}
+
+// Sets how many idle connections are kept open to reuse them for later requests. The defaults of the http transport
+// only keep two idle connections per server, so more parallel requests open a new connection most of the time.
+// It has to be called after Initialize.
+func (context *ServerContext) UseConnectionPool(maxIdleConns int, maxIdleConnsPerHost int, idleConnTimeout time.Duration) error {
+	if maxIdleConns < 0 || maxIdleConnsPerHost < 0 || idleConnTimeout < 0 {
+		return errors.New(fmt.Sprintf("the connection pool settings must not be negative: maxIdleConns %d, maxIdleConnsPerHost %d, idleConnTimeout %s", maxIdleConns, maxIdleConnsPerHost, idleConnTimeout))
+	}
+	if context.transport == nil {
+		return errors.New("the server context has to be initialized before configuring the connection pool")
+	}
+
+	logrus.Debugf("Keeping up to %d idle connections, %d per server, for %s", maxIdleConns, maxIdleConnsPerHost, idleConnTimeout)
+	context.transport.MaxIdleConns = maxIdleConns
+	context.transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	context.transport.IdleConnTimeout = idleConnTimeout
+	return nil
+}
+
+// Sets the user agent and the additional headers given as "Key: Value" that are sent with every request.
+func (context *ServerContext) UseHeaders(userAgent string, headers []string) error {
+	parsed := http.Header{}
+	for _, header := range headers {
+		key, value, err := ParseHeader(header)
+		if err != nil {
+			return err
+		}
+		parsed.Add(key, value)
+	}
+	if strings.ContainsAny(userAgent, "\r\n") {
+		return errors.New("the user agent must not contain line breaks")
+	}
+
+	context.userAgent = userAgent
+	context.headers = parsed
+	return nil
+}
+
+// Sets how the original filename of an uploaded image is sanitized before it is sent to the server.
+func (context *ServerContext) UseFilenameMode(mode string, preserveCase bool) error {
+	if _, err := SanitizeFilename("", mode, preserveCase); err != nil {
+		return err
+	}
+	context.filenameMode = mode
+	context.lowercaseFilenames = !preserveCase
+	return nil
+}
+
+// Sets the time zone the dates read from the server are interpreted in, as piwigo stores them without a time zone.
+// Nil uses the local time zone.
+func (context *ServerContext) UseTimezone(zone *time.Location) {
+	context.timezone = zone
+}
+
+// Sets the type parameter sent with every chunk of an upload. Core piwigo ignores it and only requires it for
+// compatibility, but some plugins handle the chunks depending on it.
+func (context *ServerContext) UseChunkType(chunkType string) error {
+	if strings.TrimSpace(chunkType) == "" {
+		return errors.New("the chunk type must not be empty")
+	}
+	if chunkType != defaultChunkType {
+		logrus.Infof("Uploading the chunks with the type %s", chunkType)
+	}
+	context.chunkType = chunkType
+	return nil
+}
+
+// Creates the context of a single request. The returned cancel function has to be called after the request.
+func (context *ServerContext) newRequestContext() (gocontext.Context, gocontext.CancelFunc) {
+	ctx := context.baseContext
+	if ctx == nil {
+		ctx = gocontext.Background()
+	}
+	if context.requestTimeout <= 0 {
+		return gocontext.WithCancel(ctx)
+	}
+	return gocontext.WithTimeout(ctx, context.requestTimeout)
+}
+
+// Loads the client certificate and the matching key to present them on every request. This is required if the
+// server is protected by mutual TLS authentication. It has to be called after Initialize.
+func (context *ServerContext) UseClientCertificate(certFile string, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		return errors.New("please provide the client certificate and the key file to use client certificate authentication")
+	}
+	if context.transport == nil {
+		return errors.New("the server context has to be initialized before adding a client certificate")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not load client certificate %s with key %s: %s", certFile, keyFile, err))
+	}
+
+	if context.transport.TLSClientConfig == nil {
+		context.transport.TLSClientConfig = &tls.Config{}
+	}
+	context.transport.TLSClientConfig.Certificates = append(context.transport.TLSClientConfig.Certificates, certificate)
 
+	logrus.Infof("Using client certificate %s for authentication", certFile)
 	return nil
 }
 
+// Returns the maximum file size of uploads in megabytes the server reported at the login. Zero is returned if the
+// server does not report upload_max_filesize in its status.
+func (context *ServerContext) MaxUploadSizeInMB() int {
+	return int(context.maxUploadSizeInBytes / 1024 / 1024)
+}
+
+// Builds the url of the web service of the piwigo installation at the given url. Installations in a sub path like
+// https://example.com/gallery are supported and trailing slashes or an included ws.php are removed.
+func buildServiceUrl(baseUrl string) (string, error) {
+	serverUrl, err := url.Parse(strings.TrimSpace(baseUrl))
+	if err != nil {
+		return "", err
+	}
+	if baseUrl == "" || (serverUrl.Scheme != "http" && serverUrl.Scheme != "https") || serverUrl.Host == "" {
+		return "", errors.New(fmt.Sprintf("please provide a valid piwigo server base URL like https://example.com/gallery instead of %q", baseUrl))
+	}
+
+	basePath := strings.TrimRight(serverUrl.Path, "/")
+	basePath = strings.TrimSuffix(basePath, "/ws.php")
+	serverUrl.Path = strings.TrimRight(basePath, "/") + "/ws.php"
+	serverUrl.RawPath = ""
+	serverUrl.RawQuery = "format=json"
+	serverUrl.Fragment = ""
+	return serverUrl.String(), nil
+}
+
 func (context *ServerContext) Login() error {
 	logrus.Infoln("Logging in to piwigo and getting chunk size configuration for uploads")
 	logrus.Debugf("Logging in to %s using user %s", context.url, context.username)
@@ -73,17 +321,34 @@ func (context *ServerContext) Login() error {
 	formData.Set("password", context.password)
 
 	var response loginResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
-		errorMessage := fmt.Sprintf("Login failed: %d - %s", response.ErrorNumber, response.Message)
-		logrus.Errorln(errorMessage)
-		return errors.New(errorMessage)
+		logrus.Errorf("Login failed: %s", err)
+		return fmt.Errorf("login failed - %w", err)
 	}
 
 	logrus.Infof("Login succeeded: %s", response.Status)
 	return context.initializeUploadChunkSize()
 }
 
+// Checks if the existing session is still logged in. Anonymous sessions are rejected.
+func (context *ServerContext) VerifySession() error {
+	status, err := context.getStatus()
+	if err != nil {
+		return err
+	}
+
+	if status.Result.Username == "" || status.Result.Username == "guest" {
+		return errors.New("the session is not logged in. The session cookie may be invalid or expired")
+	}
+
+	context.username = status.Result.Username
+	logrus.Infof("Using the existing session of user %s", context.username)
+	return nil
+}
+
 func (context *ServerContext) Logout() error {
 	logrus.Debugf("Logging out from %s", context.url)
 
@@ -91,7 +356,9 @@ func (context *ServerContext) Logout() error {
 	formData.Set("method", "pwg.session.logout")
 
 	var response logoutResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
 		logrus.Errorf("Logout from %s failed", context.url)
 		return err
@@ -108,37 +375,63 @@ func (context *ServerContext) getStatus() (*getStatusResponse, error) {
 	formData.Set("method", "pwg.session.getStatus")
 
 	var response getStatusResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
-		errorMessage := fmt.Sprintln("Could not get session state from server")
-		logrus.Errorln(errorMessage)
-		return nil, errors.New(errorMessage)
+		logrus.Errorf("Could not get session state from server: %s", err)
+		return nil, fmt.Errorf("could not get session state from server - %w", err)
 	}
 
 	return &response, nil
 }
 
+// Returns the categories by key. Only the managed categories and their parents are returned.
 func (context *ServerContext) GetAllCategories() (map[string]*Category, error) {
+	categories, err := context.loadCategories()
+	if err != nil {
+		return nil, err
+	}
+	return buildLookupMap(context.visibleCategories(categories)), nil
+}
+
+func (context *ServerContext) loadCategories() (map[int]*Category, error) {
 	formData := url.Values{}
 	formData.Set("method", "pwg.categories.getList")
 	formData.Set("recursive", "true")
 
 	var response getCategoryListResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
 		logrus.Errorf("Got error while loading categories: %s", err)
-		return nil, errors.New("could not load categories")
+		return nil, fmt.Errorf("could not load categories - %w", err)
 	}
 
 	logrus.Infof("Successfully got all categories")
 	categories := buildCategoryMap(&response)
 	buildCategoryKeys(categories)
-	categoryLookups := buildLookupMap(categories)
-
-	return categoryLookups, nil
+	context.applyLocalCategoryKeys(categories)
+	return categories, nil
 }
 
 func (context *ServerContext) CreateCategory(parentId int, name string) (int, error) {
+	return context.CreateCategoryWithSettings(parentId, name, CategorySettings{})
+}
+
+// Creates the category with the given status and comment setting. Settings that are not set use the defaults
+// configured on the server.
+func (context *ServerContext) CreateCategoryWithSettings(parentId int, name string, settings CategorySettings) (int, error) {
+	err := settings.validate()
+	if err != nil {
+		return 0, err
+	}
+	key, err := context.requireManagedChild(parentId, name)
+	if err != nil {
+		return 0, err
+	}
+
 	formData := url.Values{}
 	formData.Set("method", "pwg.categories.add")
 	formData.Set("name", name)
@@ -147,18 +440,110 @@ func (context *ServerContext) CreateCategory(parentId int, name string) (int, er
 	if parentId > 0 {
 		formData.Set("parent", fmt.Sprint(parentId))
 	}
+	if settings.Status != "" {
+		formData.Set("status", settings.Status)
+	}
+	if settings.Commentable != nil {
+		formData.Set("commentable", strconv.FormatBool(*settings.Commentable))
+	}
 
 	var response createCategoryResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
 		logrus.Errorln(err)
 		return 0, err
 	}
 
 	logrus.Infof("Successfully created category %s with id %d", name, response.Result.ID)
+	if context.managed != nil {
+		context.managed.addCategory(response.Result.ID, key)
+	}
 	return response.Result.ID, nil
 }
 
+// Moves the category including its images and sub categories below the given parent. A parent id of zero
+// moves the category to the root.
+func (context *ServerContext) MoveCategory(categoryId int, parentId int) error {
+	err := context.requireManagedMove(categoryId, parentId)
+	if err != nil {
+		return err
+	}
+
+	pwgToken, err := context.getPiwigoToken()
+	if err != nil {
+		return err
+	}
+
+	formData := url.Values{}
+	formData.Set("method", "pwg.categories.move")
+	formData.Set("category_id", strconv.Itoa(categoryId))
+	formData.Set("parent", strconv.Itoa(parentId))
+	formData.Set("pwg_token", pwgToken)
+
+	var response moveCategoryResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		logrus.Errorln(err)
+		return err
+	}
+
+	logrus.Infof("Successfully moved category %d below %d", categoryId, parentId)
+	return nil
+}
+
+// Sets the position of the category between its siblings. The ranks start at 1.
+func (context *ServerContext) SetCategoryRank(categoryId int, rank int) error {
+	err := context.requireManagedCategory(categoryId)
+	if err != nil {
+		return err
+	}
+
+	formData := url.Values{}
+	formData.Set("method", "pwg.categories.setRank")
+	formData.Set("category_id", strconv.Itoa(categoryId))
+	formData.Set("rank", strconv.Itoa(rank))
+
+	var response setCategoryRankResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		logrus.Errorln(err)
+		return err
+	}
+
+	logrus.Debugf("Set rank of category %d to %d", categoryId, rank)
+	return nil
+}
+
+func (context *ServerContext) SetCategoryRepresentative(categoryId int, imageId int) error {
+	err := context.requireManagedCategory(categoryId)
+	if err != nil {
+		return err
+	}
+
+	formData := url.Values{}
+	formData.Set("method", "pwg.categories.setRepresentative")
+	formData.Set("category_id", strconv.Itoa(categoryId))
+	formData.Set("image_id", strconv.Itoa(imageId))
+
+	var response setCategoryRepresentativeResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		logrus.Errorln(err)
+		return err
+	}
+
+	logrus.Debugf("Set representative of category %d to image %d", categoryId, imageId)
+	return nil
+}
+
 func (context *ServerContext) ImageCheckFile(piwigoId int, md5sum string) (int, error) {
 	formData := url.Values{}
 	formData.Set("method", "pwg.images.checkFiles")
@@ -168,7 +553,9 @@ func (context *ServerContext) ImageCheckFile(piwigoId int, md5sum string) (int,
 	logrus.Tracef("Checking if file %s - %d needs to be uploaded", md5sum, piwigoId)
 
 	var response checkFilesResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
 		return imageStateInvalid, err
 	}
@@ -179,7 +566,56 @@ func (context *ServerContext) ImageCheckFile(piwigoId int, md5sum string) (int,
 	return ImageStateDifferent, nil
 }
 
+func (context *ServerContext) GetImageInfo(piwigoId int) (*ImageInfo, error) {
+	formData := url.Values{}
+	formData.Set("method", "pwg.images.getInfo")
+	formData.Set("image_id", strconv.Itoa(piwigoId))
+
+	logrus.Tracef("Getting image info of image %d", piwigoId)
+
+	var response imageInfoResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ImageInfo{
+		Id:            response.Result.ID,
+		File:          response.Result.File,
+		Name:          response.Result.Name,
+		Md5Sum:        response.Result.Md5Sum,
+		DateAvailable: response.Result.DateAvailable,
+		DateCreation:  response.Result.DateCreation,
+		Filesize:      int(response.Result.Filesize),
+		Width:         int(response.Result.Width),
+		Height:        int(response.Result.Height),
+		ElementUrl:    response.Result.ElementURL,
+		CategoryIds:   make([]int, 0, len(response.Result.Categories)),
+	}
+	for _, category := range response.Result.Categories {
+		info.CategoryIds = append(info.CategoryIds, category.ID)
+	}
+
+	return info, nil
+}
+
+// Returns the ids of the images with the given md5sums, zero if there is none. Images outside of the managed
+// categories are reported as missing.
 func (context *ServerContext) ImagesExistOnPiwigo(md5sums []string) (map[string]int, error) {
+	existResults, err := context.imagesExistOnPiwigo(md5sums)
+	if err != nil {
+		return nil, err
+	}
+	err = context.visibleImages(existResults)
+	if err != nil {
+		return nil, err
+	}
+	return existResults, nil
+}
+
+func (context *ServerContext) imagesExistOnPiwigo(md5sums []string) (map[string]int, error) {
 	existResults := make(map[string]int, len(md5sums))
 
 	batchSize := 2000
@@ -207,7 +643,9 @@ func (context *ServerContext) imagesExistOnPiwigoBatch(md5sums []string, existRe
 	logrus.Tracef("Looking up if files exist: %s", md5sumList)
 
 	var response imageExistResponse
-	err := context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
 	if err != nil {
 		return err
 	}
@@ -231,43 +669,189 @@ func (context *ServerContext) imagesExistOnPiwigoBatch(md5sums []string, existRe
 	return nil
 }
 
-func (context *ServerContext) UploadImage(piwigoId int, filePath string, md5sum string, category int) (int, error) {
+// Uploads the image to the given category. New images with a md5sum that already exists on the server are not
+// uploaded again, the existing image is assigned to the category instead.
+func (context *ServerContext) UploadImage(piwigoId int, filePath string, md5sum string, category int, correlationId string) (UploadResult, error) {
 	if context.chunkSizeInKB <= 0 {
-		return 0, errors.New("uploadchunk size is less or equal to zero. 512 is a recommendet value to begin with")
+		return UploadResult{}, errors.New("uploadchunk size is less or equal to zero. 512 is a recommendet value to begin with")
+	}
+	err := context.requireManagedCategory(category)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if piwigoId > 0 {
+		err = context.requireManagedImages([]int{piwigoId})
+		if err != nil {
+			return UploadResult{}, err
+		}
 	}
 
-	fileInfo, err := os.Stat(filePath)
+	fileInfo, err := localFileStructure.Stat(filePath)
 	if err != nil {
-		return 0, err
+		return UploadResult{}, err
+	}
+
+	if piwigoId == 0 {
+		existingId, err := context.findExistingImage(md5sum)
+		if err != nil {
+			return UploadResult{}, err
+		}
+		if existingId > 0 {
+			CorrelationLog(correlationId).Infof("%s already exists on the server as image %d, adding it to category %d", filePath, existingId, category)
+			err = addImageToCategory(context, existingId, category, correlationId)
+			if err != nil {
+				return UploadResult{}, err
+			}
+			if context.managed != nil {
+				context.managed.forgetImage(existingId)
+			}
+			return UploadResult{ImageId: existingId, MatchedExisting: true}, nil
+		}
 	}
 
-	fileSizeInKB := fileInfo.Size() / 1024
-	logrus.Infof("Uploading %s using chunksize of %d KB and total size of %d KB", filePath, context.chunkSizeInKB, fileSizeInKB)
+	CorrelationLog(correlationId).Infof("Uploading %s using chunksize of %d KB and total size of %d KB", filePath, context.chunkSizeInKB, fileInfo.Size()/1024)
 
-	err = uploadImageChunks(filePath, context, fileSizeInKB, md5sum)
+	resumed, err := uploadImageChunks(filePath, context, fileInfo.Size(), md5sum, correlationId, context.partialUploads == PartialUploadResume)
 	if err != nil {
-		return 0, err
+		return UploadResult{}, err
+	}
+
+	imageId, err := uploadImageFinal(context, piwigoId, fileInfo.Name(), md5sum, category, correlationId)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	if resumed {
+		// the skipped chunks are only known by the progress store, so the merged file is checked by the server
+		state, err := context.ImageCheckFile(imageId, md5sum)
+		if err != nil {
+			return UploadResult{}, err
+		}
+		if state != ImageStateUptodate {
+			CorrelationLog(correlationId).Warnf("The resumed upload of %s does not match the file, uploading all chunks again", filePath)
+			context.clearChunkProgress(md5sum, CorrelationLog(correlationId))
+			_, err = uploadImageChunks(filePath, context, fileInfo.Size(), md5sum, correlationId, false)
+			if err != nil {
+				return UploadResult{}, err
+			}
+			imageId, err = uploadImageFinal(context, imageId, fileInfo.Name(), md5sum, category, correlationId)
+			if err != nil {
+				return UploadResult{}, err
+			}
+		}
+	}
+	context.clearChunkProgress(md5sum, CorrelationLog(correlationId))
+	if context.managed != nil && piwigoId == 0 {
+		context.managed.setImage(imageId, true)
 	}
 
-	imageId, err := uploadImageFinal(context, piwigoId, fileInfo.Name(), md5sum, category)
+	return UploadResult{ImageId: imageId}, nil
+}
+
+func (context *ServerContext) findExistingImage(md5sum string) (int, error) {
+	// the images outside of the managed categories are not taken over, the content is uploaded as a new image instead
+	existingImages, err := context.ImagesExistOnPiwigo([]string{md5sum})
 	if err != nil {
 		return 0, err
 	}
+	return existingImages[md5sum], nil
+}
 
-	return imageId, nil
+// Requests all derivatives of the image in the sizes available on the server, so piwigo generates them right away
+// instead of on the first view.
+func (context *ServerContext) GenerateDerivatives(piwigoId int) error {
+	return generateDerivatives(context, piwigoId)
+}
+
+// Returns the ids of all images directly assigned to the given category. The images of sub categories are not included.
+func (context *ServerContext) GetCategoryImages(categoryId int) ([]int, error) {
+	err := context.requireManagedCategory(categoryId)
+	if err != nil {
+		return nil, err
+	}
+
+	imageIds := make([]int, 0)
+	for page := 0; ; page++ {
+		formData := url.Values{}
+		formData.Set("method", "pwg.categories.getImages")
+		formData.Set("cat_id", strconv.Itoa(categoryId))
+		formData.Set("recursive", "false")
+		formData.Set("per_page", strconv.Itoa(categoryImagesPageSize))
+		formData.Set("page", strconv.Itoa(page))
+
+		var response categoryImagesResponse
+		ctx, cancel := context.newRequestContext()
+		err := context.executePiwigoRequest(ctx, formData, &response)
+		cancel()
+		if err != nil {
+			logrus.Errorf("Got error while loading the images of category %d: %s", categoryId, err)
+			return nil, fmt.Errorf("could not load the images of category %d - %w", categoryId, err)
+		}
+
+		for _, image := range response.Result.Images {
+			imageIds = append(imageIds, image.ID)
+		}
+		if len(response.Result.Images) < categoryImagesPageSize {
+			return imageIds, nil
+		}
+	}
+}
+
+// Returns the date the latest image got added to the given category. Only the newest image is requested by ordering
+// by the date. Returns false if the category has no images.
+func (context *ServerContext) LatestCategoryImageDate(categoryId int) (time.Time, bool, error) {
+	err := context.requireManagedCategory(categoryId)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	formData := url.Values{}
+	formData.Set("method", "pwg.categories.getImages")
+	formData.Set("cat_id", strconv.Itoa(categoryId))
+	formData.Set("recursive", "false")
+	formData.Set("order", "date_available DESC")
+	formData.Set("per_page", "1")
+	formData.Set("page", "0")
+
+	var response categoryImagesResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		logrus.Errorf("Got error while loading the latest image of category %d: %s", categoryId, err)
+		return time.Time{}, false, fmt.Errorf("could not load the latest image of category %d - %w", categoryId, err)
+	}
+
+	if len(response.Result.Images) == 0 || response.Result.Images[0].DateAvailable == "" {
+		return time.Time{}, false, nil
+	}
+	zone := time.Local
+	if context.timezone != nil {
+		zone = context.timezone
+	}
+	latest, err := time.ParseInLocation(piwigoDateFormat, response.Result.Images[0].DateAvailable, zone)
+	if err != nil {
+		return time.Time{}, false, errors.New(fmt.Sprintf("could not parse the date %s of the latest image of category %d", response.Result.Images[0].DateAvailable, categoryId))
+	}
+	return latest, true, nil
 }
 
 func (context *ServerContext) DeleteImages(imageIds []int) error {
 	logrus.Debug("Entering DeleteImages")
 	defer logrus.Debug("Leaving DeleteImages")
 
+	err := context.requireManagedImages(imageIds)
+	if err != nil {
+		return err
+	}
+
 	pwgToken, err := context.getPiwigoToken()
 	if err != nil {
 		return err
 	}
 
-	parts := make([]string, len(imageIds))
-	for id := range imageIds {
+	parts := make([]string, 0, len(imageIds))
+	for _, id := range imageIds {
 		parts = append(parts, strconv.Itoa(id))
 	}
 	joinedIds := strings.Join(parts, "|")
@@ -280,7 +864,35 @@ func (context *ServerContext) DeleteImages(imageIds []int) error {
 	formData.Set("pwg_token", pwgToken)
 
 	var response deleteResponse
-	return context.executePiwigoRequest(formData, &response)
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	return context.executePiwigoRequest(ctx, formData, &response)
+}
+
+// Deletes the category and its sub categories. The images are kept, images only assigned to the category get orphans.
+func (context *ServerContext) DeleteCategory(categoryId int) error {
+	err := context.requireManagedCategory(categoryId)
+	if err != nil {
+		return err
+	}
+
+	pwgToken, err := context.getPiwigoToken()
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Deleting category %d", categoryId)
+
+	formData := url.Values{}
+	formData.Set("method", "pwg.categories.delete")
+	formData.Set("category_id", strconv.Itoa(categoryId))
+	formData.Set("photo_deletion_mode", "no_delete")
+	formData.Set("pwg_token", pwgToken)
+
+	var response deleteCategoryResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	return context.executePiwigoRequest(ctx, formData, &response)
 }
 
 func (context *ServerContext) getPiwigoToken() (string, error) {
@@ -294,19 +906,21 @@ func (context *ServerContext) getPiwigoToken() (string, error) {
 	}
 	pwgToken := status.Result.PwgToken
 	if pwgToken == "" {
-		return "", errors.New("did not get a valid piwigo token. Could not delete the images")
+		return "", errors.New("did not get a valid piwigo token")
 	}
 	return pwgToken, nil
 }
 
 func (context *ServerContext) initializeCookieJarIfRequired() {
-	if context.cookies != nil {
-		return
-	}
+	context.cookiesOnce.Do(func() {
+		if context.cookies != nil {
+			return
+		}
 
-	options := cookiejar.Options{}
-	jar, _ := cookiejar.New(&options)
-	context.cookies = jar
+		options := cookiejar.Options{}
+		jar, _ := cookiejar.New(&options)
+		context.cookies = jar
+	})
 }
 
 func (context *ServerContext) initializeUploadChunkSize() error {
@@ -314,30 +928,149 @@ func (context *ServerContext) initializeUploadChunkSize() error {
 	if err != nil {
 		return err
 	}
+	if userStatus.Result.UploadFormChunkSize <= 0 {
+		errorMessage := fmt.Sprintf("The server %s does not report a chunk size for uploads (upload_form_chunk_size is %d). "+
+			"Make sure the user %s is an administrator as piwigo only reports the upload configuration to administrators "+
+			"and check the configured chunk size of the upload form (upload_form_chunk_size) on the server.",
+			context.url, userStatus.Result.UploadFormChunkSize, context.username)
+		logrus.Errorln(errorMessage)
+		return errors.New(errorMessage)
+	}
+
 	context.chunkSizeInKB = userStatus.Result.UploadFormChunkSize
-	logrus.Debugf("Got chunksize of %d KB from server.", context.chunkSizeInKB)
+	context.availableSizes = userStatus.Result.AvailableSizes
+	context.maxUploadSizeInBytes = int64(userStatus.Result.UploadMaxFilesize)
+	logrus.Debugf("Got chunksize of %d KB, the maximum upload size of %d bytes and the sizes %v from server.", context.chunkSizeInKB, context.maxUploadSizeInBytes, context.availableSizes)
+	if context.autoTuneUpload {
+		context.tuneUploadChunkSize()
+	}
 	return nil
 }
 
-func (context *ServerContext) executePiwigoRequest(formData url.Values, decodedResponse responseStatuser) error {
+func (context *ServerContext) executePiwigoRequest(ctx gocontext.Context, formData url.Values, decodedResponse responseStatuser) error {
+	context.dumpRequest(formData, 0)
+	encoded := formData.Encode()
+	return context.executePiwigoStreamRequest(ctx, formData.Get("method"), func() io.Reader { return strings.NewReader(encoded) }, decodedResponse)
+}
+
+// Creates a client sharing the session cookies and the transport of this context.
+func (context *ServerContext) newHttpClient() http.Client {
 	context.initializeCookieJarIfRequired()
 
 	client := http.Client{Jar: context.cookies}
-	response, err := client.PostForm(context.url, formData)
+	if context.transport != nil {
+		client.Transport = context.transport
+	}
+	return client
+}
+
+// Creates the body of a request and returns it with its content type. It is called again for every retry of a
+// throttled request, as the body of the previous attempt is already consumed.
+type requestBody func() (io.Reader, string)
+
+// Posts the url encoded form read from the body to the server and decodes the response.
+// The request is aborted as soon as the given context is done. A failed request returns a *PiwigoError.
+func (context *ServerContext) executePiwigoStreamRequest(ctx gocontext.Context, method string, newBody func() io.Reader, decodedResponse responseStatuser) error {
+	return context.executePiwigoBodyRequest(ctx, method, func() (io.Reader, string) {
+		return newBody(), "application/x-www-form-urlencoded"
+	}, decodedResponse)
+}
+
+// Sends the request again as long as the server answers it with 429 Too Many Requests, waiting as told by its
+// Retry-After header. Gives up after maxThrottledRetries with ErrorThrottled.
+func (context *ServerContext) executePiwigoBodyRequest(ctx gocontext.Context, method string, newBody requestBody, decodedResponse responseStatuser) error {
+	for attempt := 0; ; attempt++ {
+		err := context.throttle.wait(ctx)
+		if err != nil {
+			return err
+		}
+
+		body, contentType := newBody()
+		response, err := context.sendRequest(ctx, body, contentType)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusTooManyRequests {
+			context.throttle.succeeded()
+			return context.decodeResponse(method, response, decodedResponse)
+		}
+		_ = response.Body.Close()
+
+		if context.throttle == nil || attempt >= maxThrottledRetries {
+			return fmt.Errorf("%s: %w after %d retries", method, ErrorThrottled, attempt)
+		}
+		delay := parseRetryAfter(response.Header.Get("Retry-After"), context.throttle.now())
+		logrus.Warnf("The server is throttling the requests, sending %s again in %s (%d of %d)", method, delay, attempt+1, maxThrottledRetries)
+		context.throttle.throttled(delay)
+	}
+}
+
+func (context *ServerContext) sendRequest(ctx gocontext.Context, body io.Reader, contentType string) (*http.Response, error) {
+	client := context.newHttpClient()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, context.url, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	context.addRequestHeaders(request)
+	request.Header.Set("Content-Type", contentType)
+	return client.Do(request)
+}
+
+func (context *ServerContext) decodeResponse(method string, response *http.Response, decodedResponse responseStatuser) error {
 	defer response.Body.Close()
 
-	if err = json.NewDecoder(response.Body).Decode(decodedResponse); err != nil {
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if err = checkJsonResponse(method, response, content); err != nil {
+		logrus.Errorln(err)
+		return err
+	}
+	if err = json.Unmarshal(content, decodedResponse); err != nil {
 		logrus.Errorln(err)
 		return err
 	}
 
 	if decodedResponse.responseStatus() != "ok" {
-		errorMessage := fmt.Sprintf("Error on handling piwigo response: %s", decodedResponse)
-		logrus.Error(errorMessage)
-		return errors.New(errorMessage)
+		var failure errorResponse
+		_ = json.Unmarshal(content, &failure)
+		piwigoError := &PiwigoError{Method: method, Code: failure.ErrorNumber, Message: failure.Message}
+		logrus.Errorf("Error on handling piwigo response: %s", piwigoError)
+		return piwigoError
 	}
 	return nil
 }
+
+// Checks that the server answered with JSON before decoding it, as a proxy or a broken installation answers with an
+// error page the decoder would only report as an invalid character. The status is not checked for JSON answers, as
+// the web service may report its errors with a matching status.
+func checkJsonResponse(method string, response *http.Response, content []byte) error {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	status := response.Status
+	if status == "" {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	return &UnexpectedResponseError{
+		Method:      method,
+		StatusCode:  response.StatusCode,
+		Status:      status,
+		ContentType: contentType,
+		Snippet:     responseSnippet(trimmed),
+	}
+}
+
+// Returns the beginning of the text of the response without markup on a single line.
+func responseSnippet(content []byte) string {
+	text := strings.Join(strings.Fields(htmlTagPattern.ReplaceAllString(string(content), " ")), " ")
+	if utf8.RuneCountInString(text) <= responseSnippetLength {
+		return text
+	}
+	return string([]rune(text)[:responseSnippetLength]) + "..."
+}
@@ -0,0 +1,698 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_executePiwigoRequest_aborts_on_cancelled_context(t *testing.T) {
+	server, release := createSlowServer()
+	defer server.Close()
+	defer release()
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	context := &ServerContext{url: server.URL}
+	context.UseContext(ctx)
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	assertAbortsPromptly(t, func() error {
+		return context.Logout()
+	})
+}
+
+func Test_executePiwigoRequest_aborts_after_request_timeout(t *testing.T) {
+	server, release := createSlowServer()
+	defer server.Close()
+	defer release()
+
+	context := &ServerContext{url: server.URL}
+	context.UseRequestTimeout(50 * time.Millisecond)
+
+	assertAbortsPromptly(t, func() error {
+		_, err := context.GetAllCategories()
+		return err
+	})
+}
+
+func assertAbortsPromptly(t *testing.T, request func() error) {
+	start := time.Now()
+	err := request()
+	if err == nil {
+		t.Error("expected an error as the request got aborted")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("the request was not aborted promptly, took %s", time.Since(start))
+	}
+}
+
+// Creates a server that does not answer until the test releases it.
+func createSlowServer() (*httptest.Server, func()) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	return server, func() { close(done) }
+}
+
+func Test_initializeUploadChunkSize_fails_without_chunk_size(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"uploader","status":"normal","upload_form_chunk_size":0}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, username: "uploader", chunkSizeInKB: 512}
+
+	err := context.initializeUploadChunkSize()
+	if err == nil || !strings.Contains(err.Error(), "upload_form_chunk_size") {
+		t.Errorf("expected an error naming the chunk size configuration but got %v", err)
+	}
+	if context.chunkSizeInKB != 512 {
+		t.Errorf("the chunk size should not be changed but is %d", context.chunkSizeInKB)
+	}
+}
+
+func Test_initializeUploadChunkSize_uses_chunk_size_of_server(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"uploader","status":"admin","upload_form_chunk_size":1024}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, username: "uploader"}
+
+	err := context.initializeUploadChunkSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.chunkSizeInKB != 1024 {
+		t.Errorf("expected the chunk size 1024 of the server but got %d", context.chunkSizeInKB)
+	}
+}
+
+func Test_initializeUploadChunkSize_reads_the_maximum_upload_size(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"uploader","status":"admin","upload_form_chunk_size":1024,"upload_max_filesize":"20M"}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, username: "uploader"}
+
+	err := context.initializeUploadChunkSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.MaxUploadSizeInMB() != 20 {
+		t.Errorf("expected the maximum upload size of 20 MB reported by the server but got %d", context.MaxUploadSizeInMB())
+	}
+}
+
+func Test_VerifySession_uses_session_cookie(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("pwg_id")
+		if err != nil || cookie.Value != "abc123" {
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"guest"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"admin"}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{}
+	err := context.InitializeWithSessionCookie(server.URL, "pwg_id=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.VerifySession()
+	if err != nil {
+		t.Errorf("expected a valid session but got %s", err)
+	}
+}
+
+func Test_VerifySession_rejects_guest_session(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"guest"}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{}
+	err := context.InitializeWithSessionCookie(server.URL, "expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.VerifySession()
+	if err == nil {
+		t.Error("expected an error as the session is not logged in")
+	}
+}
+
+func Test_buildServiceUrl(t *testing.T) {
+	tests := []struct {
+		baseUrl  string
+		expected string
+	}{
+		{baseUrl: "https://example.com", expected: "https://example.com/ws.php?format=json"},
+		{baseUrl: "https://example.com/", expected: "https://example.com/ws.php?format=json"},
+		{baseUrl: "https://example.com/gallery", expected: "https://example.com/gallery/ws.php?format=json"},
+		{baseUrl: "https://example.com/gallery/", expected: "https://example.com/gallery/ws.php?format=json"},
+		{baseUrl: "https://example.com/gallery//", expected: "https://example.com/gallery/ws.php?format=json"},
+		{baseUrl: "https://example.com/photos/gallery", expected: "https://example.com/photos/gallery/ws.php?format=json"},
+		{baseUrl: "https://example.com/gallery/ws.php", expected: "https://example.com/gallery/ws.php?format=json"},
+		{baseUrl: "http://localhost:8080/piwigo", expected: "http://localhost:8080/piwigo/ws.php?format=json"},
+		{baseUrl: " https://example.com/gallery ", expected: "https://example.com/gallery/ws.php?format=json"},
+	}
+
+	for _, test := range tests {
+		serviceUrl, err := buildServiceUrl(test.baseUrl)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.baseUrl, err)
+			continue
+		}
+		if serviceUrl != test.expected {
+			t.Errorf("%s: expected %s but got %s", test.baseUrl, test.expected, serviceUrl)
+		}
+	}
+}
+
+func Test_buildServiceUrl_rejects_invalid_urls(t *testing.T) {
+	for _, baseUrl := range []string{"", "example.com/gallery", "ftp://example.com", "https://"} {
+		_, err := buildServiceUrl(baseUrl)
+		if err == nil {
+			t.Errorf("%q: expected an error for an invalid url", baseUrl)
+		}
+	}
+}
+
+func Test_GetCategoryImages_loads_all_pages(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("method") != "pwg.categories.getImages" || r.PostForm.Get("cat_id") != "3" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		pages = append(pages, r.PostForm.Get("page"))
+
+		images := make([]string, 0, categoryImagesPageSize)
+		count := categoryImagesPageSize
+		if r.PostForm.Get("page") == "1" {
+			count = 2
+		}
+		for i := 0; i < count; i++ {
+			images = append(images, `{"id":1}`)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"images":[` + strings.Join(images, ",") + `]}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	imageIds, err := context.GetCategoryImages(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imageIds) != categoryImagesPageSize+2 {
+		t.Errorf("expected %d images but got %d", categoryImagesPageSize+2, len(imageIds))
+	}
+	if strings.Join(pages, ",") != "0,1" {
+		t.Errorf("unexpected pages loaded: %v", pages)
+	}
+}
+
+func Test_GetAllCategories_reads_the_representative(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"categories":[` +
+			`{"id":1,"name":"2019","representative_picture_id":"12"},` +
+			`{"id":2,"name":"2020","representative_picture_id":null}]}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	categories, err := context.GetAllCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if categories["2019"].RepresentativeId != 12 {
+		t.Errorf("expected the representative 12 but got %d", categories["2019"].RepresentativeId)
+	}
+	if categories["2020"].RepresentativeId != 0 {
+		t.Errorf("expected no representative but got %d", categories["2020"].RepresentativeId)
+	}
+}
+
+func Test_GetAllCategories_uses_the_local_keys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"categories":[` +
+			`{"id":1,"name":"Family"},` +
+			`{"id":2,"name":"Wedding 2019","id_uppercat":"1"},` +
+			`{"id":3,"name":"Day 1","id_uppercat":"2"},` +
+			`{"id":4,"name":"2020","id_uppercat":"1"}]}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	context.UseLocalCategoryKeys(map[string]string{filepath.Join("Family", "Wedding 2019"): filepath.Join("Family", "2019-wedding")})
+	categories, err := context.GetAllCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"Family", filepath.Join("Family", "2019-wedding"), filepath.Join("Family", "2019-wedding", "Day 1"), filepath.Join("Family", "2020")} {
+		if categories[key] == nil {
+			t.Errorf("expected the category %s but got %v", key, categories)
+		}
+	}
+	if categories[filepath.Join("Family", "2019-wedding")].Name != "Wedding 2019" {
+		t.Errorf("expected the name of the category to be kept but got %s", categories[filepath.Join("Family", "2019-wedding")].Name)
+	}
+}
+
+func Test_SetCategoryRepresentative_sends_the_image(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("method") != "pwg.categories.setRepresentative" || r.PostForm.Get("category_id") != "3" || r.PostForm.Get("image_id") != "7" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.SetCategoryRepresentative(3, 7)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_CreateCategoryWithSettings_sends_the_settings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("method") != "pwg.categories.add" || r.PostForm.Get("parent") != "3" || r.PostForm.Get("status") != "private" || r.PostForm.Get("commentable") != "false" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"info":"Album added","id":5}}`))
+	}))
+	defer server.Close()
+
+	commentable := false
+	context := &ServerContext{url: server.URL}
+	id, err := context.CreateCategoryWithSettings(3, "family", CategorySettings{Status: CategoryStatusPrivate, Commentable: &commentable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 5 {
+		t.Errorf("expected the category 5 but got %d", id)
+	}
+}
+
+func Test_CreateCategory_uses_the_server_defaults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if _, found := r.PostForm["status"]; found {
+			t.Errorf("Unexpected status %s", r.PostForm.Get("status"))
+		}
+		if _, found := r.PostForm["commentable"]; found {
+			t.Errorf("Unexpected commentable %s", r.PostForm.Get("commentable"))
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"info":"Album added","id":5}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	_, err := context.CreateCategory(0, "family")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_CreateCategoryWithSettings_rejects_unknown_status(t *testing.T) {
+	context := &ServerContext{}
+	_, err := context.CreateCategoryWithSettings(0, "family", CategorySettings{Status: "hidden"})
+	if err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+}
+
+func Test_DeleteImages_sends_the_image_ids(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("method") == "pwg.session.getStatus" {
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"admin","pwg_token":"token"}}`))
+			return
+		}
+		if r.PostForm.Get("image_id") != "12|15" || r.PostForm.Get("pwg_token") != "token" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":2}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.DeleteImages([]int{12, 15})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_DeleteCategory_keeps_the_images(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("method") == "pwg.session.getStatus" {
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"admin","pwg_token":"token"}}`))
+			return
+		}
+		if r.PostForm.Get("method") != "pwg.categories.delete" || r.PostForm.Get("category_id") != "3" || r.PostForm.Get("photo_deletion_mode") != "no_delete" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	err := context.DeleteCategory(3)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_UpdateImagesInfo_merges_the_updates_of_an_image(t *testing.T) {
+	mutex := sync.Mutex{}
+	requests := make(map[string]url.Values)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		mutex.Lock()
+		requests[r.PostForm.Get("image_id")] = r.PostForm
+		mutex.Unlock()
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	dateAvailable := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	name := ImageInfoUpdate{PiwigoId: 3, Fields: url.Values{"name": {"holidays"}}}
+	context := &ServerContext{url: server.URL}
+	result, err := context.UpdateImagesInfo([]ImageInfoUpdate{NewDateAvailableUpdate(3, dateAvailable), NewDateAvailableUpdate(7, dateAvailable), name}, 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if result.Updates != 3 || result.Images != 2 || result.Requests != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if requests["3"].Get("method") != "pwg.images.setInfo" || requests["3"].Get("date_available") != "2012-03-04 05:06:07" || requests["3"].Get("name") != "holidays" {
+		t.Errorf("unexpected merged request %v", requests["3"])
+	}
+	if requests["7"].Get("date_available") != "2012-03-04 05:06:07" || requests["7"].Get("name") != "" {
+		t.Errorf("unexpected request %v", requests["7"])
+	}
+}
+
+func Test_UpdateImagesInfo_continues_after_failed_updates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("image_id") == "3" {
+			_, _ = w.Write([]byte(`{"stat":"fail","err":1002,"message":"Invalid image_id"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	now := time.Now()
+	result, err := context.UpdateImagesInfo([]ImageInfoUpdate{NewDateAvailableUpdate(3, now), NewDateAvailableUpdate(7, now)}, 1)
+	if err == nil {
+		t.Error("expected an error as image 3 failed")
+	}
+	if result.Requests != 2 {
+		t.Errorf("expected both images to be updated but got %d requests", result.Requests)
+	}
+}
+
+func Test_UseConnectionPool_configures_the_transport(t *testing.T) {
+	context := &ServerContext{}
+	err := context.Initialize("https://example.com/gallery", "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.UseConnectionPool(120, 16, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.transport.MaxIdleConns != 120 || context.transport.MaxIdleConnsPerHost != 16 || context.transport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("unexpected transport settings %d, %d, %s", context.transport.MaxIdleConns, context.transport.MaxIdleConnsPerHost, context.transport.IdleConnTimeout)
+	}
+}
+
+func Test_UseConnectionPool_rejects_negative_settings(t *testing.T) {
+	context := &ServerContext{}
+	err := context.Initialize("https://example.com/gallery", "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.UseConnectionPool(100, -1, time.Minute)
+	if err == nil {
+		t.Error("expected an error as maxIdleConnsPerHost is negative")
+	}
+}
+
+func Test_UseConnectionPool_requires_initialized_context(t *testing.T) {
+	context := &ServerContext{}
+	err := context.UseConnectionPool(100, 4, time.Minute)
+	if err == nil {
+		t.Error("expected an error as the context is not initialized")
+	}
+}
+
+func Test_UseClientCertificate_adds_the_certificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certificates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeClientCertificate(t, dir, "client")
+	context := &ServerContext{}
+	err = context.Initialize("https://example.com/gallery", "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.UseClientCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.transport.TLSClientConfig == nil || len(context.transport.TLSClientConfig.Certificates) != 1 {
+		t.Error("expected the client certificate in the tls config of the transport")
+	}
+}
+
+func Test_UseClientCertificate_rejects_missing_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certificates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, keyFile := writeClientCertificate(t, dir, "client")
+	context := &ServerContext{}
+	err = context.Initialize("https://example.com/gallery", "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.UseClientCertificate(filepath.Join(dir, "missing.pem"), keyFile)
+	if err == nil {
+		t.Error("expected an error as the certificate file does not exist")
+	}
+}
+
+func Test_UseClientCertificate_rejects_key_of_another_certificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certificates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, _ := writeClientCertificate(t, dir, "client")
+	_, otherKeyFile := writeClientCertificate(t, dir, "other")
+	context := &ServerContext{}
+	err = context.Initialize("https://example.com/gallery", "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = context.UseClientCertificate(certFile, otherKeyFile)
+	if err == nil {
+		t.Error("expected an error as the key does not belong to the certificate")
+	}
+	if context.transport.TLSClientConfig != nil && len(context.transport.TLSClientConfig.Certificates) != 0 {
+		t.Error("expected no client certificate in the tls config of the transport")
+	}
+}
+
+// Writes a self signed certificate and its key as pem files with the given name to the directory.
+func writeClientCertificate(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKey}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func Test_LatestCategoryImageDate_requests_the_newest_image(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("cat_id") != "3" || r.PostForm.Get("order") != "date_available DESC" || r.PostForm.Get("per_page") != "1" {
+			t.Errorf("Unexpected form values %v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"images":[{"id":1,"date_available":"2020-04-12 18:30:05"}]}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	latest, found, err := context.LatestCategoryImageDate(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2020, 4, 12, 18, 30, 5, 0, time.Local)
+	if !found || !latest.Equal(expected) {
+		t.Errorf("expected %s but got %s (found: %t)", expected, latest, found)
+	}
+}
+
+func Test_LatestCategoryImageDate_of_an_empty_category(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"images":[]}}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	_, found, err := context.LatestCategoryImageDate(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("expected no date for an empty category")
+	}
+}
+
+// Answers like php does for a form that exceeds post_max_size, which drops the values of the form.
+func createLimitedServer(t *testing.T, limit int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) > limit {
+			_, _ = w.Write([]byte(`{"stat":"fail","err":501,"message":"Missing \"method\" name"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"username":"uploader","status":"admin","upload_form_chunk_size":1024}}`))
+	}))
+}
+
+func Test_initializeUploadChunkSize_tunes_chunk_size_to_accepted_requests(t *testing.T) {
+	server := createLimitedServer(t, 800*1024)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, username: "uploader"}
+	context.UseAutoTunedUpload(true)
+
+	err := context.initializeUploadChunkSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.chunkSizeInKB != 512 {
+		t.Errorf("expected the chunk size 512 accepted by the server but got %d", context.chunkSizeInKB)
+	}
+}
+
+func Test_initializeUploadChunkSize_keeps_chunk_size_if_all_probes_fail(t *testing.T) {
+	server := createLimitedServer(t, 1024)
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, username: "uploader"}
+	context.UseAutoTunedUpload(true)
+
+	err := context.initializeUploadChunkSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context.chunkSizeInKB != 1024 {
+		t.Errorf("expected the chunk size 1024 of the server but got %d", context.chunkSizeInKB)
+	}
+}
+
+func Test_chunkRequestSize_exceeds_encoded_chunk(t *testing.T) {
+	size := chunkRequestSize(512)
+	if size < 512*1024*4/3 || size > 512*1024*3/2 {
+		t.Errorf("unexpected request size %d for a chunk of 512 KB", size)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// the median is taken over the durations of the latest chunks, so it follows a network that gets slower or faster
+	chunkTimingWindow = 100
+	// no chunk is slow before the median is based on this many chunks
+	minChunkTimings = 5
+)
+
+// Detects chunks that took much longer to upload than the others, e.g. due to a network or server problem that did
+// not lead to a timeout yet. All uploads of the context share the timings, so the parallel uploads have one median.
+type chunkTimings struct {
+	mutex  sync.Mutex
+	factor int
+	// the latest durations, the oldest gets replaced once the window is full
+	durations []time.Duration
+	next      int
+}
+
+func newChunkTimings(factor int) *chunkTimings {
+	return &chunkTimings{factor: factor, durations: make([]time.Duration, 0, chunkTimingWindow)}
+}
+
+// Adds the duration of an uploaded chunk. Returns true and the median of the chunks before if the chunk took more
+// than factor times the median.
+func (timings *chunkTimings) add(duration time.Duration) (time.Duration, bool) {
+	timings.mutex.Lock()
+	defer timings.mutex.Unlock()
+
+	var median time.Duration
+	slow := false
+	if len(timings.durations) >= minChunkTimings {
+		median = timings.median()
+		slow = median > 0 && duration > median*time.Duration(timings.factor)
+	}
+
+	if len(timings.durations) < chunkTimingWindow {
+		timings.durations = append(timings.durations, duration)
+	} else {
+		timings.durations[timings.next] = duration
+		timings.next = (timings.next + 1) % chunkTimingWindow
+	}
+	return median, slow
+}
+
+func (timings *chunkTimings) median() time.Duration {
+	sorted := make([]time.Duration, len(timings.durations))
+	copy(sorted, timings.durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// Warns about every chunk whose upload takes more than factor times the median of the latest chunks. Zero disables
+// the warning.
+func (context *ServerContext) UseSlowChunkWarning(factor int) {
+	if factor <= 0 {
+		context.chunkTimings = nil
+		return
+	}
+	context.chunkTimings = newChunkTimings(factor)
+}
+
+// Records the duration of the chunk and warns if it was slow.
+func (context *ServerContext) timeChunk(filePath string, position int64, numberOfChunks int64, duration time.Duration, log *logrus.Entry) {
+	if context.chunkTimings == nil {
+		return
+	}
+	median, slow := context.chunkTimings.add(duration)
+	if slow {
+		log.Warnf("%s: chunk %d of %d took %s, more than %d times the median of %s. The network or the server may be degrading", filePath, position, numberOfChunks, duration.Round(time.Millisecond), context.chunkTimings.factor, median.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"github.com/sirupsen/logrus"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_chunkTimings_add_detects_chunks_slower_than_the_median(t *testing.T) {
+	timings := newChunkTimings(10)
+	for _, duration := range []time.Duration{time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Minute} {
+		if _, slow := timings.add(duration); slow {
+			t.Fatal("expected no slow chunk before the median is known")
+		}
+	}
+
+	median, slow := timings.add(15 * time.Second)
+	if slow || median != 2*time.Second {
+		t.Errorf("expected a chunk below ten times the median of 2s to pass but got slow %t and median %s", slow, median)
+	}
+	median, slow = timings.add(time.Minute)
+	if !slow || median != 2*time.Second {
+		t.Errorf("expected a slow chunk above ten times the median of 2s but got slow %t and median %s", slow, median)
+	}
+}
+
+func Test_chunkTimings_add_keeps_the_latest_chunks(t *testing.T) {
+	timings := newChunkTimings(10)
+	for i := 0; i < chunkTimingWindow; i++ {
+		timings.add(time.Minute)
+	}
+	for i := 0; i < chunkTimingWindow/2+1; i++ {
+		timings.add(time.Second)
+	}
+
+	median, slow := timings.add(20 * time.Second)
+	if !slow || median != time.Second {
+		t.Errorf("expected the median of the latest chunks to be 1s but got slow %t and median %s", slow, median)
+	}
+}
+
+func Test_timeChunk_warns_about_the_slow_chunk_with_its_position_and_path(t *testing.T) {
+	hook := captureTraceLog(t)
+	context := &ServerContext{}
+	context.UseSlowChunkWarning(5)
+	for i := int64(0); i < minChunkTimings; i++ {
+		context.timeChunk("/photos/a.jpg", i, 10, 100*time.Millisecond, CorrelationLog(""))
+	}
+	context.timeChunk("/photos/a.jpg", 7, 10, time.Second, CorrelationLog(""))
+
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "/photos/a.jpg: chunk 7 of 10 took 1s") {
+		t.Errorf("expected one warning about chunk 7 of /photos/a.jpg but got %v", warnings)
+	}
+}
+
+func Test_timeChunk_does_nothing_without_factor(t *testing.T) {
+	context := &ServerContext{}
+	context.UseSlowChunkWarning(0)
+	context.timeChunk("/photos/a.jpg", 0, 1, time.Second, CorrelationLog(""))
+	if context.chunkTimings != nil {
+		t.Error("expected no timings without factor")
+	}
+}
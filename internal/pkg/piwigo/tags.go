@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Returns the ids of the tags with the given names. Tags that do not exist yet are created. The names are compared
+// case insensitive, as piwigo does not allow two tags that only differ in case.
+func (context *ServerContext) GetOrCreateTags(names []string) (map[string]int, error) {
+	logrus.Debug("Entering GetOrCreateTags")
+	defer logrus.Debug("Leaving GetOrCreateTags")
+
+	tagIds := make(map[string]int, len(names))
+	if len(names) == 0 {
+		return tagIds, nil
+	}
+
+	existing, err := getAllTags(context)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if _, found := tagIds[name]; found {
+			continue
+		}
+		if id, found := existing[strings.ToLower(name)]; found {
+			tagIds[name] = id
+			continue
+		}
+
+		id, err := addTag(context, name)
+		if err != nil {
+			return nil, err
+		}
+		existing[strings.ToLower(name)] = id
+		tagIds[name] = id
+	}
+	return tagIds, nil
+}
+
+// Separates the tag ids the way pwg.images.setInfo expects them.
+func FormatTagIds(tagIds []int) string {
+	parts := make([]string, 0, len(tagIds))
+	for _, id := range tagIds {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+func getAllTags(context *ServerContext) (map[string]int, error) {
+	formData := url.Values{}
+	formData.Set("method", "pwg.tags.getAdminList")
+
+	var response tagListResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err := context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		logrus.Errorf("Got error while loading the tags: %s", err)
+		return nil, fmt.Errorf("could not load the tags - %w", err)
+	}
+
+	tags := make(map[string]int, len(response.Result.Tags))
+	for _, tag := range response.Result.Tags {
+		tags[strings.ToLower(tag.Name)] = int(tag.ID)
+	}
+	return tags, nil
+}
+
+func addTag(context *ServerContext, name string) (int, error) {
+	pwgToken, err := context.getPiwigoToken()
+	if err != nil {
+		return 0, err
+	}
+
+	formData := url.Values{}
+	formData.Set("method", "pwg.tags.add")
+	formData.Set("name", name)
+	formData.Set("pwg_token", pwgToken)
+
+	var response addTagResponse
+	ctx, cancel := context.newRequestContext()
+	defer cancel()
+	err = context.executePiwigoRequest(ctx, formData, &response)
+	if err != nil {
+		logrus.Errorf("Got error while creating the tag %s: %s", name, err)
+		return 0, fmt.Errorf("could not create the tag %s - %w", name, err)
+	}
+
+	logrus.Infof("Successfully created tag %s with id %d", name, response.Result.ID)
+	return int(response.Result.ID), nil
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_GetOrCreateTags_creates_the_missing_tags(t *testing.T) {
+	var created []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		switch r.PostForm.Get("method") {
+		case "pwg.tags.getAdminList":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"tags":[{"id":"3","name":"Holidays"}]}}`))
+		case "pwg.session.getStatus":
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"pwg_token":"token"}}`))
+		case "pwg.tags.add":
+			created = append(created, r.PostForm.Get("name"))
+			_, _ = w.Write([]byte(`{"stat":"ok","result":{"id":7}}`))
+		default:
+			t.Errorf("Unexpected method %s", r.PostForm.Get("method"))
+		}
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL}
+	tagIds, err := context.GetOrCreateTags([]string{"holidays", "beach", "beach"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagIds["holidays"] != 3 || tagIds["beach"] != 7 {
+		t.Errorf("unexpected tag ids %v", tagIds)
+	}
+	if len(created) != 1 || created[0] != "beach" {
+		t.Errorf("expected only the tag beach to be created but got %v", created)
+	}
+}
+
+func Test_NewImageDetailsUpdate_skips_the_empty_values(t *testing.T) {
+	update := NewImageDetailsUpdate(5, "", time.Date(2019, 7, 1, 12, 30, 0, 0, time.Local), []int{3, 7})
+	if update.Fields.Get("date_creation") != "2019-07-01 12:30:00" || update.Fields.Get("tag_ids") != "3,7" {
+		t.Errorf("unexpected fields %v", update.Fields)
+	}
+	if _, found := update.Fields["name"]; found {
+		t.Error("expected the name to remain unchanged")
+	}
+}
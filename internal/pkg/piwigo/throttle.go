@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// how often a request is sent again after the server answered it with 429 Too Many Requests
+	maxThrottledRetries = 5
+	// the delay of a throttled request without a valid Retry-After header
+	defaultRetryAfter = time.Second
+	// longer Retry-After delays are cut down, so a misconfigured proxy does not stall the run for hours
+	maxRetryAfter = 5 * time.Minute
+	// the spacing between the requests starts at this value after the first throttled request and doubles with every
+	// further one up to the maximum
+	minRequestSpacing = 100 * time.Millisecond
+	maxRequestSpacing = 10 * time.Second
+)
+
+// Slows down all requests to a server that answered with 429 Too Many Requests, e.g. a reverse proxy in front of
+// piwigo under load. All requests of the context share it, so the parallel workers slow down together.
+//
+// A throttled request pauses all requests until the delay of its Retry-After header passed. It also doubles the
+// spacing between the starts of the requests, so sustained throttling reduces the rate of the requests instead of
+// sending a burst after every pause. Every request that is not throttled shrinks the spacing again.
+type requestThrottle struct {
+	mutex sync.Mutex
+	// no request starts before this time
+	pausedUntil time.Time
+	spacing     time.Duration
+	// the earliest start of the next request by the spacing
+	next time.Time
+	// replaced in the tests to run without waiting
+	now        func() time.Time
+	sleepUntil func(ctx gocontext.Context, until time.Time) error
+}
+
+func newRequestThrottle() *requestThrottle {
+	return &requestThrottle{now: time.Now, sleepUntil: sleepUntil}
+}
+
+// Waits until the next request may start. It returns early with the error of the context if it is done.
+func (throttle *requestThrottle) wait(ctx gocontext.Context) error {
+	if throttle == nil {
+		return nil
+	}
+
+	throttle.mutex.Lock()
+	now := throttle.now()
+	start := now
+	if throttle.pausedUntil.After(start) {
+		start = throttle.pausedUntil
+	}
+	if throttle.next.After(start) {
+		start = throttle.next
+	}
+	throttle.next = start.Add(throttle.spacing)
+	throttle.mutex.Unlock()
+
+	if !start.After(now) {
+		return nil
+	}
+	return throttle.sleepUntil(ctx, start)
+}
+
+// Pauses all requests for the given delay and reduces the rate of the following requests.
+func (throttle *requestThrottle) throttled(delay time.Duration) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	until := throttle.now().Add(delay)
+	if until.After(throttle.pausedUntil) {
+		throttle.pausedUntil = until
+	}
+	throttle.spacing *= 2
+	if throttle.spacing < minRequestSpacing {
+		throttle.spacing = minRequestSpacing
+	}
+	if throttle.spacing > maxRequestSpacing {
+		throttle.spacing = maxRequestSpacing
+	}
+}
+
+// Raises the rate of the requests again after a request that was not throttled.
+func (throttle *requestThrottle) succeeded() {
+	if throttle == nil {
+		return
+	}
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+	throttle.spacing -= throttle.spacing / 10
+	if throttle.spacing < minRequestSpacing {
+		throttle.spacing = 0
+	}
+}
+
+// Returns the delay of the Retry-After header, which holds either the seconds to wait or the HTTP-date to wait for.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	delay := defaultRetryAfter
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay
+}
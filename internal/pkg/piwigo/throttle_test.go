@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package piwigo
+
+import (
+	gocontext "context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestThrottle(clock *fakeClock) *requestThrottle {
+	throttle := newRequestThrottle()
+	throttle.now = clock.now
+	throttle.sleepUntil = clock.sleepUntil
+	return throttle
+}
+
+func Test_executePiwigoRequest_honors_the_Retry_After_delay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"stat":"ok","result":{"pwg_token":"token"}}`))
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	context := &ServerContext{url: server.URL, throttle: newTestThrottle(clock)}
+	token, err := context.getPiwigoToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token" || requests != 2 {
+		t.Errorf("expected the request to be sent again, got %d requests", requests)
+	}
+	if clock.elapsed() < 3*time.Second {
+		t.Errorf("expected a delay of 3s before the retry but waited %s", clock.elapsed())
+	}
+}
+
+func Test_executePiwigoRequest_gives_up_if_the_server_keeps_throttling(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, throttle: newTestThrottle(newFakeClock())}
+	_, err := context.getPiwigoToken()
+	if !errors.Is(err, ErrorThrottled) || !IsTransientError(err) {
+		t.Errorf("expected a transient ErrorThrottled but got %v", err)
+	}
+	if requests != maxThrottledRetries+1 {
+		t.Errorf("expected %d requests but got %d", maxThrottledRetries+1, requests)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"seconds", "120", 2 * time.Minute},
+		{"http date", "Sun, 01 Mar 2020 12:00:30 GMT", 30 * time.Second},
+		{"date in the past", "Sun, 01 Mar 2020 11:00:00 GMT", 0},
+		{"missing", "", defaultRetryAfter},
+		{"invalid", "soon", defaultRetryAfter},
+		{"too long", "86400", maxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_requestThrottle_reduces_the_rate_while_throttled(t *testing.T) {
+	clock := newFakeClock()
+	throttle := newTestThrottle(clock)
+	for i := 0; i < 3; i++ {
+		throttle.throttled(0)
+	}
+
+	for i := 0; i < 3; i++ {
+		_ = throttle.wait(gocontext.Background())
+	}
+	if clock.elapsed() != 800*time.Millisecond {
+		t.Errorf("expected the requests to be spaced by 400ms but waited %s", clock.elapsed())
+	}
+
+	for i := 0; i < 20; i++ {
+		throttle.succeeded()
+	}
+	if throttle.spacing != 0 {
+		t.Errorf("expected the spacing to shrink after successful requests but got %s", throttle.spacing)
+	}
+}
+
+func Test_uploadImageChunk_streams_the_chunk_again_after_throttling(t *testing.T) {
+	var positions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(positions) == 0 {
+			positions = append(positions, "throttled")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.PostForm.Get("data") == "" {
+			t.Error("expected the chunk in the retried request")
+		}
+		positions = append(positions, r.PostForm.Get("position"))
+		_, _ = w.Write([]byte(`{"stat":"ok","result":null}`))
+	}))
+	defer server.Close()
+
+	context := &ServerContext{url: server.URL, throttle: newTestThrottle(newFakeClock())}
+	err := uploadImageChunk(context, make([]byte, 2000), "1234", 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 2 || positions[1] != "3" {
+		t.Errorf("unexpected requests %v", positions)
+	}
+}
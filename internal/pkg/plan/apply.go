@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/manifest"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+)
+
+// Uploads the images of the plan to their categories and creates the missing categories. The assumptions of the plan
+// are checked first and every difference to the current state is logged as drift: files that changed since the plan
+// was made are skipped, new images whose content got uploaded in the meantime are only added to their categories,
+// images that got replaced in the meantime are not uploaded again and replaced images that got deleted are uploaded as
+// new images. The results are in the order of the plan.
+func Apply(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, plan Plan, options manifest.Options) ([]manifest.Result, error) {
+	logrus.Debug("Entering plan.Apply")
+	defer logrus.Debug("Leaving plan.Apply")
+
+	drifts, err := checkCategories(categoryApi, plan)
+	if err != nil {
+		return nil, err
+	}
+	existingImages, err := existingNewImages(imageApi, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIds := make(map[string]int, len(plan.Categories))
+	for _, category := range plan.Categories {
+		categoryIds[category.Key] = category.PiwigoId
+	}
+
+	results := make([]manifest.Result, len(plan.Images))
+	entries := make([]manifest.Entry, 0, len(plan.Images))
+	positions := make([]int, 0, len(plan.Images))
+	for i, img := range plan.Images {
+		result := manifest.Result{LocalPath: img.LocalPath, CategoryId: categoryIds[img.Category], PiwigoId: img.PiwigoId}
+		reason := checkFile(img)
+		if reason != "" {
+			drifts++
+			logrus.Warnf("%s: Drift from the plan, %s. Skipping the image", img.LocalPath, reason)
+			result.Result = manifest.ResultFailed
+			result.Reason = reason
+			results[i] = result
+			continue
+		}
+
+		entry := manifest.Entry{LocalPath: img.LocalPath, Category: img.Category}
+		var upload bool
+		reason, entry.PiwigoId, upload, err = checkServerImage(imageApi, img, existingImages)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			drifts++
+			logrus.Warnf("%s: Drift from the plan, %s", img.LocalPath, reason)
+		}
+		if !upload {
+			result.Result = manifest.ResultMatched
+			result.Reason = reason
+			results[i] = result
+			continue
+		}
+		entries = append(entries, entry)
+		positions = append(positions, i)
+	}
+
+	options.CreateCategories = true
+	uploaded, err := manifest.Upload(categoryApi, imageApi, entries, options)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range uploaded {
+		results[positions[i]] = result
+	}
+
+	if drifts > 0 {
+		logrus.Warnf("Applied the plan of %s with %d drifts from the current state", plan.Created.Format("2006-01-02 15:04:05"), drifts)
+	} else {
+		logrus.Infof("Applied the plan of %s without drift", plan.Created.Format("2006-01-02 15:04:05"))
+	}
+	return results, nil
+}
+
+// Logs the categories that got created, deleted or moved on the server since the plan was made. The manifest upload
+// resolves them by key anyway, so they only count as drift.
+func checkCategories(categoryApi piwigo.CategoryApi, plan Plan) (int, error) {
+	categories, err := categoryApi.GetAllCategories()
+	if err != nil {
+		return 0, err
+	}
+	index := piwigo.NewCategoryIndex(categories)
+
+	drifts := 0
+	for _, planned := range plan.Categories {
+		existing, found := index.ByKey(filepath.FromSlash(planned.Key))
+		switch {
+		case planned.PiwigoId == 0 && found:
+			logrus.Warnf("Drift from the plan, the category %s got created on the server as category %d in the meantime", planned.Key, existing.Id)
+		case planned.PiwigoId > 0 && !found:
+			logrus.Warnf("Drift from the plan, the category %s with id %d no longer exists and gets created again", planned.Key, planned.PiwigoId)
+		case planned.PiwigoId > 0 && existing.Id != planned.PiwigoId:
+			logrus.Warnf("Drift from the plan, the category %s has the id %d instead of %d", planned.Key, existing.Id, planned.PiwigoId)
+		default:
+			continue
+		}
+		drifts++
+	}
+	return drifts, nil
+}
+
+// Returns the ids of the planned new images whose content got uploaded in the meantime by their md5sum.
+func existingNewImages(imageApi piwigo.ImageApi, plan Plan) (map[string]int, error) {
+	md5sums := make([]string, 0, len(plan.Images))
+	for _, img := range plan.Images {
+		if img.PiwigoId == 0 && img.Md5Sum != "" {
+			md5sums = append(md5sums, img.Md5Sum)
+		}
+	}
+	if len(md5sums) == 0 {
+		return map[string]int{}, nil
+	}
+	return imageApi.ImagesExistOnPiwigo(md5sums)
+}
+
+// Returns why the file differs from the plan or an empty string if it is unchanged.
+func checkFile(img PlannedUpload) string {
+	fileInfo, err := localFileStructure.Stat(img.LocalPath)
+	if err != nil {
+		return fmt.Sprintf("the file can not be read - %s", err)
+	}
+	if fileInfo.Size() != img.Size || !fileInfo.ModTime().Equal(img.ModTime) {
+		return "the file changed after the plan was made"
+	}
+	return ""
+}
+
+// Returns why the image on the server differs from the plan, the id of the image that gets replaced and whether the
+// file still has to be uploaded. Fails if the image to replace could not be checked, as uploading it as new image
+// would create a duplicate of an image that still exists.
+func checkServerImage(imageApi piwigo.ImageApi, img PlannedUpload, existingImages map[string]int) (string, int, bool, error) {
+	if img.PiwigoId == 0 {
+		id := existingImages[img.Md5Sum]
+		switch {
+		case id > 0 && id != img.MatchesId:
+			return fmt.Sprintf("the image got uploaded as image %d in the meantime and is only added to its category", id), 0, true, nil
+		case id == 0 && img.MatchesId > 0:
+			return fmt.Sprintf("the image %d with the same content no longer exists and the file is uploaded", img.MatchesId), 0, true, nil
+		}
+		return "", 0, true, nil
+	}
+
+	state, err := imageApi.ImageCheckFile(img.PiwigoId, img.Md5Sum)
+	if errors.Is(err, piwigo.ErrorImageNotFound) {
+		return fmt.Sprintf("the image %d to replace no longer exists and is uploaded as new image", img.PiwigoId), 0, true, nil
+	}
+	if err != nil {
+		return "", 0, false, err
+	}
+	if state == piwigo.ImageStateUptodate {
+		return fmt.Sprintf("the image %d got replaced in the meantime", img.PiwigoId), img.PiwigoId, false, nil
+	}
+	return "", img.PiwigoId, true, nil
+}
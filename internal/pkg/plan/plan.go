@@ -0,0 +1,205 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/images"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the version of the schema, plans of other versions are rejected
+const planVersion = 1
+
+// What a synchronization would change on the server, written before anything is changed so it can be reviewed and
+// applied later exactly as planned.
+type Plan struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// the url of the piwigo installation the plan was made for
+	Server     string            `json:"server"`
+	Categories []PlannedCategory `json:"categories"`
+	Images     []PlannedUpload   `json:"images"`
+}
+
+// A category the planned images are uploaded to.
+type PlannedCategory struct {
+	// the path of the category with slashes, e.g. "2019/Summer"
+	Key string `json:"key"`
+	// the id of the category on the server, zero if it gets created
+	PiwigoId int `json:"piwigoId"`
+}
+
+// An image that gets uploaded.
+type PlannedUpload struct {
+	LocalPath string `json:"localPath"`
+	// the key of the category it is uploaded to
+	Category string `json:"category"`
+	Md5Sum   string `json:"md5sum"`
+	// the size and the modification date of the file, a file that differs when the plan is applied is skipped
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// the image on the server that gets replaced, zero uploads a new image
+	PiwigoId int `json:"piwigoId,omitempty"`
+	// the image on the server with the same content that is only added to the category, zero if the content is new
+	MatchesId int `json:"matchesId,omitempty"`
+}
+
+// Plans the upload of the local images that are missing or different on the server and the categories they are
+// uploaded to without changing anything on the server or in the metadata store. Images whose content is on the server
+// but not in their category are planned to be matched like the synchronization does. The categories whose images are
+// all up to date are not part of the plan.
+func Create(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, provider datastore.ImageMetadataProvider, fileSystemNodes map[string]*localFileStructure.FilesystemNode, checksumCalculator localFileStructure.ChecksumCalculator, server string) (Plan, error) {
+	logrus.Debug("Entering plan.Create")
+	defer logrus.Debug("Leaving plan.Create")
+
+	plan := Plan{Version: planVersion, Created: time.Now(), Server: server, Categories: []PlannedCategory{}, Images: []PlannedUpload{}}
+	planned, err := images.PlanImages(imageApi, provider, fileSystemNodes, checksumCalculator)
+	if err != nil {
+		return plan, err
+	}
+	categories, err := categoryApi.GetAllCategories()
+	if err != nil {
+		return plan, err
+	}
+	index := piwigo.NewCategoryIndex(categories)
+
+	keys := make(map[string]bool)
+	categoryImages := make(map[int]map[int]bool)
+	for _, img := range planned {
+		if img.ExistingId > 0 {
+			inCategory, err := isInCategory(imageApi, index, categoryImages, img)
+			if err != nil {
+				return plan, err
+			}
+			if inCategory {
+				continue
+			}
+		}
+		plan.Images = append(plan.Images, PlannedUpload{
+			LocalPath: img.Path,
+			Category:  filepath.ToSlash(img.CategoryKey),
+			Md5Sum:    img.Md5Sum,
+			Size:      img.Size,
+			ModTime:   img.ModTime,
+			PiwigoId:  img.PiwigoId,
+			MatchesId: img.ExistingId,
+		})
+		for key := img.CategoryKey; key != "." && key != string(filepath.Separator) && !keys[key]; key = filepath.Dir(key) {
+			keys[key] = true
+		}
+	}
+	for key := range keys {
+		category := PlannedCategory{Key: filepath.ToSlash(key)}
+		if existing, found := index.ByKey(key); found {
+			category.PiwigoId = existing.Id
+		}
+		plan.Categories = append(plan.Categories, category)
+	}
+	sort.Slice(plan.Categories, func(i, j int) bool { return plan.Categories[i].Key < plan.Categories[j].Key })
+
+	logrus.Infof("Planned the upload of %d images to %d categories, %d of them get created", len(plan.Images), len(plan.Categories), plan.categoriesToCreate())
+	return plan, nil
+}
+
+// Checks if the image with the same content is already in the category of the planned image. The images of every
+// category are loaded once.
+func isInCategory(imageApi piwigo.ImageApi, index *piwigo.CategoryIndex, categoryImages map[int]map[int]bool, img images.PlannedImage) (bool, error) {
+	category, found := index.ByKey(img.CategoryKey)
+	if !found {
+		return false, nil
+	}
+	ids, loaded := categoryImages[category.Id]
+	if !loaded {
+		imageIds, err := imageApi.GetCategoryImages(category.Id)
+		if err != nil {
+			return false, err
+		}
+		ids = make(map[int]bool, len(imageIds))
+		for _, id := range imageIds {
+			ids[id] = true
+		}
+		categoryImages[category.Id] = ids
+	}
+	return ids[img.ExistingId], nil
+}
+
+func (plan Plan) categoriesToCreate() int {
+	created := 0
+	for _, category := range plan.Categories {
+		if category.PiwigoId == 0 {
+			created++
+		}
+	}
+	return created
+}
+
+// Checks that the plan was made for the server at the given url, as the ids of the plan only exist on that server.
+func (plan Plan) CheckServer(server string) error {
+	if normalizeServer(plan.Server) != normalizeServer(server) {
+		return errors.New(fmt.Sprintf("the plan was made for the server %s and can not be applied to %s", plan.Server, server))
+	}
+	return nil
+}
+
+func normalizeServer(server string) string {
+	return strings.TrimRight(strings.TrimSpace(server), "/")
+}
+
+// Writes the plan as indented JSON.
+func (plan Plan) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+// Writes the plan to the given file.
+func (plan Plan) WriteFile(planPath string) error {
+	file, err := os.Create(planPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not create the plan file %s - %s", planPath, err))
+	}
+	err = plan.Write(file)
+	if err != nil {
+		file.Close()
+		return errors.New(fmt.Sprintf("could not write the plan file %s - %s", planPath, err))
+	}
+	err = file.Close()
+	if err != nil {
+		return errors.New(fmt.Sprintf("could not write the plan file %s - %s", planPath, err))
+	}
+	logrus.Infof("Wrote the plan to %s", planPath)
+	return nil
+}
+
+// Reads a plan written by WriteFile.
+func Read(planPath string) (Plan, error) {
+	var plan Plan
+	content, err := ioutil.ReadFile(planPath)
+	if err != nil {
+		return plan, err
+	}
+	err = json.Unmarshal(content, &plan)
+	if err != nil {
+		return plan, errors.New(fmt.Sprintf("could not read the plan %s - %s", planPath, err))
+	}
+	if plan.Version != planVersion {
+		return plan, errors.New(fmt.Sprintf("the plan %s has the version %d, only version %d is supported", planPath, plan.Version, planVersion))
+	}
+	return plan, nil
+}
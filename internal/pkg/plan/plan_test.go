@@ -0,0 +1,292 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package plan
+
+//go:generate mockgen -destination=./piwigo_mock_test.go -package=plan git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo CategoryApi,ImageApi
+//go:generate mockgen -destination=./datastore_mock_test.go -package=plan git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore ImageMetadataProvider
+
+import (
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/datastore"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/manifest"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func planTestChecksum(filePath string) (string, string, error) {
+	return "md5-" + filepath.Base(filePath), "", nil
+}
+
+func planTestCategories() map[string]*piwigo.Category {
+	return map[string]*piwigo.Category{
+		"2019": {Id: 1, Name: "2019", Key: "2019"},
+	}
+}
+
+// Creates the images new.jpg and changed.jpg in 2019/Summer and current.jpg in 2019 and returns the scanned nodes.
+func createPlanTestFiles(t *testing.T) (string, map[string]*localFileStructure.FilesystemNode) {
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summer := filepath.Join(dir, "2019", "Summer")
+	err = os.MkdirAll(summer, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := map[string]*localFileStructure.FilesystemNode{
+		filepath.Join(dir, "2019"): {Key: "2019", Path: filepath.Join(dir, "2019"), Name: "2019", IsDir: true},
+		summer:                     {Key: filepath.Join("2019", "Summer"), Path: summer, Name: "Summer", IsDir: true},
+	}
+	for _, key := range []string{filepath.Join("2019", "Summer", "new.jpg"), filepath.Join("2019", "Summer", "changed.jpg"), filepath.Join("2019", "current.jpg")} {
+		path := filepath.Join(dir, key)
+		name := filepath.Base(key)
+		err = ioutil.WriteFile(path, []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[path] = &localFileStructure.FilesystemNode{Key: key, Path: path, Name: name, ModTime: info.ModTime(), Size: info.Size()}
+	}
+	return dir, nodes
+}
+
+func createTestPlan(t *testing.T, mockCtrl *gomock.Controller, dir string, nodes map[string]*localFileStructure.FilesystemNode) Plan {
+	summer := filepath.Join(dir, "2019", "Summer")
+	provider := NewMockImageMetadataProvider(mockCtrl)
+	provider.EXPECT().ImageMetadata(gomock.Any()).AnyTimes().DoAndReturn(func(path string) (datastore.ImageMetaData, error) {
+		if path == filepath.Join(summer, "changed.jpg") {
+			return datastore.ImageMetaData{FullImagePath: path, PiwigoId: 7}, nil
+		}
+		return datastore.ImageMetaData{}, datastore.ErrorRecordNotFound
+	})
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Return(planTestCategories(), nil)
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Return(map[string]int{"md5-current.jpg": 9}, nil)
+	imageApi.EXPECT().ImageCheckFile(7, "md5-changed.jpg").Return(piwigo.ImageStateDifferent, nil)
+	imageApi.EXPECT().GetCategoryImages(1).Return([]int{9}, nil)
+
+	plan, err := Create(categoryApi, imageApi, provider, nodes, planTestChecksum, "https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the plan is applied from its file
+	planPath := filepath.Join(dir, "plan.json")
+	err = plan.WriteFile(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = Read(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func Test_Create_plans_the_missing_and_different_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+
+	plan := createTestPlan(t, mockCtrl, dir, nodes)
+
+	expectedCategories := []PlannedCategory{{Key: "2019", PiwigoId: 1}, {Key: "2019/Summer"}}
+	if len(plan.Categories) != 2 || plan.Categories[0] != expectedCategories[0] || plan.Categories[1] != expectedCategories[1] {
+		t.Errorf("expected the categories %v but got %v", expectedCategories, plan.Categories)
+	}
+	if len(plan.Images) != 2 {
+		t.Fatalf("expected 2 planned images but got %v", plan.Images)
+	}
+	changed, created := plan.Images[0], plan.Images[1]
+	if changed.PiwigoId != 7 || changed.Category != "2019/Summer" || changed.Md5Sum != "md5-changed.jpg" {
+		t.Errorf("expected the replacement of image 7 but got %+v", changed)
+	}
+	if created.PiwigoId != 0 || created.Size != int64(len("new.jpg")) {
+		t.Errorf("expected the upload of the new image but got %+v", created)
+	}
+}
+
+func Test_Create_plans_to_match_content_missing_in_its_category(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+
+	provider := NewMockImageMetadataProvider(mockCtrl)
+	provider.EXPECT().ImageMetadata(gomock.Any()).AnyTimes().Return(datastore.ImageMetaData{}, datastore.ErrorRecordNotFound)
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Return(planTestCategories(), nil)
+	imageApi := NewMockImageApi(mockCtrl)
+	// the content of current.jpg is on the server, but in another category
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Return(map[string]int{"md5-current.jpg": 9}, nil)
+	imageApi.EXPECT().GetCategoryImages(1).Return([]int{4}, nil)
+
+	plan, err := Create(categoryApi, imageApi, provider, nodes, planTestChecksum, "https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Images) != 3 {
+		t.Fatalf("expected 3 planned images but got %v", plan.Images)
+	}
+	matched := plan.Images[2]
+	if matched.LocalPath != filepath.Join(dir, "2019", "current.jpg") || matched.MatchesId != 9 || matched.PiwigoId != 0 {
+		t.Errorf("expected current.jpg to be matched with image 9 but got %+v", matched)
+	}
+}
+
+func Test_Create_fails_if_the_image_to_replace_can_not_be_checked(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+	summer := filepath.Join(dir, "2019", "Summer")
+
+	provider := NewMockImageMetadataProvider(mockCtrl)
+	provider.EXPECT().ImageMetadata(gomock.Any()).AnyTimes().DoAndReturn(func(path string) (datastore.ImageMetaData, error) {
+		if path == filepath.Join(summer, "changed.jpg") {
+			return datastore.ImageMetaData{FullImagePath: path, PiwigoId: 7}, nil
+		}
+		return datastore.ImageMetaData{}, datastore.ErrorRecordNotFound
+	})
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Return(map[string]int{}, nil)
+	imageApi.EXPECT().ImageCheckFile(7, "md5-changed.jpg").Return(0, errors.New("timeout"))
+
+	_, err := Create(categoryApi, imageApi, provider, nodes, planTestChecksum, "https://example.com")
+	if err == nil {
+		t.Error("expected the error of the server instead of planning image 7 as new image")
+	}
+}
+
+func Test_Apply_uploads_the_planned_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+	plan := createTestPlan(t, mockCtrl, dir, nodes)
+	summer := filepath.Join(dir, "2019", "Summer")
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(2).Return(planTestCategories(), nil)
+	categoryApi.EXPECT().CreateCategoryWithSettings(1, "Summer", gomock.Any()).Return(5, nil)
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo([]string{"md5-new.jpg"}).Return(map[string]int{}, nil)
+	imageApi.EXPECT().ImageCheckFile(7, "md5-changed.jpg").Return(piwigo.ImageStateDifferent, nil)
+	imageApi.EXPECT().GetOrCreateTags(gomock.Any()).Return(map[string]int{}, nil)
+	imageApi.EXPECT().UploadImage(7, filepath.Join(summer, "changed.jpg"), "md5-changed.jpg", 5, gomock.Any()).Return(piwigo.UploadResult{ImageId: 7}, nil)
+	imageApi.EXPECT().UploadImage(0, filepath.Join(summer, "new.jpg"), "md5-new.jpg", 5, gomock.Any()).Return(piwigo.UploadResult{ImageId: 10}, nil)
+
+	results, err := Apply(categoryApi, imageApi, plan, manifest.Options{ChecksumCalculator: planTestChecksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].PiwigoId != 7 || results[1].PiwigoId != 10 || manifest.Failed(results) != 0 {
+		t.Errorf("expected both images to be uploaded but got %+v", results)
+	}
+}
+
+func Test_Apply_skips_files_that_changed_after_planning(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+	plan := createTestPlan(t, mockCtrl, dir, nodes)
+	summer := filepath.Join(dir, "2019", "Summer")
+
+	later := time.Now().Add(time.Hour)
+	err := os.Chtimes(filepath.Join(summer, "new.jpg"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories := planTestCategories()
+	// created by another run after the plan
+	categories["2019/Summer"] = &piwigo.Category{Id: 6, ParentId: 1, Name: "Summer", Key: "2019/Summer"}
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(2).Return(categories, nil)
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo([]string{"md5-new.jpg"}).Return(map[string]int{}, nil)
+	imageApi.EXPECT().ImageCheckFile(7, "md5-changed.jpg").Return(piwigo.ImageStateUptodate, nil)
+	imageApi.EXPECT().GetOrCreateTags(gomock.Any()).Return(map[string]int{}, nil)
+
+	results, err := Apply(categoryApi, imageApi, plan, manifest.Options{ChecksumCalculator: planTestChecksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Result != manifest.ResultMatched || results[0].PiwigoId != 7 {
+		t.Errorf("expected the image replaced in the meantime to be matched but got %+v", results[0])
+	}
+	if results[1].Result != manifest.ResultFailed || results[1].Reason != "the file changed after the plan was made" {
+		t.Errorf("expected the changed file to be skipped but got %+v", results[1])
+	}
+}
+
+func Test_Apply_aborts_if_the_image_to_replace_can_not_be_checked(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+	plan := createTestPlan(t, mockCtrl, dir, nodes)
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Return(planTestCategories(), nil)
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo([]string{"md5-new.jpg"}).Return(map[string]int{}, nil)
+	imageApi.EXPECT().ImageCheckFile(7, "md5-changed.jpg").Return(0, errors.New("timeout"))
+	imageApi.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := Apply(categoryApi, imageApi, plan, manifest.Options{ChecksumCalculator: planTestChecksum})
+	if err == nil {
+		t.Error("expected the error of the server instead of uploading a duplicate of image 7")
+	}
+}
+
+func Test_CheckServer_rejects_plans_of_another_server(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, nodes := createPlanTestFiles(t)
+	defer os.RemoveAll(dir)
+	plan := createTestPlan(t, mockCtrl, dir, nodes)
+
+	err := plan.CheckServer("https://example.com/")
+	if err != nil {
+		t.Errorf("expected the plan to be accepted for the server it was made for - %s", err)
+	}
+	err = plan.CheckServer("https://other.example.com")
+	if err == nil {
+		t.Error("expected an error as the plan was made for another server")
+	}
+}
+
+func Test_Read_rejects_other_versions(t *testing.T) {
+	file, err := ioutil.TempFile("", "plan*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, _ = file.WriteString(`{"version":2,"images":[]}`)
+	_ = file.Close()
+
+	_, err = Read(file.Name())
+	if err == nil {
+		t.Error("expected an error for a plan of another version")
+	}
+}
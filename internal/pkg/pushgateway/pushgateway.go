@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package pushgateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Metric struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// Pushes the metrics as gauges to the prometheus pushgateway using the text exposition format.
+// All metrics of the same job and instance get replaced on the pushgateway.
+func Push(gatewayUrl string, job string, instance string, metrics []Metric) error {
+	if gatewayUrl == "" || job == "" {
+		return errors.New("please provide the url of the pushgateway and the job name")
+	}
+
+	pushUrl := buildPushUrl(gatewayUrl, job, instance)
+	logrus.Debugf("Pushing %d metrics to %s", len(metrics), pushUrl)
+
+	request, err := http.NewRequest(http.MethodPut, pushUrl, bytes.NewReader(formatMetrics(metrics)))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusAccepted {
+		return errors.New(fmt.Sprintf("pushgateway responded with status %s", response.Status))
+	}
+	return nil
+}
+
+// The label values are base64 encoded as the instance may contain slashes (e.g. a path).
+func buildPushUrl(gatewayUrl string, job string, instance string) string {
+	pushUrl := fmt.Sprintf("%s/metrics/job@base64/%s", strings.TrimSuffix(gatewayUrl, "/"), base64.RawURLEncoding.EncodeToString([]byte(job)))
+	if instance != "" {
+		pushUrl = fmt.Sprintf("%s/instance@base64/%s", pushUrl, base64.RawURLEncoding.EncodeToString([]byte(instance)))
+	}
+	return pushUrl
+}
+
+func formatMetrics(metrics []Metric) []byte {
+	buffer := bytes.Buffer{}
+	for _, metric := range metrics {
+		if metric.Help != "" {
+			buffer.WriteString(fmt.Sprintf("# HELP %s %s\n", metric.Name, metric.Help))
+		}
+		buffer.WriteString(fmt.Sprintf("# TYPE %s gauge\n", metric.Name))
+		buffer.WriteString(fmt.Sprintf("%s %g\n", metric.Name, metric.Value))
+	}
+	return buffer.Bytes()
+}
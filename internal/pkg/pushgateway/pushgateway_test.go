@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package pushgateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Push_sends_metrics_to_job_and_instance(t *testing.T) {
+	var path string
+	var method string
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		method = r.Method
+		content, _ := ioutil.ReadAll(r.Body)
+		body = string(content)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	metrics := []Metric{{Name: "uploaded_images", Help: "Number of uploaded images.", Value: 3}}
+	err := Push(server.URL+"/", "uploader", "/home/photos", metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPut {
+		t.Errorf("Expected a PUT request but got %s", method)
+	}
+	if path != "/metrics/job@base64/dXBsb2FkZXI/instance@base64/L2hvbWUvcGhvdG9z" {
+		t.Errorf("Unexpected push path %s", path)
+	}
+	expectedBody := "# HELP uploaded_images Number of uploaded images.\n# TYPE uploaded_images gauge\nuploaded_images 3\n"
+	if body != expectedBody {
+		t.Errorf("Unexpected body:\n%s", body)
+	}
+}
+
+func Test_Push_fails_on_server_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := Push(server.URL, "uploader", "", []Metric{{Name: "uploaded_images", Value: 3}})
+	if err == nil {
+		t.Error("Expected an error as the pushgateway failed")
+	}
+}
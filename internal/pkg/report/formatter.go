@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+// The results of the records.
+const (
+	ResultUploaded    = "uploaded"
+	ResultMatched     = "matched"
+	ResultSkipped     = "skipped"
+	ResultFailed      = "failed"
+	ResultQuarantined = "quarantined"
+	ResultInvalid     = "invalid"
+	// the image got uploaded but the server resized the original
+	ResultResized = "resized"
+)
+
+// The formats the report can be written in.
+const (
+	FormatJson     = "json"
+	FormatCsv      = "csv"
+	FormatTemplate = "template"
+)
+
+// The data of the report of a run that gets rendered by the formatters.
+type ReportData struct {
+	Totals  Totals   `json:"totals"`
+	Records []Record `json:"records"`
+}
+
+// The number of images by result of all installations.
+type Totals struct {
+	Uploaded      int   `json:"uploaded"`
+	UploadedBytes int64 `json:"uploadedBytes"`
+	Matched       int   `json:"matched"`
+	Skipped       int   `json:"skipped"`
+	Failed        int   `json:"failed"`
+	Quarantined   int   `json:"quarantined"`
+	Invalid       int   `json:"invalid"`
+	Resized       int   `json:"resized"`
+}
+
+// What happened with a single image on one of the installations.
+type Record struct {
+	Target string `json:"target"`
+	Path   string `json:"path"`
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+	// the size of uploaded images, zero for the other results
+	SizeInBytes int64 `json:"sizeInBytes,omitempty"`
+}
+
+// Renders the report data.
+type Formatter interface {
+	Format(writer io.Writer, data ReportData) error
+}
+
+// Returns the formatter of the format. The template format renders the Go template in the file templatePath with the
+// ReportData.
+func NewFormatter(format string, templatePath string) (Formatter, error) {
+	switch format {
+	case FormatJson:
+		return jsonFormatter{}, nil
+	case FormatCsv:
+		return csvFormatter{}, nil
+	case FormatTemplate:
+		if templatePath == "" {
+			return nil, errors.New("the report format template requires a template file")
+		}
+		reportTemplate, err := template.New(filepath.Base(templatePath)).ParseFiles(templatePath)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("could not read the report template %s - %s", templatePath, err))
+		}
+		return templateFormatter{template: reportTemplate}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown report format %s. Use one of json, csv or template", format))
+	}
+}
+
+// Returns the data of the report with the target as installation of all records.
+func (r *Report) Data(target string) ReportData {
+	data := ReportData{Records: make([]Record, 0)}
+	if r == nil {
+		return data
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	data.Totals = Totals{
+		Uploaded:      r.uploaded,
+		UploadedBytes: r.uploadedBytes,
+		Matched:       r.matched,
+		Skipped:       len(r.skipped),
+		Failed:        len(r.failed),
+		Quarantined:   len(r.quarantined),
+		Invalid:       len(r.invalid),
+		Resized:       len(r.resized),
+	}
+	for _, file := range r.uploadedFiles {
+		data.Records = append(data.Records, Record{Target: target, Path: file.path, Result: ResultUploaded, SizeInBytes: file.sizeInBytes})
+	}
+	for _, path := range r.matchedFiles {
+		data.Records = append(data.Records, Record{Target: target, Path: path, Result: ResultMatched})
+	}
+	data.Records = appendRecords(data.Records, target, ResultSkipped, r.skipped)
+	data.Records = appendRecords(data.Records, target, ResultFailed, r.failed)
+	data.Records = appendRecords(data.Records, target, ResultQuarantined, r.quarantined)
+	data.Records = appendRecords(data.Records, target, ResultInvalid, r.invalid)
+	data.Records = appendRecords(data.Records, target, ResultResized, r.resized)
+	return data
+}
+
+func appendRecords(records []Record, target string, result string, entries []Entry) []Record {
+	for _, entry := range entries {
+		records = append(records, Record{Target: target, Path: entry.Path, Result: result, Reason: entry.Reason})
+	}
+	return records
+}
+
+// Sums up the data of the reports of several installations.
+func CombineData(data []ReportData) ReportData {
+	combined := ReportData{Records: make([]Record, 0)}
+	for _, d := range data {
+		combined.Totals.Uploaded += d.Totals.Uploaded
+		combined.Totals.UploadedBytes += d.Totals.UploadedBytes
+		combined.Totals.Matched += d.Totals.Matched
+		combined.Totals.Skipped += d.Totals.Skipped
+		combined.Totals.Failed += d.Totals.Failed
+		combined.Totals.Quarantined += d.Totals.Quarantined
+		combined.Totals.Invalid += d.Totals.Invalid
+		combined.Totals.Resized += d.Totals.Resized
+		combined.Records = append(combined.Records, d.Records...)
+	}
+	return combined
+}
+
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(writer io.Writer, data ReportData) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// Writes one row per record. The totals are left out as they are easily summed up in a spreadsheet.
+type csvFormatter struct{}
+
+func (csvFormatter) Format(writer io.Writer, data ReportData) error {
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write([]string{"target", "result", "path", "reason", "sizeInBytes"})
+	if err != nil {
+		return err
+	}
+	for _, record := range data.Records {
+		err = csvWriter.Write([]string{record.Target, record.Result, record.Path, record.Reason, strconv.FormatInt(record.SizeInBytes, 10)})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+type templateFormatter struct {
+	template *template.Template
+}
+
+func (formatter templateFormatter) Format(writer io.Writer, data ReportData) error {
+	return formatter.template.Execute(writer, data)
+}
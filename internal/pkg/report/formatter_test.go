@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package report
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testReportData = ReportData{
+	Totals: Totals{Uploaded: 1, UploadedBytes: 2048, Failed: 1},
+	Records: []Record{
+		{Target: "primary", Path: "/images/a.jpg", Result: ResultUploaded, SizeInBytes: 2048},
+		{Target: "backup", Path: "/images/b, c.jpg", Result: ResultFailed, Reason: "server error"},
+	},
+}
+
+func Test_json_formatter(t *testing.T) {
+	want := `{
+  "totals": {
+    "uploaded": 1,
+    "uploadedBytes": 2048,
+    "matched": 0,
+    "skipped": 0,
+    "failed": 1,
+    "quarantined": 0,
+    "invalid": 0,
+    "resized": 0
+  },
+  "records": [
+    {
+      "target": "primary",
+      "path": "/images/a.jpg",
+      "result": "uploaded",
+      "sizeInBytes": 2048
+    },
+    {
+      "target": "backup",
+      "path": "/images/b, c.jpg",
+      "result": "failed",
+      "reason": "server error"
+    }
+  ]
+}
+`
+	assertFormatted(t, FormatJson, "", want)
+}
+
+func Test_csv_formatter(t *testing.T) {
+	want := "target,result,path,reason,sizeInBytes\n" +
+		"primary,uploaded,/images/a.jpg,,2048\n" +
+		"backup,failed,\"/images/b, c.jpg\",server error,0\n"
+	assertFormatted(t, FormatCsv, "", want)
+}
+
+func Test_template_formatter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reporttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	templatePath := filepath.Join(dir, "report.tmpl")
+	content := "{{.Totals.Uploaded}} uploaded, {{.Totals.Failed}} failed\n{{range .Records}}{{.Result}} {{.Path}}\n{{end}}"
+	err = ioutil.WriteFile(templatePath, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "1 uploaded, 1 failed\nuploaded /images/a.jpg\nfailed /images/b, c.jpg\n"
+	assertFormatted(t, FormatTemplate, templatePath, want)
+}
+
+func Test_NewFormatter_rejects_invalid_formats(t *testing.T) {
+	for _, format := range []string{"xml", FormatTemplate} {
+		_, err := NewFormatter(format, "")
+		if err == nil {
+			t.Errorf("expected the format %s without template to be rejected", format)
+		}
+	}
+	_, err := NewFormatter(FormatTemplate, "/nonexisting/report.tmpl")
+	if err == nil {
+		t.Error("expected the missing template to be rejected")
+	}
+}
+
+func Test_Data_contains_the_records_and_totals_of_all_reports(t *testing.T) {
+	primary := NewReport()
+	primary.AddUploaded("/images/a.jpg", 2048)
+	primary.AddMatched("/images/b.jpg")
+	backup := NewReport()
+	backup.AddFailed("/images/a.jpg", "server error")
+
+	data := CombineData([]ReportData{primary.Data("primary"), backup.Data("backup")})
+	wantRecords := []Record{
+		{Target: "primary", Path: "/images/a.jpg", Result: ResultUploaded, SizeInBytes: 2048},
+		{Target: "primary", Path: "/images/b.jpg", Result: ResultMatched},
+		{Target: "backup", Path: "/images/a.jpg", Result: ResultFailed, Reason: "server error"},
+	}
+	if !reflect.DeepEqual(data.Records, wantRecords) {
+		t.Errorf("expected the records %v but got %v", wantRecords, data.Records)
+	}
+	if data.Totals != (Totals{Uploaded: 1, UploadedBytes: 2048, Matched: 1, Failed: 1}) {
+		t.Errorf("unexpected totals %v", data.Totals)
+	}
+}
+
+func assertFormatted(t *testing.T, format string, templatePath string, want string) {
+	formatter, err := NewFormatter(format, templatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := bytes.Buffer{}
+	err = formatter.Format(&buffer, testReportData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != want {
+		t.Errorf("unexpected %s output:\n%s", format, buffer.String())
+	}
+}
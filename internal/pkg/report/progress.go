@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// The progress periodically writes a single updating status line with the number of processed images,
+// the upload speed and the estimated remaining time. It reads the numbers from the report.
+type Progress struct {
+	report    *Report
+	total     int
+	processed int
+	start     time.Time
+	writer    io.Writer
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// Starts writing the progress of the given number of images to upload. The images already processed
+// when starting are not counted.
+func StartProgress(report *Report, total int, writer io.Writer, interval time.Duration) *Progress {
+	p := &Progress{
+		report:    report,
+		total:     total,
+		processed: report.processed(),
+		start:     time.Now(),
+		writer:    writer,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer close(p.stopped)
+		for {
+			select {
+			case <-ticker.C:
+				p.write("\r")
+			case <-p.done:
+				p.write("\r")
+				_, _ = io.WriteString(p.writer, "\n")
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Writes the final state of the progress and stops updating it.
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	<-p.stopped
+}
+
+func (p *Progress) write(prefix string) {
+	processed := p.report.processed() - p.processed
+	_, _ = io.WriteString(p.writer, prefix+formatProgress(processed, p.total, p.report.UploadedBytes(), time.Since(p.start)))
+}
+
+// returns the number of images that got uploaded, matched, failed, skipped or quarantined
+func (r *Report) processed() int {
+	if r == nil {
+		return 0
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.uploaded + r.matched + len(r.failed) + len(r.skipped) + len(r.quarantined)
+}
+
+func formatProgress(processed int, total int, uploadedBytes int64, elapsed time.Duration) string {
+	percent := 100
+	if total > 0 {
+		percent = processed * 100 / total
+	}
+
+	speed := 0.0
+	if elapsed > 0 {
+		speed = float64(uploadedBytes) / 1024 / 1024 / elapsed.Seconds()
+	}
+
+	eta := "--:--:--"
+	if processed > 0 && processed <= total {
+		remaining := time.Duration(float64(elapsed) / float64(processed) * float64(total-processed))
+		eta = formatDuration(remaining)
+	}
+
+	return fmt.Sprintf("Images %d/%d (%d%%), %.1f MB/s, ETA %s", processed, total, percent, speed, eta)
+}
+
+func formatDuration(duration time.Duration) string {
+	seconds := int(duration.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
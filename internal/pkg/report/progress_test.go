@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_formatProgress_calculates_speed_and_eta(t *testing.T) {
+	line := formatProgress(100, 400, 420*1024*1024, 100*time.Second)
+
+	expected := "Images 100/400 (25%), 4.2 MB/s, ETA 00:05:00"
+	if line != expected {
+		t.Errorf("expected %s but got %s", expected, line)
+	}
+}
+
+func Test_formatProgress_without_processed_images_has_no_eta(t *testing.T) {
+	line := formatProgress(0, 8540, 0, 0)
+
+	expected := "Images 0/8540 (0%), 0.0 MB/s, ETA --:--:--"
+	if line != expected {
+		t.Errorf("expected %s but got %s", expected, line)
+	}
+}
+
+func Test_Progress_ignores_images_processed_before_start(t *testing.T) {
+	report := NewReport()
+	report.AddUploaded("/nonexisting/file.jpg", 10)
+	report.AddSkipped("skipped.jpg", "too large")
+
+	output := bytes.Buffer{}
+	progress := StartProgress(report, 2, &output, time.Hour)
+	report.AddUploaded("/nonexisting/file.jpg", 10)
+	report.AddFailed("failed.jpg", "server error")
+	progress.Stop()
+
+	if !strings.HasPrefix(output.String(), "\rImages 2/2 (100%)") || !strings.HasSuffix(output.String(), "\n") {
+		t.Errorf("unexpected progress output %q", output.String())
+	}
+}
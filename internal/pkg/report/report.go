@@ -0,0 +1,240 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package report
+
+import (
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// An entry references a local file that needs attention of the user and why.
+type Entry struct {
+	Path   string
+	Reason string
+}
+
+// The report collects the results of a run that are printed at the end. All methods are safe to be called
+// concurrently and may be called on a nil report which makes the report optional for all callers.
+type Report struct {
+	mutex         sync.Mutex
+	uploaded      int
+	matched       int
+	uploadedBytes int64
+	// the paths of the uploaded and matched images in the order they completed
+	uploadedFiles []uploadedFile
+	matchedFiles  []string
+	skipped       []Entry
+	failed        []Entry
+	quarantined   []Entry
+	resized       []Entry
+	invalid       []Entry
+}
+
+type uploadedFile struct {
+	path        string
+	sizeInBytes int64
+}
+
+func NewReport() *Report {
+	return &Report{}
+}
+
+func (r *Report) AddUploaded(path string, sizeInBytes int64) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.uploaded++
+	r.uploadedBytes += sizeInBytes
+	r.uploadedFiles = append(r.uploadedFiles, uploadedFile{path: path, sizeInBytes: sizeInBytes})
+}
+
+// Counts an image that was not uploaded as its content already existed on the server.
+func (r *Report) AddMatched(path string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.matched++
+	r.matchedFiles = append(r.matchedFiles, path)
+}
+
+func (r *Report) AddSkipped(path string, reason string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.skipped = append(r.skipped, Entry{Path: path, Reason: reason})
+}
+
+func (r *Report) AddFailed(path string, reason string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failed = append(r.failed, Entry{Path: path, Reason: reason})
+}
+
+// Records an uploaded image that got deleted again as failed, e.g. as the upload of its album got rolled back.
+func (r *Report) AddRolledBack(path string, reason string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, file := range r.uploadedFiles {
+		if file.path == path {
+			r.uploaded--
+			r.uploadedBytes -= file.sizeInBytes
+			r.uploadedFiles = append(r.uploadedFiles[:i], r.uploadedFiles[i+1:]...)
+			break
+		}
+	}
+	r.failed = append(r.failed, Entry{Path: path, Reason: reason})
+}
+
+// Records an image that is not uploaded as its uploads failed too often.
+func (r *Report) AddQuarantined(path string, reason string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.quarantined = append(r.quarantined, Entry{Path: path, Reason: reason})
+}
+
+// Records an uploaded image whose original got resized by the server, so only the resized version is stored.
+func (r *Report) AddResized(path string, reason string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.resized = append(r.resized, Entry{Path: path, Reason: reason})
+}
+
+// Records an image that is not uploaded as it could not be decoded or does not meet the constraints.
+func (r *Report) AddInvalid(path string, reason string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.invalid = append(r.invalid, Entry{Path: path, Reason: reason})
+}
+
+func (r *Report) UploadedBytes() int64 {
+	if r == nil {
+		return 0
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.uploadedBytes
+}
+
+func (r *Report) Failed() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	failed := make([]Entry, len(r.failed))
+	copy(failed, r.failed)
+	return failed
+}
+
+func (r *Report) Uploaded() int {
+	if r == nil {
+		return 0
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.uploaded
+}
+
+func (r *Report) Matched() int {
+	if r == nil {
+		return 0
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.matched
+}
+
+func (r *Report) Skipped() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	skipped := make([]Entry, len(r.skipped))
+	copy(skipped, r.skipped)
+	return skipped
+}
+
+func (r *Report) Quarantined() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	quarantined := make([]Entry, len(r.quarantined))
+	copy(quarantined, r.quarantined)
+	return quarantined
+}
+
+func (r *Report) Resized() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	resized := make([]Entry, len(r.resized))
+	copy(resized, r.resized)
+	return resized
+}
+
+func (r *Report) Invalid() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	invalid := make([]Entry, len(r.invalid))
+	copy(invalid, r.invalid)
+	return invalid
+}
+
+func (r *Report) Log() {
+	if r == nil {
+		return
+	}
+
+	skipped := r.Skipped()
+	failed := r.Failed()
+	quarantined := r.Quarantined()
+	invalid := r.Invalid()
+	logrus.Infof("Summary: %d images uploaded (%d KB), %d images matched existing, %d images skipped, %d images failed, %d images quarantined, %d images invalid", r.Uploaded(), r.UploadedBytes()/1024, r.Matched(), len(skipped), len(failed), len(quarantined), len(invalid))
+	for _, entry := range skipped {
+		logrus.Warnf("Skipped %s: %s", entry.Path, entry.Reason)
+	}
+	for _, entry := range failed {
+		logrus.Errorf("Failed %s: %s", entry.Path, entry.Reason)
+	}
+	for _, entry := range quarantined {
+		logrus.Warnf("Quarantined %s: %s", entry.Path, entry.Reason)
+	}
+	for _, entry := range invalid {
+		logrus.Warnf("Invalid %s: %s", entry.Path, entry.Reason)
+	}
+	for _, entry := range r.Resized() {
+		logrus.Warnf("Original not kept %s: %s", entry.Path, entry.Reason)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package report
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_report_counts_concurrent_entries(t *testing.T) {
+	r := NewReport()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			r.AddUploaded("/nonexisting/file.jpg", 100)
+			r.AddSkipped("/nonexisting/file.jpg", "too large")
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	if r.Uploaded() != 10 {
+		t.Errorf("Expected 10 uploaded images but got %d", r.Uploaded())
+	}
+	if len(r.Skipped()) != 10 {
+		t.Errorf("Expected 10 skipped images but got %d", len(r.Skipped()))
+	}
+	if r.UploadedBytes() != 1000 {
+		t.Errorf("Expected 1000 uploaded bytes but got %d", r.UploadedBytes())
+	}
+}
+
+func Test_nil_report_does_not_panic(t *testing.T) {
+	var r *Report
+	r.AddUploaded("/nonexisting/file.jpg", 100)
+	r.AddSkipped("/nonexisting/file.jpg", "too large")
+	r.AddFailed("/nonexisting/file.jpg", "server error")
+	r.AddResized("/nonexisting/file.jpg", "resized to 800x600")
+	r.AddInvalid("/nonexisting/file.jpg", "unexpected EOF")
+	r.AddRolledBack("/nonexisting/file.jpg", "rolled back")
+	r.Log()
+
+	if r.Uploaded() != 0 || len(r.Skipped()) != 0 || len(r.Failed()) != 0 || len(r.Resized()) != 0 || len(r.Invalid()) != 0 {
+		t.Error("A nil report should not contain anything")
+	}
+}
+
+func Test_AddRolledBack_moves_the_uploaded_image_to_the_failed_images(t *testing.T) {
+	r := NewReport()
+	r.AddUploaded("a.jpg", 100)
+	r.AddUploaded("b.jpg", 200)
+	r.AddRolledBack("a.jpg", "rolled back")
+
+	if r.Uploaded() != 1 || r.UploadedBytes() != 200 {
+		t.Errorf("expected 1 uploaded image of 200 bytes but got %d of %d bytes", r.Uploaded(), r.UploadedBytes())
+	}
+	failed := r.Failed()
+	if len(failed) != 1 || failed[0] != (Entry{Path: "a.jpg", Reason: "rolled back"}) {
+		t.Errorf("expected the rolled back image to be failed but got %v", failed)
+	}
+}
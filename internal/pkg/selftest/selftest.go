@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package selftest
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/sirupsen/logrus"
+	"image"
+	"image/color"
+	"image/png"
+	"time"
+)
+
+// the number of generated images that are tried if the content already exists on the server
+const maxImageAttempts = 3
+
+// Creates a temporary category, uploads a generated image of one pixel into it, verifies the image and removes both
+// again. Only the category and the image created by the self-test are removed. The test stops before anything gets
+// uploaded if the category name or the generated image already exist on the server. The returned error names the
+// operation that failed.
+func Run(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, workDir *workdir.WorkDir) error {
+	logrus.Debug("Entering selftest.Run")
+	defer logrus.Debug("Leaving selftest.Run")
+
+	categoryName := fmt.Sprintf("PiwigoDirectoryUploader self-test %s", time.Now().Format("20060102T150405"))
+	categories, err := categoryApi.GetAllCategories()
+	if err != nil {
+		return stepError("list the categories", err)
+	}
+	if _, found := categories[categoryName]; found {
+		return stepError("create the category", errors.New(fmt.Sprintf("the category %s already exists and is not touched", categoryName)))
+	}
+
+	imagePath, md5sum, err := generateUniqueImage(imageApi, workDir)
+	if err != nil {
+		return err
+	}
+
+	categoryId, err := categoryApi.CreateCategory(0, categoryName)
+	if err != nil {
+		return stepError("create the category", err)
+	}
+	logrus.Infof("Created the self-test category %s with id %d", categoryName, categoryId)
+
+	imageId, err := uploadImage(imageApi, imagePath, md5sum, categoryId)
+	if err == nil {
+		err = verifyImage(imageApi, imageId, md5sum, categoryId)
+	}
+	if err == nil && imageId > 0 {
+		err = imageApi.DeleteImages([]int{imageId})
+		if err != nil {
+			err = stepError("delete the image", err)
+		}
+		imageId = 0
+	}
+
+	if err != nil {
+		// the created content is removed even if a step failed, the error of the failed step is returned
+		cleanup(categoryApi, imageApi, categoryId, imageId)
+		return err
+	}
+
+	err = categoryApi.DeleteCategory(categoryId)
+	if err != nil {
+		return stepError("delete the category", err)
+	}
+	return nil
+}
+
+func stepError(step string, err error) error {
+	return errors.New(fmt.Sprintf("self-test failed to %s: %s", step, err))
+}
+
+// Generates images until there is one whose md5sum is unknown to the server. An image with a known md5sum would
+// be matched with the existing image, which must never get deleted by the self-test.
+func generateUniqueImage(imageApi piwigo.ImageApi, workDir *workdir.WorkDir) (string, string, error) {
+	for attempt := 0; attempt < maxImageAttempts; attempt++ {
+		imagePath, err := generateImage(workDir)
+		if err != nil {
+			return "", "", stepError("generate the image", err)
+		}
+		md5sum, err := localFileStructure.CalculateFileCheckSums(imagePath)
+		if err != nil {
+			return "", "", stepError("generate the image", err)
+		}
+
+		existing, err := imageApi.ImagesExistOnPiwigo([]string{md5sum})
+		if err != nil {
+			return "", "", stepError("check the image", err)
+		}
+		if existing[md5sum] == 0 {
+			return imagePath, md5sum, nil
+		}
+		logrus.Debugf("The generated image %s already exists on the server", md5sum)
+	}
+	return "", "", stepError("generate the image", errors.New("all generated images already exist on the server"))
+}
+
+// Writes a png image of one pixel with a random color.
+func generateImage(workDir *workdir.WorkDir) (string, error) {
+	randomColor := make([]byte, 4)
+	_, err := rand.Read(randomColor)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := workDir.CreateFile("selftest*.png")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	pixel := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	pixel.Set(0, 0, color.NRGBA{R: randomColor[0], G: randomColor[1], B: randomColor[2], A: randomColor[3] | 1})
+	err = png.Encode(file, pixel)
+	if err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func uploadImage(imageApi piwigo.ImageApi, imagePath string, md5sum string, categoryId int) (int, error) {
+	result, err := imageApi.UploadImage(0, imagePath, md5sum, categoryId, piwigo.NewCorrelationId())
+	if err != nil {
+		return 0, stepError("upload the image", err)
+	}
+	if result.MatchedExisting {
+		// the existing image is only assigned to the category and has to stay on the server
+		return 0, stepError("upload the image", errors.New(fmt.Sprintf("the server matched the existing image %d", result.ImageId)))
+	}
+	logrus.Infof("Uploaded the self-test image with id %d", result.ImageId)
+	return result.ImageId, nil
+}
+
+func verifyImage(imageApi piwigo.ImageApi, imageId int, md5sum string, categoryId int) error {
+	info, err := imageApi.GetImageInfo(imageId)
+	if err != nil {
+		return stepError("verify the image", err)
+	}
+	if info.Md5Sum != "" && info.Md5Sum != md5sum {
+		return stepError("verify the image", errors.New(fmt.Sprintf("the image got the md5sum %s instead of %s", info.Md5Sum, md5sum)))
+	}
+	for _, id := range info.CategoryIds {
+		if id == categoryId {
+			return nil
+		}
+	}
+	return stepError("verify the image", errors.New(fmt.Sprintf("the image is not assigned to the category %d", categoryId)))
+}
+
+func cleanup(categoryApi piwigo.CategoryApi, imageApi piwigo.ImageApi, categoryId int, imageId int) {
+	if imageId > 0 {
+		err := imageApi.DeleteImages([]int{imageId})
+		if err != nil {
+			logrus.Warnf("Could not delete the self-test image %d - %s", imageId, err)
+		}
+	}
+	err := categoryApi.DeleteCategory(categoryId)
+	if err != nil {
+		logrus.Warnf("Could not delete the self-test category %d - %s", categoryId, err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package selftest
+
+//go:generate mockgen -destination=./piwigo_mock_test.go -package=selftest git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo CategoryApi,ImageApi
+
+import (
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/piwigo"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/golang/mock/gomock"
+	"strings"
+	"testing"
+)
+
+func Test_Run_removes_the_created_content(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{}, nil)
+	categoryApi.EXPECT().CreateCategory(0, gomock.Any()).Times(1).Return(3, nil)
+	categoryApi.EXPECT().DeleteCategory(3).Times(1).Return(nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Times(1).Return(map[string]int{}, nil)
+	imageApi.EXPECT().UploadImage(0, gomock.Any(), gomock.Any(), 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 7}, nil)
+	imageApi.EXPECT().GetImageInfo(7).Times(1).Return(&piwigo.ImageInfo{Id: 7, CategoryIds: []int{3}}, nil)
+	imageApi.EXPECT().DeleteImages([]int{7}).Times(1).Return(nil)
+
+	err := Run(categoryApi, imageApi, createWorkDir(t))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Run_never_deletes_matched_images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{}, nil)
+	categoryApi.EXPECT().CreateCategory(0, gomock.Any()).Times(1).Return(3, nil)
+	categoryApi.EXPECT().DeleteCategory(3).Times(1).Return(nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Times(1).Return(map[string]int{}, nil)
+	imageApi.EXPECT().UploadImage(0, gomock.Any(), gomock.Any(), 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 7, MatchedExisting: true}, nil)
+	imageApi.EXPECT().DeleteImages(gomock.Any()).Times(0)
+
+	err := Run(categoryApi, imageApi, createWorkDir(t))
+	assertFailedStep(t, err, "upload the image")
+}
+
+func Test_Run_does_not_create_anything_if_the_images_exist(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{}, nil)
+	categoryApi.EXPECT().CreateCategory(gomock.Any(), gomock.Any()).Times(0)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Times(maxImageAttempts).DoAndReturn(func(md5sums []string) (map[string]int, error) {
+		return map[string]int{md5sums[0]: 1}, nil
+	})
+
+	err := Run(categoryApi, imageApi, createWorkDir(t))
+	assertFailedStep(t, err, "generate the image")
+}
+
+func Test_Run_removes_the_content_if_the_verification_fails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	categoryApi := NewMockCategoryApi(mockCtrl)
+	categoryApi.EXPECT().GetAllCategories().Times(1).Return(map[string]*piwigo.Category{}, nil)
+	categoryApi.EXPECT().CreateCategory(0, gomock.Any()).Times(1).Return(3, nil)
+	categoryApi.EXPECT().DeleteCategory(3).Times(1).Return(nil)
+
+	imageApi := NewMockImageApi(mockCtrl)
+	imageApi.EXPECT().ImagesExistOnPiwigo(gomock.Any()).Times(1).Return(map[string]int{}, nil)
+	imageApi.EXPECT().UploadImage(0, gomock.Any(), gomock.Any(), 3, gomock.Any()).Times(1).Return(piwigo.UploadResult{ImageId: 7}, nil)
+	imageApi.EXPECT().GetImageInfo(7).Times(1).Return(&piwigo.ImageInfo{Id: 7, Md5Sum: "other"}, nil)
+	imageApi.EXPECT().DeleteImages([]int{7}).Times(1).Return(nil)
+
+	err := Run(categoryApi, imageApi, createWorkDir(t))
+	assertFailedStep(t, err, "verify the image")
+}
+
+func assertFailedStep(t *testing.T, err error, step string) {
+	if err == nil {
+		t.Fatalf("expected the step %s to fail", step)
+	}
+	if !strings.HasPrefix(err.Error(), "self-test failed to "+step) {
+		t.Errorf("expected the step %s to fail but got %s", step, err)
+	}
+}
+
+func createWorkDir(t *testing.T) *workdir.WorkDir {
+	dir, err := workdir.Create("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dir.Remove() })
+	return dir
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"github.com/sirupsen/logrus"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+// Rotates and flips jpeg images according to the exif orientation. The exif data is kept but the orientation
+// is reset to 1 (normal) to prevent viewers from rotating the image again.
+// Images without an exif orientation and formats other than jpeg are returned untouched.
+func AutoRotate(content []byte) ([]byte, bool, error) {
+	if !isJpeg(content) {
+		return content, false, nil
+	}
+
+	segment, err := findExifSegment(content)
+	if err != nil || segment == nil {
+		return content, false, err
+	}
+
+	exifSegment := make([]byte, segment.end-segment.start)
+	copy(exifSegment, content[segment.start:segment.end])
+	exif, err := parseExif(exifSegment[4:])
+	if err != nil {
+		return content, false, err
+	}
+
+	orientation, err := exif.orientation()
+	if err != nil || orientation <= 1 || orientation > 8 {
+		return content, false, err
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil {
+		return content, false, err
+	}
+
+	logrus.Tracef("Applying exif orientation %d", orientation)
+	rotated := applyOrientation(decoded, orientation)
+
+	encoded := bytes.Buffer{}
+	err = jpeg.Encode(&encoded, rotated, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return content, false, err
+	}
+
+	err = exif.setOrientation(1)
+	if err != nil {
+		return content, false, err
+	}
+
+	return insertJpegSegments(encoded.Bytes(), exifSegment), true, nil
+}
+
+// Transforms the image as stored to the image as it should be displayed according to the exif orientation.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	source := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(source, source.Bounds(), img, bounds.Min, draw.Src)
+
+	width := bounds.Dx()
+	height := bounds.Dy()
+	targetWidth, targetHeight := width, height
+	if orientation >= 5 {
+		targetWidth, targetHeight = height, width
+	}
+	target := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	for y := 0; y < targetHeight; y++ {
+		for x := 0; x < targetWidth; x++ {
+			var sourceX, sourceY int
+			switch orientation {
+			case 2:
+				sourceX, sourceY = width-1-x, y
+			case 3:
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4:
+				sourceX, sourceY = x, height-1-y
+			case 5:
+				sourceX, sourceY = y, x
+			case 6:
+				sourceX, sourceY = y, height-1-x
+			case 7:
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8:
+				sourceX, sourceY = width-1-y, x
+			default:
+				sourceX, sourceY = x, y
+			}
+
+			sourceOffset := source.PixOffset(sourceX, sourceY)
+			targetOffset := target.PixOffset(x, y)
+			copy(target.Pix[targetOffset:targetOffset+4], source.Pix[sourceOffset:sourceOffset+4])
+		}
+	}
+	return target
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+const fixtureWidth = 64
+const fixtureHeight = 32
+
+func Test_AutoRotate_applies_all_orientations(t *testing.T) {
+	// quadrants of the displayed image: top left, top right, bottom left, bottom right
+	tests := []struct {
+		orientation int
+		quadrants   [4]color.RGBA
+	}{
+		{1, [4]color.RGBA{red, green, blue, white}},
+		{2, [4]color.RGBA{green, red, white, blue}},
+		{3, [4]color.RGBA{white, blue, green, red}},
+		{4, [4]color.RGBA{blue, white, red, green}},
+		{5, [4]color.RGBA{red, blue, green, white}},
+		{6, [4]color.RGBA{blue, red, white, green}},
+		{7, [4]color.RGBA{white, green, blue, red}},
+		{8, [4]color.RGBA{green, white, red, blue}},
+	}
+
+	for _, test := range tests {
+		content := createJpegWithOrientation(t, test.orientation)
+
+		rotated, changed, err := AutoRotate(content)
+		if err != nil {
+			t.Fatalf("orientation %d: unexpected error %s", test.orientation, err)
+		}
+		if changed != (test.orientation != 1) {
+			t.Errorf("orientation %d: unexpected changed flag %t", test.orientation, changed)
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(rotated))
+		if err != nil {
+			t.Fatalf("orientation %d: could not decode result %s", test.orientation, err)
+		}
+
+		width, height := fixtureWidth, fixtureHeight
+		if test.orientation >= 5 {
+			width, height = fixtureHeight, fixtureWidth
+		}
+		if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+			t.Errorf("orientation %d: expected size %dx%d but got %dx%d", test.orientation, width, height, img.Bounds().Dx(), img.Bounds().Dy())
+			continue
+		}
+
+		samples := []image.Point{{width / 4, height / 4}, {width * 3 / 4, height / 4}, {width / 4, height * 3 / 4}, {width * 3 / 4, height * 3 / 4}}
+		for i, sample := range samples {
+			if !isSimilarColor(img.At(sample.X, sample.Y), test.quadrants[i]) {
+				t.Errorf("orientation %d: unexpected color %v in quadrant %d, expected %v", test.orientation, img.At(sample.X, sample.Y), i, test.quadrants[i])
+			}
+		}
+
+		assertOrientation(t, rotated, 1)
+	}
+}
+
+func Test_AutoRotate_ignores_images_without_exif(t *testing.T) {
+	content := encodeJpeg(t, createQuadrantImage())
+
+	result, changed, err := AutoRotate(content)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if changed || !bytes.Equal(result, content) {
+		t.Error("expected the image without exif data to stay untouched")
+	}
+}
+
+func Test_AutoRotate_ignores_other_formats(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := png.Encode(&buffer, createQuadrantImage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, changed, err := AutoRotate(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if changed || !bytes.Equal(result, buffer.Bytes()) {
+		t.Error("expected the png image to stay untouched")
+	}
+}
+
+func Test_AutoRotate_is_deterministic(t *testing.T) {
+	content := createJpegWithOrientation(t, 6)
+
+	first, _, _ := AutoRotate(content)
+	second, _, _ := AutoRotate(content)
+	if !bytes.Equal(first, second) {
+		t.Error("expected the same result for the same image as the md5sum relies on it")
+	}
+}
+
+func assertOrientation(t *testing.T, content []byte, expected int) {
+	segment, err := findExifSegment(content)
+	if err != nil || segment == nil {
+		t.Fatalf("expected exif data to be kept - %v", err)
+	}
+	exif, err := parseExif(segment.payload(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orientation, err := exif.orientation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation != expected {
+		t.Errorf("expected exif orientation %d but got %d", expected, orientation)
+	}
+}
+
+func isSimilarColor(actual color.Color, expected color.RGBA) bool {
+	r, g, b, _ := actual.RGBA()
+	return isSimilarChannel(r>>8, expected.R) && isSimilarChannel(g>>8, expected.G) && isSimilarChannel(b>>8, expected.B)
+}
+
+func isSimilarChannel(actual uint32, expected uint8) bool {
+	difference := int(actual) - int(expected)
+	return difference > -48 && difference < 48
+}
+
+func createQuadrantImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, fixtureWidth, fixtureHeight))
+	for y := 0; y < fixtureHeight; y++ {
+		for x := 0; x < fixtureWidth; x++ {
+			left := x < fixtureWidth/2
+			top := y < fixtureHeight/2
+			switch {
+			case top && left:
+				img.Set(x, y, red)
+			case top:
+				img.Set(x, y, green)
+			case left:
+				img.Set(x, y, blue)
+			default:
+				img.Set(x, y, white)
+			}
+		}
+	}
+	return img
+}
+
+func encodeJpeg(t *testing.T, img image.Image) []byte {
+	buffer := bytes.Buffer{}
+	err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// Creates a jpeg with an exif segment only containing the orientation in IFD0.
+func createJpegWithOrientation(t *testing.T, orientation int) []byte {
+	tiff := bytes.Buffer{}
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(1))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(exifTagOrientation))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(exifTypeShort))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(orientation))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint16(0))
+	_ = binary.Write(&tiff, binary.LittleEndian, uint32(0))
+
+	return insertJpegSegments(encodeJpeg(t, createQuadrantImage()), createApp1Segment(append(exifHeader, tiff.Bytes()...)))
+}
+
+func createApp1Segment(payload []byte) []byte {
+	segment := bytes.Buffer{}
+	segment.Write([]byte{0xFF, jpegMarkerAPP1})
+	_ = binary.Write(&segment, binary.BigEndian, uint16(len(payload)+2))
+	segment.Write(payload)
+	return segment.Bytes()
+}
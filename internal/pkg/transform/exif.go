@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	exifTagOrientation = 0x0112
+	exifTagGpsIfd      = 0x8825
+	exifTypeShort      = 3
+)
+
+// the size in bytes of a single value of the exif field types
+var exifTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// A minimal reader and editor of the TIFF structure of exif data. It supports only what is needed
+// to transform images and edits the data in place.
+type exifData struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag       uint16
+	fieldType uint16
+	count     uint32
+	// position of the entry within the tiff data
+	position int
+}
+
+// Parses the payload of an APP1 segment starting with the exif header.
+func parseExif(payload []byte) (*exifData, error) {
+	if len(payload) < len(exifHeader)+8 {
+		return nil, errors.New("exif data too short")
+	}
+
+	tiff := payload[len(exifHeader):]
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid byte order of exif data")
+	}
+
+	if order.Uint16(tiff[2:4]) != 42 {
+		return nil, errors.New("invalid tiff header of exif data")
+	}
+
+	return &exifData{tiff: tiff, order: order}, nil
+}
+
+func (e *exifData) ifd0Offset() uint32 {
+	return e.order.Uint32(e.tiff[4:8])
+}
+
+func (e *exifData) readIfd(offset uint32) ([]ifdEntry, error) {
+	if int(offset)+2 > len(e.tiff) {
+		return nil, errors.New("invalid ifd offset in exif data")
+	}
+
+	count := int(e.order.Uint16(e.tiff[offset : offset+2]))
+	if int(offset)+2+count*12+4 > len(e.tiff) {
+		return nil, errors.New("invalid ifd size in exif data")
+	}
+
+	entries := make([]ifdEntry, 0, count)
+	for i := 0; i < count; i++ {
+		position := int(offset) + 2 + i*12
+		entries = append(entries, ifdEntry{
+			tag:       e.order.Uint16(e.tiff[position : position+2]),
+			fieldType: e.order.Uint16(e.tiff[position+2 : position+4]),
+			count:     e.order.Uint32(e.tiff[position+4 : position+8]),
+			position:  position,
+		})
+	}
+	return entries, nil
+}
+
+func (e *exifData) findIfd0Entry(tag uint16) (*ifdEntry, error) {
+	return e.findEntry(e.ifd0Offset(), tag)
+}
+
+// Returns the exif orientation (1-8) or zero if the orientation is not set.
+func (e *exifData) orientation() (int, error) {
+	entry, err := e.findIfd0Entry(exifTagOrientation)
+	if err != nil || entry == nil {
+		return 0, err
+	}
+	if entry.fieldType != exifTypeShort || entry.count != 1 {
+		return 0, errors.New("invalid type of exif orientation")
+	}
+	return int(e.order.Uint16(e.tiff[entry.position+8 : entry.position+10])), nil
+}
+
+func (e *exifData) setOrientation(orientation int) error {
+	entry, err := e.findIfd0Entry(exifTagOrientation)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("there is no exif orientation to update")
+	}
+	e.order.PutUint16(e.tiff[entry.position+8:entry.position+10], uint16(orientation))
+	return nil
+}
+
+// Removes the GPS IFD and its values. The data is overwritten with zeros, so the position does not
+// remain in the file. Returns false if there is no GPS IFD.
+func (e *exifData) removeGps() (bool, error) {
+	entry, err := e.findIfd0Entry(exifTagGpsIfd)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	gpsOffset := e.order.Uint32(e.tiff[entry.position+8 : entry.position+12])
+	gpsEntries, err := e.readIfd(gpsOffset)
+	if err != nil {
+		return false, err
+	}
+	for _, gpsEntry := range gpsEntries {
+		size := exifTypeSizes[gpsEntry.fieldType] * int(gpsEntry.count)
+		if size <= 4 {
+			// the value is stored in the entry itself
+			continue
+		}
+		valueOffset := int(e.order.Uint32(e.tiff[gpsEntry.position+8 : gpsEntry.position+12]))
+		if valueOffset+size > len(e.tiff) {
+			return false, errors.New("invalid gps value offset in exif data")
+		}
+		zero(e.tiff[valueOffset : valueOffset+size])
+	}
+	zero(e.tiff[gpsOffset : int(gpsOffset)+2+len(gpsEntries)*12+4])
+
+	return true, e.removeIfd0Entry(entry)
+}
+
+// Removes the entry from IFD0 by moving the following entries and the offset of the next IFD.
+func (e *exifData) removeIfd0Entry(entry *ifdEntry) error {
+	offset := int(e.ifd0Offset())
+	count := int(e.order.Uint16(e.tiff[offset : offset+2]))
+	if count == 0 {
+		return errors.New("there is no exif entry to remove")
+	}
+
+	end := offset + 2 + count*12 + 4
+	copy(e.tiff[entry.position:end-12], e.tiff[entry.position+12:end])
+	zero(e.tiff[end-12 : end])
+	e.order.PutUint16(e.tiff[offset:offset+2], uint16(count-1))
+	return nil
+}
+
+func zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	exifTagDateTime         = 0x0132
+	exifTagExifIfd          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+	exifTypeAscii           = 2
+)
+
+// Returns the date the photo was taken as "2006:01:02 15:04:05" from the exif data of jpeg images. The date of the
+// last change is used if the original date is missing. Returns false if the image has no exif date.
+func ExifDate(content []byte) (string, bool, error) {
+	if !isJpeg(content) {
+		return "", false, ErrorUnsupportedFormat
+	}
+
+	segment, err := findExifSegment(content)
+	if err != nil || segment == nil {
+		return "", false, err
+	}
+	exif, err := parseExif(segment.payload(content))
+	if err != nil {
+		return "", false, err
+	}
+
+	entry, err := exif.findIfd0Entry(exifTagExifIfd)
+	if err != nil {
+		return "", false, err
+	}
+	if entry != nil {
+		exifIfdOffset := exif.order.Uint32(exif.tiff[entry.position+8 : entry.position+12])
+		original, err := exif.findEntry(exifIfdOffset, exifTagDateTimeOriginal)
+		if err != nil {
+			return "", false, err
+		}
+		if original != nil {
+			return exif.asciiValue(original)
+		}
+	}
+
+	entry, err = exif.findIfd0Entry(exifTagDateTime)
+	if err != nil || entry == nil {
+		return "", false, err
+	}
+	return exif.asciiValue(entry)
+}
+
+func (e *exifData) findEntry(offset uint32, tag uint16) (*ifdEntry, error) {
+	entries, err := e.readIfd(offset)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.tag == tag {
+			return &entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// Ascii values of more than four bytes are stored at the offset given in the entry.
+func (e *exifData) asciiValue(entry *ifdEntry) (string, bool, error) {
+	if entry.fieldType != exifTypeAscii {
+		return "", false, errors.New("invalid type of exif date")
+	}
+
+	start := entry.position + 8
+	if entry.count > 4 {
+		start = int(e.order.Uint32(e.tiff[entry.position+8 : entry.position+12]))
+	}
+	end := start + int(entry.count)
+	if start < 0 || end > len(e.tiff) {
+		return "", false, errors.New("invalid offset of exif date")
+	}
+
+	value := strings.TrimSpace(strings.TrimRight(string(e.tiff[start:end]), "\x00"))
+	return value, value != "", nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Creates a jpeg whose IFD0 contains the date of the last change and whose exif IFD contains the original date
+// if it is given.
+func createJpegWithDates(t *testing.T, dateTime string, dateTimeOriginal string) []byte {
+	order := binary.LittleEndian
+	tiff := bytes.Buffer{}
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, order, uint16(42))
+	_ = binary.Write(&tiff, order, uint32(8))
+
+	// IFD0 at 8 with two entries, the exif IFD follows at 8+2+2*12+4 = 38 and the values at 38+2+12+4 = 56
+	_ = binary.Write(&tiff, order, uint16(2))
+	_ = binary.Write(&tiff, order, []uint16{exifTagDateTime, exifTypeAscii})
+	_ = binary.Write(&tiff, order, []uint32{20, 56})
+	_ = binary.Write(&tiff, order, []uint16{exifTagExifIfd, 4})
+	_ = binary.Write(&tiff, order, []uint32{1, 38})
+	_ = binary.Write(&tiff, order, uint32(0))
+
+	tag := uint16(exifTagDateTimeOriginal)
+	if dateTimeOriginal == "" {
+		// an unrelated tag keeps the layout the same
+		tag = 0x9004
+	}
+	_ = binary.Write(&tiff, order, uint16(1))
+	_ = binary.Write(&tiff, order, []uint16{tag, exifTypeAscii})
+	_ = binary.Write(&tiff, order, []uint32{20, 76})
+	_ = binary.Write(&tiff, order, uint32(0))
+
+	tiff.WriteString(dateTime + "\x00")
+	tiff.WriteString("2000:01:01 00:00:00\x00")
+	if dateTimeOriginal != "" {
+		tiff.Bytes()[76] = 0
+		tiff.Truncate(76)
+		tiff.WriteString(dateTimeOriginal + "\x00")
+	}
+
+	return insertJpegSegments(encodeJpeg(t, createQuadrantImage()), createApp1Segment(append(exifHeader, tiff.Bytes()...)))
+}
+
+func Test_ExifDate_prefers_the_original_date(t *testing.T) {
+	content := createJpegWithDates(t, "2020:05:06 07:08:09", "2019:01:02 03:04:05")
+
+	date, found, err := ExifDate(content)
+	if err != nil || !found || date != "2019:01:02 03:04:05" {
+		t.Errorf("unexpected date %q, %t, %v", date, found, err)
+	}
+}
+
+func Test_ExifDate_uses_the_date_of_the_last_change_without_original_date(t *testing.T) {
+	content := createJpegWithDates(t, "2020:05:06 07:08:09", "")
+
+	date, found, err := ExifDate(content)
+	if err != nil || !found || date != "2020:05:06 07:08:09" {
+		t.Errorf("unexpected date %q, %t, %v", date, found, err)
+	}
+}
+
+func Test_ExifDate_without_exif(t *testing.T) {
+	_, found, err := ExifDate(encodeJpeg(t, createQuadrantImage()))
+	if err != nil || found {
+		t.Errorf("expected no date but got %t, %v", found, err)
+	}
+}
+
+func Test_ExifDate_does_not_support_other_formats(t *testing.T) {
+	_, _, err := ExifDate([]byte("\x89PNG\r\n\x1a\n"))
+	if err != ErrorUnsupportedFormat {
+		t.Errorf("expected ErrorUnsupportedFormat but got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	jpegMarkerAPP13 = 0xED
+	// the id of the photoshop image resource holding the IPTC-NAA records
+	photoshopResourceIptc = 0x0404
+	iptcTagMarker         = 0x1C
+	iptcRecordApplication = 2
+	iptcDatasetObjectName = 5
+	iptcDatasetKeywords   = 25
+	iptcDatasetCaption    = 120
+)
+
+var (
+	photoshopHeader    = []byte("Photoshop 3.0\x00")
+	photoshopSignature = []byte("8BIM")
+)
+
+// The IPTC fields of an image that describe it in the gallery.
+type Iptc struct {
+	// the ObjectName, which is the title of the image
+	Name string
+	// the Caption-Abstract
+	Caption  string
+	Keywords []string
+}
+
+func (i Iptc) IsEmpty() bool {
+	return i.Name == "" && i.Caption == "" && len(i.Keywords) == 0
+}
+
+// Returns the IPTC fields from the APP13 segment of jpeg images, e.g. the ones written by Lightroom. Returns false if
+// the image has no IPTC data. Values that are not valid UTF-8 are read as ISO-8859-1, the default of IPTC.
+func ReadIptc(content []byte) (Iptc, bool, error) {
+	if !isJpeg(content) {
+		return Iptc{}, false, ErrorUnsupportedFormat
+	}
+
+	segments, err := readJpegSegments(content)
+	if err != nil {
+		return Iptc{}, false, err
+	}
+
+	for _, segment := range segments {
+		payload := segment.payload(content)
+		if segment.marker != jpegMarkerAPP13 || !bytes.HasPrefix(payload, photoshopHeader) {
+			continue
+		}
+		records, err := findIptcResource(payload[len(photoshopHeader):])
+		if err != nil || records == nil {
+			return Iptc{}, false, err
+		}
+		iptc, err := parseIptcRecords(records)
+		if err != nil {
+			return Iptc{}, false, err
+		}
+		return iptc, !iptc.IsEmpty(), nil
+	}
+	return Iptc{}, false, nil
+}
+
+// Returns the data of the IPTC resource from the photoshop image resources or nil if there is none.
+func findIptcResource(resources []byte) ([]byte, error) {
+	position := 0
+	for position+len(photoshopSignature)+2 < len(resources) {
+		if !bytes.Equal(resources[position:position+4], photoshopSignature) {
+			return nil, errors.New("invalid signature of photoshop image resource")
+		}
+		id := binary.BigEndian.Uint16(resources[position+4 : position+6])
+		position += 6
+
+		// the name is a pascal string padded to an even size including its length byte
+		nameLength := int(resources[position]) + 1
+		position += nameLength + nameLength%2
+		if position+4 > len(resources) {
+			return nil, errors.New("invalid photoshop image resource name")
+		}
+
+		size := int(binary.BigEndian.Uint32(resources[position : position+4]))
+		position += 4
+		if size < 0 || position+size > len(resources) {
+			return nil, errors.New("invalid photoshop image resource size")
+		}
+		if id == photoshopResourceIptc {
+			return resources[position : position+size], nil
+		}
+		position += size + size%2
+	}
+	return nil, nil
+}
+
+func parseIptcRecords(records []byte) (Iptc, error) {
+	iptc := Iptc{}
+	position := 0
+	for position+5 <= len(records) {
+		if records[position] != iptcTagMarker {
+			// the records may be followed by padding
+			break
+		}
+		record, dataset := records[position+1], records[position+2]
+		size := int(binary.BigEndian.Uint16(records[position+3 : position+5]))
+		position += 5
+		if size&0x8000 != 0 {
+			return iptc, errors.New("extended IPTC datasets are not supported")
+		}
+		if position+size > len(records) {
+			return iptc, errors.New("invalid IPTC dataset size")
+		}
+		value := iptcString(records[position : position+size])
+		position += size
+
+		if record != iptcRecordApplication || value == "" {
+			continue
+		}
+		switch dataset {
+		case iptcDatasetObjectName:
+			iptc.Name = value
+		case iptcDatasetCaption:
+			iptc.Caption = value
+		case iptcDatasetKeywords:
+			iptc.Keywords = append(iptc.Keywords, value)
+		}
+	}
+	return iptc, nil
+}
+
+func iptcString(value []byte) string {
+	value = bytes.TrimRight(value, "\x00")
+	if utf8.Valid(value) {
+		return strings.TrimSpace(string(value))
+	}
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return strings.TrimSpace(string(runes))
+}
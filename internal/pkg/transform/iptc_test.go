@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type iptcDataset struct {
+	dataset byte
+	value   string
+}
+
+// Creates a jpeg with an APP13 segment holding an unrelated photoshop resource in front of the IPTC resource.
+func createJpegWithIptc(t *testing.T, datasets ...iptcDataset) []byte {
+	records := bytes.Buffer{}
+	for _, dataset := range datasets {
+		records.Write([]byte{iptcTagMarker, iptcRecordApplication, dataset.dataset})
+		_ = binary.Write(&records, binary.BigEndian, uint16(len(dataset.value)))
+		records.WriteString(dataset.value)
+	}
+
+	payload := bytes.Buffer{}
+	payload.Write(photoshopHeader)
+	payload.Write(photoshopSignature)
+	_ = binary.Write(&payload, binary.BigEndian, uint16(0x03ED))
+	payload.Write([]byte{0, 0})
+	_ = binary.Write(&payload, binary.BigEndian, uint32(3))
+	payload.Write([]byte{1, 2, 3, 0})
+	payload.Write(photoshopSignature)
+	_ = binary.Write(&payload, binary.BigEndian, uint16(photoshopResourceIptc))
+	payload.Write([]byte{0, 0})
+	_ = binary.Write(&payload, binary.BigEndian, uint32(records.Len()))
+	payload.Write(records.Bytes())
+
+	segment := bytes.Buffer{}
+	segment.Write([]byte{0xFF, jpegMarkerAPP13})
+	_ = binary.Write(&segment, binary.BigEndian, uint16(payload.Len()+2))
+	segment.Write(payload.Bytes())
+	return insertJpegSegments(encodeJpeg(t, createQuadrantImage()), segment.Bytes())
+}
+
+func Test_ReadIptc_returns_the_name_caption_and_keywords(t *testing.T) {
+	content := createJpegWithIptc(t,
+		iptcDataset{iptcDatasetObjectName, "Eiffel Tower"},
+		iptcDataset{iptcDatasetKeywords, "Paris"},
+		iptcDataset{0x37, "20190102"},
+		iptcDataset{iptcDatasetCaption, "The tower at night "},
+		iptcDataset{iptcDatasetKeywords, "Caf\xe9"},
+	)
+
+	iptc, found, err := ReadIptc(content)
+	if err != nil || !found {
+		t.Fatalf("expected IPTC data but got %t, %v", found, err)
+	}
+	expected := Iptc{Name: "Eiffel Tower", Caption: "The tower at night", Keywords: []string{"Paris", "Café"}}
+	if !reflect.DeepEqual(iptc, expected) {
+		t.Errorf("expected %+v but got %+v", expected, iptc)
+	}
+}
+
+func Test_ReadIptc_without_iptc(t *testing.T) {
+	for name, content := range map[string][]byte{
+		"no APP13":      encodeJpeg(t, createQuadrantImage()),
+		"empty records": createJpegWithIptc(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, found, err := ReadIptc(content)
+			if err != nil || found {
+				t.Errorf("expected no IPTC data but got %t, %v", found, err)
+			}
+		})
+	}
+}
+
+func Test_ReadIptc_rejects_truncated_datasets(t *testing.T) {
+	content := createJpegWithIptc(t, iptcDataset{iptcDatasetCaption, "caption"})
+	// the size of the caption points behind the records
+	position := bytes.Index(content, []byte("caption")) - 2
+	binary.BigEndian.PutUint16(content[position:], 0x1000)
+
+	_, _, err := ReadIptc(content)
+	if err == nil {
+		t.Error("expected an error for the truncated dataset")
+	}
+}
+
+func Test_ReadIptc_does_not_support_other_formats(t *testing.T) {
+	_, _, err := ReadIptc([]byte("\x89PNG\r\n\x1a\n"))
+	if err != ErrorUnsupportedFormat {
+		t.Errorf("expected ErrorUnsupportedFormat but got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"errors"
+)
+
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerAPP1 = 0xE1
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// A segment of the jpeg header. Start points to the 0xFF of the marker, end to the first byte after the segment.
+type jpegSegment struct {
+	marker byte
+	start  int
+	end    int
+}
+
+func (s jpegSegment) payload(content []byte) []byte {
+	return content[s.start+4 : s.end]
+}
+
+func isJpeg(content []byte) bool {
+	return len(content) > 3 && content[0] == 0xFF && content[1] == jpegMarkerSOI
+}
+
+// Reads all segments in front of the image data.
+func readJpegSegments(content []byte) ([]jpegSegment, error) {
+	if !isJpeg(content) {
+		return nil, errors.New("not a jpeg file")
+	}
+
+	segments := make([]jpegSegment, 0)
+	position := 2
+	for position+4 <= len(content) {
+		if content[position] != 0xFF {
+			return nil, errors.New("invalid jpeg segment marker")
+		}
+		marker := content[position+1]
+		if marker == 0xFF {
+			// fill bytes are allowed in front of a marker
+			position++
+			continue
+		}
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			break
+		}
+
+		length := int(content[position+2])<<8 | int(content[position+3])
+		end := position + 2 + length
+		if length < 2 || end > len(content) {
+			return nil, errors.New("invalid jpeg segment length")
+		}
+
+		segments = append(segments, jpegSegment{marker: marker, start: position, end: end})
+		position = end
+	}
+	return segments, nil
+}
+
+// Returns the APP1 segment containing the exif data or nil if there is none.
+func findExifSegment(content []byte) (*jpegSegment, error) {
+	segments, err := readJpegSegments(content)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		if segment.marker == jpegMarkerAPP1 && bytes.HasPrefix(segment.payload(content), exifHeader) {
+			return &segment, nil
+		}
+	}
+	return nil, nil
+}
+
+// Inserts the given segments (including marker and length) right after the start of image marker.
+func insertJpegSegments(content []byte, segments ...[]byte) []byte {
+	result := bytes.Buffer{}
+	result.Grow(len(content) + 64*1024)
+	result.Write(content[:2])
+	for _, segment := range segments {
+		result.Write(segment)
+	}
+	result.Write(content[2:])
+	return result.Bytes()
+}
+
+// Returns the content without the given segments.
+func removeJpegSegments(content []byte, segments []jpegSegment) []byte {
+	result := bytes.Buffer{}
+	result.Grow(len(content))
+	position := 0
+	for _, segment := range segments {
+		result.Write(content[position:segment.start])
+		position = segment.end
+	}
+	result.Write(content[position:])
+	return result.Bytes()
+}
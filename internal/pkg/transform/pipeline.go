@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// the quality used to encode jpeg images after a transformation
+const jpegQuality = 95
+
+// A transformation gets the content of an image and returns the transformed content.
+// If the transformation does not apply to the image, the content is returned with false.
+// All transformations have to be deterministic as the checksum and the upload transform the image independently.
+type Transformation func(content []byte) ([]byte, bool, error)
+
+// Returned by transformations that do not support the format of the image. The image is used unchanged.
+var ErrorUnsupportedFormat = errors.New("unsupported image format")
+
+type namedTransformation struct {
+	name           string
+	transformation Transformation
+}
+
+// The pipeline applies all transformations to an image before the md5sum gets calculated and before
+// the image gets uploaded. A nil pipeline does not transform anything.
+type Pipeline struct {
+	workDir         *workdir.WorkDir
+	transformations []namedTransformation
+}
+
+func NewPipeline(workDir *workdir.WorkDir) *Pipeline {
+	return &Pipeline{workDir: workDir}
+}
+
+func (p *Pipeline) Add(name string, transformation Transformation) {
+	logrus.Infof("Transforming images using %s before the upload", name)
+	p.transformations = append(p.transformations, namedTransformation{name: name, transformation: transformation})
+}
+
+func (p *Pipeline) IsEmpty() bool {
+	return p == nil || len(p.transformations) == 0
+}
+
+func (p *Pipeline) transform(filePath string) ([]byte, bool, error) {
+	file, err := localFileStructure.OpenFile(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	content, err := ioutil.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, false, err
+	}
+
+	transformed := false
+	for _, t := range p.transformations {
+		var changed bool
+		var transformedContent []byte
+		transformedContent, changed, err = t.transformation(content)
+		if err == ErrorUnsupportedFormat {
+			logrus.Warnf("%s: %s is not supported for this format. Using the image without it.", filePath, t.name)
+			continue
+		}
+		content = transformedContent
+		if err != nil {
+			logrus.Warnf("%s: could not apply %s - %s", filePath, t.name, err)
+			return nil, false, err
+		}
+		if changed {
+			logrus.Debugf("%s: applied %s", filePath, t.name)
+		}
+		transformed = transformed || changed
+	}
+	return content, transformed, nil
+}
+
+// Creates a calculator for the checksums of the transformed image as this is the content the server gets.
+func (p *Pipeline) NewChecksumCalculator(algorithm string) localFileStructure.ChecksumCalculator {
+	return func(filePath string) (string, string, error) {
+		content, _, err := p.transform(filePath)
+		if err != nil {
+			return "", "", err
+		}
+
+		md5sum, checksum, err := localFileStructure.CalculateCheckSums(bytes.NewReader(content), algorithm)
+		logrus.Tracef("Calculated md5 sum of transformed %s - %s, checksum %s", filePath, md5sum, checksum)
+		return md5sum, checksum, err
+	}
+}
+
+// Writes the transformed image to the work directory and returns the path of the file to upload.
+// The file keeps its name to preserve the original filename. If nothing got transformed,
+// the original path is returned. The returned cleanup function has to be called after the upload.
+func (p *Pipeline) Prepare(filePath string) (string, func(), error) {
+	noCleanup := func() {}
+	if p.IsEmpty() {
+		return filePath, noCleanup, nil
+	}
+
+	content, transformed, err := p.transform(filePath)
+	if err != nil {
+		return "", noCleanup, err
+	}
+	if !transformed {
+		return filePath, noCleanup, nil
+	}
+
+	directory, err := ioutil.TempDir(p.workDir.Path(), "transformed")
+	if err != nil {
+		return "", noCleanup, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(directory)
+	}
+
+	transformedPath := filepath.Join(directory, filepath.Base(filePath))
+	err = ioutil.WriteFile(transformedPath, content, 0600)
+	if err != nil {
+		cleanup()
+		return "", noCleanup, err
+	}
+
+	logrus.Debugf("%s: using transformed file %s", filePath, transformedPath)
+	return transformedPath, cleanup, nil
+}
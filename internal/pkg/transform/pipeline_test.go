@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"crypto/md5"
+	"fmt"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/localFileStructure"
+	"git.haefelfinger.net/piwigo/PiwigoDirectoryUploader/internal/pkg/workdir"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Prepare_keeps_the_file_name_and_matches_the_checksum(t *testing.T) {
+	pipeline, source := createPipelineWithImage(t, createJpegWithOrientation(t, 6))
+	pipeline.Add("auto rotation", AutoRotate)
+
+	md5sum, _, err := pipeline.NewChecksumCalculator(localFileStructure.ChecksumMd5)(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepared, cleanup, err := pipeline.Prepare(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prepared == source {
+		t.Fatal("expected a transformed file")
+	}
+	if filepath.Base(prepared) != filepath.Base(source) {
+		t.Errorf("expected file name %s but got %s", filepath.Base(source), filepath.Base(prepared))
+	}
+
+	content, err := ioutil.ReadFile(prepared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%x", md5.Sum(content)) != md5sum {
+		t.Error("the md5sum of the uploaded file does not match the calculated one")
+	}
+
+	cleanup()
+	if _, err := os.Stat(prepared); !os.IsNotExist(err) {
+		t.Error("expected the transformed file to be removed on cleanup")
+	}
+}
+
+func Test_Prepare_returns_original_if_nothing_changed(t *testing.T) {
+	pipeline, source := createPipelineWithImage(t, createJpegWithOrientation(t, 1))
+	pipeline.Add("auto rotation", AutoRotate)
+
+	prepared, cleanup, err := pipeline.Prepare(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if prepared != source {
+		t.Errorf("expected the original file %s but got %s", source, prepared)
+	}
+}
+
+func Test_Prepare_uses_unsupported_formats_unchanged(t *testing.T) {
+	pipeline, source := createPipelineWithImage(t, []byte("\x89PNG\r\n\x1a\n"))
+	pipeline.Add("gps removal", StripGps)
+
+	prepared, cleanup, err := pipeline.Prepare(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if prepared != source {
+		t.Errorf("expected the original file %s but got %s", source, prepared)
+	}
+}
+
+func Test_Prepare_on_nil_pipeline_returns_original(t *testing.T) {
+	var pipeline *Pipeline
+
+	prepared, cleanup, err := pipeline.Prepare("/some/image.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if prepared != "/some/image.jpg" {
+		t.Errorf("expected the original file but got %s", prepared)
+	}
+}
+
+func createPipelineWithImage(t *testing.T, content []byte) (*Pipeline, string) {
+	dir, err := ioutil.TempDir("", "transformtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	source := filepath.Join(dir, "IMG_0001.jpg")
+	err = ioutil.WriteFile(source, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := workdir.Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPipeline(wd), source
+}
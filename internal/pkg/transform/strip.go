@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+)
+
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// Removes the GPS position from the exif data of jpeg images. XMP data containing a GPS position is removed as well.
+// The image data is copied as is, so the pixels do not change. Other formats are not supported.
+func StripGps(content []byte) ([]byte, bool, error) {
+	if !isJpeg(content) {
+		return content, false, ErrorUnsupportedFormat
+	}
+
+	segments, err := readJpegSegments(content)
+	if err != nil {
+		return content, false, err
+	}
+
+	stripped := make([]byte, len(content))
+	copy(stripped, content)
+	changed := false
+	toRemove := make([]jpegSegment, 0)
+	for _, segment := range segments {
+		if segment.marker != jpegMarkerAPP1 {
+			continue
+		}
+
+		payload := segment.payload(stripped)
+		if bytes.HasPrefix(payload, xmpHeader) && bytes.Contains(payload, []byte("GPS")) {
+			toRemove = append(toRemove, segment)
+			continue
+		}
+		if !bytes.HasPrefix(payload, exifHeader) {
+			continue
+		}
+
+		exif, err := parseExif(payload)
+		if err != nil {
+			return content, false, err
+		}
+		removed, err := exif.removeGps()
+		if err != nil {
+			return content, false, err
+		}
+		changed = changed || removed
+	}
+
+	if len(toRemove) > 0 {
+		return removeJpegSegments(stripped, toRemove), true, nil
+	}
+	return stripped, changed, nil
+}
+
+// Removes all exif and XMP data of jpeg images. The image data is copied as is, so the pixels do not change.
+// Other formats are not supported.
+func StripAllExif(content []byte) ([]byte, bool, error) {
+	if !isJpeg(content) {
+		return content, false, ErrorUnsupportedFormat
+	}
+
+	segments, err := readJpegSegments(content)
+	if err != nil {
+		return content, false, err
+	}
+
+	toRemove := make([]jpegSegment, 0)
+	for _, segment := range segments {
+		payload := segment.payload(content)
+		if segment.marker == jpegMarkerAPP1 && (bytes.HasPrefix(payload, exifHeader) || bytes.HasPrefix(payload, xmpHeader)) {
+			toRemove = append(toRemove, segment)
+		}
+	}
+
+	if len(toRemove) == 0 {
+		return content, false, nil
+	}
+	return removeJpegSegments(content, toRemove), true, nil
+}
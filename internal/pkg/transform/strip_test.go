@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"testing"
+)
+
+// a value of the gps latitude that is easy to find in the file
+const gpsMarker = uint32(0x47505331)
+
+// Creates a jpeg with an exif segment containing the orientation and a GPS IFD with latitude ref and latitude.
+func createJpegWithGps(t *testing.T) []byte {
+	order := binary.LittleEndian
+	tiff := bytes.Buffer{}
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, order, uint16(42))
+	_ = binary.Write(&tiff, order, uint32(8))
+
+	// IFD0 at 8 with two entries, the GPS IFD follows at 8+2+2*12+4 = 38
+	_ = binary.Write(&tiff, order, uint16(2))
+	_ = binary.Write(&tiff, order, []uint16{exifTagOrientation, exifTypeShort})
+	_ = binary.Write(&tiff, order, uint32(1))
+	_ = binary.Write(&tiff, order, []uint16{6, 0})
+	_ = binary.Write(&tiff, order, []uint16{exifTagGpsIfd, 4})
+	_ = binary.Write(&tiff, order, []uint32{1, 38})
+	_ = binary.Write(&tiff, order, uint32(0))
+
+	// GPS IFD with two entries, the latitude values follow at 38+2+2*12+4 = 68
+	_ = binary.Write(&tiff, order, uint16(2))
+	_ = binary.Write(&tiff, order, []uint16{0x0001, 2})
+	_ = binary.Write(&tiff, order, uint32(2))
+	tiff.Write([]byte{'N', 0, 0, 0})
+	_ = binary.Write(&tiff, order, []uint16{0x0002, 5})
+	_ = binary.Write(&tiff, order, []uint32{3, 68})
+	_ = binary.Write(&tiff, order, uint32(0))
+	_ = binary.Write(&tiff, order, []uint32{gpsMarker, 1, gpsMarker, 1, gpsMarker, 1})
+
+	return insertJpegSegments(encodeJpeg(t, createQuadrantImage()), createApp1Segment(append(exifHeader, tiff.Bytes()...)))
+}
+
+func containsGpsMarker(content []byte) bool {
+	marker := make([]byte, 4)
+	binary.LittleEndian.PutUint32(marker, gpsMarker)
+	return bytes.Contains(content, marker)
+}
+
+func Test_StripGps_removes_gps_and_keeps_other_exif_and_pixels(t *testing.T) {
+	content := createJpegWithGps(t)
+	if !containsGpsMarker(content) {
+		t.Fatal("the fixture does not contain the gps position")
+	}
+
+	stripped, changed, err := StripGps(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("the gps position was not removed")
+	}
+	if containsGpsMarker(stripped) || bytes.Contains(stripped, []byte{'N', 0, 0, 0}) {
+		t.Error("the gps position is still part of the file")
+	}
+
+	segment, err := findExifSegment(stripped)
+	if err != nil || segment == nil {
+		t.Fatalf("the exif data was removed - %v", err)
+	}
+	exif, err := parseExif(segment.payload(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gps, err := exif.findIfd0Entry(exifTagGpsIfd)
+	if err != nil || gps != nil {
+		t.Errorf("the gps ifd is still referenced - %v", err)
+	}
+	assertOrientation(t, stripped, 6)
+
+	// the image data behind the exif segment is copied untouched
+	if !bytes.Equal(stripped[segment.end:], content[segment.end:]) {
+		t.Error("the image data changed")
+	}
+}
+
+func Test_StripGps_ignores_images_without_gps(t *testing.T) {
+	content := createJpegWithOrientation(t, 3)
+
+	stripped, changed, err := StripGps(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || !bytes.Equal(stripped, content) {
+		t.Error("an image without gps position was changed")
+	}
+}
+
+func Test_StripGps_removes_xmp_with_gps(t *testing.T) {
+	xmp := append(append([]byte{}, xmpHeader...), []byte(`<x:xmpmeta><rdf:Description exif:GPSLatitude="47,22.5N"/></x:xmpmeta>`)...)
+	content := insertJpegSegments(encodeJpeg(t, createQuadrantImage()), createApp1Segment(xmp))
+
+	stripped, changed, err := StripGps(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || bytes.Contains(stripped, []byte("GPSLatitude")) {
+		t.Error("the xmp gps position was not removed")
+	}
+	if _, err = jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("the stripped image is no longer valid - %s", err)
+	}
+}
+
+func Test_StripAllExif_removes_the_exif_segment(t *testing.T) {
+	content := createJpegWithGps(t)
+
+	stripped, changed, err := StripAllExif(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("the exif data was not removed")
+	}
+
+	segment, err := findExifSegment(stripped)
+	if err != nil || segment != nil {
+		t.Errorf("the exif data is still part of the file - %v", err)
+	}
+	withoutExif := encodeJpeg(t, createQuadrantImage())
+	if !bytes.Equal(stripped, withoutExif) {
+		t.Error("the image data changed")
+	}
+}
+
+func Test_Strip_does_not_support_other_formats(t *testing.T) {
+	content := []byte("\x89PNG\r\n\x1a\n")
+	for _, strip := range []Transformation{StripGps, StripAllExif} {
+		_, changed, err := strip(content)
+		if err != ErrorUnsupportedFormat || changed {
+			t.Errorf("expected the unsupported format error but got %v", err)
+		}
+	}
+}
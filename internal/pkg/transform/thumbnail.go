@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"errors"
+)
+
+const (
+	// the position and the size of the jpeg thumbnail in IFD1
+	exifTagThumbnailOffset = 0x0201
+	exifTagThumbnailLength = 0x0202
+	exifTypeLong           = 4
+)
+
+// Returns the thumbnail embedded in the exif data of jpeg images, which most cameras write with a width of 160
+// pixels. Returns false if the image has no jpeg thumbnail.
+func ExifThumbnail(content []byte) ([]byte, bool, error) {
+	if !isJpeg(content) {
+		return nil, false, ErrorUnsupportedFormat
+	}
+
+	segment, err := findExifSegment(content)
+	if err != nil || segment == nil {
+		return nil, false, err
+	}
+	exif, err := parseExif(segment.payload(content))
+	if err != nil {
+		return nil, false, err
+	}
+
+	ifd1Offset, err := exif.nextIfdOffset(exif.ifd0Offset())
+	if err != nil || ifd1Offset == 0 {
+		return nil, false, err
+	}
+	offsetEntry, err := exif.findEntry(ifd1Offset, exifTagThumbnailOffset)
+	if err != nil || offsetEntry == nil {
+		return nil, false, err
+	}
+	lengthEntry, err := exif.findEntry(ifd1Offset, exifTagThumbnailLength)
+	if err != nil || lengthEntry == nil {
+		return nil, false, err
+	}
+
+	offset, err := exif.longValue(offsetEntry)
+	if err != nil {
+		return nil, false, err
+	}
+	length, err := exif.longValue(lengthEntry)
+	if err != nil {
+		return nil, false, err
+	}
+	if length == 0 || uint64(offset)+uint64(length) > uint64(len(exif.tiff)) {
+		return nil, false, errors.New("invalid position of the exif thumbnail")
+	}
+
+	thumbnail := exif.tiff[offset : offset+length]
+	if !isJpeg(thumbnail) {
+		// thumbnails of old cameras may be uncompressed
+		return nil, false, nil
+	}
+	// the thumbnail is copied as it refers to the content of the image
+	return append([]byte(nil), thumbnail...), true, nil
+}
+
+// Returns the offset of the IFD following the IFD at the given offset or zero if it is the last one.
+func (e *exifData) nextIfdOffset(offset uint32) (uint32, error) {
+	entries, err := e.readIfd(offset)
+	if err != nil {
+		return 0, err
+	}
+	position := int(offset) + 2 + len(entries)*12
+	return e.order.Uint32(e.tiff[position : position+4]), nil
+}
+
+func (e *exifData) longValue(entry *ifdEntry) (uint32, error) {
+	if entry.count != 1 {
+		return 0, errors.New("invalid count of exif value")
+	}
+	switch entry.fieldType {
+	case exifTypeLong:
+		return e.order.Uint32(e.tiff[entry.position+8 : entry.position+12]), nil
+	case exifTypeShort:
+		return uint32(e.order.Uint16(e.tiff[entry.position+8 : entry.position+10])), nil
+	default:
+		return 0, errors.New("invalid type of exif value")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Creates a jpeg with an empty IFD0 followed by IFD1 pointing to the given thumbnail.
+func createJpegWithThumbnail(t *testing.T, thumbnail []byte) []byte {
+	order := binary.LittleEndian
+	tiff := bytes.Buffer{}
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, order, uint16(42))
+	_ = binary.Write(&tiff, order, uint32(8))
+
+	// IFD0 at 8 without entries, IFD1 follows at 8+2+4 = 14 and the thumbnail at 14+2+2*12+4 = 44
+	_ = binary.Write(&tiff, order, uint16(0))
+	_ = binary.Write(&tiff, order, uint32(14))
+	_ = binary.Write(&tiff, order, uint16(2))
+	_ = binary.Write(&tiff, order, []uint16{exifTagThumbnailOffset, exifTypeLong})
+	_ = binary.Write(&tiff, order, []uint32{1, 44})
+	_ = binary.Write(&tiff, order, []uint16{exifTagThumbnailLength, exifTypeLong})
+	_ = binary.Write(&tiff, order, []uint32{1, uint32(len(thumbnail))})
+	_ = binary.Write(&tiff, order, uint32(0))
+	tiff.Write(thumbnail)
+
+	return insertJpegSegments(encodeJpeg(t, createQuadrantImage()), createApp1Segment(append(exifHeader, tiff.Bytes()...)))
+}
+
+func Test_ExifThumbnail_returns_the_embedded_thumbnail(t *testing.T) {
+	small := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	small.Set(0, 0, color.RGBA{R: 255, A: 255})
+	thumbnail := encodeJpeg(t, small)
+
+	content, found, err := ExifThumbnail(createJpegWithThumbnail(t, thumbnail))
+	if err != nil || !found {
+		t.Fatalf("expected the thumbnail but got %t, %v", found, err)
+	}
+	if !bytes.Equal(content, thumbnail) {
+		t.Error("expected the embedded thumbnail")
+	}
+}
+
+func Test_ExifThumbnail_without_thumbnail(t *testing.T) {
+	_, found, err := ExifThumbnail(createJpegWithOrientation(t, 1))
+	if err != nil || found {
+		t.Errorf("expected no thumbnail but got %t, %v", found, err)
+	}
+}
+
+func Test_ExifThumbnail_rejects_empty_thumbnails(t *testing.T) {
+	_, _, err := ExifThumbnail(createJpegWithThumbnail(t, nil))
+	if err == nil {
+		t.Error("expected an error for a thumbnail without content")
+	}
+}
+
+func Test_ExifThumbnail_does_not_support_other_formats(t *testing.T) {
+	_, _, err := ExifThumbnail([]byte("\x89PNG\r\n\x1a\n"))
+	if err != ErrorUnsupportedFormat {
+		t.Errorf("expected ErrorUnsupportedFormat but got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package workdir
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+)
+
+// The WorkDir holds all transient files created during a run (e.g. resized or transformed images).
+// Every run gets its own directory that is removed with all its content at the end of the run.
+type WorkDir struct {
+	path string
+}
+
+// Creates a new run specific directory below the given base directory.
+// If the base directory is empty, the temporary directory of the operating system is used.
+func Create(baseDir string) (*WorkDir, error) {
+	if baseDir != "" {
+		err := os.MkdirAll(baseDir, 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := ioutil.TempDir(baseDir, "PiwigoDirectoryUploader")
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("Using work directory %s", path)
+	return &WorkDir{path: path}, nil
+}
+
+func (w *WorkDir) Path() string {
+	return w.path
+}
+
+// Creates a new file in the work directory. The pattern is handled the same way as in ioutil.TempFile.
+// The caller is responsible to close the file but does not need to remove it.
+func (w *WorkDir) CreateFile(pattern string) (*os.File, error) {
+	if w.path == "" {
+		return nil, errors.New("the work directory is already removed")
+	}
+	return ioutil.TempFile(w.path, pattern)
+}
+
+// Removes the work directory and all transient files. It is safe to call remove multiple times.
+func (w *WorkDir) Remove() error {
+	if w.path == "" {
+		return nil
+	}
+
+	logrus.Debugf("Removing work directory %s", w.path)
+	err := os.RemoveAll(w.path)
+	if err == nil {
+		w.path = ""
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2020 Philipp Haefelfinger (http://www.haefelfinger.ch/). All Rights Reserved.
+ * This application is licensed under GPLv2. See the LICENSE file in the root directory of the project.
+ */
+
+package workdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_workdir_is_created_below_base_and_removed(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "workdirtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	workDir, err := Create(filepath.Join(baseDir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := workDir.Path()
+
+	file, err := workDir.CreateFile("image*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	if filepath.Dir(file.Name()) != path {
+		t.Errorf("The file %s was not created in the work directory %s", file.Name(), path)
+	}
+
+	err = workDir.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("The work directory %s still exists", path)
+	}
+
+	if workDir.Remove() != nil {
+		t.Error("Removing the work directory twice should not fail")
+	}
+}